@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var client = &http.Client{Timeout: 5 * time.Minute}
+
+// call sends a request with header to a service and decodes a JSON
+// response into out. Admin endpoints get the ADMIN_API_KEY bearer token.
+func call(method, url string, header http.Header, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if key := os.Getenv("ADMIN_API_KEY"); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func callJSON(method, url string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	return call(method, url, http.Header{"Content-Type": {"application/json"}}, body, out)
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	kind := fs.String("type", "file", "upload endpoint: file, slack or chat")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one file to import")
+	}
+	switch *kind {
+	case "file", "slack", "chat":
+	default:
+		return fmt.Errorf("unknown import type %q", *kind)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(f.Name()))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	form.Close()
+
+	// The uploader takes the key of the user the file is uploaded as
+	header := http.Header{"Content-Type": {form.FormDataContentType()}}
+	if key := os.Getenv("UPLOAD_API_KEY"); key != "" {
+		header.Set("X-API-Key", key)
+	}
+	var result map[string]interface{}
+	url := envOr("UPLOADER_URL", "http://localhost:8083") + "/upload/" + *kind
+	if err := call(http.MethodPost, url, header, &body, &result); err != nil {
+		return err
+	}
+	printJSON(result)
+	return nil
+}
+
+func runCollect(args []string) error {
+	var result struct {
+		Queued bool `json:"queued"`
+	}
+	if err := callJSON(http.MethodPost, envOr("COLLECTOR_URL", "http://localhost:8082")+"/collect", nil, &result); err != nil {
+		return err
+	}
+	if result.Queued {
+		fmt.Println("✅ Collection cycle started")
+	} else {
+		fmt.Println("⏳ A collection cycle is already pending")
+	}
+	return nil
+}
+
+func runStatus(args []string) error {
+	var report json.RawMessage
+	if err := callJSON(http.MethodGet, envOr("GATEWAY_URL", "http://localhost:8080")+"/admin/system", nil, &report); err != nil {
+		return err
+	}
+	printJSON(report)
+	return nil
+}
+
+func runRescore(args []string) error {
+	var result struct {
+		Scanned int `json:"scanned"`
+		Updated int `json:"updated"`
+	}
+	if err := callJSON(http.MethodPost, envOr("COLLECTOR_URL", "http://localhost:8082")+"/rescore", nil, &result); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Rescored %d items, %d changed\n", result.Scanned, result.Updated)
+	return nil
+}
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	limit := fs.Int("limit", 10, "maximum results")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("expected a query")
+	}
+
+	req := map[string]interface{}{
+		"name": "search_content",
+		"arguments": map[string]interface{}{
+			"query": strings.Join(fs.Args(), " "),
+			"limit": *limit,
+		},
+	}
+	var resp struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := callJSON(http.MethodPost, envOr("MCP_SERVER_URL", "http://localhost:8084")+"/mcp/call", req, &resp); err != nil {
+		return err
+	}
+	for _, c := range resp.Content {
+		fmt.Println(c.Text)
+	}
+	return nil
+}
+
+func runKeys(args []string) error {
+	url := envOr("GATEWAY_URL", "http://localhost:8080") + "/admin/api-keys"
+	if len(args) == 0 {
+		return fmt.Errorf("expected list, create <name> or revoke <name>")
+	}
+
+	switch args[0] {
+	case "list":
+		var result struct {
+			Keys []struct {
+				Name      string    `json:"name"`
+				Workspace string    `json:"workspace_id"`
+				Role      string    `json:"role"`
+				Hint      string    `json:"hint"`
+				CreatedAt time.Time `json:"created_at"`
+			} `json:"keys"`
+		}
+		if err := callJSON(http.MethodGet, url, nil, &result); err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tWORKSPACE\tROLE\tKEY\tCREATED")
+		for _, k := range result.Keys {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t…%s\t%s\n", k.Name, k.Workspace, k.Role, k.Hint, k.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+		workspace := fs.String("workspace", "default", "workspace the key is scoped to")
+		role := fs.String("role", "reader", "role granted to the key: reader, editor or admin")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			return fmt.Errorf("expected a key name")
+		}
+		var result struct {
+			Key string `json:"key"`
+		}
+		body := map[string]string{"name": fs.Arg(0), "workspace_id": *workspace, "role": *role}
+		if err := callJSON(http.MethodPost, url, body, &result); err != nil {
+			return err
+		}
+		fmt.Printf("🔑 %s\n", result.Key)
+		fmt.Fprintln(os.Stderr, "Store this key now; it cannot be shown again.")
+		return nil
+
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("expected a key name")
+		}
+		if err := callJSON(http.MethodDelete, url+"?name="+neturl.QueryEscape(args[1]), nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Revoked %s\n", args[1])
+		return nil
+	}
+	return fmt.Errorf("unknown keys command %q", args[0])
+}
+
+// reindexJob is the progress the MCP server reports for a reindex job.
+type reindexJob struct {
+	ID         int64      `json:"id"`
+	Steps      []string   `json:"steps"`
+	Status     string     `json:"status"`
+	Processed  int64      `json:"processed"`
+	Total      int64      `json:"total"`
+	Percent    float64    `json:"percent"`
+	RowsPerSec float64    `json:"rows_per_sec"`
+	ETA        *time.Time `json:"eta"`
+	Error      string     `json:"error"`
+}
+
+func (j reindexJob) print() {
+	line := fmt.Sprintf("Job %d (%s): %s, %d/%d rows (%.1f%%)", j.ID, strings.Join(j.Steps, ","), j.Status, j.Processed, j.Total, j.Percent)
+	if j.RowsPerSec > 0 {
+		line += fmt.Sprintf(", %.0f rows/s", j.RowsPerSec)
+	}
+	if j.ETA != nil {
+		line += fmt.Sprintf(", done in ~%s", time.Until(*j.ETA).Round(time.Second))
+	}
+	if j.Error != "" {
+		line += ": " + j.Error
+	}
+	fmt.Println(line)
+}
+
+func runReindex(args []string) error {
+	url := envOr("GATEWAY_URL", "http://localhost:8080") + "/admin/reindex"
+	if len(args) == 0 {
+		return fmt.Errorf("expected start, status, pause, resume or cancel")
+	}
+
+	var job reindexJob
+	wait := false
+	switch args[0] {
+	case "start":
+		fs := flag.NewFlagSet("reindex start", flag.ExitOnError)
+		steps := fs.String("steps", "", "comma-separated steps: search_vector, tags, embeddings (default search_vector,tags)")
+		batch := fs.Int("batch", 0, "rows per batch (default 500)")
+		throttle := fs.String("throttle", "", "pause between batches (default 100ms)")
+		fs.BoolVar(&wait, "wait", false, "follow progress until the job stops")
+		fs.Parse(args[1:])
+		body := map[string]interface{}{"batch_size": *batch, "throttle": *throttle}
+		if *steps != "" {
+			body["steps"] = strings.Split(*steps, ",")
+		}
+		if err := callJSON(http.MethodPost, url, body, &job); err != nil {
+			return err
+		}
+	case "status":
+		fs := flag.NewFlagSet("reindex status", flag.ExitOnError)
+		fs.BoolVar(&wait, "wait", false, "follow progress until the job stops")
+		fs.Parse(args[1:])
+		if err := callJSON(http.MethodGet, url, nil, &job); err != nil {
+			return err
+		}
+	case "pause", "resume":
+		if err := callJSON(http.MethodPost, url+"/"+args[0], nil, &job); err != nil {
+			return err
+		}
+	case "cancel":
+		if err := callJSON(http.MethodDelete, url, nil, &job); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown reindex command %q", args[0])
+	}
+
+	job.print()
+	for wait && job.Status == "running" {
+		time.Sleep(5 * time.Second)
+		job = reindexJob{}
+		if err := callJSON(http.MethodGet, url, nil, &job); err != nil {
+			return err
+		}
+		job.print()
+	}
+	if job.Status == "failed" {
+		return fmt.Errorf("reindex job %d failed; fix the cause and run selinctl reindex resume", job.ID)
+	}
+	return nil
+}
+
+// jobRun is a run of a scheduled job as the scheduler reports it.
+type jobRun struct {
+	ID         int64      `json:"id"`
+	Trigger    string     `json:"trigger"`
+	Status     string     `json:"status"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	HTTPStatus int        `json:"http_status"`
+	Output     string     `json:"output"`
+}
+
+func runJobs(args []string) error {
+	url := envOr("GATEWAY_URL", "http://localhost:8080") + "/admin/jobs"
+	if len(args) == 0 {
+		return fmt.Errorf("expected list, runs <name>, trigger <name>, pause <name> or resume <name>")
+	}
+	if args[0] != "list" && len(args) != 2 {
+		return fmt.Errorf("expected a job name")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	switch args[0] {
+	case "list":
+		var result struct {
+			Jobs []struct {
+				Name      string     `json:"name"`
+				Schedule  string     `json:"schedule"`
+				Paused    bool       `json:"paused"`
+				NextRunAt *time.Time `json:"next_run_at"`
+				LastRun   *jobRun    `json:"last_run"`
+				Error     string     `json:"error"`
+			} `json:"jobs"`
+		}
+		if err := callJSON(http.MethodGet, url, nil, &result); err != nil {
+			return err
+		}
+		fmt.Fprintln(tw, "NAME\tSCHEDULE\tNEXT RUN\tLAST RUN")
+		for _, j := range result.Jobs {
+			next := "-"
+			switch {
+			case j.Error != "":
+				next = j.Error
+			case j.Paused:
+				next = "paused"
+			case j.NextRunAt != nil:
+				next = j.NextRunAt.Format(time.RFC3339)
+			}
+			last := "-"
+			if j.LastRun != nil {
+				last = fmt.Sprintf("%s (%s)", j.LastRun.Status, j.LastRun.QueuedAt.Format(time.RFC3339))
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", j.Name, j.Schedule, next, last)
+		}
+		return tw.Flush()
+
+	case "runs":
+		var result struct {
+			Runs []jobRun `json:"runs"`
+		}
+		if err := callJSON(http.MethodGet, url+"/"+args[1]+"/runs", nil, &result); err != nil {
+			return err
+		}
+		fmt.Fprintln(tw, "ID\tTRIGGER\tSTATUS\tQUEUED\tHTTP\tOUTPUT")
+		for _, r := range result.Runs {
+			output := strings.Join(strings.Fields(r.Output), " ")
+			if len(output) > 60 {
+				output = output[:60] + "…"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\n", r.ID, r.Trigger, r.Status, r.QueuedAt.Format(time.RFC3339), r.HTTPStatus, output)
+		}
+		return tw.Flush()
+
+	case "trigger", "pause", "resume":
+		var result interface{}
+		if err := callJSON(http.MethodPost, url+"/"+args[1]+"/"+args[0], nil, &result); err != nil {
+			return err
+		}
+		printJSON(result)
+		return nil
+	}
+	return fmt.Errorf("unknown jobs command %q", args[0])
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"selin/internal/config"
+	"selin/internal/llm"
+	"selin/internal/search"
+)
+
+func openDB() (*sql.DB, error) {
+	db, err := sql.Open("postgres", config.PostgresDSN("selinctl"))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return db, nil
+}
+
+// stripPSQLCommands drops psql meta-commands such as \c and \echo, which
+// only psql understands, so the schema script can be sent as plain SQL.
+func stripPSQLCommands(script string) string {
+	var out strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), `\`) {
+			continue
+		}
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// runMigrate applies the schema script. Every statement in it is
+// idempotent, so it is safe to run against an existing database.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	file := fs.String("file", "scripts/init-database.sql", "schema script to apply")
+	fs.Parse(args)
+
+	script, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(stripPSQLCommands(string(script))); err != nil {
+		return fmt.Errorf("migration failed: %v", err)
+	}
+	fmt.Printf("✅ Applied %s\n", *file)
+	return nil
+}
+
+// BackupRecord is one line of a backup file.
+type BackupRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// runBackup writes every row of the selected tables (all tables by
+// default) as JSON lines.
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", "selin-backup.jsonl", "output file, - for stdout")
+	only := fs.String("tables", "", "comma-separated tables to export")
+	fs.Parse(args)
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tables, err := backupTables(db, *only)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	for _, table := range tables {
+		rows, err := db.Query(fmt.Sprintf("SELECT row_to_json(t) FROM %s t", pq.QuoteIdentifier(table)))
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %v", table, err)
+		}
+		count := 0
+		for rows.Next() {
+			var row json.RawMessage
+			if err := rows.Scan(&row); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to export %s: %v", table, err)
+			}
+			if err := enc.Encode(BackupRecord{Table: table, Row: row}); err != nil {
+				rows.Close()
+				return err
+			}
+			count++
+		}
+		rows.Close()
+		fmt.Fprintf(os.Stderr, "📦 %s: %d rows\n", table, count)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "✅ Backup written to %s\n", *output)
+	}
+	return nil
+}
+
+func backupTables(db *sql.DB, only string) ([]string, error) {
+	if only != "" {
+		return strings.Split(only, ","), nil
+	}
+	rows, err := db.Query(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = 'public' AND table_type = 'BASE TABLE'
+		ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// runEmbeddings reports and purges the embedding cache. Purging by model
+// frees what a model no longer in use left behind; -unused drops entries
+// no embedding run has asked for in that long.
+func runEmbeddings(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected stats or purge")
+	}
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	cache := llm.NewSQLEmbedCache(db)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "stats":
+		stats, err := cache.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		if len(stats) == 0 {
+			fmt.Println("The embedding cache is empty")
+		}
+		for _, s := range stats {
+			fmt.Printf("%-32s %8d entries %10.1f MB  last used %s\n",
+				s.Model, s.Entries, float64(s.Bytes)/(1<<20), s.LastUsedAt.Format(time.RFC3339))
+		}
+		return nil
+	case "purge":
+		fs := flag.NewFlagSet("embeddings purge", flag.ExitOnError)
+		model := fs.String("model", "", "only purge this model's entries")
+		unused := fs.Duration("unused", 0, "only purge entries unused for this long, such as 720h")
+		all := fs.Bool("all", false, "purge every entry when neither -model nor -unused is given")
+		fs.Parse(args[1:])
+		if *model == "" && *unused == 0 && !*all {
+			return fmt.Errorf("give -model, -unused or -all")
+		}
+		n, err := cache.Purge(ctx, llm.PurgeFilter{Model: *model, UnusedFor: *unused})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Purged %d cached embeddings\n", n)
+		return nil
+	default:
+		return fmt.Errorf("unknown embeddings command %q", args[0])
+	}
+}
+
+// runSearchEval replays judged queries through each ranker configuration
+// and compares how well they rank the content judged relevant.
+func runSearchEval(args []string) error {
+	fs := flag.NewFlagSet("search-eval", flag.ExitOnError)
+	file := fs.String("judgments", "", "judgments as JSON lines (default: logged queries with relevant_content_ids)")
+	workspace := fs.String("workspace", "", "only replay this workspace's logged queries")
+	queries := fs.Int("queries", 500, "most logged queries to replay")
+	configs := fs.String("configs", "classic;hybrid", "rankers to compare, separated by ';': classic, hybrid, or hybrid weights such as keyword=0.7,vector=0.3")
+	k := fs.Int("k", 10, "results judged per query")
+	freshness := fs.Float64("freshness", 60, "half-life in days, 0 for none")
+	fs.Parse(args)
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	var judgments []search.Judgment
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		judgments, err = search.ReadJudgments(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *file, err)
+		}
+	} else if judgments, err = search.LoggedJudgments(ctx, db, *workspace, *queries); err != nil {
+		return err
+	}
+	if len(judgments) == 0 {
+		return fmt.Errorf("no judged queries to replay")
+	}
+
+	var vectors search.Vectors
+	if client := llm.Default(); client != nil {
+		if v := search.WeaviateFromEnv(func(ctx context.Context, text string) ([]float32, error) {
+			out, err := client.Embed(ctx, "search_eval", []string{text})
+			if err != nil {
+				return nil, err
+			}
+			return out[0], nil
+		}); v != nil {
+			vectors = v
+		}
+	}
+
+	fmt.Printf("%d queries, top %d\n\n%-48s %7s %7s %7s\n", len(judgments), *k, "ranker", "ndcg", "mrr", "recall")
+	for _, config := range strings.Split(*configs, ";") {
+		config = strings.TrimSpace(config)
+		var weights *search.Weights
+		switch config {
+		case "classic":
+		case "hybrid":
+			w := search.DefaultWeights
+			weights = &w
+		default:
+			w, err := search.ParseWeights(config, search.DefaultWeights)
+			if err != nil {
+				return err
+			}
+			weights = &w
+		}
+		m, err := search.Evaluate(judgments, *k, func(j search.Judgment) ([]string, error) {
+			ws := j.Workspace
+			if ws == "" {
+				ws = "default"
+			}
+			result, err := search.Search(ctx, db, search.SearchRequest{
+				Workspace: ws,
+				Query:     j.Query,
+				HalfLife:  time.Duration(*freshness * float64(24*time.Hour)),
+				Hybrid:    weights,
+				Vectors:   vectors,
+				Limit:     *k,
+			})
+			if err != nil {
+				return nil, err
+			}
+			ids := make([]string, len(result.Items))
+			for i, item := range result.Items {
+				ids[i] = item.ID
+			}
+			return ids, nil
+		})
+		if err != nil {
+			return err
+		}
+		name := config
+		if weights != nil {
+			name = weights.String()
+		}
+		fmt.Printf("%-48s %7.3f %7.3f %7.3f\n", name, m.NDCG, m.MRR, m.Recall)
+	}
+	return nil
+}
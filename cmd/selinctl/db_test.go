@@ -0,0 +1,18 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripPSQLCommands(t *testing.T) {
+	script := "\\c selin;\nCREATE TABLE IF NOT EXISTS a (id INT);\n  \\echo 'done'\nSELECT 1;\n"
+	got := stripPSQLCommands(script)
+
+	if strings.Contains(got, `\`) {
+		t.Errorf("Expected psql meta-commands removed, got %q", got)
+	}
+	if !strings.Contains(got, "CREATE TABLE IF NOT EXISTS a (id INT);") || !strings.Contains(got, "SELECT 1;") {
+		t.Errorf("Expected SQL statements kept, got %q", got)
+	}
+}
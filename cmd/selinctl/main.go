@@ -0,0 +1,70 @@
+// selinctl is the operator CLI for Selin. Database commands connect with
+// the same POSTGRES_* settings as the services; the others call the
+// services' HTTP APIs, authenticating with ADMIN_API_KEY where required.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"migrate", "migrate [-file scripts/init-database.sql]", "Apply the database schema", runMigrate},
+	{"import", "import [-type file|slack|chat] <path>", "Upload a file through the file uploader", runImport},
+	{"collect", "collect", "Start a Reddit collection cycle now", runCollect},
+	{"rescore", "rescore", "Recompute relevance scores of collected content", runRescore},
+	{"status", "status", "Show content, collector, queue, storage and error status", runStatus},
+	{"search", "search [-limit 10] <query>", "Search the knowledge base", runSearch},
+	{"backup", "backup [-o selin-backup.jsonl] [-tables a,b]", "Export tables as JSON lines", runBackup},
+	{"keys", "keys list | keys create [-workspace id] [-role reader|editor|admin] <name> | keys revoke <name>", "Manage gateway API keys", runKeys},
+	{"reindex", "reindex start [-steps search_vector,tags] [-batch 500] [-throttle 100ms] [-wait] | reindex status [-wait] | reindex pause|resume|cancel", "Rebuild derived content columns in resumable batches", runReindex},
+	{"embeddings", "embeddings stats | embeddings purge [-model name] [-unused 720h] [-all]", "Report on and purge the embedding cache", runEmbeddings},
+	{"search-eval", "search-eval [-judgments file.jsonl] [-configs 'classic;hybrid;keyword=0.7,vector=0.3'] [-k 10]", "Compare search rankers on judged queries", runSearchEval},
+	{"jobs", "jobs list | jobs runs|trigger|pause|resume <name>", "Inspect and run the scheduler's jobs", runJobs},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: selinctl <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n            selinctl %s\n", c.name, c.summary, c.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Service URLs: GATEWAY_URL, COLLECTOR_URL, UPLOADER_URL, MCP_SERVER_URL")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "selinctl %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	if os.Args[1] != "help" && os.Args[1] != "-h" {
+		fmt.Fprintf(os.Stderr, "selinctl: unknown command %q\n\n", os.Args[1])
+	}
+	usage()
+	os.Exit(2)
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,37 @@
+package adminauth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/config"
+)
+
+func TestAuthorized(t *testing.T) {
+	for _, tt := range []struct {
+		key, header string
+		want        int
+	}{
+		{"", "Bearer anything", 403},
+		{"admin", "", 401},
+		{"admin", "Bearer wrong", 401},
+		{"admin", "Bearer admin", 200},
+	} {
+		t.Setenv(SecretName, tt.key)
+		config.Secrets().Reload()
+		r := httptest.NewRequest("GET", "/admin/stats", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		if Authorized(w, r) {
+			w.WriteHeader(200)
+		}
+		if w.Code != tt.want {
+			t.Errorf("key %q with %q: expected %d, got %d", tt.key, tt.header, tt.want, w.Code)
+		}
+		if Valid(r) != (tt.want == 200) {
+			t.Errorf("key %q with %q: expected Valid to be %v", tt.key, tt.header, tt.want == 200)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Package apikeys keeps the API keys the gateway issues, in Redis next to
+// the rate limiter state, so every service that faces clients resolves a
+// caller's workspace and role the same way. Each key belongs to one
+// workspace and carries one role. Only a SHA-256 of each key is stored:
+// HashesKey maps hash → name for lookups, and InfoKey maps name → record.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/rbac"
+)
+
+const (
+	HashesKey = "api_keys"
+	InfoKey   = "api_keys:info"
+	Prefix    = "selin_"
+
+	// WorkspacesKey holds the gateway's workspaces, by ID. The default
+	// workspace exists without an entry.
+	WorkspacesKey    = "workspaces"
+	DefaultWorkspace = "default"
+)
+
+var ErrExists = errors.New("api key name already in use")
+
+type Info struct {
+	Name      string    `json:"name"`
+	Workspace string    `json:"workspace_id"`
+	Role      rbac.Role `json:"role"`
+	Hint      string    `json:"hint"` // last characters of the key
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// record is the InfoKey entry for one key.
+type record struct {
+	Hash      string    `json:"hash"`
+	Workspace string    `json:"workspace_id"`
+	Role      rbac.Role `json:"role"`
+	Hint      string    `json:"hint"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Store struct {
+	client *redis.Client
+}
+
+func New(client *redis.Client) *Store {
+	return &Store{client: client}
+}
+
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// FromRequest returns the key a request carries in X-API-Key or as a
+// bearer token, or "".
+func FromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// Create issues a new key for workspace under name and returns it. The key
+// itself is not stored and cannot be shown again.
+func (s *Store) Create(ctx context.Context, name, workspace string, role rbac.Role) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	key := Prefix + hex.EncodeToString(raw)
+	rec := record{Hash: Hash(key), Workspace: workspace, Role: role, Hint: key[len(key)-4:], CreatedAt: time.Now().UTC()}
+	data, _ := json.Marshal(rec)
+
+	ok, err := s.client.HSetNX(ctx, InfoKey, name, data).Result()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrExists
+	}
+	if err := s.client.HSet(ctx, HashesKey, rec.Hash, name).Err(); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *Store) List(ctx context.Context) ([]Info, error) {
+	entries, err := s.client.HGetAll(ctx, InfoKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := []Info{}
+	for name, data := range entries {
+		var rec record
+		if json.Unmarshal([]byte(data), &rec) != nil {
+			continue
+		}
+		keys = append(keys, rec.info(name))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// Revoke deletes the key issued under name, reporting whether it existed.
+func (s *Store) Revoke(ctx context.Context, name string) (bool, error) {
+	data, err := s.client.HGet(ctx, InfoKey, name).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return false, err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HDel(ctx, HashesKey, rec.Hash)
+	pipe.HDel(ctx, InfoKey, name)
+	_, err = pipe.Exec(ctx)
+	return err == nil, err
+}
+
+// Lookup returns the key's details, or nil when it is not a valid key.
+func (s *Store) Lookup(ctx context.Context, key string) (*Info, error) {
+	name, err := s.client.HGet(ctx, HashesKey, Hash(key)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.client.HGet(ctx, InfoKey, name).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		return nil, err
+	}
+	info := rec.info(name)
+	return &info, nil
+}
+
+// Resolve is Lookup for services that only need the caller's workspace: a
+// key whose workspace was deleted resolves to nil too, as the gateway
+// refuses it.
+func (s *Store) Resolve(ctx context.Context, key string) (*Info, error) {
+	info, err := s.Lookup(ctx, key)
+	if err != nil || info == nil || info.Workspace == DefaultWorkspace {
+		return info, err
+	}
+	exists, err := s.client.HExists(ctx, WorkspacesKey, info.Workspace).Result()
+	if err != nil || !exists {
+		return nil, err
+	}
+	return info, nil
+}
+
+// info treats keys issued before roles or workspaces existed as readers of
+// the default workspace.
+func (r record) info(name string) Info {
+	info := Info{Name: name, Workspace: r.Workspace, Role: r.Role, Hint: r.Hint, CreatedAt: r.CreatedAt}
+	if info.Workspace == "" {
+		info.Workspace = DefaultWorkspace
+	}
+	if info.Role == "" {
+		info.Role = rbac.Reader
+	}
+	return info
+}
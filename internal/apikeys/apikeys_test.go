@@ -0,0 +1,49 @@
+package apikeys
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/rbac"
+)
+
+func TestResolve(t *testing.T) {
+	mr := miniredis.RunT(t)
+	keys := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	mr.HSet(WorkspacesKey, "team-a", `{"id":"team-a"}`)
+	teamKey, _ := keys.Create(ctx, "team-a-ci", "team-a", rbac.Editor)
+	defaultKey, _ := keys.Create(ctx, "laptop", DefaultWorkspace, rbac.Reader)
+
+	if info, err := keys.Resolve(ctx, teamKey); err != nil || info == nil || info.Workspace != "team-a" || info.Role != rbac.Editor {
+		t.Errorf("Expected the key to resolve to team-a, got %+v (%v)", info, err)
+	}
+	if info, _ := keys.Resolve(ctx, defaultKey); info == nil || info.Workspace != DefaultWorkspace {
+		t.Errorf("Expected the default workspace without an entry, got %+v", info)
+	}
+	if info, _ := keys.Resolve(ctx, Prefix+"nope"); info != nil {
+		t.Errorf("Expected an unknown key to resolve to nil, got %+v", info)
+	}
+
+	mr.HDel(WorkspacesKey, "team-a")
+	if info, _ := keys.Resolve(ctx, teamKey); info != nil {
+		t.Errorf("Expected a key of a deleted workspace to resolve to nil, got %+v", info)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer selin_b")
+	if key := FromRequest(r); key != "selin_b" {
+		t.Errorf("Expected the bearer token, got %q", key)
+	}
+	r.Header.Set("X-API-Key", "selin_a")
+	if key := FromRequest(r); key != "selin_a" {
+		t.Errorf("Expected X-API-Key to come first, got %q", key)
+	}
+}
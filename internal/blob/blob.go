@@ -0,0 +1,107 @@
+// Package blob keeps binary files, such as message attachments, out of the
+// database. Blobs are stored under the SHA-256 of their contents, so the
+// same file uploaded twice is kept once, and a blob's key is all a row
+// needs to record.
+//
+// Blobs live on the local filesystem under BLOB_DIR, which in the cluster
+// is on the shared NFS volume.
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"selin/internal/config"
+)
+
+// ErrNotFound is returned by Open for keys that are not stored.
+var ErrNotFound = errors.New("blob not found")
+
+var keyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type Store struct {
+	dir string
+}
+
+// New stores blobs under dir.
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// FromEnv stores blobs under BLOB_DIR ("blobs" by default).
+func FromEnv() *Store {
+	return New(config.Env("BLOB_DIR", "blobs"))
+}
+
+// Path is where the blob with key is stored. Keys fan out over
+// directories named after their first two characters.
+func (s *Store) Path(key string) (string, error) {
+	if !keyPattern.MatchString(key) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, key[:2], key), nil
+}
+
+// Put stores what r holds and returns its key and size.
+func (s *Store) Put(r io.Reader) (key string, size int64, err error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if size, err = io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	key = hex.EncodeToString(h.Sum(nil))
+	path, _ := s.Path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+	// Renaming over an existing blob is fine: it has the same contents
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return key, size, nil
+}
+
+// Open opens the blob with key, or returns ErrNotFound.
+func (s *Store) Open(key string) (*os.File, error) {
+	path, err := s.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Remove deletes the blob with key. Removing one that is not stored is
+// not an error. Blobs are shared by everything with the same contents, so
+// the caller checks that nothing refers to it anymore.
+func (s *Store) Remove(key string) error {
+	path, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package blob
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPutAndOpen(t *testing.T) {
+	s := New(t.TempDir())
+
+	key, size, err := s.Put(strings.NewReader("screenshot bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len("screenshot bytes")) || len(key) != 64 {
+		t.Fatalf("Unexpected key %q and size %d", key, size)
+	}
+
+	again, _, err := s.Put(strings.NewReader("screenshot bytes"))
+	if err != nil || again != key {
+		t.Errorf("Expected the same contents to get the same key, got %q, %v", again, err)
+	}
+
+	f, err := s.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, _ := io.ReadAll(f); string(data) != "screenshot bytes" {
+		t.Errorf("Unexpected contents %q", data)
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != 1 || entries[0].Name() != key[:2] {
+		t.Errorf("Expected only the blob's directory, got %v", entries)
+	}
+}
+
+func TestOpenRejectsUnknownAndInvalidKeys(t *testing.T) {
+	s := New(t.TempDir())
+	for _, key := range []string{strings.Repeat("a", 64), "../../etc/passwd", ""} {
+		if _, err := s.Open(key); err != ErrNotFound {
+			t.Errorf("%q: expected ErrNotFound, got %v", key, err)
+		}
+	}
+	if _, err := s.Path("../x"); err != ErrNotFound {
+		t.Errorf("Expected an invalid key to have no path, got %v", err)
+	}
+	if path, _ := s.Path(strings.Repeat("b", 64)); filepath.Dir(path) != filepath.Join(s.dir, "bb") {
+		t.Errorf("Unexpected path %s", path)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	s := New(t.TempDir())
+	key, _, err := s.Put(strings.NewReader("old sealed bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(key); err != ErrNotFound {
+		t.Errorf("Expected the blob gone, got %v", err)
+	}
+	if err := s.Remove(key); err != nil {
+		t.Errorf("Expected removing a missing blob to succeed, got %v", err)
+	}
+	if err := s.Remove("../x"); err != ErrNotFound {
+		t.Errorf("Expected an invalid key rejected, got %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+// Package chunker splits long content into the passages that are stored,
+// embedded and searched, so that PDF pages, markdown documents, Reddit
+// posts and transcripts are not each one large blob. How a content type
+// is split is configured in config/chunking.yaml: by markdown heading, by
+// groups of sentences, or by token windows, with overlap between chunks so
+// that a passage cut at a boundary still appears whole in one of them.
+// The uploader and the collectors share the configuration.
+package chunker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"selin/internal/keyring"
+	"selin/internal/tokenizer"
+)
+
+// Strategy names a way of splitting text.
+type Strategy string
+
+const (
+	// ByHeading starts a chunk at every markdown heading, splitting
+	// sections longer than MaxTokens by sentences.
+	ByHeading Strategy = "heading"
+	// BySentences groups whole sentences into chunks of up to MaxTokens,
+	// repeating the last Overlap sentences at the start of the next one.
+	BySentences Strategy = "sentences"
+	// ByTokens cuts windows of MaxTokens tokens, the last Overlap tokens
+	// of one starting the next.
+	ByTokens Strategy = "tokens"
+)
+
+// Options configure how one content type is split. Overlap counts
+// sentences for the heading and sentences strategies, tokens for tokens.
+type Options struct {
+	Strategy  Strategy `yaml:"strategy"`
+	MaxTokens int      `yaml:"max_tokens"`
+	Overlap   int      `yaml:"overlap"`
+}
+
+// Config selects the options for each content type.
+type Config struct {
+	Default      Options            `yaml:"default"`
+	ContentTypes map[string]Options `yaml:"content_types"`
+}
+
+// Chunk is one passage of a text.
+type Chunk struct {
+	Position int    `json:"position"`
+	Heading  string `json:"heading,omitempty"`
+	Text     string `json:"text"`
+	Tokens   int    `json:"tokens"`
+}
+
+// DefaultConfig returns the configuration shipped as config/chunking.yaml.
+func DefaultConfig() *Config {
+	return &Config{
+		Default: Options{Strategy: BySentences, MaxTokens: 256, Overlap: 1},
+		ContentTypes: map[string]Options{
+			"markdown":    {Strategy: ByHeading, MaxTokens: 512, Overlap: 1},
+			"text":        {Strategy: BySentences, MaxTokens: 256, Overlap: 1},
+			"pdf":         {Strategy: ByTokens, MaxTokens: 400, Overlap: 40},
+			"transcript":  {Strategy: ByTokens, MaxTokens: 300, Overlap: 50},
+			"reddit_post": {Strategy: BySentences, MaxTokens: 256, Overlap: 1},
+			"article":     {Strategy: ByHeading, MaxTokens: 512, Overlap: 1},
+			"html":        {Strategy: ByHeading, MaxTokens: 512, Overlap: 1},
+			"source_code": {Strategy: ByHeading, MaxTokens: 512, Overlap: 1},
+		},
+	}
+}
+
+// Load reads a configuration from a YAML file. A content type without a
+// strategy or max_tokens takes the default one.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid chunking config %s: %v", path, err)
+	}
+	c.Default = c.Default.withDefaults(DefaultConfig().Default)
+	if err := c.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid chunking config %s: default: %v", path, err)
+	}
+	for name, o := range c.ContentTypes {
+		o = o.withDefaults(c.Default)
+		if err := o.validate(); err != nil {
+			return nil, fmt.Errorf("invalid chunking config %s: %s: %v", path, name, err)
+		}
+		c.ContentTypes[name] = o
+	}
+	return &c, nil
+}
+
+// FromEnv loads the configuration CHUNKING_CONFIG_FILE points to, or
+// returns the default one when it is unset.
+func FromEnv() (*Config, error) {
+	path := os.Getenv("CHUNKING_CONFIG_FILE")
+	if path == "" {
+		return DefaultConfig(), nil
+	}
+	return Load(path)
+}
+
+func (o Options) withDefaults(d Options) Options {
+	if o.Strategy == "" {
+		o.Strategy = d.Strategy
+	}
+	if o.MaxTokens == 0 {
+		o.MaxTokens = d.MaxTokens
+	}
+	return o
+}
+
+func (o Options) validate() error {
+	switch o.Strategy {
+	case ByHeading, BySentences, ByTokens:
+	default:
+		return fmt.Errorf("unknown strategy %q", o.Strategy)
+	}
+	if o.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be positive")
+	}
+	if o.Overlap < 0 || (o.Strategy == ByTokens && o.Overlap >= o.MaxTokens) {
+		return fmt.Errorf("overlap must be at least 0 and below max_tokens")
+	}
+	return nil
+}
+
+// For returns the options for a content type.
+func (c *Config) For(contentType string) Options {
+	if o, ok := c.ContentTypes[contentType]; ok {
+		return o
+	}
+	return c.Default
+}
+
+// Chunk splits text the way its content type is configured to be,
+// counting tokens with the default tokenizer.
+func (c *Config) Chunk(contentType, text string) []Chunk {
+	return Split(text, c.For(contentType), tokenizer.Default())
+}
+
+// Split splits text into chunks, counting tokens with tok. Text that
+// fits in one chunk is returned as one.
+func Split(text string, o Options, tok tokenizer.Tokenizer) []Chunk {
+	var chunks []Chunk
+	add := func(heading, text string) {
+		if text = strings.TrimSpace(text); text != "" {
+			chunks = append(chunks, Chunk{Position: len(chunks), Heading: heading, Text: text, Tokens: tok.Count(text)})
+		}
+	}
+	switch o.Strategy {
+	case ByHeading:
+		for _, s := range sections(text) {
+			for _, part := range splitSentences(s.body, o.MaxTokens, o.Overlap, tok) {
+				add(s.heading, part)
+			}
+		}
+	case ByTokens:
+		for _, part := range splitTokens(text, o.MaxTokens, o.Overlap, tok) {
+			add("", part)
+		}
+	default:
+		for _, part := range splitSentences(text, o.MaxTokens, o.Overlap, tok) {
+			add("", part)
+		}
+	}
+	return chunks
+}
+
+type section struct {
+	heading string
+	body    string
+}
+
+// sections splits markdown at its headings, each section keeping its
+// heading line. Text before the first heading is a section of its own.
+func sections(text string) []section {
+	var out []section
+	var cur section
+	var body strings.Builder
+	fenced := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			fenced = !fenced
+		}
+		if !fenced && isHeading(trimmed) {
+			cur.body = body.String()
+			out = append(out, cur)
+			cur = section{heading: strings.TrimSpace(strings.TrimLeft(trimmed, "#"))}
+			body.Reset()
+		}
+		body.WriteString(line)
+	}
+	cur.body = body.String()
+	return append(out, cur)
+}
+
+func isHeading(line string) bool {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	return level >= 1 && level <= 6 && (len(line) == level || line[level] == ' ')
+}
+
+// splitSentences groups sentences into parts of up to maxTokens, the
+// last overlap sentences of a part starting the next. A sentence too long
+// for a part on its own is cut by tokens.
+func splitSentences(text string, maxTokens, overlap int, tok tokenizer.Tokenizer) []string {
+	var parts, group []string
+	size, fresh := 0, 0
+	flush := func() {
+		if fresh > 0 {
+			parts = append(parts, strings.Join(group, " "))
+		}
+		keep := min(overlap, len(group))
+		if fresh == 0 {
+			keep = 0
+		}
+		group = append([]string(nil), group[len(group)-keep:]...)
+		size, fresh = 0, 0
+		for _, s := range group {
+			size += tok.Count(s)
+		}
+	}
+	for _, s := range sentences(text) {
+		n := tok.Count(s)
+		if n > maxTokens {
+			flush()
+			group, size = nil, 0
+			parts = append(parts, splitTokens(s, maxTokens, 0, tok)...)
+			continue
+		}
+		if size+n > maxTokens {
+			flush()
+			// Drop the overlap when it leaves no room for the sentence
+			for len(group) > 0 && size+n > maxTokens {
+				size -= tok.Count(group[0])
+				group = group[1:]
+			}
+		}
+		group = append(group, s)
+		size += n
+		fresh++
+	}
+	flush()
+	return parts
+}
+
+// sentences splits text after sentence-ending punctuation followed by
+// whitespace, and at blank lines.
+func sentences(text string) []string {
+	var out []string
+	runes := []rune(text)
+	start := 0
+	cut := func(end int) {
+		if s := strings.Join(strings.Fields(string(runes[start:end])), " "); s != "" {
+			out = append(out, s)
+		}
+		start = end
+	}
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\n' && i+1 < len(runes) && runes[i+1] == '\n':
+			cut(i)
+		case strings.ContainsRune(".!?", runes[i]) && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])):
+			cut(i + 1)
+		}
+	}
+	cut(len(runes))
+	return out
+}
+
+// splitTokens cuts text into windows of whole words holding up to
+// maxTokens tokens, each starting with the last overlap tokens' worth of
+// words of the one before.
+func splitTokens(text string, maxTokens, overlap int, tok tokenizer.Tokenizer) []string {
+	words := strings.Fields(text)
+	counts := make([]int, len(words))
+	for i, w := range words {
+		counts[i] = tok.Count(w)
+	}
+	var parts []string
+	for start := 0; start < len(words); {
+		end, size := start, 0
+		for end < len(words) && (end == start || size+counts[end] <= maxTokens) {
+			size += counts[end]
+			end++
+		}
+		parts = append(parts, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+		next, back := end, 0
+		for next > start+1 && back+counts[next-1] <= overlap {
+			next--
+			back += counts[next]
+		}
+		start = next
+	}
+	return parts
+}
+
+// Save replaces the chunks stored for a content item. Their text is
+// encrypted when the workspace has encryption keys (see package keyring).
+func Save(ctx context.Context, db *sql.DB, workspace, contentID string, chunks []Chunk) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM content_chunks WHERE content_id = $1`, contentID); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		text, err := keyring.Default().SealString(ctx, workspace, c.Text)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO content_chunks (content_id, position, workspace_id, heading, text, token_count)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			contentID, c.Position, workspace, c.Heading, text, c.Tokens); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
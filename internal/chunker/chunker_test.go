@@ -0,0 +1,108 @@
+package chunker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// words counts one token per word, to make the tests easy to follow.
+type words struct{}
+
+func (words) Count(text string) int { return len(strings.Fields(text)) }
+
+func texts(chunks []Chunk) []string {
+	var out []string
+	for _, c := range chunks {
+		out = append(out, c.Text)
+	}
+	return out
+}
+
+func TestSplitBySentences(t *testing.T) {
+	text := "One two three. Four five!\n\nSix seven eight? Nine ten."
+	chunks := Split(text, Options{Strategy: BySentences, MaxTokens: 5, Overlap: 1}, words{})
+	want := []string{"One two three. Four five!", "Four five! Six seven eight?", "Six seven eight? Nine ten."}
+	if got := texts(chunks); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	for i, c := range chunks {
+		if c.Position != i || c.Tokens != 5 {
+			t.Errorf("Expected chunk %d of 5 tokens, got %+v", i, c)
+		}
+	}
+
+	// Short text is one chunk, a sentence too long for one is cut
+	if got := texts(Split("Short.", Options{Strategy: BySentences, MaxTokens: 5}, words{})); !reflect.DeepEqual(got, []string{"Short."}) {
+		t.Errorf("Expected one chunk, got %q", got)
+	}
+	got := texts(Split("a b c d e f g. h.", Options{Strategy: BySentences, MaxTokens: 3}, words{}))
+	if want := []string{"a b c", "d e f", "g.", "h."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestSplitByHeading(t *testing.T) {
+	text := "Intro line.\n\n# Setup\nInstall it. Run it.\n\n```\n# not a heading\n```\n## Usage\nCall it.\n"
+	chunks := Split(text, Options{Strategy: ByHeading, MaxTokens: 50}, words{})
+	if len(chunks) != 3 {
+		t.Fatalf("Expected a chunk per section, got %+v", chunks)
+	}
+	if chunks[0].Heading != "" || chunks[0].Text != "Intro line." {
+		t.Errorf("Expected the text before the first heading on its own, got %+v", chunks[0])
+	}
+	if chunks[1].Heading != "Setup" || !strings.Contains(chunks[1].Text, "# not a heading") {
+		t.Errorf("Expected fenced code kept in its section, got %+v", chunks[1])
+	}
+	if chunks[2].Heading != "Usage" || chunks[2].Text != "## Usage Call it." {
+		t.Errorf("Expected the Usage section, got %+v", chunks[2])
+	}
+}
+
+func TestSplitByTokens(t *testing.T) {
+	got := texts(Split("a b c d e f g h", Options{Strategy: ByTokens, MaxTokens: 4, Overlap: 2}, words{}))
+	want := []string{"a b c d", "c d e f", "e f g h"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := Split("   ", Options{Strategy: ByTokens, MaxTokens: 4}, words{}); len(got) != 0 {
+		t.Errorf("Expected no chunks for blank text, got %+v", got)
+	}
+}
+
+func TestLoadMatchesShippedConfig(t *testing.T) {
+	c, err := Load("../../config/chunking.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, DefaultConfig()) {
+		t.Errorf("config/chunking.yaml and DefaultConfig differ:\n%+v\n%+v", c, DefaultConfig())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunking.yaml")
+	os.WriteFile(path, []byte("default:\n  max_tokens: 100\ncontent_types:\n  transcript:\n    strategy: tokens\n"), 0o600)
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.For("transcript"); got != (Options{Strategy: ByTokens, MaxTokens: 100}) {
+		t.Errorf("Expected max_tokens taken from the default, got %+v", got)
+	}
+	if got := c.For("slack_message"); got != (Options{Strategy: BySentences, MaxTokens: 100}) {
+		t.Errorf("Expected unlisted types to use the default, got %+v", got)
+	}
+
+	for _, bad := range []string{
+		"default:\n  strategy: paragraphs\n",
+		"content_types:\n  pdf:\n    strategy: tokens\n    max_tokens: 10\n    overlap: 10\n",
+	} {
+		os.WriteFile(path, []byte(bad), 0o600)
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
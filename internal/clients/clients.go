@@ -0,0 +1,188 @@
+// Package clients finds Selin's services and calls them.
+//
+// Each Service knows where it runs. Its URL comes from its environment
+// variable (MCP_SERVER_URL, COLLECTOR_URL, ...) when set. Inside Kubernetes
+// it falls back to the Service of the same name in the pod's namespace, and
+// elsewhere to its port on localhost. The typed clients (MCPServerClient,
+// CollectorClient, UploaderClient) and Proxy share one policy: requests
+// carry the caller's request ID, and idempotent requests are retried when
+// the service is briefly unreachable or overloaded.
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// Service is one of Selin's services.
+type Service struct {
+	Name string // also its Kubernetes Service name
+	Env  string // overrides the base URL
+	Port int
+}
+
+var (
+	Gateway   = Service{Name: "api-gateway", Env: "GATEWAY_URL", Port: 8080}
+	WS        = Service{Name: "ws", Env: "WS_URL", Port: 8081}
+	Collector = Service{Name: "reddit-collector", Env: "COLLECTOR_URL", Port: 8082}
+	Uploader  = Service{Name: "file-uploader", Env: "UPLOADER_URL", Port: 8083}
+	MCPServer = Service{Name: "mcp-server", Env: "MCP_SERVER_URL", Port: 8084}
+	Notifier  = Service{Name: "notifier", Env: "NOTIFIER_URL", Port: 8085}
+	Scheduler = Service{Name: "scheduler", Env: "SCHEDULER_URL", Port: 8086}
+)
+
+// URL returns the service's base URL, without a trailing slash.
+func (s Service) URL() string {
+	if u := os.Getenv(s.Env); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	host := "localhost"
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		host = s.Name
+	}
+	return "http://" + host + ":" + strconv.Itoa(s.Port)
+}
+
+// Shared policy.
+const (
+	// DefaultTimeout bounds a typed client's request, retries included.
+	DefaultTimeout = 10 * time.Second
+	// Retries is how many times an idempotent request is retried.
+	Retries = 2
+	// RetryBackoff is the wait before the first retry, doubled after.
+	RetryBackoff = 100 * time.Millisecond
+)
+
+// Transport applies the shared policy on top of http.DefaultTransport.
+var Transport http.RoundTripper = &transport{base: http.DefaultTransport}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := logging.RequestID(req.Context()); id != "" && req.Header.Get(logging.RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+
+	// Only requests that can be sent again unchanged are retried
+	retry := (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		(req.Body == nil || req.Body == http.NoBody)
+	backoff := RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if !retry || attempt == Retries || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a failure is likely to pass: the service could
+// not be reached, or a proxy in front of it could not reach it.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// NewHTTPClient returns an HTTP client with the shared policy whose
+// requests take at most timeout.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: Transport, Timeout: timeout}
+}
+
+// StatusError is returned when a service answers with an unexpected status.
+type StatusError struct {
+	Service string
+	Status  int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.Service, e.Status)
+}
+
+// Client calls one service's JSON API.
+type Client struct {
+	Service string
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// NewClient returns a client for the service named name at base.
+func NewClient(name, base string) *Client {
+	return &Client{Service: name, BaseURL: strings.TrimSuffix(base, "/"), HTTP: NewHTTPClient(DefaultTimeout)}
+}
+
+// Call sends in (when not nil) as JSON to path and decodes the response
+// into out (when not nil). header is added to the request, and any status
+// other than want is a *StatusError.
+func (c *Client) Call(ctx context.Context, method, path string, header http.Header, in, out interface{}, want int) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s unreachable: %w", c.Service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		return &StatusError{Service: c.Service, Status: resp.StatusCode}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", c.Service, err)
+	}
+	return nil
+}
+
+// bearer is a header passing the caller's Authorization through.
+func bearer(auth string) http.Header {
+	if auth == "" {
+		return nil
+	}
+	return http.Header{"Authorization": {auth}}
+}
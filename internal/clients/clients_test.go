@@ -0,0 +1,133 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"selin/internal/llm"
+	"selin/internal/logging"
+)
+
+func TestServiceURL(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("MCP_SERVER_URL", "")
+	if got := MCPServer.URL(); got != "http://localhost:8084" {
+		t.Errorf("Expected localhost outside Kubernetes, got %s", got)
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	if got := MCPServer.URL(); got != "http://mcp-server:8084" {
+		t.Errorf("Expected the Kubernetes Service, got %s", got)
+	}
+	t.Setenv("MCP_SERVER_URL", "https://mcp.internal/")
+	if got := MCPServer.URL(); got != "https://mcp.internal" {
+		t.Errorf("Expected MCP_SERVER_URL to win, got %s", got)
+	}
+}
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"running": true}`))
+	}))
+	defer upstream.Close()
+
+	status, err := NewCollector(upstream.URL).Status(context.Background(), "Bearer admin")
+	if err != nil || string(status) != `{"running": true}` {
+		t.Fatalf("Expected the status after two retries, got %s (%v)", status, err)
+	}
+
+	// Posts are sent once
+	calls.Store(0)
+	err = NewMCPServer(upstream.URL).RecordQuery(context.Background(), "default", QueryRecord{Query: "q"})
+	if status, ok := err.(*StatusError); !ok || status.Status != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("Expected one attempt failing with 503, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	if _, err := NewUploader(upstream.URL).Status(context.Background(), ""); err == nil {
+		t.Error("Expected an error")
+	}
+	if n := calls.Load(); n != Retries+1 {
+		t.Errorf("Expected %d attempts, got %d", Retries+1, n)
+	}
+}
+
+func TestRecordQuery(t *testing.T) {
+	var got QueryRecord
+	var workspace, requestID string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/queries" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		workspace, requestID = r.Header.Get(WorkspaceHeader), r.Header.Get(logging.RequestIDHeader)
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer upstream.Close()
+
+	q := QueryRecord{Query: "what is ibc?", Tool: "query", UserID: "alice", RequestID: "req-1"}
+	ctx := logging.WithRequestID(context.Background(), "req-1")
+	if err := NewMCPServer(upstream.URL).RecordQuery(ctx, "team", q); err != nil {
+		t.Fatal(err)
+	}
+	if got != q {
+		t.Errorf("Expected %+v, got %+v", q, got)
+	}
+	if workspace != "team" || requestID != "req-1" {
+		t.Errorf("Expected workspace team and request req-1, got %q and %q", workspace, requestID)
+	}
+}
+
+func TestUsageLedger(t *testing.T) {
+	var recorded llm.Entry
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/usage/allow":
+			if r.URL.Query().Get("user_id") == "alice" {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"allowed":  false,
+					"exceeded": llm.BudgetError{Scope: "user", Name: "alice", Limit: 1, Spent: 1.2},
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]bool{"allowed": true})
+		case r.Method == http.MethodPost && r.URL.Path == "/usage":
+			json.NewDecoder(r.Body).Decode(&recorded)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer upstream.Close()
+	ledger := NewMCPServer(upstream.URL).Ledger()
+	ctx := context.Background()
+
+	var budget *llm.BudgetError
+	if err := ledger.Allow(ctx, llm.Account{Workspace: "team", UserID: "alice", Feature: "query"}); !errors.As(err, &budget) || budget.Spent != 1.2 {
+		t.Errorf("Expected alice's budget spent, got %v", err)
+	}
+	if err := ledger.Allow(ctx, llm.Account{Workspace: "team", UserID: "bob", Feature: "query"}); err != nil {
+		t.Errorf("Expected bob allowed, got %v", err)
+	}
+	entry := llm.Entry{Workspace: "team", UserID: "bob", Feature: "query", Model: "gpt-4o-mini", Cost: 0.01}
+	if err := ledger.Record(ctx, entry); err != nil || recorded != entry {
+		t.Errorf("Expected %+v recorded, got %+v, %v", entry, recorded, err)
+	}
+}
@@ -0,0 +1,60 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"selin/internal/logging"
+)
+
+// Proxy forwards requests to the service at base with prefix stripped from
+// the path, keeping the query string. Only the given methods are allowed
+// through.
+func Proxy(base, prefix string, methods ...string) http.Handler {
+	target, err := url.Parse(base)
+	if err != nil {
+		logging.Fatal("invalid upstream URL", "url", base, "error", err)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Transport: Transport,
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.URL.Path = target.Path + strings.TrimPrefix(r.In.URL.Path, prefix)
+			r.Out.URL.RawPath = ""
+			r.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var tooLarge *http.MaxBytesError
+			switch {
+			case errors.As(err, &tooLarge):
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			case errors.Is(err, context.DeadlineExceeded):
+				logging.FromContext(r.Context()).Warn("upstream request timed out", "upstream", base, "path", r.URL.Path)
+				http.Error(w, "Upstream service timed out", http.StatusGatewayTimeout)
+			default:
+				logging.FromContext(r.Context()).Error("upstream request failed", "upstream", base, "path", r.URL.Path, "error", err)
+				http.Error(w, "Upstream service unavailable", http.StatusBadGateway)
+			}
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				proxy.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	})
+}
+
+// Proxy forwards requests to the service as the package-level Proxy does.
+func (s Service) Proxy(prefix string, methods ...string) http.Handler {
+	return Proxy(s.URL(), prefix, methods...)
+}
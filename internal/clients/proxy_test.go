@@ -0,0 +1,42 @@
+package clients
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/recommendations" || r.URL.Query().Get("limit") != "3" {
+			t.Errorf("Unexpected upstream request %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"recommendations":[]}`))
+	}))
+	defer upstream.Close()
+
+	handler := Proxy(upstream.URL, "/api/v1", http.MethodGet)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/recommendations?limit=3", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"recommendations":[]}` {
+		t.Errorf("Expected proxied response, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/recommendations", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rr.Code)
+	}
+}
+
+func TestProxyUnavailable(t *testing.T) {
+	handler := Proxy("http://127.0.0.1:1", "/api/v1", http.MethodGet)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/recommendations", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when upstream is down, got %d", rr.Code)
+	}
+}
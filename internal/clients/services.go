@@ -0,0 +1,141 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"selin/internal/config"
+	"selin/internal/llm"
+)
+
+// Headers carrying the caller to the MCP server. It only believes them, and
+// the role header, from requests that carry the MCP_SERVER_TOKEN it shares
+// with the other services in TokenHeader.
+const (
+	WorkspaceHeader = "X-Workspace-ID"
+	UserHeader      = "X-User-ID"
+	TokenHeader     = "X-Service-Token"
+
+	// MCPServerToken is the secret holding the token.
+	MCPServerToken = "MCP_SERVER_TOKEN"
+)
+
+// Vouch sets the MCP server token on h, when there is one, and returns h.
+// The token is resolved per call, so a rotated one applies right away.
+func Vouch(h http.Header) http.Header {
+	if token := config.Secret(MCPServerToken); token != "" {
+		h.Set(TokenHeader, token)
+	}
+	return h
+}
+
+// MCPServerClient calls the MCP server, which owns the learning data.
+type MCPServerClient struct{ *Client }
+
+// NewMCPServer returns a client for the MCP server at base.
+func NewMCPServer(base string) *MCPServerClient {
+	return &MCPServerClient{NewClient(MCPServer.Name, base)}
+}
+
+// QueryRecord is a question for the MCP server's query history.
+type QueryRecord struct {
+	Query     string `json:"query"`
+	Tool      string `json:"tool"`
+	UserID    string `json:"user_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// RecordQuery stores a question asked in workspace in the query history.
+func (c *MCPServerClient) RecordQuery(ctx context.Context, workspace string, q QueryRecord) error {
+	return c.Call(ctx, http.MethodPost, "/queries", Vouch(http.Header{WorkspaceHeader: {workspace}}), q, nil, http.StatusCreated)
+}
+
+// Stats returns GET /admin/stats, authorized by the caller's auth header.
+func (c *MCPServerClient) Stats(ctx context.Context, auth string) (json.RawMessage, error) {
+	var stats json.RawMessage
+	err := c.Call(ctx, http.MethodGet, "/admin/stats", bearer(auth), nil, &stats, http.StatusOK)
+	return stats, err
+}
+
+// DeleteUserData deletes a user's rows from every table the MCP server
+// keeps, returning the deleted row counts by table.
+func (c *MCPServerClient) DeleteUserData(ctx context.Context, auth, userID string) (json.RawMessage, error) {
+	return deleteUser(ctx, c.Client, auth, "/admin/users/"+url.PathEscape(userID)+"/data")
+}
+
+// Ledger returns an llm.Ledger kept by the MCP server, which owns the
+// usage_ledger table and enforces the budgets.
+func (c *MCPServerClient) Ledger() llm.Ledger {
+	return usageLedger{c}
+}
+
+type usageLedger struct{ c *MCPServerClient }
+
+func (l usageLedger) Allow(ctx context.Context, account llm.Account) error {
+	query := url.Values{"user_id": {account.UserID}, "feature": {account.Feature}}
+	var out struct {
+		Allowed  bool             `json:"allowed"`
+		Exceeded *llm.BudgetError `json:"exceeded,omitempty"`
+	}
+	header := Vouch(http.Header{WorkspaceHeader: {account.Workspace}})
+	if err := l.c.Call(ctx, http.MethodGet, "/usage/allow?"+query.Encode(), header, nil, &out, http.StatusOK); err != nil {
+		return err
+	}
+	if !out.Allowed && out.Exceeded != nil {
+		return out.Exceeded
+	}
+	return nil
+}
+
+func (l usageLedger) Record(ctx context.Context, entry llm.Entry) error {
+	header := Vouch(http.Header{WorkspaceHeader: {entry.Workspace}})
+	return l.c.Call(ctx, http.MethodPost, "/usage", header, entry, nil, http.StatusCreated)
+}
+
+// CollectorClient calls the reddit collector.
+type CollectorClient struct{ *Client }
+
+// NewCollector returns a client for the collector at base.
+func NewCollector(base string) *CollectorClient {
+	return &CollectorClient{NewClient(Collector.Name, base)}
+}
+
+// Status returns the collection loop's GET /status.
+func (c *CollectorClient) Status(ctx context.Context, auth string) (json.RawMessage, error) {
+	var status json.RawMessage
+	err := c.Call(ctx, http.MethodGet, "/status", bearer(auth), nil, &status, http.StatusOK)
+	return status, err
+}
+
+// UploaderClient calls the file uploader.
+type UploaderClient struct{ *Client }
+
+// NewUploader returns a client for the file uploader at base.
+func NewUploader(base string) *UploaderClient {
+	return &UploaderClient{NewClient(Uploader.Name, base)}
+}
+
+// Status returns the uploader's GET /status.
+func (c *UploaderClient) Status(ctx context.Context, auth string) (json.RawMessage, error) {
+	var status json.RawMessage
+	err := c.Call(ctx, http.MethodGet, "/status", bearer(auth), nil, &status, http.StatusOK)
+	return status, err
+}
+
+// DeleteUserUploads deletes a user's uploads, their files and the
+// documents stored from them, returning what was deleted.
+func (c *UploaderClient) DeleteUserUploads(ctx context.Context, auth, userID string) (json.RawMessage, error) {
+	return deleteUser(ctx, c.Client, auth, "/admin/users/"+url.PathEscape(userID)+"/uploads")
+}
+
+// deleteUser calls a service's user deletion endpoint at path and returns
+// the "deleted" part of its response.
+func deleteUser(ctx context.Context, c *Client, auth, path string) (json.RawMessage, error) {
+	var out struct {
+		Deleted json.RawMessage `json:"deleted"`
+	}
+	err := c.Call(ctx, http.MethodDelete, path, bearer(auth), nil, &out, http.StatusOK)
+	return out.Deleted, err
+}
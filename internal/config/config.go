@@ -0,0 +1,104 @@
+// Package config assembles service settings from the environment, with
+// credentials resolved through the secrets provider.
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/logging"
+	"selin/internal/secrets"
+)
+
+var (
+	providerOnce sync.Once
+	provider     *secrets.Cache
+)
+
+// Secrets returns the process-wide secrets provider, built from
+// SECRETS_PROVIDER on first use. Its cache is reloaded on SIGHUP.
+func Secrets() *secrets.Cache {
+	providerOnce.Do(func() {
+		p, err := secrets.FromEnv()
+		if err != nil {
+			logging.Fatal("failed to configure secrets", "error", err)
+		}
+		p.ReloadOnSIGHUP()
+		provider = p
+	})
+	return provider
+}
+
+// Secret resolves a secret, returning "" when it is not configured.
+func Secret(name string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	v, err := Secrets().Get(ctx, name)
+	if err != nil {
+		if err != secrets.ErrNotFound {
+			slog.Error("failed to resolve secret", "secret", name, "error", err)
+		}
+		return ""
+	}
+	return v
+}
+
+// Env returns a non-secret setting, or def when it is unset.
+func Env(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// PostgresDSN builds the Postgres connection string. The password comes from
+// the secrets provider and has no default; it is looked up on every call so
+// rotated credentials apply to new connections.
+//
+// application names the connecting component in Postgres; content_revisions
+// records it as the author of each change.
+func PostgresDSN(application string) string {
+	user := Secret("POSTGRES_USER")
+	if user == "" {
+		user = "postgres"
+	}
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		Env("POSTGRES_HOST", "localhost"),
+		Env("POSTGRES_PORT", "5433"),
+		user,
+		Secret("POSTGRES_PASSWORD"),
+		Env("POSTGRES_DB", "selin"),
+		Env("POSTGRES_SSLMODE", "disable"))
+	if application != "" {
+		dsn += " application_name=" + application
+	}
+	return dsn
+}
+
+// RedisPassword is the Redis password, empty when Redis has no auth.
+func RedisPassword() string {
+	return Secret("REDIS_PASSWORD")
+}
+
+// RedisClient returns a client for the Redis at addr. Each new connection
+// authenticates with the password current at the time, rather than the one
+// the client started with, so a rotated REDIS_PASSWORD applies without a
+// restart.
+func RedisClient(addr string) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr: addr,
+		OnConnect: func(ctx context.Context, cn *redis.Conn) error {
+			if password := RedisPassword(); password != "" {
+				return cn.Auth(ctx, password).Err()
+			}
+			return nil
+		},
+	})
+}
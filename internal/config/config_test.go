@@ -0,0 +1,32 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisClientUsesRotatedPassword(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("first")
+	t.Setenv("REDIS_PASSWORD", "first")
+	Secrets().Reload()
+	ctx := context.Background()
+
+	client := RedisClient(mr.Addr())
+	defer client.Close()
+	held := client.Conn(ctx)
+	defer held.Close()
+	if err := held.Ping(ctx).Err(); err != nil {
+		t.Fatalf("Expected the first password accepted, got %v", err)
+	}
+
+	mr.RequireAuth("second")
+	t.Setenv("REDIS_PASSWORD", "second")
+	Secrets().Reload()
+	// The held connection keeps the pool from reusing it, so this one is new
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Errorf("Expected a new connection to use the rotated password, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package errlog remembers a service's most recent errors so its admin API
+// can report them without anyone reading the logs. The logging package
+// records every error-level log entry here.
+package errlog
+
+import (
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Ring keeps the last size entries added to it.
+type Ring struct {
+	mu      sync.Mutex
+	size    int
+	entries []Entry
+}
+
+func New(size int) *Ring {
+	return &Ring{size: size}
+}
+
+func (r *Ring) Add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+	if len(r.entries) > r.size {
+		r.entries = r.entries[len(r.entries)-r.size:]
+	}
+}
+
+// Recent returns the recorded errors, newest first.
+func (r *Ring) Recent() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Entry, len(r.entries))
+	for i, e := range r.entries {
+		out[len(out)-1-i] = e
+	}
+	return out
+}
+
+var std = New(50)
+
+// Add records an error in the process-wide ring.
+func Add(e Entry) {
+	std.Add(e)
+}
+
+// Recent returns the process's recorded errors, newest first.
+func Recent() []Entry {
+	return std.Recent()
+}
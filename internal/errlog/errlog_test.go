@@ -0,0 +1,22 @@
+package errlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRingKeepsRecentErrors(t *testing.T) {
+	r := New(2)
+	now := time.Now()
+	r.Add(Entry{Time: now, Message: "collect failed"})
+	r.Add(Entry{Time: now, Message: "load workspace failed"})
+	r.Add(Entry{Time: now, Message: "rate limit check failed"})
+
+	got := r.Recent()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(got))
+	}
+	if got[0].Message != "rate limit check failed" || got[1].Message != "load workspace failed" {
+		t.Errorf("Expected newest errors first, got %+v", got)
+	}
+}
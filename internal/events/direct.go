@@ -0,0 +1,100 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Without a bus, services announce their work by calling the ws service
+// and the notifier directly. Those calls are sent in the background like
+// Emit's events, and Flush waits for them too.
+
+// ContentNewTopic is the ws topic live feeds subscribe to.
+const ContentNewTopic = "content.new"
+
+// Notification is an event for the notifier's /notify endpoint.
+type Notification struct {
+	Type      string   `json:"type"`
+	Title     string   `json:"title"`
+	Body      string   `json:"body,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Workspace string   `json:"workspace_id,omitempty"`
+}
+
+var directClient = &http.Client{Timeout: 5 * time.Second}
+
+// PublishWS sends payload to the clients in workspace subscribed to topic
+// through the ws service's /publish endpoint, authorized by
+// WS_PUBLISH_TOKEN. It is disabled unless WS_PUBLISH_URL is set; failures
+// are only logged.
+func PublishWS(topic, workspace string, tags []string, payload interface{}) {
+	url := os.Getenv("WS_PUBLISH_URL")
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"topic":        topic,
+		"workspace_id": workspace,
+		"tags":         tags,
+		"payload":      payload,
+	})
+	if err != nil {
+		slog.Error("failed to publish to the ws service", "topic", topic, "error", err)
+		return
+	}
+	post(url, os.Getenv("WS_PUBLISH_TOKEN"), body, http.StatusAccepted)
+}
+
+// Notify reports n to the notifier service at NOTIFIER_URL, authorized by
+// NOTIFIER_TOKEN, which forwards it to the users who asked for it. It is
+// disabled unless NOTIFIER_URL is set; failures are only logged.
+func Notify(n Notification) {
+	url := os.Getenv("NOTIFIER_URL")
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		slog.Error("failed to send notification", "type", n.Type, "error", err)
+		return
+	}
+	post(strings.TrimSuffix(url, "/")+"/notify", os.Getenv("NOTIFIER_TOKEN"), body, http.StatusOK)
+}
+
+// post sends body to url in the background, counted with Emit's events.
+func post(url, token string, body []byte, wantStatus int) {
+	emitting.Add(1)
+	go func() {
+		defer emitting.Done()
+		if err := postJSON(url, token, body, wantStatus); err != nil {
+			slog.Warn("failed to call service", "url", url, "error", err)
+		}
+	}()
+}
+
+func postJSON(url, token string, body []byte, wantStatus int) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := directClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
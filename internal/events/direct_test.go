@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDirectCalls(t *testing.T) {
+	type call struct{ path, auth, body string }
+	calls := make(chan call, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls <- call{r.URL.Path, r.Header.Get("Authorization"), string(body)}
+		if r.URL.Path == "/publish" {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer srv.Close()
+
+	// Disabled without URLs
+	t.Setenv("WS_PUBLISH_URL", "")
+	t.Setenv("NOTIFIER_URL", "")
+	PublishWS(ContentNewTopic, "default", nil, "x")
+	Notify(Notification{Type: "high_relevance_content", Title: "x"})
+
+	t.Setenv("WS_PUBLISH_URL", srv.URL+"/publish")
+	t.Setenv("WS_PUBLISH_TOKEN", "ws-token")
+	t.Setenv("NOTIFIER_URL", srv.URL+"/")
+	t.Setenv("NOTIFIER_TOKEN", "notifier-token")
+	PublishWS(ContentNewTopic, "team-a", []string{"golang"}, map[string]string{"id": "c1"})
+	Notify(Notification{Type: "high_relevance_content", Title: "New in golang", Tags: []string{"golang"}})
+	if err := Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(calls)
+
+	got := map[string]call{}
+	for c := range calls {
+		got[c.path] = c
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected one call each to /publish and /notify, got %+v", got)
+	}
+	if c := got["/publish"]; c.auth != "Bearer ws-token" || c.body != `{"payload":{"id":"c1"},"tags":["golang"],"topic":"content.new","workspace_id":"team-a"}` {
+		t.Errorf("Expected the payload published on content.new, got %+v", c)
+	}
+	if c := got["/notify"]; c.auth != "Bearer notifier-token" || c.body != `{"type":"high_relevance_content","title":"New in golang","tags":["golang"]}` {
+		t.Errorf("Expected the notification sent, got %+v", c)
+	}
+}
@@ -0,0 +1,282 @@
+// Package events carries typed events between services over a bus, so a
+// service can react to another's work as it happens instead of finding it
+// in the database later. Collectors and the uploader announce
+// content.created for every new item, the uploader upload.completed for
+// every processed file too, the vector
+// generator embedding.ready once an item's embedding is stored, and the
+// notifier watch.matched for new content matching a user's watch.
+//
+// EVENT_BUS picks the backend: "nats" (NATS_URL), "postgres" (LISTEN/NOTIFY
+// on the content database) or "" for none, in which case publishing does
+// nothing and subscribers never hear anything.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// Event types.
+const (
+	ContentCreated  = "content.created"
+	UploadCompleted = "upload.completed"
+	EmbeddingReady  = "embedding.ready"
+	WatchMatched    = "watch.matched"
+)
+
+// Event is one message on the bus. Data holds the payload of its type:
+// Content, Upload, Embedding or WatchMatch.
+type Event struct {
+	Type      string          `json:"type"`
+	Workspace string          `json:"workspace_id"`
+	Time      time.Time       `json:"time"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Content is the payload of content.created.
+type Content struct {
+	ID        string    `json:"id"`
+	Platform  string    `json:"platform"`
+	Tags      []string  `json:"tags"`
+	Score     float64   `json:"score"`
+	Summary   string    `json:"summary,omitempty"`
+	SourceURL string    `json:"source_url,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Visibility is the content's; private content is never sent outside
+	// the system.
+	Visibility string `json:"visibility,omitempty"`
+	// Uploaded marks items of an upload, which clients hear about once per
+	// file through upload.completed.
+	Uploaded bool `json:"uploaded,omitempty"`
+}
+
+// Upload is the payload of upload.completed, sent once per processed file
+// rather than per extracted item.
+type Upload struct {
+	ID       string   `json:"id"`
+	Platform string   `json:"platform"`
+	Tags     []string `json:"tags"`
+	Filename string   `json:"filename,omitempty"`
+	Items    int      `json:"items"`
+}
+
+// Embedding is the payload of embedding.ready.
+type Embedding struct {
+	ContentID string `json:"content_id"`
+	Model     string `json:"model,omitempty"`
+}
+
+// WatchMatch is the payload of watch.matched, sent to the one user whose
+// watch expression the content matched.
+type WatchMatch struct {
+	WatchID    string  `json:"watch_id"`
+	UserID     string  `json:"user_id"`
+	Expression string  `json:"expression"`
+	Content    Content `json:"content"`
+}
+
+// New returns an event of type typ carrying data.
+func New(typ, workspace string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %s event: %v", typ, err)
+	}
+	return Event{Type: typ, Workspace: workspace, Time: time.Now().UTC(), Data: raw}, nil
+}
+
+// Decode unmarshals the event's payload into v.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Bus publishes events and delivers them to subscribers.
+type Bus interface {
+	Publish(ctx context.Context, e Event) error
+	// Subscribe calls handle with every event of the given types, or of
+	// any type when none are given, until ctx is done. Lost connections
+	// are logged and retried; an error is only returned when the
+	// subscription itself is refused.
+	Subscribe(ctx context.Context, handle func(Event), types ...string) error
+	Close() error
+}
+
+// matcher reports whether an event type is among types, or any type when
+// types is empty.
+func matcher(types []string) func(string) bool {
+	if len(types) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return func(t string) bool { return set[t] }
+}
+
+// FromEnv returns the bus EVENT_BUS selects. application names the
+// connection in Postgres or NATS.
+func FromEnv(application string) (Bus, error) {
+	switch os.Getenv("EVENT_BUS") {
+	case "":
+		return Discard, nil
+	case "nats":
+		url := os.Getenv("NATS_URL")
+		if url == "" {
+			url = "nats://nats:4222"
+		}
+		return NewNATS(url, application)
+	case "postgres":
+		return NewPostgres(application)
+	default:
+		return nil, fmt.Errorf("unknown EVENT_BUS %q: use nats, postgres or leave it empty", os.Getenv("EVENT_BUS"))
+	}
+}
+
+var (
+	defaultOnce sync.Once
+	defaultBus  Bus
+)
+
+// Default returns the process-wide bus, set from the environment on first
+// use. application is only used then.
+func Default(application string) Bus {
+	defaultOnce.Do(func() {
+		bus, err := FromEnv(application)
+		if err != nil {
+			logging.Fatal("failed to configure the event bus", "error", err)
+		}
+		defaultBus = bus
+	})
+	return defaultBus
+}
+
+// Enabled reports whether the process-wide bus goes anywhere.
+func Enabled(application string) bool {
+	return Default(application) != Discard
+}
+
+// emitting counts the events Emit is still publishing, and the direct
+// calls still being sent.
+var emitting sync.WaitGroup
+
+// Emit publishes an event on the process-wide bus in the background, so it
+// never holds up the work it announces: failures are only logged.
+func Emit(application, typ, workspace string, data interface{}) {
+	bus := Default(application)
+	if bus == Discard {
+		return
+	}
+	e, err := New(typ, workspace, data)
+	if err != nil {
+		slog.Error("failed to publish event", "type", typ, "error", err)
+		return
+	}
+	emitting.Add(1)
+	go func() {
+		defer emitting.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := bus.Publish(ctx, e); err != nil {
+			slog.Warn("failed to publish event", "type", typ, "error", err)
+		}
+	}()
+}
+
+// Flush waits for the events Emit is publishing and the calls PublishWS
+// and Notify are sending, so a service shutting down does not drop what it
+// announced last. It gives up when ctx is done.
+func Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		emitting.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Discard is the bus used without EVENT_BUS: it drops what is published
+// and delivers nothing.
+var Discard Bus = discard{}
+
+type discard struct{}
+
+func (discard) Publish(ctx context.Context, e Event) error { return nil }
+
+func (discard) Subscribe(ctx context.Context, handle func(Event), types ...string) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (discard) Close() error { return nil }
+
+// Memory is a bus within one process, for tests and single-binary setups.
+type Memory struct {
+	mu   sync.Mutex
+	subs map[int]memorySub
+	next int
+}
+
+type memorySub struct {
+	match func(string) bool
+	ch    chan Event
+}
+
+func NewMemory() *Memory {
+	return &Memory{subs: make(map[int]memorySub)}
+}
+
+// Publish hands e to every subscriber of its type. A subscriber more than
+// a hundred events behind misses the event.
+func (m *Memory) Publish(ctx context.Context, e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.subs {
+		if !s.match(e.Type) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			slog.Warn("event subscriber is behind, dropping event", "type", e.Type)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context, handle func(Event), types ...string) error {
+	sub := memorySub{match: matcher(types), ch: make(chan Event, 100)}
+	m.mu.Lock()
+	id := m.next
+	m.next++
+	m.subs[id] = sub
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.subs, id)
+		m.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case e := <-sub.ch:
+			handle(e)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (m *Memory) Close() error { return nil }
@@ -0,0 +1,28 @@
+//go:build integration
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	"selin/internal/config"
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration ./events (needs a Docker daemon)
+
+func TestPostgresAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	bus := newPostgres(db, config.PostgresDSN("test"))
+
+	testDelivery(t, bus, func() {
+		// LISTEN has no acknowledgement to wait for
+		time.Sleep(500 * time.Millisecond)
+	})
+
+	e, _ := New(ContentCreated, "default", Content{Summary: string(make([]byte, maxNotifyBytes))})
+	if err := bus.Publish(t.Context(), e); err == nil {
+		t.Error("Expected an event too large to notify to be rejected")
+	}
+}
@@ -0,0 +1,256 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect subscribes to bus and returns a channel of the events heard.
+func collect(t *testing.T, bus Bus, types ...string) <-chan Event {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	heard := make(chan Event, 10)
+	go bus.Subscribe(ctx, func(e Event) { heard <- e }, types...)
+	return heard
+}
+
+func next(t *testing.T, heard <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-heard:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an event")
+		return Event{}
+	}
+}
+
+func publish(t *testing.T, bus Bus, typ string, data interface{}) {
+	t.Helper()
+	e, err := New(typ, "default", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testDelivery publishes one event of each type and checks that a
+// subscriber to all types hears both, and one to uploads only the upload.
+// ready is called once the subscribers are listening.
+func testDelivery(t *testing.T, bus Bus, ready func()) {
+	all := collect(t, bus)
+	uploads := collect(t, bus, UploadCompleted)
+	ready()
+
+	publish(t, bus, ContentCreated, Content{ID: "c1", Platform: "reddit", Tags: []string{"golang"}, Score: 0.9})
+	publish(t, bus, UploadCompleted, Upload{ID: "f1", Platform: "slack", Items: 3})
+
+	e := next(t, all)
+	var c Content
+	if err := e.Decode(&c); err != nil || e.Type != ContentCreated || e.Workspace != "default" || c.ID != "c1" || c.Score != 0.9 {
+		t.Errorf("Expected the content.created event, got %+v (%+v, %v)", e, c, err)
+	}
+	if e := next(t, all); e.Type != UploadCompleted {
+		t.Errorf("Expected upload.completed next, got %+v", e)
+	}
+
+	e = next(t, uploads)
+	var u Upload
+	if err := e.Decode(&u); err != nil || e.Type != UploadCompleted || u.ID != "f1" || u.Items != 3 {
+		t.Errorf("Expected only upload.completed, got %+v (%+v, %v)", e, u, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	bus := NewMemory()
+	testDelivery(t, bus, func() {
+		for {
+			bus.mu.Lock()
+			n := len(bus.subs)
+			bus.mu.Unlock()
+			if n == 2 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+func TestNATS(t *testing.T) {
+	server := newFakeNATS(t)
+	bus, err := NewNATS("nats://secret@"+server.addr(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	testDelivery(t, bus, func() { server.waitForSubs(t, 2) })
+	if got := server.connectOptions(); !strings.Contains(got, `"auth_token":"secret"`) || !strings.Contains(got, `"name":"test"`) {
+		t.Errorf("Expected the token and name in CONNECT, got %s", got)
+	}
+}
+
+func TestNewNATSRejectsBadURLs(t *testing.T) {
+	for _, u := range []string{"http://nats:4222", "nats://", "::"} {
+		if _, err := NewNATS(u, "test"); err == nil {
+			t.Errorf("Expected %q to be rejected", u)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("EVENT_BUS", "")
+	if bus, err := FromEnv("test"); err != nil || bus != Discard {
+		t.Errorf("Expected Discard without EVENT_BUS, got %v, %v", bus, err)
+	}
+	t.Setenv("EVENT_BUS", "kafka")
+	if _, err := FromEnv("test"); err == nil {
+		t.Error("Expected an unknown bus to be rejected")
+	}
+}
+
+// fakeNATS is just enough of a NATS server for the client: it greets,
+// answers pings and routes PUB to matching SUBs, with ">" as a trailing
+// wildcard.
+type fakeNATS struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	connect string
+	subs    []fakeSub
+}
+
+type fakeSub struct {
+	subject string
+	sid     string
+	conn    net.Conn
+	mu      *sync.Mutex
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATS{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	var wmu sync.Mutex
+	write := func(format string, args ...interface{}) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		fmt.Fprintf(conn, format, args...)
+	}
+	write("INFO {\"server_id\":\"fake\"}\r\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "CONNECT":
+			s.mu.Lock()
+			s.connect = strings.TrimSpace(strings.TrimPrefix(line, "CONNECT"))
+			s.mu.Unlock()
+		case "PING":
+			write("PONG\r\n")
+		case "SUB":
+			s.mu.Lock()
+			s.subs = append(s.subs, fakeSub{subject: fields[1], sid: fields[2], conn: conn, mu: &wmu})
+			s.mu.Unlock()
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.route(fields[1], payload[:size])
+		}
+	}
+}
+
+func (s *fakeNATS) route(subject string, payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs {
+		if sub.subject == subject || strings.HasSuffix(sub.subject, ">") && strings.HasPrefix(subject, strings.TrimSuffix(sub.subject, ">")) {
+			sub.mu.Lock()
+			fmt.Fprintf(sub.conn, "MSG %s %s %d\r\n%s\r\n", subject, sub.sid, len(payload), payload)
+			sub.mu.Unlock()
+		}
+	}
+}
+
+func (s *fakeNATS) waitForSubs(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		got := len(s.subs)
+		s.mu.Unlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscriptions, got %d", n, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (s *fakeNATS) connectOptions() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connect
+}
+
+func TestFlush(t *testing.T) {
+	release := make(chan struct{})
+	emitting.Add(1)
+	go func() {
+		<-release
+		emitting.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected Flush to give up with a publish pending, got %v", err)
+	}
+	close(release)
+	if err := Flush(context.Background()); err != nil {
+		t.Errorf("Expected Flush to return once publishing finished, got %v", err)
+	}
+}
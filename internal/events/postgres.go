@@ -0,0 +1,92 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"selin/internal/config"
+)
+
+// postgresChannel is the channel every event is notified on; subscribers
+// filter by type themselves.
+const postgresChannel = "selin_events"
+
+// Postgres rejects NOTIFY payloads of 8000 bytes or more.
+const maxNotifyBytes = 7999
+
+// Postgres is a bus over LISTEN/NOTIFY. Events are only delivered to
+// listeners connected when they are published, and a notification is sent
+// when its transaction commits, which for Publish is straight away.
+type Postgres struct {
+	db  *sql.DB
+	dsn string
+}
+
+// NewPostgres connects to the content database.
+func NewPostgres(application string) (*Postgres, error) {
+	dsn := config.PostgresDSN(application)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newPostgres(db, dsn), nil
+}
+
+func newPostgres(db *sql.DB, dsn string) *Postgres {
+	return &Postgres{db: db, dsn: dsn}
+}
+
+func (p *Postgres) Publish(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyBytes {
+		return fmt.Errorf("%s event of %d bytes is too large to notify", e.Type, len(payload))
+	}
+	_, err = p.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, postgresChannel, string(payload))
+	return err
+}
+
+func (p *Postgres) Subscribe(ctx context.Context, handle func(Event), types ...string) error {
+	listener := pq.NewListener(p.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("event listener connection failed", "error", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(postgresChannel); err != nil {
+		return fmt.Errorf("failed to listen for events: %v", err)
+	}
+
+	match := matcher(types)
+	for {
+		select {
+		case n := <-listener.Notify:
+			// nil after a reconnect: anything sent meanwhile is lost
+			if n == nil {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				slog.Warn("dropping malformed event", "payload", n.Extra)
+				continue
+			}
+			if match(e.Type) {
+				handle(e)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
@@ -0,0 +1,189 @@
+// Package experiment splits search traffic between ranking variants, so a
+// ranking change is measured on real queries before it becomes the default.
+//
+// An experiment is read from the YAML file at SEARCH_EXPERIMENT_FILE (see
+// config/search-experiment.yaml). Each caller is assigned a variant by a
+// stable hash of the experiment's name and their ID, in proportion to the
+// variants' weights, so they keep seeing the same ranking. The
+// X-Search-Variant header picks a variant by name instead, to try one by
+// hand.
+//
+// Searches served under an experiment are logged in query_history with
+// their variant and the IDs they returned; views and reads recorded with
+// the search's query_id are its feedback. Results compares the variants.
+package experiment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"selin/internal/search"
+)
+
+// Header picks a variant by name.
+const Header = "X-Search-Variant"
+
+// Variant is one way of ranking searches.
+type Variant struct {
+	Name string `yaml:"name" json:"name"`
+	// Weight is the variant's share of callers, relative to the others'
+	Weight int `yaml:"weight" json:"weight"`
+	// Ranker is classic or hybrid
+	Ranker string `yaml:"ranker" json:"ranker"`
+	// Weights are the hybrid ranker's, over search.DefaultWeights
+	Weights string `yaml:"weights,omitempty" json:"weights,omitempty"`
+}
+
+// Ranking returns the hybrid ranker's weights, or nil for the classic
+// ranker.
+func (v Variant) Ranking() (*search.Weights, error) {
+	switch v.Ranker {
+	case "classic":
+		if v.Weights != "" {
+			return nil, fmt.Errorf("variant %s: weights only apply to the hybrid ranker", v.Name)
+		}
+		return nil, nil
+	case "hybrid":
+		w, err := search.ParseWeights(v.Weights, search.DefaultWeights)
+		if err != nil {
+			return nil, fmt.Errorf("variant %s: %w", v.Name, err)
+		}
+		return &w, nil
+	}
+	return nil, fmt.Errorf("variant %s: ranker must be classic or hybrid", v.Name)
+}
+
+// Experiment is a set of variants searches are split between.
+type Experiment struct {
+	Name     string    `yaml:"name" json:"name"`
+	Variants []Variant `yaml:"variants" json:"variants"`
+}
+
+// FromEnv loads the experiment at SEARCH_EXPERIMENT_FILE, or returns nil
+// when it is unset.
+func FromEnv() (*Experiment, error) {
+	path := os.Getenv("SEARCH_EXPERIMENT_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// Load reads and checks an experiment file.
+func Load(path string) (*Experiment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e Experiment
+	if err := yaml.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid experiment file %s: %v", path, err)
+	}
+	if err := e.validate(); err != nil {
+		return nil, fmt.Errorf("invalid experiment file %s: %v", path, err)
+	}
+	return &e, nil
+}
+
+func (e *Experiment) validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("the experiment needs a name")
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("an experiment needs at least two variants")
+	}
+	seen := make(map[string]bool)
+	total := 0
+	for _, v := range e.Variants {
+		if v.Name == "" || seen[v.Name] {
+			return fmt.Errorf("variants need distinct names")
+		}
+		seen[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %s: weight must not be negative", v.Name)
+		}
+		total += v.Weight
+		if _, err := v.Ranking(); err != nil {
+			return err
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("at least one variant needs a weight")
+	}
+	return nil
+}
+
+// Assign returns the variant for caller, or the variant named requested
+// when there is one.
+func (e *Experiment) Assign(caller, requested string) Variant {
+	total := 0
+	for _, v := range e.Variants {
+		if v.Name == requested {
+			return v
+		}
+		total += v.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(e.Name + ":" + caller))
+	n := int(h.Sum32() % uint32(total))
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// VariantResult is how one variant's searches fared.
+type VariantResult struct {
+	Variant string `json:"variant"`
+	Queries int    `json:"queries"`
+	Users   int    `json:"users"`
+	// ClickRate is the share of searches with a result viewed or read
+	// from them, ReadRate the share with a result read
+	ClickRate float64 `json:"click_rate"`
+	ReadRate  float64 `json:"read_rate"`
+	// MRR is the mean reciprocal rank of the first result acted on, 0 for
+	// searches without one
+	MRR float64 `json:"mrr"`
+	// AvgResults is the mean number of matches
+	AvgResults float64 `json:"avg_results"`
+}
+
+// Results compares the variants of the named experiment over the
+// searches logged since then in workspace ("" for every workspace).
+func Results(ctx context.Context, db *sql.DB, name, workspace string, since time.Time) ([]VariantResult, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH searches AS (
+			SELECT q.variant, q.user_id, q.result_count,
+				EXISTS (SELECT 1 FROM content_interactions i WHERE i.query_id = q.id) AS clicked,
+				EXISTS (SELECT 1 FROM content_interactions i WHERE i.query_id = q.id AND i.interaction_type = 'read') AS read,
+				(SELECT MIN(array_position(q.result_ids, i.content_id::text)) FROM content_interactions i WHERE i.query_id = q.id) AS first_rank
+			FROM query_history q
+			WHERE q.experiment = $1 AND ($2 = '' OR q.workspace_id = $2) AND q.created_at >= $3
+		)
+		SELECT variant, COUNT(*), COUNT(DISTINCT user_id),
+			AVG(clicked::int), AVG(read::int), AVG(COALESCE(1.0 / first_rank, 0)), COALESCE(AVG(result_count), 0)
+		FROM searches GROUP BY variant ORDER BY variant`, name, workspace, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load experiment results: %w", err)
+	}
+	defer rows.Close()
+
+	results := []VariantResult{}
+	for rows.Next() {
+		var r VariantResult
+		if err := rows.Scan(&r.Variant, &r.Queries, &r.Users, &r.ClickRate, &r.ReadRate, &r.MRR, &r.AvgResults); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,78 @@
+//go:build integration
+
+package experiment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration ./experiment (needs a Docker daemon)
+
+func TestResultsAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+
+	var a, b string
+	for i, id := range []*string{&a, &b} {
+		err := db.QueryRow(`INSERT INTO content_metadata (source_url, content_summary) VALUES ($1, 'x') RETURNING id`,
+			"https://example.com/"+string(rune('a'+i))).Scan(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	search := func(user, variant string, results ...string) string {
+		t.Helper()
+		var id string
+		err := db.QueryRow(`
+			INSERT INTO query_history (user_id, query_text, tool, result_count, experiment, variant, result_ids)
+			VALUES ($1, 'cosmos', 'content_api', $2, 'exp', $3, string_to_array($4, ',')) RETURNING id`,
+			user, len(results), variant, joinIDs(results)).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	interact := func(query, content, kind string) {
+		t.Helper()
+		if _, err := db.Exec(`INSERT INTO content_interactions (user_id, content_id, interaction_type, query_id)
+			VALUES ('alice', $1, $2, $3)`, content, kind, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// control: one search with its second result read, one ignored
+	interact(search("alice", "control", a, b), b, "read")
+	search("bob", "control", a, b)
+	// hybrid: one search with its first result viewed
+	interact(search("carol", "hybrid", b, a), b, "viewed")
+
+	results, err := Results(ctx, db, "exp", "", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected both variants, got %+v", results)
+	}
+	control, hybrid := results[0], results[1]
+	if control.Queries != 2 || control.Users != 2 || control.ClickRate != 0.5 || control.ReadRate != 0.5 || control.MRR != 0.25 {
+		t.Errorf("Unexpected control results %+v", control)
+	}
+	if hybrid.Queries != 1 || hybrid.ClickRate != 1 || hybrid.ReadRate != 0 || hybrid.MRR != 1 || hybrid.AvgResults != 2 {
+		t.Errorf("Unexpected hybrid results %+v", hybrid)
+	}
+}
+
+func joinIDs(ids []string) string {
+	s := ""
+	for i, id := range ids {
+		if i > 0 {
+			s += ","
+		}
+		s += id
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package experiment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func write(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "experiment.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	e, err := Load(write(t, `
+name: hybrid-vs-classic
+variants:
+  - {name: control, weight: 50, ranker: classic}
+  - {name: hybrid, weight: 50, ranker: hybrid, weights: "keyword=0.7,vector=0.3"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := e.Variants[1].Ranking()
+	if err != nil || w == nil || w.Keyword != 0.7 || w.Relevance != 0.2 {
+		t.Errorf("Expected the variant's weights over the defaults, got %+v, %v", w, err)
+	}
+
+	for name, bad := range map[string]string{
+		"one variant": "name: x\nvariants: [{name: a, weight: 1, ranker: classic}]",
+		"duplicate":   "name: x\nvariants: [{name: a, weight: 1, ranker: classic}, {name: a, weight: 1, ranker: hybrid}]",
+		"no weight":   "name: x\nvariants: [{name: a, ranker: classic}, {name: b, ranker: hybrid}]",
+		"ranker":      "name: x\nvariants: [{name: a, weight: 1, ranker: bm25}, {name: b, weight: 1, ranker: hybrid}]",
+		"weights":     "name: x\nvariants: [{name: a, weight: 1, ranker: classic, weights: keyword=1}, {name: b, weight: 1, ranker: hybrid}]",
+		"no name":     "variants: [{name: a, weight: 1, ranker: classic}, {name: b, weight: 1, ranker: hybrid}]",
+	} {
+		if _, err := Load(write(t, bad)); err == nil {
+			t.Errorf("%s: expected the experiment rejected", name)
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	e := &Experiment{Name: "x", Variants: []Variant{
+		{Name: "control", Weight: 3, Ranker: "classic"},
+		{Name: "off", Weight: 0, Ranker: "classic"},
+		{Name: "hybrid", Weight: 1, Ranker: "hybrid"},
+	}}
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		caller := fmt.Sprintf("user-%d", i)
+		v := e.Assign(caller, "")
+		if e.Assign(caller, "") != v {
+			t.Fatalf("Expected %s to keep its variant", caller)
+		}
+		counts[v.Name]++
+	}
+	if counts["off"] != 0 || counts["control"] < 2700 || counts["control"] > 3300 {
+		t.Errorf("Expected callers split 3:1 by weight, got %v", counts)
+	}
+
+	if v := e.Assign("user-1", "off"); v.Name != "off" {
+		t.Errorf("Expected the requested variant, got %s", v.Name)
+	}
+	if v := e.Assign("user-1", "unknown"); v != e.Assign("user-1", "") {
+		t.Errorf("Expected an unknown variant ignored, got %s", v.Name)
+	}
+}
@@ -0,0 +1,450 @@
+// Package fetch is the HTTP client collectors fetch their sources with, so
+// that each new collector crawls politely without re-implementing it:
+//
+//   - requests to the same host go one at a time, spaced at least Interval
+//     apart (or the host's crawl delay, when longer), across all of a
+//     process's goroutines
+//   - clients fetching web pages follow each site's robots.txt, and no
+//     client fetches from a blocked domain
+//   - failed requests (network errors, 429 and 5xx) are retried with
+//     exponential backoff, waiting as long as a Retry-After asks, up to
+//     MaxRetryAfter; a 429's Retry-After also holds back the host's other
+//     requests
+//   - responses with an ETag or Last-Modified are kept and revalidated, so a
+//     source that has not changed answers 304 and costs nothing to parse
+//   - every request carries the collector's User-Agent
+//   - requests, retries and time spent waiting for a host are exported as
+//     Prometheus metrics by collector
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"selin/internal/config"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fetch_requests_total",
+			Help: "Collector fetches by outcome (ok, not_modified, client_error, server_error, error, disallowed, blocked), retries and robots.txt included",
+		},
+		[]string{"collector", "outcome"},
+	)
+	retriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fetch_retries_total",
+			Help: "Collector fetches retried, by reason (error, rate_limited, server_error)",
+		},
+		[]string{"collector", "reason"},
+	)
+	waitSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "fetch_host_wait_seconds",
+			Help:    "How long collector fetches waited for their host's rate limit",
+			Buckets: prometheus.ExponentialBuckets(0.01, 3, 10),
+		},
+		[]string{"collector"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, retriesTotal, waitSeconds)
+}
+
+// Options are a client's crawling policy.
+type Options struct {
+	// UserAgent is sent with every request
+	UserAgent string
+	// Interval is the least time between two requests to the same host
+	Interval time.Duration
+	// Retries is how many times a failed request is retried
+	Retries int
+	// Backoff is the wait before the first retry, doubled for each next one
+	Backoff time.Duration
+	// MaxRetryAfter caps the wait a Retry-After asks for
+	MaxRetryAfter time.Duration
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// MaxBodySize is the most of a response body that is read
+	MaxBodySize int64
+	// CacheSize is how many responses are kept for revalidation
+	CacheSize int
+	// Robots makes the client follow robots.txt and its crawl delays. It is
+	// set for clients fetching web pages, and left off for those calling
+	// APIs under the API's own terms
+	Robots bool
+	// CrawlDelays overrides Interval for domains and their subdomains,
+	// when longer
+	CrawlDelays map[string]time.Duration
+	// Blocked are domains, subdomains included, never fetched from
+	Blocked []string
+}
+
+// DefaultOptions returns the policy collectors use unless configured
+// otherwise: a request a second per host, three retries.
+func DefaultOptions() Options {
+	return Options{
+		UserAgent:     "selin-bot/1.0",
+		Interval:      time.Second,
+		Retries:       3,
+		Backoff:       time.Second,
+		MaxRetryAfter: 5 * time.Minute,
+		Timeout:       30 * time.Second,
+		MaxBodySize:   10 << 20,
+		CacheSize:     256,
+	}
+}
+
+// OptionsFromEnv returns the default policy with userAgent, overridden by
+// FETCH_HOST_INTERVAL, FETCH_RETRIES and FETCH_TIMEOUT, with the crawl
+// delays of FETCH_CRAWL_DELAYS ("example.com=5s,news.example.org=30s") and
+// the domains of FETCH_BLOCKED_DOMAINS (comma-separated).
+func OptionsFromEnv(userAgent string) Options {
+	opts := DefaultOptions()
+	if userAgent != "" {
+		opts.UserAgent = userAgent
+	}
+	if d, err := time.ParseDuration(config.Env("FETCH_HOST_INTERVAL", "")); err == nil && d >= 0 {
+		opts.Interval = d
+	}
+	if n, err := strconv.Atoi(config.Env("FETCH_RETRIES", "")); err == nil && n >= 0 {
+		opts.Retries = n
+	}
+	if d, err := time.ParseDuration(config.Env("FETCH_TIMEOUT", "")); err == nil && d > 0 {
+		opts.Timeout = d
+	}
+	for _, entry := range strings.Split(config.Env("FETCH_CRAWL_DELAYS", ""), ",") {
+		domain, delay, ok := strings.Cut(entry, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(delay))
+		if !ok || err != nil || d < 0 {
+			continue
+		}
+		if opts.CrawlDelays == nil {
+			opts.CrawlDelays = map[string]time.Duration{}
+		}
+		opts.CrawlDelays[strings.ToLower(strings.TrimSpace(domain))] = d
+	}
+	for _, domain := range strings.Split(config.Env("FETCH_BLOCKED_DOMAINS", ""), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			opts.Blocked = append(opts.Blocked, domain)
+		}
+	}
+	return opts
+}
+
+// Response is a fetched response, its body read.
+type Response struct {
+	// URL is where the response came from, after redirects
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Cached is set when the server answered 304 Not Modified and Body is
+	// the copy kept from before
+	Cached bool
+}
+
+// StatusError is returned for responses other than 200 and 304, once
+// retries are exhausted.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.URL, e.StatusCode)
+}
+
+type cached struct {
+	url          string
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+}
+
+// Client fetches for one collector. It is safe for concurrent use.
+type Client struct {
+	collector string
+	opts      Options
+	// HTTP sends the requests; tests point it at their servers
+	HTTP *http.Client
+
+	mu     sync.Mutex
+	next   map[string]time.Time
+	hosts  map[string]chan struct{}
+	robots map[string]*robots
+	cache  map[string]*cached
+	order  []string
+}
+
+// New returns a client fetching for collector with opts.
+func New(collector string, opts Options) *Client {
+	return &Client{
+		collector: collector,
+		opts:      opts,
+		HTTP:      &http.Client{Timeout: opts.Timeout},
+		next:      map[string]time.Time{},
+		hosts:     map[string]chan struct{}{},
+		robots:    map[string]*robots{},
+		cache:     map[string]*cached{},
+	}
+}
+
+// Get fetches rawURL.
+func (c *Client) Get(ctx context.Context, rawURL string) (*Response, error) {
+	return c.Fetch(ctx, rawURL, nil)
+}
+
+// Fetch GETs rawURL with header added to the request. It waits for the
+// host's turn, retries failures, and answers from the cache when the
+// server reports the response unchanged. Responses other than 200 and 304
+// are returned as a *StatusError, URLs on blocked domains as ErrBlocked
+// and pages robots.txt disallows as ErrDisallowed.
+func (c *Client) Fetch(ctx context.Context, rawURL string, header http.Header) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if c.blocked(strings.ToLower(u.Hostname())) {
+		requestsTotal.WithLabelValues(c.collector, "blocked").Inc()
+		return nil, fmt.Errorf("%w: %s", ErrBlocked, u.Hostname())
+	}
+	if c.opts.Robots {
+		allowed, err := c.robotsAllowed(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			requestsTotal.WithLabelValues(c.collector, "disallowed").Inc()
+			return nil, fmt.Errorf("%w: %s", ErrDisallowed, rawURL)
+		}
+	}
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		release, err := c.acquire(ctx, u.Host)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.wait(ctx, u.Host); err != nil {
+			release()
+			return nil, err
+		}
+		resp, retryAfter, err := c.do(ctx, rawURL, header)
+		release()
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		reason := retryReason(err)
+		if reason == "" || attempt >= c.opts.Retries {
+			return nil, lastErr
+		}
+		retriesTotal.WithLabelValues(c.collector, reason).Inc()
+
+		delay := c.opts.Backoff << attempt
+		if retryAfter > 0 {
+			delay = min(retryAfter, c.opts.MaxRetryAfter)
+			if reason == "rate_limited" {
+				c.holdBack(u.Host, delay)
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// do makes one attempt, returning how long a Retry-After asks to wait.
+func (c *Client) do(ctx context.Context, rawURL string, header http.Header) (*Response, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	c.mu.Lock()
+	prev := c.cache[rawURL]
+	c.mu.Unlock()
+	if prev != nil {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		requestsTotal.WithLabelValues(c.collector, "error").Inc()
+		return nil, 0, &transientError{err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && prev != nil:
+		requestsTotal.WithLabelValues(c.collector, "not_modified").Inc()
+		return &Response{URL: prev.url, StatusCode: http.StatusOK, Header: prev.header, Body: prev.body, Cached: true}, 0, nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, c.opts.MaxBodySize))
+		if err != nil {
+			requestsTotal.WithLabelValues(c.collector, "error").Inc()
+			return nil, 0, &transientError{err}
+		}
+		requestsTotal.WithLabelValues(c.collector, "ok").Inc()
+		final := resp.Request.URL.String()
+		c.store(rawURL, final, resp.Header, body)
+		return &Response{URL: final, StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, 0, nil
+	case resp.StatusCode >= 500:
+		requestsTotal.WithLabelValues(c.collector, "server_error").Inc()
+	default:
+		requestsTotal.WithLabelValues(c.collector, "client_error").Inc()
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil, RetryAfter(resp.Header.Get("Retry-After"), time.Now()), &StatusError{URL: rawURL, StatusCode: resp.StatusCode}
+}
+
+// transientError is a failure to get a response at all.
+type transientError struct{ err error }
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// retryReason returns why err is worth retrying, or "" when it is not.
+func retryReason(err error) string {
+	var status *StatusError
+	switch {
+	case errors.As(err, &status) && status.StatusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case errors.As(err, &status) && status.StatusCode >= 500:
+		return "server_error"
+	case errors.As(err, new(*transientError)) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded):
+		return "error"
+	}
+	return ""
+}
+
+// RetryAfter parses a Retry-After header, in seconds or as an HTTP date,
+// returning 0 when there is none.
+func RetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(0, at.Sub(now))
+	}
+	return 0
+}
+
+// acquire takes host's one request slot, returning the function that
+// gives it back.
+func (c *Client) acquire(ctx context.Context, host string) (func(), error) {
+	c.mu.Lock()
+	slot, ok := c.hosts[host]
+	if !ok {
+		slot = make(chan struct{}, 1)
+		c.hosts[host] = slot
+	}
+	c.mu.Unlock()
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// interval is the least time between two requests to host: Interval, or
+// the crawl delay configured for its domain or asked by its robots.txt
+// when longer. c.mu must be held.
+func (c *Client) interval(host string) time.Duration {
+	interval := c.opts.Interval
+	name := strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = strings.ToLower(h)
+	}
+	for domain, delay := range c.opts.CrawlDelays {
+		if onDomain(name, domain) {
+			interval = max(interval, delay)
+		}
+	}
+	for site, r := range c.robots {
+		if strings.HasSuffix(site, "://"+host) {
+			interval = max(interval, r.delay)
+		}
+	}
+	return interval
+}
+
+// wait blocks until it is host's turn, taking the turn.
+func (c *Client) wait(ctx context.Context, host string) error {
+	c.mu.Lock()
+	now := time.Now()
+	at := c.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	c.next[host] = at.Add(c.interval(host))
+	c.mu.Unlock()
+
+	delay := at.Sub(now)
+	waitSeconds.WithLabelValues(c.collector).Observe(delay.Seconds())
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// holdBack keeps host's next request from starting for d.
+func (c *Client) holdBack(host string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if at := time.Now().Add(d); c.next[host].Before(at) {
+		c.next[host] = at
+	}
+}
+
+// store keeps a response that can be revalidated, forgetting the oldest
+// one once the cache is full.
+func (c *Client) store(rawURL, final string, header http.Header, body []byte) {
+	etag, lastModified := header.Get("ETag"), header.Get("Last-Modified")
+	if (etag == "" && lastModified == "") || c.opts.CacheSize <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.cache[rawURL]; !ok {
+		if len(c.order) >= c.opts.CacheSize {
+			delete(c.cache, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, rawURL)
+	}
+	c.cache[rawURL] = &cached{url: final, etag: etag, lastModified: lastModified, header: header, body: body}
+}
@@ -0,0 +1,132 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.UserAgent = "test-bot/1.0"
+	opts.Interval = 0
+	opts.Backoff = time.Millisecond
+	return opts
+}
+
+func TestFetchRetriesWithRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != "test-bot/1.0" {
+			t.Errorf("Expected the collector's User-Agent, got %q", r.UserAgent())
+		}
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	resp, err := New("test", testOptions()).Get(context.Background(), srv.URL)
+	if err != nil || string(resp.Body) != "ok" {
+		t.Fatalf("Expected the retry to succeed, got %+v, %v", resp, err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls.Load())
+	}
+}
+
+func TestFetchGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c := New("test", testOptions())
+	_, err := c.Get(context.Background(), srv.URL)
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected a 502 StatusError, got %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("Expected the request and 3 retries, got %d calls", calls.Load())
+	}
+
+	calls.Store(0)
+	if _, err := c.Get(context.Background(), srv.URL+"/missing"); !errors.As(err, &status) || status.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 StatusError, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected a 404 not to be retried, got %d calls", calls.Load())
+	}
+}
+
+func TestFetchRevalidatesWithETag(t *testing.T) {
+	var full atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("listing"))
+	}))
+	defer srv.Close()
+
+	c := New("test", testOptions())
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(context.Background(), srv.URL)
+		if err != nil || string(resp.Body) != "listing" || resp.Cached != (i == 1) {
+			t.Fatalf("Fetch %d: unexpected %+v, %v", i, resp, err)
+		}
+	}
+	if full.Load() != 1 {
+		t.Errorf("Expected the second fetch to be revalidated, got %d full responses", full.Load())
+	}
+}
+
+func TestFetchSpacesRequestsToAHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.Interval = 50 * time.Millisecond
+	c := New("test", opts)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get(context.Background(), srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected 3 requests to take at least 2 intervals, took %v", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"Thu, 01 Jan 2026 12:00:30 GMT": 30 * time.Second,
+		"soon":                          0,
+	}
+	for value, want := range tests {
+		if got := RetryAfter(value, now); got != want {
+			t.Errorf("RetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
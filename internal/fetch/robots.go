@@ -0,0 +1,220 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrDisallowed is returned for pages a site's robots.txt disallows.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// ErrBlocked is returned for URLs on a blocked domain.
+var ErrBlocked = errors.New("domain is blocked")
+
+const (
+	// robotsTTL is how long a site's robots.txt is followed before it is
+	// fetched again.
+	robotsTTL = 24 * time.Hour
+	// robotsRetry is how long a site whose robots.txt could not be fetched
+	// is left alone before trying again.
+	robotsRetry = 10 * time.Minute
+	// maxRobotsSize is the most of a robots.txt that is read.
+	maxRobotsSize = 500 << 10
+)
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	match   *regexp.Regexp
+}
+
+// robots is what a site's robots.txt asks of this client's user agent.
+type robots struct {
+	rules   []robotsRule
+	delay   time.Duration
+	expires time.Time
+}
+
+var (
+	allowAll    = &robots{}
+	disallowAll = &robots{rules: []robotsRule{{pattern: "/", match: robotsPattern("/")}}}
+)
+
+// parseRobots reads the rules of the groups naming userAgent's product
+// token, or of the "*" groups when none does.
+func parseRobots(body, userAgent string) *robots {
+	token := strings.ToLower(strings.TrimSpace(strings.SplitN(userAgent, "/", 2)[0]))
+	var specific, wildcard robots
+	var current []*robots
+	inAgents := false
+	for _, line := range strings.Split(body, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field, value = strings.ToLower(strings.TrimSpace(field)), strings.TrimSpace(value)
+		if field == "user-agent" {
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			switch agent := strings.ToLower(value); {
+			case agent == "*":
+				current = append(current, &wildcard)
+			case agent != "" && token != "" && strings.Contains(token, agent):
+				current = append(current, &specific)
+			}
+			continue
+		}
+		inAgents = false
+		for _, group := range current {
+			switch field {
+			case "allow", "disallow":
+				if value != "" {
+					group.rules = append(group.rules, robotsRule{allow: field == "allow", pattern: value, match: robotsPattern(value)})
+				}
+			case "crawl-delay":
+				var seconds float64
+				if _, err := fmt.Sscanf(value, "%g", &seconds); err == nil && seconds > 0 {
+					group.delay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	if len(specific.rules) > 0 || specific.delay > 0 {
+		return &specific
+	}
+	return &wildcard
+}
+
+// allowed reports whether path (with its query) may be fetched: the
+// longest matching rule decides, an allow winning a tie.
+func (r *robots) allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !rule.match.MatchString(path) {
+			continue
+		}
+		if n := len(rule.pattern); n > best || (n == best && rule.allow) {
+			best, allow = n, rule.allow
+		}
+	}
+	return allow
+}
+
+// robotsPattern compiles a robots.txt path pattern, where * matches
+// anything and a trailing $ anchors the end.
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsAllowed reports whether u may be fetched, fetching the site's
+// robots.txt when it is not known or has expired. Sites answering 4xx
+// have no rules; sites that cannot be reached are left alone for a while.
+func (c *Client) robotsAllowed(ctx context.Context, u *url.URL) (bool, error) {
+	site := u.Scheme + "://" + u.Host
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if r := c.cachedRobots(site); r != nil {
+		return r.allowed(path), nil
+	}
+
+	release, err := c.acquire(ctx, u.Host)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	// Another request may have fetched it while this one waited
+	if r := c.cachedRobots(site); r != nil {
+		return r.allowed(path), nil
+	}
+	if err := c.wait(ctx, u.Host); err != nil {
+		return false, err
+	}
+	r := c.fetchRobots(ctx, site)
+	c.mu.Lock()
+	c.robots[site] = r
+	c.mu.Unlock()
+	return r.allowed(path), nil
+}
+
+func (c *Client) cachedRobots(site string) *robots {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.robots[site]; ok && time.Now().Before(r.expires) {
+		return r
+	}
+	return nil
+}
+
+func (c *Client) fetchRobots(ctx context.Context, site string) *robots {
+	expire := func(r robots, ttl time.Duration) *robots {
+		r.expires = time.Now().Add(ttl)
+		return &r
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, site+"/robots.txt", nil)
+	if err != nil {
+		return expire(*disallowAll, robotsRetry)
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		requestsTotal.WithLabelValues(c.collector, "error").Inc()
+		return expire(*disallowAll, robotsRetry)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+		if err != nil {
+			return expire(*disallowAll, robotsRetry)
+		}
+		requestsTotal.WithLabelValues(c.collector, "ok").Inc()
+		return expire(*parseRobots(string(body), c.opts.UserAgent), robotsTTL)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		requestsTotal.WithLabelValues(c.collector, "client_error").Inc()
+		return expire(*allowAll, robotsTTL)
+	default:
+		requestsTotal.WithLabelValues(c.collector, "server_error").Inc()
+		return expire(*disallowAll, robotsRetry)
+	}
+}
+
+// onDomain reports whether host is domain or one of its subdomains.
+func onDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func (c *Client) blocked(host string) bool {
+	for _, domain := range c.opts.Blocked {
+		if onDomain(host, domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# Everyone else stays out of /private
+User-agent: *
+Disallow: /private
+Crawl-delay: 2
+
+User-agent: OtherBot
+User-agent: test-bot
+Disallow: /search
+Disallow: /*.pdf$
+Allow: /search/about
+Crawl-delay: 0.5
+`
+
+func TestParseRobots(t *testing.T) {
+	r := parseRobots(testRobots, "test-bot/1.0")
+	tests := map[string]bool{
+		"/":                  true,
+		"/private/page":      true,
+		"/search?q=go":       false,
+		"/search/about":      true,
+		"/papers/paper.pdf":  false,
+		"/papers/paper.pdfx": true,
+		"/robots.txt":        true,
+	}
+	for path, want := range tests {
+		if got := r.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if r.delay != 500*time.Millisecond {
+		t.Errorf("Expected the group's crawl delay, got %v", r.delay)
+	}
+
+	other := parseRobots(testRobots, "selin-bot/1.0")
+	if other.allowed("/private/page") || !other.allowed("/search") || other.delay != 2*time.Second {
+		t.Errorf("Expected the * group for other agents, got %+v", other)
+	}
+}
+
+func TestFetchFollowsRobots(t *testing.T) {
+	var robotsFetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			robotsFetches.Add(1)
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.Robots = true
+	c := New("test", opts)
+	if _, err := c.Get(context.Background(), srv.URL+"/public"); err != nil {
+		t.Fatalf("Expected an allowed page to be fetched, got %v", err)
+	}
+	if _, err := c.Get(context.Background(), srv.URL+"/private/x"); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("Expected ErrDisallowed, got %v", err)
+	}
+	if robotsFetches.Load() != 1 {
+		t.Errorf("Expected robots.txt to be fetched once, got %d", robotsFetches.Load())
+	}
+}
+
+func TestFetchBlockedDomain(t *testing.T) {
+	opts := testOptions()
+	opts.Blocked = []string{"example.com"}
+	c := New("test", opts)
+	for _, u := range []string{"https://example.com/a", "https://www.example.com/b"} {
+		if _, err := c.Get(context.Background(), u); !errors.Is(err, ErrBlocked) {
+			t.Errorf("Expected %s to be blocked, got %v", u, err)
+		}
+	}
+	if c.blocked("notexample.com") {
+		t.Error("Expected only the domain and its subdomains to be blocked")
+	}
+}
+
+func TestFetchOneRequestPerHost(t *testing.T) {
+	var inFlight, most atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+	}))
+	defer srv.Close()
+
+	c := New("test", testOptions())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Get(context.Background(), srv.URL)
+		}()
+	}
+	wg.Wait()
+	if most.Load() != 1 {
+		t.Errorf("Expected one request at a time, saw %d", most.Load())
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("FETCH_CRAWL_DELAYS", "Example.com=5s, bad, news.example.org=30s")
+	t.Setenv("FETCH_BLOCKED_DOMAINS", "spam.example, ")
+	opts := OptionsFromEnv("")
+	if opts.CrawlDelays["example.com"] != 5*time.Second || opts.CrawlDelays["news.example.org"] != 30*time.Second || len(opts.CrawlDelays) != 2 {
+		t.Errorf("Unexpected crawl delays %v", opts.CrawlDelays)
+	}
+	if len(opts.Blocked) != 1 || opts.Blocked[0] != "spam.example" {
+		t.Errorf("Unexpected blocked domains %v", opts.Blocked)
+	}
+
+	c := New("test", opts)
+	if got := c.interval("www.example.com:443"); got != 5*time.Second {
+		t.Errorf("Expected the domain's crawl delay for a subdomain, got %v", got)
+	}
+}
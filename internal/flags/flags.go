@@ -0,0 +1,253 @@
+// Package flags switches risky pipeline behaviour on per deployment or per
+// user without a code change.
+//
+// Every flag starts off. Its rule can then be set, each source overriding
+// the one before it:
+//
+//	FLAGS_FILE      YAML file mapping flag names to rules (see config/flags.yaml)
+//	FLAG_<NAME>     true or false, e.g. FLAG_SEMANTIC_SEARCH=true
+//	Redis "flags"   hash of flag name to "true", "false" or a JSON rule,
+//	                re-read every FLAGS_REFRESH (default 30s) when REDIS_URL is set
+//
+// Redis is the runtime switch: changing the hash takes effect across every
+// service without a restart.
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/yaml.v3"
+
+	"selin/internal/config"
+	"selin/internal/logging"
+)
+
+type Flag string
+
+const (
+	// ScoringV2 scores collected content with the new scoring engine.
+	ScoringV2 Flag = "scoring_v2"
+	// SemanticSearch answers searches from embeddings instead of text matching.
+	SemanticSearch Flag = "semantic_search"
+	// AsyncProcessing processes uploads in the background.
+	AsyncProcessing Flag = "async_processing"
+	// FollowLinks fetches and stores the articles collected posts link to.
+	FollowLinks Flag = "follow_links"
+)
+
+// Known lists every flag, so each appears in /health even when unset.
+var Known = []Flag{ScoringV2, SemanticSearch, AsyncProcessing, FollowLinks}
+
+// RedisKey is the hash holding runtime overrides.
+const RedisKey = "flags"
+
+// Rule decides who a flag is on for. Users always get the flag, and Percent
+// of the remaining users get it by a stable hash of their ID.
+type Rule struct {
+	Enabled bool     `yaml:"enabled" json:"enabled"`
+	Users   []string `yaml:"users,omitempty" json:"users,omitempty"`
+	Percent int      `yaml:"percent,omitempty" json:"percent,omitempty"`
+}
+
+func (r Rule) enabledFor(flag Flag, user string) bool {
+	if r.Enabled {
+		return true
+	}
+	if user == "" {
+		return false
+	}
+	for _, u := range r.Users {
+		if u == user {
+			return true
+		}
+	}
+	if r.Percent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(string(flag) + ":" + user))
+	return int(h.Sum32()%100) < r.Percent
+}
+
+// parseRule reads a Redis value: "true", "false" or a JSON rule.
+func parseRule(value string) (Rule, error) {
+	if on, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+		return Rule{Enabled: on}, nil
+	}
+	var r Rule
+	if err := json.Unmarshal([]byte(value), &r); err != nil {
+		return Rule{}, fmt.Errorf("want true, false or a JSON rule: %v", err)
+	}
+	return r, nil
+}
+
+// Set holds the current rule for every flag. It is safe for concurrent use.
+type Set struct {
+	redis *redis.Client
+
+	mu    sync.RWMutex
+	base  map[Flag]Rule // file and environment
+	rules map[Flag]Rule // base with the Redis overrides applied
+}
+
+// New builds a set from base rules, without Redis.
+func New(base map[Flag]Rule) *Set {
+	s := &Set{base: map[Flag]Rule{}}
+	for _, f := range Known {
+		s.base[f] = Rule{}
+	}
+	for f, r := range base {
+		s.base[f] = r
+	}
+	s.apply(nil)
+	return s
+}
+
+// FromEnv builds a set from FLAGS_FILE, FLAG_* variables and, when
+// REDIS_URL is set, Redis.
+func FromEnv() (*Set, error) {
+	base := map[Flag]Rule{}
+	if path := os.Getenv("FLAGS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &base); err != nil {
+			return nil, fmt.Errorf("invalid flags file %s: %v", path, err)
+		}
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, "FLAG_") {
+			continue
+		}
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: want true or false", name)
+		}
+		f := Flag(strings.ToLower(strings.TrimPrefix(name, "FLAG_")))
+		r := base[f]
+		r.Enabled = on
+		base[f] = r
+	}
+
+	s := New(base)
+	if addr := os.Getenv("REDIS_URL"); addr != "" {
+		s.redis = config.RedisClient(addr)
+	}
+	return s, nil
+}
+
+// Refresh re-reads the Redis overrides. Without Redis it does nothing.
+func (s *Set) Refresh(ctx context.Context) error {
+	if s.redis == nil {
+		return nil
+	}
+	values, err := s.redis.HGetAll(ctx, RedisKey).Result()
+	if err != nil {
+		return err
+	}
+	s.apply(values)
+	return nil
+}
+
+func (s *Set) apply(overrides map[string]string) {
+	rules := make(map[Flag]Rule, len(s.base))
+	for f, r := range s.base {
+		rules[f] = r
+	}
+	for name, value := range overrides {
+		r, err := parseRule(value)
+		if err != nil {
+			slog.Warn("ignoring invalid flag override", "flag", name, "error", err)
+			continue
+		}
+		rules[Flag(name)] = r
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+}
+
+// Watch refreshes from Redis every interval until ctx is done. A failed
+// refresh keeps the last known rules.
+func (s *Set) Watch(ctx context.Context, interval time.Duration) {
+	if s.redis == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to refresh flags from redis", "error", err)
+		}
+	}
+}
+
+// Enabled reports whether a flag is on for the whole deployment.
+func (s *Set) Enabled(flag Flag) bool {
+	return s.EnabledFor(flag, "")
+}
+
+// EnabledFor reports whether a flag is on for a user.
+func (s *Set) EnabledFor(flag Flag, user string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rules[flag].enabledFor(flag, user)
+}
+
+// Rules returns a copy of the current rules, for /health.
+func (s *Set) Rules() map[Flag]Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make(map[Flag]Rule, len(s.rules))
+	for f, r := range s.rules {
+		rules[f] = r
+	}
+	return rules
+}
+
+var (
+	defaultOnce sync.Once
+	defaultSet  *Set
+)
+
+// Default returns the process-wide set, built by FromEnv on first use and
+// kept in sync with Redis in the background.
+func Default() *Set {
+	defaultOnce.Do(func() {
+		s, err := FromEnv()
+		if err != nil {
+			logging.Fatal("failed to load feature flags", "error", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := s.Refresh(ctx); err != nil {
+			slog.Warn("failed to load flags from redis", "error", err)
+		}
+		cancel()
+
+		interval := 30 * time.Second
+		if d, err := time.ParseDuration(os.Getenv("FLAGS_REFRESH")); err == nil && d > 0 {
+			interval = d
+		}
+		go s.Watch(context.Background(), interval)
+		defaultSet = s
+	})
+	return defaultSet
+}
@@ -0,0 +1,93 @@
+package flags
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromEnvLayersFileAndEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	data := "scoring_v2:\n  enabled: true\nsemantic_search:\n  users: [alice]\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FLAGS_FILE", path)
+	t.Setenv("FLAG_SCORING_V2", "false")
+	t.Setenv("FLAG_ASYNC_PROCESSING", "true")
+	t.Setenv("REDIS_URL", "")
+
+	s, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Enabled(ScoringV2) {
+		t.Error("Expected FLAG_SCORING_V2 to override the file")
+	}
+	if !s.Enabled(AsyncProcessing) {
+		t.Error("Expected FLAG_ASYNC_PROCESSING to enable the flag")
+	}
+	if s.Enabled(SemanticSearch) || !s.EnabledFor(SemanticSearch, "alice") {
+		t.Error("Expected semantic_search to be on for alice only")
+	}
+}
+
+func TestFromEnvRejectsInvalidValue(t *testing.T) {
+	t.Setenv("FLAG_SCORING_V2", "sometimes")
+	if _, err := FromEnv(); err == nil {
+		t.Error("Expected an error for a non-boolean FLAG_ variable")
+	}
+}
+
+func TestRedisOverrides(t *testing.T) {
+	s := New(map[Flag]Rule{ScoringV2: {Enabled: true}})
+	s.apply(map[string]string{
+		"scoring_v2":       "false",
+		"semantic_search":  `{"users":["bob"]}`,
+		"async_processing": "not a rule",
+	})
+
+	if s.Enabled(ScoringV2) {
+		t.Error("Expected Redis to override the base rule")
+	}
+	if !s.EnabledFor(SemanticSearch, "bob") {
+		t.Error("Expected a JSON rule to be applied")
+	}
+	if s.Enabled(AsyncProcessing) {
+		t.Error("Expected an invalid override to be ignored")
+	}
+
+	s.apply(nil)
+	if !s.Enabled(ScoringV2) {
+		t.Error("Expected removing the override to restore the base rule")
+	}
+}
+
+func TestPercentRolloutIsStable(t *testing.T) {
+	r := Rule{Percent: 30}
+	on := 0
+	for i := 0; i < 1000; i++ {
+		user := "user" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if r.enabledFor(ScoringV2, user) != r.enabledFor(ScoringV2, user) {
+			t.Fatalf("Rollout changed between calls for %s", user)
+		}
+		if r.enabledFor(ScoringV2, user) {
+			on++
+		}
+	}
+	if on < 200 || on > 400 {
+		t.Errorf("Expected about 30%% of users, got %d of 1000", on)
+	}
+	if r.enabledFor(ScoringV2, "") {
+		t.Error("Expected a percentage rollout to need a user")
+	}
+}
+
+func TestRulesListsKnownFlags(t *testing.T) {
+	rules := New(nil).Rules()
+	for _, f := range Known {
+		if _, ok := rules[f]; !ok {
+			t.Errorf("Expected %s in Rules", f)
+		}
+	}
+}
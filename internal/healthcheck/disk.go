@@ -0,0 +1,25 @@
+//go:build unix
+
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+)
+
+// DiskSpace checks that the filesystem holding path has at least minFree
+// bytes available.
+func DiskSpace(path string, minFree uint64) Probe {
+	return func(ctx context.Context) error {
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(path, &fs); err != nil {
+			return err
+		}
+		free := uint64(fs.Bavail) * uint64(fs.Bsize)
+		if free < minFree {
+			return fmt.Errorf("%s has %d MB free, want %d MB", path, free>>20, minFree>>20)
+		}
+		return nil
+	}
+}
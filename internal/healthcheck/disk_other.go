@@ -0,0 +1,16 @@
+//go:build !unix
+
+package healthcheck
+
+import (
+	"context"
+	"os"
+)
+
+// DiskSpace only checks that path exists where free space cannot be read.
+func DiskSpace(path string, minFree uint64) Probe {
+	return func(ctx context.Context) error {
+		_, err := os.Stat(path)
+		return err
+	}
+}
@@ -0,0 +1,196 @@
+// Package healthcheck serves a service's /ready endpoint from probes of the
+// things it depends on: Postgres, Redis, disk space, upstream APIs.
+//
+// Results are cached for each check's TTL, so frequent readiness polling
+// does not turn into a stream of pings against the dependencies. A service
+// is ready when all of its required checks pass; optional checks, for
+// dependencies the service can degrade without, are only reported.
+package healthcheck
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	StatusReady    = "READY"
+	StatusNotReady = "NOT_READY"
+
+	Up   = "up"
+	Down = "down"
+
+	DefaultTTL     = 10 * time.Second
+	DefaultTimeout = 2 * time.Second
+)
+
+// Probe returns nil when the dependency is usable.
+type Probe func(ctx context.Context) error
+
+type Check struct {
+	Name  string
+	Probe Probe
+	// Optional checks are reported but do not fail readiness.
+	Optional bool
+	// TTL is how long a result is reused; DefaultTTL when zero.
+	TTL time.Duration
+}
+
+type Result struct {
+	Status    string    `json:"status"`
+	Optional  bool      `json:"optional,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Latency   string    `json:"latency"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the /ready response.
+type Report struct {
+	Status    string            `json:"status"`
+	Service   string            `json:"service"`
+	Timestamp time.Time         `json:"timestamp"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+// Checker runs a service's checks. It is safe for concurrent use.
+type Checker struct {
+	service string
+	timeout time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	checks  []Check
+	results map[string]Result
+}
+
+func New(service string) *Checker {
+	return &Checker{
+		service: service,
+		timeout: DefaultTimeout,
+		now:     time.Now,
+		results: map[string]Result{},
+	}
+}
+
+// Register adds a check. Checks are usually registered once at startup.
+func (c *Checker) Register(check Check) {
+	if check.TTL <= 0 {
+		check.TTL = DefaultTTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+}
+
+// Run probes every check whose cached result has expired, concurrently,
+// and reports the results.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	var due []Check
+	for _, check := range c.checks {
+		if cached, ok := c.results[check.Name]; !ok || now.Sub(cached.CheckedAt) >= check.TTL {
+			due = append(due, check)
+		}
+	}
+	fresh := make([]Result, len(due))
+	var wg sync.WaitGroup
+	for i, check := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fresh[i] = c.probe(ctx, check)
+		}()
+	}
+	wg.Wait()
+	for i, check := range due {
+		c.results[check.Name] = fresh[i]
+	}
+
+	report := Report{Status: StatusReady, Service: c.service, Timestamp: now, Checks: map[string]Result{}}
+	for _, check := range c.checks {
+		result := c.results[check.Name]
+		report.Checks[check.Name] = result
+		if result.Status != Up && !check.Optional {
+			report.Status = StatusNotReady
+		}
+	}
+	return report
+}
+
+func (c *Checker) probe(ctx context.Context, check Check) Result {
+	// A caller hanging up should not get a dependency cached as down
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := c.now()
+	err := check.Probe(ctx)
+	result := Result{
+		Status:    Up,
+		Optional:  check.Optional,
+		Latency:   c.now().Sub(start).Round(time.Millisecond).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = Down
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ServeHTTP writes the report, with a 503 when the service is not ready.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusReady {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// SQL pings a database opened by open, closing it afterwards. Services
+// that open a connection per request pass their usual opener.
+func SQL(open func() (*sql.DB, error)) Probe {
+	return func(ctx context.Context) error {
+		db, err := open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return db.PingContext(ctx)
+	}
+}
+
+func Redis(client *redis.Client) Probe {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// HTTP checks that url answers. Any response below 500 counts: the probe
+// is about reachability, and APIs often refuse unauthenticated requests.
+func HTTP(url string) Probe {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
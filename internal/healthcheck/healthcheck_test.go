@@ -0,0 +1,97 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCachesResults(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := New("test")
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	c.Register(Check{Name: "db", TTL: time.Minute, Probe: func(context.Context) error {
+		calls++
+		return nil
+	}})
+
+	c.Run(context.Background())
+	c.Run(context.Background())
+	if calls != 1 {
+		t.Errorf("Expected a cached result, got %d probes", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	c.Run(context.Background())
+	if calls != 2 {
+		t.Errorf("Expected the expired result to be re-probed, got %d probes", calls)
+	}
+}
+
+func TestOptionalChecksDoNotFailReadiness(t *testing.T) {
+	c := New("test")
+	c.Register(Check{Name: "db", Probe: func(context.Context) error { return nil }})
+	c.Register(Check{Name: "cache", Optional: true, Probe: func(context.Context) error { return errors.New("refused") }})
+
+	report := c.Run(context.Background())
+	if report.Status != StatusReady {
+		t.Errorf("Expected READY, got %s", report.Status)
+	}
+	if got := report.Checks["cache"]; got.Status != Down || got.Error != "refused" || !got.Optional {
+		t.Errorf("Unexpected cache result: %+v", got)
+	}
+}
+
+func TestServeHTTPReportsFailedChecks(t *testing.T) {
+	c := New("test")
+	c.timeout = 10 * time.Millisecond
+	c.Register(Check{Name: "slow", Probe: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"status":"NOT_READY"`) || !strings.Contains(w.Body.String(), "deadline exceeded") {
+		t.Errorf("Unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	status := http.StatusUnauthorized
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer upstream.Close()
+
+	probe := HTTP(upstream.URL)
+	if err := probe(context.Background()); err != nil {
+		t.Errorf("Expected a 401 to count as reachable, got %v", err)
+	}
+	status = http.StatusBadGateway
+	if err := probe(context.Background()); err == nil {
+		t.Error("Expected a 502 to fail")
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskSpace(dir, 0)(context.Background()); err != nil {
+		t.Errorf("Expected no minimum to pass, got %v", err)
+	}
+	if err := DiskSpace(dir, 1<<62)(context.Background()); err == nil {
+		t.Error("Expected an impossible minimum to fail")
+	}
+	if err := DiskSpace(dir+"/missing", 0)(context.Background()); err == nil {
+		t.Error("Expected a missing path to fail")
+	}
+}
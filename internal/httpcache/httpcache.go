@@ -0,0 +1,35 @@
+// Package httpcache builds and compares the weak ETags read-only endpoints
+// answer conditional requests with. The MCP server derives them from the
+// content version, a counter the database bumps on every content write, and
+// the gateway revalidates the responses it caches against them.
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ETag returns the weak ETag of a response at content version, told apart
+// from the responses of other requests by parts such as the workspace and
+// the request URI.
+func ETag(version int64, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return fmt.Sprintf(`W/"%d-%s"`, version, hex.EncodeToString(sum[:8]))
+}
+
+// Matches reports whether an If-None-Match header names etag. ETags are
+// compared weakly, as conditional GETs require, and "*" matches any.
+func Matches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
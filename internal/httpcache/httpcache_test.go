@@ -0,0 +1,41 @@
+package httpcache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	etag := ETag(7, "default", "/content?limit=5")
+	if !strings.HasPrefix(etag, `W/"7-`) {
+		t.Errorf("Expected a weak ETag of version 7, got %s", etag)
+	}
+	if ETag(7, "default", "/content?limit=5") != etag {
+		t.Error("Expected the same request at the same version to keep its ETag")
+	}
+	if ETag(8, "default", "/content?limit=5") == etag || ETag(7, "research", "/content?limit=5") == etag {
+		t.Error("Expected the version and workspace to change the ETag")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	etag := `W/"7-abc"`
+	for _, tt := range []struct {
+		header string
+		want   bool
+	}{
+		{`W/"7-abc"`, true},
+		{`"7-abc"`, true},
+		{`W/"6-abc", W/"7-abc"`, true},
+		{`*`, true},
+		{`W/"6-abc"`, false},
+		{``, false},
+	} {
+		if got := Matches(tt.header, etag); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+	if Matches("*", "") {
+		t.Error("Expected nothing to match a response without an ETag")
+	}
+}
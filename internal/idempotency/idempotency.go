@@ -0,0 +1,287 @@
+// Package idempotency makes retried requests safe. A client that may retry
+// sends an Idempotency-Key header; the first request with a key runs, and
+// its response is kept in Redis so that retries with the same key get that
+// response back instead of running again.
+//
+// A key is bound to the request it was first used with: reusing it for a
+// different method, path or body is rejected with 422, and a retry that
+// arrives while the first request is still running gets 409. Server errors
+// are not kept, so a request that failed with a 5xx can be retried for real.
+// A multipart form counts as the same body when its fields and files are,
+// whatever boundary the client encoded it with.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/logging"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from a previous request.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	DefaultTTL = 24 * time.Hour
+
+	// A request that never finishes (say the process died) holds its key
+	// this long before retries may run it again.
+	pendingTTL = 10 * time.Minute
+
+	maxKeyLength = 255
+	// Responses larger than this are not kept; retries of such requests run
+	// again.
+	maxResponseSize = 1 << 20
+)
+
+// record is what Redis holds for a key: a pending marker while the first
+// request runs, then its response.
+type record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+type Store struct {
+	client *redis.Client
+	ttl    time.Duration
+	prefix string
+}
+
+// New keeps responses in Redis for ttl under keys starting with prefix,
+// usually the service name.
+func New(client *redis.Client, prefix string, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{client: client, ttl: ttl, prefix: "idempotency:" + prefix + ":"}
+}
+
+// fingerprint identifies the request a key was used with, from its method,
+// URI and the digest of its body.
+func fingerprint(r *http.Request, digest []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	h.Write(digest)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// spool copies the request body to a temporary file, hashing it on the
+// way, and has the file stand in for the body. It returns the body's
+// digest and a func removing the file once the request is done. Uploads
+// can be large, so the body is never held in memory.
+func spool(r *http.Request) ([]byte, func(), error) {
+	tmp, err := os.CreateTemp("", "idempotency-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	raw := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, raw), r.Body); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	digest := raw.Sum(nil)
+	if form, ok := formDigest(r, tmp); ok {
+		digest = form
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	r.Body = tmp
+	return digest, cleanup, nil
+}
+
+// formDigest hashes a multipart form by its fields and the SHA-256 of each
+// part, in name order, leaving out the boundary. It reports false for
+// other bodies and for forms it cannot read, which are hashed as they are.
+func formDigest(r *http.Request, body io.ReadSeeker) ([]byte, bool) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, false
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, false
+	}
+	form := multipart.NewReader(body, params["boundary"])
+	var parts []string
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, part); err != nil {
+			return nil, false
+		}
+		parts = append(parts, fmt.Sprintf("%q %q %x", part.FormName(), part.FileName(), h.Sum(nil)))
+	}
+	sort.Strings(parts)
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintln(h, part)
+	}
+	return h.Sum(nil), true
+}
+
+// Middleware applies the store to next. Requests without the header pass
+// straight through, and so does everything while Redis is unreachable:
+// a possible duplicate is better than refusing uploads.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			http.Error(w, fmt.Sprintf("%s must be at most %d characters", Header, maxKeyLength), http.StatusBadRequest)
+			return
+		}
+		log := logging.FromContext(r.Context())
+
+		digest, cleanup, err := spool(r)
+		if err != nil {
+			log.Warn("failed to read request", "error", err)
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
+		}
+		defer cleanup()
+
+		// Keys are per workspace, so tenants cannot replay each other's responses
+		redisKey := s.prefix + r.Header.Get("X-Workspace-ID") + ":" + key
+		fp := fingerprint(r, digest)
+		pending, _ := json.Marshal(record{Fingerprint: fp})
+
+		claimed, err := s.client.SetNX(r.Context(), redisKey, pending, min(pendingTTL, s.ttl)).Result()
+		if err != nil {
+			log.Warn("idempotency store unavailable, running request", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !claimed {
+			s.replay(w, r, redisKey, fp)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.finish(r, redisKey, fp, rec)
+	})
+}
+
+// replay answers a request whose key has been seen before.
+func (s *Store) replay(w http.ResponseWriter, r *http.Request, redisKey, fp string) {
+	data, err := s.client.Get(r.Context(), redisKey).Bytes()
+	if err == redis.Nil {
+		// Expired or released between SETNX and GET; the client can retry
+		http.Error(w, "Request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+	var stored record
+	if err == nil {
+		err = json.Unmarshal(data, &stored)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load idempotent response", "error", err)
+		http.Error(w, "Failed to load previous response", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case stored.Fingerprint != fp:
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+	case !stored.Done:
+		http.Error(w, "Request with this Idempotency-Key is in progress", http.StatusConflict)
+	default:
+		for name, values := range stored.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// finish keeps the response, or releases the key when the response should
+// not be replayed.
+func (s *Store) finish(r *http.Request, redisKey, fp string, rec *recorder) {
+	// The request may have been cancelled; the key must still be settled
+	ctx := context.WithoutCancel(r.Context())
+	if rec.status >= 500 || rec.overflow {
+		if err := s.client.Del(ctx, redisKey).Err(); err != nil {
+			slog.Error("failed to release idempotency key", "error", err)
+		}
+		return
+	}
+
+	header := http.Header{}
+	for _, name := range []string{"Content-Type", "Location"} {
+		if v := rec.Header().Values(name); len(v) > 0 {
+			header[name] = v
+		}
+	}
+	data, _ := json.Marshal(record{
+		Fingerprint: fp,
+		Done:        true,
+		Status:      rec.status,
+		Header:      header,
+		Body:        rec.body.Bytes(),
+	})
+	if err := s.client.Set(ctx, redisKey, data, s.ttl).Err(); err != nil {
+		slog.Error("failed to store idempotent response", "error", err)
+	}
+}
+
+// recorder passes a response through while keeping a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	if !r.overflow {
+		if r.body.Len()+len(p) > maxResponseSize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
@@ -0,0 +1,183 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestStore returns a store on an in-memory Redis and a handler that
+// counts its runs, answering with status.
+func newTestStore(t *testing.T, status int) (http.Handler, *int32, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	var runs int32
+	handler := New(client, "test", time.Hour).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&runs, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"run":` + strconv.Itoa(int(n)) + `,"body":"` + string(body) + `"}`))
+	}))
+	return handler, &runs, mr
+}
+
+func send(h http.Handler, key, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestReplaysResponse(t *testing.T) {
+	h, runs, _ := newTestStore(t, http.StatusCreated)
+
+	first := send(h, "abc", "/upload/file", "data")
+	second := send(h, "abc", "/upload/file", "data")
+	if *runs != 1 {
+		t.Fatalf("Expected the handler to run once, ran %d times", *runs)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("Expected the first response replayed, got %d %s", second.Code, second.Body)
+	}
+	if second.Header().Get(ReplayedHeader) != "true" || second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected replay headers: %v", second.Header())
+	}
+	if first.Header().Get(ReplayedHeader) != "" {
+		t.Error("Expected the original response not to be marked as replayed")
+	}
+}
+
+func TestWithoutKeyRunsEveryTime(t *testing.T) {
+	h, runs, _ := newTestStore(t, http.StatusOK)
+	send(h, "", "/upload/file", "data")
+	send(h, "", "/upload/file", "data")
+	if *runs != 2 {
+		t.Errorf("Expected 2 runs, got %d", *runs)
+	}
+}
+
+func TestRejectsKeyReuseForDifferentRequest(t *testing.T) {
+	h, runs, _ := newTestStore(t, http.StatusOK)
+	send(h, "abc", "/upload/file", "data")
+
+	if w := send(h, "abc", "/upload/file", "other data"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a different body, got %d", w.Code)
+	}
+	if w := send(h, "abc", "/upload/chat", "data"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a different path, got %d", w.Code)
+	}
+	if *runs != 1 {
+		t.Errorf("Expected 1 run, got %d", *runs)
+	}
+}
+
+func TestInProgressConflicts(t *testing.T) {
+	h, _, mr := newTestStore(t, http.StatusOK)
+	r := httptest.NewRequest("POST", "/upload/file", strings.NewReader("data"))
+	digest := sha256.Sum256([]byte("data"))
+	mr.Set("idempotency:test::abc", `{"fingerprint":"`+fingerprint(r, digest[:])+`","done":false}`)
+
+	if w := send(h, "abc", "/upload/file", "data"); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while the first request runs, got %d", w.Code)
+	}
+}
+
+func TestServerErrorsAreNotKept(t *testing.T) {
+	h, runs, _ := newTestStore(t, http.StatusInternalServerError)
+	send(h, "abc", "/upload/file", "data")
+	send(h, "abc", "/upload/file", "data")
+	if *runs != 2 {
+		t.Errorf("Expected a failed request to run again, ran %d times", *runs)
+	}
+}
+
+func TestKeysArePerWorkspace(t *testing.T) {
+	h, runs, _ := newTestStore(t, http.StatusOK)
+	for _, ws := range []string{"a", "b"} {
+		r := httptest.NewRequest("POST", "/upload/file", strings.NewReader("data"))
+		r.Header.Set(Header, "abc")
+		r.Header.Set("X-Workspace-ID", ws)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if *runs != 2 {
+		t.Errorf("Expected each workspace's request to run, ran %d times", *runs)
+	}
+}
+
+func TestRedisDownRunsRequest(t *testing.T) {
+	h, runs, mr := newTestStore(t, http.StatusOK)
+	mr.Close()
+	if w := send(h, "abc", "/upload/file", "data"); w.Code != http.StatusOK || *runs != 1 {
+		t.Errorf("Expected the request to run without Redis, got %d after %d runs", w.Code, *runs)
+	}
+}
+
+func TestRejectsLongKeys(t *testing.T) {
+	h, _, _ := newTestStore(t, http.StatusOK)
+	if w := send(h, strings.Repeat("k", maxKeyLength+1), "/upload/file", "data"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
+
+// sendForm posts a multipart form with a file, encoded with boundary.
+func sendForm(t *testing.T, h http.Handler, key, boundary, platform, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	form.WriteField("platform", platform)
+	file, _ := form.CreateFormFile("file", "notes.md")
+	file.Write([]byte(content))
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/upload/chat", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set(Header, key)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestFormsMatchAcrossBoundaries(t *testing.T) {
+	h, runs, _ := newTestStore(t, http.StatusCreated)
+
+	sendForm(t, h, "abc", "first-boundary", "slack", "# Notes")
+	if w := sendForm(t, h, "abc", "second-boundary", "slack", "# Notes"); w.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("Expected a retry with a new boundary replayed, got %d", w.Code)
+	}
+	if w := sendForm(t, h, "abc", "third-boundary", "slack", "# Other notes"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a different file, got %d", w.Code)
+	}
+	if w := sendForm(t, h, "abc", "first-boundary", "discord", "# Notes"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a different field, got %d", w.Code)
+	}
+	if *runs != 1 {
+		t.Errorf("Expected 1 run, got %d", *runs)
+	}
+}
+
+func TestSpooledBodyReachesHandler(t *testing.T) {
+	h, _, _ := newTestStore(t, http.StatusOK)
+	if w := send(h, "abc", "/upload/file", "data"); !strings.Contains(w.Body.String(), `"body":"data"`) {
+		t.Errorf("Expected the handler to read the whole body, got %s", w.Body)
+	}
+}
@@ -0,0 +1,289 @@
+// Package keyring encrypts content at rest with per-workspace AES-256-GCM
+// keys, for workspaces whose content, such as private chat exports, should
+// not be readable from a database dump or the blob volume.
+//
+// A workspace's keys come from the secrets provider, under
+// CONTENT_ENCRYPTION_KEYS_<WORKSPACE> (the workspace upper-cased, anything
+// but letters and digits replaced by "_"), as comma-separated
+// "<id>:<base64 of 32 bytes>" entries. The first key encrypts; all of them
+// decrypt, so a key is rotated by putting a new one first and keeping the
+// old one until the MCP server's "encryption" reindex step has rewrapped
+// everything under the new one. Workspaces without keys are stored in
+// plaintext, and plaintext stored before a workspace got keys still reads.
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"selin/internal/config"
+	"selin/internal/secrets"
+)
+
+// magic starts every sealed value; it is followed by the key ID's length
+// and the key ID, the nonce, and the ciphertext.
+var magic = []byte("SELENC1\x00")
+
+// stringPrefix starts sealed values stored in text columns, followed by
+// the base64 of the sealed bytes.
+const stringPrefix = "enc:"
+
+// ErrUnknownKey is returned when opening a value sealed under a key the
+// workspace no longer lists.
+var ErrUnknownKey = errors.New("content sealed under an unknown key")
+
+// Source is where keys are looked up; *secrets.Cache is one.
+type Source interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Keyring seals and opens content. A nil Keyring stores plaintext.
+type Keyring struct {
+	src Source
+}
+
+// New looks keys up in src.
+func New(src Source) *Keyring {
+	return &Keyring{src: src}
+}
+
+var (
+	defaultOnce sync.Once
+	defaultRing *Keyring
+)
+
+// Default returns the process-wide keyring, on the configured secrets
+// provider.
+func Default() *Keyring {
+	defaultOnce.Do(func() {
+		defaultRing = New(config.Secrets())
+	})
+	return defaultRing
+}
+
+// SecretName is the secret holding workspace's keys.
+func SecretName(workspace string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, workspace)
+	return "CONTENT_ENCRYPTION_KEYS_" + name
+}
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// parseKeys parses a key list, current key first.
+func parseKeys(value string) ([]key, error) {
+	var keys []key
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid key entry: expected <id>:<base64 key>")
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("invalid key %s: expected 32 bytes, base64 encoded", id)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key{id: id, aead: aead})
+	}
+	return keys, nil
+}
+
+// keys returns workspace's keys, none when it has no secret.
+func (k *Keyring) keys(ctx context.Context, workspace string) ([]key, error) {
+	if k == nil {
+		return nil, nil
+	}
+	value, err := k.src.Get(ctx, SecretName(workspace))
+	if errors.Is(err, secrets.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %v", err)
+	}
+	keys, err := parseKeys(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", SecretName(workspace), err)
+	}
+	return keys, nil
+}
+
+// Enabled reports whether workspace's content is encrypted.
+func (k *Keyring) Enabled(ctx context.Context, workspace string) (bool, error) {
+	keys, err := k.keys(ctx, workspace)
+	return len(keys) > 0, err
+}
+
+// Sealed reports whether data was sealed.
+func Sealed(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Seal encrypts plaintext under workspace's current key, or returns it as
+// it is when the workspace has no keys. The workspace is authenticated
+// with it, so sealed content cannot be moved to another workspace.
+func (k *Keyring) Seal(ctx context.Context, workspace string, plaintext []byte) ([]byte, error) {
+	keys, err := k.keys(ctx, workspace)
+	if err != nil || len(keys) == 0 {
+		return plaintext, err
+	}
+	current := keys[0]
+	nonce := make([]byte, current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(magic)+1+len(current.id)+len(nonce)+len(plaintext)+current.aead.Overhead())
+	out = append(out, magic...)
+	out = append(out, byte(len(current.id)))
+	out = append(out, current.id...)
+	out = append(out, nonce...)
+	return current.aead.Seal(out, nonce, plaintext, []byte(workspace)), nil
+}
+
+// Open decrypts what Seal returned. Data that was not sealed is returned
+// as it is.
+func (k *Keyring) Open(ctx context.Context, workspace string, data []byte) ([]byte, error) {
+	if !Sealed(data) {
+		return data, nil
+	}
+	id, rest, err := splitSealed(data)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := k.keys(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.id != id {
+			continue
+		}
+		size := key.aead.NonceSize()
+		if len(rest) < size {
+			return nil, fmt.Errorf("sealed content is truncated")
+		}
+		plaintext, err := key.aead.Open(nil, rest[:size], rest[size:], []byte(workspace))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt content under key %s: %v", id, err)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("%w %s", ErrUnknownKey, id)
+}
+
+// Stale reports whether data should be sealed again: it is plaintext in a
+// workspace that has keys, or sealed under a key other than the current
+// one.
+func (k *Keyring) Stale(ctx context.Context, workspace string, data []byte) (bool, error) {
+	keys, err := k.keys(ctx, workspace)
+	if err != nil || len(keys) == 0 {
+		return false, err
+	}
+	if !Sealed(data) {
+		return true, nil
+	}
+	id, _, err := splitSealed(data)
+	if err != nil {
+		return false, err
+	}
+	return id != keys[0].id, nil
+}
+
+// Rewrap opens data and seals it again under workspace's current key.
+func (k *Keyring) Rewrap(ctx context.Context, workspace string, data []byte) ([]byte, error) {
+	plaintext, err := k.Open(ctx, workspace, data)
+	if err != nil {
+		return nil, err
+	}
+	return k.Seal(ctx, workspace, plaintext)
+}
+
+func splitSealed(data []byte) (string, []byte, error) {
+	rest := data[len(magic):]
+	if len(rest) == 0 || len(rest) < 1+int(rest[0]) {
+		return "", nil, fmt.Errorf("sealed content is truncated")
+	}
+	n := int(rest[0])
+	return string(rest[1 : 1+n]), rest[1+n:], nil
+}
+
+// SealString seals text for a text column.
+func (k *Keyring) SealString(ctx context.Context, workspace, text string) (string, error) {
+	sealed, err := k.Seal(ctx, workspace, []byte(text))
+	if err != nil || !Sealed(sealed) {
+		return text, err
+	}
+	return stringPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenString opens what SealString returned. Text that was not sealed is
+// returned as it is.
+func (k *Keyring) OpenString(ctx context.Context, workspace, text string) (string, error) {
+	data, err := sealedString(text)
+	if err != nil || data == nil {
+		return text, err
+	}
+	plaintext, err := k.Open(ctx, workspace, data)
+	return string(plaintext), err
+}
+
+// StaleString is Stale for what SealString returned.
+func (k *Keyring) StaleString(ctx context.Context, workspace, text string) (bool, error) {
+	data, err := sealedString(text)
+	if err != nil {
+		return false, err
+	}
+	if data == nil {
+		data = []byte(text)
+	}
+	return k.Stale(ctx, workspace, data)
+}
+
+// RewrapString is Rewrap for what SealString returned.
+func (k *Keyring) RewrapString(ctx context.Context, workspace, text string) (string, error) {
+	plaintext, err := k.OpenString(ctx, workspace, text)
+	if err != nil {
+		return "", err
+	}
+	return k.SealString(ctx, workspace, plaintext)
+}
+
+// sealedString decodes sealed text, returning nil for plaintext.
+func sealedString(text string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(text, stringPrefix)
+	if !ok {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !Sealed(data) {
+		// Plaintext that happens to start with the prefix
+		return nil, nil
+	}
+	return data, nil
+}
@@ -0,0 +1,107 @@
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"selin/internal/secrets"
+)
+
+type staticSource map[string]string
+
+func (s staticSource) Get(_ context.Context, name string) (string, error) {
+	if v, ok := s[name]; ok {
+		return v, nil
+	}
+	return "", secrets.ErrNotFound
+}
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestSecretName(t *testing.T) {
+	if got := SecretName("team-a.chat"); got != "CONTENT_ENCRYPTION_KEYS_TEAM_A_CHAT" {
+		t.Errorf("Unexpected secret name %q", got)
+	}
+}
+
+func TestSealAndOpen(t *testing.T) {
+	ctx := context.Background()
+	k := New(staticSource{SecretName("private"): "k1:" + testKey(1)})
+
+	sealed, err := k.Seal(ctx, "private", []byte("meet at noon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Sealed(sealed) || bytes.Contains(sealed, []byte("noon")) {
+		t.Fatalf("Expected the content to be encrypted, got %q", sealed)
+	}
+	if opened, err := k.Open(ctx, "private", sealed); err != nil || string(opened) != "meet at noon" {
+		t.Errorf("Expected the content back, got %q (%v)", opened, err)
+	}
+	if _, err := k.Open(ctx, "other", sealed); err == nil {
+		t.Error("Expected content sealed for one workspace not to open in another")
+	}
+
+	// Workspaces without keys are stored as they are, and plaintext
+	// stored before keys were added still reads
+	if plain, err := k.Seal(ctx, "public", []byte("hello")); err != nil || string(plain) != "hello" {
+		t.Errorf("Expected plaintext for a workspace without keys, got %q (%v)", plain, err)
+	}
+	if opened, err := k.Open(ctx, "private", []byte("old")); err != nil || string(opened) != "old" {
+		t.Errorf("Expected plaintext to open as it is, got %q (%v)", opened, err)
+	}
+
+	var none *Keyring
+	if plain, err := none.Seal(ctx, "private", []byte("hello")); err != nil || string(plain) != "hello" {
+		t.Errorf("Expected a nil keyring to store plaintext, got %q (%v)", plain, err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	src := staticSource{SecretName("w"): "old:" + testKey(1)}
+	k := New(src)
+	sealed, err := k.SealString(ctx, "w", "transcript")
+	if err != nil || !strings.HasPrefix(sealed, "enc:") {
+		t.Fatalf("Expected sealed text, got %q (%v)", sealed, err)
+	}
+
+	src[SecretName("w")] = "new:" + testKey(2) + ", old:" + testKey(1)
+	if stale, err := k.StaleString(ctx, "w", sealed); err != nil || !stale {
+		t.Errorf("Expected text under the old key to be stale, got %v (%v)", stale, err)
+	}
+	if opened, err := k.OpenString(ctx, "w", sealed); err != nil || opened != "transcript" {
+		t.Errorf("Expected the old key to still decrypt, got %q (%v)", opened, err)
+	}
+	rewrapped, err := k.RewrapString(ctx, "w", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale, _ := k.StaleString(ctx, "w", rewrapped); stale {
+		t.Error("Expected rewrapped text to be under the current key")
+	}
+	if stale, _ := k.StaleString(ctx, "w", "plaintext"); !stale {
+		t.Error("Expected plaintext in a workspace with keys to be stale")
+	}
+
+	src[SecretName("w")] = "new:" + testKey(2)
+	if _, err := k.OpenString(ctx, "w", sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey once the old key is dropped, got %v", err)
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	for _, value := range []string{"nokey", "k1:not-base64!", "k1:" + base64.StdEncoding.EncodeToString([]byte("short"))} {
+		k := New(staticSource{SecretName("w"): value})
+		if _, err := k.Seal(ctx, "w", []byte("x")); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
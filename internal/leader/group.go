@@ -0,0 +1,219 @@
+package leader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/config"
+)
+
+// Take the lease if it is free, or extend it if it is ours.
+var claimScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end
+if not owner then redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2]) return 1 end
+return 0`)
+
+// Group shares work, such as the sources a collector polls, among a
+// service's live replicas. Each instance announces itself in a Redis sorted
+// set while it runs, and Assign splits items among the live members by
+// rendezvous hashing: every instance computes the same split, and only the
+// items of an instance that joins or leaves move. Claim guards each item
+// with a lease for the moments when instances disagree about who is live.
+//
+// A nil *Group, returned by GroupFromEnv without REDIS_URL, is assigned
+// every item.
+type Group struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	claimed map[string]bool
+}
+
+// NewGroup returns a member of the group at key. A member is live until
+// ttl after its last announcement, which it makes every third of ttl.
+func NewGroup(client *redis.Client, key string, ttl time.Duration) *Group {
+	return &Group{client: client, key: key, id: instanceID(), ttl: ttl, claimed: make(map[string]bool)}
+}
+
+// GroupFromEnv returns a member of the group at key on the Redis at
+// REDIS_URL, or nil when it is unset.
+func GroupFromEnv(key string, ttl time.Duration) *Group {
+	addr := os.Getenv("REDIS_URL")
+	if addr == "" {
+		return nil
+	}
+	return NewGroup(config.RedisClient(addr), key, ttl)
+}
+
+// ID identifies this instance in the group.
+func (g *Group) ID() string {
+	if g == nil {
+		host, _ := os.Hostname()
+		return host
+	}
+	return g.id
+}
+
+// Client is the Redis client, for readiness checks; nil without Redis.
+func (g *Group) Client() *redis.Client {
+	if g == nil {
+		return nil
+	}
+	return g.client
+}
+
+// Run announces this instance until ctx is done, then leaves the group and
+// releases its leases so the others take its items straight away.
+func (g *Group) Run(ctx context.Context) {
+	if g == nil {
+		<-ctx.Done()
+		return
+	}
+	defer g.leave()
+
+	ticker := time.NewTicker(g.ttl / 3)
+	defer ticker.Stop()
+	for {
+		if err := g.announce(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to announce group membership", "key", g.key, "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (g *Group) announce(ctx context.Context) error {
+	now := time.Now()
+	_, err := g.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, g.key, &redis.Z{Score: float64(now.UnixMilli()), Member: g.id})
+		p.ZRemRangeByScore(ctx, g.key, "-inf", strconv.FormatInt(now.Add(-g.ttl).UnixMilli(), 10))
+		return nil
+	})
+	return err
+}
+
+func (g *Group) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	g.client.ZRem(ctx, g.key, g.id)
+
+	g.mu.Lock()
+	items := make([]string, 0, len(g.claimed))
+	for item := range g.claimed {
+		items = append(items, item)
+	}
+	g.mu.Unlock()
+	for _, item := range items {
+		g.Release(ctx, item)
+	}
+}
+
+// Members lists the live instances, this one included.
+func (g *Group) Members(ctx context.Context) ([]string, error) {
+	if g == nil {
+		return []string{g.ID()}, nil
+	}
+	since := strconv.FormatInt(time.Now().Add(-g.ttl).UnixMilli(), 10)
+	members, err := g.client.ZRangeByScore(ctx, g.key, &redis.ZRangeBy{Min: "(" + since, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if m == g.id {
+			return members, nil
+		}
+	}
+	// Not announced yet, or Run is not running
+	return append(members, g.id), nil
+}
+
+// Assign returns the items assigned to this instance, in their order, and
+// releases the leases it holds on items now assigned to others.
+func (g *Group) Assign(ctx context.Context, items []string) ([]string, error) {
+	if g == nil {
+		return items, nil
+	}
+	members, err := g.Members(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list group members: %w", err)
+	}
+	var mine []string
+	for _, item := range items {
+		if owner(members, item) == g.id {
+			mine = append(mine, item)
+			continue
+		}
+		g.mu.Lock()
+		held := g.claimed[item]
+		g.mu.Unlock()
+		if held {
+			g.Release(ctx, item)
+		}
+	}
+	return mine, nil
+}
+
+// owner picks the member with the highest hash of member and item.
+func owner(members []string, item string) string {
+	var best string
+	var bestHash uint64
+	for _, m := range members {
+		h := sha256.Sum256([]byte(m + "\x00" + item))
+		if sum := binary.BigEndian.Uint64(h[:8]); best == "" || sum > bestHash || (sum == bestHash && m < best) {
+			best, bestHash = m, sum
+		}
+	}
+	return best
+}
+
+// Claim takes or extends this instance's lease on item for ttl, reporting
+// false when another instance holds it.
+func (g *Group) Claim(ctx context.Context, item string, ttl time.Duration) (bool, error) {
+	if g == nil {
+		return true, nil
+	}
+	ok, err := claimScript.Run(ctx, g.client, []string{g.leaseKey(item)}, g.id, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	if ok == 1 {
+		g.mu.Lock()
+		g.claimed[item] = true
+		g.mu.Unlock()
+	}
+	return ok == 1, nil
+}
+
+// Release gives up this instance's lease on item, if it holds it.
+func (g *Group) Release(ctx context.Context, item string) {
+	if g == nil {
+		return
+	}
+	if err := releaseScript.Run(ctx, g.client, []string{g.leaseKey(item)}, g.id).Err(); err != nil {
+		slog.Warn("failed to release lease", "key", g.leaseKey(item), "error", err)
+		return
+	}
+	g.mu.Lock()
+	delete(g.claimed, item)
+	g.mu.Unlock()
+}
+
+func (g *Group) leaseKey(item string) string {
+	return g.key + ":lease:" + item
+}
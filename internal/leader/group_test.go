@@ -0,0 +1,109 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestGroupSplitsItems(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	a := NewGroup(client, "test:group", time.Minute)
+	b := NewGroup(client, "test:group", time.Minute)
+	for _, g := range []*Group{a, b} {
+		if err := g.announce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var items []string
+	for i := 0; i < 40; i++ {
+		items = append(items, fmt.Sprintf("source-%d", i))
+	}
+	mineA, err := a.Assign(ctx, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineB, err := b.Assign(ctx, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mineA)+len(mineB) != len(items) || len(mineA) == 0 || len(mineB) == 0 {
+		t.Fatalf("Expected the items split between both, got %d and %d", len(mineA), len(mineB))
+	}
+	seen := make(map[string]bool)
+	for _, item := range append(mineA, mineB...) {
+		if seen[item] {
+			t.Errorf("Expected %s assigned once", item)
+		}
+		seen[item] = true
+	}
+
+	// Once b leaves, a takes everything
+	b.leave()
+	if mineA, _ = a.Assign(ctx, items); len(mineA) != len(items) {
+		t.Errorf("Expected a to be assigned all %d items, got %d", len(items), len(mineA))
+	}
+}
+
+func TestGroupMembersExpire(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	a := NewGroup(client, "test:group", time.Minute)
+	// Announced long ago
+	client.ZAdd(context.Background(), "test:group", &redis.Z{Score: float64(time.Now().Add(-2 * time.Minute).UnixMilli()), Member: "gone"})
+
+	members, err := a.Members(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0] != a.ID() {
+		t.Errorf("Expected only this instance live, got %v", members)
+	}
+}
+
+func TestGroupClaims(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	a := NewGroup(client, "test:group", time.Minute)
+	b := NewGroup(client, "test:group", time.Minute)
+
+	if ok, err := a.Claim(ctx, "golang", time.Minute); !ok || err != nil {
+		t.Fatalf("Expected a to claim a free item, got %v (%v)", ok, err)
+	}
+	if ok, _ := a.Claim(ctx, "golang", time.Minute); !ok {
+		t.Error("Expected a to extend its own lease")
+	}
+	if ok, _ := b.Claim(ctx, "golang", time.Minute); ok {
+		t.Error("Expected b refused while a holds the lease")
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if ok, _ := b.Claim(ctx, "golang", time.Minute); !ok {
+		t.Error("Expected b to claim the item once a's lease expired")
+	}
+	// a no longer holds it, so releasing leaves b's lease alone
+	a.Release(ctx, "golang")
+	if got, _ := mr.Get("test:group:lease:golang"); got != b.ID() {
+		t.Errorf("Expected b to keep the lease, got %q", got)
+	}
+}
+
+func TestNilGroupGetsEverything(t *testing.T) {
+	var g *Group
+	items := []string{"golang", "rust"}
+	mine, err := g.Assign(context.Background(), items)
+	if err != nil || len(mine) != 2 {
+		t.Errorf("Expected a nil group assigned every item, got %v (%v)", mine, err)
+	}
+	if ok, _ := g.Claim(context.Background(), "golang", time.Minute); !ok {
+		t.Error("Expected a nil group to claim anything")
+	}
+}
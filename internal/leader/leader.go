@@ -0,0 +1,174 @@
+// Package leader elects one instance among a service's replicas to do work
+// that must not run twice, through a lock in Redis: the instance holding
+// the key leads and renews it, the others retry until it is released or
+// expires. A leader that cannot renew in time stops leading before its key
+// expires, so two instances never lead at once.
+//
+// Work that can be split instead, such as polling many sources, is shared
+// among the live replicas by a Group.
+//
+// A nil *Elector, returned by FromEnv without REDIS_URL, always leads: a
+// single instance needs no election.
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/config"
+)
+
+// Renew the key if it is still ours, or release it.
+var (
+	renewScript   = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`)
+	releaseScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+)
+
+// Elector campaigns for one Redis key.
+type Elector struct {
+	client  *redis.Client
+	key     string
+	id      string
+	ttl     time.Duration
+	leading atomic.Bool
+}
+
+// New returns an elector for key. The key expires ttl after the leader
+// last renewed it, which it does every third of ttl.
+func New(client *redis.Client, key string, ttl time.Duration) *Elector {
+	return &Elector{client: client, key: key, id: instanceID(), ttl: ttl}
+}
+
+// FromEnv returns an elector for key on the Redis at REDIS_URL, or nil when
+// it is unset.
+func FromEnv(key string, ttl time.Duration) *Elector {
+	addr := os.Getenv("REDIS_URL")
+	if addr == "" {
+		return nil
+	}
+	return New(config.RedisClient(addr), key, ttl)
+}
+
+func instanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// ID identifies this instance in the lock.
+func (e *Elector) ID() string {
+	if e == nil {
+		host, _ := os.Hostname()
+		return host
+	}
+	return e.id
+}
+
+// Leading reports whether this instance leads now.
+func (e *Elector) Leading() bool {
+	return e == nil || e.leading.Load()
+}
+
+// Client is the Redis client, for readiness checks; nil without Redis.
+func (e *Elector) Client() *redis.Client {
+	if e == nil {
+		return nil
+	}
+	return e.client
+}
+
+// Run campaigns until ctx is done, calling lead whenever this instance
+// becomes leader. The context lead gets is cancelled when leadership is
+// lost, and lead must return then. On the way out the key is released so
+// another instance takes over without waiting for it to expire.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	if e == nil {
+		lead(ctx)
+		return
+	}
+	defer e.release()
+
+	interval := e.ttl / 3
+	for {
+		if e.acquire(ctx) {
+			slog.Info("became leader", "key", e.key, "instance", e.id)
+			e.lead(ctx, interval, lead)
+			slog.Info("stopped leading", "key", e.key, "instance", e.id)
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Elector) acquire(ctx context.Context) bool {
+	ok, err := e.client.SetNX(ctx, e.key, e.id, e.ttl).Result()
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("leader election failed", "key", e.key, "error", err)
+	}
+	return ok
+}
+
+// lead runs lead while renewing the key, returning once either stops.
+func (e *Elector) lead(ctx context.Context, interval time.Duration, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.leading.Store(true)
+	defer e.leading.Store(false)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		case <-ticker.C:
+			ok, err := renewScript.Run(ctx, e.client, []string{e.key}, e.id, e.ttl.Milliseconds()).Int()
+			switch {
+			case err == nil && ok == 1:
+				renewed = time.Now()
+				continue
+			case err == nil:
+				slog.Warn("lost leadership to another instance", "key", e.key)
+			case time.Since(renewed) < e.ttl-interval:
+				// Redis blipped; the key is still ours for a while
+				slog.Warn("failed to renew leadership", "key", e.key, "error", err)
+				continue
+			default:
+				slog.Error("failed to renew leadership in time", "key", e.key, "error", err)
+			}
+			// Stop before the key expires and another instance leads
+			e.leading.Store(false)
+			cancel()
+			<-done
+			return
+		}
+	}
+}
+
+func (e *Elector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	releaseScript.Run(ctx, e.client, []string{e.key}, e.id)
+}
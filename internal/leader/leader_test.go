@@ -0,0 +1,93 @@
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestOneInstanceLeads(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	a := New(client, "test:leader", 300*time.Millisecond)
+	b := New(client, "test:leader", 300*time.Millisecond)
+
+	var leaders atomic.Int32
+	lead := func(ctx context.Context) {
+		leaders.Add(1)
+		<-ctx.Done()
+		leaders.Add(-1)
+	}
+	ctxA, stopA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() { a.Run(ctxA, lead); close(doneA) }()
+	waitUntil(t, a.Leading)
+
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	go b.Run(ctxB, lead)
+
+	time.Sleep(400 * time.Millisecond) // past the ttl: a keeps renewing
+	if !a.Leading() || b.Leading() || leaders.Load() != 1 {
+		t.Fatalf("Expected only the first instance to lead, got a=%v b=%v leaders=%d", a.Leading(), b.Leading(), leaders.Load())
+	}
+
+	// Stepping down releases the key for b
+	stopA()
+	<-doneA
+	waitUntil(t, b.Leading)
+	if got, _ := mr.Get("test:leader"); got != b.ID() {
+		t.Errorf("Expected the key to hold b's ID, got %q", got)
+	}
+}
+
+func TestLeaderStopsWhenItLosesTheKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	e := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "test:leader", 300*time.Millisecond)
+
+	stopped := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	waitUntil(t, e.Leading)
+
+	mr.Set("test:leader", "someone-else")
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the leader to stop once the key was taken")
+	}
+	if e.Leading() {
+		t.Error("Expected the instance to no longer lead")
+	}
+}
+
+func TestNilElectorAlwaysLeads(t *testing.T) {
+	var e *Elector
+	if !e.Leading() {
+		t.Error("Expected a nil elector to lead")
+	}
+	ran := false
+	e.Run(context.Background(), func(ctx context.Context) { ran = true })
+	if !ran {
+		t.Error("Expected a nil elector to run lead straight away")
+	}
+}
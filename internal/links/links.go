@@ -0,0 +1,109 @@
+// Package links records typed relations between content items, so that
+// replies, thread messages and derived items are not unrelated rows: a
+// crosspost is derived from the post it copies, a chat reply answers the
+// message it quotes, a Slack thread reply belongs to the thread its first
+// message started, and a link post links to the article it shares. Links live in the content_links table and need
+// Postgres.
+package links
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type Relation string
+
+const (
+	// DerivedFrom links an item to the one it was made from.
+	DerivedFrom Relation = "derived_from"
+	// ReplyTo links a message to the message it answers.
+	ReplyTo Relation = "reply_to"
+	// SameThread links a message to the first message of its thread.
+	SameThread Relation = "same_thread"
+	// LinksTo links an item to a page it links to, fetched and stored as
+	// an article of its own.
+	LinksTo Relation = "links_to"
+)
+
+// MaxThread caps the messages Thread returns.
+const MaxThread = 500
+
+// ErrNotFound is returned by Thread for unknown items.
+var ErrNotFound = errors.New("content not found")
+
+// Add links the item id to the item stored from targetURL in the same
+// workspace. It does nothing when the target has not been stored, so
+// callers can link to items that may never have been collected, and
+// adding a link twice is harmless.
+func Add(ctx context.Context, db *sql.DB, workspace, id string, rel Relation, targetURL string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO content_links (workspace_id, source_id, target_id, relation)
+		SELECT $1, $2, id, $3 FROM content_metadata
+		WHERE workspace_id = $1 AND source_url = $4 AND id <> $2
+		ON CONFLICT DO NOTHING`, workspace, id, string(rel), targetURL)
+	return err
+}
+
+// Message is one item of a thread.
+type Message struct {
+	ID             string    `json:"id"`
+	SourceURL      string    `json:"source_url"`
+	Author         string    `json:"author"`
+	Timestamp      time.Time `json:"timestamp"`
+	SourcePlatform string    `json:"source_platform"`
+	ContentSummary string    `json:"content_summary"`
+	// ParentID is the message this one replies to, or else the first
+	// message of its thread; it is empty for the first message.
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// Thread reconstructs the conversation id belongs to: every item reachable
+// from it over reply_to and same_thread links, followed in either
+// direction, oldest first. An item without links is a thread of one.
+func Thread(ctx context.Context, db *sql.DB, workspace, id string) ([]Message, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH RECURSIVE edges AS (
+			SELECT source_id, target_id FROM content_links
+			WHERE workspace_id = $1 AND relation IN ('reply_to', 'same_thread')
+		), thread(id) AS (
+			SELECT id FROM content_metadata WHERE workspace_id = $1 AND id::text = $2
+			UNION
+			SELECT CASE WHEN e.source_id = t.id THEN e.target_id ELSE e.source_id END
+			FROM edges e JOIN thread t ON t.id IN (e.source_id, e.target_id)
+		)
+		SELECT c.id, c.source_url, COALESCE(c.author, ''), COALESCE(c.timestamp, c.created_at),
+			COALESCE(c.source_platform, ''), COALESCE(c.content_summary, ''),
+			COALESCE((
+				-- A direct reply beats thread membership as the parent
+				SELECT l.target_id::text FROM content_links l
+				WHERE l.source_id = c.id AND l.relation IN ('reply_to', 'same_thread')
+				ORDER BY l.relation = 'reply_to' DESC LIMIT 1
+			), '')
+		FROM content_metadata c JOIN thread USING (id)
+		ORDER BY COALESCE(c.timestamp, c.created_at), c.id
+		LIMIT $3`, workspace, strings.ToLower(id), MaxThread)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var thread []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.SourceURL, &m.Author, &m.Timestamp,
+			&m.SourcePlatform, &m.ContentSummary, &m.ParentID); err != nil {
+			return nil, err
+		}
+		thread = append(thread, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(thread) == 0 {
+		return nil, ErrNotFound
+	}
+	return thread, nil
+}
@@ -0,0 +1,79 @@
+//go:build integration
+
+package links
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"selin/internal/storage"
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration ./links (needs a Docker daemon)
+
+func TestThreadAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+	store := storage.NewPostgres(db)
+	start := time.Now().Add(-time.Hour)
+
+	ids := map[string]string{}
+	for i, name := range []string{"root", "reply", "answer", "crosspost", "other"} {
+		id, _, err := store.SaveContent(ctx, storage.Content{
+			Workspace: "default",
+			SourceURL: "slack://general/" + name,
+			Summary:   name,
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = id
+	}
+	for _, l := range []struct {
+		from   string
+		rel    Relation
+		target string
+	}{
+		{"reply", SameThread, "root"},
+		{"answer", ReplyTo, "reply"},
+		{"answer", SameThread, "root"},
+		{"crosspost", DerivedFrom, "root"},
+		// Not collected: ignored
+		{"other", ReplyTo, "missing"},
+	} {
+		if err := Add(ctx, db, "default", ids[l.from], l.rel, "slack://general/"+l.target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Adding a link again is harmless
+	if err := Add(ctx, db, "default", ids["reply"], SameThread, "slack://general/root"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, from := range []string{"root", "reply", "answer"} {
+		thread, err := Thread(ctx, db, "default", ids[from])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range thread {
+			got = append(got, m.ContentSummary)
+		}
+		if len(got) != 3 || got[0] != "root" || got[1] != "reply" || got[2] != "answer" {
+			t.Errorf("From %s: expected root, reply, answer; got %v", from, got)
+		}
+		if thread[2].ParentID != ids["reply"] || thread[1].ParentID != ids["root"] || thread[0].ParentID != "" {
+			t.Errorf("From %s: unexpected parents %+v", from, thread)
+		}
+	}
+
+	if thread, err := Thread(ctx, db, "default", ids["other"]); err != nil || len(thread) != 1 {
+		t.Errorf("Expected an unlinked item to be a thread of one, got %v, %v", thread, err)
+	}
+	if _, err := Thread(ctx, db, "other-workspace", ids["root"]); err != ErrNotFound {
+		t.Errorf("Expected another workspace not to see the thread, got %v", err)
+	}
+}
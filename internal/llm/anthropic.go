@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// anthropicVersion is the Messages API version requests are made against.
+const anthropicVersion = "2023-06-01"
+
+// Anthropic speaks Anthropic's Messages API. It has no embeddings.
+type Anthropic struct {
+	// URL is the messages endpoint
+	URL       string
+	APIKey    string
+	ChatModel string // claude-3-5-haiku-latest by default
+	HTTP      *http.Client
+}
+
+func (a *Anthropic) Name() string { return "anthropic" }
+
+func (a *Anthropic) Model() string {
+	if a.ChatModel == "" {
+		return "claude-3-5-haiku-latest"
+	}
+	return a.ChatModel
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (a *Anthropic) Chat(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	// The API requires a cap on the reply
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+	body := map[string]interface{}{
+		"model":      a.Model(),
+		"messages":   req.Messages,
+		"max_tokens": maxTokens,
+	}
+	if req.System != "" {
+		body["system"] = req.System
+	}
+	if onDelta != nil {
+		body["stream"] = true
+	}
+	header := http.Header{"Anthropic-Version": {anthropicVersion}}
+	if a.APIKey != "" {
+		header.Set("X-Api-Key", a.APIKey)
+	}
+
+	resp, err := postJSON(ctx, a.HTTP, a.Name(), a.URL, header, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if onDelta == nil {
+		var message struct {
+			Model   string `json:"model"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			Usage anthropicUsage `json:"usage"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+			return nil, fmt.Errorf("invalid response from anthropic: %w", err)
+		}
+		var text strings.Builder
+		for _, block := range message.Content {
+			if block.Type == "text" {
+				text.WriteString(block.Text)
+			}
+		}
+		return &Response{
+			Text:  strings.TrimSpace(text.String()),
+			Model: message.Model,
+			Usage: Usage(message.Usage),
+		}, nil
+	}
+
+	out := &Response{}
+	var text strings.Builder
+	err = readEvents(resp.Body, func(data []byte) error {
+		var event struct {
+			Type    string `json:"type"`
+			Message struct {
+				Model string         `json:"model"`
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage anthropicUsage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("invalid stream event from anthropic: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			out.Model = event.Message.Model
+			out.Usage.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				text.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			}
+		case "message_delta":
+			out.Usage.OutputTokens = event.Usage.OutputTokens
+		case "message_stop":
+			return io.EOF
+		case "error":
+			return fmt.Errorf("anthropic stream failed: %s", event.Error.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Text = strings.TrimSpace(text.String())
+	return out, nil
+}
+
+func (a *Anthropic) EmbeddingModel() string { return "" }
+
+func (a *Anthropic) Embed(context.Context, []string) ([][]float32, string, Usage, error) {
+	return nil, "", Usage{}, fmt.Errorf("anthropic embeddings: %w", ErrUnsupported)
+}
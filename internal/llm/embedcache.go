@@ -0,0 +1,233 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"selin/internal/logging"
+)
+
+var embedCacheTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "llm_embedding_cache_total",
+		Help: "Texts looked up in the embedding cache, by model and result (hit, miss)",
+	},
+	[]string{"model", "result"},
+)
+
+// EmbedCache keeps embeddings by model and EmbedKey.
+type EmbedCache interface {
+	// Get returns the vectors it holds for keys, by key.
+	Get(ctx context.Context, model string, keys []string) (map[string][]float32, error)
+	// Put stores vectors by key.
+	Put(ctx context.Context, model string, vectors map[string][]float32) error
+}
+
+// EmbedKey is the cache key of text: the SHA-256 of it with runs of
+// whitespace collapsed and the ends trimmed, which change nothing a model
+// would notice.
+func EmbedKey(text string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedEmbed embeds the texts c.Cache does not hold and stores them. A
+// cache that fails is passed by: the texts are embedded as if it missed.
+func (c *Client) cachedEmbed(ctx context.Context, feature string, texts []string) ([][]float32, error) {
+	model := c.provider.EmbeddingModel()
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = EmbedKey(text)
+	}
+	cached, err := c.Cache.Get(ctx, model, keys)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to read embedding cache", "model", model, "error", err)
+		cached = nil
+	}
+
+	// Texts repeated in one call are only sent once
+	vectors := make([][]float32, len(texts))
+	var missing []string
+	missingKeys := make(map[string]int)
+	for i, key := range keys {
+		if v, ok := cached[key]; ok {
+			vectors[i] = v
+			continue
+		}
+		if _, ok := missingKeys[key]; !ok {
+			missingKeys[key] = len(missing)
+			missing = append(missing, texts[i])
+		}
+	}
+	embedCacheTotal.WithLabelValues(model, "hit").Add(float64(len(texts) - len(missing)))
+	embedCacheTotal.WithLabelValues(model, "miss").Add(float64(len(missing)))
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	fresh, err := c.embed(ctx, feature, missing)
+	if err != nil {
+		return nil, err
+	}
+	store := make(map[string][]float32, len(missing))
+	for i, key := range keys {
+		if vectors[i] == nil {
+			vectors[i] = fresh[missingKeys[key]]
+			store[key] = vectors[i]
+		}
+	}
+	if err := c.Cache.Put(ctx, model, store); err != nil {
+		logging.FromContext(ctx).Warn("failed to write embedding cache", "model", model, "error", err)
+	}
+	return vectors, nil
+}
+
+// SQLEmbedCache keeps embeddings in the embedding_cache table.
+type SQLEmbedCache struct {
+	db *sql.DB
+}
+
+// NewSQLEmbedCache returns a cache in db.
+func NewSQLEmbedCache(db *sql.DB) *SQLEmbedCache {
+	return &SQLEmbedCache{db: db}
+}
+
+// Get returns the cached vectors for keys and marks them used.
+func (c *SQLEmbedCache) Get(ctx context.Context, model string, keys []string) (map[string][]float32, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	rows, err := c.db.QueryContext(ctx, `
+		UPDATE embedding_cache SET used_at = now()
+		WHERE model = $1 AND text_hash = ANY(string_to_array($2, ','))
+		RETURNING text_hash, vector`, model, strings.Join(keys, ","))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding cache: %w", err)
+	}
+	defer rows.Close()
+
+	vectors := make(map[string][]float32)
+	for rows.Next() {
+		var key string
+		var raw []byte
+		if err := rows.Scan(&key, &raw); err != nil {
+			return nil, err
+		}
+		if v, ok := decodeVector(raw); ok {
+			vectors[key] = v
+		}
+	}
+	return vectors, rows.Err()
+}
+
+// Put stores vectors, replacing what the cache held for their keys.
+func (c *SQLEmbedCache) Put(ctx context.Context, model string, vectors map[string][]float32) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+	// In key order, so concurrent writers lock rows in the same order
+	keys := make([]string, 0, len(vectors))
+	for key := range vectors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var query strings.Builder
+	query.WriteString(`INSERT INTO embedding_cache (model, text_hash, dimensions, vector) VALUES `)
+	args := []interface{}{model}
+	for i, key := range keys {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($1, $%d, $%d, $%d)", n+1, n+2, n+3)
+		args = append(args, key, len(vectors[key]), encodeVector(vectors[key]))
+	}
+	query.WriteString(` ON CONFLICT (model, text_hash) DO UPDATE
+		SET dimensions = EXCLUDED.dimensions, vector = EXCLUDED.vector, used_at = now()`)
+	if _, err := c.db.ExecContext(ctx, query.String(), args...); err != nil {
+		return fmt.Errorf("failed to write embedding cache: %w", err)
+	}
+	return nil
+}
+
+// EmbedCacheStats describes the cached embeddings of one model.
+type EmbedCacheStats struct {
+	Model      string    `json:"model"`
+	Entries    int64     `json:"entries"`
+	Bytes      int64     `json:"bytes"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Stats returns what the cache holds per model.
+func (c *SQLEmbedCache) Stats(ctx context.Context) ([]EmbedCacheStats, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT model, COUNT(*), COALESCE(SUM(octet_length(vector)), 0), MAX(used_at)
+		FROM embedding_cache GROUP BY model ORDER BY model`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding cache stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []EmbedCacheStats{}
+	for rows.Next() {
+		var s EmbedCacheStats
+		if err := rows.Scan(&s.Model, &s.Entries, &s.Bytes, &s.LastUsedAt); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// PurgeFilter selects the entries Purge removes. Empty fields match
+// everything.
+type PurgeFilter struct {
+	Model string
+	// UnusedFor keeps entries used more recently than this
+	UnusedFor time.Duration
+}
+
+// Purge removes the entries matching f and returns how many it removed.
+func (c *SQLEmbedCache) Purge(ctx context.Context, f PurgeFilter) (int64, error) {
+	var before interface{}
+	if f.UnusedFor > 0 {
+		before = time.Now().Add(-f.UnusedFor)
+	}
+	res, err := c.db.ExecContext(ctx, `
+		DELETE FROM embedding_cache
+		WHERE ($1 = '' OR model = $1) AND ($2::timestamptz IS NULL OR used_at < $2)`, f.Model, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge embedding cache: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func decodeVector(b []byte) ([]float32, bool) {
+	if len(b) == 0 || len(b)%4 != 0 {
+		return nil, false
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v, true
+}
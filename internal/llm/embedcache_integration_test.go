@@ -0,0 +1,49 @@
+//go:build integration
+
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"selin/internal/testenv"
+)
+
+func TestSQLEmbedCacheAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+	cache := NewSQLEmbedCache(db)
+
+	err := cache.Put(ctx, "nomic-embed-text", map[string][]float32{EmbedKey("go"): {1, 0}, EmbedKey("rust"): {0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(ctx, "text-embedding-3-small", map[string][]float32{EmbedKey("go"): {0.5, 0.5}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cache.Get(ctx, "nomic-embed-text", []string{EmbedKey("go"), EmbedKey("zig")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[EmbedKey("go")][0] != 1 {
+		t.Errorf("Expected only go cached for the model, got %v", got)
+	}
+
+	stats, err := cache.Stats(ctx)
+	if err != nil || len(stats) != 2 || stats[0].Model != "nomic-embed-text" || stats[0].Entries != 2 || stats[0].Bytes != 16 {
+		t.Errorf("Unexpected stats %+v, %v", stats, err)
+	}
+
+	// Nothing is old enough yet; then drop one model's entries
+	if n, err := cache.Purge(ctx, PurgeFilter{UnusedFor: time.Hour}); err != nil || n != 0 {
+		t.Errorf("Expected recent entries kept, purged %d, %v", n, err)
+	}
+	if n, err := cache.Purge(ctx, PurgeFilter{Model: "text-embedding-3-small"}); err != nil || n != 1 {
+		t.Errorf("Expected one entry purged, purged %d, %v", n, err)
+	}
+	if n, err := cache.Purge(ctx, PurgeFilter{}); err != nil || n != 2 {
+		t.Errorf("Expected the rest purged, purged %d, %v", n, err)
+	}
+}
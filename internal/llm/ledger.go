@@ -0,0 +1,213 @@
+package llm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Account is who a call is made for.
+type Account struct {
+	Workspace string
+	UserID    string
+	Feature   string
+}
+
+// Entry is one call in the usage ledger.
+type Entry struct {
+	Workspace    string    `json:"workspace_id"`
+	UserID       string    `json:"user_id"`
+	Feature      string    `json:"feature"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         float64   `json:"cost"`
+	RequestID    string    `json:"request_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Ledger keeps what calls cost and the budgets they are held to. A Client
+// with a Ledger asks it before every call and records every call made.
+type Ledger interface {
+	// Allow returns a *BudgetError when account's budget is spent. Other
+	// errors do not block the call.
+	Allow(ctx context.Context, account Account) error
+	Record(ctx context.Context, entry Entry) error
+}
+
+// ErrBudgetExceeded matches every *BudgetError.
+var ErrBudgetExceeded = errors.New("LLM budget exceeded")
+
+// BudgetError is returned for calls over a daily budget.
+type BudgetError struct {
+	Scope string  `json:"scope"` // "user" or "feature"
+	Name  string  `json:"name"`
+	Limit float64 `json:"limit"`
+	Spent float64 `json:"spent"`
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("daily LLM budget of $%.2f for %s %s exceeded ($%.2f spent)", e.Limit, e.Scope, e.Name, e.Spent)
+}
+
+func (e *BudgetError) Is(target error) bool { return target == ErrBudgetExceeded }
+
+// Budgets caps what calls may cost per UTC day, in US dollars; 0 is no cap.
+type Budgets struct {
+	// User caps each user of a workspace, across features
+	User float64 `json:"user_daily,omitempty"`
+	// Features caps each feature, across users and workspaces
+	Features map[string]float64 `json:"features_daily,omitempty"`
+}
+
+// BudgetsFromEnv reads LLM_BUDGET_USER_DAILY ("1.50") and
+// LLM_BUDGET_FEATURES_DAILY ("query=5,quiz=0.5").
+func BudgetsFromEnv() (Budgets, error) {
+	var b Budgets
+	if v := os.Getenv("LLM_BUDGET_USER_DAILY"); v != "" {
+		limit, err := strconv.ParseFloat(v, 64)
+		if err != nil || limit < 0 {
+			return b, fmt.Errorf("invalid LLM_BUDGET_USER_DAILY %q", v)
+		}
+		b.User = limit
+	}
+	for _, pair := range strings.Split(os.Getenv("LLM_BUDGET_FEATURES_DAILY"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		feature, v, ok := strings.Cut(pair, "=")
+		limit, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !ok || err != nil || limit < 0 || strings.TrimSpace(feature) == "" {
+			return b, fmt.Errorf("invalid LLM_BUDGET_FEATURES_DAILY entry %q: use feature=dollars", pair)
+		}
+		if b.Features == nil {
+			b.Features = make(map[string]float64)
+		}
+		b.Features[strings.TrimSpace(feature)] = limit
+	}
+	return b, nil
+}
+
+// SQLLedger keeps the ledger in the usage_ledger table and enforces
+// Budgets from it.
+type SQLLedger struct {
+	db      *sql.DB
+	budgets Budgets
+	now     func() time.Time
+}
+
+// NewSQLLedger returns a ledger in db holding calls to budgets.
+func NewSQLLedger(db *sql.DB, budgets Budgets) *SQLLedger {
+	return &SQLLedger{db: db, budgets: budgets, now: time.Now}
+}
+
+// Budgets returns the budgets the ledger enforces.
+func (l *SQLLedger) Budgets() Budgets {
+	return l.budgets
+}
+
+func (l *SQLLedger) today() time.Time {
+	return l.now().UTC().Truncate(24 * time.Hour)
+}
+
+// Allow checks the user's and the feature's spending today.
+func (l *SQLLedger) Allow(ctx context.Context, account Account) error {
+	since := l.today()
+	if l.budgets.User > 0 && account.UserID != "" {
+		var spent float64
+		err := l.db.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(cost_usd), 0) FROM usage_ledger
+			WHERE workspace_id = $1 AND user_id = $2 AND created_at >= $3`,
+			account.Workspace, account.UserID, since).Scan(&spent)
+		if err != nil {
+			return fmt.Errorf("failed to check user budget: %w", err)
+		}
+		if spent >= l.budgets.User {
+			return &BudgetError{Scope: "user", Name: account.UserID, Limit: l.budgets.User, Spent: spent}
+		}
+	}
+	if limit := l.budgets.Features[account.Feature]; limit > 0 {
+		var spent float64
+		err := l.db.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(cost_usd), 0) FROM usage_ledger
+			WHERE feature = $1 AND created_at >= $2`, account.Feature, since).Scan(&spent)
+		if err != nil {
+			return fmt.Errorf("failed to check feature budget: %w", err)
+		}
+		if spent >= limit {
+			return &BudgetError{Scope: "feature", Name: account.Feature, Limit: limit, Spent: spent}
+		}
+	}
+	return nil
+}
+
+// Record adds entry to the ledger.
+func (l *SQLLedger) Record(ctx context.Context, e Entry) error {
+	if e.Workspace == "" {
+		e.Workspace = "default"
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = l.now()
+	}
+	_, err := l.db.ExecContext(ctx, `
+		INSERT INTO usage_ledger (workspace_id, user_id, feature, provider, model, input_tokens, output_tokens, cost_usd, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)`,
+		e.Workspace, e.UserID, e.Feature, e.Provider, e.Model, e.InputTokens, e.OutputTokens, e.Cost, e.RequestID, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record LLM usage: %w", err)
+	}
+	return nil
+}
+
+// UsageFilter selects the ledger entries a report covers. Empty fields
+// match everything.
+type UsageFilter struct {
+	Workspace string
+	UserID    string
+	Feature   string
+	Since     time.Time
+}
+
+// UsageRow is what one user spent on one feature on one UTC day.
+type UsageRow struct {
+	Day          string  `json:"day"`
+	UserID       string  `json:"user_id"`
+	Feature      string  `json:"feature"`
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// Usage aggregates the entries matching f per day, user and feature, the
+// latest day first.
+func (l *SQLLedger) Usage(ctx context.Context, f UsageFilter) ([]UsageRow, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT to_char(date_trunc('day', created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD'), user_id, feature,
+		       COUNT(*), SUM(input_tokens), SUM(output_tokens), SUM(cost_usd)
+		FROM usage_ledger
+		WHERE ($1 = '' OR workspace_id = $1) AND ($2 = '' OR user_id = $2) AND ($3 = '' OR feature = $3)
+		  AND created_at >= $4
+		GROUP BY 1, 2, 3
+		ORDER BY 1 DESC, 7 DESC`, f.Workspace, f.UserID, f.Feature, f.Since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load LLM usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []UsageRow{}
+	for rows.Next() {
+		var u UsageRow
+		if err := rows.Scan(&u.Day, &u.UserID, &u.Feature, &u.Calls, &u.InputTokens, &u.OutputTokens, &u.Cost); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
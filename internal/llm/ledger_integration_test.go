@@ -0,0 +1,62 @@
+//go:build integration
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration ./llm (needs a Docker daemon)
+
+func TestSQLLedgerAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+	ledger := NewSQLLedger(db, Budgets{User: 1, Features: map[string]float64{"quiz": 0.5}})
+	now := time.Date(2026, 3, 4, 15, 0, 0, 0, time.UTC)
+	ledger.now = func() time.Time { return now }
+
+	record := func(user, feature string, cost float64, at time.Time) {
+		t.Helper()
+		err := ledger.Record(ctx, Entry{Workspace: "team-a", UserID: user, Feature: feature, Provider: "openai",
+			Model: "gpt-4o-mini", InputTokens: 100, OutputTokens: 10, Cost: cost, CreatedAt: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Yesterday's spending does not count against today's budget
+	record("alice", "query", 5, now.Add(-24*time.Hour))
+	record("alice", "query", 0.6, now.Add(-time.Hour))
+	record("bob", "quiz", 0.3, now.Add(-time.Hour))
+
+	if err := ledger.Allow(ctx, Account{Workspace: "team-a", UserID: "alice", Feature: "query"}); err != nil {
+		t.Errorf("Expected alice under budget, got %v", err)
+	}
+	record("alice", "query", 0.4, now)
+	var budget *BudgetError
+	err := ledger.Allow(ctx, Account{Workspace: "team-a", UserID: "alice", Feature: "query"})
+	if !errors.As(err, &budget) || budget.Scope != "user" || budget.Spent != 1 {
+		t.Errorf("Expected alice's budget spent, got %v", err)
+	}
+	// The same user ID in another workspace is someone else
+	if err := ledger.Allow(ctx, Account{Workspace: "team-b", UserID: "alice", Feature: "query"}); err != nil {
+		t.Errorf("Expected alice of team-b under budget, got %v", err)
+	}
+
+	record("carol", "quiz", 0.2, now)
+	if err := ledger.Allow(ctx, Account{Workspace: "team-b", UserID: "dave", Feature: "quiz"}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected the quiz budget spent for everyone, got %v", err)
+	}
+
+	usage, err := ledger.Usage(ctx, UsageFilter{Workspace: "team-a", UserID: "alice", Since: now.Add(-48 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 2 || usage[0].Day != "2026-03-04" || usage[0].Calls != 2 || usage[0].Cost != 1 || usage[0].InputTokens != 200 {
+		t.Errorf("Expected alice's usage per day, latest first, got %+v", usage)
+	}
+}
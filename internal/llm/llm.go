@@ -0,0 +1,445 @@
+// Package llm talks to the language models Selin's features use for
+// generation and embeddings: quiz questions, answers to queries, and
+// anything else that needs a model.
+//
+// A Provider speaks one vendor's API (OpenAI and compatible endpoints,
+// Anthropic, Ollama). Client wraps the configured one with the policy every
+// feature shares: transient failures are retried with backoff, and each
+// call's latency, tokens and estimated cost are recorded as metrics labelled
+// with the feature that made it. With a Ledger, calls are also recorded per
+// user and feature, and refused once a daily budget is spent. With an
+// EmbedCache, text already embedded by the same model is not sent again.
+// FromEnv picks the provider from LLM_PROVIDER.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"selin/internal/config"
+	"selin/internal/logging"
+)
+
+// Message roles.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a chat completion request.
+type Request struct {
+	// Feature names the caller in metrics and the ledger, such as "quiz"
+	// or "query"
+	Feature string
+	// Workspace and UserID are who the call is made for, in the ledger
+	Workspace string
+	UserID    string
+
+	System   string
+	Messages []Message
+	// MaxTokens caps the reply, 0 for the provider's default
+	MaxTokens int
+}
+
+// Usage counts the tokens a call consumed.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Response is a completed chat.
+type Response struct {
+	Text  string `json:"text"`
+	Model string `json:"model"`
+	Usage Usage  `json:"usage"`
+	// Cost is the estimated cost of the call in US dollars
+	Cost float64 `json:"cost"`
+}
+
+// Provider is one vendor's API.
+type Provider interface {
+	// Name identifies the provider in metrics: "openai", "anthropic", "ollama"
+	Name() string
+	// Model is the chat model requests are sent to.
+	Model() string
+	// Chat completes req. When onDelta is not nil the reply is streamed,
+	// each piece of text handed to it as it arrives.
+	Chat(ctx context.Context, req Request, onDelta func(string)) (*Response, error)
+	// EmbeddingModel is the model Embed uses, "" for providers without
+	// embeddings.
+	EmbeddingModel() string
+	// Embed returns a vector per text, in order, and the model that made
+	// them. Providers without embeddings return ErrUnsupported.
+	Embed(ctx context.Context, texts []string) ([][]float32, string, Usage, error)
+}
+
+// ErrUnsupported is returned for operations a provider does not offer.
+var ErrUnsupported = errors.New("not supported by this provider")
+
+// StatusError is returned when a provider answers with an error status.
+type StatusError struct {
+	Provider string
+	Status   int
+	Message  string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s returned status %d", e.Provider, e.Status)
+	}
+	return fmt.Sprintf("%s returned status %d: %s", e.Provider, e.Status, e.Message)
+}
+
+// Shared policy.
+const (
+	// DefaultTimeout bounds one call to the provider, a streamed reply
+	// included.
+	DefaultTimeout = 120 * time.Second
+	// DefaultRetries is how many times a failed call is retried.
+	DefaultRetries = 2
+	// RetryBackoff is the wait before the first retry, doubled after.
+	RetryBackoff = 500 * time.Millisecond
+)
+
+// Metrics
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_requests_total",
+			Help: "LLM calls by provider, operation (chat, embed), feature and status (ok, error, over_budget)",
+		},
+		[]string{"provider", "operation", "feature", "status"},
+	)
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "llm_request_duration_seconds",
+			Help:    "How long LLM calls took, retries included",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2.5, 10),
+		},
+		[]string{"provider", "operation"},
+	)
+	tokensTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_tokens_total",
+			Help: "Tokens consumed by LLM calls, by direction (input, output)",
+		},
+		[]string{"provider", "model", "feature", "direction"},
+	)
+	costTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_cost_dollars_total",
+			Help: "Estimated cost of LLM calls in US dollars",
+		},
+		[]string{"provider", "model", "feature"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, tokensTotal, costTotal, embedCacheTotal)
+}
+
+// Client calls a provider with the shared policy. A nil *Client, returned
+// by FromEnv when no provider is configured, fails every call with
+// ErrNotConfigured.
+type Client struct {
+	// Ledger, when set before the client is used, records each call and
+	// enforces budgets
+	Ledger Ledger
+	// Cache, when set before the client is used, keeps embeddings so
+	// unchanged text is not embedded again
+	Cache EmbedCache
+
+	provider Provider
+	prices   Prices
+	retries  int
+	backoff  time.Duration
+}
+
+// ErrNotConfigured is returned by a nil *Client.
+var ErrNotConfigured = errors.New("no LLM provider configured")
+
+// New returns a client for p, pricing calls with DefaultPrices.
+func New(p Provider) *Client {
+	return &Client{provider: p, prices: DefaultPrices, retries: DefaultRetries, backoff: RetryBackoff}
+}
+
+// Provider is the name of the client's provider, "" for a nil client.
+func (c *Client) Provider() string {
+	if c == nil {
+		return ""
+	}
+	return c.provider.Name()
+}
+
+// Model is the chat model, "" for a nil client.
+func (c *Client) Model() string {
+	if c == nil {
+		return ""
+	}
+	return c.provider.Model()
+}
+
+// Chat completes req.
+func (c *Client) Chat(ctx context.Context, req Request) (*Response, error) {
+	return c.Stream(ctx, req, nil)
+}
+
+// Stream completes req, handing each piece of the reply to onDelta as it
+// arrives. A call is only retried while nothing has been handed over.
+func (c *Client) Stream(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	if c == nil {
+		return nil, ErrNotConfigured
+	}
+	account := Account{Workspace: req.Workspace, UserID: req.UserID, Feature: req.Feature}
+	if err := c.allow(ctx, "chat", account); err != nil {
+		return nil, err
+	}
+	var started bool
+	deliver := onDelta
+	if onDelta != nil {
+		deliver = func(s string) {
+			started = true
+			onDelta(s)
+		}
+	}
+
+	var resp *Response
+	err := c.do(ctx, "chat", req.Feature, func() bool { return !started }, func() (err error) {
+		resp, err = c.provider.Chat(ctx, req, deliver)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Model == "" {
+		resp.Model = c.provider.Model()
+	}
+	resp.Cost = c.prices.Cost(resp.Model, resp.Usage)
+	c.record(ctx, account, resp.Model, resp.Usage, resp.Cost)
+	return resp, nil
+}
+
+// Embed returns a vector per text, in order. With a Cache, only the texts
+// it does not hold for the provider's embedding model are sent.
+func (c *Client) Embed(ctx context.Context, feature string, texts []string) ([][]float32, error) {
+	if c == nil {
+		return nil, ErrNotConfigured
+	}
+	if c.Cache != nil && c.provider.EmbeddingModel() != "" {
+		return c.cachedEmbed(ctx, feature, texts)
+	}
+	return c.embed(ctx, feature, texts)
+}
+
+func (c *Client) embed(ctx context.Context, feature string, texts []string) ([][]float32, error) {
+	account := Account{Feature: feature}
+	if err := c.allow(ctx, "embed", account); err != nil {
+		return nil, err
+	}
+	var vectors [][]float32
+	var model string
+	var usage Usage
+	err := c.do(ctx, "embed", feature, func() bool { return true }, func() (err error) {
+		vectors, model, usage, err = c.provider.Embed(ctx, texts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", c.provider.Name(), len(vectors), len(texts))
+	}
+	c.record(ctx, account, model, usage, c.prices.Cost(model, usage))
+	return vectors, nil
+}
+
+// do runs call, retrying it while retry allows and the failure is likely
+// to pass, and records its outcome.
+func (c *Client) do(ctx context.Context, operation, feature string, retry func() bool, call func() error) error {
+	start := time.Now()
+	backoff := c.backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = call(); err == nil || attempt == c.retries || !retryable(err) || !retry() || ctx.Err() != nil {
+			break
+		}
+		logging.FromContext(ctx).Warn("llm call failed, retrying", "provider", c.provider.Name(), "attempt", attempt+1, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	requestsTotal.WithLabelValues(c.provider.Name(), operation, feature, status).Inc()
+	requestDuration.WithLabelValues(c.provider.Name(), operation).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// allow asks the ledger whether account may make a call. Only a spent
+// budget stops it: a ledger that cannot answer is no reason to fail.
+func (c *Client) allow(ctx context.Context, operation string, account Account) error {
+	if c.Ledger == nil {
+		return nil
+	}
+	err := c.Ledger.Allow(ctx, account)
+	if errors.Is(err, ErrBudgetExceeded) {
+		requestsTotal.WithLabelValues(c.provider.Name(), operation, account.Feature, "over_budget").Inc()
+		return err
+	}
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to check llm budget", "feature", account.Feature, "error", err)
+	}
+	return nil
+}
+
+func (c *Client) record(ctx context.Context, account Account, model string, usage Usage, cost float64) {
+	name := c.provider.Name()
+	tokensTotal.WithLabelValues(name, model, account.Feature, "input").Add(float64(usage.InputTokens))
+	tokensTotal.WithLabelValues(name, model, account.Feature, "output").Add(float64(usage.OutputTokens))
+	costTotal.WithLabelValues(name, model, account.Feature).Add(cost)
+	if c.Ledger == nil {
+		return
+	}
+
+	// Recorded even when the caller has gone, since the call was paid for
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	err := c.Ledger.Record(ctx, Entry{
+		Workspace:    account.Workspace,
+		UserID:       account.UserID,
+		Feature:      account.Feature,
+		Provider:     name,
+		Model:        model,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		Cost:         cost,
+		RequestID:    logging.RequestID(ctx),
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to record llm usage", "feature", account.Feature, "error", err)
+	}
+}
+
+// retryable reports whether a failure is likely to pass: the provider could
+// not be reached, is rate limiting, or is overloaded.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrUnsupported) {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Status == http.StatusTooManyRequests || status.Status >= 500
+	}
+	// Transport errors
+	return true
+}
+
+// FromEnv returns a client for the provider named by LLM_PROVIDER, or nil
+// when none is configured:
+//
+//	openai     LLM_API_URL, the chat completions endpoint (OpenAI's by
+//	           default, any compatible one otherwise), with OPENAI_API_KEY
+//	anthropic  LLM_API_URL, the messages endpoint (Anthropic's by default),
+//	           with ANTHROPIC_API_KEY
+//	ollama     OLLAMA_URL, the server (http://localhost:11434 by default)
+//
+// Without LLM_PROVIDER, a set LLM_API_URL selects openai. LLM_MODEL and
+// LLM_EMBED_MODEL override each provider's default models, LLM_TIMEOUT and
+// LLM_RETRIES the shared policy, and LLM_PRICE_INPUT and LLM_PRICE_OUTPUT
+// (dollars per million tokens) the chat model's price.
+func FromEnv() (*Client, error) {
+	timeout := DefaultTimeout
+	if v, err := time.ParseDuration(os.Getenv("LLM_TIMEOUT")); err == nil && v > 0 {
+		timeout = v
+	}
+	httpClient := &http.Client{Timeout: timeout}
+	model, embedModel := os.Getenv("LLM_MODEL"), os.Getenv("LLM_EMBED_MODEL")
+
+	var p Provider
+	switch name := os.Getenv("LLM_PROVIDER"); name {
+	case "":
+		if os.Getenv("LLM_API_URL") == "" {
+			return nil, nil
+		}
+		fallthrough
+	case "openai":
+		p = &OpenAI{
+			URL:        config.Env("LLM_API_URL", "https://api.openai.com/v1/chat/completions"),
+			EmbedURL:   os.Getenv("LLM_EMBED_URL"),
+			APIKey:     config.Secret("OPENAI_API_KEY"),
+			ChatModel:  model,
+			EmbedModel: embedModel,
+			HTTP:       httpClient,
+		}
+	case "anthropic":
+		key := config.Secret("ANTHROPIC_API_KEY")
+		if key == "" {
+			key = config.Secret("CLAUDE_API_KEY")
+		}
+		p = &Anthropic{
+			URL:       config.Env("LLM_API_URL", "https://api.anthropic.com/v1/messages"),
+			APIKey:    key,
+			ChatModel: model,
+			HTTP:      httpClient,
+		}
+	case "ollama":
+		p = &Ollama{
+			URL:        config.Env("OLLAMA_URL", "http://localhost:11434"),
+			ChatModel:  model,
+			EmbedModel: embedModel,
+			HTTP:       httpClient,
+		}
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q: use openai, anthropic or ollama", name)
+	}
+
+	c := New(p)
+	if v, err := strconv.Atoi(os.Getenv("LLM_RETRIES")); err == nil && v >= 0 {
+		c.retries = v
+	}
+	input, inErr := strconv.ParseFloat(os.Getenv("LLM_PRICE_INPUT"), 64)
+	output, outErr := strconv.ParseFloat(os.Getenv("LLM_PRICE_OUTPUT"), 64)
+	if inErr == nil || outErr == nil {
+		c.prices = c.prices.With(p.Model(), Price{Input: input, Output: output})
+	}
+	return c, nil
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultClient *Client
+)
+
+// Default returns the process-wide client built by FromEnv on first use,
+// nil when no provider is configured. A misconfigured provider is fatal.
+func Default() *Client {
+	defaultOnce.Do(func() {
+		c, err := FromEnv()
+		if err != nil {
+			logging.Fatal("failed to configure the LLM provider", "error", err)
+		}
+		defaultClient = c
+	})
+	return defaultClient
+}
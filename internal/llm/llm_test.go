@@ -0,0 +1,348 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request decodes a provider request body.
+func request(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+	return body
+}
+
+func TestProvidersChat(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		reply   string
+		stream  string
+		newFunc func(url string) Provider
+	}{
+		{
+			name:   "openai",
+			path:   "/v1/chat/completions",
+			reply:  `{"model":"gpt-4o-mini-2024-07-18","choices":[{"message":{"role":"assistant","content":"Hello there"}}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`,
+			stream: "data: {\"model\":\"gpt-4o-mini-2024-07-18\",\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\" there\"}}]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":3}}\n\ndata: [DONE]\n\n",
+			newFunc: func(url string) Provider {
+				return &OpenAI{URL: url + "/v1/chat/completions", APIKey: "sk-test", HTTP: http.DefaultClient}
+			},
+		},
+		{
+			name:   "anthropic",
+			path:   "/v1/messages",
+			reply:  `{"model":"claude-3-5-haiku-20241022","content":[{"type":"text","text":"Hello there"}],"usage":{"input_tokens":12,"output_tokens":3}}`,
+			stream: "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"claude-3-5-haiku-20241022\",\"usage\":{\"input_tokens\":12}}}\n\nevent: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\nevent: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\" there\"}}\n\nevent: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":3}}\n\nevent: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+			newFunc: func(url string) Provider {
+				return &Anthropic{URL: url + "/v1/messages", APIKey: "sk-ant-test", HTTP: http.DefaultClient}
+			},
+		},
+		{
+			name:   "ollama",
+			path:   "/api/chat",
+			reply:  `{"model":"llama3.1","message":{"role":"assistant","content":"Hello there"},"done":true,"prompt_eval_count":12,"eval_count":3}`,
+			stream: "{\"model\":\"llama3.1\",\"message\":{\"content\":\"Hello\"},\"done\":false}\n{\"model\":\"llama3.1\",\"message\":{\"content\":\" there\"},\"done\":false}\n{\"model\":\"llama3.1\",\"message\":{\"content\":\"\"},\"done\":true,\"prompt_eval_count\":12,\"eval_count\":3}\n",
+			newFunc: func(url string) Provider {
+				return &Ollama{URL: url, HTTP: http.DefaultClient}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("Expected a request to %s, got %s", tt.path, r.URL.Path)
+				}
+				body := request(t, r)
+				if !strings.Contains(fmt.Sprint(body), "Be brief") {
+					t.Errorf("Expected the system prompt sent, got %v", body)
+				}
+				if body["stream"] == true {
+					w.Write([]byte(tt.stream))
+					return
+				}
+				w.Write([]byte(tt.reply))
+			}))
+			defer srv.Close()
+
+			client := New(tt.newFunc(srv.URL))
+			req := Request{Feature: "test", System: "Be brief", Messages: []Message{{Role: RoleUser, Content: "Hi"}}}
+			resp, err := client.Chat(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Text != "Hello there" || resp.Usage != (Usage{InputTokens: 12, OutputTokens: 3}) {
+				t.Errorf("Unexpected response %+v", resp)
+			}
+
+			var deltas []string
+			streamed, err := client.Stream(context.Background(), req, func(s string) { deltas = append(deltas, s) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(deltas, "|") != "Hello| there" || streamed.Text != "Hello there" || streamed.Usage != resp.Usage || streamed.Model != resp.Model {
+				t.Errorf("Expected the same reply streamed, got %v and %+v", deltas, streamed)
+			}
+		})
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/embeddings":
+			// Out of order, as the API allows
+			w.Write([]byte(`{"model":"text-embedding-3-small","data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}],"usage":{"prompt_tokens":4}}`))
+		case "/api/embed":
+			w.Write([]byte(`{"model":"nomic-embed-text","embeddings":[[1,0],[0,1]],"prompt_eval_count":4}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, p := range []Provider{
+		&OpenAI{URL: srv.URL + "/v1/chat/completions", HTTP: http.DefaultClient},
+		&Ollama{URL: srv.URL, HTTP: http.DefaultClient},
+	} {
+		vectors, err := New(p).Embed(context.Background(), "test", []string{"a", "b"})
+		if err != nil {
+			t.Fatalf("%s: %v", p.Name(), err)
+		}
+		if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+			t.Errorf("%s: expected a vector per text in order, got %v", p.Name(), vectors)
+		}
+	}
+
+	_, err := New(&Anthropic{URL: srv.URL, HTTP: http.DefaultClient}).Embed(context.Background(), "test", []string{"a"})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected anthropic embeddings unsupported, got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch {
+		case r.Header.Get("Authorization") != "Bearer ok":
+			http.Error(w, `{"error":"invalid key"}`, http.StatusUnauthorized)
+		case calls < 3:
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"choices":[{"message":{"content":"done"}}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := New(&OpenAI{URL: srv.URL, APIKey: "ok", HTTP: http.DefaultClient})
+	client.backoff = 0
+	resp, err := client.Chat(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "Hi"}}})
+	if err != nil || resp.Text != "done" || calls != 3 {
+		t.Errorf("Expected success on the third call, got %+v, %v after %d calls", resp, err, calls)
+	}
+
+	calls = 0
+	client = New(&OpenAI{URL: srv.URL, APIKey: "wrong", HTTP: http.DefaultClient})
+	client.backoff = 0
+	_, err = client.Chat(context.Background(), Request{})
+	var status *StatusError
+	if !errors.As(err, &status) || status.Status != http.StatusUnauthorized || calls != 1 {
+		t.Errorf("Expected a 401 without retries, got %v after %d calls", err, calls)
+	}
+
+	var nilClient *Client
+	if _, err := nilClient.Chat(context.Background(), Request{}); err != ErrNotConfigured {
+		t.Errorf("Expected ErrNotConfigured from a nil client, got %v", err)
+	}
+}
+
+func TestPricesCost(t *testing.T) {
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000}
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"gpt-4o-mini-2024-07-18", 0.15 + 0.06},
+		{"gpt-4o", 2.50 + 1},
+		{"claude-3-5-haiku-20241022", 0.80 + 0.40},
+		{"llama3.1", 0},
+	}
+	for _, tt := range tests {
+		if got := DefaultPrices.Cost(tt.model, usage); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%s) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+	if got := DefaultPrices.With("llama3.1", Price{Input: 1}).Cost("llama3.1", usage); got != 1 {
+		t.Errorf("Expected the override to apply, got %v", got)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("LLM_API_URL", "")
+	if c, err := FromEnv(); c != nil || err != nil {
+		t.Errorf("Expected no client without configuration, got %v, %v", c, err)
+	}
+
+	t.Setenv("LLM_API_URL", "http://vllm:8000/v1/chat/completions")
+	t.Setenv("LLM_MODEL", "qwen2.5")
+	c, err := FromEnv()
+	if err != nil || c.Provider() != "openai" || c.Model() != "qwen2.5" {
+		t.Errorf("Expected LLM_API_URL to select an OpenAI-compatible provider, got %v, %v", c, err)
+	}
+
+	t.Setenv("LLM_PROVIDER", "ollama")
+	t.Setenv("LLM_MODEL", "")
+	if c, err := FromEnv(); err != nil || c.Provider() != "ollama" || c.Model() != "llama3.1" {
+		t.Errorf("Expected ollama with its default model, got %v, %v", c, err)
+	}
+
+	t.Setenv("LLM_PROVIDER", "bard")
+	if _, err := FromEnv(); err == nil {
+		t.Error("Expected an unknown provider rejected")
+	}
+}
+
+// fakeLedger holds every account to a budget of calls.
+type fakeLedger struct {
+	calls   int
+	entries []Entry
+}
+
+func (l *fakeLedger) Allow(_ context.Context, a Account) error {
+	if len(l.entries) >= l.calls {
+		return &BudgetError{Scope: "user", Name: a.UserID, Limit: 1, Spent: 1}
+	}
+	return nil
+}
+
+func (l *fakeLedger) Record(_ context.Context, e Entry) error {
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+func TestClientLedger(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"model":"gpt-4o-mini","choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":1000,"completion_tokens":100}}`))
+	}))
+	defer srv.Close()
+
+	ledger := &fakeLedger{calls: 1}
+	client := New(&OpenAI{URL: srv.URL, HTTP: http.DefaultClient})
+	client.Ledger = ledger
+	req := Request{Feature: "query", Workspace: "team-a", UserID: "alice"}
+
+	resp, err := client.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Entry{Workspace: "team-a", UserID: "alice", Feature: "query", Provider: "openai", Model: "gpt-4o-mini",
+		InputTokens: 1000, OutputTokens: 100, Cost: resp.Cost}
+	if len(ledger.entries) != 1 {
+		t.Fatalf("Expected the call recorded, got %+v", ledger.entries)
+	}
+	got := ledger.entries[0]
+	got.CreatedAt = time.Time{}
+	if got != want || resp.Cost <= 0 {
+		t.Errorf("Expected %+v recorded, got %+v", want, got)
+	}
+
+	_, err = client.Chat(context.Background(), req)
+	if !errors.Is(err, ErrBudgetExceeded) || calls != 1 {
+		t.Errorf("Expected the second call refused before reaching the provider, got %v after %d calls", err, calls)
+	}
+}
+
+func TestBudgetsFromEnv(t *testing.T) {
+	t.Setenv("LLM_BUDGET_USER_DAILY", "1.5")
+	t.Setenv("LLM_BUDGET_FEATURES_DAILY", "query=5, quiz=0.25")
+	b, err := BudgetsFromEnv()
+	if err != nil || b.User != 1.5 || b.Features["query"] != 5 || b.Features["quiz"] != 0.25 {
+		t.Errorf("Unexpected budgets %+v, %v", b, err)
+	}
+
+	t.Setenv("LLM_BUDGET_FEATURES_DAILY", "query")
+	if _, err := BudgetsFromEnv(); err == nil {
+		t.Error("Expected a feature without a limit rejected")
+	}
+}
+
+// mapCache is an EmbedCache in memory.
+type mapCache map[string][]float32
+
+func (m mapCache) Get(_ context.Context, model string, keys []string) (map[string][]float32, error) {
+	out := make(map[string][]float32)
+	for _, k := range keys {
+		if v, ok := m[model+"/"+k]; ok {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+func (m mapCache) Put(_ context.Context, model string, vectors map[string][]float32) error {
+	for k, v := range vectors {
+		m[model+"/"+k] = v
+	}
+	return nil
+}
+
+func TestEmbedCache(t *testing.T) {
+	var sent [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		sent = append(sent, req.Input)
+		vectors := make([][]float32, len(req.Input))
+		for i, text := range req.Input {
+			vectors[i] = []float32{float32(len(text))}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"model": "nomic-embed-text", "embeddings": vectors})
+	}))
+	defer srv.Close()
+
+	cache := mapCache{}
+	client := New(&Ollama{URL: srv.URL, HTTP: http.DefaultClient})
+	client.Cache = cache
+
+	vectors, err := client.Embed(context.Background(), "test", []string{"go", "rust", "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || len(sent[0]) != 2 || vectors[0][0] != 2 || vectors[1][0] != 4 || vectors[2][0] != 2 {
+		t.Fatalf("Expected repeated text sent once, sent %v and got %v", sent, vectors)
+	}
+
+	// Whitespace changes nothing; only new text is sent
+	vectors, err = client.Embed(context.Background(), "test", []string{" rust\n", "zig", "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || len(sent[1]) != 1 || sent[1][0] != "zig" || vectors[0][0] != 4 || vectors[1][0] != 3 || vectors[2][0] != 2 {
+		t.Errorf("Expected only zig embedded, sent %v and got %v", sent, vectors)
+	}
+	if _, ok := cache["nomic-embed-text/"+EmbedKey("zig")]; !ok {
+		t.Errorf("Expected entries keyed by model, got %v", cache)
+	}
+
+	if v, ok := decodeVector(encodeVector([]float32{1.5, -2, 0})); !ok || len(v) != 3 || v[0] != 1.5 || v[1] != -2 {
+		t.Errorf("Expected a vector to survive encoding, got %v", v)
+	}
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Ollama speaks the API of an Ollama server running models locally.
+type Ollama struct {
+	// URL is the server, such as http://localhost:11434
+	URL        string
+	ChatModel  string // llama3.1 by default
+	EmbedModel string // nomic-embed-text by default
+	HTTP       *http.Client
+}
+
+func (o *Ollama) Name() string { return "ollama" }
+
+func (o *Ollama) Model() string {
+	if o.ChatModel == "" {
+		return "llama3.1"
+	}
+	return o.ChatModel
+}
+
+// ollamaChat is a chat response, or one line of a streamed one.
+type ollamaChat struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+func (o *Ollama) Chat(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	messages := make([]Message, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, Message{Role: "system", Content: req.System})
+	}
+	body := map[string]interface{}{
+		"model":    o.Model(),
+		"messages": append(messages, req.Messages...),
+		"stream":   onDelta != nil,
+	}
+	if req.MaxTokens > 0 {
+		body["options"] = map[string]int{"num_predict": req.MaxTokens}
+	}
+
+	resp, err := postJSON(ctx, o.HTTP, o.Name(), strings.TrimSuffix(o.URL, "/")+"/api/chat", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if onDelta == nil {
+		var chat ollamaChat
+		if err := json.NewDecoder(resp.Body).Decode(&chat); err != nil {
+			return nil, fmt.Errorf("invalid response from ollama: %w", err)
+		}
+		return &Response{
+			Text:  strings.TrimSpace(chat.Message.Content),
+			Model: chat.Model,
+			Usage: Usage{InputTokens: chat.PromptEvalCount, OutputTokens: chat.EvalCount},
+		}, nil
+	}
+
+	// A stream is a JSON object per line, the last one marked done
+	out := &Response{}
+	var text strings.Builder
+	err = readLines(resp.Body, func(line []byte) error {
+		var chunk ollamaChat
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("invalid stream line from ollama: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("ollama stream failed: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			out.Model = chunk.Model
+			out.Usage = Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Text = strings.TrimSpace(text.String())
+	return out, nil
+}
+
+func (o *Ollama) EmbeddingModel() string {
+	if o.EmbedModel == "" {
+		return "nomic-embed-text"
+	}
+	return o.EmbedModel
+}
+
+func (o *Ollama) Embed(ctx context.Context, texts []string) ([][]float32, string, Usage, error) {
+	model := o.EmbeddingModel()
+	resp, err := postJSON(ctx, o.HTTP, o.Name(), strings.TrimSuffix(o.URL, "/")+"/api/embed", nil,
+		map[string]interface{}{"model": model, "input": texts})
+	if err != nil {
+		return nil, "", Usage{}, err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Model           string      `json:"model"`
+		Embeddings      [][]float32 `json:"embeddings"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, "", Usage{}, fmt.Errorf("invalid response from ollama: %w", err)
+	}
+	if out.Model == "" {
+		out.Model = model
+	}
+	return out.Embeddings, out.Model, Usage{InputTokens: out.PromptEvalCount}, nil
+}
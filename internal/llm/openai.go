@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAI speaks the chat completions and embeddings API of OpenAI and of
+// the servers compatible with it (vLLM, LiteLLM, LocalAI, ...).
+type OpenAI struct {
+	// URL is the chat completions endpoint
+	URL string
+	// EmbedURL is the embeddings endpoint, by default URL with
+	// /chat/completions replaced by /embeddings
+	EmbedURL   string
+	APIKey     string
+	ChatModel  string // gpt-4o-mini by default
+	EmbedModel string // text-embedding-3-small by default
+	HTTP       *http.Client
+}
+
+func (o *OpenAI) Name() string { return "openai" }
+
+func (o *OpenAI) Model() string {
+	if o.ChatModel == "" {
+		return "gpt-4o-mini"
+	}
+	return o.ChatModel
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (o *OpenAI) Chat(ctx context.Context, req Request, onDelta func(string)) (*Response, error) {
+	messages := make([]Message, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, Message{Role: "system", Content: req.System})
+	}
+	body := map[string]interface{}{
+		"model":    o.Model(),
+		"messages": append(messages, req.Messages...),
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if onDelta != nil {
+		body["stream"] = true
+		body["stream_options"] = map[string]bool{"include_usage": true}
+	}
+
+	resp, err := postJSON(ctx, o.HTTP, o.Name(), o.URL, o.header(), body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if onDelta == nil {
+		var completion struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Message Message `json:"message"`
+			} `json:"choices"`
+			Usage openAIUsage `json:"usage"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+			return nil, fmt.Errorf("invalid response from openai: %w", err)
+		}
+		if len(completion.Choices) == 0 {
+			return nil, fmt.Errorf("openai returned no choices")
+		}
+		return &Response{
+			Text:  strings.TrimSpace(completion.Choices[0].Message.Content),
+			Model: completion.Model,
+			Usage: Usage{InputTokens: completion.Usage.PromptTokens, OutputTokens: completion.Usage.CompletionTokens},
+		}, nil
+	}
+
+	out := &Response{}
+	var text strings.Builder
+	err = readEvents(resp.Body, func(data []byte) error {
+		if string(data) == "[DONE]" {
+			return io.EOF
+		}
+		var chunk struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta Message `json:"delta"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("invalid stream event from openai: %w", err)
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			out.Usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Text = strings.TrimSpace(text.String())
+	return out, nil
+}
+
+func (o *OpenAI) EmbeddingModel() string {
+	if o.EmbedModel == "" {
+		return "text-embedding-3-small"
+	}
+	return o.EmbedModel
+}
+
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, string, Usage, error) {
+	model := o.EmbeddingModel()
+	url := o.EmbedURL
+	if url == "" {
+		url = strings.Replace(o.URL, "/chat/completions", "/embeddings", 1)
+	}
+
+	resp, err := postJSON(ctx, o.HTTP, o.Name(), url, o.header(), map[string]interface{}{"model": model, "input": texts})
+	if err != nil {
+		return nil, "", Usage{}, err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Model string `json:"model"`
+		Data  []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Usage openAIUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, "", Usage{}, fmt.Errorf("invalid response from openai: %w", err)
+	}
+	vectors := make([][]float32, len(out.Data))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, "", Usage{}, fmt.Errorf("openai returned embedding %d of %d", d.Index, len(vectors))
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	if out.Model == "" {
+		out.Model = model
+	}
+	return vectors, out.Model, Usage{InputTokens: out.Usage.PromptTokens}, nil
+}
+
+func (o *OpenAI) header() http.Header {
+	if o.APIKey == "" {
+		return nil
+	}
+	return http.Header{"Authorization": {"Bearer " + o.APIKey}}
+}
+
+// postJSON posts body to url, turning any status but 200 into a
+// *StatusError carrying the start of the provider's explanation.
+func postJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s unreachable: %w", provider, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &StatusError{Provider: provider, Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// readEvents hands the data of each server-sent event in r to fn until r
+// ends or fn returns io.EOF.
+func readEvents(r io.Reader, fn func(data []byte) error) error {
+	return readLines(r, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return nil
+		}
+		return fn(bytes.TrimSpace(data))
+	})
+}
+
+// readLines hands each non-empty line in r to fn until r ends or fn
+// returns io.EOF.
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,53 @@
+package llm
+
+import "strings"
+
+// Price is what a model charges, in US dollars per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// Prices maps model names to prices. A model matches the longest name it
+// starts with, so dated snapshots ("gpt-4o-mini-2024-07-18") are priced
+// like their model.
+type Prices map[string]Price
+
+// DefaultPrices are the list prices of the models Selin is usually run
+// with. Local models, and models not listed, cost nothing.
+var DefaultPrices = Prices{
+	"gpt-4o":                 {Input: 2.50, Output: 10},
+	"gpt-4o-mini":            {Input: 0.15, Output: 0.60},
+	"gpt-4.1":                {Input: 2, Output: 8},
+	"gpt-4.1-mini":           {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":           {Input: 0.10, Output: 0.40},
+	"text-embedding-3-small": {Input: 0.02},
+	"text-embedding-3-large": {Input: 0.13},
+	"claude-3-5-haiku":       {Input: 0.80, Output: 4},
+	"claude-3-5-sonnet":      {Input: 3, Output: 15},
+	"claude-3-7-sonnet":      {Input: 3, Output: 15},
+	"claude-sonnet-4":        {Input: 3, Output: 15},
+	"claude-opus-4":          {Input: 15, Output: 75},
+}
+
+// Cost estimates what usage of model cost.
+func (p Prices) Cost(model string, usage Usage) float64 {
+	var price Price
+	var matched string
+	for name, pr := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(matched) {
+			price, matched = pr, name
+		}
+	}
+	return (float64(usage.InputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1e6
+}
+
+// With returns a copy of p with model priced at price.
+func (p Prices) With(model string, price Price) Prices {
+	out := make(Prices, len(p)+1)
+	for name, pr := range p {
+		out[name] = pr
+	}
+	out[model] = price
+	return out
+}
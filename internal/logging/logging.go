@@ -0,0 +1,140 @@
+// Package logging sets up structured logging for the services.
+//
+// Setup installs a log/slog default logger whose entries carry the service
+// name and version. LOG_LEVEL (debug, info, warn or error; default info)
+// sets the minimum level and LOG_FORMAT selects json (default) or console
+// output. Error entries are also kept in errlog for the admin API.
+//
+// Middleware gives every request an ID, taken from X-Request-ID when the
+// caller (usually the gateway) sent one, and FromContext returns a logger
+// tagged with it, so one request can be followed across services.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"selin/internal/errlog"
+)
+
+// RequestIDHeader carries the request ID between services and back to the
+// client.
+const RequestIDHeader = "X-Request-ID"
+
+// Setup makes a logger configured from the environment the slog default,
+// which the standard log package then writes through as well.
+func Setup(service, version string) *slog.Logger {
+	logger := New(os.Stderr, os.Getenv("LOG_FORMAT"), ParseLevel(os.Getenv("LOG_LEVEL"))).
+		With("service", service, "version", version)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New builds a logger writing json or console ("console" or "text") output.
+func New(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "console", "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(errorCapture{h})
+}
+
+// ParseLevel reads a level name, defaulting to info.
+func ParseLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Fatal logs at error level and exits, for startup failures.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// errorCapture records error entries in errlog before passing them on.
+type errorCapture struct {
+	slog.Handler
+}
+
+func (h errorCapture) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		var b strings.Builder
+		b.WriteString(r.Message)
+		r.Attrs(func(a slog.Attr) bool {
+			fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+			return true
+		})
+		errlog.Add(errlog.Entry{Time: r.Time.UTC(), Message: b.String()})
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h errorCapture) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return errorCapture{h.Handler.WithAttrs(attrs)}
+}
+
+func (h errorCapture) WithGroup(name string) slog.Handler {
+	return errorCapture{h.Handler.WithGroup(name)}
+}
+
+type requestIDKey struct{}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Middleware assigns the request ID, echoes it in the response and sets it
+// on the request headers so proxied calls pass it on.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = NewRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "req_" + hex.EncodeToString(b)
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request's ID, or "" outside a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns the default logger, tagged with the request ID when
+// ctx belongs to a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
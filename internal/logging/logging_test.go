@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"selin/internal/errlog"
+)
+
+func TestJSONOutputAndLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", slog.LevelInfo).With("service", "test")
+
+	logger.Debug("hidden")
+	logger.Info("stored post", "id", "abc")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected only the info entry, got %q", buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "stored post" || entry["level"] != "INFO" || entry["service"] != "test" || entry["id"] != "abc" {
+		t.Errorf("Unexpected entry: %v", entry)
+	}
+}
+
+func TestConsoleOutput(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, "console", slog.LevelInfo).Warn("slow query", "ms", 1200)
+	if !strings.Contains(buf.String(), "level=WARN") || !strings.Contains(buf.String(), "ms=1200") {
+		t.Errorf("Unexpected console output: %q", buf.String())
+	}
+}
+
+func TestErrorsAreRecorded(t *testing.T) {
+	New(&bytes.Buffer{}, "json", slog.LevelInfo).Error("collect failed", "subreddit", "golang")
+	recent := errlog.Recent()
+	if len(recent) == 0 || recent[0].Message != "collect failed subreddit=golang" {
+		t.Errorf("Expected error to be recorded, got %+v", recent)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{"": slog.LevelInfo, "DEBUG": slog.LevelDebug, "warn": slog.LevelWarn, "error": slog.LevelError, "loud": slog.LevelInfo}
+	for in, want := range tests {
+		if got := ParseLevel(in); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	var seen, forwarded string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+		forwarded = r.Header.Get(RequestIDHeader)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if seen != "abc-123" || rr.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected incoming ID to be kept, got %q / %q", seen, rr.Header().Get(RequestIDHeader))
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if !strings.HasPrefix(seen, "req_") || forwarded != seen || rr.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("Expected a fresh ID to replace an invalid one, got %q forwarded as %q", seen, forwarded)
+	}
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The knowledge graph is built from the concepts new items mention: each
+// mention is recorded, and every pair of concepts mentioned together is
+// linked by an edge that strengthens as they keep coming up together.
+
+// Concept is a named tool, library, protocol or algorithm found in content.
+type Concept struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // language, tool, library, protocol, blockchain, algorithm
+}
+
+// conceptDictionary lists the concepts the knowledge graph tracks. A concept
+// matches its name or any alias as a whole word, case-insensitively.
+var conceptDictionary = []struct {
+	name    string
+	kind    string
+	aliases []string
+}{
+	{"golang", "language", []string{"go programming", "go language"}},
+	{"rust", "language", nil},
+	{"solidity", "language", nil},
+	{"goroutines", "language", []string{"goroutine"}},
+	{"docker", "tool", []string{"dockerfile"}},
+	{"kubernetes", "tool", []string{"k8s"}},
+	{"helm", "tool", nil},
+	{"terraform", "tool", nil},
+	{"prometheus", "tool", nil},
+	{"grafana", "tool", nil},
+	{"postgresql", "tool", []string{"postgres"}},
+	{"redis", "tool", nil},
+	{"kafka", "tool", nil},
+	{"grpc", "library", nil},
+	{"protobuf", "library", []string{"protocol buffers"}},
+	{"cosmos-sdk", "library", []string{"cosmos sdk"}},
+	{"cosmwasm", "library", nil},
+	{"libp2p", "library", nil},
+	{"cosmos", "blockchain", nil},
+	{"celestia", "blockchain", nil},
+	{"ethereum", "blockchain", nil},
+	{"bitcoin", "blockchain", nil},
+	{"solana", "blockchain", nil},
+	{"tendermint", "protocol", nil},
+	{"cometbft", "protocol", nil},
+	{"abci", "protocol", nil},
+	{"ibc", "protocol", []string{"inter-blockchain communication"}},
+	{"evm", "protocol", nil},
+	{"webassembly", "protocol", []string{"wasm"}},
+	{"tls", "protocol", nil},
+	{"merkle tree", "algorithm", []string{"merkle trees", "merkle proof", "merkle proofs"}},
+	{"zero-knowledge proofs", "algorithm", []string{"zero knowledge", "zk-snark", "zksnark", "zk proof"}},
+	{"ed25519", "algorithm", nil},
+	{"secp256k1", "algorithm", nil},
+	{"ecdsa", "algorithm", nil},
+	{"bls signatures", "algorithm", []string{"bls"}},
+	{"sha-256", "algorithm", []string{"sha256"}},
+	{"aes", "algorithm", nil},
+	{"rsa", "algorithm", nil},
+}
+
+var conceptPatterns = compileConceptPatterns()
+
+func compileConceptPatterns() []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, len(conceptDictionary))
+	for i, c := range conceptDictionary {
+		terms := []string{regexp.QuoteMeta(c.name)}
+		for _, alias := range c.aliases {
+			terms = append(terms, regexp.QuoteMeta(alias))
+		}
+		patterns[i] = regexp.MustCompile(`(?i)(^|[^a-z0-9])(` + strings.Join(terms, "|") + `)($|[^a-z0-9])`)
+	}
+	return patterns
+}
+
+// ExtractConcepts returns the dictionary concepts mentioned in text, sorted
+// by name.
+func ExtractConcepts(text string) []Concept {
+	var concepts []Concept
+	for i, pattern := range conceptPatterns {
+		if pattern.MatchString(text) {
+			concepts = append(concepts, Concept{Name: conceptDictionary[i].name, Kind: conceptDictionary[i].kind})
+		}
+	}
+	sort.Slice(concepts, func(i, j int) bool { return concepts[i].Name < concepts[j].Name })
+	return concepts
+}
+
+// Concepts records the concepts new items mention in their text, or their
+// summary when there is no text.
+func Concepts(db *sql.DB) Stage {
+	return Stage{Name: "concepts", OnError: Continue, Writes: true, Run: func(ctx context.Context, item *ContentItem) error {
+		if db == nil || !item.Inserted {
+			return nil
+		}
+		text := item.Text
+		if text == "" {
+			text = item.Summary
+		}
+		return storeConcepts(ctx, db, item.ID, ExtractConcepts(text))
+	}}
+}
+
+// storeConcepts records the concepts mentioned by one content item and
+// strengthens the co-occurrence edge between every pair of them. Edges are
+// undirected and stored once, with source < target.
+func storeConcepts(ctx context.Context, db *sql.DB, contentID string, concepts []Concept) error {
+	for _, c := range concepts {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO knowledge_concepts (name, kind, mention_count)
+			VALUES ($1, $2, 1)
+			ON CONFLICT (name) DO UPDATE SET
+				mention_count = knowledge_concepts.mention_count + 1,
+				last_seen = now()`, c.Name, c.Kind)
+		if err != nil {
+			return fmt.Errorf("failed to store concept %s: %v", c.Name, err)
+		}
+
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO concept_mentions (concept, content_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, c.Name, contentID)
+		if err != nil {
+			return fmt.Errorf("failed to store mention of %s: %v", c.Name, err)
+		}
+	}
+
+	// concepts is sorted, so i < j keeps source < target
+	for i := 0; i < len(concepts); i++ {
+		for j := i + 1; j < len(concepts); j++ {
+			_, err := db.ExecContext(ctx, `
+				INSERT INTO concept_edges (source, target, weight)
+				VALUES ($1, $2, 1)
+				ON CONFLICT (source, target) DO UPDATE SET
+					weight = concept_edges.weight + 1,
+					updated_at = now()`, concepts[i].Name, concepts[j].Name)
+			if err != nil {
+				return fmt.Errorf("failed to store edge %s-%s: %v", concepts[i].Name, concepts[j].Name, err)
+			}
+		}
+	}
+
+	return nil
+}
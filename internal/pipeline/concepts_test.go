@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractConcepts(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want []string
+	}{
+		{"Running Tendermint validators on Kubernetes", []string{"kubernetes", "tendermint"}},
+		{"We deploy with k8s and a Dockerfile", []string{"docker", "kubernetes"}},
+		{"Merkle proofs in the Cosmos SDK", []string{"cosmos", "cosmos-sdk", "merkle tree"}},
+		{"zk-SNARK verifiers written in Rust", []string{"rust", "zero-knowledge proofs"}},
+		// Whole words only
+		{"trusted setups, redistribution, abcide", nil},
+		{"SHA256 and SHA-256 are one concept", []string{"sha-256"}},
+		{"", nil},
+	} {
+		var got []string
+		for _, c := range ExtractConcepts(tt.text) {
+			got = append(got, c.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestExtractConceptsKinds(t *testing.T) {
+	want := []Concept{{Name: "golang", Kind: "language"}, {Name: "grpc", Kind: "library"}, {Name: "tls", Kind: "protocol"}}
+	if got := ExtractConcepts("gRPC over TLS in the Go language"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
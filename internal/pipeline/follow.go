@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"selin/internal/fetch"
+	"selin/internal/flags"
+	"selin/internal/links"
+	"selin/internal/readability"
+	"selin/internal/search"
+	"selin/internal/storage"
+)
+
+// MaxFollowed caps the links followed from one item.
+const MaxFollowed = 3
+
+// urlPattern finds URLs in text.
+var urlPattern = regexp.MustCompile(`https?://[^\s<>()\[\]{}"'|\\^` + "`" + `]+`)
+
+// mediaExtensions are links to files rather than pages.
+var mediaExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".gifv": true, ".webp": true, ".svg": true,
+	".mp4": true, ".webm": true, ".mov": true, ".mp3": true, ".pdf": true, ".zip": true,
+}
+
+// OutboundURLs returns the web pages text links to, in order and without
+// repeats, leaving out links to the hosts in skip (and their subdomains)
+// and to images, video and other files.
+func OutboundURLs(text string, skip ...string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, raw := range urlPattern.FindAllString(text, -1) {
+		raw = strings.TrimRight(raw, ".,;:!?*_~")
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		host := strings.ToLower(u.Hostname())
+		if mediaExtensions[strings.ToLower(path.Ext(u.Path))] || skipped(host, skip) {
+			continue
+		}
+		urls = append(urls, raw)
+	}
+	return urls
+}
+
+func skipped(host string, skip []string) bool {
+	for _, s := range skip {
+		if host == s || strings.HasSuffix(host, "."+s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractLinks sets the item's Outbound to the web pages it links to: the
+// ones already there, such as a link post's URL, then those in its text.
+// Links to the hosts in skip, such as the item's own platform, are left
+// out.
+func ExtractLinks(skip ...string) Stage {
+	return Stage{Name: "extract_links", Run: func(ctx context.Context, item *ContentItem) error {
+		item.Outbound = OutboundURLs(strings.Join(item.Outbound, " ")+" "+item.Text, skip...)
+		return nil
+	}}
+}
+
+// FollowLinks fetches the pages new items link to, up to MaxFollowed of
+// them, while the follow_links flag is on. Each page's article is run
+// through ingest as an item of its own, and the item is linked to it.
+// Articles already stored are linked without being fetched again.
+//
+// Articles are private: their license is unknown. They take the item's
+// tags and relevance, and the page's author and published date.
+func FollowLinks(db *sql.DB, pages *fetch.Client, ingest *Pipeline) Stage {
+	return Stage{Name: "follow_links", OnError: Continue, Writes: true, Run: func(ctx context.Context, item *ContentItem) error {
+		if !item.Inserted || len(item.Outbound) == 0 || !flags.Default().Enabled(flags.FollowLinks) {
+			return nil
+		}
+		var errs []error
+		for _, target := range item.Outbound[:min(len(item.Outbound), MaxFollowed)] {
+			if err := follow(ctx, db, pages, ingest, item, target); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", target, err))
+			}
+		}
+		return errors.Join(errs...)
+	}}
+}
+
+func follow(ctx context.Context, db *sql.DB, pages *fetch.Client, ingest *Pipeline, item *ContentItem, target string) error {
+	if db != nil {
+		var stored bool
+		if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM content_metadata WHERE workspace_id = $1 AND source_url = $2)`,
+			item.Workspace, target).Scan(&stored); err != nil {
+			return err
+		}
+		if stored {
+			return links.Add(ctx, db, item.Workspace, item.ID, links.LinksTo, target)
+		}
+	}
+
+	resp, err := pages.Get(ctx, target)
+	if err != nil {
+		return err
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return nil
+	}
+	article, err := readability.Extract(bytes.NewReader(resp.Body))
+	if err != nil {
+		return err
+	}
+
+	text := article.Text
+	if article.Title != "" && !strings.HasPrefix(text, "# ") {
+		text = "# " + article.Title + "\n\n" + text
+	}
+	published := article.Published
+	if published.IsZero() {
+		published = time.Now().UTC()
+	}
+	language := article.Language
+	if language == "" {
+		language = item.Language
+	}
+	linked := &ContentItem{
+		Content: storage.Content{
+			Workspace:      item.Workspace,
+			SourceURL:      target,
+			Author:         article.Author,
+			Timestamp:      published,
+			Tags:           item.Tags,
+			ContentType:    "article",
+			SourcePlatform: "web",
+			Language:       language,
+			Summary:        article.Description,
+			RelevanceScore: item.RelevanceScore,
+			Visibility:     search.VisibilityPrivate,
+		},
+		Text: text,
+	}
+	if err := ingest.Run(ctx, linked); err != nil {
+		return err
+	}
+	if db == nil {
+		return nil
+	}
+	return links.Add(ctx, db, item.Workspace, item.ID, links.LinksTo, target)
+}
@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"selin/internal/fetch"
+	"selin/internal/search"
+	"selin/internal/storage"
+)
+
+func TestOutboundURLs(t *testing.T) {
+	text := `Writeup at https://blog.example.com/rollups. Also (https://docs.example.org/da?x=1),
+		https://www.reddit.com/r/golang/comments/1, https://i.redd.it/cat.png,
+		https://example.net/diagram.PNG and https://blog.example.com/rollups again`
+	want := []string{"https://blog.example.com/rollups", "https://docs.example.org/da?x=1"}
+	if got := OutboundURLs(text, "reddit.com", "redd.it"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestFollowLinks(t *testing.T) {
+	t.Setenv("FLAG_FOLLOW_LINKS", "true")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Light clients</title><meta name="author" content="Ada"></head>
+			<body><article><p>Light clients verify headers without downloading every block, which keeps them cheap to run.</p>
+			<p>They sample data availability, too, so a dishonest majority cannot hide data from them.</p></article></body></html>`))
+	}))
+	defer srv.Close()
+
+	store, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	opts := fetch.DefaultOptions()
+	opts.Interval, opts.Robots = 0, true
+	pages := fetch.New("test", opts)
+	ingest := Standard(Deps{Name: "test_article", Store: store})
+
+	post := &ContentItem{
+		Content: storage.Content{Workspace: "default", SourceURL: "https://reddit.com/r/x/1", Tags: []string{"celestia"},
+			RelevanceScore: 0.8, Language: "en", Timestamp: time.Now()},
+		Text:     "Good read",
+		Outbound: []string{srv.URL + "/light-clients"},
+		Inserted: true,
+	}
+	// Run directly, as the pipeline would only log a follow_links error
+	if err := ExtractLinks("reddit.com").Run(context.Background(), post); err != nil || len(post.Outbound) != 1 {
+		t.Fatalf("Expected the link to be kept, got %v (%v)", post.Outbound, err)
+	}
+	if err := FollowLinks(nil, pages, ingest).Run(context.Background(), post); err != nil {
+		t.Fatalf("Expected the article to be followed, got %v", err)
+	}
+
+	items, err := store.Search(context.Background(), search.SearchRequest{Workspace: "default", Platform: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items.Items) != 1 {
+		t.Fatalf("Expected the linked article to be stored, got %+v", items.Items)
+	}
+	a := items.Items[0]
+	if a.SourceURL != srv.URL+"/light-clients" || a.Author != "Ada" || a.Visibility != search.VisibilityPrivate ||
+		!reflect.DeepEqual(a.Tags, []string{"celestia"}) {
+		t.Errorf("Unexpected article %+v", a)
+	}
+}
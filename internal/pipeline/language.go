@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// stopwords are the commonest short words of the languages DetectLanguage
+// tells apart by their words rather than their script.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "that", "it", "with", "for", "this", "was", "you", "not"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "mit", "auf", "sich", "auch", "ich", "wir", "den"},
+	"fr": {"le", "la", "les", "et", "est", "une", "des", "du", "que", "pas", "pour", "dans", "qui", "sur", "nous"},
+	"es": {"el", "los", "las", "y", "es", "una", "que", "del", "por", "para", "con", "como", "pero", "muy", "está"},
+	"it": {"il", "gli", "che", "è", "di", "una", "per", "non", "sono", "della", "con", "come", "anche", "questo", "nel"},
+	"pt": {"o", "os", "as", "e", "é", "um", "uma", "que", "não", "do", "da", "para", "com", "como", "mais"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "op", "voor", "met", "zijn", "ook", "maar", "wij"},
+}
+
+// stopwordLanguages maps each stopword to the languages it belongs to.
+var stopwordLanguages = func() map[string][]string {
+	m := make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// detectSample is how much of the text DetectLanguage reads.
+const detectSample = 4000
+
+// DetectLanguage guesses the two-letter code of the language text is
+// written in: by script for Cyrillic, Chinese, Japanese and Korean, and by
+// its commonest words for Latin-script languages. It returns "" when the
+// text is too short or too mixed to tell.
+func DetectLanguage(text string) string {
+	if len(text) > detectSample {
+		text = text[:detectSample]
+	}
+	var letters, cyrillic, ukrainian, han, kana, hangul int
+	for _, r := range text {
+		switch {
+		case !unicode.IsLetter(r):
+			continue
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		}
+		letters++
+	}
+	if letters == 0 {
+		return ""
+	}
+	switch {
+	case kana*5 > letters:
+		return "ja"
+	case hangul*2 > letters:
+		return "ko"
+	case han*2 > letters:
+		return "zh"
+	case cyrillic*2 > letters:
+		if ukrainian > 0 {
+			return "uk"
+		}
+		return "ru"
+	}
+
+	hits := make(map[string]int)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for _, lang := range stopwordLanguages[w] {
+			hits[lang]++
+		}
+	}
+	best, first, second := "", 0, 0
+	for lang, n := range hits {
+		switch {
+		case n > first || n == first && lang < best:
+			best, first, second = lang, n, first
+		case n > second:
+			second = n
+		}
+	}
+	// A handful of shared words is no evidence either way
+	if first < 3 || first < second*3/2 {
+		return ""
+	}
+	return best
+}
+
+// Language sets an empty language to the one the text is detected in.
+func Language() Stage {
+	return Stage{Name: "language", Run: func(ctx context.Context, item *ContentItem) error {
+		text := item.Text
+		if text == "" {
+			text = item.Summary
+		}
+		if item.Language == "" {
+			item.Language = DetectLanguage(text)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,194 @@
+// Package pipeline runs content through the same ordered stages on its way
+// into the store, whichever service ingested it: summarizing, detecting
+// the language, counting tokens, chunking, applying tag aliases and author reputation, storing,
+// then saving chunks, links and the concepts mentioned. Services add stages
+// of their own, such as the collector's link following, to the end of the
+// Standard chain.
+//
+// Every stage is timed and has an error policy: a Fail stage stops the
+// item and returns its error, a Continue stage's error is logged and
+// counted and the item goes on. A stage returning Drop stops the item
+// without it being an error.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"selin/internal/chunker"
+	"selin/internal/links"
+	"selin/internal/logging"
+	"selin/internal/storage"
+)
+
+// ContentItem is one item on its way into the store.
+type ContentItem struct {
+	storage.Content
+	// Text is the full text the summary, token count and chunks are
+	// derived from; when empty, the summary is all there is.
+	Text   string
+	Chunks []chunker.Chunk
+	// Links relate the item to others by source URL, added once it is
+	// stored.
+	Links []Link
+	// Outbound are the web pages the item links to, set by ExtractLinks
+	// and fetched by FollowLinks.
+	Outbound []string
+	// Inserted is set by the store stage when the item is new rather
+	// than an update of one stored before.
+	Inserted bool
+}
+
+// Link is a relation from an item to the item stored from TargetURL.
+type Link struct {
+	Relation  links.Relation
+	TargetURL string
+}
+
+// Policy is what a stage's error does to the item.
+type Policy int
+
+const (
+	// Fail stops the item and returns the error.
+	Fail Policy = iota
+	// Continue logs the error and passes the item on.
+	Continue
+)
+
+func (p Policy) String() string {
+	if p == Continue {
+		return "continue"
+	}
+	return "fail"
+}
+
+// Stage is one step of a pipeline.
+type Stage struct {
+	Name    string
+	Run     func(ctx context.Context, item *ContentItem) error
+	OnError Policy
+	// Writes marks stages that store the item or anything of it, which a
+	// dry run leaves out.
+	Writes bool
+}
+
+// ErrDropped is returned by Run for items a stage dropped.
+var ErrDropped = errors.New("item dropped")
+
+// Drop returns the error a stage stops an item with when it is not to be
+// stored, with the reason why.
+func Drop(reason string) error {
+	return fmt.Errorf("%w: %s", ErrDropped, reason)
+}
+
+var (
+	stageDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ingest_stage_duration_seconds",
+			Help:    "Time one item spent in an ingestion stage",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 4, 10),
+		},
+		[]string{"pipeline", "stage"},
+	)
+	stageErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_stage_errors_total",
+			Help: "Ingestion stage failures, by the policy applied to them",
+		},
+		[]string{"pipeline", "stage", "policy"},
+	)
+	itemsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_items_total",
+			Help: "Items run through an ingestion pipeline, by result (processed, dropped, failed)",
+		},
+		[]string{"pipeline", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(stageDuration, stageErrors, itemsTotal)
+}
+
+// Pipeline is an ordered chain of stages.
+type Pipeline struct {
+	name   string
+	stages []Stage
+}
+
+// New returns a pipeline running stages in order. name labels its
+// metrics, such as "reddit" or "slack".
+func New(name string, stages ...Stage) *Pipeline {
+	return &Pipeline{name: name, stages: stages}
+}
+
+// Then adds stages to the end of the chain.
+func (p *Pipeline) Then(stages ...Stage) *Pipeline {
+	p.stages = append(p.stages, stages...)
+	return p
+}
+
+// Before adds stages ahead of the stage called name, or to the end of the
+// chain when there is none.
+func (p *Pipeline) Before(name string, stages ...Stage) *Pipeline {
+	for i, s := range p.stages {
+		if s.Name == name {
+			p.stages = append(append(append([]Stage{}, p.stages[:i]...), stages...), p.stages[i:]...)
+			return p
+		}
+	}
+	return p.Then(stages...)
+}
+
+// DryRun returns a copy of the pipeline without the stages that write, so
+// items are parsed, chunked, tagged and scored as they would be but
+// nothing is stored. Items run through it are never Inserted and have no
+// ID.
+func (p *Pipeline) DryRun() *Pipeline {
+	dry := &Pipeline{name: p.name}
+	for _, s := range p.stages {
+		if !s.Writes {
+			dry.stages = append(dry.stages, s)
+		}
+	}
+	return dry
+}
+
+// Stages returns the names of the stages, in order.
+func (p *Pipeline) Stages() []string {
+	names := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Run passes item through every stage. It returns the error of a Fail
+// stage, or one wrapping ErrDropped when a stage dropped the item.
+func (p *Pipeline) Run(ctx context.Context, item *ContentItem) error {
+	for _, s := range p.stages {
+		start := time.Now()
+		err := s.Run(ctx, item)
+		stageDuration.WithLabelValues(p.name, s.Name).Observe(time.Since(start).Seconds())
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrDropped):
+			itemsTotal.WithLabelValues(p.name, "dropped").Inc()
+			return err
+		case s.OnError == Continue:
+			stageErrors.WithLabelValues(p.name, s.Name, s.OnError.String()).Inc()
+			logging.FromContext(ctx).Warn("ingestion stage failed", "pipeline", p.name, "stage", s.Name,
+				"source_url", item.SourceURL, "error", err)
+		default:
+			stageErrors.WithLabelValues(p.name, s.Name, s.OnError.String()).Inc()
+			itemsTotal.WithLabelValues(p.name, "failed").Inc()
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+	itemsTotal.WithLabelValues(p.name, "processed").Inc()
+	return nil
+}
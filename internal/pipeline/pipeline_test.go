@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"selin/internal/storage"
+)
+
+func TestRunAppliesErrorPolicies(t *testing.T) {
+	var ran []string
+	stage := func(name string, policy Policy, err error) Stage {
+		return Stage{Name: name, OnError: policy, Run: func(ctx context.Context, item *ContentItem) error {
+			ran = append(ran, name)
+			return err
+		}}
+	}
+	boom := errors.New("boom")
+
+	p := New("test", stage("a", Continue, boom), stage("b", Fail, nil))
+	if err := p.Run(context.Background(), &ContentItem{}); err != nil {
+		t.Errorf("Expected a Continue stage's error to be passed over, got %v", err)
+	}
+
+	ran = nil
+	p = New("test", stage("a", Fail, boom), stage("b", Fail, nil))
+	if err := p.Run(context.Background(), &ContentItem{}); !errors.Is(err, boom) || !strings.HasPrefix(err.Error(), "a: ") {
+		t.Errorf("Expected the Fail stage's error, got %v", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"a"}) {
+		t.Errorf("Expected the chain to stop at the failed stage, ran %v", ran)
+	}
+
+	ran = nil
+	p = New("test", stage("a", Continue, Drop("off topic"))).Then(stage("b", Fail, nil))
+	if err := p.Run(context.Background(), &ContentItem{}); !errors.Is(err, ErrDropped) {
+		t.Errorf("Expected ErrDropped, got %v", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"a"}) {
+		t.Errorf("Expected a dropped item to stop even at a Continue stage, ran %v", ran)
+	}
+}
+
+func TestBefore(t *testing.T) {
+	stage := func(name string) Stage { return Stage{Name: name} }
+	p := New("test", stage("a"), stage("c")).Before("c", stage("b1"), stage("b2")).Before("missing", stage("d"))
+	if got, want := p.Stages(), []string{"a", "b1", "b2", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected stages %v, got %v", want, got)
+	}
+}
+
+func TestStandard(t *testing.T) {
+	store, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	p := Standard(Deps{Name: "test", Store: store})
+	want := []string{"summarize", "language", "count_tokens", "chunk", "tag_aliases", "reputation", "store", "save_chunks", "links", "concepts"}
+	if got := p.Stages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected stages %v, got %v", want, got)
+	}
+
+	text := strings.Repeat("Validators sign blocks. ", 30)
+	item := &ContentItem{
+		Content: storage.Content{Workspace: "default", SourceURL: "https://example.com/a", Tags: []string{"Cosmos"}, ContentType: "text", RelevanceScore: 0.5},
+		Text:    text,
+	}
+	if err := p.Run(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID == "" || !item.Inserted {
+		t.Errorf("Expected the item stored as new, got %+v", item)
+	}
+	if len(item.Summary) != SummaryLength+3 || !strings.HasPrefix(item.Summary, "Validators sign blocks.") {
+		t.Errorf("Expected the summary cut from the text, got %q", item.Summary)
+	}
+	if item.Tokens == 0 || len(item.Chunks) == 0 {
+		t.Errorf("Expected tokens counted and chunks made, got %d tokens and %d chunks", item.Tokens, len(item.Chunks))
+	}
+	if !reflect.DeepEqual(item.Tags, []string{"Cosmos"}) {
+		t.Errorf("Expected the Postgres-only stages to leave the tags alone, got %v", item.Tags)
+	}
+
+	got, err := store.Get(context.Background(), "default", item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TokenCount != item.Tokens {
+		t.Errorf("Expected %d tokens stored, got %d", item.Tokens, got.TokenCount)
+	}
+
+	if err := p.Run(context.Background(), &ContentItem{Content: storage.Content{SourceURL: "https://example.com/empty"}}); !errors.Is(err, ErrDropped) {
+		t.Errorf("Expected an item without text dropped, got %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	store, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	p := Standard(Deps{Name: "test", Store: store})
+	dry := p.DryRun()
+	want := []string{"summarize", "language", "count_tokens", "chunk", "tag_aliases", "reputation"}
+	if got := dry.Stages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected stages %v, got %v", want, got)
+	}
+	if len(p.Stages()) != 10 {
+		t.Errorf("Expected the pipeline itself left whole, got %v", p.Stages())
+	}
+
+	newItem := func() *ContentItem {
+		return &ContentItem{
+			Content: storage.Content{Workspace: "default", SourceURL: "https://example.com/dry", Tags: []string{"Cosmos"}, ContentType: "text", RelevanceScore: 0.5},
+			Text:    strings.Repeat("The validators sign the blocks and the chain is final. ", 20),
+		}
+	}
+	item := newItem()
+	if err := dry.Run(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != "" || item.Inserted || item.Language != "en" || len(item.Chunks) == 0 {
+		t.Errorf("Expected the item prepared but not stored, got %+v", item)
+	}
+
+	preview := NewPreview()
+	preview.Add(item)
+	if preview.Items != 1 || preview.Chunks != len(item.Chunks) || preview.Languages["en"] != 1 || preview.Tags["Cosmos"] != 1 || len(preview.Samples) != 1 {
+		t.Errorf("Unexpected preview %+v", preview)
+	}
+
+	item = newItem()
+	if err := p.Run(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+	if !item.Inserted {
+		t.Error("Expected the dry run to have stored nothing")
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	for _, tt := range []struct{ text, want string }{
+		{"The validators sign the blocks and it is final for the chain.", "en"},
+		{"Die Validatoren signieren die Blöcke und das ist nicht umkehrbar.", "de"},
+		{"Les validateurs signent les blocs et la chaîne est finale pour nous.", "fr"},
+		{"Los validadores firman los bloques y la cadena es final para todos.", "es"},
+		{"De validators tekenen de blokken en het is niet terug te draaien.", "nl"},
+		{"Валидаторы подписывают блоки, и цепочка становится окончательной.", "ru"},
+		{"Валідатори підписують блоки, і ланцюг стає остаточним.", "uk"},
+		{"バリデーターがブロックに署名します。", "ja"},
+		{"검증자가 블록에 서명합니다.", "ko"},
+		{"验证者签署区块。", "zh"},
+		{"Validators sign blocks.", ""},
+		{"", ""},
+	} {
+		if got := DetectLanguage(tt.text); got != tt.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+// PreviewSamples is how many items a Preview keeps whole.
+const PreviewSamples = 5
+
+// Preview sums up the items of a dry run: what an import would store,
+// without storing it.
+type Preview struct {
+	// Items counts the items that would be stored
+	Items  int `json:"items"`
+	Chunks int `json:"chunks"`
+	Tokens int `json:"tokens"`
+	// Languages counts the items by detected language, "" when unknown
+	Languages map[string]int `json:"languages"`
+	// Tags counts the items by the tags they would be stored with, after
+	// the workspace's aliases
+	Tags    map[string]int `json:"tags"`
+	Samples []PreviewItem  `json:"samples"`
+}
+
+// PreviewItem is an item as it would be stored.
+type PreviewItem struct {
+	SourceURL      string   `json:"source_url"`
+	ContentType    string   `json:"content_type"`
+	Author         string   `json:"author,omitempty"`
+	Language       string   `json:"language,omitempty"`
+	Summary        string   `json:"summary"`
+	Tags           []string `json:"tags"`
+	RelevanceScore float64  `json:"relevance_score"`
+	Tokens         int      `json:"tokens"`
+	Chunks         int      `json:"chunks"`
+}
+
+// NewPreview returns an empty preview.
+func NewPreview() *Preview {
+	return &Preview{Languages: map[string]int{}, Tags: map[string]int{}, Samples: []PreviewItem{}}
+}
+
+// Add counts an item that went through a dry run, keeping it as a sample
+// while there are fewer than PreviewSamples.
+func (p *Preview) Add(item *ContentItem) {
+	p.Items++
+	p.Chunks += len(item.Chunks)
+	p.Tokens += item.Tokens
+	p.Languages[item.Language]++
+	for _, tag := range item.Tags {
+		p.Tags[tag]++
+	}
+	if len(p.Samples) < PreviewSamples {
+		p.Samples = append(p.Samples, PreviewItem{
+			SourceURL:      item.SourceURL,
+			ContentType:    item.ContentType,
+			Author:         item.Author,
+			Language:       item.Language,
+			Summary:        item.Summary,
+			Tags:           item.Tags,
+			RelevanceScore: item.RelevanceScore,
+			Tokens:         item.Tokens,
+			Chunks:         len(item.Chunks),
+		})
+	}
+}
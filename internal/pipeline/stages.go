@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"selin/internal/chunker"
+	"selin/internal/links"
+	"selin/internal/reputation"
+	"selin/internal/storage"
+	"selin/internal/tagging"
+	"selin/internal/tokenizer"
+)
+
+// SummaryLength is the longest summary Summarize derives from the text.
+const SummaryLength = 200
+
+// Deps are what the standard stages work with.
+type Deps struct {
+	// Name labels the pipeline's metrics.
+	Name  string
+	Store storage.Store
+	// Chunking splits the text; the default configuration when nil.
+	Chunking *chunker.Config
+}
+
+// Standard returns the chain every ingestion path runs. Stages that need
+// Postgres do nothing with other stores.
+func Standard(d Deps) *Pipeline {
+	chunking := d.Chunking
+	if chunking == nil {
+		chunking = chunker.DefaultConfig()
+	}
+	db, _ := storage.PostgresDB(d.Store)
+	return New(d.Name,
+		Summarize(),
+		Language(),
+		CountTokens(tokenizer.Default()),
+		Chunk(chunking),
+		TagAliases(db),
+		Reputation(db),
+		Store(d.Store),
+		SaveChunks(db),
+		AddLinks(db),
+		Concepts(db),
+	)
+}
+
+// Summarize sets an empty summary to the start of the text.
+func Summarize() Stage {
+	return Stage{Name: "summarize", Run: func(ctx context.Context, item *ContentItem) error {
+		if item.Summary != "" {
+			return nil
+		}
+		summary := strings.Join(strings.Fields(item.Text), " ")
+		if len(summary) > SummaryLength {
+			summary = summary[:SummaryLength] + "..."
+		}
+		if summary == "" {
+			return Drop("no text")
+		}
+		item.Summary = summary
+		return nil
+	}}
+}
+
+// CountTokens sets the item's length in tokens from its text.
+func CountTokens(tok tokenizer.Tokenizer) Stage {
+	return Stage{Name: "count_tokens", Run: func(ctx context.Context, item *ContentItem) error {
+		if item.Text != "" {
+			item.Tokens = tok.Count(item.Text)
+		}
+		return nil
+	}}
+}
+
+// Chunk splits the text as configured for the item's content type.
+func Chunk(c *chunker.Config) Stage {
+	return Stage{Name: "chunk", Run: func(ctx context.Context, item *ContentItem) error {
+		if item.Text != "" && item.Chunks == nil {
+			item.Chunks = c.Chunk(item.ContentType, item.Text)
+		}
+		return nil
+	}}
+}
+
+// TagAliases applies the workspace's tag aliases (e.g. k8s → kubernetes).
+func TagAliases(db *sql.DB) Stage {
+	return Stage{Name: "tag_aliases", OnError: Continue, Run: func(ctx context.Context, item *ContentItem) error {
+		if db == nil {
+			return nil
+		}
+		aliases, err := tagging.LoadAliases(ctx, db, item.Workspace)
+		// Tags are normalized even without the aliases
+		item.Tags = aliases.Apply(item.Tags)
+		return err
+	}}
+}
+
+// Reputation weighs the relevance score by the author's reputation, so
+// authors whose content has proven relevant or useful weigh more.
+func Reputation(db *sql.DB) Stage {
+	return Stage{Name: "reputation", OnError: Continue, Run: func(ctx context.Context, item *ContentItem) error {
+		if db == nil {
+			return nil
+		}
+		author, err := reputation.Lookup(ctx, db, item.Workspace, item.SourcePlatform, item.Author)
+		item.RelevanceScore = math.Min(1, item.RelevanceScore*reputation.Weight(author.Reputation))
+		return err
+	}}
+}
+
+// Store saves the item, setting its ID and whether it is new.
+func Store(store storage.Store) Stage {
+	return Stage{Name: "store", Writes: true, Run: func(ctx context.Context, item *ContentItem) error {
+		id, inserted, err := store.SaveContent(ctx, item.Content)
+		if err != nil {
+			return err
+		}
+		item.ID, item.Inserted = id, inserted
+		return nil
+	}}
+}
+
+// SaveChunks stores the chunks of new items.
+func SaveChunks(db *sql.DB) Stage {
+	return Stage{Name: "save_chunks", OnError: Continue, Writes: true, Run: func(ctx context.Context, item *ContentItem) error {
+		if db == nil || !item.Inserted || len(item.Chunks) == 0 {
+			return nil
+		}
+		return chunker.Save(ctx, db, item.Workspace, item.ID, item.Chunks)
+	}}
+}
+
+// AddLinks links the item to the ones it relates to.
+func AddLinks(db *sql.DB) Stage {
+	return Stage{Name: "links", OnError: Continue, Writes: true, Run: func(ctx context.Context, item *ContentItem) error {
+		if db == nil {
+			return nil
+		}
+		for _, link := range item.Links {
+			if err := links.Add(ctx, db, item.Workspace, item.ID, link.Relation, link.TargetURL); err != nil {
+				return fmt.Errorf("%s link: %v", link.Relation, err)
+			}
+		}
+		return nil
+	}}
+}
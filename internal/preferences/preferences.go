@@ -0,0 +1,167 @@
+// Package preferences keeps each user's settings in the user_preferences
+// table, apart in every workspace they use: the tags they follow, how often they get email digests, and the
+// platform and result format their searches default to. The MCP server
+// serves and applies them, the notifier follows them when routing events
+// and the ws service when filtering what it pushes.
+package preferences
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Digest schedules.
+const (
+	DigestDaily  = "daily"  // every NOTIFY_DIGEST_INTERVAL
+	DigestWeekly = "weekly" // at most once a week
+	DigestOff    = "off"    // no email
+)
+
+// Result formats, from the least to the most said about each search result.
+const (
+	FormatConcise  = "concise"
+	FormatBalanced = "balanced"
+	FormatDetailed = "detailed"
+)
+
+// MaxTags caps the tags a user can follow.
+const MaxTags = 50
+
+var (
+	digestSchedules = map[string]bool{DigestDaily: true, DigestWeekly: true, DigestOff: true}
+	platforms       = map[string]bool{"reddit": true, "slack": true, "file_upload": true, "all": true}
+	resultFormats   = map[string]bool{FormatConcise: true, FormatBalanced: true, FormatDetailed: true}
+)
+
+// Preferences are one user's settings. In an update, empty fields and a
+// nil SubscribedTags leave the current setting alone; an empty, non-nil
+// SubscribedTags stops following tags.
+type Preferences struct {
+	SubscribedTags  []string `json:"subscribed_tags"`
+	DigestSchedule  string   `json:"digest_schedule,omitempty"`  // daily, weekly, off
+	DefaultPlatform string   `json:"default_platform,omitempty"` // reddit, slack, file_upload, all
+	ResultFormat    string   `json:"result_format,omitempty"`    // concise, balanced, detailed
+}
+
+// Default returns the settings of a user who has not changed any.
+func Default() Preferences {
+	return Preferences{
+		SubscribedTags:  []string{},
+		DigestSchedule:  DigestDaily,
+		DefaultPlatform: "all",
+		ResultFormat:    FormatBalanced,
+	}
+}
+
+// Validate checks the fields that are set.
+func (p Preferences) Validate() error {
+	if p.DigestSchedule != "" && !digestSchedules[p.DigestSchedule] {
+		return fmt.Errorf("digest_schedule must be daily, weekly or off")
+	}
+	if p.DefaultPlatform != "" && !platforms[p.DefaultPlatform] {
+		return fmt.Errorf("default_platform must be reddit, slack, file_upload or all")
+	}
+	if p.ResultFormat != "" && !resultFormats[p.ResultFormat] {
+		return fmt.Errorf("result_format must be concise, balanced or detailed")
+	}
+	if len(p.SubscribedTags) > MaxTags {
+		return fmt.Errorf("subscribed_tags is limited to %d tags", MaxTags)
+	}
+	for _, tag := range p.SubscribedTags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("subscribed_tags must not contain empty tags")
+		}
+	}
+	return nil
+}
+
+// Merge returns p with the fields set in update replaced. Tags are
+// lowercased and deduplicated.
+func (p Preferences) Merge(update Preferences) Preferences {
+	if update.SubscribedTags != nil {
+		seen := map[string]bool{}
+		p.SubscribedTags = []string{}
+		for _, tag := range update.SubscribedTags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if !seen[tag] {
+				seen[tag] = true
+				p.SubscribedTags = append(p.SubscribedTags, tag)
+			}
+		}
+	}
+	if update.DigestSchedule != "" {
+		p.DigestSchedule = update.DigestSchedule
+	}
+	if update.DefaultPlatform != "" {
+		p.DefaultPlatform = update.DefaultPlatform
+	}
+	if update.ResultFormat != "" {
+		p.ResultFormat = update.ResultFormat
+	}
+	return p
+}
+
+// Follows reports whether content with tags is of interest: it is when the
+// user follows none of them in particular, when it is untagged, or when it
+// has a tag they follow.
+func (p Preferences) Follows(tags []string) bool {
+	if len(p.SubscribedTags) == 0 || len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, followed := range p.SubscribedTags {
+			if strings.EqualFold(tag, followed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Load returns a user's settings in workspace, the defaults when they have
+// saved none.
+func Load(ctx context.Context, db *sql.DB, workspace, userID string) (Preferences, error) {
+	p := Default()
+	err := db.QueryRowContext(ctx, `
+		SELECT subscribed_tags, digest_schedule, default_platform, result_format
+		FROM user_preferences WHERE workspace_id = $1 AND user_id = $2`, workspace, userID).
+		Scan(pq.Array(&p.SubscribedTags), &p.DigestSchedule, &p.DefaultPlatform, &p.ResultFormat)
+	if err == sql.ErrNoRows {
+		return Default(), nil
+	}
+	if p.SubscribedTags == nil {
+		p.SubscribedTags = []string{}
+	}
+	return p, err
+}
+
+// Update merges update into a user's settings in workspace, saving and
+// returning the result.
+func Update(ctx context.Context, db *sql.DB, workspace, userID string, update Preferences) (Preferences, error) {
+	if err := update.Validate(); err != nil {
+		return Preferences{}, err
+	}
+	current, err := Load(ctx, db, workspace, userID)
+	if err != nil {
+		return Preferences{}, err
+	}
+	p := current.Merge(update)
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO user_preferences (workspace_id, user_id, subscribed_tags, digest_schedule, default_platform, result_format)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET
+			subscribed_tags = EXCLUDED.subscribed_tags,
+			digest_schedule = EXCLUDED.digest_schedule,
+			default_platform = EXCLUDED.default_platform,
+			result_format = EXCLUDED.result_format,
+			updated_at = now()`,
+		workspace, userID, pq.Array(p.SubscribedTags), p.DigestSchedule, p.DefaultPlatform, p.ResultFormat)
+	if err != nil {
+		return Preferences{}, err
+	}
+	return p, nil
+}
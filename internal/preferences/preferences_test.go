@@ -0,0 +1,62 @@
+package preferences
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := (Preferences{}).Validate(); err != nil {
+		t.Errorf("Expected an empty update to be valid, got %v", err)
+	}
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Expected the defaults to be valid, got %v", err)
+	}
+	for _, p := range []Preferences{
+		{DigestSchedule: "hourly"},
+		{DefaultPlatform: "twitter"},
+		{ResultFormat: "verbose"},
+		{SubscribedTags: []string{"golang", " "}},
+		{SubscribedTags: make([]string, MaxTags+1)},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", p)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	p := Default().Merge(Preferences{SubscribedTags: []string{"Golang", "cosmos", "golang "}, DigestSchedule: DigestWeekly})
+	want := Preferences{SubscribedTags: []string{"golang", "cosmos"}, DigestSchedule: DigestWeekly, DefaultPlatform: "all", ResultFormat: FormatBalanced}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Expected %+v, got %+v", want, p)
+	}
+
+	// Unset fields are kept, an empty tag list clears them
+	p = p.Merge(Preferences{ResultFormat: FormatConcise})
+	if len(p.SubscribedTags) != 2 || p.DigestSchedule != DigestWeekly || p.ResultFormat != FormatConcise {
+		t.Errorf("Expected only the result format to change, got %+v", p)
+	}
+	if p = p.Merge(Preferences{SubscribedTags: []string{}}); len(p.SubscribedTags) != 0 {
+		t.Errorf("Expected the tags cleared, got %v", p.SubscribedTags)
+	}
+}
+
+func TestFollows(t *testing.T) {
+	p := Preferences{SubscribedTags: []string{"golang"}}
+	for _, tt := range []struct {
+		tags []string
+		want bool
+	}{
+		{[]string{"cosmos", "Golang"}, true},
+		{[]string{"cosmos"}, false},
+		{nil, true},
+	} {
+		if got := p.Follows(tt.tags); got != tt.want {
+			t.Errorf("Follows(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+	if !Default().Follows([]string{"cosmos"}) {
+		t.Error("Expected a user following no tags to follow everything")
+	}
+}
@@ -0,0 +1,42 @@
+package query
+
+import (
+	"context"
+	"errors"
+
+	"selin/internal/llm"
+	"selin/internal/logging"
+)
+
+const answerInstructions = "You answer a developer's question using only the context below, " +
+	"which Selin gathered from their saved content. Cite the items you use with their " +
+	"[n] markers. If the context does not answer the question, say so."
+
+// AnswerError describes why Reply failed for the caller: their budget is
+// spent, or the LLM is unavailable.
+func AnswerError(err error) string {
+	if errors.Is(err, llm.ErrBudgetExceeded) {
+		return err.Error()
+	}
+	return "LLM unavailable"
+}
+
+// Reply has the pipeline's LLM answer prompt from the gathered context for
+// caller, handing each piece of the answer to onDelta (when not nil) as it
+// arrives.
+func (p *Pipeline) Reply(ctx context.Context, caller Caller, prompt, gathered string, onDelta func(string)) (string, error) {
+	if caller.RequestID != "" && logging.RequestID(ctx) == "" {
+		ctx = logging.WithRequestID(ctx, caller.RequestID)
+	}
+	resp, err := p.LLM.Stream(ctx, llm.Request{
+		Feature:   "query",
+		Workspace: caller.Workspace,
+		UserID:    caller.UserID,
+		System:    answerInstructions + "\n\n" + gathered,
+		Messages:  []llm.Message{{Role: llm.RoleUser, Content: prompt}},
+	}, onDelta)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
@@ -0,0 +1,44 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source is an item the context cites as [N].
+type Source struct {
+	N    int    `json:"n"`
+	Tool string `json:"tool"`
+	URL  string `json:"url"`
+}
+
+// citer numbers the URLs the tools list, in the order they first appear,
+// so an item found by several tools keeps one number.
+type citer struct {
+	sources []Source
+	seen    map[string]int
+}
+
+// cite appends [N] to each line of text listing a URL (the MCP server's
+// "URL: ..." lines) and records the sources.
+func (c *citer) cite(tool, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		_, url, ok := strings.Cut(line, "URL: ")
+		url = strings.TrimSpace(url)
+		if !ok || !strings.Contains(url, "://") {
+			continue
+		}
+		n, ok := c.seen[url]
+		if !ok {
+			if c.seen == nil {
+				c.seen = make(map[string]int)
+			}
+			n = len(c.sources) + 1
+			c.seen[url] = n
+			c.sources = append(c.sources, Source{N: n, Tool: tool, URL: url})
+		}
+		lines[i] = fmt.Sprintf("%s [%d]", strings.TrimRight(line, " "), n)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,59 @@
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	recentWords = regexp.MustCompile(`\b(new|latest|recent|recently|today|lately|this week)\b`)
+	// "past 3 days", "last 12 hours", "last week"
+	recentPeriod  = regexp.MustCompile(`\b(?:past|last)\s+(\d+\s+)?(hour|day|week)s?\b`)
+	progressWords = regexp.MustCompile(`\b(progress|how am i doing|have i learned|have i learnt|my learning)\b`)
+)
+
+// progressTopics are the topics learning progress is tracked for, with the
+// words that name them.
+var progressTopics = []struct {
+	topic string
+	words *regexp.Regexp
+}{
+	{"golang", regexp.MustCompile(`\b(go|golang)\b`)},
+	{"blockchain", regexp.MustCompile(`\b(blockchains?|cosmos|ibc|tendermint|celestia)\b`)},
+	{"cryptography", regexp.MustCompile(`\b(cryptography|crypto|encryption|signatures?)\b`)},
+	{"kubernetes", regexp.MustCompile(`\b(kubernetes|k8s)\b`)},
+}
+
+// recentHours reports whether prompt, in lower case, asks what is new, and
+// over how many hours.
+func recentHours(prompt string) (int, bool) {
+	if m := recentPeriod.FindStringSubmatch(prompt); m != nil {
+		n := 1
+		if v, err := strconv.Atoi(strings.TrimSpace(m[1])); err == nil && v > 0 {
+			n = v
+		}
+		return n * map[string]int{"hour": 1, "day": 24, "week": 24 * 7}[m[2]], true
+	}
+	if m := recentWords.FindString(prompt); m != "" {
+		if m == "this week" {
+			return 24 * 7, true
+		}
+		return 24, true
+	}
+	return 0, false
+}
+
+// progressTopic returns the topic whose progress prompt, in lower case,
+// asks about, or "" when it does not.
+func progressTopic(prompt string) string {
+	if !progressWords.MatchString(prompt) {
+		return ""
+	}
+	for _, t := range progressTopics {
+		if t.words.MatchString(prompt) {
+			return t.topic
+		}
+	}
+	return ""
+}
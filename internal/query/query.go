@@ -0,0 +1,233 @@
+// Package query answers a question from the MCP server's tools. Steps
+// picks the tools the question calls for, Run calls them and assembles
+// their output into one context block, numbering the sources it cites, and
+// Ask also has the configured LLM, when there is one, answer from it.
+// The gateway's /api/v1/query returns the whole answer in one response; the
+// ws service streams each tool's output to the client as it arrives, then
+// the assembled context.
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"selin/internal/clients"
+	"selin/internal/llm"
+	"selin/internal/logging"
+	"selin/internal/tokenizer"
+)
+
+// Headers carrying the caller to the MCP server.
+const (
+	WorkspaceHeader = clients.WorkspaceHeader
+	UserHeader      = clients.UserHeader
+)
+
+// ErrNoContext is returned when no step produced any context.
+var ErrNoContext = errors.New("no tool returned context for the question")
+
+// Step is one tool call made for a question.
+type Step struct {
+	Tool      string
+	Arguments map[string]interface{}
+}
+
+// Result is the output of one step.
+type Result struct {
+	Tool    string `json:"tool"`
+	Text    string `json:"text"`
+	IsError bool   `json:"is_error,omitempty"`
+}
+
+// Steps returns the tool calls made for prompt, in order:
+//
+//   - search_content for the most relevant content, without copies of the
+//     same item, always
+//   - get_recent_content when the prompt asks what is new, over the period
+//     it names ("past 3 days", "this week"; a day by default)
+//   - get_learning_progress when it asks about the user's progress in a
+//     topic it names
+//   - get_related_concepts for the concepts around the prompt, always
+func Steps(prompt string) []Step {
+	steps := []Step{
+		{Tool: "search_content", Arguments: map[string]interface{}{"query": prompt, "limit": 5, "collapse_duplicates": true}},
+	}
+	lower := strings.ToLower(prompt)
+	if hours, ok := recentHours(lower); ok {
+		steps = append(steps, Step{Tool: "get_recent_content", Arguments: map[string]interface{}{"hours": hours}})
+	}
+	if topic := progressTopic(lower); topic != "" {
+		steps = append(steps, Step{Tool: "get_learning_progress", Arguments: map[string]interface{}{"topic": topic}})
+	}
+	return append(steps, Step{Tool: "get_related_concepts", Arguments: map[string]interface{}{"concept": prompt}})
+}
+
+// Caller identifies who a question is asked for.
+type Caller struct {
+	Workspace string
+	UserID    string
+	RequestID string
+}
+
+// Pipeline runs the steps against the MCP server at BaseURL.
+type Pipeline struct {
+	BaseURL string
+	Client  *http.Client
+	// LLM answers from the assembled context; nil for none
+	LLM *llm.Client
+}
+
+// New returns a pipeline calling the MCP server at base and answering with
+// the process's LLM, if one is configured.
+func New(base string) *Pipeline {
+	return &Pipeline{BaseURL: strings.TrimSuffix(base, "/"), Client: clients.NewHTTPClient(30 * time.Second), LLM: llm.Default()}
+}
+
+// Run calls each step in order, handing every result to emit (when not nil)
+// as soon as it arrives, and returns the context assembled from them. A
+// step that fails is emitted as an error and left out of the context; Run
+// only fails when none of them produced any.
+func (p *Pipeline) Run(ctx context.Context, caller Caller, prompt string, emit func(Result)) (string, error) {
+	return p.RunWithin(ctx, caller, prompt, 0, emit)
+}
+
+// RunWithin is Run with the assembled context kept to maxTokens tokens, 0
+// for no limit. Each step asks for an equal share of them.
+func (p *Pipeline) RunWithin(ctx context.Context, caller Caller, prompt string, maxTokens int, emit func(Result)) (string, error) {
+	answer, err := p.run(ctx, caller, prompt, maxTokens, emit)
+	if err != nil {
+		return "", err
+	}
+	return answer.Context, nil
+}
+
+// Answer is the outcome of a question.
+type Answer struct {
+	// Context is the assembled output of the tools, citing Sources as [n]
+	Context string `json:"context"`
+	// Answer is the LLM's answer from Context, empty without an LLM
+	Answer  string   `json:"answer,omitempty"`
+	Sources []Source `json:"sources"`
+	Steps   []Result `json:"steps"`
+}
+
+// Ask runs the steps like RunWithin and, when withAnswer is set and an LLM
+// is configured, has it answer prompt from the assembled context. An LLM
+// failure is returned along with the answer without it, so callers can
+// still use the context.
+func (p *Pipeline) Ask(ctx context.Context, caller Caller, prompt string, maxTokens int, withAnswer bool) (*Answer, error) {
+	answer, err := p.run(ctx, caller, prompt, maxTokens, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !withAnswer || p.LLM == nil {
+		return answer, nil
+	}
+	answer.Answer, err = p.Reply(ctx, caller, prompt, answer.Context, nil)
+	return answer, err
+}
+
+func (p *Pipeline) run(ctx context.Context, caller Caller, prompt string, maxTokens int, emit func(Result)) (*Answer, error) {
+	steps := Steps(prompt)
+	if maxTokens > 0 {
+		for _, step := range steps {
+			step.Arguments["max_tokens"] = max(maxTokens/len(steps), 1)
+		}
+	}
+	var results []Result
+	var cite citer
+	for _, step := range steps {
+		res, err := p.call(ctx, caller, step)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			res = Result{Tool: step.Tool, Text: err.Error(), IsError: true}
+		}
+		if !res.IsError {
+			res.Text = cite.cite(res.Tool, res.Text)
+		}
+		if emit != nil {
+			emit(res)
+		}
+		results = append(results, res)
+	}
+	assembled := Assemble(results)
+	if assembled == "" {
+		return nil, ErrNoContext
+	}
+	if maxTokens > 0 {
+		// The section headings are not part of any step's share
+		assembled = tokenizer.Truncate(tokenizer.Default(), assembled, maxTokens)
+	}
+	sources := cite.sources
+	if sources == nil {
+		sources = []Source{}
+	}
+	return &Answer{Context: assembled, Sources: sources, Steps: results}, nil
+}
+
+// Assemble joins the successful results into one markdown document, a
+// section per tool.
+func Assemble(results []Result) string {
+	var sections []string
+	for _, res := range results {
+		if res.IsError || strings.TrimSpace(res.Text) == "" {
+			continue
+		}
+		sections = append(sections, fmt.Sprintf("## %s\n\n%s", res.Tool, strings.TrimSpace(res.Text)))
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// mcpResponse is the part of the MCP server's /mcp/call response used here.
+type mcpResponse struct {
+	Content []struct {
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+func (p *Pipeline) call(ctx context.Context, caller Caller, step Step) (Result, error) {
+	body, err := json.Marshal(map[string]interface{}{"name": step.Tool, "arguments": step.Arguments})
+	if err != nil {
+		return Result{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/mcp/call", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	clients.Vouch(req.Header)
+	if caller.Workspace != "" {
+		req.Header.Set(WorkspaceHeader, caller.Workspace)
+	}
+	if caller.UserID != "" {
+		req.Header.Set(UserHeader, caller.UserID)
+	}
+	if caller.RequestID != "" {
+		req.Header.Set(logging.RequestIDHeader, caller.RequestID)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s failed: %v", step.Tool, err)
+	}
+	defer resp.Body.Close()
+	var out mcpResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&out); err != nil {
+		return Result{}, fmt.Errorf("%s failed: %s", step.Tool, resp.Status)
+	}
+	texts := make([]string, 0, len(out.Content))
+	for _, c := range out.Content {
+		texts = append(texts, c.Text)
+	}
+	return Result{Tool: step.Tool, Text: strings.Join(texts, "\n"), IsError: out.IsError}, nil
+}
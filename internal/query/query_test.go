@@ -0,0 +1,197 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"selin/internal/llm"
+	"selin/internal/tokenizer"
+)
+
+// fakeMCP answers /mcp/call with text per tool, as an error for tools in
+// failing.
+func fakeMCP(t *testing.T, text map[string]string, failing ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get(WorkspaceHeader) != "team-a" {
+			t.Errorf("Expected the caller's workspace, got %q", r.Header.Get(WorkspaceHeader))
+		}
+		isError := false
+		for _, name := range failing {
+			isError = isError || name == req.Name
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": text[req.Name]}},
+			"isError": isError,
+		})
+	}))
+}
+
+func TestRunStreamsEachStep(t *testing.T) {
+	srv := fakeMCP(t, map[string]string{
+		"search_content":       "Found 1 results for 'tendermint'",
+		"get_related_concepts": "Concept 'tendermint' not found",
+	}, "get_related_concepts")
+	defer srv.Close()
+
+	var emitted []Result
+	got, err := New(srv.URL).Run(context.Background(), Caller{Workspace: "team-a"}, "tendermint", func(res Result) {
+		emitted = append(emitted, res)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 2 || emitted[0].Tool != "search_content" || !emitted[1].IsError {
+		t.Errorf("Expected both steps emitted in order, the second as an error, got %+v", emitted)
+	}
+	if got != "## search_content\n\nFound 1 results for 'tendermint'" {
+		t.Errorf("Expected only the successful step in the context, got %q", got)
+	}
+}
+
+func TestRunWithoutContext(t *testing.T) {
+	srv := fakeMCP(t, map[string]string{}, "search_content", "get_related_concepts")
+	defer srv.Close()
+
+	if _, err := New(srv.URL).Run(context.Background(), Caller{Workspace: "team-a"}, "x", nil); err != ErrNoContext {
+		t.Errorf("Expected ErrNoContext, got %v", err)
+	}
+}
+
+func TestRunReportsUnreachableServer(t *testing.T) {
+	srv := fakeMCP(t, nil)
+	srv.Close()
+
+	var emitted []Result
+	_, err := New(srv.URL).Run(context.Background(), Caller{}, "x", func(res Result) { emitted = append(emitted, res) })
+	if err != ErrNoContext {
+		t.Errorf("Expected ErrNoContext, got %v", err)
+	}
+	if len(emitted) != 2 || !emitted[0].IsError || !strings.Contains(emitted[0].Text, "search_content failed") {
+		t.Errorf("Expected each failed call emitted, got %+v", emitted)
+	}
+}
+
+func TestRunWithinSharesTheBudget(t *testing.T) {
+	var budgets []float64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		budgets = append(budgets, req.Arguments["max_tokens"].(float64))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": strings.Repeat("word ", 100)}},
+		})
+	}))
+	defer srv.Close()
+
+	got, err := New(srv.URL).RunWithin(context.Background(), Caller{}, "x", 60, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(budgets) != 2 || budgets[0] != 30 || budgets[1] != 30 {
+		t.Errorf("Expected each step asked for half the budget, got %v", budgets)
+	}
+	if n := tokenizer.Default().Count(got); n > 60 {
+		t.Errorf("Expected the context kept to 60 tokens, got %d", n)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   []string
+		args   map[string]interface{}
+	}{
+		{"tendermint consensus", []string{"search_content", "get_related_concepts"}, nil},
+		{"what's new in cosmos?", []string{"search_content", "get_recent_content", "get_related_concepts"}, map[string]interface{}{"hours": 24}},
+		{"posts from the past 3 days", []string{"search_content", "get_recent_content", "get_related_concepts"}, map[string]interface{}{"hours": 72}},
+		{"anything this week", []string{"search_content", "get_recent_content", "get_related_concepts"}, map[string]interface{}{"hours": 168}},
+		{"How is my progress in Go?", []string{"search_content", "get_learning_progress", "get_related_concepts"}, map[string]interface{}{"topic": "golang"}},
+		// No topic named, so no progress to report
+		{"track my progress", []string{"search_content", "get_related_concepts"}, nil},
+	}
+	for _, tt := range tests {
+		steps := Steps(tt.prompt)
+		var tools []string
+		for _, s := range steps {
+			tools = append(tools, s.Tool)
+			for k, v := range tt.args {
+				if _, ok := s.Arguments[k]; ok && s.Arguments[k] != v {
+					t.Errorf("%q: %s %s = %v, want %v", tt.prompt, s.Tool, k, s.Arguments[k], v)
+				}
+			}
+		}
+		if strings.Join(tools, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: steps %v, want %v", tt.prompt, tools, tt.want)
+		}
+	}
+}
+
+func TestRunCitesSources(t *testing.T) {
+	srv := fakeMCP(t, map[string]string{
+		"search_content":       "1. IBC\n   • URL: https://a.example/ibc\n2. CometBFT\n   • URL: https://b.example/comet",
+		"get_related_concepts": "Seen in\n   • URL: https://b.example/comet",
+	})
+	defer srv.Close()
+
+	answer, err := New(srv.URL).Ask(context.Background(), Caller{Workspace: "team-a"}, "tendermint", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answer.Sources) != 2 || answer.Sources[1] != (Source{N: 2, Tool: "search_content", URL: "https://b.example/comet"}) {
+		t.Errorf("Expected each URL numbered once, got %+v", answer.Sources)
+	}
+	if !strings.Contains(answer.Context, "URL: https://a.example/ibc [1]") || strings.Count(answer.Context, "[2]") != 2 {
+		t.Errorf("Expected the context to cite both sources, got %q", answer.Context)
+	}
+	if answer.Answer != "" || len(answer.Steps) != 2 {
+		t.Errorf("Expected the steps and no answer, got %+v", answer)
+	}
+}
+
+func TestAskAnswersWithTheLLM(t *testing.T) {
+	srv := fakeMCP(t, map[string]string{"search_content": "1. IBC\n   • URL: https://a.example/ibc"})
+	defer srv.Close()
+	var system string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		system = req.Messages[0].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": " IBC connects chains [1]. "}}},
+		})
+	}))
+	defer server.Close()
+	p := New(srv.URL)
+	p.LLM = llm.New(&llm.OpenAI{URL: server.URL, HTTP: http.DefaultClient})
+
+	answer, err := p.Ask(context.Background(), Caller{Workspace: "team-a"}, "what is ibc", 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Answer != "IBC connects chains [1]." {
+		t.Errorf("Expected the LLM's answer, got %q", answer.Answer)
+	}
+	if !strings.Contains(system, "https://a.example/ibc [1]") {
+		t.Errorf("Expected the cited context sent to the LLM, got %q", system)
+	}
+
+	server.Close()
+	answer, err = p.Ask(context.Background(), Caller{Workspace: "team-a"}, "what is ibc", 0, true)
+	if err == nil || answer == nil || answer.Context == "" || answer.Answer != "" {
+		t.Errorf("Expected the context along with the LLM's failure, got %+v, %v", answer, err)
+	}
+}
@@ -0,0 +1,402 @@
+// Package ratelimit enforces sliding-window request limits shared by every
+// replica through Redis. The gateway limits API requests with it and the
+// MCP server limits tool calls per caller and tool.
+//
+// Identities in the Redis allowlist are never limited and those in the
+// denylist are always refused, whatever window they are checked against.
+// While Redis is unreachable a fallback mode decides instead: an
+// in-process token bucket (limits then apply per replica), letting every
+// request through, or refusing every request.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Fallback modes applied while Redis is unreachable.
+const (
+	FallbackLocal  = "local"  // enforce limits with an in-process token bucket
+	FallbackOpen   = "open"   // allow every request
+	FallbackClosed = "closed" // reject every request
+)
+
+// RetryInterval is how long to skip Redis after a failed check before
+// probing it again.
+const RetryInterval = 5 * time.Second
+
+// Redis sets holding identities exempt from, or blocked by, rate limiting.
+const (
+	AllowlistKey = "rate_limit:allowlist"
+	DenylistKey  = "rate_limit:denylist"
+)
+
+var (
+	// ErrUnavailable is returned while Redis is down in FallbackClosed mode.
+	ErrUnavailable = errors.New("rate limiter unavailable")
+	// ErrBlocked is returned for denylisted identities.
+	ErrBlocked = errors.New("identity is denylisted")
+)
+
+// FallbackFromEnv returns RATE_LIMIT_FALLBACK, defaulting to FallbackLocal.
+func FallbackFromEnv() string {
+	fallback := os.Getenv("RATE_LIMIT_FALLBACK")
+	switch fallback {
+	case FallbackLocal, FallbackOpen, FallbackClosed:
+	case "":
+		fallback = FallbackLocal
+	default:
+		slog.Warn("unknown RATE_LIMIT_FALLBACK", "value", fallback, "using", FallbackLocal)
+		fallback = FallbackLocal
+	}
+	return fallback
+}
+
+type Limiter struct {
+	client   *redis.Client
+	limit    int
+	window   time.Duration
+	fallback string
+	local    *localLimiter
+	seq      atomic.Uint64 // disambiguates members recorded in the same microsecond
+
+	// OnDegrade, when set, is called with true when Redis becomes
+	// unreachable and with false when it answers again.
+	OnDegrade func(degraded bool)
+
+	mu         sync.Mutex
+	degraded   bool
+	retryRedis time.Time
+}
+
+// New returns a limiter allowing limit requests per window by default.
+func New(client *redis.Client, limit int, window time.Duration, fallback string) *Limiter {
+	return &Limiter{
+		client:   client,
+		limit:    limit,
+		window:   window,
+		fallback: fallback,
+		local:    newLocalLimiter(window),
+	}
+}
+
+// Limit returns the default number of requests allowed per window.
+func (l *Limiter) Limit() int {
+	return l.limit
+}
+
+// Allow checks a request by identity against the window kept under key,
+// allowing limit requests per window, or the default limit when limit is
+// 0. Keys let one identity have separate windows, such as one per tool.
+// When Redis is unavailable the fallback decides instead, and the limiter
+// reports itself as degraded until Redis answers again. The allow and deny
+// lists live in Redis too, so they are not consulted while degraded.
+func (l *Limiter) Allow(ctx context.Context, key, identity string, limit int) (bool, error) {
+	if limit <= 0 {
+		limit = l.limit
+	}
+
+	if !l.shouldTryRedis() {
+		return l.fallbackAllow(key, limit)
+	}
+
+	allowed, err := l.redisAllow(ctx, key, identity, limit)
+	if errors.Is(err, ErrBlocked) {
+		l.markHealthy()
+		return false, err
+	}
+	if err != nil {
+		l.markDegraded(err)
+		return l.fallbackAllow(key, limit)
+	}
+
+	l.markHealthy()
+	return allowed, nil
+}
+
+// slidingWindowScript consults the deny and allow lists, then trims the
+// window, checks the count and records the request in one atomic step, so
+// concurrent requests cannot all pass the check before any of them is added,
+// and denied requests consume no quota.
+//
+// KEYS[1] = window key, KEYS[2] = allowlist, KEYS[3] = denylist
+// ARGV[1] = now (microseconds), ARGV[2] = window (microseconds),
+// ARGV[3] = limit, ARGV[4] = unique member for this request,
+// ARGV[5] = identity
+//
+// Returns 1 when allowed, 0 when over the limit, 2 when allowlisted and
+// -1 when denylisted.
+var slidingWindowScript = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[3], ARGV[5]) == 1 then
+	return -1
+end
+if redis.call('SISMEMBER', KEYS[2], ARGV[5]) == 1 then
+	return 2
+end
+
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+if redis.call('ZCARD', key) >= limit then
+	return 0
+end
+
+redis.call('ZADD', key, now, ARGV[4])
+redis.call('PEXPIRE', key, math.ceil(window / 1000))
+return 1
+`)
+
+func windowKey(key string) string {
+	return fmt.Sprintf("rate_limit:%s", key)
+}
+
+func (l *Limiter) redisAllow(ctx context.Context, key, identity string, limit int) (bool, error) {
+	// Microseconds keep scores exactly representable as Redis doubles
+	now := time.Now().UnixMicro()
+	member := fmt.Sprintf("%d-%d", now, l.seq.Add(1))
+
+	res, err := slidingWindowScript.Run(ctx, l.client, []string{windowKey(key), AllowlistKey, DenylistKey},
+		now, l.window.Microseconds(), limit, member, identity).Int()
+	if err != nil {
+		return false, fmt.Errorf("rate limit check failed: %w", err)
+	}
+
+	if res == -1 {
+		return false, ErrBlocked
+	}
+	return res > 0, nil
+}
+
+func (l *Limiter) fallbackAllow(key string, limit int) (bool, error) {
+	switch l.fallback {
+	case FallbackOpen:
+		return true, nil
+	case FallbackClosed:
+		return false, ErrUnavailable
+	default:
+		return l.local.Allow(key, limit, time.Now()), nil
+	}
+}
+
+func (l *Limiter) shouldTryRedis() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.degraded || !time.Now().Before(l.retryRedis)
+}
+
+func (l *Limiter) markDegraded(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.degraded {
+		slog.Error("Redis rate limiting unavailable, falling back", "mode", l.fallback, "error", err)
+		if l.OnDegrade != nil {
+			l.OnDegrade(true)
+		}
+	}
+	l.degraded = true
+	l.retryRedis = time.Now().Add(RetryInterval)
+}
+
+func (l *Limiter) markHealthy() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.degraded {
+		slog.Info("Redis rate limiting recovered")
+		if l.OnDegrade != nil {
+			l.OnDegrade(false)
+		}
+	}
+	l.degraded = false
+}
+
+// Mode reports how limits are currently enforced: "redis" when the shared
+// window is in use, otherwise "degraded:<fallback>".
+func (l *Limiter) Mode() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.degraded {
+		return "degraded:" + l.fallback
+	}
+	return "redis"
+}
+
+// listKey maps a list name from the admin API to its Redis set.
+func listKey(list string) (string, bool) {
+	switch list {
+	case "allowlist":
+		return AllowlistKey, true
+	case "denylist":
+		return DenylistKey, true
+	}
+	return "", false
+}
+
+func (l *Limiter) AddToList(ctx context.Context, list, identity string) error {
+	key, ok := listKey(list)
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+	return l.client.SAdd(ctx, key, identity).Err()
+}
+
+func (l *Limiter) RemoveFromList(ctx context.Context, list, identity string) error {
+	key, ok := listKey(list)
+	if !ok {
+		return fmt.Errorf("unknown list %q", list)
+	}
+	return l.client.SRem(ctx, key, identity).Err()
+}
+
+func (l *Limiter) ListEntries(ctx context.Context, list string) ([]string, error) {
+	key, ok := listKey(list)
+	if !ok {
+		return nil, fmt.Errorf("unknown list %q", list)
+	}
+	return l.client.SMembers(ctx, key).Result()
+}
+
+// Reset clears the window kept under key in Redis and its local bucket.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	l.local.mu.Lock()
+	delete(l.local.buckets, key)
+	l.local.mu.Unlock()
+	return l.client.Del(ctx, windowKey(key)).Err()
+}
+
+// Forget removes every trace of identity: its windows, whichever key they
+// are kept under ("<identity>", "<workspace>:<identity>" or
+// "mcp:<tool>:...<identity>"), its local buckets and its allow and deny
+// list entries. It returns how many Redis keys and list entries it
+// deleted.
+func (l *Limiter) Forget(ctx context.Context, identity string) (int, error) {
+	suffix := ":" + identity
+	l.local.mu.Lock()
+	for key := range l.local.buckets {
+		if key == identity || strings.HasSuffix(key, suffix) {
+			delete(l.local.buckets, key)
+		}
+	}
+	l.local.mu.Unlock()
+
+	var keys []string
+	for _, pattern := range []string{windowKey(globEscape(identity)), windowKey("*" + globEscape(suffix))} {
+		iter := l.client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			if key := iter.Val(); key != AllowlistKey && key != DenylistKey {
+				keys = append(keys, key)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return 0, err
+		}
+	}
+	deleted := 0
+	if len(keys) > 0 {
+		n, err := l.client.Del(ctx, keys...).Result()
+		if err != nil {
+			return 0, err
+		}
+		deleted += int(n)
+	}
+	for _, list := range []string{AllowlistKey, DenylistKey} {
+		n, err := l.client.SRem(ctx, list, identity).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+	return deleted, nil
+}
+
+// globEscape quotes the characters SCAN MATCH patterns treat specially.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (l *Limiter) Close() error {
+	return l.client.Close()
+}
+
+// localLimiter is a per-key token bucket kept in process memory. It is
+// only consulted while Redis is down, so limits apply per replica.
+type localLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	window    time.Duration
+	lastSweep time.Time
+}
+
+// tokenBucket holds up to capacity tokens and refills all of them over
+// the window.
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	last     time.Time
+}
+
+func newLocalLimiter(window time.Duration) *localLimiter {
+	return &localLimiter{
+		buckets: make(map[string]*tokenBucket),
+		window:  window,
+	}
+}
+
+func (b *tokenBucket) refilled(now time.Time, window time.Duration) float64 {
+	return b.tokens + now.Sub(b.last).Seconds()*b.capacity/window.Seconds()
+}
+
+func (l *localLimiter) Allow(key string, limit int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit), last: now}
+		l.buckets[key] = b
+	}
+	b.capacity = float64(limit)
+
+	b.tokens = min(b.refilled(now, l.window), b.capacity)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops buckets idle long enough to have refilled completely, so the
+// map does not grow with every identity seen during an outage.
+func (l *localLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.refilled(now, l.window) >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
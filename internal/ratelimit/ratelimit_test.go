@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestLimiter(t *testing.T, limit int) (*Limiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	l := New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), limit, time.Minute, FallbackLocal)
+	t.Cleanup(func() { l.Close() })
+	return l, mr
+}
+
+func TestAllowKeepsWindowsPerKey(t *testing.T) {
+	l, mr := newTestLimiter(t, 2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, err := l.Allow(ctx, "mcp:search_content:alice", "alice", 0); err != nil || !ok {
+			t.Fatalf("request %d: got %v, %v", i+1, ok, err)
+		}
+	}
+	if ok, _ := l.Allow(ctx, "mcp:search_content:alice", "alice", 0); ok {
+		t.Error("third request should be limited")
+	}
+	if ok, _ := l.Allow(ctx, "mcp:generate_quiz:alice", "alice", 0); !ok {
+		t.Error("another key should have its own window")
+	}
+	if !mr.Exists("rate_limit:mcp:search_content:alice") {
+		t.Error("expected the window under rate_limit:<key>")
+	}
+}
+
+func TestAllowTakesLimitPerCall(t *testing.T) {
+	l, _ := newTestLimiter(t, 10)
+	ctx := context.Background()
+
+	if ok, _ := l.Allow(ctx, "quiz", "alice", 1); !ok {
+		t.Fatal("first request should be allowed")
+	}
+	if ok, _ := l.Allow(ctx, "quiz", "alice", 1); ok {
+		t.Error("a limit of 1 should refuse the second request")
+	}
+}
+
+func TestDenylistAppliesToEveryKey(t *testing.T) {
+	l, _ := newTestLimiter(t, 10)
+	ctx := context.Background()
+
+	if err := l.AddToList(ctx, "denylist", "abuser"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := l.Allow(ctx, "mcp:search_content:abuser", "abuser", 0); ok || err != ErrBlocked {
+		t.Errorf("expected ErrBlocked, got %v, %v", ok, err)
+	}
+}
+
+func TestForgetRemovesEveryWindowOfIdentity(t *testing.T) {
+	l, mr := newTestLimiter(t, 10)
+	ctx := context.Background()
+
+	for _, key := range []string{"alice", "acme:alice", "mcp:search_content:alice", "mcp:generate_quiz:acme:alice", "malice", "bob"} {
+		if _, err := l.Allow(ctx, key, "alice", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.local.Allow("alice", 10, time.Now())
+	l.local.Allow("bob", 10, time.Now())
+	if err := l.AddToList(ctx, "allowlist", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := l.Forget(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("expected 4 windows and 1 list entry deleted, got %d", n)
+	}
+	for _, key := range []string{"alice", "acme:alice", "mcp:search_content:alice", "mcp:generate_quiz:acme:alice"} {
+		if mr.Exists(windowKey(key)) {
+			t.Errorf("expected %s to be deleted", windowKey(key))
+		}
+	}
+	for _, key := range []string{"malice", "bob"} {
+		if !mr.Exists(windowKey(key)) {
+			t.Errorf("expected %s to be kept", windowKey(key))
+		}
+	}
+	if entries, _ := l.ListEntries(ctx, "allowlist"); len(entries) != 0 {
+		t.Errorf("expected alice off the allowlist, got %v", entries)
+	}
+	if _, ok := l.local.buckets["alice"]; ok {
+		t.Error("expected the local bucket to be dropped")
+	}
+	if _, ok := l.local.buckets["bob"]; !ok {
+		t.Error("expected other local buckets to be kept")
+	}
+}
+
+func TestForgetEscapesPatterns(t *testing.T) {
+	l, mr := newTestLimiter(t, 10)
+	ctx := context.Background()
+
+	if _, err := l.Allow(ctx, "bob", "bob", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Forget(ctx, "*"); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists(windowKey("bob")) {
+		t.Error("a * identity must not match other identities")
+	}
+}
+
+func TestFallbackFromEnv(t *testing.T) {
+	for env, want := range map[string]string{"": FallbackLocal, "open": FallbackOpen, "closed": FallbackClosed, "bogus": FallbackLocal} {
+		t.Setenv("RATE_LIMIT_FALLBACK", env)
+		if got := FallbackFromEnv(); got != want {
+			t.Errorf("RATE_LIMIT_FALLBACK=%q: expected %s, got %s", env, want, got)
+		}
+	}
+}
+
+func TestLocalFallbackUsesCallLimit(t *testing.T) {
+	l := New(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"}), 10, time.Minute, FallbackLocal)
+	t.Cleanup(func() { l.Close() })
+	var degraded []bool
+	l.OnDegrade = func(d bool) { degraded = append(degraded, d) }
+
+	if ok, err := l.Allow(context.Background(), "quiz", "alice", 1); !ok || err != nil {
+		t.Fatalf("first request: got %v, %v", ok, err)
+	}
+	if ok, _ := l.Allow(context.Background(), "quiz", "alice", 1); ok {
+		t.Error("the local bucket should hold the call's limit")
+	}
+	if l.Mode() != "degraded:local" || len(degraded) != 1 || !degraded[0] {
+		t.Errorf("expected one degrade notification, got %s %v", l.Mode(), degraded)
+	}
+}
+
+func TestLocalLimiterAllowsUpToCapacity(t *testing.T) {
+	l := newLocalLimiter(time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("user", 3, now) {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+	}
+	if l.Allow("user", 3, now) {
+		t.Error("request over capacity should be denied")
+	}
+	if !l.Allow("other", 3, now) {
+		t.Error("buckets should be independent per identity")
+	}
+}
+
+func TestLocalLimiterRefills(t *testing.T) {
+	l := newLocalLimiter(time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 60; i++ {
+		l.Allow("user", 60, now)
+	}
+	if l.Allow("user", 60, now) {
+		t.Fatal("bucket should be empty")
+	}
+	if !l.Allow("user", 60, now.Add(time.Second)) {
+		t.Error("one token should refill after a second")
+	}
+}
+
+func TestLocalLimiterSweepsIdleBuckets(t *testing.T) {
+	l := newLocalLimiter(time.Minute)
+	now := time.Now()
+
+	l.Allow("idle", 10, now)
+	l.Allow("active", 10, now.Add(2*time.Minute))
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket should have been swept")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("active bucket should be kept")
+	}
+}
@@ -0,0 +1,180 @@
+// Package rbac decides which roles may use gateway routes and MCP tools.
+//
+// There are three roles, each including the ones below it:
+//
+//	admin   everything
+//	editor  reads plus tools and routes that change data
+//	reader  read-only access
+//
+// A policy maps routes and tools to the least role that may use them. It is
+// loaded from the YAML file named by RBAC_POLICY_FILE (see config/rbac.yaml)
+// or, when that is unset, from DefaultPolicy.
+package rbac
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Role string
+
+const (
+	Reader Role = "reader"
+	Editor Role = "editor"
+	Admin  Role = "admin"
+)
+
+// Header carries the caller's role from the gateway to upstream services.
+const Header = "X-Role"
+
+var rank = map[Role]int{Reader: 1, Editor: 2, Admin: 3}
+
+// ParseRole validates a role name.
+func ParseRole(s string) (Role, bool) {
+	r := Role(strings.ToLower(strings.TrimSpace(s)))
+	_, ok := rank[r]
+	return r, ok
+}
+
+// Includes reports whether r grants everything need grants.
+func (r Role) Includes(need Role) bool {
+	return rank[r] > 0 && rank[r] >= rank[need]
+}
+
+func (r *Role) UnmarshalYAML(value *yaml.Node) error {
+	role, ok := ParseRole(value.Value)
+	if !ok {
+		return fmt.Errorf("line %d: unknown role %q", value.Line, value.Value)
+	}
+	*r = role
+	return nil
+}
+
+// Route requires Role for requests whose path starts with Path. An empty
+// Methods list matches every method.
+type Route struct {
+	Path    string   `yaml:"path"`
+	Methods []string `yaml:"methods"`
+	Role    Role     `yaml:"role"`
+}
+
+type Policy struct {
+	// DefaultRole is given to callers without an API key.
+	DefaultRole Role `yaml:"default_role"`
+	// Routes are matched longest path first; unmatched routes need admin.
+	Routes []Route `yaml:"routes"`
+	// Tools maps MCP tool names to the role they need; unlisted tools need
+	// DefaultToolRole.
+	Tools           map[string]Role `yaml:"tools"`
+	DefaultToolRole Role            `yaml:"default_tool_role"`
+}
+
+// DefaultPolicy keeps keyless access as it was before roles existed:
+// everything but administration.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		DefaultRole: Editor,
+		Routes: []Route{
+			{Path: "/api/v1/query", Role: Reader},
+			{Path: "/api/v1/recommendations", Role: Reader},
+			{Path: "/api/v1/dashboard", Role: Reader},
+			{Path: "/api/v1/content/interactions", Methods: []string{"POST"}, Role: Editor},
+			{Path: "/api/v1/content", Role: Reader},
+			{Path: "/api/v1/tags", Role: Reader},
+			{Path: "/api/v1/feedback", Role: Editor},
+			{Path: "/api/v1/goals", Methods: []string{"GET"}, Role: Reader},
+			{Path: "/api/v1/goals", Role: Editor},
+			{Path: "/api/v1/collections", Methods: []string{"GET"}, Role: Reader},
+			{Path: "/api/v1/collections", Role: Editor},
+			{Path: "/api/v1/preferences", Methods: []string{"GET"}, Role: Reader},
+			{Path: "/api/v1/preferences", Role: Editor},
+			{Path: "/api/v1/upload", Role: Editor},
+			{Path: "/api/v1/uploads", Role: Reader},
+			{Path: "/api/v1/ingest", Role: Editor},
+		},
+		Tools: map[string]Role{
+			"mark_as_read":        Editor,
+			"flag_for_review":     Editor,
+			"record_review":       Editor,
+			"submit_quiz_answers": Editor,
+			"set_learning_goal":   Editor,
+			"create_collection":   Editor,
+			"add_to_collection":   Editor,
+			"rate_result":         Editor,
+			"set_preferences":     Editor,
+			"rename_tag":          Admin,
+			"merge_tags":          Admin,
+			"delete_tag":          Admin,
+			"set_tag_alias":       Admin,
+		},
+		DefaultToolRole: Reader,
+	}
+}
+
+// Load reads a policy file. Omitted defaults fall back to DefaultPolicy's.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	if p.DefaultRole == "" {
+		p.DefaultRole = DefaultPolicy().DefaultRole
+	}
+	if p.DefaultToolRole == "" {
+		p.DefaultToolRole = DefaultPolicy().DefaultToolRole
+	}
+	for i, route := range p.Routes {
+		if route.Path == "" || route.Role == "" {
+			return nil, fmt.Errorf("invalid policy %s: route %d needs a path and a role", path, i+1)
+		}
+	}
+	return &p, nil
+}
+
+// FromEnv loads RBAC_POLICY_FILE, or returns DefaultPolicy when it is unset.
+func FromEnv() (*Policy, error) {
+	path := os.Getenv("RBAC_POLICY_FILE")
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+	return Load(path)
+}
+
+// RouteRole returns the role a request needs.
+func (p *Policy) RouteRole(method, path string) Role {
+	best, need := -1, Admin
+	for _, route := range p.Routes {
+		if !strings.HasPrefix(path, route.Path) || len(route.Path) <= best || !route.matchesMethod(method) {
+			continue
+		}
+		best, need = len(route.Path), route.Role
+	}
+	return need
+}
+
+func (route Route) matchesMethod(method string) bool {
+	if len(route.Methods) == 0 {
+		return true
+	}
+	for _, m := range route.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolRole returns the role an MCP tool needs.
+func (p *Policy) ToolRole(tool string) Role {
+	if role, ok := p.Tools[tool]; ok {
+		return role
+	}
+	return p.DefaultToolRole
+}
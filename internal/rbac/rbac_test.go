@@ -0,0 +1,78 @@
+package rbac
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		have, need Role
+		want       bool
+	}{
+		{Admin, Editor, true},
+		{Editor, Editor, true},
+		{Reader, Editor, false},
+		{Role("guest"), Reader, false},
+	}
+	for _, tt := range tests {
+		if got := tt.have.Includes(tt.need); got != tt.want {
+			t.Errorf("%s.Includes(%s) = %v, want %v", tt.have, tt.need, got, tt.want)
+		}
+	}
+}
+
+func TestRouteRole(t *testing.T) {
+	p := DefaultPolicy()
+	tests := []struct {
+		method, path string
+		want         Role
+	}{
+		{"POST", "/api/v1/query", Reader},
+		{"GET", "/api/v1/goals/123", Reader},
+		{"DELETE", "/api/v1/goals/123", Editor},
+		{"GET", "/api/v1/collections/123?format=markdown", Reader},
+		{"POST", "/api/v1/collections/123/items", Editor},
+		{"GET", "/api/v1/preferences", Reader},
+		{"PUT", "/api/v1/preferences", Editor},
+		{"POST", "/api/v1/upload/file", Editor},
+		{"GET", "/api/v1/uploads/123/download", Reader},
+		{"POST", "/api/v1/ingest/repo", Editor},
+		{"GET", "/api/v1/content/123", Reader},
+		{"GET", "/api/v1/content/interactions", Reader},
+		{"POST", "/api/v1/content/interactions", Editor},
+		{"POST", "/api/v1/feedback", Editor},
+		{"GET", "/api/v2/unknown", Admin},
+	}
+	for _, tt := range tests {
+		if got := p.RouteRole(tt.method, tt.path); got != tt.want {
+			t.Errorf("RouteRole(%s %s) = %s, want %s", tt.method, tt.path, got, tt.want)
+		}
+	}
+	if got := p.ToolRole("set_learning_goal"); got != Editor {
+		t.Errorf("Expected set_learning_goal to need editor, got %s", got)
+	}
+	if got := p.ToolRole("search_content"); got != Reader {
+		t.Errorf("Expected unlisted tools to need reader, got %s", got)
+	}
+}
+
+func TestLoadMatchesShippedPolicy(t *testing.T) {
+	p, err := Load("../../config/rbac.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, DefaultPolicy()) {
+		t.Errorf("config/rbac.yaml and DefaultPolicy differ:\n%+v\n%+v", p, DefaultPolicy())
+	}
+}
+
+func TestLoadRejectsUnknownRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbac.yaml")
+	os.WriteFile(path, []byte("tools:\n  search_content: superuser\n"), 0o600)
+	if _, err := Load(path); err == nil {
+		t.Error("Expected an unknown role to be rejected")
+	}
+}
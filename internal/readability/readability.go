@@ -0,0 +1,396 @@
+// Package readability extracts the article from a web page: its main
+// content as Markdown, without the navigation, sidebars, comments and ads
+// around it, and what the page's meta tags say about it.
+//
+// The main content is the page's <article> or <main> when it has one with
+// enough text, or else the element whose paragraphs hold the most text,
+// scored as Readability does. Headings, lists, quotes and code blocks are
+// kept as Markdown, so the article chunks by heading like any Markdown
+// document.
+package readability
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Article is what was extracted from a page.
+type Article struct {
+	Title string
+	// Text is the main content as Markdown
+	Text string
+	// Canonical is the page's canonical URL, from <link rel="canonical">
+	// or og:url
+	Canonical   string
+	Author      string
+	Published   time.Time
+	Description string
+	SiteName    string
+	// Language is the page's two-letter language code, when it declares one
+	Language string
+}
+
+// minArticleText is the least text an <article> or <main> must hold to be
+// taken as the main content without scoring.
+const minArticleText = 200
+
+// boilerplate matches the classes and IDs of elements around the content.
+var boilerplate = regexp.MustCompile(`(?i)(^|[\s_-])(nav|navbar|menu|footer|sidebar|comments?|share|sharing|social|advert|ads?|sponsored?|promo|cookies?|banner|related|recommended|subscribe|newsletter|breadcrumbs?|popup|modal|masthead)($|[\s_-])`)
+
+// removed are elements that are never content.
+var removed = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true,
+	atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+	atom.Iframe: true, atom.Svg: true, atom.Button: true, atom.Template: true,
+	atom.Select: true, atom.Input: true, atom.Img: true, atom.Picture: true,
+	atom.Video: true, atom.Audio: true, atom.Canvas: true, atom.Object: true,
+}
+
+// Extract reads a page and extracts its article.
+func Extract(r io.Reader) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTML: %v", err)
+	}
+	a := &Article{}
+	readMeta(doc, a)
+	prune(doc)
+	if body := find(doc, atom.Body); body != nil {
+		a.Text = render(mainContent(body))
+	}
+	if a.Title == "" {
+		if h1 := find(doc, atom.H1); h1 != nil {
+			a.Title = collapse(textContent(h1))
+		}
+	}
+	if a.Text == "" {
+		return nil, fmt.Errorf("no text found in the page")
+	}
+	return a, nil
+}
+
+// readMeta fills in what the page's head says about the article.
+func readMeta(doc *html.Node, a *Article) {
+	var title, ogTitle, ogURL, ogDescription, description string
+	walk(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Html:
+			if lang := attr(n, "lang"); len(lang) >= 2 {
+				a.Language = strings.ToLower(lang[:2])
+			}
+		case atom.Title:
+			if title == "" {
+				title = collapse(textContent(n))
+			}
+		case atom.Link:
+			if strings.EqualFold(attr(n, "rel"), "canonical") && a.Canonical == "" {
+				a.Canonical = attr(n, "href")
+			}
+		case atom.Meta:
+			name := strings.ToLower(attr(n, "property") + attr(n, "name") + attr(n, "itemprop"))
+			content := strings.TrimSpace(attr(n, "content"))
+			switch name {
+			case "og:title":
+				ogTitle = content
+			case "og:url":
+				ogURL = content
+			case "og:description":
+				ogDescription = content
+			case "description":
+				description = content
+			case "og:site_name":
+				a.SiteName = content
+			case "author", "article:author", "twitter:creator":
+				// article:author is often a profile URL
+				if a.Author == "" && !strings.Contains(content, "://") {
+					a.Author = content
+				}
+			case "article:published_time", "datepublished", "date", "pubdate", "dc.date", "dc.date.issued":
+				if a.Published.IsZero() {
+					a.Published = parseDate(content)
+				}
+			}
+		case atom.Time:
+			if a.Published.IsZero() && attr(n, "pubdate") != "" {
+				a.Published = parseDate(attr(n, "datetime"))
+			}
+		}
+		return true
+	})
+	a.Title = firstOf(ogTitle, title)
+	a.Description = firstOf(ogDescription, description)
+	if a.Canonical == "" {
+		a.Canonical = ogURL
+	}
+}
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", time.RFC1123, time.RFC1123Z}
+
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// prune removes the elements that are never content, and those whose
+// class or ID marks them as boilerplate.
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || c.Type == html.ElementNode && (removed[c.DataAtom] || isBoilerplate(c)) {
+			n.RemoveChild(c)
+		} else {
+			prune(c)
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Html, atom.Head, atom.Body, atom.Article, atom.Main:
+		return false
+	}
+	if strings.EqualFold(attr(n, "role"), "navigation") || strings.EqualFold(attr(n, "aria-hidden"), "true") {
+		return true
+	}
+	return boilerplate.MatchString(attr(n, "class")) || boilerplate.MatchString(attr(n, "id"))
+}
+
+// mainContent finds the element holding the article.
+func mainContent(body *html.Node) *html.Node {
+	var best *html.Node
+	bestLen := 0
+	walk(body, func(n *html.Node) bool {
+		if n.DataAtom == atom.Article || n.DataAtom == atom.Main || strings.EqualFold(attr(n, "role"), "main") {
+			if l := len(collapse(textContent(n))); l > bestLen {
+				best, bestLen = n, l
+			}
+		}
+		return true
+	})
+	if best != nil && bestLen >= minArticleText {
+		return best
+	}
+
+	// Score the parents of paragraphs by the text they hold, and the
+	// grandparents by half of it
+	scores := map[*html.Node]float64{}
+	walk(body, func(n *html.Node) bool {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre {
+			return true
+		}
+		text := collapse(textContent(n))
+		if len(text) < 25 || n.Parent == nil {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")) + float64(min(len(text)/100, 3))
+		scores[n.Parent] += score * (1 - linkDensity(n.Parent))
+		if gp := n.Parent.Parent; gp != nil {
+			scores[gp] += score / 2 * (1 - linkDensity(gp))
+		}
+		return false
+	})
+	best, bestScore := body, 0.0
+	for n, score := range scores {
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+// linkDensity is the share of n's text that is link text.
+func linkDensity(n *html.Node) float64 {
+	total := len(collapse(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	walk(n, func(c *html.Node) bool {
+		if c.DataAtom == atom.A {
+			linked += len(collapse(textContent(c)))
+			return false
+		}
+		return true
+	})
+	return float64(linked) / float64(total)
+}
+
+// renderer turns content into Markdown blocks.
+type renderer struct {
+	blocks []string
+	inline strings.Builder
+}
+
+func render(n *html.Node) string {
+	r := &renderer{}
+	r.children(n)
+	r.flush()
+	return strings.Join(r.blocks, "\n\n")
+}
+
+func (r *renderer) flush() {
+	if text := collapse(r.inline.String()); text != "" {
+		r.blocks = append(r.blocks, text)
+	}
+	r.inline.Reset()
+}
+
+func (r *renderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.node(c)
+	}
+}
+
+func (r *renderer) node(n *html.Node) {
+	if n.Type == html.TextNode {
+		r.inline.WriteString(n.Data)
+		return
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.flush()
+		if text := collapse(textContent(n)); text != "" {
+			level := int(n.Data[1] - '0')
+			r.blocks = append(r.blocks, strings.Repeat("#", level)+" "+text)
+		}
+	case atom.Pre:
+		r.flush()
+		if code := strings.Trim(textContent(n), "\n"); strings.TrimSpace(code) != "" {
+			r.blocks = append(r.blocks, "```"+codeLanguage(n)+"\n"+code+"\n```")
+		}
+	case atom.Code:
+		if text := textContent(n); strings.TrimSpace(text) != "" {
+			r.inline.WriteString("`" + strings.TrimSpace(text) + "`")
+		}
+	case atom.Br:
+		r.flush()
+	case atom.Ul, atom.Ol:
+		r.flush()
+		i := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom != atom.Li {
+				r.node(c)
+				continue
+			}
+			i++
+			marker := "- "
+			if n.DataAtom == atom.Ol {
+				marker = fmt.Sprintf("%d. ", i)
+			}
+			if item := render(c); item != "" {
+				r.blocks = append(r.blocks, marker+indent(item, strings.Repeat(" ", len(marker))))
+			}
+		}
+		r.flush()
+	case atom.Blockquote:
+		r.flush()
+		if quote := render(n); quote != "" {
+			r.blocks = append(r.blocks, "> "+indent(quote, "> "))
+		}
+	case atom.Td, atom.Th:
+		r.children(n)
+		r.inline.WriteString(" ")
+	case atom.A, atom.Span, atom.Em, atom.I, atom.Strong, atom.B, atom.Small, atom.Sub, atom.Sup,
+		atom.Abbr, atom.Mark, atom.Kbd, atom.Label, atom.Q, atom.S, atom.U, atom.Time, atom.Cite:
+		r.children(n)
+	default:
+		// Block elements: paragraphs, divs, sections, tables and the like
+		r.flush()
+		r.children(n)
+		r.flush()
+	}
+}
+
+// codeLanguage is the language a code block declares in a language-* or
+// lang-* class, on the <pre> or its <code>.
+func codeLanguage(pre *html.Node) string {
+	nodes := []*html.Node{pre}
+	if code := find(pre, atom.Code); code != nil {
+		nodes = append(nodes, code)
+	}
+	for _, n := range nodes {
+		for _, class := range strings.Fields(attr(n, "class")) {
+			for _, prefix := range []string{"language-", "lang-"} {
+				if lang, ok := strings.CutPrefix(class, prefix); ok {
+					return lang
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// indent indents every line after the first.
+func indent(text, prefix string) string {
+	return strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+// walk calls visit on n and its descendants, skipping the descendants of
+// nodes visit returns false for.
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if n.Type == html.ElementNode && !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, visit)
+	}
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found == nil && c.DataAtom == a {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
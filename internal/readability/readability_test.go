@@ -0,0 +1,94 @@
+package readability
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPage = `<!DOCTYPE html>
+<html lang="en-US">
+<head>
+  <title>Rollups explained | Example Blog</title>
+  <meta property="og:title" content="Rollups explained">
+  <meta name="description" content="How rollups post data to a DA layer.">
+  <meta name="author" content="Ada Lovelace">
+  <meta property="article:published_time" content="2026-03-14T09:30:00Z">
+  <meta property="og:site_name" content="Example Blog">
+  <link rel="canonical" href="https://blog.example.com/rollups">
+</head>
+<body>
+  <nav><a href="/">Home</a> <a href="/about">About</a></nav>
+  <div class="sidebar">Popular posts: <a href="/a">one</a>, <a href="/b">two</a></div>
+  <article>
+    <h1>Rollups explained</h1>
+    <p>A rollup executes transactions off chain, and posts the data, compressed, to a data availability layer.</p>
+    <h2>Posting blobs</h2>
+    <p>Blobs are submitted with <code>PayForBlobs</code>, which the sequencer signs.</p>
+    <pre><code class="language-go">func submit(blob []byte) error {
+	return client.Submit(blob)
+}</code></pre>
+    <ul><li>cheap data</li><li>fast finality</li></ul>
+    <div class="share-buttons">Share on <a href="#">X</a></div>
+  </article>
+  <footer>Copyright 2026</footer>
+  <script>track()</script>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	a, err := Extract(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != "Rollups explained" || a.Author != "Ada Lovelace" || a.SiteName != "Example Blog" || a.Language != "en" {
+		t.Errorf("Unexpected metadata %+v", a)
+	}
+	if a.Canonical != "https://blog.example.com/rollups" || a.Description != "How rollups post data to a DA layer." {
+		t.Errorf("Unexpected canonical URL or description %+v", a)
+	}
+	if !a.Published.Equal(time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected published date %v", a.Published)
+	}
+
+	for _, want := range []string{
+		"# Rollups explained",
+		"## Posting blobs",
+		"submitted with `PayForBlobs`, which",
+		"```go\nfunc submit(blob []byte) error {\n\treturn client.Submit(blob)\n}\n```",
+		"- cheap data\n\n- fast finality",
+	} {
+		if !strings.Contains(a.Text, want) {
+			t.Errorf("Expected the text to contain %q, got:\n%s", want, a.Text)
+		}
+	}
+	for _, unwanted := range []string{"Home", "Popular posts", "Share on", "Copyright", "track()"} {
+		if strings.Contains(a.Text, unwanted) {
+			t.Errorf("Expected %q to be left out, got:\n%s", unwanted, a.Text)
+		}
+	}
+}
+
+func TestExtractScoresPagesWithoutArticle(t *testing.T) {
+	page := `<html><body>
+		<div id="menu"><a href="/">Home</a></div>
+		<div class="links"><p><a href="/x">A link list that is long enough to count, with commas, and more</a></p></div>
+		<div class="post">
+			<p>The first paragraph of the post, long enough to be counted, with a comma or two, like this.</p>
+			<p>The second paragraph carries on, and it too has a few commas, so it scores.</p>
+		</div>
+	</body></html>`
+	a, err := Extract(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(a.Text, "The first paragraph") || strings.Contains(a.Text, "link list") {
+		t.Errorf("Expected the post's paragraphs, got:\n%s", a.Text)
+	}
+}
+
+func TestExtractRejectsEmptyPages(t *testing.T) {
+	if _, err := Extract(strings.NewReader(`<html><body><nav>Home</nav></body></html>`)); err == nil {
+		t.Error("Expected a page without text to be rejected")
+	}
+}
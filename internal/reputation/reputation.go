@@ -0,0 +1,148 @@
+// Package reputation scores authors by their track record: how relevant
+// their collected content was, and how often items of theirs were rated
+// useful (4 or 5 stars) when marked as read. Collectors weight the
+// relevance of new content by its author's reputation, so consistently
+// good authors rise and noisy ones sink.
+//
+// Scores are smoothed towards a neutral 0.5, so an author with one lucky
+// post is not treated as an expert; unknown authors get the neutral
+// weight of 1.
+package reputation
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+const (
+	// Neutral is the reputation of an author with no track record.
+	Neutral = 0.5
+	// priorWeight is how many neutral items and ratings every author starts
+	// with.
+	priorWeight = 5
+	// MinWeight and MaxWeight bound the factor reputation multiplies
+	// relevance by.
+	MinWeight = 0.8
+	MaxWeight = 1.2
+	// usefulRating is the lowest rating that counts as useful.
+	usefulRating = 4
+)
+
+// Stats is an author's track record in a workspace.
+type Stats struct {
+	Author   string `json:"author"`
+	Platform string `json:"source_platform"`
+	Items    int    `json:"items"`
+	// AvgRelevance is the mean relevance_score of the author's content.
+	AvgRelevance float64 `json:"avg_relevance"`
+	// Rated and Useful count the author's items rated when marked as
+	// read, and those rated useful.
+	Rated      int     `json:"rated_items"`
+	Useful     int     `json:"useful_items"`
+	Reputation float64 `json:"reputation"`
+}
+
+// Score is the reputation for a track record: the smoothed average
+// relevance and the smoothed share of useful ratings, equally weighted.
+func Score(items int, avgRelevance float64, rated, useful int) float64 {
+	relevance := (avgRelevance*float64(items) + Neutral*priorWeight) / float64(items+priorWeight)
+	usefulness := (float64(useful) + Neutral*priorWeight) / float64(rated+priorWeight)
+	return (relevance + usefulness) / 2
+}
+
+// Weight is the factor relevance is multiplied by for an author with
+// reputation r: MinWeight at 0, 1 at Neutral and MaxWeight at 1.
+func Weight(r float64) float64 {
+	r = max(0, min(1, r))
+	return MinWeight + (MaxWeight-MinWeight)*r
+}
+
+// anonymous authors have no track record to speak of.
+func anonymous(author string) bool {
+	switch strings.TrimSpace(author) {
+	case "", "[deleted]", "unknown":
+		return true
+	}
+	return false
+}
+
+// statsQuery aggregates authors' content; an item counts as useful when
+// its best rating is.
+const statsQuery = `
+	SELECT c.author, COALESCE(c.source_platform, ''), COUNT(*), COALESCE(AVG(c.relevance_score), 0),
+		COUNT(r.best), COUNT(*) FILTER (WHERE r.best >= $2)
+	FROM content_metadata c
+	LEFT JOIN (
+		SELECT content_id, MAX(rating) AS best FROM content_interactions
+		WHERE rating IS NOT NULL GROUP BY content_id
+	) r ON r.content_id = c.id
+	WHERE c.workspace_id = $1 AND c.author IS NOT NULL AND c.author NOT IN ('', '[deleted]', 'unknown')`
+
+func scanStats(rows *sql.Rows) ([]Stats, error) {
+	defer rows.Close()
+	var stats []Stats
+	for rows.Next() {
+		var s Stats
+		if err := rows.Scan(&s.Author, &s.Platform, &s.Items, &s.AvgRelevance, &s.Rated, &s.Useful); err != nil {
+			return nil, err
+		}
+		s.Reputation = Score(s.Items, s.AvgRelevance, s.Rated, s.Useful)
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// Lookup returns an author's track record on a platform. Authors without
+// content, and anonymous ones, have Neutral reputation.
+func Lookup(ctx context.Context, db *sql.DB, workspace, platform, author string) (Stats, error) {
+	none := Stats{Author: author, Platform: platform, Reputation: Neutral}
+	if anonymous(author) {
+		return none, nil
+	}
+	rows, err := db.QueryContext(ctx, statsQuery+`
+		AND c.source_platform = $3 AND c.author = $4
+		GROUP BY 1, 2`, workspace, usefulRating, platform, author)
+	if err != nil {
+		return none, err
+	}
+	stats, err := scanStats(rows)
+	if err != nil || len(stats) == 0 {
+		return none, err
+	}
+	return stats[0], nil
+}
+
+// Top returns the best reputed authors of content tagged topic, or of all
+// content when topic is empty. Reputation counts only their content on
+// the topic.
+func Top(ctx context.Context, db *sql.DB, workspace, topic string, limit int) ([]Stats, error) {
+	query := statsQuery
+	args := []interface{}{workspace, usefulRating}
+	if topic = strings.ToLower(strings.TrimSpace(topic)); topic != "" {
+		query += " AND $3 = ANY(c.tags)"
+		args = append(args, topic)
+	}
+	rows, err := db.QueryContext(ctx, query+" GROUP BY 1, 2", args...)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := scanStats(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Reputation != stats[j].Reputation {
+			return stats[i].Reputation > stats[j].Reputation
+		}
+		if stats[i].Items != stats[j].Items {
+			return stats[i].Items > stats[j].Items
+		}
+		return stats[i].Author < stats[j].Author
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
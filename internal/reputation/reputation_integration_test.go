@@ -0,0 +1,79 @@
+//go:build integration
+
+package reputation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration ./reputation (needs a Docker daemon)
+
+func TestReputationAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+
+	n := 0
+	add := func(author string, score float64, tags string, ratings ...int) {
+		t.Helper()
+		n++
+		var id string
+		err := db.QueryRow(`
+			INSERT INTO content_metadata (workspace_id, source_url, author, source_platform, tags, relevance_score)
+			VALUES ('default', $1, $2, 'reddit', string_to_array($3, ','), $4) RETURNING id`,
+			fmt.Sprintf("https://example.com/%d", n), author, tags, score).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rating := range ratings {
+			if _, err := db.Exec(`INSERT INTO content_interactions (content_id, rating) VALUES ($1, $2)`, id, rating); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i < 6; i++ {
+		add("expert", 0.9, "golang", 5, 2)
+		add("noisy", 0.2, "golang", 1)
+	}
+	add("newcomer", 1, "golang")
+	add("cosmonaut", 0.8, "cosmos", 5)
+	add("[deleted]", 1, "golang", 5)
+
+	expert, err := Lookup(ctx, db, "default", "reddit", "expert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rated twice per item, but each item counts once, by its best rating
+	if expert.Items != 6 || expert.Rated != 6 || expert.Useful != 6 {
+		t.Errorf("Unexpected stats: %+v", expert)
+	}
+	if expert.AvgRelevance < 0.89 || expert.AvgRelevance > 0.91 {
+		t.Errorf("Expected interactions not to skew the average relevance, got %v", expert.AvgRelevance)
+	}
+
+	if stranger, err := Lookup(ctx, db, "default", "reddit", "stranger"); err != nil || stranger.Reputation != Neutral {
+		t.Errorf("Expected an unknown author to be neutral, got %+v, %v", stranger, err)
+	}
+	if deleted, err := Lookup(ctx, db, "default", "reddit", "[deleted]"); err != nil || deleted.Items != 0 {
+		t.Errorf("Expected deleted authors to have no record, got %+v, %v", deleted, err)
+	}
+
+	top, err := Top(ctx, db, "default", "Golang", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range top {
+		names = append(names, s.Author)
+	}
+	if len(names) != 3 || names[0] != "expert" || names[1] != "newcomer" || names[2] != "noisy" {
+		t.Errorf("Expected expert, newcomer, noisy; got %v", names)
+	}
+
+	if top, err := Top(ctx, db, "default", "", 1); err != nil || len(top) != 1 || top[0].Author != "expert" {
+		t.Errorf("Expected the limit to keep the best author, got %+v, %v", top, err)
+	}
+}
@@ -0,0 +1,57 @@
+package reputation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	if got := Score(0, 0, 0, 0); got != Neutral {
+		t.Errorf("Expected an author without a record to be neutral, got %v", got)
+	}
+
+	// One great post barely moves the needle; a long record does
+	lucky := Score(1, 1, 1, 1)
+	proven := Score(50, 0.9, 20, 18)
+	if !(Neutral < lucky && lucky < proven) {
+		t.Errorf("Expected neutral < lucky (%v) < proven (%v)", lucky, proven)
+	}
+
+	noisy := Score(50, 0.1, 20, 1)
+	if noisy >= Neutral {
+		t.Errorf("Expected a noisy author below neutral, got %v", noisy)
+	}
+
+	// Ratings count as much as relevance
+	unrated := Score(50, 0.9, 0, 0)
+	disliked := Score(50, 0.9, 30, 0)
+	if disliked >= unrated {
+		t.Errorf("Expected poor ratings to lower reputation: %v >= %v", disliked, unrated)
+	}
+}
+
+func TestWeight(t *testing.T) {
+	tests := []struct{ reputation, want float64 }{
+		{0, MinWeight},
+		{Neutral, 1},
+		{1, MaxWeight},
+		{-1, MinWeight},
+		{2, MaxWeight},
+	}
+	for _, tt := range tests {
+		if got := Weight(tt.reputation); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Weight(%v) = %v, want %v", tt.reputation, got, tt.want)
+		}
+	}
+}
+
+func TestAnonymous(t *testing.T) {
+	for _, author := range []string{"", " ", "[deleted]", "unknown"} {
+		if !anonymous(author) {
+			t.Errorf("Expected %q to be anonymous", author)
+		}
+	}
+	if anonymous("gopher") {
+		t.Error("Expected a named author not to be anonymous")
+	}
+}
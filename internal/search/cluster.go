@@ -0,0 +1,114 @@
+package search
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// DuplicateSimilarity is how much of their wording two summaries must share
+// (the Jaccard similarity of their word trigrams) to count as the same
+// content, such as one article collected from Reddit and Hacker News and
+// uploaded as a PDF.
+const DuplicateSimilarity = 0.8
+
+// shingleSize is the number of words in each compared shingle.
+const shingleSize = 3
+
+// Duplicate is a copy of an item collapsed into it.
+type Duplicate struct {
+	ID             string `json:"id"`
+	SourcePlatform string `json:"source_platform"`
+	SourceURL      string `json:"source_url"`
+}
+
+// Collapse folds duplicates into the first, highest ranked, copy of each
+// piece of content, listing the others in its AlsoSeenOn. Items are
+// duplicates when their URLs are the same once tracking parameters and the
+// like are dropped, or when their summaries are near-identical.
+func Collapse(items []Item) []Item {
+	type kept struct {
+		index    int
+		url      string
+		shingles map[string]bool
+	}
+	var out []Item
+	var seen []kept
+	for _, item := range items {
+		u := canonicalURL(item.SourceURL)
+		s := shingles(item.ContentSummary)
+		dup := -1
+		for _, k := range seen {
+			if (u != "" && u == k.url) || similarity(s, k.shingles) >= DuplicateSimilarity {
+				dup = k.index
+				break
+			}
+		}
+		if dup >= 0 {
+			out[dup].AlsoSeenOn = append(out[dup].AlsoSeenOn, Duplicate{
+				ID:             item.ID,
+				SourcePlatform: item.SourcePlatform,
+				SourceURL:      item.SourceURL,
+			})
+			continue
+		}
+		seen = append(seen, kept{index: len(out), url: u, shingles: s})
+		out = append(out, item)
+	}
+	if out == nil {
+		out = []Item{}
+	}
+	return out
+}
+
+// canonicalURL drops what differs between links to the same page: the
+// scheme, a leading www., the fragment, a trailing slash and utm_ tracking
+// parameters. Links that do not parse are not compared.
+func canonicalURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	q := u.Query()
+	for key := range q {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			q.Del(key)
+		}
+	}
+	canonical := strings.TrimPrefix(strings.ToLower(u.Host), "www.") + strings.TrimSuffix(u.EscapedPath(), "/")
+	if query := q.Encode(); query != "" {
+		canonical += "?" + query
+	}
+	return canonical
+}
+
+// shingles returns the word trigrams of text, lowercased and without
+// punctuation. Texts too short to have one are not compared.
+func shingles(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < shingleSize {
+		return nil
+	}
+	set := make(map[string]bool, len(words)-shingleSize+1)
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[strings.Join(words[i:i+shingleSize], " ")] = true
+	}
+	return set
+}
+
+// similarity is the Jaccard similarity of two shingle sets, 0 when either
+// is empty.
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for s := range a {
+		if b[s] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Judgment is a query with the content judged relevant to it.
+type Judgment struct {
+	Workspace string `json:"workspace_id,omitempty"`
+	Query     string `json:"query"`
+	// Relevant grades content IDs: 1 is relevant, higher is more so
+	Relevant map[string]int `json:"relevant"`
+}
+
+// ReadJudgments reads judgments as JSON lines, skipping blank ones.
+func ReadJudgments(r io.Reader) ([]Judgment, error) {
+	var judgments []Judgment
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var j Judgment
+		if err := json.Unmarshal(scanner.Bytes(), &j); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if strings.TrimSpace(j.Query) == "" || len(j.Relevant) == 0 {
+			return nil, fmt.Errorf("line %d: a judgment needs a query and relevant content", line)
+		}
+		judgments = append(judgments, j)
+	}
+	return judgments, scanner.Err()
+}
+
+// LoggedJudgments turns the latest logged queries with relevant_content_ids
+// into judgments, each listed ID graded 1. An empty workspace takes every
+// workspace's.
+func LoggedJudgments(ctx context.Context, db *sql.DB, workspace string, limit int) ([]Judgment, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT workspace_id, query_text, array_to_string(relevant_content_ids, ',')
+		FROM query_history
+		WHERE cardinality(relevant_content_ids) > 0 AND ($1 = '' OR workspace_id = $1)
+		ORDER BY created_at DESC LIMIT $2`, workspace, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var judgments []Judgment
+	for rows.Next() {
+		var j Judgment
+		var ids string
+		if err := rows.Scan(&j.Workspace, &j.Query, &ids); err != nil {
+			return nil, err
+		}
+		j.Relevant = make(map[string]int)
+		for _, id := range strings.Split(ids, ",") {
+			j.Relevant[id] = 1
+		}
+		judgments = append(judgments, j)
+	}
+	return judgments, rows.Err()
+}
+
+// Metrics measure a ranker over judged queries, averaged per query, at
+// the cutoff K.
+type Metrics struct {
+	Queries int `json:"queries"`
+	K       int `json:"k"`
+	// NDCG is the normalized discounted cumulative gain of the grades
+	NDCG float64 `json:"ndcg"`
+	// MRR is the mean reciprocal rank of the first relevant result
+	MRR float64 `json:"mrr"`
+	// Recall is the share of the relevant content ranked in the top K, out
+	// of as much as fits in K
+	Recall float64 `json:"recall"`
+}
+
+// Evaluate replays judgments through rank, which returns a query's
+// results as content IDs, the best first, and scores the top k.
+func Evaluate(judgments []Judgment, k int, rank func(Judgment) ([]string, error)) (Metrics, error) {
+	m := Metrics{K: k}
+	for _, j := range judgments {
+		ranked, err := rank(j)
+		if err != nil {
+			return m, fmt.Errorf("query %q: %w", j.Query, err)
+		}
+		ndcg, rr, recall := judge(ranked, j.Relevant, k)
+		m.NDCG += ndcg
+		m.MRR += rr
+		m.Recall += recall
+		m.Queries++
+	}
+	if m.Queries > 0 {
+		n := float64(m.Queries)
+		m.NDCG, m.MRR, m.Recall = m.NDCG/n, m.MRR/n, m.Recall/n
+	}
+	return m, nil
+}
+
+// judge scores one ranking against graded relevance.
+func judge(ranked []string, relevant map[string]int, k int) (ndcg, rr, recall float64) {
+	if len(ranked) > k {
+		ranked = ranked[:k]
+	}
+	var dcg float64
+	found := 0
+	for i, id := range ranked {
+		grade := relevant[id]
+		if grade <= 0 {
+			continue
+		}
+		dcg += gain(grade, i)
+		found++
+		if rr == 0 {
+			rr = 1 / float64(i+1)
+		}
+	}
+
+	grades := make([]int, 0, len(relevant))
+	for _, g := range relevant {
+		if g > 0 {
+			grades = append(grades, g)
+		}
+	}
+	if len(grades) == 0 {
+		return 0, 0, 0
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(grades)))
+	var ideal float64
+	for i, g := range grades[:min(k, len(grades))] {
+		ideal += gain(g, i)
+	}
+	return dcg / ideal, rr, float64(found) / float64(min(k, len(grades)))
+}
+
+// gain is the discounted gain of a grade at a 0-based position.
+func gain(grade, position int) float64 {
+	return (math.Pow(2, float64(grade)) - 1) / math.Log2(float64(position)+2)
+}
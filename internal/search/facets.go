@@ -0,0 +1,105 @@
+package search
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// MaxFacetValues caps how many values each facet lists, so a workspace
+// with thousands of tags does not bloat every response.
+const MaxFacetValues = 20
+
+// Facet names, as returned by facet queries.
+const (
+	PlatformFacet    = "platform"
+	TagFacet         = "tag"
+	ContentTypeFacet = "content_type"
+	MonthFacet       = "month"
+)
+
+// FacetCount is how many matches have a facet value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets counts all matches of a search, not just the page, by platform,
+// tag, content type and month of publication (as YYYY-MM). Values are most
+// common first, except months, which are newest first.
+type Facets struct {
+	Platforms    []FacetCount `json:"platform"`
+	Tags         []FacetCount `json:"tag"`
+	ContentTypes []FacetCount `json:"content_type"`
+	Months       []FacetCount `json:"month"`
+}
+
+// facetQuery counts the filtered content by each facet. The row with an
+// empty facet is the total, so it replaces the count query and facets cost
+// no extra round trip.
+const facetQuery = `
+	WITH matched AS (SELECT source_platform, content_type, tags, COALESCE(timestamp, created_at) AS published
+		FROM content_metadata%s)
+	SELECT '', '', COUNT(*) FROM matched
+	UNION ALL SELECT 'platform', COALESCE(source_platform, ''), COUNT(*) FROM matched GROUP BY 2
+	UNION ALL SELECT 'content_type', COALESCE(content_type, ''), COUNT(*) FROM matched GROUP BY 2
+	UNION ALL SELECT 'tag', tag, COUNT(*) FROM matched, unnest(tags) AS tag GROUP BY 2
+	UNION ALL SELECT 'month', to_char(published, 'YYYY-MM'), COUNT(*) FROM matched GROUP BY 2`
+
+// ScanFacets reads (facet, value, count) rows, as returned by a facet
+// query, into the total and the facets. Stores implementing the search
+// outside Postgres use it too.
+func ScanFacets(rows *sql.Rows) (int, *Facets, error) {
+	defer rows.Close()
+	total := 0
+	facets := &Facets{Platforms: []FacetCount{}, Tags: []FacetCount{}, ContentTypes: []FacetCount{}, Months: []FacetCount{}}
+	for rows.Next() {
+		var facet string
+		var c FacetCount
+		if err := rows.Scan(&facet, &c.Value, &c.Count); err != nil {
+			return 0, nil, err
+		}
+		facets.add(facet, c)
+		if facet == "" {
+			total = c.Count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	facets.sort()
+	return total, facets, nil
+}
+
+func (f *Facets) add(facet string, c FacetCount) {
+	if c.Value == "" {
+		return
+	}
+	switch facet {
+	case PlatformFacet:
+		f.Platforms = append(f.Platforms, c)
+	case TagFacet:
+		f.Tags = append(f.Tags, c)
+	case ContentTypeFacet:
+		f.ContentTypes = append(f.ContentTypes, c)
+	case MonthFacet:
+		f.Months = append(f.Months, c)
+	}
+}
+
+func (f *Facets) sort() {
+	for _, counts := range []*[]FacetCount{&f.Platforms, &f.Tags, &f.ContentTypes} {
+		c := *counts
+		sort.Slice(c, func(i, j int) bool {
+			if c[i].Count != c[j].Count {
+				return c[i].Count > c[j].Count
+			}
+			return c[i].Value < c[j].Value
+		})
+	}
+	sort.Slice(f.Months, func(i, j int) bool { return f.Months[i].Value > f.Months[j].Value })
+	for _, counts := range []*[]FacetCount{&f.Platforms, &f.Tags, &f.ContentTypes, &f.Months} {
+		if len(*counts) > MaxFacetValues {
+			*counts = (*counts)[:MaxFacetValues]
+		}
+	}
+}
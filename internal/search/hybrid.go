@@ -0,0 +1,225 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// MaxCandidates caps how many matches the hybrid ranker scores. Total counts
+// at most this many.
+const MaxCandidates = 500
+
+// Weights balance the signals the hybrid ranker combines. A score is the
+// weighted mean of the signals, so weights need not sum to 1; a signal that
+// is not available, such as vector similarity without a vector store,
+// drops out of the mean.
+type Weights struct {
+	// Keyword is the full-text rank of the query against the summary and
+	// tags, relative to the best match
+	Keyword float64 `json:"keyword"`
+	// Vector is the semantic similarity the Vectors report
+	Vector float64 `json:"vector"`
+	// Recency halves every HalfLife since the content was published
+	Recency float64 `json:"recency"`
+	// Relevance is relevance_score
+	Relevance float64 `json:"relevance"`
+}
+
+// DefaultWeights favour the query match, then the content's own score.
+var DefaultWeights = Weights{Keyword: 0.4, Vector: 0.3, Recency: 0.1, Relevance: 0.2}
+
+// ParseWeights reads weights such as "keyword=0.6,vector=0.4" over base:
+// signals it does not name keep their weight in base.
+func ParseWeights(s string, base Weights) (Weights, error) {
+	w := base
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(pair, "=")
+		weight, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !ok || err != nil || weight < 0 || math.IsInf(weight, 0) {
+			return base, fmt.Errorf("invalid weight %q: use signal=weight with a non-negative weight", pair)
+		}
+		switch strings.TrimSpace(name) {
+		case "keyword":
+			w.Keyword = weight
+		case "vector":
+			w.Vector = weight
+		case "recency":
+			w.Recency = weight
+		case "relevance":
+			w.Relevance = weight
+		default:
+			return base, fmt.Errorf("unknown signal %q: use keyword, vector, recency or relevance", name)
+		}
+	}
+	return w, nil
+}
+
+func (w Weights) String() string {
+	return fmt.Sprintf("keyword=%g,vector=%g,recency=%g,relevance=%g", w.Keyword, w.Vector, w.Recency, w.Relevance)
+}
+
+// Signals are what the hybrid ranker knows about a match, each from 0 to 1.
+type Signals struct {
+	Keyword   float64 `json:"keyword"`
+	Vector    float64 `json:"vector"`
+	Recency   float64 `json:"recency"`
+	Relevance float64 `json:"relevance"`
+}
+
+// Score is the weighted mean of s.
+func (w Weights) Score(s Signals) float64 {
+	total := w.Keyword + w.Vector + w.Recency + w.Relevance
+	if total == 0 {
+		return 0
+	}
+	return (w.Keyword*s.Keyword + w.Vector*s.Vector + w.Recency*s.Recency + w.Relevance*s.Relevance) / total
+}
+
+// Vectors find content semantically close to a query, such as a vector
+// database holding the content's embeddings.
+type Vectors interface {
+	// Similar returns up to limit IDs of the workspace's content with
+	// their similarity to query, from 0 to 1.
+	Similar(ctx context.Context, workspace, query string, limit int) (map[string]float64, error)
+}
+
+// hybridSearch ranks the request's matches with req.Hybrid. Matches are
+// the content the query matches as text or full-text, and the content the
+// Vectors find similar, under the request's other filters.
+func hybridSearch(ctx context.Context, db *sql.DB, req SearchRequest) (*SearchResult, error) {
+	w := *req.Hybrid
+	text := strings.TrimSpace(req.Query)
+
+	var similar map[string]float64
+	if req.Vectors != nil && w.Vector > 0 {
+		var err error
+		if similar, err = req.Vectors.Similar(ctx, req.Workspace, text, MaxCandidates); err != nil {
+			// Keyword search still answers without them
+			logging.FromContext(ctx).Warn("vector search failed, ranking without it", "error", err)
+			similar = nil
+		}
+	}
+	if similar == nil {
+		w.Vector = 0
+	}
+	if req.HalfLife <= 0 {
+		w.Recency = 0
+	}
+
+	filters := req
+	filters.Query = ""
+	q := filters.filter()
+	ids := make([]string, 0, len(similar))
+	for id := range similar {
+		ids = append(ids, id)
+	}
+	tsquery := "plainto_tsquery('english', " + q.arg(text) + ")"
+	vectorMatch := "id::text = ANY(string_to_array(" + q.arg(strings.Join(ids, ",")) + ", ','))"
+	q.conds = append(q.conds, fmt.Sprintf("(%s OR search_vector @@ %s OR %s)", q.textMatch(text), tsquery, vectorMatch))
+	where := q.where()
+
+	result := &SearchResult{Items: []Item{}, Limit: req.limit(), Offset: req.offset()}
+	if req.Facets {
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(facetQuery, where), q.args...)
+		if err != nil {
+			return nil, err
+		}
+		if _, result.Facets, err = ScanFacets(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	// What the vectors found comes first, so the cap never drops it
+	rows, err := db.QueryContext(ctx, "SELECT"+itemColumns+`,
+		COALESCE(ts_rank_cd(search_vector, `+tsquery+`), 0),
+		GREATEST(EXTRACT(EPOCH FROM now() - COALESCE(timestamp, created_at)), 0)
+		FROM content_metadata`+where+`
+		ORDER BY `+vectorMatch+` DESC, 11 DESC, created_at DESC, id LIMIT `+q.arg(MaxCandidates), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []Item
+	var keyword, age []float64
+	for rows.Next() {
+		var item Item
+		var rank, seconds float64
+		if err := scanItem(rows, &item, &rank, &seconds); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, item)
+		keyword = append(keyword, rank)
+		age = append(age, seconds)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rankHybrid(candidates, keyword, age, similar, w, req.HalfLife.Seconds(), req.Staleness)
+	result.Total = len(candidates)
+	if result.Offset < len(candidates) {
+		result.Items = candidates[result.Offset:min(result.Offset+result.Limit, len(candidates))]
+	}
+	if err := loadAttachments(ctx, db, result.Items); err != nil {
+		return nil, err
+	}
+	if next := result.Offset + len(result.Items); next < result.Total && len(result.Items) > 0 {
+		result.NextOffset = &next
+	}
+	if req.Collapse {
+		result.Items = Collapse(result.Items)
+	}
+	return result, nil
+}
+
+// rankHybrid scores items by w and sorts them, the best first. keyword and
+// age (in seconds) are per item; keyword ranks are taken relative to the
+// best of them. An item stale flags is marked, and its score multiplied
+// by the rule's penalty.
+func rankHybrid(items []Item, keyword, age []float64, similar map[string]float64, w Weights, halfLife float64, stale *Staleness) {
+	now := time.Now()
+	best := 0.0
+	for _, k := range keyword {
+		best = math.Max(best, k)
+	}
+	for i := range items {
+		s := Signals{Relevance: clamp(items[i].RelevanceScore), Vector: clamp(similar[items[i].ID])}
+		if best > 0 {
+			s.Keyword = keyword[i] / best
+		}
+		if halfLife > 0 {
+			s.Recency = math.Pow(0.5, age[i]/halfLife)
+		}
+		items[i].Signals = &s
+		items[i].Score = w.Score(s)
+		if rule := stale.Rule(items[i], now); rule != nil {
+			items[i].PossiblyOutdated = rule
+			items[i].Score *= rule.Penalty
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Score != items[j].Score {
+			return items[i].Score > items[j].Score
+		}
+		if !items[i].Timestamp.Equal(items[j].Timestamp) {
+			return items[i].Timestamp.After(items[j].Timestamp)
+		}
+		return items[i].ID < items[j].ID
+	})
+}
+
+func clamp(v float64) float64 {
+	return math.Min(math.Max(v, 0), 1)
+}
@@ -0,0 +1,418 @@
+// Package search queries collected content. The MCP tools and the gateway's
+// REST API both go through it, so a search means the same thing everywhere.
+//
+// Results are ranked by relevance_score weighted by how well the text query
+// matched: an exact tag beats part of a tag, which beats a summary match.
+// Searches without a query rank by relevance_score alone. Requests with a
+// HalfLife also decay the rank with age, so old high scorers give way to
+// newer content. A Staleness policy lowers the rank of content on
+// fast-moving topics past its age limit, and flags it PossiblyOutdated.
+//
+// Requests with Hybrid weights rank by the hybrid ranker instead, which
+// blends full-text rank, vector similarity, recency and relevance_score
+// (see Weights). Evaluate compares rankers on judged queries.
+package search
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"selin/internal/keyring"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Match weights multiplied into relevance_score when ranking.
+const (
+	ExactTagWeight = 1.0
+	TagWeight      = 0.8
+	SummaryWeight  = 0.6
+)
+
+// ErrNotFound is returned by Get for unknown IDs.
+var ErrNotFound = errors.New("content not found")
+
+// SearchRequest selects content in one workspace. Zero fields match
+// everything.
+type SearchRequest struct {
+	Workspace string
+	// Query matches a substring of the summary, tags or text extracted from
+	// attachments, case-insensitively.
+	Query string
+	// Tags must all be present on the content.
+	Tags []string
+	// Platform matches source_platform; "all" is the same as empty.
+	Platform string
+	// Visibility matches the content's visibility; "all" is the same as
+	// empty.
+	Visibility string
+	// Since keeps content published at or after this time.
+	Since time.Time
+	// IDs, when set, keeps only these items, such as a collection's.
+	IDs []string
+	// HalfLife halves the rank of content every HalfLife since it was
+	// published. Zero ranks without regard to age.
+	HalfLife time.Duration
+	// Staleness, when set, penalizes and flags content past its tags' age
+	// limits.
+	Staleness *Staleness
+	// Facets also counts all matches by platform, tag, content type and
+	// month.
+	Facets bool
+	// Collapse folds duplicates on the page into one item each (see
+	// Collapse). Total and paging still count every match.
+	Collapse bool
+	// Hybrid, with a Query, ranks by the hybrid ranker with these weights.
+	Hybrid *Weights
+	// Vectors, when set, find semantically similar content for the hybrid
+	// ranker.
+	Vectors Vectors
+	Limit   int
+	Offset  int
+}
+
+// Content visibility, set by the path that ingested it. Private content,
+// such as Slack messages, never leaves the system: it is left out of
+// exports, shared collections and notifications.
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// ValidVisibility reports whether v is a visibility to filter by.
+func ValidVisibility(v string) bool {
+	return v == "" || v == "all" || v == VisibilityPublic || v == VisibilityPrivate
+}
+
+type Item struct {
+	ID             string    `json:"id"`
+	SourceURL      string    `json:"source_url"`
+	Author         string    `json:"author"`
+	Timestamp      time.Time `json:"timestamp"`
+	Tags           []string  `json:"tags"`
+	ContentType    string    `json:"content_type"`
+	SourcePlatform string    `json:"source_platform"`
+	ContentSummary string    `json:"content_summary"`
+	RelevanceScore float64   `json:"relevance_score"`
+	Visibility     string    `json:"visibility"`
+	// License is the terms the content came under, such as an SPDX ID.
+	License string `json:"license,omitempty"`
+	// TokenCount is the length of the item's text in tokens.
+	TokenCount int `json:"token_count"`
+	// Score is the rank: relevance_score weighted by the query match and,
+	// with a HalfLife, by age. The hybrid ranker scores by Signals instead.
+	Score float64 `json:"score"`
+	// Signals are what the hybrid ranker scored.
+	Signals *Signals `json:"signals,omitempty"`
+	// PossiblyOutdated is the staleness rule that flagged the item, if one
+	// did.
+	PossiblyOutdated *StaleRule   `json:"possibly_outdated,omitempty"`
+	Attachments      []Attachment `json:"attachments,omitempty"`
+	// AlsoSeenOn lists the duplicates a collapsed search folded into this
+	// item.
+	AlsoSeenOn []Duplicate `json:"also_seen_on,omitempty"`
+}
+
+// Attachment is a file attached to an item, such as an image in a chat
+// message.
+type Attachment struct {
+	Filename  string `json:"filename"`
+	MimeType  string `json:"mime_type,omitempty"`
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+	// SourceURL is set for files the export only referred to.
+	SourceURL string `json:"source_url,omitempty"`
+	// ExtractedText is the text OCR found in an image.
+	ExtractedText string `json:"extracted_text,omitempty"`
+}
+
+// SearchResult is one page of ranked matches. NextOffset is set when there
+// are more.
+type SearchResult struct {
+	Items      []Item `json:"items"`
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextOffset *int   `json:"next_offset,omitempty"`
+	// Facets is set when the request asked for them.
+	Facets *Facets `json:"facets,omitempty"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+const itemColumns = `
+	id, source_url, COALESCE(author, ''), COALESCE(timestamp, created_at),
+	COALESCE(array_to_string(tags, ','), ''), COALESCE(content_type, ''),
+	COALESCE(source_platform, ''), COALESCE(content_summary, ''), COALESCE(relevance_score, 0),
+	COALESCE(token_count, 0), visibility, license`
+
+// limit clamps the page size to 1..MaxLimit, defaulting to DefaultLimit.
+func (req SearchRequest) limit() int {
+	switch {
+	case req.Limit <= 0:
+		return DefaultLimit
+	case req.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return req.Limit
+}
+
+func (req SearchRequest) offset() int {
+	if req.Offset < 0 {
+		return 0
+	}
+	return req.Offset
+}
+
+// Page returns the clamped limit and offset, for stores implementing the
+// search outside Postgres.
+func (req SearchRequest) Page() (limit, offset int) {
+	return req.limit(), req.offset()
+}
+
+// query holds a statement's conditions and their positional arguments.
+type query struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg adds an argument and returns its placeholder.
+func (q *query) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *query) where() string {
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+// textMatch is the condition matching text in the summary, tags or
+// attachments.
+func (q *query) textMatch(text string) string {
+	return fmt.Sprintf("(content_summary ILIKE %[1]s OR array_to_string(tags, ',') ILIKE %[1]s"+
+		" OR EXISTS (SELECT 1 FROM content_attachments a WHERE a.content_id = content_metadata.id AND a.extracted_text ILIKE %[1]s))",
+		q.arg("%"+text+"%"))
+}
+
+// filter builds the conditions selecting the request's content.
+func (req SearchRequest) filter() *query {
+	q := &query{}
+	q.conds = append(q.conds, "workspace_id = "+q.arg(req.Workspace))
+	if text := strings.TrimSpace(req.Query); text != "" {
+		q.conds = append(q.conds, q.textMatch(text))
+	}
+	if tags := cleanTags(req.Tags); len(tags) > 0 {
+		q.conds = append(q.conds, "tags @> string_to_array("+q.arg(strings.Join(tags, ","))+", ',')")
+	}
+	if req.Platform != "" && req.Platform != "all" {
+		q.conds = append(q.conds, "source_platform = "+q.arg(req.Platform))
+	}
+	if req.Visibility != "" && req.Visibility != "all" {
+		q.conds = append(q.conds, "visibility = "+q.arg(req.Visibility))
+	}
+	if !req.Since.IsZero() {
+		q.conds = append(q.conds, "COALESCE(timestamp, created_at) >= "+q.arg(req.Since))
+	}
+	if len(req.IDs) > 0 {
+		q.conds = append(q.conds, "id::text = ANY(string_to_array("+q.arg(strings.Join(req.IDs, ","))+", ','))")
+	}
+	return q
+}
+
+// rank returns the score expression, adding its arguments to q. They come
+// after the filter's so the count can run with the filter's alone.
+func (req SearchRequest) rank(q *query) string {
+	rank := "COALESCE(relevance_score, 0)"
+	if text := strings.TrimSpace(req.Query); text != "" {
+		rank = fmt.Sprintf(`%s * CASE
+			WHEN %s = ANY(lower(tags::text)::text[]) THEN %v
+			WHEN array_to_string(tags, ',') ILIKE %s THEN %v
+			ELSE %v END`,
+			rank, q.arg(strings.ToLower(text)), ExactTagWeight, q.arg("%"+text+"%"), TagWeight, SummaryWeight)
+	}
+	if req.HalfLife > 0 {
+		// Content dated in the future counts as new
+		rank = fmt.Sprintf("(%s) * power(0.5, GREATEST(EXTRACT(EPOCH FROM now() - COALESCE(timestamp, created_at)), 0) / %s)",
+			rank, q.arg(req.HalfLife.Seconds()))
+	}
+	return req.Staleness.penalize(q, rank)
+}
+
+func cleanTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Search returns one page of ranked matches and the total number of matches.
+func Search(ctx context.Context, db *sql.DB, req SearchRequest) (*SearchResult, error) {
+	if req.Hybrid != nil && strings.TrimSpace(req.Query) != "" {
+		return hybridSearch(ctx, db, req)
+	}
+	q := req.filter()
+	where := q.where()
+
+	result := &SearchResult{Items: []Item{}, Limit: req.limit(), Offset: req.offset()}
+	if req.Facets {
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(facetQuery, where), q.args...)
+		if err != nil {
+			return nil, err
+		}
+		if result.Total, result.Facets, err = ScanFacets(rows); err != nil {
+			return nil, err
+		}
+	} else if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM content_metadata"+where, q.args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	// Ties go to the newest content; id keeps pages stable
+	stmt := "SELECT" + itemColumns + ", " + req.rank(q) + " AS score FROM content_metadata" + where +
+		" ORDER BY score DESC, created_at DESC, id" +
+		" LIMIT " + q.arg(result.Limit) + " OFFSET " + q.arg(result.Offset)
+	rows, err := db.QueryContext(ctx, stmt, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := scanItem(rows, &item, &item.Score); err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	req.Staleness.Flag(result.Items, time.Now())
+	if err := loadAttachments(ctx, db, result.Items); err != nil {
+		return nil, err
+	}
+
+	if next := result.Offset + len(result.Items); next < result.Total && len(result.Items) > 0 {
+		result.NextOffset = &next
+	}
+	if req.Collapse {
+		result.Items = Collapse(result.Items)
+	}
+	return result, nil
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Get returns one item, or ErrNotFound.
+func Get(ctx context.Context, db *sql.DB, workspace, id string) (*Item, error) {
+	if !uuidPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	var item Item
+	err := scanItem(db.QueryRowContext(ctx,
+		"SELECT"+itemColumns+" FROM content_metadata WHERE workspace_id = $1 AND id = $2", workspace, id), &item)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	item.Score = item.RelevanceScore
+	items := []Item{item}
+	if err := loadAttachments(ctx, db, items); err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// loadAttachments fills in the items' attachments, decrypting the text
+// extracted from them.
+func loadAttachments(ctx context.Context, db *sql.DB, items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(items))
+	ids := make([]string, len(items))
+	for i, item := range items {
+		index[item.ID] = i
+		ids[i] = item.ID
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT content_id, workspace_id, filename, COALESCE(mime_type, ''), COALESCE(size_bytes, 0),
+			COALESCE(source_url, ''), COALESCE(extracted_text, '')
+		FROM content_attachments
+		WHERE content_id::text = ANY(string_to_array($1, ','))
+		ORDER BY content_id, position`, strings.Join(ids, ","))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, workspace string
+		var a Attachment
+		if err := rows.Scan(&id, &workspace, &a.Filename, &a.MimeType, &a.SizeBytes, &a.SourceURL, &a.ExtractedText); err != nil {
+			return err
+		}
+		if a.ExtractedText, err = keyring.Default().OpenString(ctx, workspace, a.ExtractedText); err != nil {
+			return fmt.Errorf("attachment %s of %s: %v", a.Filename, id, err)
+		}
+		if i, ok := index[id]; ok {
+			items[i].Attachments = append(items[i].Attachments, a)
+		}
+	}
+	return rows.Err()
+}
+
+// Tags returns the most used tags in a workspace.
+func Tags(ctx context.Context, db *sql.DB, workspace string, limit int) ([]TagCount, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT tag, COUNT(*) FROM content_metadata, unnest(tags) AS tag
+		WHERE workspace_id = $1
+		GROUP BY tag ORDER BY COUNT(*) DESC, tag LIMIT $2`, workspace, SearchRequest{Limit: limit}.limit())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+	return tags, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanItem reads itemColumns, then any extra columns into extra.
+func scanItem(row scanner, item *Item, extra ...interface{}) error {
+	var tags string
+	dest := append([]interface{}{&item.ID, &item.SourceURL, &item.Author, &item.Timestamp, &tags,
+		&item.ContentType, &item.SourcePlatform, &item.ContentSummary, &item.RelevanceScore, &item.TokenCount,
+		&item.Visibility, &item.License}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	item.Tags = []string{}
+	if tags != "" {
+		item.Tags = strings.Split(tags, ",")
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+//go:build integration
+
+package search
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration ./search (needs a Docker daemon)
+
+type row struct {
+	workspace, summary string
+	tags               []string
+	platform           string
+	score              float64
+	published          time.Time
+}
+
+func insert(t *testing.T, db *sql.DB, r row) string {
+	t.Helper()
+	if r.workspace == "" {
+		r.workspace = "default"
+	}
+	if r.platform == "" {
+		r.platform = "reddit"
+	}
+	if r.published.IsZero() {
+		r.published = time.Now()
+	}
+	var id string
+	err := db.QueryRow(`
+		INSERT INTO content_metadata (workspace_id, source_url, tags, source_platform, content_summary, relevance_score, timestamp)
+		VALUES ($1, 'https://example.com/' || $4, string_to_array($2, ','), $3, $4, $5, $6) RETURNING id`,
+		r.workspace, joinTags(r.tags), r.platform, r.summary, r.score, r.published).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func joinTags(tags []string) string {
+	s := ""
+	for i, tag := range tags {
+		if i > 0 {
+			s += ","
+		}
+		s += tag
+	}
+	return s
+}
+
+func TestSearchAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+
+	exact := insert(t, db, row{summary: "Validator set changes", tags: []string{"cosmos", "golang"}, score: 0.8})
+	partial := insert(t, db, row{summary: "Module wiring", tags: []string{"cosmos-sdk"}, score: 0.8})
+	summary := insert(t, db, row{summary: "Why Cosmos chains use IBC", tags: []string{"ibc"}, score: 0.9, platform: "slack"})
+	old := insert(t, db, row{summary: "Cosmos retrospective", tags: []string{"history"}, score: 0.5,
+		published: time.Now().AddDate(-2, 0, 0)})
+	insert(t, db, row{workspace: "other", summary: "Cosmos in another workspace", tags: []string{"cosmos"}, score: 1})
+
+	t.Run("ranks exact tags over partial tags over summaries", func(t *testing.T) {
+		result, err := Search(ctx, db, SearchRequest{Workspace: "default", Query: "cosmos"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 4 {
+			t.Fatalf("Expected 4 matches in the workspace, got %d", result.Total)
+		}
+		want := []string{exact, partial, summary, old}
+		for i, id := range want {
+			if result.Items[i].ID != id {
+				t.Errorf("Position %d: expected %s, got %s (%+v)", i, id, result.Items[i].ID, result.Items[i])
+			}
+		}
+		if result.NextOffset != nil {
+			t.Errorf("Expected no next page, got %d", *result.NextOffset)
+		}
+	})
+
+	t.Run("paginates", func(t *testing.T) {
+		first, err := Search(ctx, db, SearchRequest{Workspace: "default", Query: "cosmos", Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(first.Items) != 3 || first.NextOffset == nil || *first.NextOffset != 3 {
+			t.Fatalf("Unexpected first page: %d items, next %v", len(first.Items), first.NextOffset)
+		}
+		second, err := Search(ctx, db, SearchRequest{Workspace: "default", Query: "cosmos", Limit: 3, Offset: *first.NextOffset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(second.Items) != 1 || second.Items[0].ID != old || second.NextOffset != nil {
+			t.Errorf("Unexpected second page: %+v", second)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		tests := []struct {
+			name string
+			req  SearchRequest
+			want int
+		}{
+			{"tags", SearchRequest{Tags: []string{"Cosmos", "golang"}}, 1},
+			{"platform", SearchRequest{Platform: "slack"}, 1},
+			{"since", SearchRequest{Since: time.Now().AddDate(-1, 0, 0)}, 3},
+			{"no match", SearchRequest{Query: "solana"}, 0},
+		}
+		for _, tt := range tests {
+			tt.req.Workspace = "default"
+			result, err := Search(ctx, db, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != tt.want || len(result.Items) != tt.want {
+				t.Errorf("%s: expected %d results, got %d (%d items)", tt.name, tt.want, result.Total, len(result.Items))
+			}
+		}
+	})
+
+	t.Run("get and tags", func(t *testing.T) {
+		item, err := Get(ctx, db, "default", exact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ContentSummary != "Validator set changes" || len(item.Tags) != 2 {
+			t.Errorf("Unexpected item: %+v", item)
+		}
+		if _, err := Get(ctx, db, "other", exact); err != ErrNotFound {
+			t.Errorf("Expected other workspaces to get ErrNotFound, got %v", err)
+		}
+
+		tags, err := Tags(ctx, db, "default", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 5 || tags[0].Count != 1 {
+			t.Errorf("Unexpected tags: %+v", tags)
+		}
+	})
+
+	t.Run("attachments", func(t *testing.T) {
+		id := insert(t, db, row{workspace: "attachments", summary: "[diagram.png]", score: 0.5})
+		_, err := db.Exec(`
+			INSERT INTO content_attachments (content_id, position, workspace_id, filename, mime_type, extracted_text)
+			VALUES ($1, 0, 'attachments', 'diagram.png', 'image/png', 'Tendermint consensus rounds'),
+				($1, 1, 'attachments', 'notes.pdf', 'application/pdf', NULL)`, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Text found in an attachment matches the item
+		result, err := Search(ctx, db, SearchRequest{Workspace: "attachments", Query: "consensus"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 1 || len(result.Items[0].Attachments) != 2 {
+			t.Fatalf("Expected the item with its attachments, got %+v", result)
+		}
+		if a := result.Items[0].Attachments[0]; a.Filename != "diagram.png" || a.ExtractedText != "Tendermint consensus rounds" {
+			t.Errorf("Unexpected attachment: %+v", a)
+		}
+
+		item, err := Get(ctx, db, "attachments", id)
+		if err != nil || len(item.Attachments) != 2 || item.Attachments[1].Filename != "notes.pdf" {
+			t.Errorf("Expected Get to include the attachments, got %+v, %v", item, err)
+		}
+	})
+
+	t.Run("hybrid", func(t *testing.T) {
+		strong := insert(t, db, row{workspace: "hybrid", summary: "Validator rotation in Cosmos validators", tags: []string{"cosmos"}, score: 0.2})
+		weak := insert(t, db, row{workspace: "hybrid", summary: "A note mentioning validators once", score: 0.9})
+		semantic := insert(t, db, row{workspace: "hybrid", summary: "Staking set changes", score: 0.5})
+		insert(t, db, row{workspace: "hybrid", summary: "Unrelated", score: 1})
+
+		vectors := stubVectors{semantic: 0.95}
+		req := SearchRequest{Workspace: "hybrid", Query: "validators", Hybrid: &Weights{Keyword: 1}, Vectors: vectors}
+		result, err := Search(ctx, db, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The vectors add a match the text alone misses
+		if result.Total != 3 || result.Items[0].ID != strong || result.Items[0].Signals == nil {
+			t.Fatalf("Expected the best keyword match first of three, got %+v", result)
+		}
+
+		req.Hybrid = &Weights{Relevance: 1}
+		if result, err = Search(ctx, db, req); err != nil || result.Items[0].ID != weak {
+			t.Errorf("Expected relevance to put the weak match first, got %+v, %v", result, err)
+		}
+		req.Hybrid = &Weights{Vector: 1}
+		if result, err = Search(ctx, db, req); err != nil || result.Items[0].ID != semantic {
+			t.Errorf("Expected the similar item first, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("staleness", func(t *testing.T) {
+		stale := insert(t, db, row{workspace: "stale", summary: "Kubernetes 1.20 upgrade notes", tags: []string{"kubernetes"}, score: 0.9,
+			published: time.Now().AddDate(-2, 0, 0)})
+		current := insert(t, db, row{workspace: "stale", summary: "Kubernetes gateway API", tags: []string{"kubernetes"}, score: 0.6})
+
+		req := SearchRequest{Workspace: "stale", Query: "kubernetes"}
+		result, err := Search(ctx, db, req)
+		if err != nil || result.Items[0].ID != stale || result.Items[0].PossiblyOutdated != nil {
+			t.Fatalf("Expected the higher score first without a policy, got %+v, %v", result, err)
+		}
+		req.Staleness = DefaultStaleness()
+		result, err = Search(ctx, db, req)
+		if err != nil || result.Items[0].ID != current || result.Items[1].PossiblyOutdated == nil {
+			t.Fatalf("Expected the stale item penalized and flagged, got %+v, %v", result, err)
+		}
+		if got := result.Items[1].Score; math.Abs(got-0.45) > 1e-6 {
+			t.Errorf("Expected 0.9 halved, got %v", got)
+		}
+	})
+}
+
+type stubVectors map[string]float64
+
+func (v stubVectors) Similar(context.Context, string, string, int) (map[string]float64, error) {
+	return v, nil
+}
@@ -0,0 +1,296 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	since := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	q := SearchRequest{
+		Workspace: "team",
+		Query:     " Cosmos ",
+		Tags:      []string{"Go", " ", "ibc"},
+		Platform:  "reddit",
+		Since:     since,
+	}.filter()
+
+	want := " WHERE workspace_id = $1" +
+		" AND (content_summary ILIKE $2 OR array_to_string(tags, ',') ILIKE $2" +
+		" OR EXISTS (SELECT 1 FROM content_attachments a WHERE a.content_id = content_metadata.id AND a.extracted_text ILIKE $2))" +
+		" AND tags @> string_to_array($3, ',')" +
+		" AND source_platform = $4" +
+		" AND COALESCE(timestamp, created_at) >= $5"
+	if got := q.where(); got != want {
+		t.Errorf("where = %q\nwant    %q", got, want)
+	}
+	wantArgs := []interface{}{"team", "%Cosmos%", "go,ibc", "reddit", since}
+	if !reflect.DeepEqual(q.args, wantArgs) {
+		t.Errorf("args = %v, want %v", q.args, wantArgs)
+	}
+}
+
+func TestRankAddsArgumentsAfterFilter(t *testing.T) {
+	req := SearchRequest{Workspace: "team", Query: "Cosmos"}
+	q := req.filter()
+	rank := req.rank(q)
+	if !strings.Contains(rank, "$3 = ANY(") || !strings.Contains(rank, "ILIKE $4") {
+		t.Errorf("Unexpected rank placeholders: %s", rank)
+	}
+	if q.args[2] != "cosmos" || q.args[3] != "%Cosmos%" {
+		t.Errorf("Unexpected rank args: %v", q.args[2:])
+	}
+}
+
+func TestWithoutQueryRanksByRelevance(t *testing.T) {
+	req := SearchRequest{Workspace: "default", Platform: "all"}
+	q := req.filter()
+	if q.where() != " WHERE workspace_id = $1" || len(q.args) != 1 {
+		t.Errorf("Expected only the workspace condition, got %q %v", q.where(), q.args)
+	}
+	if rank := req.rank(q); rank != "COALESCE(relevance_score, 0)" || len(q.args) != 1 {
+		t.Errorf("Unexpected rank %q", rank)
+	}
+}
+
+func TestRankDecaysWithHalfLife(t *testing.T) {
+	req := SearchRequest{Workspace: "team", Query: "Cosmos", HalfLife: 60 * 24 * time.Hour}
+	q := req.filter()
+	rank := req.rank(q)
+	if !strings.Contains(rank, "power(0.5,") || !strings.HasSuffix(rank, "/ $5)") {
+		t.Errorf("Expected the rank to decay by the fifth argument, got %s", rank)
+	}
+	if q.args[4] != float64(60*24*60*60) {
+		t.Errorf("Expected the half-life in seconds, got %v", q.args[4])
+	}
+}
+
+func TestRequestLimit(t *testing.T) {
+	tests := []struct{ in, want int }{
+		{0, DefaultLimit},
+		{-5, DefaultLimit},
+		{7, 7},
+		{MaxLimit + 1, MaxLimit},
+	}
+	for _, tt := range tests {
+		if got := (SearchRequest{Limit: tt.in}).limit(); got != tt.want {
+			t.Errorf("limit(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFacetsSortAndCap(t *testing.T) {
+	f := &Facets{}
+	for i := 0; i < MaxFacetValues+5; i++ {
+		f.add(TagFacet, FacetCount{Value: fmt.Sprintf("tag%02d", i), Count: i % 3})
+	}
+	f.add(PlatformFacet, FacetCount{Value: "", Count: 4})
+	f.add(MonthFacet, FacetCount{Value: "2025-12", Count: 1})
+	f.add(MonthFacet, FacetCount{Value: "2026-01", Count: 1})
+	f.sort()
+
+	if len(f.Tags) != MaxFacetValues || f.Tags[0] != (FacetCount{Value: "tag02", Count: 2}) {
+		t.Errorf("Expected the most common tags first, capped, got %v", f.Tags)
+	}
+	if len(f.Platforms) != 0 {
+		t.Errorf("Expected empty values to be left out, got %v", f.Platforms)
+	}
+	if f.Months[0].Value != "2026-01" {
+		t.Errorf("Expected the newest month first, got %v", f.Months)
+	}
+}
+
+func TestCollapse(t *testing.T) {
+	article := "Why IBC relayers need to be incentivized, and what happens to packets when nobody relays them"
+	items := []Item{
+		{ID: "reddit", SourcePlatform: "reddit", SourceURL: "https://reddit.com/r/cosmos/1", ContentSummary: article},
+		{ID: "other", SourcePlatform: "reddit", SourceURL: "https://reddit.com/r/golang/2", ContentSummary: "Generics in Go 1.22, a practical tour"},
+		{ID: "hn", SourcePlatform: "hackernews", SourceURL: "https://news.ycombinator.com/item?id=3", ContentSummary: article + "."},
+		{ID: "pdf", SourcePlatform: "file_upload", SourceURL: "https://www.example.com/ibc/?utm_source=x", ContentSummary: "IBC relayers"},
+		{ID: "link", SourcePlatform: "slack", SourceURL: "http://example.com/ibc#intro", ContentSummary: "Shared in #cosmos"},
+	}
+	got := Collapse(items)
+	if len(got) != 3 || got[0].ID != "reddit" || got[1].ID != "other" || got[2].ID != "pdf" {
+		t.Fatalf("Expected the first copy of each piece of content in rank order, got %+v", got)
+	}
+	if len(got[0].AlsoSeenOn) != 1 || got[0].AlsoSeenOn[0] != (Duplicate{ID: "hn", SourcePlatform: "hackernews", SourceURL: items[2].SourceURL}) {
+		t.Errorf("Expected the near-identical summary folded in, got %+v", got[0].AlsoSeenOn)
+	}
+	if len(got[2].AlsoSeenOn) != 1 || got[2].AlsoSeenOn[0].ID != "link" {
+		t.Errorf("Expected the same URL folded in, got %+v", got[2].AlsoSeenOn)
+	}
+	if got[1].AlsoSeenOn != nil {
+		t.Errorf("Expected distinct content left alone, got %+v", got[1].AlsoSeenOn)
+	}
+
+	// Short summaries alone are not enough to call items duplicates
+	short := Collapse([]Item{{ID: "a", ContentSummary: "Go tips"}, {ID: "b", ContentSummary: "Go tips"}})
+	if len(short) != 2 {
+		t.Errorf("Expected short summaries not to be compared, got %+v", short)
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	w, err := ParseWeights("keyword=0.7, vector=0", DefaultWeights)
+	if err != nil || w != (Weights{Keyword: 0.7, Vector: 0, Recency: 0.1, Relevance: 0.2}) {
+		t.Errorf("Unexpected weights %v, %v", w, err)
+	}
+	for _, bad := range []string{"keyword", "keyword=-1", "bm25=1"} {
+		if _, err := ParseWeights(bad, DefaultWeights); err == nil {
+			t.Errorf("Expected %q rejected", bad)
+		}
+	}
+}
+
+func TestRankHybrid(t *testing.T) {
+	now := time.Now()
+	var items []Item
+	fresh := func() []Item {
+		items = []Item{
+			{ID: "keyword", RelevanceScore: 0.5, Timestamp: now},
+			{ID: "vector", RelevanceScore: 0.5, Timestamp: now},
+			{ID: "old", RelevanceScore: 0.9, Timestamp: now.Add(-time.Hour)},
+		}
+		return items
+	}
+	keyword := []float64{0.2, 0.05, 0.1}
+	age := []float64{0, 0, 3600}
+	similar := map[string]float64{"vector": 0.9, "old": 0.3}
+
+	rankHybrid(fresh(), keyword, age, similar, Weights{Keyword: 1}, 0, nil)
+	if items[0].ID != "keyword" || items[0].Score != 1 || items[2].Signals.Keyword != 0.25 {
+		t.Errorf("Expected keyword rank relative to the best, got %+v", items)
+	}
+
+	rankHybrid(fresh(), keyword, age, similar, Weights{Vector: 1}, 0, nil)
+	if items[0].ID != "vector" {
+		t.Errorf("Expected the most similar first, got %s", items[0].ID)
+	}
+
+	// An hour-old item at a one-hour half-life is worth half on recency
+	rankHybrid(fresh(), []float64{0, 0, 0}, age, nil, Weights{Recency: 1, Relevance: 1}, 3600, nil)
+	for _, item := range items {
+		if item.ID == "old" && math.Abs(item.Score-(0.5+0.9)/2) > 1e-9 {
+			t.Errorf("Expected the old item scored 0.7, got %v", item.Score)
+		}
+	}
+}
+
+func TestLoadStalenessMatchesShippedPolicy(t *testing.T) {
+	s, err := LoadStaleness("../../config/staleness.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, DefaultStaleness()) {
+		t.Errorf("config/staleness.yaml and DefaultStaleness differ:\n%+v\n%+v", s, DefaultStaleness())
+	}
+
+	path := filepath.Join(t.TempDir(), "staleness.yaml")
+	for _, policy := range []string{
+		"rules:\n  - tag: k8s\n    max_age_months: 0\n    penalty: 0.5\n",
+		"rules:\n  - tag: k8s\n    max_age_months: 6\n    penalty: 2\n",
+		"rules:\n  - tag: k8s\n    max_age_months: 6\n  - tag: K8s\n    max_age_months: 12\n",
+	} {
+		os.WriteFile(path, []byte(policy), 0o600)
+		if _, err := LoadStaleness(path); err == nil {
+			t.Errorf("Expected %q to be rejected", policy)
+		}
+	}
+}
+
+func TestStalenessRule(t *testing.T) {
+	now := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	s := &Staleness{Rules: []StaleRule{
+		{Tag: "kubernetes", MaxAgeMonths: 18, Penalty: 0.5},
+		{Tag: "helm", MaxAgeMonths: 6, Penalty: 0.8},
+		{Tag: "tendermint", MaxAgeMonths: 12, Penalty: 0.3},
+	}}
+	items := []Item{
+		{ID: "recent", Tags: []string{"kubernetes"}, Timestamp: now.AddDate(-1, 0, 0)},
+		{ID: "old", Tags: []string{"kubernetes", "helm"}, Timestamp: now.AddDate(-2, 0, 0)},
+		{ID: "untracked", Tags: []string{"golang"}, Timestamp: now.AddDate(-5, 0, 0)},
+		{ID: "heaviest", Tags: []string{"tendermint", "kubernetes"}, Timestamp: now.AddDate(-2, 0, 0)},
+	}
+	s.Flag(items, now)
+	want := map[string]string{"recent": "", "old": "kubernetes", "untracked": "", "heaviest": "tendermint"}
+	for _, item := range items {
+		got := ""
+		if item.PossiblyOutdated != nil {
+			got = item.PossiblyOutdated.Tag
+		}
+		if got != want[item.ID] {
+			t.Errorf("%s: expected rule %q, got %q", item.ID, want[item.ID], got)
+		}
+	}
+	if (*Staleness)(nil).Rule(items[1], now) != nil {
+		t.Error("Expected a nil policy to flag nothing")
+	}
+
+	// Staleness outweighs a higher relevance in the hybrid ranker
+	ranked := []Item{
+		{ID: "stale", RelevanceScore: 0.9, Tags: []string{"tendermint"}, Timestamp: time.Now().AddDate(-2, 0, 0)},
+		{ID: "current", RelevanceScore: 0.6, Tags: []string{"tendermint"}, Timestamp: time.Now()},
+	}
+	rankHybrid(ranked, []float64{0, 0}, []float64{0, 0}, nil, Weights{Relevance: 1}, 0, s)
+	if ranked[0].ID != "current" || ranked[1].PossiblyOutdated == nil || math.Abs(ranked[1].Score-0.27) > 1e-9 {
+		t.Errorf("Expected the stale item penalized below the current one, got %+v", ranked)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	judgments := []Judgment{
+		{Query: "cosmos", Relevant: map[string]int{"a": 2, "b": 1}},
+		{Query: "ibc", Relevant: map[string]int{"c": 1}},
+	}
+	rankings := map[string][]string{"cosmos": {"a", "b", "x"}, "ibc": {"x", "c"}}
+	m, err := Evaluate(judgments, 10, func(j Judgment) ([]string, error) { return rankings[j.Query], nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A perfect ranking, and one with its only hit second
+	wantNDCG := (1 + 1/math.Log2(3)) / 2
+	if m.Queries != 2 || math.Abs(m.NDCG-wantNDCG) > 1e-9 || m.MRR != 0.75 || m.Recall != 1 {
+		t.Errorf("Unexpected metrics %+v", m)
+	}
+
+	m, _ = Evaluate(judgments[:1], 1, func(Judgment) ([]string, error) { return []string{"b", "a"}, nil })
+	if m.Recall != 1 || m.MRR != 1 || math.Abs(m.NDCG-1.0/3) > 1e-9 {
+		t.Errorf("Expected a weaker hit in first place scored below ideal, got %+v", m)
+	}
+
+	if _, err := ReadJudgments(strings.NewReader(`{"query":"cosmos","relevant":{"a":2}}` + "\n\n" + `{"query":"x","relevant":{}}`)); err == nil {
+		t.Error("Expected a judgment without relevant content rejected")
+	}
+}
+
+func TestWeaviateSimilar(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/v1/graphql" || !strings.Contains(body.Query, "Content(nearVector: {vector: [0.5,1]}") ||
+			!strings.Contains(body.Query, `valueText: "team"`) {
+			t.Errorf("Unexpected query %s %s", r.URL.Path, body.Query)
+		}
+		w.Write([]byte(`{"data":{"Get":{"Content":[{"content_id":"a","_additional":{"certainty":0.8}}]}}}`))
+	}))
+	defer srv.Close()
+
+	v := &Weaviate{URL: srv.URL, Class: "Content", HTTP: http.DefaultClient,
+		Embed: func(context.Context, string) ([]float32, error) { return []float32{0.5, 1}, nil }}
+	similar, err := v.Similar(context.Background(), "team", "cosmos", 5)
+	if err != nil || len(similar) != 1 || similar["a"] != 0.8 {
+		t.Errorf("Unexpected similar content %v, %v", similar, err)
+	}
+}
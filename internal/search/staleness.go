@@ -0,0 +1,114 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StaleRule flags content tagged Tag as possibly outdated once it is older
+// than MaxAgeMonths, and multiplies its rank by Penalty.
+type StaleRule struct {
+	Tag          string  `yaml:"tag" json:"tag"`
+	MaxAgeMonths int     `yaml:"max_age_months" json:"max_age_months"`
+	Penalty      float64 `yaml:"penalty" json:"penalty"`
+}
+
+// Staleness is the per-tag staleness policy for fast-moving topics, applied
+// when searching: content a rule flags ranks lower and is marked
+// PossiblyOutdated. Under several rules the heaviest penalty applies.
+type Staleness struct {
+	Rules []StaleRule `yaml:"rules"`
+}
+
+// DefaultStaleness returns the policy shipped as config/staleness.yaml.
+func DefaultStaleness() *Staleness {
+	return &Staleness{Rules: []StaleRule{
+		{Tag: "kubernetes", MaxAgeMonths: 18, Penalty: 0.5},
+		{Tag: "blockchain", MaxAgeMonths: 18, Penalty: 0.5},
+		{Tag: "cosmos", MaxAgeMonths: 18, Penalty: 0.5},
+		{Tag: "tendermint", MaxAgeMonths: 12, Penalty: 0.5},
+		{Tag: "celestia", MaxAgeMonths: 12, Penalty: 0.5},
+	}}
+}
+
+// LoadStaleness reads a staleness policy from a YAML file.
+func LoadStaleness(path string) (*Staleness, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Staleness
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid staleness policy %s: %v", path, err)
+	}
+	seen := make(map[string]bool)
+	for i, r := range s.Rules {
+		r.Tag = strings.ToLower(strings.TrimSpace(r.Tag))
+		switch {
+		case r.Tag == "" || seen[r.Tag]:
+			return nil, fmt.Errorf("invalid staleness policy %s: rule %d needs a tag of its own", path, i+1)
+		case r.MaxAgeMonths <= 0:
+			return nil, fmt.Errorf("invalid staleness policy %s: %s: max_age_months must be positive", path, r.Tag)
+		case r.Penalty < 0 || r.Penalty > 1:
+			return nil, fmt.Errorf("invalid staleness policy %s: %s: penalty must be between 0 and 1", path, r.Tag)
+		}
+		seen[r.Tag] = true
+		s.Rules[i] = r
+	}
+	return &s, nil
+}
+
+// StalenessFromEnv loads the policy STALENESS_POLICY_FILE points to, or
+// returns the default one when it is unset.
+func StalenessFromEnv() (*Staleness, error) {
+	path := os.Getenv("STALENESS_POLICY_FILE")
+	if path == "" {
+		return DefaultStaleness(), nil
+	}
+	return LoadStaleness(path)
+}
+
+// Rule returns the rule flagging item at now with the heaviest penalty, or
+// nil when none does. A nil policy flags nothing.
+func (s *Staleness) Rule(item Item, now time.Time) *StaleRule {
+	if s == nil {
+		return nil
+	}
+	var found *StaleRule
+	for i, r := range s.Rules {
+		if !item.Timestamp.Before(now.AddDate(0, -r.MaxAgeMonths, 0)) || !slices.Contains(item.Tags, r.Tag) {
+			continue
+		}
+		if found == nil || r.Penalty < found.Penalty {
+			found = &s.Rules[i]
+		}
+	}
+	return found
+}
+
+// Flag marks the items the policy flags at now.
+func (s *Staleness) Flag(items []Item, now time.Time) {
+	for i := range items {
+		items[i].PossiblyOutdated = s.Rule(items[i], now)
+	}
+}
+
+// penalize multiplies the rank expression by the heaviest penalty of the
+// rules a row falls under, adding their arguments to q.
+func (s *Staleness) penalize(q *query, rank string) string {
+	if s == nil || len(s.Rules) == 0 {
+		return rank
+	}
+	factors := []string{"1.0"}
+	for _, r := range s.Rules {
+		factors = append(factors, fmt.Sprintf(
+			"CASE WHEN %s = ANY(tags) AND COALESCE(timestamp, created_at) < now() - make_interval(months => %s::int) THEN %s::float8 ELSE 1.0 END",
+			q.arg(r.Tag), q.arg(r.MaxAgeMonths), q.arg(r.Penalty)))
+	}
+	return fmt.Sprintf("(%s) * LEAST(%s)", rank, strings.Join(factors, ", "))
+}
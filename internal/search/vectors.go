@@ -0,0 +1,94 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Weaviate finds similar content in a Weaviate class holding an object per
+// content item, with content_id and workspace_id properties and the
+// item's embedding as its vector.
+type Weaviate struct {
+	// URL is the server, such as http://weaviate:8080
+	URL   string
+	Class string
+	// Embed turns the query into a vector with the model the content was
+	// embedded with
+	Embed func(ctx context.Context, text string) ([]float32, error)
+	HTTP  *http.Client
+}
+
+// WeaviateFromEnv returns the Weaviate at WEAVIATE_URL, class
+// WEAVIATE_CLASS (Content by default), or nil when WEAVIATE_URL is unset.
+func WeaviateFromEnv(embed func(ctx context.Context, text string) ([]float32, error)) *Weaviate {
+	url := os.Getenv("WEAVIATE_URL")
+	if url == "" || embed == nil {
+		return nil
+	}
+	class := os.Getenv("WEAVIATE_CLASS")
+	if class == "" {
+		class = "Content"
+	}
+	return &Weaviate{URL: url, Class: class, Embed: embed, HTTP: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Similar runs a nearVector query, reporting certainty as similarity.
+func (v *Weaviate) Similar(ctx context.Context, workspace, query string, limit int) (map[string]float64, error) {
+	vector, err := v.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	vec, _ := json.Marshal(vector)
+	ws, _ := json.Marshal(workspace)
+	graphql := fmt.Sprintf(`{ Get { %s(nearVector: {vector: %s}, limit: %d,
+		where: {path: ["workspace_id"], operator: Equal, valueText: %s}) {
+		content_id _additional { certainty } } } }`, v.Class, vec, limit, ws)
+	body, _ := json.Marshal(map[string]string{"query": graphql})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(v.URL, "/")+"/v1/graphql", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := v.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("weaviate returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Data struct {
+			Get map[string][]struct {
+				ContentID  string `json:"content_id"`
+				Additional struct {
+					Certainty float64 `json:"certainty"`
+				} `json:"_additional"`
+			} `json:"Get"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid response from weaviate: %w", err)
+	}
+	if len(out.Errors) > 0 {
+		return nil, fmt.Errorf("weaviate query failed: %s", out.Errors[0].Message)
+	}
+	similar := make(map[string]float64)
+	for _, obj := range out.Data.Get[v.Class] {
+		if obj.ContentID != "" {
+			similar[obj.ContentID] = obj.Additional.Certainty
+		}
+	}
+	return similar, nil
+}
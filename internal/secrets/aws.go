@@ -0,0 +1,148 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSProvider reads secrets from one AWS Secrets Manager secret whose
+// SecretString is a JSON object keyed by secret name. Requests are signed
+// with Signature Version 4 using static credentials.
+type AWSProvider struct {
+	Region       string
+	SecretID     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Endpoint     string // defaults to https://secretsmanager.<region>.amazonaws.com
+	Client       *http.Client
+}
+
+// NewAWSProvider configures Secrets Manager from AWS_REGION,
+// AWS_SECRET_ID and the standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN variables.
+func NewAWSProvider() (*AWSProvider, error) {
+	p := &AWSProvider{
+		Region:       os.Getenv("AWS_REGION"),
+		SecretID:     os.Getenv("AWS_SECRET_ID"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:     os.Getenv("AWS_SECRETS_ENDPOINT"),
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.Region == "" || p.SecretID == "" || p.AccessKey == "" || p.SecretKey == "" {
+		return nil, fmt.Errorf("aws secrets need AWS_REGION, AWS_SECRET_ID, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if p.Endpoint == "" {
+		p.Endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", p.Region)
+	}
+	return p, nil
+}
+
+func (p *AWSProvider) Get(ctx context.Context, name string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"SecretId": p.SecretID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, body)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if strings.Contains(string(msg), "ResourceNotFoundException") {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("secrets manager returned status %d: %s", resp.StatusCode, msg)
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("invalid secrets manager response: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(out.SecretString), &doc); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object", p.SecretID)
+	}
+	return lookupKey(doc, name)
+}
+
+// sign adds SigV4 authentication headers for the secretsmanager service.
+func (p *AWSProvider) sign(req *http.Request, body []byte) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+
+	payloadHash := sha256Hex(body)
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         req.URL.Host,
+		"x-amz-date":   amzDate,
+		"x-amz-target": req.Header.Get("X-Amz-Target"),
+	}
+	if p.SessionToken != "" {
+		headers["x-amz-security-token"] = p.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/secretsmanager/aws4_request", date, p.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+p.SecretKey), date)
+	key = hmacSHA256(key, p.Region)
+	key = hmacSHA256(key, "secretsmanager")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,185 @@
+// Package secrets resolves credentials such as POSTGRES_PASSWORD from a
+// configurable backend instead of plain environment variables.
+//
+// The backend is chosen with SECRETS_PROVIDER:
+//
+//	env    environment variables (default)
+//	file   files mounted by Docker or Kubernetes secrets
+//	vault  a HashiCorp Vault KV v2 secret
+//	aws    an AWS Secrets Manager secret holding a JSON object
+//
+// Whatever the backend, a secret it does not have falls back to the
+// environment, so non-sensitive settings keep working unchanged.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrNotFound is returned when a provider has no value for a secret.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider looks up secrets by their environment variable style name.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// EnvProvider reads secrets from environment variables.
+type EnvProvider struct{}
+
+func (EnvProvider) Get(_ context.Context, name string) (string, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, nil
+	}
+	return "", ErrNotFound
+}
+
+// FileProvider reads secrets from files. NAME_FILE, when set, is the path
+// of the file holding NAME; otherwise the lowercase name is looked up in
+// Dir, so POSTGRES_PASSWORD is read from /run/secrets/postgres_password.
+type FileProvider struct {
+	Dir string
+}
+
+func (p FileProvider) Get(_ context.Context, name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		path = filepath.Join(p.Dir, strings.ToLower(name))
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// fallback tries primary and then secondary when primary has no value.
+type fallback struct {
+	primary, secondary Provider
+}
+
+func (f fallback) Get(ctx context.Context, name string) (string, error) {
+	v, err := f.primary.Get(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return f.secondary.Get(ctx, name)
+	}
+	return v, err
+}
+
+type cached struct {
+	value   string
+	err     error
+	expires time.Time
+}
+
+// Cache memoizes lookups for a TTL so remote backends are not queried on
+// every connection, while rotated secrets are still picked up.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cached
+}
+
+// NewCache wraps p, keeping values for ttl.
+func NewCache(p Provider, ttl time.Duration) *Cache {
+	return &Cache{provider: p, ttl: ttl, entries: map[string]cached{}}
+}
+
+func (c *Cache) Get(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.value, e.err
+	}
+
+	v, err := c.provider.Get(ctx, name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		// Keep serving the last good value while the backend is failing
+		if ok && e.err == nil {
+			slog.Warn("failed to refresh secret, using cached value", "secret", name, "error", err)
+			return e.value, nil
+		}
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = cached{value: v, err: err, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return v, err
+}
+
+// Reload drops all cached values so the next lookups hit the backend.
+func (c *Cache) Reload() {
+	c.mu.Lock()
+	c.entries = map[string]cached{}
+	c.mu.Unlock()
+}
+
+// ReloadOnSIGHUP reloads the cache whenever the process receives SIGHUP.
+func (c *Cache) ReloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			slog.Info("SIGHUP received, reloading secrets")
+			c.Reload()
+		}
+	}()
+}
+
+// FromEnv builds the provider selected by SECRETS_PROVIDER, falling back to
+// the environment and cached for SECRETS_TTL (default 5m).
+func FromEnv() (*Cache, error) {
+	var primary Provider
+	switch kind := os.Getenv("SECRETS_PROVIDER"); kind {
+	case "", "env":
+		primary = EnvProvider{}
+	case "file":
+		dir := os.Getenv("SECRETS_DIR")
+		if dir == "" {
+			dir = "/run/secrets"
+		}
+		primary = FileProvider{Dir: dir}
+	case "vault":
+		p, err := NewVaultProvider()
+		if err != nil {
+			return nil, err
+		}
+		primary = p
+	case "aws":
+		p, err := NewAWSProvider()
+		if err != nil {
+			return nil, err
+		}
+		primary = p
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q", kind)
+	}
+
+	ttl := 5 * time.Minute
+	if v, err := time.ParseDuration(os.Getenv("SECRETS_TTL")); err == nil && v > 0 {
+		ttl = v
+	}
+
+	var p Provider = primary
+	if _, isEnv := primary.(EnvProvider); !isEnv {
+		p = fallback{primary: primary, secondary: EnvProvider{}}
+	}
+	return NewCache(p, ttl), nil
+}
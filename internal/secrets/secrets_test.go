@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "postgres_password"), []byte("s3cret\n"), 0600)
+	custom := filepath.Join(dir, "custom")
+	os.WriteFile(custom, []byte("from-file-env"), 0600)
+	t.Setenv("REDIS_PASSWORD_FILE", custom)
+
+	p := FileProvider{Dir: dir}
+	if v, err := p.Get(context.Background(), "POSTGRES_PASSWORD"); err != nil || v != "s3cret" {
+		t.Errorf("Expected s3cret, got %q (%v)", v, err)
+	}
+	if v, err := p.Get(context.Background(), "REDIS_PASSWORD"); err != nil || v != "from-file-env" {
+		t.Errorf("Expected NAME_FILE to win, got %q (%v)", v, err)
+	}
+	if _, err := p.Get(context.Background(), "MISSING"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+type countingProvider struct {
+	calls int
+	value string
+	err   error
+}
+
+func (p *countingProvider) Get(context.Context, string) (string, error) {
+	p.calls++
+	return p.value, p.err
+}
+
+func TestCacheTTLAndReload(t *testing.T) {
+	backend := &countingProvider{value: "v1"}
+	c := NewCache(backend, time.Hour)
+
+	c.Get(context.Background(), "A")
+	c.Get(context.Background(), "A")
+	if backend.calls != 1 {
+		t.Fatalf("Expected cached lookups, got %d backend calls", backend.calls)
+	}
+
+	backend.value = "v2"
+	c.Reload()
+	if v, _ := c.Get(context.Background(), "A"); v != "v2" {
+		t.Errorf("Expected rotated value after reload, got %q", v)
+	}
+}
+
+func TestCacheServesStaleOnBackendError(t *testing.T) {
+	backend := &countingProvider{value: "good"}
+	c := NewCache(backend, time.Nanosecond)
+	c.Get(context.Background(), "A")
+
+	time.Sleep(time.Millisecond)
+	backend.err = errors.New("vault sealed")
+	if v, err := c.Get(context.Background(), "A"); err != nil || v != "good" {
+		t.Errorf("Expected last good value while backend fails, got %q (%v)", v, err)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/selin" || r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"postgres_password":"from-vault"}}}`))
+	}))
+	defer vault.Close()
+
+	p := &VaultProvider{Addr: vault.URL, Token: "token", Path: "secret/data/selin", Client: vault.Client()}
+	if v, err := p.Get(context.Background(), "POSTGRES_PASSWORD"); err != nil || v != "from-vault" {
+		t.Errorf("Expected from-vault, got %q (%v)", v, err)
+	}
+	if _, err := p.Get(context.Background(), "REDIS_PASSWORD"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAWSProvider(t *testing.T) {
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			http.Error(w, "bad target", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"SecretString":"{\"POSTGRES_PASSWORD\":\"from-aws\"}"}`))
+	}))
+	defer aws.Close()
+
+	p := &AWSProvider{Region: "eu-west-1", SecretID: "selin", AccessKey: "AKID", SecretKey: "secret", Endpoint: aws.URL, Client: aws.Client()}
+	if v, err := p.Get(context.Background(), "POSTGRES_PASSWORD"); err != nil || v != "from-aws" {
+		t.Errorf("Expected from-aws, got %q (%v)", v, err)
+	}
+}
+
+func TestFromEnvFallsBackToEnvironment(t *testing.T) {
+	t.Setenv("SECRETS_PROVIDER", "file")
+	t.Setenv("SECRETS_DIR", t.TempDir())
+	t.Setenv("POSTGRES_USER", "postgres")
+
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get(context.Background(), "POSTGRES_USER"); err != nil || v != "postgres" {
+		t.Errorf("Expected environment fallback, got %q (%v)", v, err)
+	}
+
+	t.Setenv("SECRETS_PROVIDER", "keychain")
+	if _, err := FromEnv(); err == nil {
+		t.Error("Expected an unknown provider to be rejected")
+	}
+}
@@ -0,0 +1,83 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultProvider reads secrets from one Vault KV v2 secret whose keys are
+// the secret names, e.g. POSTGRES_PASSWORD (or postgres_password).
+type VaultProvider struct {
+	Addr   string // e.g. https://vault.internal:8200
+	Token  string
+	Path   string // KV v2 data path, e.g. secret/data/selin
+	Client *http.Client
+}
+
+// NewVaultProvider configures Vault from VAULT_ADDR, VAULT_TOKEN (or
+// VAULT_TOKEN_FILE) and VAULT_SECRET_PATH.
+func NewVaultProvider() (*VaultProvider, error) {
+	p := &VaultProvider{
+		Addr:   strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		Token:  os.Getenv("VAULT_TOKEN"),
+		Path:   strings.Trim(os.Getenv("VAULT_SECRET_PATH"), "/"),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.Token == "" {
+		if token, err := (FileProvider{}).Get(context.Background(), "VAULT_TOKEN"); err == nil {
+			p.Token = token
+		}
+	}
+	if p.Addr == "" || p.Token == "" || p.Path == "" {
+		return nil, fmt.Errorf("vault secrets need VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+	}
+	return p, nil
+}
+
+func (p *VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Addr+"/v1/"+p.Path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %v", err)
+	}
+	return lookupKey(body.Data.Data, name)
+}
+
+// lookupKey finds name, or its lowercase form, in a secret document.
+func lookupKey(doc map[string]interface{}, name string) (string, error) {
+	for _, key := range []string{name, strings.ToLower(name)} {
+		if v, ok := doc[key]; ok {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return fmt.Sprint(v), nil
+		}
+	}
+	return "", ErrNotFound
+}
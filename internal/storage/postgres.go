@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"selin/internal/search"
+	"selin/internal/tokenizer"
+)
+
+// Postgres is the production store, on the schema in
+// scripts/init-database.sql.
+type Postgres struct {
+	db *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) SaveContent(ctx context.Context, c Content) (string, bool, error) {
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	if c.Tags == nil {
+		c.Tags = []string{}
+	}
+	if c.Tokens == 0 {
+		c.Tokens = tokenizer.Default().Count(c.Summary)
+	}
+	// Re-collected content keeps its feedback adjustment on top of the
+	// new score
+	var inserted bool
+	err := p.db.QueryRowContext(ctx, `
+		INSERT INTO content_metadata (
+			id, source_url, author, timestamp, tags, content_type,
+			source_platform, language, content_summary, relevance_score, base_relevance_score, workspace_id, token_count,
+			visibility, license
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, $11, $12, COALESCE(NULLIF($13, ''), 'private'), $14)
+		ON CONFLICT (workspace_id, source_url) DO UPDATE SET
+			relevance_score = LEAST(GREATEST(EXCLUDED.relevance_score + content_metadata.feedback_adjustment, 0), 1),
+			base_relevance_score = EXCLUDED.relevance_score,
+			updated_at = now()
+		RETURNING id, (xmax = 0) AS inserted`,
+		c.ID, c.SourceURL, c.Author, c.Timestamp, pq.Array(c.Tags), c.ContentType,
+		c.SourcePlatform, c.Language, c.Summary, c.RelevanceScore, c.Workspace, c.Tokens,
+		c.Visibility, c.License,
+	).Scan(&c.ID, &inserted)
+	return c.ID, inserted, err
+}
+
+func (p *Postgres) Search(ctx context.Context, req search.SearchRequest) (*search.SearchResult, error) {
+	return search.Search(ctx, p.db, req)
+}
+
+func (p *Postgres) Get(ctx context.Context, workspace, id string) (*search.Item, error) {
+	return search.Get(ctx, p.db, workspace, id)
+}
+
+func (p *Postgres) Tags(ctx context.Context, workspace string, limit int) ([]search.TagCount, error) {
+	return search.Tags(ctx, p.db, workspace, limit)
+}
+
+func (p *Postgres) Stored(ctx context.Context, workspace, sourceURL string) (bool, error) {
+	var exists bool
+	err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM content_metadata WHERE workspace_id = $1 AND source_url = $2)`,
+		workspace, sourceURL).Scan(&exists)
+	return exists, err
+}
+
+func (p *Postgres) Progress(ctx context.Context, workspace, topic string) (*Progress, error) {
+	pr := Progress{Topic: topic}
+	err := p.db.QueryRowContext(ctx, `
+		SELECT skill_level, progress_score, total_content_consumed, total_queries, last_updated
+		FROM learning_progress
+		WHERE workspace_id = $1 AND topic = $2`, workspace, topic).
+		Scan(&pr.SkillLevel, &pr.Score, &pr.ContentConsumed, &pr.Queries, &pr.LastUpdated)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (p *Postgres) TrackTopic(ctx context.Context, workspace, topic string) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO learning_progress (workspace_id, topic)
+		SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM learning_progress WHERE workspace_id = $1 AND topic = $2)`,
+		workspace, topic)
+	return err
+}
+
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
@@ -0,0 +1,51 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration ./storage (needs a Docker daemon)
+
+func TestPostgresStore(t *testing.T) {
+	db := testenv.Postgres(t)
+	testStore(t, func(t *testing.T) Store {
+		if _, err := db.Exec(`TRUNCATE content_metadata, learning_progress CASCADE`); err != nil {
+			t.Fatal(err)
+		}
+		return NewPostgres(db)
+	})
+}
+
+func TestPostgresKeepsFeedbackAdjustment(t *testing.T) {
+	db := testenv.Postgres(t)
+	if _, err := db.Exec(`TRUNCATE content_metadata CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	s := NewPostgres(db)
+	ctx := context.Background()
+	c := Content{Workspace: "default", SourceURL: "https://example.com/a", Summary: "First", RelevanceScore: 0.5}
+	id, _, err := s.SaveContent(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE content_metadata SET relevance_score = 0.6, feedback_adjustment = 0.1 WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	c.RelevanceScore = 0.95
+	if _, _, err := s.SaveContent(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	var score, base float64
+	if err := db.QueryRow(`SELECT relevance_score, base_relevance_score FROM content_metadata WHERE id = $1`, id).Scan(&score, &base); err != nil {
+		t.Fatal(err)
+	}
+	if score != 1 || base < 0.949 || base > 0.951 {
+		t.Errorf("Expected the adjustment kept over the new score, clamped, got %v over a base of %v", score, base)
+	}
+}
@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+
+	"selin/internal/search"
+	"selin/internal/tokenizer"
+)
+
+// sqliteSchema is the subset of the Postgres schema the Store needs. Tags
+// are JSON arrays and times are UTC text in sqliteTime, which sorts
+// chronologically.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS content_metadata (
+  id TEXT PRIMARY KEY,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  source_url TEXT NOT NULL,
+  author TEXT,
+  timestamp TEXT,
+  tags TEXT NOT NULL DEFAULT '[]',
+  content_type TEXT,
+  source_platform TEXT,
+  language TEXT,
+  content_summary TEXT,
+  relevance_score REAL,
+  token_count INTEGER,
+  created_at TEXT NOT NULL,
+  updated_at TEXT NOT NULL,
+  UNIQUE (workspace_id, source_url)
+);
+
+CREATE TABLE IF NOT EXISTS learning_progress (
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  topic TEXT NOT NULL,
+  skill_level TEXT NOT NULL DEFAULT 'beginner',
+  progress_score REAL NOT NULL DEFAULT 0,
+  total_content_consumed INTEGER NOT NULL DEFAULT 0,
+  total_queries INTEGER NOT NULL DEFAULT 0,
+  last_updated TEXT NOT NULL,
+  PRIMARY KEY (workspace_id, topic)
+);`
+
+// sqliteAddedColumns are the content_metadata columns added to
+// sqliteSchema after it was first released.
+var sqliteAddedColumns = []string{
+	"token_count INTEGER",
+	"visibility TEXT NOT NULL DEFAULT 'private'",
+	"license TEXT NOT NULL DEFAULT ''",
+}
+
+const sqliteTime = "2006-01-02 15:04:05.000000"
+
+// sqliteTags is a row's tags as comma separated text, the form the
+// Postgres search matches against.
+const sqliteTags = "COALESCE((SELECT group_concat(value, ',') FROM json_each(tags)), '')"
+
+const sqliteItemColumns = `
+	id, source_url, COALESCE(author, ''), COALESCE(timestamp, created_at), ` + sqliteTags + `,
+	COALESCE(content_type, ''), COALESCE(source_platform, ''), COALESCE(content_summary, ''),
+	COALESCE(relevance_score, 0), COALESCE(token_count, 0), visibility, license`
+
+// SQLite is the embedded store for local development and tests.
+type SQLite struct {
+	db     *sql.DB
+	shared bool // opened by Open, which keeps it for the process
+}
+
+// OpenSQLite opens or creates the database at path (":memory:" for a
+// throwaway one) and creates the schema.
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// One connection: SQLite serializes writers anyway, and each
+	// connection to ":memory:" would get its own database
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %v", err)
+	}
+	// Columns added since, for databases created before them
+	for _, column := range sqliteAddedColumns {
+		if _, err := db.Exec("ALTER TABLE content_metadata ADD COLUMN " + column); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("failed to update sqlite schema: %v", err)
+		}
+	}
+	return &SQLite{db: db}, nil
+}
+
+func sqliteNow() string {
+	return time.Now().UTC().Format(sqliteTime)
+}
+
+func (s *SQLite) SaveContent(ctx context.Context, c Content) (string, bool, error) {
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	tags := c.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	if c.Tokens == 0 {
+		c.Tokens = tokenizer.Default().Count(c.Summary)
+	}
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return "", false, err
+	}
+	var timestamp interface{}
+	if !c.Timestamp.IsZero() {
+		timestamp = c.Timestamp.UTC().Format(sqliteTime)
+	}
+
+	var id string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO content_metadata (
+			id, source_url, author, timestamp, tags, content_type, source_platform,
+			language, content_summary, relevance_score, workspace_id, token_count, created_at, updated_at,
+			visibility, license
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $13, COALESCE(NULLIF($14, ''), 'private'), $15)
+		ON CONFLICT (workspace_id, source_url) DO UPDATE SET
+			relevance_score = excluded.relevance_score,
+			updated_at = excluded.updated_at
+		RETURNING id`,
+		c.ID, c.SourceURL, c.Author, timestamp, string(tagsJSON), c.ContentType, c.SourcePlatform,
+		c.Language, c.Summary, c.RelevanceScore, c.Workspace, c.Tokens, sqliteNow(), c.Visibility, c.License).Scan(&id)
+	if err != nil {
+		return "", false, err
+	}
+	// An update keeps the stored row's ID
+	return id, id == c.ID, nil
+}
+
+// sqliteQuery collects conditions and their numbered arguments.
+type sqliteQuery struct {
+	conds []string
+	args  []interface{}
+}
+
+func (q *sqliteQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// sqliteFacetQuery mirrors the Postgres facet query; timestamps are text
+// starting with the date, so the month is their first seven characters.
+const sqliteFacetQuery = `
+	WITH matched AS (SELECT source_platform, content_type, tags, COALESCE(timestamp, created_at) AS published
+		FROM content_metadata%s)
+	SELECT '', '', COUNT(*) FROM matched
+	UNION ALL SELECT 'platform', COALESCE(source_platform, ''), COUNT(*) FROM matched GROUP BY 2
+	UNION ALL SELECT 'content_type', COALESCE(content_type, ''), COUNT(*) FROM matched GROUP BY 2
+	UNION ALL SELECT 'tag', t.value, COUNT(*) FROM matched, json_each(matched.tags) AS t GROUP BY 2
+	UNION ALL SELECT 'month', substr(published, 1, 7), COUNT(*) FROM matched GROUP BY 2`
+
+func (s *SQLite) Search(ctx context.Context, req search.SearchRequest) (*search.SearchResult, error) {
+	q := &sqliteQuery{}
+	q.conds = append(q.conds, "workspace_id = "+q.arg(req.Workspace))
+	text := strings.TrimSpace(req.Query)
+	if text != "" {
+		pattern := q.arg("%" + text + "%")
+		q.conds = append(q.conds, fmt.Sprintf("(content_summary LIKE %[1]s OR %[2]s LIKE %[1]s)", pattern, sqliteTags))
+	}
+	for _, tag := range req.Tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			q.conds = append(q.conds, "EXISTS (SELECT 1 FROM json_each(tags) WHERE value = "+q.arg(tag)+")")
+		}
+	}
+	if req.Platform != "" && req.Platform != "all" {
+		q.conds = append(q.conds, "source_platform = "+q.arg(req.Platform))
+	}
+	if req.Visibility != "" && req.Visibility != "all" {
+		q.conds = append(q.conds, "visibility = "+q.arg(req.Visibility))
+	}
+	if !req.Since.IsZero() {
+		q.conds = append(q.conds, "COALESCE(timestamp, created_at) >= "+q.arg(req.Since.UTC().Format(sqliteTime)))
+	}
+	if len(req.IDs) > 0 {
+		placeholders := make([]string, len(req.IDs))
+		for i, id := range req.IDs {
+			placeholders[i] = q.arg(id)
+		}
+		q.conds = append(q.conds, "id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	where := " WHERE " + strings.Join(q.conds, " AND ")
+
+	limit, offset := req.Page()
+	result := &search.SearchResult{Items: []search.Item{}, Limit: limit, Offset: offset}
+	if req.Facets {
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(sqliteFacetQuery, where), q.args...)
+		if err != nil {
+			return nil, err
+		}
+		if result.Total, result.Facets, err = search.ScanFacets(rows); err != nil {
+			return nil, err
+		}
+	} else if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM content_metadata"+where, q.args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	rank := "COALESCE(relevance_score, 0)"
+	if text != "" {
+		rank = fmt.Sprintf(`%s * CASE
+			WHEN EXISTS (SELECT 1 FROM json_each(tags) WHERE lower(value) = %s) THEN %v
+			WHEN %s LIKE %s THEN %v
+			ELSE %v END`,
+			rank, q.arg(strings.ToLower(text)), search.ExactTagWeight,
+			sqliteTags, q.arg("%"+text+"%"), search.TagWeight, search.SummaryWeight)
+	}
+	if req.HalfLife > 0 {
+		rank = fmt.Sprintf("(%s) * pow(0.5, max(julianday('now') - julianday(COALESCE(timestamp, created_at)), 0) * 86400 / %s)",
+			rank, q.arg(req.HalfLife.Seconds()))
+	}
+	if req.Staleness != nil && len(req.Staleness.Rules) > 0 {
+		factors := []string{"1.0"}
+		for _, r := range req.Staleness.Rules {
+			factors = append(factors, fmt.Sprintf(
+				"CASE WHEN EXISTS (SELECT 1 FROM json_each(tags) WHERE value = %s) AND julianday(COALESCE(timestamp, created_at)) < julianday('now', %s) THEN %s ELSE 1.0 END",
+				q.arg(r.Tag), q.arg(fmt.Sprintf("-%d months", r.MaxAgeMonths)), q.arg(r.Penalty)))
+		}
+		rank = fmt.Sprintf("(%s) * min(%s)", rank, strings.Join(factors, ", "))
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT"+sqliteItemColumns+", "+rank+" AS score FROM content_metadata"+where+
+		" ORDER BY score DESC, created_at DESC, id LIMIT "+q.arg(limit)+" OFFSET "+q.arg(offset), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item search.Item
+		if err := scanSQLiteItem(rows, &item, &item.Score); err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	req.Staleness.Flag(result.Items, time.Now())
+
+	if next := offset + len(result.Items); next < result.Total && len(result.Items) > 0 {
+		result.NextOffset = &next
+	}
+	if req.Collapse {
+		result.Items = search.Collapse(result.Items)
+	}
+	return result, nil
+}
+
+func (s *SQLite) Get(ctx context.Context, workspace, id string) (*search.Item, error) {
+	var item search.Item
+	err := scanSQLiteItem(s.db.QueryRowContext(ctx,
+		"SELECT"+sqliteItemColumns+" FROM content_metadata WHERE workspace_id = $1 AND id = $2", workspace, id), &item)
+	if err == sql.ErrNoRows {
+		return nil, search.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	item.Score = item.RelevanceScore
+	return &item, nil
+}
+
+func (s *SQLite) Tags(ctx context.Context, workspace string, limit int) ([]search.TagCount, error) {
+	limit, _ = search.SearchRequest{Limit: limit}.Page()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.value, COUNT(*) FROM content_metadata, json_each(content_metadata.tags) AS t
+		WHERE workspace_id = $1
+		GROUP BY t.value ORDER BY COUNT(*) DESC, t.value LIMIT $2`, workspace, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []search.TagCount{}
+	for rows.Next() {
+		var tc search.TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+	return tags, rows.Err()
+}
+
+func (s *SQLite) Stored(ctx context.Context, workspace, sourceURL string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM content_metadata WHERE workspace_id = $1 AND source_url = $2)`,
+		workspace, sourceURL).Scan(&exists)
+	return exists, err
+}
+
+func (s *SQLite) Progress(ctx context.Context, workspace, topic string) (*Progress, error) {
+	pr := Progress{Topic: topic}
+	var updated string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT skill_level, progress_score, total_content_consumed, total_queries, last_updated
+		FROM learning_progress
+		WHERE workspace_id = $1 AND topic = $2`, workspace, topic).
+		Scan(&pr.SkillLevel, &pr.Score, &pr.ContentConsumed, &pr.Queries, &updated)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pr.LastUpdated, err = time.Parse(sqliteTime, updated); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (s *SQLite) TrackTopic(ctx context.Context, workspace, topic string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO learning_progress (workspace_id, topic, last_updated) VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, topic) DO NOTHING`, workspace, topic, sqliteNow())
+	return err
+}
+
+// Close closes the database, unless it is the process-wide one from Open.
+func (s *SQLite) Close() error {
+	if s.shared {
+		return nil
+	}
+	return s.db.Close()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSQLiteItem reads sqliteItemColumns, then any extra columns into extra.
+func scanSQLiteItem(row scanner, item *search.Item, extra ...interface{}) error {
+	var timestamp, tags string
+	dest := append([]interface{}{&item.ID, &item.SourceURL, &item.Author, &timestamp, &tags,
+		&item.ContentType, &item.SourcePlatform, &item.ContentSummary, &item.RelevanceScore, &item.TokenCount,
+		&item.Visibility, &item.License}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	t, err := time.Parse(sqliteTime, timestamp)
+	if err != nil {
+		return err
+	}
+	item.Timestamp = t
+	item.Tags = []string{}
+	if tags != "" {
+		item.Tags = strings.Split(tags, ",")
+	}
+	return nil
+}
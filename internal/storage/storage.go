@@ -0,0 +1,131 @@
+// Package storage puts the core content operations (storing collected
+// content, searching it, reading learning progress) behind one interface,
+// so services can run on an embedded SQLite database instead of Postgres.
+//
+// STORAGE_DRIVER selects the backend: "postgres" (the default) or "sqlite",
+// which keeps everything in the file named by SQLITE_PATH and needs neither
+// Docker nor cgo. SQLite is meant for local development and tests; features
+// beyond the Store interface (revisions, tag aliases, the concept graph,
+// analytics) need Postgres, and services skip them on other drivers.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"selin/internal/config"
+	"selin/internal/search"
+)
+
+// ErrNotFound is returned by Progress for topics that are not tracked.
+var ErrNotFound = errors.New("not found")
+
+// Content is an item to store, as produced by a collector.
+type Content struct {
+	// ID is used for new items; one is generated when empty.
+	ID             string
+	Workspace      string
+	SourceURL      string
+	Author         string
+	Timestamp      time.Time
+	Tags           []string
+	ContentType    string
+	SourcePlatform string
+	Language       string
+	Summary        string
+	RelevanceScore float64
+	// Visibility is search.VisibilityPublic or search.VisibilityPrivate;
+	// content is private unless its source says otherwise.
+	Visibility string
+	// License is the terms the content came under, when known.
+	License string
+	// Tokens is the length of the item's text in tokens, such as the sum
+	// of its chunks; when 0, the summary's is stored.
+	Tokens int
+}
+
+// Progress is a workspace's learning progress on one topic.
+type Progress struct {
+	Topic           string    `json:"topic"`
+	SkillLevel      string    `json:"skill_level"`
+	Score           float64   `json:"progress_score"`
+	ContentConsumed int       `json:"total_content_consumed"`
+	Queries         int       `json:"total_queries"`
+	LastUpdated     time.Time `json:"last_updated"`
+}
+
+type Store interface {
+	// SaveContent stores c. Content already stored from the same URL in the
+	// workspace only gets its relevance score updated; the returned ID is
+	// the stored item's and inserted reports whether it is new.
+	SaveContent(ctx context.Context, c Content) (id string, inserted bool, err error)
+	// Search, Get and Tags behave like their search package counterparts.
+	Search(ctx context.Context, req search.SearchRequest) (*search.SearchResult, error)
+	Get(ctx context.Context, workspace, id string) (*search.Item, error)
+	Tags(ctx context.Context, workspace string, limit int) ([]search.TagCount, error)
+	// Stored reports whether content from sourceURL is stored in the
+	// workspace.
+	Stored(ctx context.Context, workspace, sourceURL string) (bool, error)
+	// Progress returns a topic's progress, or ErrNotFound.
+	Progress(ctx context.Context, workspace, topic string) (*Progress, error)
+	// TrackTopic starts tracking progress on a topic; tracked topics are
+	// left alone.
+	TrackTopic(ctx context.Context, workspace, topic string) error
+	Close() error
+}
+
+var (
+	sqliteMu     sync.Mutex
+	sqliteShared = map[string]*SQLite{}
+)
+
+// Open opens the store selected by STORAGE_DRIVER. application names the
+// component in Postgres, as in config.PostgresDSN.
+//
+// Postgres stores are opened per call, like the services' other
+// connections. SQLite stores are shared per file for the life of the
+// process, and closing them is a no-op.
+func Open(application string) (Store, error) {
+	switch driver := Driver(); driver {
+	case "postgres":
+		db, err := sql.Open("postgres", config.PostgresDSN(application))
+		if err != nil {
+			return nil, err
+		}
+		return NewPostgres(db), nil
+	case "sqlite":
+		path := config.Env("SQLITE_PATH", "selin.db")
+		sqliteMu.Lock()
+		defer sqliteMu.Unlock()
+		if s, ok := sqliteShared[path]; ok {
+			return s, nil
+		}
+		s, err := OpenSQLite(path)
+		if err != nil {
+			return nil, err
+		}
+		s.shared = true
+		sqliteShared[path] = s
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q: use postgres or sqlite", driver)
+	}
+}
+
+// Driver is the configured STORAGE_DRIVER.
+func Driver() string {
+	return config.Env("STORAGE_DRIVER", "postgres")
+}
+
+// PostgresDB returns the database behind a Postgres store, for the features
+// only Postgres has. ok is false for other drivers.
+func PostgresDB(s Store) (db *sql.DB, ok bool) {
+	if p, ok := s.(*Postgres); ok {
+		return p.db, true
+	}
+	return nil, false
+}
@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"selin/internal/search"
+)
+
+func openTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	s, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+type row struct {
+	workspace, summary string
+	tags               []string
+	platform           string
+	score              float64
+	published          time.Time
+}
+
+func save(t *testing.T, s Store, r row) string {
+	t.Helper()
+	if r.workspace == "" {
+		r.workspace = "default"
+	}
+	if r.platform == "" {
+		r.platform = "reddit"
+	}
+	if r.published.IsZero() {
+		r.published = time.Now()
+	}
+	// As the collectors set it; anything else is left private by default
+	var visibility string
+	if r.platform == "reddit" {
+		visibility = search.VisibilityPublic
+	}
+	id, inserted, err := s.SaveContent(context.Background(), Content{
+		Workspace:      r.workspace,
+		SourceURL:      "https://example.com/" + r.workspace + "/" + r.summary,
+		Timestamp:      r.published,
+		Tags:           r.tags,
+		SourcePlatform: r.platform,
+		Summary:        r.summary,
+		RelevanceScore: r.score,
+		Visibility:     visibility,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted {
+		t.Fatalf("Expected %q to be new", r.summary)
+	}
+	return id
+}
+
+// testStore runs the Store tests against the stores open returns, which
+// must be empty.
+func testStore(t *testing.T, open func(t *testing.T) Store) {
+	t.Run("search", func(t *testing.T) { testSearch(t, open(t)) })
+	t.Run("recency decay", func(t *testing.T) { testRecencyDecay(t, open(t)) })
+	t.Run("staleness", func(t *testing.T) { testStaleness(t, open(t)) })
+	t.Run("facets", func(t *testing.T) { testFacets(t, open(t)) })
+	t.Run("save updates score", func(t *testing.T) { testSaveContentUpdatesScore(t, open(t)) })
+	t.Run("stored", func(t *testing.T) { testStored(t, open(t)) })
+	t.Run("progress", func(t *testing.T) { testProgress(t, open(t)) })
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return openTestSQLite(t) })
+}
+
+// The same cases as the search package's Postgres test, so both stores
+// rank and filter alike
+func testSearch(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	exact := save(t, s, row{summary: "Validator set changes", tags: []string{"cosmos", "golang"}, score: 0.8})
+	partial := save(t, s, row{summary: "Module wiring", tags: []string{"cosmos-sdk"}, score: 0.8})
+	summary := save(t, s, row{summary: "Why Cosmos chains use IBC", tags: []string{"ibc"}, score: 0.9, platform: "slack"})
+	old := save(t, s, row{summary: "Cosmos retrospective", tags: []string{"history"}, score: 0.5,
+		published: time.Now().AddDate(-2, 0, 0)})
+	save(t, s, row{workspace: "other", summary: "Cosmos in another workspace", tags: []string{"cosmos"}, score: 1})
+
+	t.Run("ranks exact tags over partial tags over summaries", func(t *testing.T) {
+		result, err := s.Search(ctx, search.SearchRequest{Workspace: "default", Query: "cosmos"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 4 {
+			t.Fatalf("Expected 4 matches in the workspace, got %d", result.Total)
+		}
+		want := []string{exact, partial, summary, old}
+		for i, id := range want {
+			if result.Items[i].ID != id {
+				t.Errorf("Position %d: expected %s, got %s (%+v)", i, id, result.Items[i].ID, result.Items[i])
+			}
+		}
+		if result.NextOffset != nil {
+			t.Errorf("Expected no next page, got %d", *result.NextOffset)
+		}
+	})
+
+	t.Run("paginates", func(t *testing.T) {
+		first, err := s.Search(ctx, search.SearchRequest{Workspace: "default", Query: "cosmos", Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(first.Items) != 3 || first.NextOffset == nil || *first.NextOffset != 3 {
+			t.Fatalf("Unexpected first page: %d items, next %v", len(first.Items), first.NextOffset)
+		}
+		second, err := s.Search(ctx, search.SearchRequest{Workspace: "default", Query: "cosmos", Limit: 3, Offset: *first.NextOffset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(second.Items) != 1 || second.Items[0].ID != old || second.NextOffset != nil {
+			t.Errorf("Unexpected second page: %+v", second)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		tests := []struct {
+			name string
+			req  search.SearchRequest
+			want int
+		}{
+			{"tags", search.SearchRequest{Tags: []string{"Cosmos", "golang"}}, 1},
+			{"platform", search.SearchRequest{Platform: "slack"}, 1},
+			{"visibility", search.SearchRequest{Visibility: search.VisibilityPrivate}, 1},
+			{"all visibilities", search.SearchRequest{Visibility: "all"}, 4},
+			{"since", search.SearchRequest{Since: time.Now().AddDate(-1, 0, 0)}, 3},
+			{"ids", search.SearchRequest{Query: "cosmos", IDs: []string{partial, old}}, 2},
+			{"no match", search.SearchRequest{Query: "solana"}, 0},
+		}
+		for _, tt := range tests {
+			tt.req.Workspace = "default"
+			result, err := s.Search(ctx, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != tt.want || len(result.Items) != tt.want {
+				t.Errorf("%s: expected %d results, got %d (%d items)", tt.name, tt.want, result.Total, len(result.Items))
+			}
+		}
+	})
+
+	t.Run("get and tags", func(t *testing.T) {
+		item, err := s.Get(ctx, "default", exact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.ContentSummary != "Validator set changes" || len(item.Tags) != 2 {
+			t.Errorf("Unexpected item: %+v", item)
+		}
+		if item.TokenCount != 6 {
+			t.Errorf("Expected the summary's token count stored, got %d", item.TokenCount)
+		}
+		if item.Visibility != search.VisibilityPublic {
+			t.Errorf("Expected the visibility stored, got %q", item.Visibility)
+		}
+		if item, err := s.Get(ctx, "default", summary); err != nil || item.Visibility != search.VisibilityPrivate {
+			t.Errorf("Expected content private by default, got %+v (%v)", item, err)
+		}
+		if _, err := s.Get(ctx, "other", exact); err != search.ErrNotFound {
+			t.Errorf("Expected other workspaces to get ErrNotFound, got %v", err)
+		}
+
+		tags, err := s.Tags(ctx, "default", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 5 || tags[0].Count != 1 {
+			t.Errorf("Unexpected tags: %+v", tags)
+		}
+	})
+}
+
+func testRecencyDecay(t *testing.T, s Store) {
+	ctx := context.Background()
+	stale := save(t, s, row{summary: "Cosmos SDK v0.45 upgrade guide", tags: []string{"cosmos"}, score: 0.9,
+		published: time.Now().AddDate(0, 0, -180)})
+	fresh := save(t, s, row{summary: "Cosmos SDK v0.50 upgrade guide", tags: []string{"cosmos"}, score: 0.6,
+		published: time.Now().AddDate(0, 0, -1)})
+
+	order := func(halfLife time.Duration) []string {
+		t.Helper()
+		result, err := s.Search(ctx, search.SearchRequest{Workspace: "default", Query: "cosmos", HalfLife: halfLife})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, item := range result.Items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	if ids := order(0); len(ids) != 2 || ids[0] != stale {
+		t.Errorf("Without decay, expected the higher score first, got %v", ids)
+	}
+	// 180 days is three 60 day half-lives: 0.9 decays to about 0.11
+	if ids := order(60 * 24 * time.Hour); len(ids) != 2 || ids[0] != fresh {
+		t.Errorf("With decay, expected the newer item first, got %v", ids)
+	}
+}
+
+func testStaleness(t *testing.T, s Store) {
+	ctx := context.Background()
+	stale := save(t, s, row{summary: "Kubernetes 1.20 upgrade notes", tags: []string{"kubernetes"}, score: 0.9,
+		published: time.Now().AddDate(-2, 0, 0)})
+	current := save(t, s, row{summary: "Kubernetes gateway API", tags: []string{"kubernetes"}, score: 0.6,
+		published: time.Now().AddDate(0, -1, 0)})
+
+	req := search.SearchRequest{Workspace: "default", Query: "kubernetes", Staleness: search.DefaultStaleness()}
+	result, err := s.Search(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Items) != 2 || result.Items[0].ID != current || result.Items[1].ID != stale {
+		t.Fatalf("Expected the stale item ranked below the current one, got %+v", result.Items)
+	}
+	if result.Items[0].PossiblyOutdated != nil || result.Items[1].PossiblyOutdated == nil || result.Items[1].PossiblyOutdated.Tag != "kubernetes" {
+		t.Errorf("Expected only the stale item flagged, got %+v", result.Items)
+	}
+}
+
+func testFacets(t *testing.T, s Store) {
+	ctx := context.Background()
+	march := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	april := time.Date(2026, 4, 2, 12, 0, 0, 0, time.UTC)
+	save(t, s, row{summary: "Cosmos IBC relayers", tags: []string{"cosmos", "ibc"}, score: 0.9, published: march})
+	save(t, s, row{summary: "Cosmos SDK modules", tags: []string{"cosmos", "sdk"}, score: 0.8, published: april})
+	save(t, s, row{summary: "Cosmos validator setup", tags: []string{"cosmos"}, platform: "hackernews", score: 0.7, published: april})
+	save(t, s, row{summary: "Go generics", tags: []string{"golang"}, score: 0.6, published: april})
+
+	result, err := s.Search(ctx, search.SearchRequest{Workspace: "default", Query: "cosmos", Limit: 1, Facets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 || len(result.Items) != 1 || result.Facets == nil {
+		t.Fatalf("Expected one of 3 matches with facets, got %+v", result)
+	}
+	f := result.Facets
+	// Facets count every match, not just the page
+	if len(f.Platforms) != 2 || f.Platforms[0] != (search.FacetCount{Value: "reddit", Count: 2}) ||
+		f.Platforms[1] != (search.FacetCount{Value: "hackernews", Count: 1}) {
+		t.Errorf("Unexpected platform facet: %+v", f.Platforms)
+	}
+	if len(f.Tags) != 3 || f.Tags[0] != (search.FacetCount{Value: "cosmos", Count: 3}) || f.Tags[1].Value != "ibc" {
+		t.Errorf("Unexpected tag facet: %+v", f.Tags)
+	}
+	if len(f.Months) != 2 || f.Months[0] != (search.FacetCount{Value: "2026-04", Count: 2}) ||
+		f.Months[1] != (search.FacetCount{Value: "2026-03", Count: 1}) {
+		t.Errorf("Unexpected month facet: %+v", f.Months)
+	}
+	if len(f.ContentTypes) != 0 {
+		t.Errorf("Expected content without a type to be left out, got %+v", f.ContentTypes)
+	}
+
+	if result, err := s.Search(ctx, search.SearchRequest{Workspace: "default", Query: "cosmos"}); err != nil || result.Facets != nil {
+		t.Errorf("Expected no facets unless asked for, got %+v, %v", result, err)
+	}
+}
+
+func testStored(t *testing.T, s Store) {
+	ctx := context.Background()
+	save(t, s, row{summary: "kept"})
+	for _, tt := range []struct {
+		workspace, url string
+		want           bool
+	}{
+		{"default", "https://example.com/default/kept", true},
+		{"default", "https://example.com/default/other", false},
+		{"team", "https://example.com/default/kept", false},
+	} {
+		if got, err := s.Stored(ctx, tt.workspace, tt.url); err != nil || got != tt.want {
+			t.Errorf("Stored(%s, %s) = %v (%v), want %v", tt.workspace, tt.url, got, err, tt.want)
+		}
+	}
+}
+
+func testSaveContentUpdatesScore(t *testing.T, s Store) {
+	ctx := context.Background()
+	c := Content{Workspace: "default", SourceURL: "https://example.com/a", Summary: "First", RelevanceScore: 0.2, Tokens: 40}
+
+	id, _, err := s.SaveContent(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RelevanceScore = 0.7
+	again, inserted, err := s.SaveContent(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted || again != id {
+		t.Errorf("Expected an update of %s, got inserted=%v id=%s", id, inserted, again)
+	}
+	item, err := s.Get(ctx, "default", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.RelevanceScore != 0.7 {
+		t.Errorf("Expected the score to be updated to 0.7, got %v", item.RelevanceScore)
+	}
+	if item.TokenCount != 40 {
+		t.Errorf("Expected the given token count kept, got %d", item.TokenCount)
+	}
+}
+
+func testProgress(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if _, err := s.Progress(ctx, "default", "golang"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for an untracked topic, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.TrackTopic(ctx, "default", "golang"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := s.Progress(ctx, "default", "golang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SkillLevel != "beginner" || p.Score != 0 || time.Since(p.LastUpdated) > time.Minute {
+		t.Errorf("Unexpected progress: %+v", p)
+	}
+	if _, err := s.Progress(ctx, "other", "golang"); err != ErrNotFound {
+		t.Errorf("Expected topics to be tracked per workspace, got %v", err)
+	}
+}
+
+func TestOpenSelectsDriver(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "selin.db"))
+
+	first, err := Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := save(t, first, row{summary: "Shared", score: 0.5})
+	first.Close()
+
+	second, err := Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Get(context.Background(), "default", id); err != nil {
+		t.Errorf("Expected the shared database to survive Close, got %v", err)
+	}
+	if _, ok := PostgresDB(second); ok {
+		t.Error("Expected no Postgres database behind a SQLite store")
+	}
+
+	t.Setenv("STORAGE_DRIVER", "mongo")
+	if _, err := Open("test"); err == nil {
+		t.Error("Expected an error for an unknown driver")
+	}
+}
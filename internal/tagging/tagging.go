@@ -0,0 +1,169 @@
+// Package tagging keeps the tag space tidy: bulk renames, merges and
+// deletes across a workspace's content, and alias rules (say "k8s" to
+// "kubernetes") that collectors apply to new content as it is stored.
+package tagging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidTag is returned for empty tags and for merging a tag into
+// itself.
+var ErrInvalidTag = errors.New("invalid tag")
+
+// Normalize lowercases and trims a tag, the form tags are stored in.
+func Normalize(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// Aliases maps alias tags to the tag they stand for.
+type Aliases map[string]string
+
+// Apply replaces aliased tags, normalizing all of them and dropping
+// duplicates while keeping the first occurrence's position.
+func (a Aliases) Apply(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = Normalize(t)
+		if canonical, ok := a[t]; ok {
+			t = canonical
+		}
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// LoadAliases returns a workspace's alias rules.
+func LoadAliases(ctx context.Context, db *sql.DB, workspace string) (Aliases, error) {
+	rows, err := db.QueryContext(ctx, `SELECT alias, tag FROM tag_aliases WHERE workspace_id = $1`, workspace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := Aliases{}
+	for rows.Next() {
+		var alias, tag string
+		if err := rows.Scan(&alias, &tag); err != nil {
+			return nil, err
+		}
+		aliases[alias] = tag
+	}
+	return aliases, rows.Err()
+}
+
+// SetAlias makes alias stand for tag in new content. Existing content is
+// left alone; Merge it to change that.
+func SetAlias(ctx context.Context, db *sql.DB, workspace, alias, tag string) error {
+	alias, tag = Normalize(alias), Normalize(tag)
+	if alias == "" || tag == "" || alias == tag {
+		return ErrInvalidTag
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO tag_aliases (workspace_id, alias, tag) VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, alias) DO UPDATE SET tag = EXCLUDED.tag`,
+		workspace, alias, tag)
+	return err
+}
+
+// DeleteAlias removes an alias rule, reporting whether there was one.
+func DeleteAlias(ctx context.Context, db *sql.DB, workspace, alias string) (bool, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM tag_aliases WHERE workspace_id = $1 AND alias = $2`,
+		workspace, Normalize(alias))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// mergeTags renames every tag in $2 to $3, dropping the duplicates that
+// leaves while keeping the tags' order.
+const mergeTags = `
+	UPDATE content_metadata SET tags = (
+		SELECT array_agg(t ORDER BY pos) FROM (
+			SELECT CASE WHEN u.t = ANY($2) THEN $3 ELSE u.t END AS t, min(u.pos) AS pos
+			FROM unnest(tags) WITH ORDINALITY AS u(t, pos)
+			GROUP BY 1
+		) merged
+	), updated_at = now()
+	WHERE workspace_id = $1 AND tags && $2`
+
+// Merge renames the from tags to into on all of a workspace's content and
+// returns how many items changed. With alias set the from tags also become
+// aliases of into, so collectors stop producing them.
+func Merge(ctx context.Context, db *sql.DB, workspace string, from []string, into string, alias bool) (int64, error) {
+	into = Normalize(into)
+	var sources []string
+	for _, f := range from {
+		if f = Normalize(f); f != "" && f != into {
+			sources = append(sources, f)
+		}
+	}
+	if into == "" || len(sources) == 0 {
+		return 0, ErrInvalidTag
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, mergeTags, workspace, pq.Array(sources), into)
+	if err != nil {
+		return 0, err
+	}
+	if alias {
+		for _, s := range sources {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO tag_aliases (workspace_id, alias, tag) VALUES ($1, $2, $3)
+				ON CONFLICT (workspace_id, alias) DO UPDATE SET tag = EXCLUDED.tag`,
+				workspace, s, into); err != nil {
+				return 0, err
+			}
+		}
+		// Aliases pointing at a merged tag now point at its replacement
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE tag_aliases SET tag = $3 WHERE workspace_id = $1 AND tag = ANY($2)`,
+			workspace, pq.Array(sources), into); err != nil {
+			return 0, err
+		}
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// Rename is Merge with a single tag.
+func Rename(ctx context.Context, db *sql.DB, workspace, from, to string, alias bool) (int64, error) {
+	return Merge(ctx, db, workspace, []string{from}, to, alias)
+}
+
+// Delete removes a tag from all of a workspace's content and returns how
+// many items changed.
+func Delete(ctx context.Context, db *sql.DB, workspace, tag string) (int64, error) {
+	tag = Normalize(tag)
+	if tag == "" {
+		return 0, ErrInvalidTag
+	}
+	res, err := db.ExecContext(ctx, `
+		UPDATE content_metadata SET tags = array_remove(tags, $2), updated_at = now()
+		WHERE workspace_id = $1 AND $2 = ANY(tags)`, workspace, tag)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
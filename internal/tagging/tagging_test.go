@@ -0,0 +1,22 @@
+package tagging
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	aliases := Aliases{"k8s": "kubernetes", "go": "golang"}
+	got := aliases.Apply([]string{"K8s", "golang", " Go ", "kubernetes", "", "docker"})
+	want := []string{"kubernetes", "golang", "docker"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestApplyWithoutAliases(t *testing.T) {
+	var aliases Aliases
+	if got := aliases.Apply([]string{"Cosmos", "cosmos"}); !reflect.DeepEqual(got, []string{"cosmos"}) {
+		t.Errorf("Expected [cosmos], got %v", got)
+	}
+}
@@ -0,0 +1,155 @@
+// Package testenv starts the real dependencies for integration tests:
+// Postgres with the schema from scripts/init-database.sql, and Redis. The
+// containers run under Docker through dockertest and are removed when the
+// test ends.
+//
+// Integration tests carry the integration build tag, so a plain go test
+// never needs Docker:
+//
+//	go test -tags integration ./...
+//
+// Both helpers also point the service configuration (POSTGRES_*, REDIS_URL)
+// at the containers, so code that opens its own connections, like the
+// services' getDBConnection, reaches them too.
+package testenv
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+const postgresPassword = "test"
+
+func pool(t testing.TB) *dockertest.Pool {
+	t.Helper()
+	p, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("Docker unavailable: %v", err)
+	}
+	if err := p.Client.Ping(); err != nil {
+		t.Fatalf("Docker unavailable: %v", err)
+	}
+	return p
+}
+
+func run(t testing.TB, p *dockertest.Pool, opts *dockertest.RunOptions) *dockertest.Resource {
+	t.Helper()
+	resource, err := p.RunWithOptions(opts, func(hc *docker.HostConfig) {
+		hc.AutoRemove = true
+	})
+	if err != nil {
+		t.Fatalf("Failed to start %s: %v", opts.Repository, err)
+	}
+	t.Cleanup(func() { p.Purge(resource) })
+	return resource
+}
+
+// Postgres starts Postgres, applies the schema and returns a connection to
+// it.
+func Postgres(t testing.TB) *sql.DB {
+	t.Helper()
+	p := pool(t)
+	resource := run(t, p, &dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "16-alpine",
+		Env:        []string{"POSTGRES_PASSWORD=" + postgresPassword, "POSTGRES_DB=selin"},
+	})
+	host, port, _ := strings.Cut(resource.GetHostPort("5432/tcp"), ":")
+
+	t.Setenv("POSTGRES_HOST", host)
+	t.Setenv("POSTGRES_PORT", port)
+	t.Setenv("POSTGRES_USER", "postgres")
+	t.Setenv("POSTGRES_PASSWORD", postgresPassword)
+	t.Setenv("POSTGRES_DB", "selin")
+	t.Setenv("POSTGRES_SSLMODE", "disable")
+
+	dsn := fmt.Sprintf("host=%s port=%s user=postgres password=%s dbname=selin sslmode=disable", host, port, postgresPassword)
+	var db *sql.DB
+	if err := p.Retry(func() error {
+		var err error
+		if db, err = sql.Open("postgres", dsn); err != nil {
+			return err
+		}
+		return db.Ping()
+	}); err != nil {
+		t.Fatalf("Postgres never became ready: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// migrate applies scripts/init-database.sql, leaving out the psql
+// meta-commands (\c, \echo) database/sql cannot run.
+func migrate(db *sql.DB) error {
+	path, err := findSchema()
+	if err != nil {
+		return err
+	}
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var statements []string
+	for _, line := range strings.Split(string(script), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), `\`) {
+			statements = append(statements, line)
+		}
+	}
+	if _, err := db.Exec(strings.Join(statements, "\n")); err != nil {
+		return fmt.Errorf("failed to apply %s: %v", path, err)
+	}
+	return nil
+}
+
+// findSchema looks for scripts/init-database.sql in the working directory
+// and its parents, so tests find it from any module in the repository.
+func findSchema() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, "scripts", "init-database.sql")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("scripts/init-database.sql not found above the working directory")
+		}
+		dir = parent
+	}
+}
+
+// Redis starts Redis and returns its address, which is also set as
+// REDIS_URL.
+func Redis(t testing.TB) string {
+	t.Helper()
+	p := pool(t)
+	resource := run(t, p, &dockertest.RunOptions{Repository: "redis", Tag: "7-alpine"})
+	addr := resource.GetHostPort("6379/tcp")
+	t.Setenv("REDIS_URL", addr)
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	if err := p.Retry(func() error {
+		return client.Ping(context.Background()).Err()
+	}); err != nil {
+		t.Fatalf("Redis never became ready: %v", err)
+	}
+	return addr
+}
@@ -0,0 +1,184 @@
+// Package tlsserve runs a service's http.Server over TLS when certificates
+// are configured, either as static files or issued by Let's Encrypt, and
+// redirects plain HTTP to HTTPS.
+package tlsserve
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Config selects how a server terminates TLS. With neither certificates
+// nor autocert domains, servers keep serving plain HTTP.
+type Config struct {
+	CertFile string
+	KeyFile  string
+
+	// AutocertDomains enables Let's Encrypt for these hosts, caching
+	// certificates in AutocertCache.
+	AutocertDomains []string
+	AutocertCache   string
+	AutocertEmail   string
+
+	// RedirectAddr, e.g. ":80", serves redirects to HTTPS (and ACME
+	// HTTP-01 challenges). Empty disables the redirect listener.
+	RedirectAddr string
+
+	// HSTSMaxAge is sent in Strict-Transport-Security on HTTPS responses;
+	// zero disables the header.
+	HSTSMaxAge time.Duration
+
+	// HTTP1Only disables HTTP/2, which cannot carry WebSocket upgrades.
+	HTTP1Only bool
+}
+
+// FromEnv reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_AUTOCERT_DOMAINS,
+// TLS_AUTOCERT_CACHE, TLS_AUTOCERT_EMAIL, TLS_REDIRECT_ADDR and
+// TLS_HSTS_MAX_AGE.
+func FromEnv() Config {
+	c := Config{
+		CertFile:      os.Getenv("TLS_CERT_FILE"),
+		KeyFile:       os.Getenv("TLS_KEY_FILE"),
+		AutocertCache: os.Getenv("TLS_AUTOCERT_CACHE"),
+		AutocertEmail: os.Getenv("TLS_AUTOCERT_EMAIL"),
+		RedirectAddr:  os.Getenv("TLS_REDIRECT_ADDR"),
+		HSTSMaxAge:    365 * 24 * time.Hour,
+	}
+	for _, d := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			c.AutocertDomains = append(c.AutocertDomains, d)
+		}
+	}
+	if c.AutocertCache == "" {
+		c.AutocertCache = "/var/lib/selin/autocert"
+	}
+	if v := os.Getenv("TLS_HSTS_MAX_AGE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			c.HSTSMaxAge = d
+		}
+	}
+	return c
+}
+
+// Enabled reports whether the server should terminate TLS.
+func (c Config) Enabled() bool {
+	return len(c.AutocertDomains) > 0 || (c.CertFile != "" && c.KeyFile != "")
+}
+
+// Scheme is "https" when TLS is enabled and "http" otherwise.
+func (c Config) Scheme() string {
+	if c.Enabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// HSTS adds Strict-Transport-Security to responses served over HTTPS,
+// including those behind a proxy that terminated TLS and set
+// X-Forwarded-Proto.
+func (c Config) HSTS(next http.Handler) http.Handler {
+	if c.HSTSMaxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.Itoa(int(c.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsHTTPS(r) {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsHTTPS reports whether the client reached us over HTTPS.
+func IsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// RedirectHandler sends clients to the same URL on HTTPS. tlsPort is the
+// HTTPS port, omitted from the URL when it is 443. WebSocket handshakes are
+// rejected rather than redirected, since clients do not follow redirects
+// on upgrade; they must connect with wss:// directly.
+func RedirectHandler(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "WebSocket connections require wss://", http.StatusBadRequest)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// ListenAndServe serves srv over TLS when c is enabled, and plain HTTP
+// otherwise. The redirect listener, if any, is closed when srv shuts down.
+func ListenAndServe(srv *http.Server, c Config) error {
+	if !c.Enabled() {
+		return srv.ListenAndServe()
+	}
+
+	_, tlsPort, _ := net.SplitHostPort(srv.Addr)
+	var redirect http.Handler = RedirectHandler(tlsPort)
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(c.AutocertDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.AutocertDomains...),
+			Cache:      autocert.DirCache(c.AutocertCache),
+			Email:      c.AutocertEmail,
+		}
+		tlsConfig = m.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		redirect = m.HTTPHandler(redirect)
+	}
+	if c.HTTP1Only {
+		// Keep ACME TLS-ALPN challenges working while refusing h2
+		protos := []string{"http/1.1"}
+		for _, p := range tlsConfig.NextProtos {
+			if p == "acme-tls/1" {
+				protos = append(protos, p)
+			}
+		}
+		tlsConfig.NextProtos = protos
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	srv.TLSConfig = tlsConfig
+
+	if c.RedirectAddr != "" {
+		redirectServer := &http.Server{
+			Addr:              c.RedirectAddr,
+			Handler:           redirect,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		srv.RegisterOnShutdown(func() { redirectServer.Close() })
+		go func() {
+			slog.Info("redirecting HTTP to HTTPS", "addr", c.RedirectAddr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("HTTP redirect listener failed", "error", err)
+			}
+		}()
+	}
+
+	if len(c.AutocertDomains) > 0 {
+		return srv.ListenAndServeTLS("", "")
+	}
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return fmt.Errorf("invalid TLS certificate: %v", err)
+	}
+	return srv.ListenAndServeTLS(c.CertFile, c.KeyFile)
+}
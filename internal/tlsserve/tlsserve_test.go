@@ -0,0 +1,81 @@
+package tlsserve
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		host, port, want string
+	}{
+		{"selin.example.com", "443", "https://selin.example.com/api/v1/query?q=go"},
+		{"selin.example.com:80", "443", "https://selin.example.com/api/v1/query?q=go"},
+		{"selin.example.com:8080", "8443", "https://selin.example.com:8443/api/v1/query?q=go"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/api/v1/query?q=go", nil)
+		rec := httptest.NewRecorder()
+		RedirectHandler(tt.port).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("Expected 308, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("Expected redirect to %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestRedirectHandlerRejectsWebSocketUpgrade(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://selin.example.com/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	rec := httptest.NewRecorder()
+	RedirectHandler("443").ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a ws:// upgrade, got %d", rec.Code)
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	handler := Config{HSTSMaxAge: time.Hour}.HSTS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	plain := httptest.NewRecorder()
+	handler.ServeHTTP(plain, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := plain.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Expected no HSTS over plain HTTP, got %q", got)
+	}
+
+	secure := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	handler.ServeHTTP(secure, req)
+	if got := secure.Header().Get("Strict-Transport-Security"); got != "max-age=3600; includeSubDomains" {
+		t.Errorf("Unexpected HSTS header %q", got)
+	}
+
+	proxied := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	handler.ServeHTTP(proxied, req)
+	if proxied.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("Expected HSTS behind a TLS-terminating proxy")
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	if (Config{}).Enabled() {
+		t.Error("Expected TLS disabled without certificates")
+	}
+	if !(Config{CertFile: "cert.pem", KeyFile: "key.pem"}).Enabled() {
+		t.Error("Expected TLS enabled with a static certificate")
+	}
+	if !(Config{AutocertDomains: []string{"selin.example.com"}}).Enabled() {
+		t.Error("Expected TLS enabled with autocert domains")
+	}
+}
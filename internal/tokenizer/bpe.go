@@ -0,0 +1,170 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// BPE counts tokens the way tiktoken encodes text: split into pieces by
+// cl100k_base's pattern, then each piece's bytes merged pairwise, lowest
+// rank first, while the merged bytes are in the vocabulary.
+type BPE struct {
+	ranks map[string]int
+}
+
+// NewBPE returns a tokenizer for the vocabulary ranks, token bytes to
+// rank.
+func NewBPE(ranks map[string]int) *BPE {
+	return &BPE{ranks: ranks}
+}
+
+// LoadBPE reads a vocabulary in tiktoken's format, a base64 token and its
+// rank per line.
+func LoadBPE(path string) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a rank", path, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty vocabulary", path)
+	}
+	return NewBPE(ranks), nil
+}
+
+func (b *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range pieces(text) {
+		n += b.countPiece(piece)
+	}
+	return n
+}
+
+// countPiece merges the bytes of piece and returns how many tokens are
+// left. Bytes missing from the vocabulary count as a token each.
+func (b *BPE) countPiece(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+	// bounds[i] is where the i-th part starts
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, at := -1, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (best < 0 || rank < best) {
+				best, at = rank, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// pieces splits text the way cl100k_base's pattern does:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// matched by hand, since Go's regexp has no lookahead.
+func pieces(text string) []string {
+	var out []string
+	rs := []rune(text)
+	for i := 0; i < len(rs); {
+		n := matchPiece(rs, i)
+		out = append(out, string(rs[i:i+n]))
+		i += n
+	}
+	return out
+}
+
+var contractions = []string{"s", "t", "re", "ve", "m", "ll", "d"}
+
+func matchPiece(rs []rune, i int) int {
+	r := rs[i]
+	if r == '\'' {
+		for _, c := range contractions {
+			if end := i + 1 + len(c); end <= len(rs) && strings.EqualFold(string(rs[i+1:end]), c) {
+				return 1 + len(c)
+			}
+		}
+	}
+	if unicode.IsLetter(r) {
+		return 1 + span(rs, i+1, unicode.IsLetter)
+	}
+	if !isNewline(r) && !unicode.IsNumber(r) && i+1 < len(rs) && unicode.IsLetter(rs[i+1]) {
+		return 1 + span(rs, i+1, unicode.IsLetter)
+	}
+	if unicode.IsNumber(r) {
+		return min(3, span(rs, i, unicode.IsNumber))
+	}
+	j := i
+	if r == ' ' {
+		j++
+	}
+	if j < len(rs) && isSymbol(rs[j]) {
+		j += span(rs, j, isSymbol)
+		j += span(rs, j, isNewline)
+		return j - i
+	}
+
+	ws := span(rs, i, unicode.IsSpace)
+	for k := i + ws - 1; k >= i; k-- {
+		if isNewline(rs[k]) {
+			return k - i + 1
+		}
+	}
+	// Whitespace before a word is left for the word to start with
+	if i+ws == len(rs) || ws == 1 {
+		return ws
+	}
+	return ws - 1
+}
+
+// span counts the runes from i on that match.
+func span(rs []rune, i int, match func(rune) bool) int {
+	n := 0
+	for i+n < len(rs) && match(rs[i+n]) {
+		n++
+	}
+	return n
+}
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
@@ -0,0 +1,107 @@
+// Package tokenizer measures text in tokens, the unit model context
+// windows and prices are counted in, rather than in characters. With
+// TOKENIZER_VOCAB_FILE pointing at a tiktoken vocabulary (such as
+// cl100k_base.tiktoken), counts are exact for the models using it; without
+// one they are estimated.
+package tokenizer
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"selin/internal/logging"
+)
+
+// Tokenizer counts the tokens a model would see in a text.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// Approx estimates token counts without a vocabulary: about four
+// characters to a token, and at least one per word.
+var Approx Tokenizer = approxTokenizer{}
+
+type approxTokenizer struct{}
+
+func (approxTokenizer) Count(text string) int {
+	n, word := 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			if word > 0 {
+				n += (word + 3) / 4
+			}
+			word = 0
+			continue
+		}
+		word++
+	}
+	if word > 0 {
+		n += (word + 3) / 4
+	}
+	return n
+}
+
+var (
+	defaultOnce      sync.Once
+	defaultTokenizer Tokenizer
+)
+
+// Default returns the process-wide tokenizer: the vocabulary at
+// TOKENIZER_VOCAB_FILE, loaded on first use, or Approx when it is unset.
+func Default() Tokenizer {
+	defaultOnce.Do(func() {
+		path := os.Getenv("TOKENIZER_VOCAB_FILE")
+		if path == "" {
+			defaultTokenizer = Approx
+			return
+		}
+		bpe, err := LoadBPE(path)
+		if err != nil {
+			logging.Fatal("failed to load tokenizer vocabulary", "path", path, "error", err)
+		}
+		defaultTokenizer = bpe
+	})
+	return defaultTokenizer
+}
+
+// Truncate returns the longest run of whole words text starts with that
+// fits in maxTokens, or text itself when it all fits.
+func Truncate(tok Tokenizer, text string, maxTokens int) string {
+	if tok.Count(text) <= maxTokens {
+		return text
+	}
+	var ends []int
+	inWord := false
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if inWord {
+				ends = append(ends, i)
+			}
+			inWord = false
+			continue
+		}
+		inWord = true
+	}
+	k := sort.Search(len(ends), func(k int) bool { return tok.Count(text[:ends[k]]) > maxTokens })
+	if k == 0 {
+		// Not even the first word fits; cut it by characters
+		runes := []rune(text)
+		n := min(len(runes), maxTokens*4)
+		for n > 0 && tok.Count(string(runes[:n])) > maxTokens {
+			n--
+		}
+		return string(runes[:n])
+	}
+	return text[:ends[k-1]]
+}
+
+// RuneCount is a Tokenizer measuring text in characters, for code that
+// takes budgets in either unit.
+var RuneCount Tokenizer = runeCounter{}
+
+type runeCounter struct{}
+
+func (runeCounter) Count(text string) int { return utf8.RuneCountInString(text) }
@@ -0,0 +1,90 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPieces(t *testing.T) {
+	got := pieces("Hello world!!\n\n  foo's 12345 (bar)\t\n")
+	want := []string{"Hello", " world", "!!\n\n", " ", " foo", "'s", " ", "123", "45", " (", "bar", ")", "\t\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := pieces("a  "); !reflect.DeepEqual(got, []string{"a", "  "}) {
+		t.Errorf("Expected trailing whitespace kept whole, got %q", got)
+	}
+}
+
+// vocabulary writes a tiktoken file with every byte and the merges given,
+// ranked after the bytes in order.
+func vocabulary(t *testing.T, merges ...string) string {
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, m := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), 256+i)
+	}
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBPE(t *testing.T) {
+	bpe, err := LoadBPE(vocabulary(t, "ll", "he", "hell", "hello", " w", "or", " wor", " world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello", 1},
+		{"hello world", 2},
+		{"help", 3}, // he, l, p
+		{"hello, world!", 4},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := bpe.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLoadBPERejectsMalformedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.tiktoken")
+	for _, content := range []string{"", "aGk=\n", "not-base64! 1\n", "aGk= one\n"} {
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := LoadBPE(path); err == nil {
+			t.Errorf("Expected %q to be rejected", content)
+		}
+	}
+}
+
+func TestApprox(t *testing.T) {
+	if got := Approx.Count("a tokenizer, roughly"); got != 1+3+2 {
+		t.Errorf("Expected 6 tokens, got %d", got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	text := "one two three four five"
+	if got := Truncate(Approx, text, 4); got != "one two three" {
+		t.Errorf("Expected three words, got %q", got)
+	}
+	if got := Truncate(Approx, text, 10); got != text {
+		t.Errorf("Expected text that fits unchanged, got %q", got)
+	}
+	if got := Truncate(RuneCount, "abcdefgh ij", 5); got != "abcde" {
+		t.Errorf("Expected a long first word cut, got %q", got)
+	}
+}
@@ -0,0 +1,232 @@
+// Package transcribe turns recorded speech, such as podcast episodes, into
+// timed text through a transcription backend: a whisper.cpp server, or a
+// hosted API speaking OpenAI's audio transcriptions API. Both answer with
+// the transcript's segments and when each was spoken, so a transcript is
+// chunked by time and a search hit can point into the recording.
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"selin/internal/chunker"
+	"selin/internal/config"
+	"selin/internal/tokenizer"
+)
+
+// DefaultTimeout bounds one transcription; an hour of audio takes minutes
+// on a GPU and much longer on a CPU.
+const DefaultTimeout = 30 * time.Minute
+
+// Segment is a stretch of speech.
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// Transcript is what a backend heard.
+type Transcript struct {
+	// Language is the spoken language's two-letter code, when detected
+	Language string
+	Duration time.Duration
+	Segments []Segment
+}
+
+// Backend is a transcription server.
+type Backend struct {
+	// Name is "whisper_cpp" or "openai"
+	Name string
+	// URL is the transcription endpoint
+	URL    string
+	APIKey string
+	// Model is sent to hosted APIs; whisper.cpp serves the model it loaded
+	Model string
+	HTTP  *http.Client
+}
+
+// FromEnv configures the backend TRANSCRIBE_BACKEND names, or returns nil
+// when it is unset:
+//
+//	whisper_cpp  a whisper.cpp server (TRANSCRIBE_URL, by default
+//	             http://localhost:8080/inference)
+//	openai       OpenAI or a compatible API (TRANSCRIBE_URL, by default
+//	             https://api.openai.com/v1/audio/transcriptions), with
+//	             TRANSCRIBE_MODEL (whisper-1) and the TRANSCRIBE_API_KEY
+//	             secret, or else OPENAI_API_KEY
+func FromEnv() (*Backend, error) {
+	timeout := DefaultTimeout
+	if v, err := time.ParseDuration(os.Getenv("TRANSCRIBE_TIMEOUT")); err == nil && v > 0 {
+		timeout = v
+	}
+	b := &Backend{Name: os.Getenv("TRANSCRIBE_BACKEND"), HTTP: &http.Client{Timeout: timeout}}
+	switch b.Name {
+	case "":
+		return nil, nil
+	case "whisper_cpp":
+		b.URL = config.Env("TRANSCRIBE_URL", "http://localhost:8080/inference")
+	case "openai":
+		b.URL = config.Env("TRANSCRIBE_URL", "https://api.openai.com/v1/audio/transcriptions")
+		b.Model = config.Env("TRANSCRIBE_MODEL", "whisper-1")
+		if b.APIKey = config.Secret("TRANSCRIBE_API_KEY"); b.APIKey == "" {
+			b.APIKey = config.Secret("OPENAI_API_KEY")
+		}
+	default:
+		return nil, fmt.Errorf("unknown TRANSCRIBE_BACKEND %q: use whisper_cpp or openai", b.Name)
+	}
+	return b, nil
+}
+
+// verboseJSON is the verbose_json response format both backends share.
+type verboseJSON struct {
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Text     string  `json:"text"`
+	Segments []struct {
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	} `json:"segments"`
+}
+
+// Transcribe sends the audio read from r to the backend, named filename
+// as backends tell formats apart by extension.
+func (b *Backend) Transcribe(ctx context.Context, filename string, r io.Reader) (*Transcript, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return nil, err
+	}
+	form.WriteField("response_format", "verbose_json")
+	if b.Name == "openai" {
+		form.WriteField("model", b.Model)
+		form.WriteField("timestamp_granularities[]", "segment")
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.URL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if b.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+	resp, err := b.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s: %s", b.Name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var v verboseJSON
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %v", b.Name, err)
+	}
+	t := &Transcript{Language: language(v.Language), Duration: seconds(v.Duration)}
+	for _, s := range v.Segments {
+		if text := strings.TrimSpace(s.Text); text != "" {
+			t.Segments = append(t.Segments, Segment{Start: seconds(s.Start), End: seconds(s.End), Text: text})
+		}
+	}
+	// Backends that leave out segments still give the text
+	if len(t.Segments) == 0 && strings.TrimSpace(v.Text) != "" {
+		t.Segments = []Segment{{End: t.Duration, Text: strings.TrimSpace(v.Text)}}
+	}
+	return t, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(10 * time.Millisecond)
+}
+
+// languages maps the language names OpenAI returns to codes; whisper.cpp
+// returns codes.
+var languages = map[string]string{
+	"english": "en", "german": "de", "french": "fr", "spanish": "es", "italian": "it", "portuguese": "pt",
+	"dutch": "nl", "russian": "ru", "ukrainian": "uk", "polish": "pl", "turkish": "tr", "chinese": "zh",
+	"japanese": "ja", "korean": "ko",
+}
+
+func language(l string) string {
+	l = strings.ToLower(strings.TrimSpace(l))
+	if code, ok := languages[l]; ok {
+		return code
+	}
+	if len(l) == 2 {
+		return l
+	}
+	return ""
+}
+
+// Timestamp formats d as h:mm:ss, or mm:ss under an hour.
+func Timestamp(d time.Duration) string {
+	s := int(d / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+// Text is the transcript with each segment on a line of its own, after
+// its timestamp.
+func (t *Transcript) Text() string {
+	lines := make([]string, len(t.Segments))
+	for i, s := range t.Segments {
+		lines[i] = "[" + Timestamp(s.Start) + "] " + s.Text
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Chunks groups whole segments into chunks of up to maxTokens tokens,
+// each headed by the stretch of the recording it covers ("01:30-03:05").
+// A segment longer than maxTokens is a chunk of its own.
+func (t *Transcript) Chunks(maxTokens int, tok tokenizer.Tokenizer) []chunker.Chunk {
+	var chunks []chunker.Chunk
+	var group []Segment
+	size := 0
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		texts := make([]string, len(group))
+		for i, s := range group {
+			texts[i] = s.Text
+		}
+		text := strings.Join(texts, " ")
+		chunks = append(chunks, chunker.Chunk{
+			Position: len(chunks),
+			Heading:  Timestamp(group[0].Start) + "-" + Timestamp(group[len(group)-1].End),
+			Text:     text,
+			Tokens:   tok.Count(text),
+		})
+		group, size = nil, 0
+	}
+	for _, s := range t.Segments {
+		n := tok.Count(s.Text)
+		if size+n > maxTokens {
+			flush()
+		}
+		group = append(group, s)
+		size += n
+	}
+	flush()
+	return chunks
+}
@@ -0,0 +1,97 @@
+package transcribe
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// words counts a token per word.
+type words struct{}
+
+func (words) Count(text string) int { return len(strings.Fields(text)) }
+
+const testResponse = `{"task": "transcribe", "language": "english", "duration": 95.5, "text": "...",
+	"segments": [
+		{"id": 0, "start": 0.0, "end": 4.2, "text": " Welcome to the show."},
+		{"id": 1, "start": 4.2, "end": 9.8, "text": " Today we talk about rollups and data availability."},
+		{"id": 2, "start": 9.8, "end": 9.9, "text": "  "},
+		{"id": 3, "start": 62.0, "end": 95.5, "text": " Light clients sample blocks."}
+	]}`
+
+func TestTranscribe(t *testing.T) {
+	for _, name := range []string{"whisper_cpp", "openai"} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				file, header, err := r.FormFile("file")
+				if err != nil {
+					t.Fatalf("Expected the audio as file, got %v", err)
+				}
+				audio, _ := io.ReadAll(file)
+				if header.Filename != "episode.mp3" || string(audio) != "ID3audio" || r.FormValue("response_format") != "verbose_json" {
+					t.Errorf("Unexpected request %s %q %q", header.Filename, audio, r.FormValue("response_format"))
+				}
+				if hosted := name == "openai"; hosted != (r.FormValue("model") == "whisper-1") || hosted != (r.Header.Get("Authorization") == "Bearer key") {
+					t.Errorf("Expected a model and key for hosted APIs only, got %q %q", r.FormValue("model"), r.Header.Get("Authorization"))
+				}
+				w.Write([]byte(testResponse))
+			}))
+			defer srv.Close()
+
+			b := &Backend{Name: name, URL: srv.URL, HTTP: srv.Client()}
+			if name == "openai" {
+				b.Model, b.APIKey = "whisper-1", "key"
+			}
+			tr, err := b.Transcribe(context.Background(), "episode.mp3", strings.NewReader("ID3audio"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tr.Language != "en" || tr.Duration != 95500*time.Millisecond || len(tr.Segments) != 3 {
+				t.Fatalf("Unexpected transcript %+v", tr)
+			}
+			want := "[00:00] Welcome to the show.\n[00:04] Today we talk about rollups and data availability.\n[01:02] Light clients sample blocks."
+			if got := tr.Text(); got != want {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestTranscribeReportsBackendErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b := &Backend{Name: "whisper_cpp", URL: srv.URL, HTTP: srv.Client()}
+	if _, err := b.Transcribe(context.Background(), "a.m4a", strings.NewReader("x")); err == nil || !strings.Contains(err.Error(), "model not loaded") {
+		t.Errorf("Expected the backend's error, got %v", err)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	tr := &Transcript{Segments: []Segment{
+		{Start: 0, End: 4 * time.Second, Text: "one two three"},
+		{Start: 4 * time.Second, End: 9 * time.Second, Text: "four five"},
+		{Start: 62 * time.Second, End: 70 * time.Second, Text: "six seven eight"},
+		{Start: time.Hour, End: time.Hour + 5*time.Second, Text: "a segment longer than the limit"},
+	}}
+	chunks := tr.Chunks(5, words{})
+	want := []struct{ heading, text string }{
+		{"00:00-00:09", "one two three four five"},
+		{"01:02-01:10", "six seven eight"},
+		{"1:00:00-1:00:05", "a segment longer than the limit"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Expected %d chunks, got %+v", len(want), chunks)
+	}
+	for i, w := range want {
+		if c := chunks[i]; c.Position != i || c.Heading != w.heading || c.Text != w.text {
+			t.Errorf("Chunk %d: expected %q %q, got %+v", i, w.heading, w.text, c)
+		}
+	}
+}
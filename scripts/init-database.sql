@@ -44,6 +44,20 @@ CREATE TABLE IF NOT EXISTS learning_progress (
   created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
 );
 
+-- Create learning_progress_history table with one row per topic per
+-- progress computation, for trend charts
+CREATE TABLE IF NOT EXISTS learning_progress_history (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  topic TEXT NOT NULL,
+  progress_score REAL NOT NULL,
+  skill_level TEXT NOT NULL,
+  reads REAL DEFAULT 0, -- decayed signal values used for the score
+  queries REAL DEFAULT 0,
+  recorded_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_learning_progress_history_topic ON learning_progress_history(topic, recorded_at);
+
 -- Create query_history table to track all user queries
 CREATE TABLE IF NOT EXISTS query_history (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -78,6 +92,597 @@ CREATE TABLE IF NOT EXISTS data_sources (
 CREATE INDEX IF NOT EXISTS idx_data_sources_type ON data_sources(source_type);
 CREATE INDEX IF NOT EXISTS idx_data_sources_enabled ON data_sources(enabled);
 
+-- Create notification_preferences table to route events to user channels
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  user_id TEXT NOT NULL,
+  event_type TEXT NOT NULL, -- 'high_relevance_content', 'weekly_summary', 'watch_match'
+  channel TEXT NOT NULL, -- 'email', 'slack', 'telegram'
+  target TEXT NOT NULL, -- email address, Slack webhook URL or Telegram chat ID
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (user_id, event_type, channel)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_preferences_event ON notification_preferences(event_type);
+
+-- Create user_preferences table for each user's settings: followed tags,
+-- digest schedule and search defaults, kept apart in each workspace
+CREATE TABLE IF NOT EXISTS user_preferences (
+  user_id TEXT NOT NULL,
+  subscribed_tags TEXT[] NOT NULL DEFAULT '{}',
+  digest_schedule TEXT NOT NULL DEFAULT 'daily' CHECK (digest_schedule IN ('daily', 'weekly', 'off')),
+  default_platform TEXT NOT NULL DEFAULT 'all' CHECK (default_platform IN ('reddit', 'slack', 'file_upload', 'all')),
+  result_format TEXT NOT NULL DEFAULT 'balanced' CHECK (result_format IN ('concise', 'balanced', 'detailed')),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  PRIMARY KEY (workspace_id, user_id)
+);
+
+-- Create content_interactions table to record what a user has read
+CREATE TABLE IF NOT EXISTS content_interactions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id TEXT DEFAULT 'default_user',
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  interaction_type TEXT DEFAULT 'read', -- 'viewed', 'read', 'reviewed', 'quizzed'
+  rating SMALLINT CHECK (rating BETWEEN 1 AND 5),
+  notes TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_interactions_user_id ON content_interactions(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_content_interactions_content_id ON content_interactions(content_id);
+
+-- Create review_items table for spaced-repetition (SM-2) scheduling
+CREATE TABLE IF NOT EXISTS review_items (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id TEXT DEFAULT 'default_user',
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  ease_factor REAL DEFAULT 2.5,
+  interval_days INTEGER DEFAULT 0,
+  repetitions INTEGER DEFAULT 0,
+  due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  last_reviewed_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (user_id, content_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_items_due ON review_items(user_id, due_at);
+
+-- Create quiz_cards and quiz_attempts tables for generated quizzes
+CREATE TABLE IF NOT EXISTS quiz_cards (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id TEXT DEFAULT 'default_user',
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  topic TEXT NOT NULL,
+  question TEXT NOT NULL,
+  answer TEXT NOT NULL,
+  source TEXT DEFAULT 'template', -- 'template', 'llm'
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_quiz_cards_topic ON quiz_cards(user_id, topic);
+
+CREATE TABLE IF NOT EXISTS quiz_attempts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  card_id UUID NOT NULL REFERENCES quiz_cards(id) ON DELETE CASCADE,
+  user_id TEXT DEFAULT 'default_user',
+  answer TEXT,
+  correct BOOLEAN NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_quiz_attempts_card_id ON quiz_attempts(card_id);
+
+-- Create knowledge graph tables: concepts extracted during ingestion, the
+-- content mentioning them, and undirected co-occurrence edges
+-- (stored once per pair, with source < target)
+CREATE TABLE IF NOT EXISTS knowledge_concepts (
+  name TEXT PRIMARY KEY,
+  kind TEXT NOT NULL, -- 'language', 'tool', 'library', 'protocol', 'blockchain', 'algorithm'
+  mention_count INTEGER DEFAULT 0,
+  first_seen TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  last_seen TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS concept_mentions (
+  concept TEXT NOT NULL REFERENCES knowledge_concepts(name) ON DELETE CASCADE,
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  PRIMARY KEY (concept, content_id)
+);
+
+CREATE TABLE IF NOT EXISTS concept_edges (
+  source TEXT NOT NULL REFERENCES knowledge_concepts(name) ON DELETE CASCADE,
+  target TEXT NOT NULL REFERENCES knowledge_concepts(name) ON DELETE CASCADE,
+  weight INTEGER DEFAULT 1,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (source, target)
+);
+
+CREATE INDEX IF NOT EXISTS idx_concept_edges_target ON concept_edges(target);
+
+-- Create learning_goals table for goals measured by topic progress
+CREATE TABLE IF NOT EXISTS learning_goals (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id TEXT DEFAULT 'default_user',
+  title TEXT NOT NULL, -- 'pass CKA', 'understand IBC'
+  topics TEXT[] NOT NULL,
+  target_score REAL DEFAULT 6.0, -- progress score each topic should reach
+  deadline DATE,
+  status TEXT DEFAULT 'active', -- 'active', 'completed', 'archived'
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_learning_goals_user_id ON learning_goals(user_id, status);
+
+-- Workspaces: content and learning progress belong to one workspace. The
+-- gateway resolves the workspace from the caller's API key and passes it to
+-- services in X-Workspace-ID; single-user setups only use 'default'.
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE learning_progress ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE learning_progress_history ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE query_history ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE learning_goals ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';
+-- Preferences were kept per user before; existing ones become the default
+-- workspace's
+ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE user_preferences DROP CONSTRAINT IF EXISTS user_preferences_pkey;
+ALTER TABLE user_preferences ADD PRIMARY KEY (workspace_id, user_id);
+-- So are notification routes: events only reach the users of their
+-- workspace
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE notification_preferences DROP CONSTRAINT IF EXISTS notification_preferences_pkey;
+ALTER TABLE notification_preferences ADD PRIMARY KEY (workspace_id, user_id, event_type, channel);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_content_workspace_source_url ON content_metadata(workspace_id, source_url);
+CREATE INDEX IF NOT EXISTS idx_learning_progress_workspace_topic ON learning_progress(workspace_id, topic);
+CREATE INDEX IF NOT EXISTS idx_progress_history_workspace_topic ON learning_progress_history(workspace_id, topic, recorded_at);
+CREATE INDEX IF NOT EXISTS idx_query_history_workspace ON query_history(workspace_id);
+-- Author reputation is looked up for every collected item
+CREATE INDEX IF NOT EXISTS idx_content_author ON content_metadata(workspace_id, source_platform, author);
+
+-- Set by mcp-server when the vector generator announces an item's embedding
+-- stored (embedding.ready); rows where it is NULL make up the embedding
+-- backlog reported by /admin/system
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS embedded_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_content_embedding_backlog ON content_metadata(collection_date) WHERE embedded_at IS NULL;
+
+-- Length of the item's text in tokens (see TOKENIZER_VOCAB_FILE), so a
+-- context budget can be planned before the text is fetched
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS token_count INTEGER;
+
+-- Which MCP tool or API a query came through, and how many results it
+-- found; result_count is NULL for questions, which return an answer instead
+ALTER TABLE query_history ADD COLUMN IF NOT EXISTS tool TEXT;
+ALTER TABLE query_history ADD COLUMN IF NOT EXISTS result_count INTEGER;
+CREATE INDEX IF NOT EXISTS idx_query_history_workspace_user ON query_history(workspace_id, user_id, created_at DESC);
+-- Searches that found nothing, read by the content_gaps tool
+CREATE INDEX IF NOT EXISTS idx_query_history_zero_results ON query_history(workspace_id, created_at) WHERE result_count = 0;
+
+-- Search experiments: the variant that ranked a search and the IDs it
+-- returned, in order. Views and reads that name the search's query_id are
+-- its feedback.
+ALTER TABLE query_history ADD COLUMN IF NOT EXISTS experiment TEXT;
+ALTER TABLE query_history ADD COLUMN IF NOT EXISTS variant TEXT;
+ALTER TABLE query_history ADD COLUMN IF NOT EXISTS result_ids TEXT[];
+CREATE INDEX IF NOT EXISTS idx_query_history_experiment ON query_history(experiment, created_at) WHERE experiment IS NOT NULL;
+ALTER TABLE content_interactions ADD COLUMN IF NOT EXISTS query_id UUID REFERENCES query_history(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_content_interactions_query ON content_interactions(query_id) WHERE query_id IS NOT NULL;
+
+-- Collector keywords suggested from frequent content gaps, for review
+CREATE TABLE IF NOT EXISTS keyword_suggestions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  keyword TEXT NOT NULL,
+  query_count INTEGER NOT NULL DEFAULT 0,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'dismissed')),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (workspace_id, keyword)
+);
+
+-- Tag alias rules: collectors store tag instead of alias on new content
+CREATE TABLE IF NOT EXISTS tag_aliases (
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  alias TEXT NOT NULL,
+  tag TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (workspace_id, alias)
+);
+
+-- Prior values of content_metadata rows, written by a trigger so every
+-- update is kept whichever component makes it. previous holds only the
+-- fields that changed; changed_by is the connection's application_name
+CREATE TABLE IF NOT EXISTS content_revisions (
+  id BIGSERIAL PRIMARY KEY,
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  previous JSONB NOT NULL,
+  changed_by TEXT NOT NULL,
+  changed_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_content_revisions_content ON content_revisions(content_id, changed_at DESC);
+
+CREATE OR REPLACE FUNCTION record_content_revision() RETURNS trigger AS $$
+DECLARE
+  -- Bookkeeping and derived columns are not revisions
+  old_row JSONB := to_jsonb(OLD) - 'updated_at' - 'embedded_at' - 'search_vector';
+  new_row JSONB := to_jsonb(NEW) - 'updated_at' - 'embedded_at' - 'search_vector';
+  previous JSONB := '{}';
+  field TEXT;
+BEGIN
+  FOR field IN SELECT jsonb_object_keys(old_row) LOOP
+    IF old_row -> field IS DISTINCT FROM new_row -> field THEN
+      previous := previous || jsonb_build_object(field, old_row -> field);
+    END IF;
+  END LOOP;
+  IF previous <> '{}' THEN
+    INSERT INTO content_revisions (content_id, workspace_id, previous, changed_by)
+    VALUES (OLD.id, OLD.workspace_id, previous,
+            COALESCE(NULLIF(current_setting('application_name', true), ''), session_user));
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS content_metadata_revisions ON content_metadata;
+CREATE TRIGGER content_metadata_revisions AFTER UPDATE ON content_metadata
+  FOR EACH ROW EXECUTE FUNCTION record_content_revision();
+
+-- Typed relations between content items: source_id was derived from,
+-- replies to, is in the thread started by, or links to target_id
+CREATE TABLE IF NOT EXISTS content_links (
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  source_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  target_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  relation TEXT NOT NULL CHECK (relation IN ('derived_from', 'reply_to', 'same_thread', 'links_to')),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (source_id, target_id, relation)
+);
+ALTER TABLE content_links DROP CONSTRAINT IF EXISTS content_links_relation_check;
+ALTER TABLE content_links ADD CONSTRAINT content_links_relation_check
+  CHECK (relation IN ('derived_from', 'reply_to', 'same_thread', 'links_to'));
+CREATE INDEX IF NOT EXISTS idx_content_links_target ON content_links(target_id);
+
+-- Files attached to content, such as images in chat messages. Files that
+-- came with the upload are kept in blob storage under blob_key; files the
+-- export only refers to keep their source_url. extracted_text is the OCR
+-- output for images, which search matches along with the summary
+CREATE TABLE IF NOT EXISTS content_attachments (
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  filename TEXT NOT NULL,
+  mime_type TEXT,
+  size_bytes BIGINT,
+  blob_key TEXT,
+  source_url TEXT,
+  extracted_text TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (content_id, position)
+);
+
+-- Passages of documents and posts, split by the strategy configured for
+-- their content type in config/chunking.yaml
+CREATE TABLE IF NOT EXISTS content_chunks (
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  heading TEXT NOT NULL DEFAULT '',
+  text TEXT NOT NULL,
+  token_count INTEGER NOT NULL,
+  PRIMARY KEY (content_id, position)
+);
+
+-- Who may see content outside the system, set by the path that ingested
+-- it: private content (Slack and chat exports, uploaded documents) is left
+-- out of exports, shared collections and notifications. license is the
+-- terms the content came under, when known. Content stored before the
+-- columns existed is public when it came from Reddit
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS visibility TEXT CHECK (visibility IN ('public', 'private'));
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS license TEXT NOT NULL DEFAULT '';
+UPDATE content_metadata
+SET visibility = CASE WHEN source_platform = 'reddit' THEN 'public' ELSE 'private' END,
+    license = CASE WHEN source_platform = 'reddit' THEN 'reddit-user-agreement' ELSE license END
+WHERE visibility IS NULL;
+ALTER TABLE content_metadata ALTER COLUMN visibility SET DEFAULT 'private';
+ALTER TABLE content_metadata ALTER COLUMN visibility SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_content_visibility ON content_metadata(workspace_id, visibility);
+
+-- Files received by the file uploader, kept on its upload disk under
+-- stored_path. sha256 lets a downloaded original be verified, and a file
+-- already uploaded to the workspace be turned away
+CREATE TABLE IF NOT EXISTS uploads (
+  id UUID PRIMARY KEY,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  filename TEXT NOT NULL,
+  file_type TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL,
+  sha256 TEXT NOT NULL,
+  stored_path TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_uploads_sha256 ON uploads(workspace_id, sha256);
+-- The uploader's X-User-ID, so a user's uploads can be deleted with the
+-- rest of their data
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS user_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_uploads_user_id ON uploads(user_id);
+-- The items an upload stored, counted towards its user's daily quota
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS items INTEGER NOT NULL DEFAULT 0;
+-- processing until the upload's items are stored, then completed or failed,
+-- and expired once UPLOAD_RETENTION removed the file; uploads recorded
+-- before are completed
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'completed';
+
+-- Transcriptions of audio uploads, run by the file uploader in the
+-- background. The audio is kept in blob storage under blob_key; jobs still
+-- queued or running when the uploader restarts are started again, up to
+-- three attempts. content_id is the transcript once completed
+CREATE TABLE IF NOT EXISTS transcription_jobs (
+  upload_id UUID PRIMARY KEY REFERENCES uploads(id) ON DELETE CASCADE,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  filename TEXT NOT NULL,
+  blob_key TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL,
+  visibility TEXT NOT NULL DEFAULT 'private',
+  license TEXT,
+  status TEXT NOT NULL DEFAULT 'queued', -- 'queued', 'running', 'completed', 'failed'
+  attempts INTEGER NOT NULL DEFAULT 0,
+  error TEXT,
+  content_id UUID REFERENCES content_metadata(id) ON DELETE SET NULL,
+  segments INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  finished_at TIMESTAMP WITH TIME ZONE
+);
+-- The upload's overrides, given to the transcript
+ALTER TABLE transcription_jobs ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE transcription_jobs ADD COLUMN IF NOT EXISTS topic TEXT;
+ALTER TABLE transcription_jobs ADD COLUMN IF NOT EXISTS min_relevance REAL NOT NULL DEFAULT 0;
+ALTER TABLE transcription_jobs ADD COLUMN IF NOT EXISTS author_override TEXT;
+CREATE INDEX IF NOT EXISTS idx_transcription_jobs_unfinished ON transcription_jobs(created_at) WHERE status IN ('queued', 'running');
+
+-- The newest Slack message imported per workspace and channel, by its
+-- timestamp, so a newer export of the workspace only processes what came
+-- after it
+CREATE TABLE IF NOT EXISTS slack_import_marks (
+  workspace_id TEXT NOT NULL,
+  channel TEXT NOT NULL,
+  last_ts TEXT NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (workspace_id, channel)
+);
+
+-- Named sets of content curated by hand ('IBC deep dive'). A collection
+-- with a share_token can be read by anyone holding the token
+CREATE TABLE IF NOT EXISTS collections (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  user_id TEXT DEFAULT 'default_user',
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  share_token TEXT UNIQUE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_collections_name ON collections(workspace_id, user_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS collection_items (
+  collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  note TEXT NOT NULL DEFAULT '',
+  added_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (collection_id, content_id)
+);
+
+-- Full-text search vector of an item's tags and summary, kept current by a
+-- trigger. Rows stored before the column existed get theirs from a reindex
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS search_vector tsvector;
+CREATE INDEX IF NOT EXISTS idx_content_search_vector ON content_metadata USING GIN (search_vector);
+
+CREATE OR REPLACE FUNCTION content_search_vector(summary TEXT, tags TEXT[]) RETURNS tsvector AS $$
+  SELECT setweight(to_tsvector('english', COALESCE(array_to_string(tags, ' '), '')), 'A') ||
+         setweight(to_tsvector('english', COALESCE(summary, '')), 'B')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION set_content_search_vector() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector := content_search_vector(NEW.content_summary, NEW.tags);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS content_metadata_search_vector ON content_metadata;
+CREATE TRIGGER content_metadata_search_vector BEFORE INSERT OR UPDATE OF content_summary, tags ON content_metadata
+  FOR EACH ROW EXECUTE FUNCTION set_content_search_vector();
+
+-- Content version: a counter bumped by every statement that writes content,
+-- its links or attachments, and by each dashboard refresh. The MCP server
+-- derives the ETags of its read-only endpoints from it, so a response
+-- tagged with an older version is out of date
+CREATE TABLE IF NOT EXISTS content_version (
+  id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+  version BIGINT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+INSERT INTO content_version (id) VALUES (true) ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION bump_content_version() RETURNS trigger AS $$
+BEGIN
+  UPDATE content_version SET version = version + 1, updated_at = now();
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS content_metadata_version ON content_metadata;
+CREATE TRIGGER content_metadata_version AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON content_metadata
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_content_version();
+DROP TRIGGER IF EXISTS content_links_version ON content_links;
+CREATE TRIGGER content_links_version AFTER INSERT OR UPDATE OR DELETE ON content_links
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_content_version();
+DROP TRIGGER IF EXISTS content_attachments_version ON content_attachments;
+CREATE TRIGGER content_attachments_version AFTER INSERT OR UPDATE OR DELETE ON content_attachments
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_content_version();
+
+-- Reindex jobs rebuild derived columns of every content row in batches of
+-- ids after last_id, the checkpoint written with each batch, so a job can
+-- be paused or interrupted and resumed where it stopped. The worker holding
+-- a job renews heartbeat_at with every batch; a job whose heartbeat is
+-- stale is taken over by another replica
+CREATE TABLE IF NOT EXISTS reindex_jobs (
+  id BIGSERIAL PRIMARY KEY,
+  steps TEXT[] NOT NULL, -- 'search_vector', 'tags', 'embeddings', 'encryption'
+  status TEXT NOT NULL DEFAULT 'running', -- 'running', 'paused', 'failed', 'completed', 'cancelled'
+  batch_size INTEGER NOT NULL,
+  throttle_ms INTEGER NOT NULL,
+  last_id UUID,
+  processed BIGINT NOT NULL DEFAULT 0,
+  total BIGINT NOT NULL,
+  error TEXT,
+  worker TEXT,
+  heartbeat_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  finished_at TIMESTAMP WITH TIME ZONE
+);
+-- One unfinished job at a time; failed jobs are resumed or cancelled
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reindex_jobs_unfinished ON reindex_jobs((true)) WHERE status IN ('running', 'paused', 'failed');
+
+-- Jobs run by the scheduler service: an HTTP call to another service on a
+-- cron schedule (UTC). token names the bearer token sent: 'admin'
+-- (ADMIN_API_KEY), 'notifier' (NOTIFIER_TOKEN) or 'none'.
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+  name TEXT PRIMARY KEY,
+  schedule TEXT NOT NULL,
+  method TEXT NOT NULL DEFAULT 'POST',
+  url TEXT NOT NULL,
+  token TEXT NOT NULL DEFAULT 'admin',
+  timeout_seconds INTEGER NOT NULL DEFAULT 300,
+  paused BOOLEAN NOT NULL DEFAULT false,
+  next_run_at TIMESTAMP WITH TIME ZONE, -- NULL until scheduled, and after resuming
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS job_runs (
+  id BIGSERIAL PRIMARY KEY,
+  job_name TEXT NOT NULL REFERENCES scheduled_jobs(name) ON DELETE CASCADE,
+  trigger TEXT NOT NULL, -- 'schedule', 'manual'
+  status TEXT NOT NULL DEFAULT 'queued', -- 'queued', 'running', 'succeeded', 'failed', 'skipped'
+  instance TEXT,
+  queued_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  started_at TIMESTAMP WITH TIME ZONE,
+  finished_at TIMESTAMP WITH TIME ZONE,
+  http_status INTEGER,
+  output TEXT -- the start of the response, or the error
+);
+CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs(job_name, id DESC);
+-- One run of a job at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_job_runs_active ON job_runs(job_name) WHERE status IN ('queued', 'running');
+
+INSERT INTO scheduled_jobs (name, schedule, url, token) VALUES
+  ('rescore', '0 3 * * *', 'http://reddit-collector:8082/rescore', 'admin'),
+  ('stats_snapshot', '@hourly', 'http://mcp-server:8084/admin/stats/snapshot', 'admin'),
+  ('send_digests', '0 8 * * *', 'http://notifier:8085/digests', 'notifier'),
+  ('send_weekly_summary', '0 8 * * 1', 'http://notifier:8085/summaries', 'notifier'),
+  ('apply_feedback', '0 4 * * *', 'http://mcp-server:8084/admin/feedback/apply', 'admin')
+ON CONFLICT DO NOTHING;
+
+-- One row per LLM call: who made it, for which feature, the tokens it used
+-- and its estimated cost. Budgets are checked against today's (UTC) rows.
+CREATE TABLE IF NOT EXISTS usage_ledger (
+  id BIGSERIAL PRIMARY KEY,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  user_id TEXT NOT NULL DEFAULT '',
+  feature TEXT NOT NULL, -- 'query', 'quiz', ...
+  provider TEXT NOT NULL,
+  model TEXT NOT NULL,
+  input_tokens INTEGER NOT NULL DEFAULT 0,
+  output_tokens INTEGER NOT NULL DEFAULT 0,
+  cost_usd NUMERIC(12, 6) NOT NULL DEFAULT 0,
+  request_id TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_usage_ledger_user ON usage_ledger(workspace_id, user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_ledger_feature ON usage_ledger(feature, created_at);
+
+-- Embeddings already computed, by model and the SHA-256 of the normalized
+-- text, so re-embedding unchanged text costs nothing. vector holds the
+-- float32s little-endian; used_at is bumped on every hit so stale entries
+-- can be purged.
+CREATE TABLE IF NOT EXISTS embedding_cache (
+  model TEXT NOT NULL,
+  text_hash TEXT NOT NULL,
+  dimensions INTEGER NOT NULL,
+  vector BYTEA NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  used_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (model, text_hash)
+);
+CREATE INDEX IF NOT EXISTS idx_embedding_cache_used ON embedding_cache(used_at);
+
+-- Whether a result was useful, as rated by a user. A user's latest rating of
+-- an item counts; /admin/feedback/apply blends the ratings of the last
+-- 180 days into the items' relevance scores and the topics' keyword weights.
+CREATE TABLE IF NOT EXISTS result_feedback (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  user_id TEXT NOT NULL DEFAULT 'default_user',
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  query_id UUID REFERENCES query_history(id) ON DELETE SET NULL,
+  query_text TEXT,
+  useful BOOLEAN NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_result_feedback_content ON result_feedback(content_id, user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_result_feedback_created ON result_feedback(created_at);
+
+-- The part of relevance_score that came from feedback, so the next blend
+-- (and a rescore) replaces it instead of adding to it
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS feedback_adjustment REAL NOT NULL DEFAULT 0;
+-- relevance_score before feedback, as last collected or rescored.
+-- relevance_score is it plus feedback_adjustment, clamped to 0..1; NULL for
+-- content stored before the column existed
+ALTER TABLE content_metadata ADD COLUMN IF NOT EXISTS base_relevance_score REAL;
+
+-- Learned multipliers of a topic's collector keywords, from feedback on
+-- content tagged with it: 1 is neutral, 0.5 to 1.5
+CREATE TABLE IF NOT EXISTS topic_weights (
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  topic TEXT NOT NULL,
+  weight REAL NOT NULL DEFAULT 1,
+  useful INTEGER NOT NULL DEFAULT 0,
+  not_useful INTEGER NOT NULL DEFAULT 0,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (workspace_id, topic)
+);
+
+-- Reddit score and comment count of each collected post at every
+-- collection cycle, kept 14 days. The MCP server's get_engagement_trends
+-- tool finds the posts whose engagement is accelerating in them
+CREATE TABLE IF NOT EXISTS content_engagement_snapshots (
+  content_id UUID NOT NULL REFERENCES content_metadata(id) ON DELETE CASCADE,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  score INTEGER NOT NULL,
+  num_comments INTEGER NOT NULL,
+  collected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_content_engagement_snapshots ON content_engagement_snapshots(workspace_id, collected_at);
+CREATE INDEX IF NOT EXISTS idx_content_engagement_snapshots_content ON content_engagement_snapshots(content_id, collected_at);
+
+-- Create watches table for the expressions users are notified of as soon
+-- as new content in the workspace matches them
+CREATE TABLE IF NOT EXISTS watches (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id TEXT NOT NULL,
+  workspace_id TEXT NOT NULL DEFAULT 'default',
+  expression TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (user_id, workspace_id, expression)
+);
+CREATE INDEX IF NOT EXISTS idx_watches_workspace ON watches(workspace_id);
+
 -- Insert initial data sources based on user/sources.yaml
 INSERT INTO data_sources (source_type, source_name, configuration) VALUES
   ('reddit', 'golang', '{"collection_interval": "5m", "max_posts_per_run": 50}'),
@@ -126,12 +731,85 @@ SELECT
 FROM learning_progress
 ORDER BY last_updated DESC;
 
+-- Daily content counts per platform (tag '') and per platform and tag,
+-- written by the MCP server's stats job. Trend queries sum a row per day
+-- instead of scanning content; the average relevance of a range is
+-- SUM(relevance_sum) / SUM(scored_items). Replaces dashboard_content_daily
+DROP MATERIALIZED VIEW IF EXISTS dashboard_content_daily;
+CREATE TABLE IF NOT EXISTS content_stats_daily (
+  workspace_id TEXT NOT NULL,
+  day DATE NOT NULL,
+  source_platform TEXT NOT NULL,
+  tag TEXT NOT NULL DEFAULT '',
+  items INTEGER NOT NULL,
+  scored_items INTEGER NOT NULL,
+  relevance_sum DOUBLE PRECISION NOT NULL,
+  PRIMARY KEY (workspace_id, day, source_platform, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_content_stats_daily_tag ON content_stats_daily(workspace_id, tag, day);
+
+-- Dashboard aggregates, refreshed by the MCP server every
+-- DASHBOARD_REFRESH_INTERVAL. The unique indexes let them be refreshed
+-- CONCURRENTLY, so dashboard reads never block on a refresh.
+
+-- Items per tag, and when the tag was last seen
+CREATE MATERIALIZED VIEW IF NOT EXISTS dashboard_tag_counts AS
+SELECT
+  workspace_id,
+  tag,
+  COUNT(*) AS items,
+  MAX(collection_date) AS last_seen
+FROM content_metadata, unnest(tags) AS tag
+GROUP BY 1, 2;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dashboard_tag_counts ON dashboard_tag_counts(workspace_id, tag);
+
+-- Bucket b counts relevance scores in [(b-1)/10, b/10); 1.0 falls in 10
+CREATE MATERIALIZED VIEW IF NOT EXISTS dashboard_relevance_histogram AS
+SELECT
+  workspace_id,
+  COALESCE(source_platform, 'unknown') AS source_platform,
+  LEAST(GREATEST(width_bucket(relevance_score, 0, 1, 10), 1), 10) AS bucket,
+  COUNT(*) AS items
+FROM content_metadata
+WHERE relevance_score IS NOT NULL
+GROUP BY 1, 2, 3;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dashboard_relevance_histogram ON dashboard_relevance_histogram(workspace_id, source_platform, bucket);
+
+-- The last progress computation of each day per topic
+CREATE MATERIALIZED VIEW IF NOT EXISTS dashboard_progress_daily AS
+SELECT DISTINCT ON (workspace_id, topic, date_trunc('day', recorded_at))
+  workspace_id,
+  topic,
+  date_trunc('day', recorded_at)::date AS day,
+  progress_score,
+  skill_level
+FROM learning_progress_history
+ORDER BY workspace_id, topic, date_trunc('day', recorded_at), recorded_at DESC;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dashboard_progress_daily ON dashboard_progress_daily(workspace_id, topic, day);
+
+-- What each platform collected lately, to spot collectors that stalled
+CREATE MATERIALIZED VIEW IF NOT EXISTS dashboard_platform_activity AS
+SELECT
+  workspace_id,
+  COALESCE(source_platform, 'unknown') AS source_platform,
+  MAX(collection_date) AS last_collected,
+  COUNT(*) FILTER (WHERE collection_date >= now() - INTERVAL '24 hours') AS items_24h,
+  now() AS refreshed_at
+FROM content_metadata
+GROUP BY 1, 2;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dashboard_platform_activity ON dashboard_platform_activity(workspace_id, source_platform);
+
 -- Grant permissions (for production, you'd want more restrictive permissions)
 GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
 GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
 
 -- Display success message
 \echo 'Selin database schema initialized successfully!'
-\echo 'Tables created: content_metadata, learning_progress, query_history, data_sources'
+\echo 'Tables created: content_metadata, learning_progress, query_history, data_sources, notification_preferences, user_preferences, learning_progress_history, content_interactions, review_items, quiz_cards, quiz_attempts, knowledge_concepts, concept_mentions, concept_edges, learning_goals, keyword_suggestions, content_revisions, tag_aliases, content_stats_daily, content_links, content_attachments, content_chunks, uploads, transcription_jobs, slack_import_marks, collections, collection_items, content_version, reindex_jobs, scheduled_jobs, job_runs, usage_ledger, embedding_cache, result_feedback, topic_weights, content_engagement_snapshots, watches'
 \echo 'Views created: recent_content, learning_analytics'
+\echo 'Materialized views created: dashboard_tag_counts, dashboard_relevance_histogram, dashboard_progress_daily, dashboard_platform_activity'
 \echo 'Database is ready for Selin services.'
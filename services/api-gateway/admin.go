@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"selin/internal/logging"
+)
+
+type AdminIdentityRequest struct {
+	Identity string `json:"identity"`
+}
+
+// Rate limit list management: GET lists entries, POST adds an identity,
+// DELETE removes the identity given in the query string.
+func rateLimitListHandler(rl *RateLimiter, list string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			entries, err := rl.ListEntries(r.Context(), list)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to read rate limit list", "list", list, "error", err)
+				http.Error(w, "Failed to read list", http.StatusInternalServerError)
+				return
+			}
+			if entries == nil {
+				entries = []string{}
+			}
+			writeJSON(w, map[string]interface{}{"list": list, "entries": entries})
+
+		case http.MethodPost:
+			var req AdminIdentityRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Identity == "" {
+				http.Error(w, "Identity is required", http.StatusBadRequest)
+				return
+			}
+			if err := rl.AddToList(r.Context(), list, req.Identity); err != nil {
+				logging.FromContext(r.Context()).Error("failed to add identity to rate limit list", "identity", req.Identity, "list", list, "error", err)
+				http.Error(w, "Failed to update list", http.StatusInternalServerError)
+				return
+			}
+			logging.FromContext(r.Context()).Info("added identity to rate limit list", "identity", req.Identity, "list", list)
+			writeJSON(w, map[string]interface{}{"list": list, "added": req.Identity})
+
+		case http.MethodDelete:
+			identity := r.URL.Query().Get("identity")
+			if identity == "" {
+				http.Error(w, "Identity is required", http.StatusBadRequest)
+				return
+			}
+			if err := rl.RemoveFromList(r.Context(), list, identity); err != nil {
+				logging.FromContext(r.Context()).Error("failed to remove identity from rate limit list", "identity", identity, "list", list, "error", err)
+				http.Error(w, "Failed to update list", http.StatusInternalServerError)
+				return
+			}
+			logging.FromContext(r.Context()).Info("removed identity from rate limit list", "identity", identity, "list", list)
+			writeJSON(w, map[string]interface{}{"list": list, "removed": identity})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// Reset a single identity's rate limit window
+func rateLimitResetHandler(rl *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req AdminIdentityRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Identity == "" {
+			http.Error(w, "Identity is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := rl.Reset(r.Context(), req.Identity); err != nil {
+			logging.FromContext(r.Context()).Error("failed to reset rate limit", "identity", req.Identity, "error", err)
+			http.Error(w, "Failed to reset rate limit", http.StatusInternalServerError)
+			return
+		}
+
+		logging.FromContext(r.Context()).Info("reset rate limit window", "identity", req.Identity)
+		writeJSON(w, map[string]interface{}{"reset": req.Identity})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/apikeys"
+	"selin/internal/logging"
+	"selin/internal/rbac"
+)
+
+// API keys are kept by internal/apikeys, shared with the other services
+// that face clients.
+const (
+	apiKeysKey   = apikeys.HashesKey
+	apiKeyPrefix = apikeys.Prefix
+)
+
+var errAPIKeyExists = apikeys.ErrExists
+
+type (
+	APIKeys    = apikeys.Store
+	APIKeyInfo = apikeys.Info
+)
+
+func NewAPIKeys(client *redis.Client) *APIKeys {
+	return apikeys.New(client)
+}
+
+// API key management: GET lists keys, POST {"name": ..., "workspace_id":
+// ..., "role": ...} issues a key and returns it once, DELETE ?name=...
+// revokes it. New keys are readers unless a role is given.
+func apiKeysHandler(keys *APIKeys, workspaces *Workspaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			list, err := keys.List(r.Context())
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to list API keys", "error", err)
+				http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"keys": list})
+
+		case http.MethodPost:
+			var req struct {
+				Name      string `json:"name"`
+				Workspace string `json:"workspace_id"`
+				Role      string `json:"role"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+				http.Error(w, "Name is required", http.StatusBadRequest)
+				return
+			}
+			if req.Workspace == "" {
+				req.Workspace = defaultWorkspace
+			}
+			if _, err := workspaces.Get(r.Context(), req.Workspace); err != nil {
+				http.Error(w, "Unknown workspace", http.StatusBadRequest)
+				return
+			}
+			if req.Role == "" {
+				req.Role = string(rbac.Reader)
+			}
+			role, ok := rbac.ParseRole(req.Role)
+			if !ok {
+				http.Error(w, "Role must be admin, editor or reader", http.StatusBadRequest)
+				return
+			}
+			key, err := keys.Create(r.Context(), req.Name, req.Workspace, role)
+			if errors.Is(err, errAPIKeyExists) {
+				http.Error(w, "An API key with that name already exists", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to create API key", "key_name", req.Name, "error", err)
+				http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+				return
+			}
+			logging.FromContext(r.Context()).Info("created API key", "key_name", req.Name, "role", role, "workspace", req.Workspace)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": req.Name, "workspace_id": req.Workspace, "role": role, "key": key})
+
+		case http.MethodDelete:
+			name := r.URL.Query().Get("name")
+			if name == "" {
+				http.Error(w, "Name is required", http.StatusBadRequest)
+				return
+			}
+			found, err := keys.Revoke(r.Context(), name)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to revoke API key", "key_name", name, "error", err)
+				http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "API key not found", http.StatusNotFound)
+				return
+			}
+			logging.FromContext(r.Context()).Info("revoked API key", "key_name", name)
+			writeJSON(w, map[string]interface{}{"revoked": name})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
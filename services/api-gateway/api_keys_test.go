@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"selin/internal/rbac"
+)
+
+func TestAPIKeysLifecycle(t *testing.T) {
+	rl, mr := newMiniredisLimiter(t, "10")
+	keys := NewAPIKeys(rl.client)
+	ctx := context.Background()
+
+	key, err := keys.Create(ctx, "laptop", defaultWorkspace, rbac.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Errorf("Expected key prefixed with %s, got %s", apiKeyPrefix, key)
+	}
+	if _, err := keys.Create(ctx, "laptop", defaultWorkspace, rbac.Reader); err != errAPIKeyExists {
+		t.Errorf("Expected duplicate name to be rejected, got %v", err)
+	}
+	fields, _ := mr.HKeys(apiKeysKey)
+	for _, field := range fields {
+		if strings.Contains(field, key) {
+			t.Error("Plaintext key must not be stored")
+		}
+	}
+
+	if info, _ := keys.Lookup(ctx, key); info == nil || info.Name != "laptop" || info.Workspace != defaultWorkspace {
+		t.Errorf("Expected key to resolve to laptop in the default workspace, got %+v", info)
+	}
+
+	if found, err := keys.Revoke(ctx, "laptop"); err != nil || !found {
+		t.Fatalf("Expected revoke to succeed, got %v %v", found, err)
+	}
+	if info, _ := keys.Lookup(ctx, key); info != nil {
+		t.Errorf("Expected revoked key to be rejected, got %+v", info)
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "10")
+	keys := NewAPIKeys(rl.client)
+	key, _ := keys.Create(context.Background(), "ci", defaultWorkspace, rbac.Reader)
+	handler := workspaceMiddleware(keys, NewWorkspaces(rl.client), true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"missing", "", "", http.StatusUnauthorized},
+		{"invalid", "X-API-Key", "selin_nope", http.StatusUnauthorized},
+		{"header", "X-API-Key", key, http.StatusOK},
+		{"bearer", "Authorization", "Bearer " + key, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/query", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestWorkspaceMiddlewareScopesRequests(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "10")
+	ctx := context.Background()
+	keys := NewAPIKeys(rl.client)
+	workspaces := NewWorkspaces(rl.client)
+	if err := workspaces.Save(ctx, Workspace{ID: "team-a", RateLimit: 1}); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := keys.Create(ctx, "team-a-ci", "team-a", rbac.Reader)
+
+	var seen string
+	handler := workspaceMiddleware(keys, workspaces, false, rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(workspaceHeader)
+	})))
+
+	send := func(key, claimed string) int {
+		req := httptest.NewRequest("GET", "/api/v1/query", nil)
+		req.Header.Set(workspaceHeader, claimed)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send(key, "other"); code != http.StatusOK || seen != "team-a" {
+		t.Errorf("Expected key to scope request to team-a, got %d %q", code, seen)
+	}
+	if code := send("", "team-a"); code != http.StatusOK || seen != defaultWorkspace {
+		t.Errorf("Expected keyless request in default workspace, got %d %q", code, seen)
+	}
+	if code := send(key, ""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected team-a's own limit of 1 to apply, got %d", code)
+	}
+
+	workspaces.Delete(ctx, "team-a")
+	if code := send(key, ""); code != http.StatusForbidden {
+		t.Errorf("Expected key for deleted workspace to be rejected, got %d", code)
+	}
+}
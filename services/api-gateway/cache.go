@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/httpcache"
+	"selin/internal/logging"
+)
+
+// Read-only API responses (content, tags, dashboards) can be cached in Redis
+// under the caller's workspace and the request URI. A cached response is
+// served as is for its route's TTL; after that it is revalidated with the
+// ETag the MCP server gave it, so an unchanged response costs the upstream
+// a version lookup rather than the query behind it.
+const (
+	responseCachePrefix = "response_cache:"
+	// Entries are kept this long past their TTL so they can be revalidated
+	// rather than fetched again
+	responseCacheRetention = time.Hour
+	// Larger responses are passed through without being cached
+	maxCachedBody = 1 << 20
+)
+
+type cachedResponse struct {
+	ETag        string    `json:"etag"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	StoredAt    time.Time `json:"stored_at"`
+}
+
+// serve writes the cached response, or 304 Not Modified when the client
+// already has it.
+func (c *cachedResponse) serve(w http.ResponseWriter, r *http.Request, result string) {
+	w.Header().Set("ETag", c.ETag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Cache", result)
+	if httpcache.Matches(r.Header.Get("If-None-Match"), c.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if c.ContentType != "" {
+		w.Header().Set("Content-Type", c.ContentType)
+	}
+	w.Write(c.Body)
+}
+
+type ResponseCache struct {
+	client *redis.Client
+}
+
+func NewResponseCache(client *redis.Client) *ResponseCache {
+	return &ResponseCache{client: client}
+}
+
+// Handler caches the GET responses of next, a route of the given name, for
+// ttl. Only responses carrying an ETag are cached. With no ttl next is
+// returned as is, and clients' conditional requests are answered upstream.
+func (c *ResponseCache) Handler(route string, ttl time.Duration, next http.Handler) http.Handler {
+	if ttl <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		key := responseCachePrefix + workspaceFrom(ctx).ID + ":" + r.URL.RequestURI()
+
+		cached := c.get(ctx, key)
+		if cached != nil && time.Since(cached.StoredAt) < ttl {
+			responseCacheResults.WithLabelValues(route, "hit").Inc()
+			cached.serve(w, r, "HIT")
+			return
+		}
+
+		// Ask upstream about the cached response, not the client's copy, so
+		// a fresh body is stored even when the client has it
+		out := r.Clone(ctx)
+		out.Header.Del("If-None-Match")
+		if cached != nil {
+			out.Header.Set("If-None-Match", cached.ETag)
+		}
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(rec, out)
+
+		switch {
+		case cached != nil && rec.status == http.StatusNotModified:
+			cached.StoredAt = time.Now()
+			c.set(ctx, key, cached, ttl)
+			responseCacheResults.WithLabelValues(route, "revalidated").Inc()
+			cached.serve(w, r, "REVALIDATED")
+		case rec.status == http.StatusOK && rec.header.Get("ETag") != "" && rec.body.Len() <= maxCachedBody:
+			entry := &cachedResponse{
+				ETag:        rec.header.Get("ETag"),
+				ContentType: rec.header.Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+				StoredAt:    time.Now(),
+			}
+			c.set(ctx, key, entry, ttl)
+			responseCacheResults.WithLabelValues(route, "miss").Inc()
+			entry.serve(w, r, "MISS")
+		default:
+			responseCacheResults.WithLabelValues(route, "bypass").Inc()
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+		}
+	})
+}
+
+func (c *ResponseCache) get(ctx context.Context, key string) *cachedResponse {
+	raw, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logging.FromContext(ctx).Warn("failed to read cached response", "key", key, "error", err)
+		}
+		return nil
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal(raw, &cached); err != nil {
+		return nil
+	}
+	return &cached
+}
+
+func (c *ResponseCache) set(ctx context.Context, key string, entry *cachedResponse, ttl time.Duration) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := c.client.Set(ctx, key, raw, ttl+responseCacheRetention).Err(); err != nil {
+		logging.FromContext(ctx).Warn("failed to cache response", "key", key, "error", err)
+	}
+}
+
+// bufferedResponse holds an upstream response until the cache has decided
+// what to send.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if !b.wrote {
+		b.wrote = true
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
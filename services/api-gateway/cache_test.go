@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/httpcache"
+)
+
+// fakeContentUpstream answers like the MCP server's read-only endpoints,
+// with ETags of *version, and counts the requests it runs the query for.
+func fakeContentUpstream(version *int64, queries *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := httpcache.ETag(*version, r.URL.RequestURI())
+		if httpcache.Matches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		*queries++
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"tags":[]}`))
+	})
+}
+
+func newTestResponseCache(t *testing.T) *ResponseCache {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewResponseCache(client)
+}
+
+func TestResponseCache(t *testing.T) {
+	version, queries := int64(1), 0
+	handler := newTestResponseCache(t).Handler("tags", 50*time.Millisecond, fakeContentUpstream(&version, &queries))
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/tags?limit=5", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != "MISS" || rr.Body.String() != `{"tags":[]}` || etag == "" {
+		t.Fatalf("Expected the first response fetched, got %d %s %q", rr.Code, rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+	if rr = get(""); rr.Header().Get("X-Cache") != "HIT" || rr.Body.String() != `{"tags":[]}` || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the cached response, got %s %q", rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+	if rr = get(etag); rr.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for the client's current copy, got %d", rr.Code)
+	}
+	if queries != 1 {
+		t.Errorf("Expected one upstream query, got %d", queries)
+	}
+
+	// Once stale the entry is revalidated, and refetched after a write
+	time.Sleep(60 * time.Millisecond)
+	if rr = get(""); rr.Header().Get("X-Cache") != "REVALIDATED" || rr.Body.String() != `{"tags":[]}` || queries != 1 {
+		t.Errorf("Expected the unchanged response revalidated, got %s after %d queries", rr.Header().Get("X-Cache"), queries)
+	}
+	time.Sleep(60 * time.Millisecond)
+	version++
+	if rr = get(etag); rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != "MISS" || rr.Header().Get("ETag") == etag || queries != 2 {
+		t.Errorf("Expected the changed response fetched, got %d %s after %d queries", rr.Code, rr.Header().Get("X-Cache"), queries)
+	}
+}
+
+func TestResponseCacheBypass(t *testing.T) {
+	cache := newTestResponseCache(t)
+	calls := 0
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "Content not found", http.StatusNotFound)
+	})
+	handler := cache.Handler("content", time.Minute, upstream)
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/content/missing", nil))
+		if rr.Code != http.StatusNotFound || rr.Header().Get("X-Cache") != "" {
+			t.Errorf("Expected the 404 passed through, got %d %s", rr.Code, rr.Header().Get("X-Cache"))
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected errors not cached, got %d upstream calls", calls)
+	}
+
+	// Responses are kept per workspace
+	version, queries := int64(1), 0
+	handler = cache.Handler("tags", time.Minute, fakeContentUpstream(&version, &queries))
+	for _, workspace := range []string{"default", "research", "default"} {
+		req := httptest.NewRequest("GET", "/api/v1/tags", nil)
+		req = req.WithContext(context.WithValue(req.Context(), workspaceContextKey{}, Workspace{ID: workspace}))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if queries != 2 {
+		t.Errorf("Expected one upstream query per workspace, got %d", queries)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies holds the networks whose forwarding headers we believe.
+// Requests arriving from anywhere else are keyed on their socket address.
+type trustedProxies struct {
+	nets []*net.IPNet
+}
+
+// parseTrustedProxies reads a comma-separated list of CIDRs or bare IPs,
+// e.g. "10.0.0.0/8,192.168.1.10". Invalid entries are logged and skipped.
+func parseTrustedProxies(spec string) *trustedProxies {
+	tp := &trustedProxies{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			slog.Warn("ignoring invalid trusted proxy", "entry", entry, "error", err)
+			continue
+		}
+		tp.nets = append(tp.nets, ipNet)
+	}
+	return tp
+}
+
+func (tp *trustedProxies) contains(ip net.IP) bool {
+	for _, n := range tp.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the normalized address of the client that originated the
+// request. Forwarding headers are only honored when the direct peer is a
+// trusted proxy; X-Forwarded-For is walked right to left so a client cannot
+// spoof its address by prepending entries.
+func (tp *trustedProxies) clientIP(r *http.Request) string {
+	peer := parseHostIP(r.RemoteAddr)
+	if peer == nil {
+		return r.RemoteAddr
+	}
+	if !tp.contains(peer) {
+		return normalizeIP(peer)
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		var leftmost net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := parseHostIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			leftmost = ip
+			if !tp.contains(ip) {
+				return normalizeIP(ip)
+			}
+		}
+		if leftmost != nil {
+			return normalizeIP(leftmost)
+		}
+	}
+
+	if ip := parseHostIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return normalizeIP(ip)
+	}
+
+	return normalizeIP(peer)
+}
+
+// identity returns the key requests are limited under: the name of the
+// caller's API key, otherwise the client address. Headers the client sets,
+// such as X-User-ID, never choose it.
+func (tp *trustedProxies) identity(r *http.Request) string {
+	if name := keyNameFrom(r.Context()); name != "" {
+		return name
+	}
+	return "ip:" + tp.clientIP(r)
+}
+
+// parseHostIP accepts "ip", "ip:port" and "[ipv6]:port".
+func parseHostIP(addr string) net.IP {
+	if addr == "" {
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// normalizeIP renders IPv4 (including IPv4-mapped IPv6) in dotted form and
+// collapses IPv6 to its /64, since a single client typically controls a
+// whole /64 and could otherwise rotate addresses to dodge limits.
+func normalizeIP(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
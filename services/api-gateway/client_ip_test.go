@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8, 192.168.1.10, fd00::/8, not-a-cidr")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{"direct client strips port", "203.0.113.7:51234", "", "", "203.0.113.7"},
+		{"untrusted peer ignores headers", "203.0.113.7:51234", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy uses forwarded client", "10.1.2.3:80", "198.51.100.1", "", "198.51.100.1"},
+		{"skips trusted hops right to left", "10.1.2.3:80", "1.1.1.1, 198.51.100.1, 10.9.9.9", "", "198.51.100.1"},
+		{"all hops trusted uses leftmost", "10.1.2.3:80", "10.5.5.5, 10.6.6.6", "", "10.5.5.5"},
+		{"falls back to X-Real-IP", "192.168.1.10:80", "", "198.51.100.9", "198.51.100.9"},
+		{"trusted proxy without headers", "10.1.2.3:80", "", "", "10.1.2.3"},
+		{"ipv4-mapped ipv6", "[::ffff:203.0.113.7]:443", "", "", "203.0.113.7"},
+		{"ipv6 collapsed to /64", "[2001:db8:1:2:aaaa::1]:443", "", "", "2001:db8:1:2::/64"},
+		{"trusted ipv6 proxy", "[fd00::1]:443", "2001:db8:1:2::5", "", "2001:db8:1:2::/64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/query", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xRealIP != "" {
+				req.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+
+			if got := proxies.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	proxies := parseTrustedProxies("")
+	req := httptest.NewRequest("GET", "/api/v1/query", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	req.Header.Set("X-User-ID", "alice")
+	if got := proxies.identity(req); got != "ip:203.0.113.7" {
+		t.Errorf("Expected a keyless caller limited by address, got %q", got)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), keyNameContextKey{}, "bob-laptop"))
+	if got := proxies.identity(req); got != "bob-laptop" {
+		t.Errorf("Expected the API key's name, got %q", got)
+	}
+}
+
+func TestParseTrustedProxiesSkipsInvalid(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8,,bogus,127.0.0.1")
+	if len(proxies.nets) != 2 {
+		t.Errorf("expected 2 valid networks, got %d", len(proxies.nets))
+	}
+}
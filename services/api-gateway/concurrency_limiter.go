@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimiter bounds how many requests run at once, globally and per
+// identity. Requests over the global limit wait in a bounded queue; requests
+// over an identity's own limit are rejected straight away.
+type ConcurrencyLimiter struct {
+	slots        chan struct{}
+	perUser      int
+	queueSize    int
+	queueTimeout time.Duration
+	proxies      *trustedProxies
+
+	mu       sync.Mutex
+	inFlight map[string]int
+	waiting  int
+}
+
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		slots:        make(chan struct{}, envInt("MAX_CONCURRENT_REQUESTS", 32)),
+		perUser:      envInt("MAX_CONCURRENT_PER_USER", 4),
+		queueSize:    envInt("CONCURRENCY_QUEUE_SIZE", 64),
+		queueTimeout: envDuration("CONCURRENCY_QUEUE_TIMEOUT", 10*time.Second),
+		proxies:      parseTrustedProxies(os.Getenv("TRUSTED_PROXIES")),
+		inFlight:     make(map[string]int),
+	}
+}
+
+func (cl *ConcurrencyLimiter) acquireUser(identity string) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.inFlight[identity] >= cl.perUser {
+		return false
+	}
+	cl.inFlight[identity]++
+	return true
+}
+
+func (cl *ConcurrencyLimiter) releaseUser(identity string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.inFlight[identity] <= 1 {
+		delete(cl.inFlight, identity)
+		return
+	}
+	cl.inFlight[identity]--
+}
+
+// acquireSlot takes a global slot, queueing for up to queueTimeout when all
+// slots are busy. It fails immediately if the queue itself is full.
+func (cl *ConcurrencyLimiter) acquireSlot(r *http.Request) bool {
+	select {
+	case cl.slots <- struct{}{}:
+		inFlightRequests.Inc()
+		return true
+	default:
+	}
+
+	cl.mu.Lock()
+	if cl.waiting >= cl.queueSize {
+		cl.mu.Unlock()
+		return false
+	}
+	cl.waiting++
+	cl.mu.Unlock()
+	queuedRequests.Inc()
+
+	defer func() {
+		cl.mu.Lock()
+		cl.waiting--
+		cl.mu.Unlock()
+		queuedRequests.Dec()
+	}()
+
+	timer := time.NewTimer(cl.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case cl.slots <- struct{}{}:
+		inFlightRequests.Inc()
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (cl *ConcurrencyLimiter) releaseSlot() {
+	<-cl.slots
+	inFlightRequests.Dec()
+}
+
+// Middleware for concurrency limiting
+func (cl *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(cl.queueTimeout.Seconds()) + 1)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := workspaceFrom(r.Context()).identity(cl.proxies.identity(r))
+
+		if !cl.acquireUser(identity) {
+			concurrencyRejections.WithLabelValues("per_user").Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many concurrent requests", http.StatusTooManyRequests)
+			return
+		}
+		defer cl.releaseUser(identity)
+
+		if !cl.acquireSlot(r) {
+			concurrencyRejections.WithLabelValues("global").Inc()
+			w.Header().Set("Retry-After", retryAfter)
+			http.Error(w, "Server busy", http.StatusServiceUnavailable)
+			return
+		}
+		defer cl.releaseSlot()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingHandler holds every request until release is closed.
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+}
+
+func serveAsync(handler http.Handler, userID string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest("POST", "/api/v1/query", nil)
+		req = req.WithContext(context.WithValue(req.Context(), keyNameContextKey{}, userID))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		done <- rr
+	}()
+	return done
+}
+
+func TestConcurrencyLimiterPerUser(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_PER_USER", "2")
+	cl := NewConcurrencyLimiter()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	handler := cl.Middleware(blockingHandler(started, release))
+
+	first := serveAsync(handler, "alice")
+	second := serveAsync(handler, "alice")
+	<-started
+	<-started
+
+	rr := <-serveAsync(handler, "alice")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for third concurrent request, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	other := serveAsync(handler, "bob")
+	<-started
+
+	close(release)
+	for _, ch := range []<-chan *httptest.ResponseRecorder{first, second, other} {
+		if rr := <-ch; rr.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", rr.Code)
+		}
+	}
+}
+
+func TestConcurrencyLimiterQueuesThenServes(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_REQUESTS", "1")
+	t.Setenv("CONCURRENCY_QUEUE_SIZE", "1")
+	cl := NewConcurrencyLimiter()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	handler := cl.Middleware(blockingHandler(started, release))
+
+	first := serveAsync(handler, "alice")
+	<-started
+
+	queued := serveAsync(handler, "bob")
+	waitFor(t, func() bool { cl.mu.Lock(); defer cl.mu.Unlock(); return cl.waiting == 1 })
+
+	rr := <-serveAsync(handler, "carol")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when queue is full, got %d", rr.Code)
+	}
+
+	close(release)
+	if rr := <-first; rr.Code != http.StatusOK {
+		t.Errorf("expected first request to succeed, got %d", rr.Code)
+	}
+	<-started
+	if rr := <-queued; rr.Code != http.StatusOK {
+		t.Errorf("expected queued request to be served, got %d", rr.Code)
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_REQUESTS", "1")
+	t.Setenv("CONCURRENCY_QUEUE_TIMEOUT", "20ms")
+	cl := NewConcurrencyLimiter()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	handler := cl.Middleware(blockingHandler(started, release))
+
+	first := serveAsync(handler, "alice")
+	<-started
+
+	rr := <-serveAsync(handler, "bob")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 after queue timeout, got %d", rr.Code)
+	}
+
+	close(release)
+	<-first
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if len(cl.inFlight) != 0 || cl.waiting != 0 {
+		t.Errorf("expected limiter to be drained, got inFlight=%v waiting=%d", cl.inFlight, cl.waiting)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
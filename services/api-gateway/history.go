@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"selin/internal/clients"
+	"selin/internal/logging"
+)
+
+// recordQuestion stores a question in the MCP server's query history. It
+// is called in the background, so failures are only logged.
+func recordQuestion(mcp *clients.MCPServerClient, workspace string, q clients.QueryRecord) {
+	ctx := logging.WithRequestID(context.Background(), q.RequestID)
+	if err := mcp.RecordQuery(ctx, workspace, q); err != nil {
+		slog.Warn("failed to record query history", "request_id", q.RequestID, "error", err)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"selin/internal/ratelimit"
+	"selin/internal/rbac"
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration . (needs a Docker daemon)
+
+// The unit tests run the limiter's script on miniredis; these check it and
+// the API keys against a real Redis.
+func TestRedisAgainstContainer(t *testing.T) {
+	testenv.Redis(t)
+	t.Setenv("RATE_LIMIT", "3")
+	rl := NewRateLimiter()
+	t.Cleanup(func() { rl.Close() })
+	ctx := context.Background()
+
+	t.Run("sliding window", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if allowed, err := rl.IsAllowed(ctx, "alice"); err != nil || !allowed {
+				t.Fatalf("Request %d: expected to be allowed, got %v %v", i+1, allowed, err)
+			}
+		}
+		if allowed, _ := rl.IsAllowed(ctx, "alice"); allowed {
+			t.Error("Expected the fourth request to be limited")
+		}
+		if rl.Mode() != "redis" {
+			t.Errorf("Expected the limiter to use Redis, got %s", rl.Mode())
+		}
+		if err := rl.Reset(ctx, "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if allowed, _ := rl.IsAllowed(ctx, "alice"); !allowed {
+			t.Error("Expected a reset identity to be allowed again")
+		}
+	})
+
+	t.Run("deny and allow lists", func(t *testing.T) {
+		if err := rl.AddToList(ctx, "denylist", "mallory"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rl.IsAllowed(ctx, "mallory"); !errors.Is(err, ratelimit.ErrBlocked) {
+			t.Errorf("Expected a denylisted identity to be blocked, got %v", err)
+		}
+		if err := rl.AddToList(ctx, "allowlist", "ci"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			if allowed, _ := rl.IsAllowed(ctx, "ci"); !allowed {
+				t.Fatalf("Request %d: expected an allowlisted identity to be unlimited", i+1)
+			}
+		}
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		keys := NewAPIKeys(rl.client)
+		key, err := keys.Create(ctx, "laptop", "team", rbac.Editor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := keys.Lookup(ctx, key)
+		if err != nil || info == nil || info.Workspace != "team" || info.Role != rbac.Editor {
+			t.Fatalf("Unexpected lookup: %+v %v", info, err)
+		}
+		if revoked, err := keys.Revoke(ctx, "laptop"); err != nil || !revoked {
+			t.Fatalf("Expected the key to be revoked, got %v %v", revoked, err)
+		}
+		if info, _ := keys.Lookup(ctx, key); info != nil {
+			t.Errorf("Expected a revoked key to be invalid, got %+v", info)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// Limit bounds the request body and the handling time of a route. Requests
+// declaring a larger body are rejected with 413 before they are handled;
+// bodies that turn out larger fail when read past MaxBody. Requests still
+// running after Timeout have their context cancelled and get 504.
+type Limit struct {
+	MaxBody int64
+	Timeout time.Duration
+}
+
+// RouteLimits applies Default to every route except those under a prefix
+// in Routes, matched longest prefix first.
+type RouteLimits struct {
+	Default Limit
+	Routes  map[string]Limit
+}
+
+// writeGrace is how long past its Timeout a request may take to write the
+// 504, or a response that was already being written.
+const writeGrace = 5 * time.Second
+
+// routeLimitsFromEnv returns the limits the gateway enforces: 1 MB and 15
+// seconds for most routes, more time for queries and downloads of uploads,
+// and more of both for uploads passed on to the file uploader.
+func routeLimitsFromEnv() RouteLimits {
+	uploadTimeout := envDuration("UPLOAD_TIMEOUT", 5*time.Minute)
+	return RouteLimits{
+		Default: Limit{
+			MaxBody: int64(envInt("API_MAX_BODY_BYTES", 1<<20)),
+			Timeout: envDuration("API_TIMEOUT", 15*time.Second),
+		},
+		Routes: map[string]Limit{
+			"/api/v1/query": {
+				MaxBody: 64 << 10,
+				Timeout: envDuration("QUERY_TIMEOUT", 60*time.Second),
+			},
+			"/api/v1/upload/": {
+				MaxBody: int64(envInt("UPLOAD_MAX_BODY_BYTES", 100<<20)),
+				Timeout: uploadTimeout,
+			},
+			"/api/v1/ingest/": {
+				MaxBody: int64(envInt("UPLOAD_MAX_BODY_BYTES", 100<<20)),
+				Timeout: uploadTimeout,
+			},
+			"/api/v1/uploads/": {
+				MaxBody: int64(envInt("API_MAX_BODY_BYTES", 1<<20)),
+				Timeout: uploadTimeout,
+			},
+		},
+	}
+}
+
+// For returns the limit of path and the route it was matched by, "default"
+// when none was.
+func (l RouteLimits) For(path string) (string, Limit) {
+	route, limit := "default", l.Default
+	for prefix, candidate := range l.Routes {
+		if strings.HasPrefix(path, prefix) && (route == "default" || len(prefix) > len(route)) {
+			route, limit = prefix, candidate
+		}
+	}
+	return route, limit
+}
+
+// Middleware enforces each request's route limit. The connection's read
+// and write deadlines follow the route's timeout, so routes may take
+// longer than the server's own timeouts.
+func (l RouteLimits) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, limit := l.For(r.URL.Path)
+		if r.ContentLength > limit.MaxBody {
+			routeLimitsExceeded.WithLabelValues(route, "body").Inc()
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit.MaxBody)
+
+		rc := http.NewResponseController(w)
+		deadline := time.Now().Add(limit.Timeout)
+		if err := rc.SetReadDeadline(deadline); err != nil && err != http.ErrNotSupported {
+			logging.FromContext(r.Context()).Warn("failed to set read deadline", "error", err)
+		}
+		if err := rc.SetWriteDeadline(deadline.Add(writeGrace)); err != nil && err != http.ErrNotSupported {
+			logging.FromContext(r.Context()).Warn("failed to set write deadline", "error", err)
+		}
+
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		switch {
+		case sw.status == http.StatusRequestEntityTooLarge:
+			routeLimitsExceeded.WithLabelValues(route, "body").Inc()
+		case ctx.Err() == context.DeadlineExceeded && (sw.status == 0 || sw.status == http.StatusGatewayTimeout):
+			routeLimitsExceeded.WithLabelValues(route, "timeout").Inc()
+			if sw.status == 0 {
+				http.Error(w, "Request timed out", http.StatusGatewayTimeout)
+			}
+		}
+	})
+}
+
+// statusWriter records the status of the response, 0 until one is written.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
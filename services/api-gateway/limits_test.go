@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"selin/internal/clients"
+)
+
+func testLimits() RouteLimits {
+	return RouteLimits{
+		Default: Limit{MaxBody: 16, Timeout: time.Second},
+		Routes: map[string]Limit{
+			"/api/v1/upload/": {MaxBody: 1024, Timeout: 50 * time.Millisecond},
+		},
+	}
+}
+
+func TestRouteLimitsFor(t *testing.T) {
+	limits := routeLimitsFromEnv()
+	if route, limit := limits.For("/api/v1/upload/file"); route != "/api/v1/upload/" || limit.MaxBody <= limits.Default.MaxBody {
+		t.Errorf("Expected uploads to allow larger bodies, got %s %+v", route, limit)
+	}
+	if route, limit := limits.For("/api/v1/goals"); route != "default" || limit != limits.Default {
+		t.Errorf("Expected the default limit, got %s %+v", route, limit)
+	}
+}
+
+func TestRouteLimitsBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("stored"))
+	}))
+	defer upstream.Close()
+	handler := testLimits().Middleware(clients.Proxy(upstream.URL, "/api/v1", http.MethodPost))
+
+	post := func(path string, body io.Reader) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", path, body))
+		return rr
+	}
+	if rr := post("/api/v1/goals", strings.NewReader(strings.Repeat("x", 17))); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a declared body over the limit, got %d", rr.Code)
+	}
+	// A body of unknown length is cut off once it passes the limit
+	if rr := post("/api/v1/goals", io.NopCloser(strings.NewReader(strings.Repeat("x", 17)))); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a streamed body over the limit, got %d", rr.Code)
+	}
+	if rr := post("/api/v1/upload/file", strings.NewReader(strings.Repeat("x", 512))); rr.Code != http.StatusOK || rr.Body.String() != "stored" {
+		t.Errorf("Expected the upload route to allow larger bodies, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRouteLimitsTimeout(t *testing.T) {
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	rr := httptest.NewRecorder()
+	testLimits().Middleware(blocking).ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/upload/file", nil))
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 for a handler past its timeout, got %d", rr.Code)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	rr = httptest.NewRecorder()
+	testLimits().Middleware(clients.Proxy(slow.URL, "/api/v1", http.MethodPost)).ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/upload/file", nil))
+	if rr.Code != http.StatusGatewayTimeout || !strings.Contains(rr.Body.String(), "timed out") {
+		t.Errorf("Expected 504 for a slow upstream, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestQueryHandlerBodyTooLarge(t *testing.T) {
+	body := `{"prompt":"` + strings.Repeat("x", 64<<10) + `"}`
+	rr := httptest.NewRecorder()
+	routeLimitsFromEnv().Middleware(http.HandlerFunc(queryHandler)).ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/query", io.NopCloser(strings.NewReader(body))))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized query, got %d", rr.Code)
+	}
+}
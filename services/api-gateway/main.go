@@ -3,16 +3,31 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"selin/internal/adminauth"
+	"selin/internal/clients"
+	"selin/internal/config"
+	"selin/internal/flags"
+	"selin/internal/healthcheck"
+	"selin/internal/llm"
+	"selin/internal/logging"
+	"selin/internal/query"
+	"selin/internal/rbac"
+	"selin/internal/tlsserve"
+	"selin/internal/tokenizer"
 )
 
 // Metrics
@@ -31,34 +46,106 @@ var (
 		},
 		[]string{"method", "endpoint"},
 	)
+	rateLimiterDegraded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_rate_limiter_degraded",
+			Help: "Whether rate limiting is running on its fallback because Redis is unavailable (1) or not (0)",
+		},
+	)
+	inFlightRequests = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_inflight_requests",
+			Help: "Number of API requests currently being handled",
+		},
+	)
+	queuedRequests = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_queued_requests",
+			Help: "Number of API requests waiting for a concurrency slot",
+		},
+	)
+	concurrencyRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_concurrency_rejections_total",
+			Help: "Total number of API requests rejected by the concurrency limiter",
+		},
+		[]string{"reason"},
+	)
+
+	responseCacheResults = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_response_cache_total",
+			Help: "Total number of cacheable API requests by route and cache result",
+		},
+		[]string{"route", "result"},
+	)
+
+	routeLimitsExceeded = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_route_limit_exceeded_total",
+			Help: "Total number of requests rejected for a body over their route's limit (body) or running past its timeout (timeout)",
+		},
+		[]string{"route", "limit"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(requestsTotal)
 	prometheus.MustRegister(requestDuration)
+	prometheus.MustRegister(rateLimiterDegraded)
+	prometheus.MustRegister(inFlightRequests)
+	prometheus.MustRegister(queuedRequests)
+	prometheus.MustRegister(concurrencyRejections)
+	prometheus.MustRegister(responseCacheResults)
+	prometheus.MustRegister(routeLimitsExceeded)
 }
 
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Version   string    `json:"version"`
+	Status       string                        `json:"status"`
+	Timestamp    time.Time                     `json:"timestamp"`
+	Version      string                        `json:"version"`
+	RateLimiting string                        `json:"rate_limiting,omitempty"`
+	Flags        map[flags.Flag]flags.Rule     `json:"flags,omitempty"`
+	Checks       map[string]healthcheck.Result `json:"checks,omitempty"`
 }
 
 type QueryRequest struct {
 	Prompt string `json:"prompt"`
 	UserID string `json:"user_id,omitempty"`
+	// MaxTokens caps the length of the response, 0 for no limit
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// ContextOnly skips the LLM's answer even when one is configured
+	ContextOnly bool `json:"context_only,omitempty"`
 }
 
 type QueryResponse struct {
-	Response  string    `json:"response"`
-	RequestID string    `json:"request_id"`
-	Timestamp time.Time `json:"timestamp"`
+	// Response is the context gathered for the prompt, citing Sources
+	Response    string         `json:"response"`
+	Answer      string         `json:"answer,omitempty"`
+	AnswerError string         `json:"answer_error,omitempty"` // why there is no answer, such as a spent budget
+	Sources     []query.Source `json:"sources"`
+	Steps       []QueryStep    `json:"steps"`
+	TokenCount  int            `json:"token_count"`
+	RequestID   string         `json:"request_id"`
+	Timestamp   time.Time      `json:"timestamp"`
+}
+
+// QueryStep reports how one of the tools called for the prompt went: "ok",
+// "empty" when it found nothing, or "error".
+type QueryStep struct {
+	Tool   string `json:"tool"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
 // Middleware to track metrics
-func metricsMiddleware(next http.Handler) http.Handler {
+// metricsMiddleware counts and times requests by the route they matched,
+// the pattern of the first of routes with one, so that IDs in paths do not
+// make a series each.
+func metricsMiddleware(next http.Handler, routes ...*http.ServeMux) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		endpoint := routePattern(r, routes)
 
 		// Wrap ResponseWriter to capture status code
 		wrapper := &responseWrapper{ResponseWriter: w, statusCode: http.StatusOK}
@@ -68,11 +155,22 @@ func metricsMiddleware(next http.Handler) http.Handler {
 		duration := time.Since(start).Seconds()
 		statusCode := fmt.Sprintf("%d", wrapper.statusCode)
 
-		requestsTotal.WithLabelValues(r.Method, r.URL.Path, statusCode).Inc()
-		requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+		requestsTotal.WithLabelValues(r.Method, endpoint, statusCode).Inc()
+		requestDuration.WithLabelValues(r.Method, endpoint).Observe(duration)
 	})
 }
 
+// routePattern returns the pattern r matches in the first of muxes that has
+// a route for it, or "unmatched".
+func routePattern(r *http.Request, muxes []*http.ServeMux) string {
+	for _, mux := range muxes {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
+
 type responseWrapper struct {
 	http.ResponseWriter
 	statusCode int
@@ -83,32 +181,61 @@ func (rw *responseWrapper) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWrapper) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
+
 // Health endpoint
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status:    "OK",
 		Timestamp: time.Now(),
 		Version:   "1.0.0",
+		Flags:     flags.Default().Rules(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// Readiness endpoint
-func readyHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Add checks for dependent services (Redis, MCP Server)
-	response := HealthResponse{
-		Status:    "READY",
-		Timestamp: time.Now(),
-		Version:   "1.0.0",
+// Readiness endpoint. Redis and the MCP server are checked but optional:
+// the rate limiter falls back without Redis and only the /api/v1 routes
+// proxied to the MCP server need it, so neither takes the gateway out of
+// service. A degraded rate limiter is reported alongside the status.
+func readyHandler(rl *RateLimiter) http.HandlerFunc {
+	checks := healthcheck.New("api-gateway")
+	if rl != nil {
+		checks.Register(healthcheck.Check{Name: "redis", Probe: healthcheck.Redis(rl.client), Optional: true})
 	}
+	checks.Register(healthcheck.Check{Name: "mcp-server", Probe: healthcheck.HTTP(clients.MCPServer.URL() + "/health"), Optional: true})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checks.Run(r.Context())
+		response := HealthResponse{
+			Status:    report.Status,
+			Timestamp: report.Timestamp,
+			Version:   "1.0.0",
+			Checks:    report.Checks,
+		}
+		if rl != nil {
+			response.RateLimiting = rl.Mode()
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != healthcheck.StatusReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	}
 }
 
-// Query endpoint (placeholder - will route to MCP Server)
+// queryPipeline gathers the context /api/v1/query answers with from the
+// MCP server's tools; the ws service streams the same pipeline.
+var queryPipeline = query.New(clients.MCPServer.URL())
+
+// mcpServer records the questions asked in the query history.
+var mcpServer = clients.NewMCPServer(clients.MCPServer.URL())
+
+// Query endpoint: returns the context assembled for the prompt and, with
+// an LLM configured, its answer from it
 func queryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -117,6 +244,11 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req QueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
@@ -125,26 +257,128 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Prompt is required", http.StatusBadRequest)
 		return
 	}
+	if req.MaxTokens < 0 {
+		http.Error(w, "max_tokens must not be negative", http.StatusBadRequest)
+		return
+	}
 
-	// TODO: Implement rate limiting with Redis
-	// TODO: Route to MCP Server
+	requestID := logging.RequestID(r.Context())
+	workspace := workspaceFrom(r.Context()).ID
+	go recordQuestion(mcpServer, workspace, clients.QueryRecord{
+		Query:     req.Prompt,
+		Tool:      "query",
+		UserID:    keyNameFrom(r.Context()),
+		RequestID: requestID,
+	})
+
+	answer, err := queryPipeline.Ask(r.Context(), query.Caller{
+		Workspace: workspace,
+		UserID:    keyNameFrom(r.Context()),
+		RequestID: requestID,
+	}, req.Prompt, req.MaxTokens, !req.ContextOnly)
+	var answerError string
+	if answer != nil && err != nil {
+		// The context still answers the question without the LLM
+		logging.FromContext(r.Context()).Warn("llm answer failed", "error", err)
+		answerError = query.AnswerError(err)
+	} else if err != nil {
+		logging.FromContext(r.Context()).Warn("query failed", "error", err)
+		if r.Context().Err() == context.DeadlineExceeded {
+			http.Error(w, "Query timed out", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, "No context found for the question", http.StatusBadGateway)
+		return
+	}
 
 	response := QueryResponse{
-		Response:  "API Gateway is working! (MCP integration pending)",
-		RequestID: generateRequestID(),
-		Timestamp: time.Now(),
+		Response:    answer.Context,
+		Answer:      answer.Answer,
+		AnswerError: answerError,
+		Sources:     answer.Sources,
+		TokenCount:  tokenizer.Default().Count(answer.Context),
+		RequestID:   requestID,
+		Timestamp:   time.Now(),
+	}
+	for _, res := range answer.Steps {
+		step := QueryStep{Tool: res.Tool, Status: "ok"}
+		switch {
+		case res.IsError:
+			step.Status, step.Error = "error", res.Text
+		case strings.TrimSpace(res.Text) == "":
+			step.Status = "empty"
+		}
+		response.Steps = append(response.Steps, step)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// Simple request ID generator
-func generateRequestID() string {
-	return fmt.Sprintf("req_%d", time.Now().UnixNano())
+// envInt reads a positive integer from the environment, falling back to def.
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// uploaderAuth has requests passed on to the uploader authenticate with the
+// UPLOADER_TOKEN the gateway shares with it, which then takes the
+// X-User-ID along as the uploader. That is the name of the caller's API
+// key, never what the client sent; keyless uploads are anonymous. The
+// caller's own key is the gateway's to check and is not passed on. The
+// token is resolved per request, so a rotated one applies right away.
+func uploaderAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("X-User-ID")
+		if name := keyNameFrom(r.Context()); name != "" {
+			r.Header.Set("X-User-ID", name)
+		}
+		if token := config.Secret("UPLOADER_TOKEN"); token != "" {
+			r.Header.Del("X-API-Key")
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mcpAuth vouches for the caller headers of requests passed on to the MCP
+// server with the MCP_SERVER_TOKEN it shares with the gateway. The role and
+// workspace headers are set by then; X-User-ID becomes the name of the
+// caller's API key, never what the client sent, and is dropped for keyless
+// callers.
+func mcpAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(clients.UserHeader)
+		if name := keyNameFrom(r.Context()); name != "" {
+			r.Header.Set(clients.UserHeader, name)
+		}
+		r.Header.Del(clients.TokenHeader)
+		clients.Vouch(r.Header)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// envDuration reads a Go duration (e.g. "10s") from the environment.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
 }
 
 func main() {
+	logging.Setup("api-gateway", "1.0.0")
+	// Fail at startup rather than on first use when the flags, the
+	// tokenizer vocabulary or the LLM provider are misconfigured
+	flags.Default()
+	tokenizer.Default()
+	// LLM calls are accounted, and held to budgets, in the MCP server
+	if client := llm.Default(); client != nil {
+		client.Ledger = mcpServer.Ledger()
+	}
+
 	// Initialize rate limiter
 	rateLimiter := NewRateLimiter()
 	defer rateLimiter.Close()
@@ -154,19 +388,94 @@ func main() {
 
 	// Health and metrics endpoints (no rate limiting)
 	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/ready", readyHandler)
+	mux.HandleFunc("/ready", readyHandler(rateLimiter))
 	mux.Handle("/metrics", promhttp.Handler())
 
 	// API endpoints with rate limiting
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("/api/v1/query", queryHandler)
-
-	// Apply rate limiting to API endpoints only
-	rateLimitedAPI := rateLimiter.Middleware(apiMux)
-	mux.Handle("/api/", rateLimitedAPI)
-
-	// Wrap with metrics middleware
-	handler := metricsMiddleware(mux)
+	// Reading only: calls are recorded by the services that make them
+	apiMux.Handle("/api/v1/usage", mcpAuth(clients.MCPServer.Proxy("/api/v1", http.MethodGet)))
+	learningAPI := mcpAuth(clients.MCPServer.Proxy("/api/v1", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete))
+	apiMux.Handle("/api/v1/recommendations", learningAPI)
+	apiMux.Handle("/api/v1/goals", learningAPI)
+	apiMux.Handle("/api/v1/goals/", learningAPI)
+	apiMux.Handle("/api/v1/collections", learningAPI)
+	apiMux.Handle("/api/v1/collections/", learningAPI)
+	apiMux.Handle("/api/v1/preferences", mcpAuth(clients.MCPServer.Proxy("/api/v1", http.MethodGet, http.MethodPut)))
+
+	// Read-only endpoints; their responses are cached in Redis for the
+	// CACHE_TTL_* of their route, when set
+	responseCache := NewResponseCache(rateLimiter.client)
+	apiMux.Handle("/api/v1/dashboard/", responseCache.Handler("dashboard", envDuration("CACHE_TTL_DASHBOARD", 0),
+		mcpAuth(clients.MCPServer.Proxy("/api/v1", http.MethodGet))))
+	contentAPI := mcpAuth(clients.MCPServer.Proxy("/api/v1", http.MethodGet))
+	cachedContent := responseCache.Handler("content", envDuration("CACHE_TTL_CONTENT", 0), contentAPI)
+	apiMux.Handle("/api/v1/content", cachedContent)
+	apiMux.Handle("/api/v1/content/", cachedContent)
+	// Views and reads, the feedback on searches, are never cached
+	apiMux.Handle("/api/v1/content/interactions", mcpAuth(clients.MCPServer.Proxy("/api/v1", http.MethodGet, http.MethodPost)))
+	apiMux.Handle("/api/v1/feedback", mcpAuth(clients.MCPServer.Proxy("/api/v1", http.MethodPost)))
+	apiMux.Handle("/api/v1/tags", responseCache.Handler("tags", envDuration("CACHE_TTL_TAGS", 0), contentAPI))
+	apiMux.Handle("/api/v1/upload/", uploaderAuth(clients.Uploader.Proxy("/api/v1", http.MethodPost)))
+	apiMux.Handle("/api/v1/uploads/", uploaderAuth(clients.Uploader.Proxy("/api/v1", http.MethodGet, http.MethodHead)))
+	apiMux.Handle("/api/v1/ingest/", uploaderAuth(clients.Uploader.Proxy("/api/v1", http.MethodPost)))
+
+	// Apply rate and concurrency limiting to API endpoints only
+	concurrencyLimiter := NewConcurrencyLimiter()
+	rateLimitedAPI := rateLimiter.Middleware(concurrencyLimiter.Middleware(apiMux))
+
+	// Resolve each caller's workspace from its API key before limiting, so
+	// limits apply per workspace; REQUIRE_API_KEY rejects keyless requests
+	apiKeys := NewAPIKeys(rateLimiter.client)
+	workspaces := NewWorkspaces(rateLimiter.client)
+	requireKey := os.Getenv("REQUIRE_API_KEY") == "true"
+	policy, err := rbac.FromEnv()
+	if err != nil {
+		logging.Fatal("failed to load RBAC policy", "error", err)
+	}
+	// Body size and time limits come first, before anything reads the body
+	routeLimits := routeLimitsFromEnv()
+	mux.Handle("/api/", routeLimits.Middleware(workspaceMiddleware(apiKeys, workspaces, requireKey, rbacMiddleware(policy, rateLimitedAPI))))
+
+	// Shared collections are read by token, without an API key
+	mux.Handle("/shared/collections/", rateLimiter.Middleware(clients.MCPServer.Proxy("", http.MethodGet)))
+
+	// Admin endpoints (require ADMIN_API_KEY)
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/admin/rate-limit/allowlist", rateLimitListHandler(rateLimiter, "allowlist"))
+	adminMux.HandleFunc("/admin/rate-limit/denylist", rateLimitListHandler(rateLimiter, "denylist"))
+	adminMux.HandleFunc("/admin/rate-limit/reset", rateLimitResetHandler(rateLimiter))
+	adminMux.HandleFunc("/admin/api-keys", apiKeysHandler(apiKeys, workspaces))
+	adminMux.HandleFunc("/admin/workspaces", workspacesHandler(workspaces))
+	// Deleting everything a user left, in every workspace, across the
+	// services and Redis
+	adminMux.HandleFunc("/admin/users/", userDataHandler(rateLimiter, systemSources{
+		MCPServer: clients.MCPServer.URL(),
+		Uploader:  clients.Uploader.URL(),
+	}))
+	adminMux.HandleFunc("/admin/system", systemHandler(rateLimiter, systemSources{
+		MCPServer: clients.MCPServer.URL(),
+		Collector: clients.Collector.URL(),
+		Uploader:  clients.Uploader.URL(),
+	}))
+	// Bulk tag changes run where the content lives; X-Workspace-ID picks the
+	// workspace
+	adminMux.Handle("/admin/tags/", clients.MCPServer.Proxy("", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete))
+	// and so do reindex jobs
+	adminMux.Handle("/admin/reindex", clients.MCPServer.Proxy("", http.MethodGet, http.MethodPost, http.MethodDelete))
+	adminMux.Handle("/admin/reindex/", clients.MCPServer.Proxy("", http.MethodPost))
+	// Search experiment results
+	adminMux.Handle("/admin/experiments", clients.MCPServer.Proxy("", http.MethodGet))
+	// Scheduled jobs and their run history
+	adminMux.Handle("/admin/jobs", clients.Scheduler.Proxy("", http.MethodGet))
+	adminMux.Handle("/admin/jobs/", clients.Scheduler.Proxy("", http.MethodGet, http.MethodPost))
+	mux.Handle("/admin/", routeLimits.Middleware(adminauth.Middleware(adminMux)))
+
+	// Wrap with metrics middleware, labelled by the innermost route, adding
+	// HSTS when served over HTTPS and a request ID for log correlation
+	tlsConfig := tlsserve.FromEnv()
+	handler := logging.Middleware(tlsConfig.HSTS(metricsMiddleware(mux, apiMux, adminMux, mux)))
 
 	// Setup server
 	port := os.Getenv("PORT")
@@ -188,21 +497,21 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("API Gateway starting on port %s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+		slog.Info("API Gateway starting", "port", port, "scheme", tlsConfig.Scheme())
+		if err := tlsserve.ListenAndServe(server, tlsConfig); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("server failed to start", "error", err)
 		}
 	}()
 
 	<-stop
-	log.Println("Shutting down API Gateway...")
+	slog.Info("shutting down API Gateway")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logging.Fatal("server forced to shutdown", "error", err)
 	}
 
-	log.Println("API Gateway stopped")
+	slog.Info("API Gateway stopped")
 }
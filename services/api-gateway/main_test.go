@@ -2,10 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"selin/internal/config"
+	"selin/internal/llm"
+	"selin/internal/query"
 )
 
 func TestHealthHandler(t *testing.T) {
@@ -39,7 +45,7 @@ func TestReadyHandler(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(readyHandler)
+	handler := readyHandler(nil)
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusOK {
@@ -57,6 +63,15 @@ func TestReadyHandler(t *testing.T) {
 }
 
 func TestQueryHandler(t *testing.T) {
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "Found 1 results"}},
+		})
+	}))
+	defer mcp.Close()
+	defer func(p *query.Pipeline) { queryPipeline = p }(queryPipeline)
+	queryPipeline = query.New(mcp.URL)
+
 	reqBody := QueryRequest{
 		Prompt: "Hello, world!",
 		UserID: "test_user",
@@ -82,8 +97,110 @@ func TestQueryHandler(t *testing.T) {
 		t.Errorf("failed to decode response: %v", err)
 	}
 
-	if response.Response == "" {
-		t.Error("expected non-empty response")
+	if !strings.Contains(response.Response, "## search_content\n\nFound 1 results") {
+		t.Errorf("expected the assembled context, got %q", response.Response)
+	}
+}
+
+func TestQueryHandlerAnswers(t *testing.T) {
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&call)
+		if call.Name != "search_content" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"content": []map[string]string{{"type": "text", "text": "down"}}, "isError": true})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "1. IBC\n   • URL: https://a.example/ibc"}},
+		})
+	}))
+	defer mcp.Close()
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": "IBC connects chains [1]."}}},
+		})
+	}))
+	defer model.Close()
+	defer func(p *query.Pipeline) { queryPipeline = p }(queryPipeline)
+	queryPipeline = query.New(mcp.URL)
+	queryPipeline.LLM = llm.New(&llm.OpenAI{URL: model.URL, HTTP: http.DefaultClient})
+
+	for _, tt := range []struct {
+		body, answer string
+	}{
+		{`{"prompt": "what is ibc"}`, "IBC connects chains [1]."},
+		{`{"prompt": "what is ibc", "context_only": true}`, ""},
+	} {
+		rr := httptest.NewRecorder()
+		queryHandler(rr, httptest.NewRequest("POST", "/api/v1/query", strings.NewReader(tt.body)))
+		var response QueryResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if response.Answer != tt.answer {
+			t.Errorf("%s: expected answer %q, got %q", tt.body, tt.answer, response.Answer)
+		}
+		if len(response.Sources) != 1 || response.Sources[0].URL != "https://a.example/ibc" {
+			t.Errorf("expected the cited source, got %+v", response.Sources)
+		}
+		if len(response.Steps) != 2 || response.Steps[0].Status != "ok" || response.Steps[1].Status != "error" {
+			t.Errorf("expected each step's status, got %+v", response.Steps)
+		}
+	}
+}
+
+// spentLedger refuses every LLM call.
+type spentLedger struct{}
+
+func (spentLedger) Allow(_ context.Context, a llm.Account) error {
+	return &llm.BudgetError{Scope: "user", Name: a.UserID, Limit: 1, Spent: 1}
+}
+
+func (spentLedger) Record(context.Context, llm.Entry) error { return nil }
+
+func TestQueryHandlerOverBudget(t *testing.T) {
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "Found 1 results"}},
+		})
+	}))
+	defer mcp.Close()
+	defer func(p *query.Pipeline) { queryPipeline = p }(queryPipeline)
+	queryPipeline = query.New(mcp.URL)
+	queryPipeline.LLM = llm.New(&llm.OpenAI{URL: "http://127.0.0.1:1", HTTP: http.DefaultClient})
+	queryPipeline.LLM.Ledger = spentLedger{}
+
+	req := httptest.NewRequest("POST", "/api/v1/query", strings.NewReader(`{"prompt": "golang"}`))
+	req.Header.Set("X-User-ID", "alice")
+	rr := httptest.NewRecorder()
+	queryHandler(rr, req)
+
+	var response QueryResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if rr.Code != http.StatusOK || response.Response == "" || response.Answer != "" {
+		t.Errorf("Expected the context without an answer, got %d %+v", rr.Code, response)
+	}
+	if !strings.Contains(response.AnswerError, "budget") {
+		t.Errorf("Expected the spent budget reported, got %q", response.AnswerError)
+	}
+}
+
+func TestQueryHandlerWithoutContext(t *testing.T) {
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer mcp.Close()
+	defer func(p *query.Pipeline) { queryPipeline = p }(queryPipeline)
+	queryPipeline = query.New(mcp.URL)
+
+	req := httptest.NewRequest("POST", "/api/v1/query", strings.NewReader(`{"prompt": "golang"}`))
+	rr := httptest.NewRecorder()
+	queryHandler(rr, req)
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 when the MCP server is down, got %d", rr.Code)
 	}
 }
 
@@ -123,3 +240,114 @@ func TestQueryHandlerEmptyPrompt(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
 	}
 }
+
+func TestReadyHandlerReportsDependencies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	t.Setenv("MCP_SERVER_URL", upstream.URL)
+
+	rr := httptest.NewRecorder()
+	readyHandler(nil).ServeHTTP(rr, httptest.NewRequest("GET", "/ready", nil))
+
+	// The MCP server is optional, so the gateway stays ready
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+	var response HealthResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if check := response.Checks["mcp-server"]; check.Status != "down" || !check.Optional {
+		t.Errorf("expected an optional, down mcp-server check, got %+v", check)
+	}
+}
+
+func TestUploaderAuth(t *testing.T) {
+	var got http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r.Header.Clone() })
+
+	t.Setenv("UPLOADER_TOKEN", "shared")
+	config.Secrets().Reload()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/file", nil)
+	req = req.WithContext(context.WithValue(req.Context(), keyNameContextKey{}, "alice-laptop"))
+	req.Header.Set("X-API-Key", "selin_caller")
+	req.Header.Set("X-User-ID", "bob")
+	uploaderAuth(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get("Authorization") != "Bearer shared" || got.Get("X-API-Key") != "" {
+		t.Errorf("Expected the shared token instead of the caller's key, got %v", got)
+	}
+	if got.Get("X-User-ID") != "alice-laptop" {
+		t.Errorf("Expected the key's name as the user, got %q", got.Get("X-User-ID"))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/upload/file", nil)
+	req.Header.Set("X-User-ID", "bob")
+	uploaderAuth(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get("X-User-ID") != "" {
+		t.Errorf("Expected a keyless upload to be anonymous, got %q", got.Get("X-User-ID"))
+	}
+
+	t.Setenv("UPLOADER_TOKEN", "")
+	config.Secrets().Reload()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/upload/file", nil)
+	req.Header.Set("X-API-Key", "selin_caller")
+	uploaderAuth(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get("X-API-Key") != "selin_caller" || got.Get("Authorization") != "" {
+		t.Errorf("Expected the caller's key passed on without a token, got %v", got)
+	}
+}
+
+func TestMCPAuth(t *testing.T) {
+	var got http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r.Header.Clone() })
+
+	t.Setenv("MCP_SERVER_TOKEN", "shared")
+	config.Secrets().Reload()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/preferences", nil)
+	req = req.WithContext(context.WithValue(req.Context(), keyNameContextKey{}, "alice-laptop"))
+	req.Header.Set("X-User-ID", "bob")
+	req.Header.Set("X-Service-Token", "guess")
+	mcpAuth(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get("X-Service-Token") != "shared" {
+		t.Errorf("Expected the shared token, got %q", got.Get("X-Service-Token"))
+	}
+	if got.Get("X-User-ID") != "alice-laptop" {
+		t.Errorf("Expected the key's name as the user, got %q", got.Get("X-User-ID"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/preferences", nil)
+	req.Header.Set("X-User-ID", "bob")
+	mcpAuth(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get("X-User-ID") != "" {
+		t.Errorf("Expected a keyless caller to have no user, got %q", got.Get("X-User-ID"))
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	apiMux := http.NewServeMux()
+	apiMux.Handle("/api/v1/content", ok)
+	apiMux.Handle("/api/v1/content/", ok)
+	mux := http.NewServeMux()
+	mux.Handle("/health", ok)
+	mux.Handle("/api/", apiMux)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/content", "/api/v1/content"},
+		{"/api/v1/content/5f0c7d1e", "/api/v1/content/"},
+		{"/api/v1/content/9b2a44c0", "/api/v1/content/"},
+		{"/api/v2/anything", "/api/"},
+		{"/health", "/health"},
+		{"/wp-login.php", "unmatched"},
+	}
+	for _, tt := range tests {
+		if got := routePattern(httptest.NewRequest("GET", tt.path, nil), []*http.ServeMux{apiMux, mux}); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.path, tt.want, got)
+		}
+	}
+}
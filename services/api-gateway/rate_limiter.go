@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+
+	"selin/internal/config"
+	"selin/internal/ratelimit"
 )
 
+// RateLimiter limits API requests per identity with the shared limiter,
+// allowing RATE_LIMIT requests per minute unless the caller's workspace
+// sets its own limit.
 type RateLimiter struct {
-	client *redis.Client
-	limit  int
-	window time.Duration
+	*ratelimit.Limiter
+	client  *redis.Client
+	proxies *trustedProxies
 }
 
 func NewRateLimiter() *RateLimiter {
@@ -30,75 +36,45 @@ func NewRateLimiter() *RateLimiter {
 		}
 	}
 
-	window := time.Minute // 1 minute window
-
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisURL,
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       0,
-	})
+	client := config.RedisClient(redisURL)
 
+	limiter := ratelimit.New(client, limit, time.Minute, ratelimit.FallbackFromEnv())
+	limiter.OnDegrade = func(degraded bool) {
+		if degraded {
+			rateLimiterDegraded.Set(1)
+		} else {
+			rateLimiterDegraded.Set(0)
+		}
+	}
 	return &RateLimiter{
-		client: client,
-		limit:  limit,
-		window: window,
+		Limiter: limiter,
+		client:  client,
+		proxies: parseTrustedProxies(os.Getenv("TRUSTED_PROXIES")),
 	}
 }
 
+// IsAllowed checks a request by userID against its window, at the limit of
+// the request's workspace.
 func (rl *RateLimiter) IsAllowed(ctx context.Context, userID string) (bool, error) {
 	if userID == "" {
 		userID = "anonymous"
 	}
-
-	key := fmt.Sprintf("rate_limit:%s", userID)
-
-	// Use sliding window with Redis
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
-
-	pipe := rl.client.Pipeline()
-
-	// Remove old entries outside the window
-	pipe.ZRemRangeByScore(ctx, key, "0", fmt.Sprintf("%.0f", float64(windowStart.UnixNano())))
-
-	// Count current requests in window
-	countCmd := pipe.ZCard(ctx, key)
-
-	// Add current request
-	pipe.ZAdd(ctx, key, &redis.Z{
-		Score:  float64(now.UnixNano()),
-		Member: fmt.Sprintf("%d", now.UnixNano()),
-	})
-
-	// Set expiration for the key
-	pipe.Expire(ctx, key, rl.window)
-
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return false, fmt.Errorf("rate limit check failed: %w", err)
-	}
-
-	count := countCmd.Val()
-	return count < int64(rl.limit), nil
-}
-
-func (rl *RateLimiter) Close() error {
-	return rl.client.Close()
+	return rl.Allow(ctx, userID, userID, workspaceFrom(ctx).RateLimit)
 }
 
 // Middleware for rate limiting
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract user ID from header or context
-		userID := r.Header.Get("X-User-ID")
-		if userID == "" {
-			// For now, use IP as identifier for anonymous users
-			userID = r.RemoteAddr
-		}
+		userID := workspaceFrom(r.Context()).identity(rl.proxies.identity(r))
 
 		allowed, err := rl.IsAllowed(r.Context(), userID)
+		if errors.Is(err, ratelimit.ErrBlocked) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 		if err != nil {
-			http.Error(w, "Rate limit check failed", http.StatusInternalServerError)
+			w.Header().Set("Retry-After", strconv.Itoa(int(ratelimit.RetryInterval.Seconds())))
+			http.Error(w, "Rate limiting unavailable", http.StatusServiceUnavailable)
 			return
 		}
 
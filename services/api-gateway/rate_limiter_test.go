@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"selin/internal/adminauth"
+	"selin/internal/config"
+	"selin/internal/ratelimit"
+)
+
+// newMiniredisLimiter returns a limiter backed by an in-memory Redis.
+func newMiniredisLimiter(t *testing.T, limit string) (*RateLimiter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	t.Setenv("REDIS_URL", mr.Addr())
+	t.Setenv("RATE_LIMIT", limit)
+	rl := NewRateLimiter()
+	t.Cleanup(func() { rl.Close() })
+	return rl, mr
+}
+
+// newUnreachableLimiter returns a limiter pointed at a port nothing listens on.
+func newUnreachableLimiter(t *testing.T, fallback string, limit string) *RateLimiter {
+	t.Setenv("REDIS_URL", "127.0.0.1:1")
+	t.Setenv("RATE_LIMIT", limit)
+	t.Setenv("RATE_LIMIT_FALLBACK", fallback)
+	rl := NewRateLimiter()
+	t.Cleanup(func() { rl.Close() })
+	return rl
+}
+
+func TestIsAllowedFallsBackToLocal(t *testing.T) {
+	rl := newUnreachableLimiter(t, ratelimit.FallbackLocal, "2")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, err := rl.IsAllowed(ctx, "user")
+		if err != nil || !allowed {
+			t.Fatalf("request %d: got allowed=%v err=%v", i+1, allowed, err)
+		}
+	}
+	allowed, err := rl.IsAllowed(ctx, "user")
+	if err != nil || allowed {
+		t.Errorf("third request: got allowed=%v err=%v, want denied", allowed, err)
+	}
+
+	if mode := rl.Mode(); mode != "degraded:local" {
+		t.Errorf("expected degraded:local mode, got %s", mode)
+	}
+}
+
+func TestIsAllowedFailOpen(t *testing.T) {
+	rl := newUnreachableLimiter(t, ratelimit.FallbackOpen, "1")
+
+	for i := 0; i < 5; i++ {
+		allowed, err := rl.IsAllowed(context.Background(), "user")
+		if err != nil || !allowed {
+			t.Fatalf("fail-open should allow everything, got allowed=%v err=%v", allowed, err)
+		}
+	}
+}
+
+func TestMiddlewareFailClosed(t *testing.T) {
+	rl := newUnreachableLimiter(t, ratelimit.FallbackClosed, "10")
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/query", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+}
+
+func TestReadyHandlerReportsDegradedLimiter(t *testing.T) {
+	rl := newUnreachableLimiter(t, ratelimit.FallbackLocal, "10")
+	rl.IsAllowed(context.Background(), "user")
+
+	rr := httptest.NewRecorder()
+	readyHandler(rl).ServeHTTP(rr, httptest.NewRequest("GET", "/ready", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("degraded limiter should not fail readiness, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"rate_limiting":"degraded:local"`) {
+		t.Errorf("expected degraded mode in body, got %s", rr.Body.String())
+	}
+}
+
+func TestIsAllowedConcurrentRequestsNeverExceedLimit(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "10")
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := rl.IsAllowed(context.Background(), "burst")
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if ok {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("expected exactly 10 allowed requests, got %d", allowed)
+	}
+	if mode := rl.Mode(); mode != "redis" {
+		t.Errorf("expected redis mode, got %s", mode)
+	}
+}
+
+func TestIsAllowedDeniedRequestsDoNotConsumeQuota(t *testing.T) {
+	rl, mr := newMiniredisLimiter(t, "2")
+	ctx := context.Background()
+
+	for i := 0; i < 7; i++ {
+		rl.IsAllowed(ctx, "user")
+	}
+
+	members, err := mr.ZMembers("rate_limit:user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Errorf("expected only the 2 allowed requests to be recorded, got %d", len(members))
+	}
+}
+
+func TestAllowlistBypassesLimit(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "1")
+	ctx := context.Background()
+
+	if err := rl.AddToList(ctx, "allowlist", "service-account"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		allowed, err := rl.IsAllowed(ctx, "service-account")
+		if err != nil || !allowed {
+			t.Fatalf("allowlisted identity should always pass, got allowed=%v err=%v", allowed, err)
+		}
+	}
+}
+
+func TestDenylistBlocksIdentity(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "10")
+	ctx := context.Background()
+
+	if err := rl.AddToList(ctx, "denylist", "abuser"); err != nil {
+		t.Fatal(err)
+	}
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	}))
+
+	req := httptest.NewRequest("GET", "/api/v1/query", nil)
+	req = req.WithContext(context.WithValue(req.Context(), keyNameContextKey{}, "abuser"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for denylisted identity, got %d", rr.Code)
+	}
+	if rl.Mode() != "redis" {
+		t.Errorf("a denylist hit should not degrade the limiter, got %s", rl.Mode())
+	}
+
+	if err := rl.RemoveFromList(ctx, "denylist", "abuser"); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, err := rl.IsAllowed(ctx, "abuser"); err != nil || !allowed {
+		t.Errorf("removed identity should be allowed again, got allowed=%v err=%v", allowed, err)
+	}
+}
+
+func TestResetClearsWindow(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "1")
+	ctx := context.Background()
+
+	rl.IsAllowed(ctx, "user")
+	if allowed, _ := rl.IsAllowed(ctx, "user"); allowed {
+		t.Fatal("second request should be limited")
+	}
+	if err := rl.Reset(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _ := rl.IsAllowed(ctx, "user"); !allowed {
+		t.Error("request after reset should be allowed")
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "10")
+	t.Setenv("ADMIN_API_KEY", "secret")
+	config.Secrets().Reload()
+	handler := adminauth.Middleware(rateLimitListHandler(rl, "denylist"))
+
+	body := strings.NewReader(`{"identity":"abuser"}`)
+	req := httptest.NewRequest("POST", "/admin/rate-limit/denylist", body)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without key, got %d", rr.Code)
+	}
+
+	body = strings.NewReader(`{"identity":"abuser"}`)
+	req = httptest.NewRequest("POST", "/admin/rate-limit/denylist", body)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 with key, got %d", rr.Code)
+	}
+
+	entries, _ := rl.ListEntries(context.Background(), "denylist")
+	if len(entries) != 1 || entries[0] != "abuser" {
+		t.Errorf("expected abuser in denylist, got %v", entries)
+	}
+}
+
+func TestAdminAuthDisabledWithoutKey(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "")
+	config.Secrets().Reload()
+	handler := adminauth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/rate-limit/allowlist", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 when admin API is disabled, got %d", rr.Code)
+	}
+}
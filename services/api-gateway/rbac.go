@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"selin/internal/rbac"
+)
+
+type roleContextKey struct{}
+
+// rbacMiddleware rejects requests whose role is below what the policy
+// requires for the route. The role comes from the caller's API key, or the
+// policy's default role for keyless requests, and is forwarded upstream in
+// the role header, replacing anything the client sent.
+func rbacMiddleware(policy *rbac.Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := roleFrom(r.Context(), policy)
+		if need := policy.RouteRole(r.Method, r.URL.Path); !role.Includes(need) {
+			http.Error(w, fmt.Sprintf("Requires the %s role", need), http.StatusForbidden)
+			return
+		}
+		r.Header.Set(rbac.Header, string(role))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func roleFrom(ctx context.Context, policy *rbac.Policy) rbac.Role {
+	if role, ok := ctx.Value(roleContextKey{}).(rbac.Role); ok {
+		return role
+	}
+	return policy.DefaultRole
+}
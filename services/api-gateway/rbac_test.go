@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/rbac"
+)
+
+func TestRBACMiddleware(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "10")
+	ctx := context.Background()
+	keys := NewAPIKeys(rl.client)
+	readerKey, _ := keys.Create(ctx, "reader", defaultWorkspace, rbac.Reader)
+	editorKey, _ := keys.Create(ctx, "editor", defaultWorkspace, rbac.Editor)
+
+	var forwarded string
+	handler := workspaceMiddleware(keys, NewWorkspaces(rl.client), false,
+		rbacMiddleware(rbac.DefaultPolicy(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r.Header.Get(rbac.Header)
+		})))
+
+	tests := []struct {
+		name, method, path, key string
+		want                    int
+		role                    rbac.Role
+	}{
+		{"reader reads goals", "GET", "/api/v1/goals", readerKey, http.StatusOK, rbac.Reader},
+		{"reader cannot write goals", "POST", "/api/v1/goals", readerKey, http.StatusForbidden, ""},
+		{"editor writes goals", "DELETE", "/api/v1/goals/1", editorKey, http.StatusOK, rbac.Editor},
+		{"keyless gets default role", "POST", "/api/v1/goals", "", http.StatusOK, rbac.Editor},
+		{"unlisted route needs admin", "GET", "/api/v1/internal", editorKey, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		forwarded = ""
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set(rbac.Header, string(rbac.Admin))
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want || forwarded != string(tt.role) {
+			t.Errorf("%s: expected %d with role %q, got %d with %q", tt.name, tt.want, tt.role, rr.Code, forwarded)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/clients"
+	"selin/internal/errlog"
+)
+
+// systemSources are the service base URLs /admin/system reports on.
+type systemSources struct {
+	MCPServer string
+	Collector string
+	Uploader  string
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type ContentReport struct {
+	Total            int            `json:"total"`
+	ByPlatform       map[string]int `json:"by_platform"`
+	ByWorkspace      map[string]int `json:"by_workspace"`
+	TopTags          []TagCount     `json:"top_tags"`
+	EmbeddingBacklog int            `json:"embedding_backlog"`
+}
+
+type StorageReport struct {
+	PostgresBytes int64            `json:"postgres_bytes"`
+	TableBytes    map[string]int64 `json:"table_bytes,omitempty"`
+	RedisBytes    int64            `json:"redis_bytes"`
+	Uploads       json.RawMessage  `json:"uploads,omitempty"`
+}
+
+// QueueReport covers the work waiting in Redis: messages held for offline
+// WebSocket clients.
+type QueueReport struct {
+	OfflineUsers    int   `json:"ws_offline_users"`
+	OfflineMessages int64 `json:"ws_offline_messages"`
+}
+
+type ServiceError struct {
+	Service string    `json:"service"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// SystemReport is the /admin/system response. Sections whose service could
+// not be reached are left empty and explained in Unavailable.
+type SystemReport struct {
+	GeneratedAt  time.Time                  `json:"generated_at"`
+	Content      *ContentReport             `json:"content,omitempty"`
+	Storage      StorageReport              `json:"storage"`
+	Collectors   map[string]json.RawMessage `json:"collectors"`
+	Queues       *QueueReport               `json:"queues,omitempty"`
+	RecentErrors []ServiceError             `json:"recent_errors"`
+	Unavailable  map[string]string          `json:"unavailable,omitempty"`
+}
+
+// System report: GET /admin/system gathers content, storage, collector,
+// queue and error information from the services and Redis in one call.
+func systemHandler(rl *RateLimiter, sources systemSources) http.HandlerFunc {
+	mcpServer := clients.NewMCPServer(sources.MCPServer)
+	collector := clients.NewCollector(sources.Collector)
+	uploader := clients.NewUploader(sources.Uploader)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := &SystemReport{
+			GeneratedAt:  time.Now().UTC(),
+			Collectors:   map[string]json.RawMessage{},
+			RecentErrors: []ServiceError{},
+			Unavailable:  map[string]string{},
+		}
+		report.addErrors("api-gateway", errlog.Recent())
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		// The caller's admin bearer token is passed through
+		auth := r.Header.Get("Authorization")
+		fetch := func(service string, get func(ctx context.Context, auth string) (json.RawMessage, error), apply func(body []byte) error) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				body, err := get(r.Context(), auth)
+				if err == nil {
+					mu.Lock()
+					err = apply(body)
+					mu.Unlock()
+				}
+				if err != nil {
+					mu.Lock()
+					report.Unavailable[service] = err.Error()
+					mu.Unlock()
+				}
+			}()
+		}
+
+		fetch("mcp-server", mcpServer.Stats, report.applyStats)
+		fetch("reddit-collector", collector.Status, func(body []byte) error {
+			return report.applyServiceStatus("reddit-collector", body, func(raw json.RawMessage) {
+				report.Collectors["reddit"] = raw
+			})
+		})
+		fetch("file-uploader", uploader.Status, func(body []byte) error {
+			return report.applyServiceStatus("file-uploader", body, func(raw json.RawMessage) {
+				var status struct {
+					Uploads json.RawMessage `json:"uploads"`
+				}
+				if json.Unmarshal(raw, &status) == nil {
+					report.Storage.Uploads = status.Uploads
+				}
+			})
+		})
+		wg.Wait()
+
+		if queues, err := queueReport(r.Context(), rl.client); err != nil {
+			report.Unavailable["redis"] = err.Error()
+		} else {
+			report.Queues = queues
+			report.Storage.RedisBytes, _ = redisUsedMemory(r.Context(), rl.client)
+		}
+
+		sort.Slice(report.RecentErrors, func(i, j int) bool {
+			return report.RecentErrors[i].Time.After(report.RecentErrors[j].Time)
+		})
+		writeJSON(w, report)
+	}
+}
+
+func (report *SystemReport) addErrors(service string, entries []errlog.Entry) {
+	for _, e := range entries {
+		report.RecentErrors = append(report.RecentErrors, ServiceError{Service: service, Time: e.Time, Message: e.Message})
+	}
+}
+
+// applyStats fills in the content and database sections from the MCP
+// server's /admin/stats.
+func (report *SystemReport) applyStats(body []byte) error {
+	var stats struct {
+		TotalContent     int              `json:"total_content"`
+		ByPlatform       map[string]int   `json:"by_platform"`
+		ByWorkspace      map[string]int   `json:"by_workspace"`
+		TopTags          []TagCount       `json:"top_tags"`
+		EmbeddingBacklog int              `json:"embedding_backlog"`
+		DatabaseBytes    int64            `json:"database_bytes"`
+		TableBytes       map[string]int64 `json:"table_bytes"`
+		RecentErrors     []errlog.Entry   `json:"recent_errors"`
+	}
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	report.Content = &ContentReport{
+		Total:            stats.TotalContent,
+		ByPlatform:       stats.ByPlatform,
+		ByWorkspace:      stats.ByWorkspace,
+		TopTags:          stats.TopTags,
+		EmbeddingBacklog: stats.EmbeddingBacklog,
+	}
+	report.Storage.PostgresBytes = stats.DatabaseBytes
+	report.Storage.TableBytes = stats.TableBytes
+	report.addErrors("mcp-server", stats.RecentErrors)
+	return nil
+}
+
+// applyServiceStatus moves a /status response's recent errors into the
+// report and hands the rest to apply.
+func (report *SystemReport) applyServiceStatus(service string, body []byte, apply func(json.RawMessage)) error {
+	var status map[string]json.RawMessage
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	var entries []errlog.Entry
+	json.Unmarshal(status["recent_errors"], &entries)
+	report.addErrors(service, entries)
+	delete(status, "recent_errors")
+
+	rest, _ := json.Marshal(status)
+	apply(rest)
+	return nil
+}
+
+// outboxPattern matches the ws service's per-user offline message lists.
+const outboxPattern = "ws:outbox:*"
+
+func queueReport(ctx context.Context, client *redis.Client) (*QueueReport, error) {
+	queues := &QueueReport{}
+	iter := client.Scan(ctx, 0, outboxPattern, 100).Iterator()
+	for iter.Next(ctx) {
+		n, err := client.LLen(ctx, iter.Val()).Result()
+		if err != nil {
+			return nil, err
+		}
+		queues.OfflineUsers++
+		queues.OfflineMessages += n
+	}
+	return queues, iter.Err()
+}
+
+func redisUsedMemory(ctx context.Context, client *redis.Client) (int64, error) {
+	info, err := client.Info(ctx, "memory").Result()
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "used_memory:"); ok {
+			return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("used_memory not reported")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSystemHandler(t *testing.T) {
+	rl, mr := newMiniredisLimiter(t, "10")
+	mr.RPush("ws:outbox:alice", "a", "b")
+	mr.RPush("ws:outbox:bob", "c")
+
+	var gotAuth string
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"total_content": 3, "by_platform": {"reddit": 3}, "embedding_backlog": 2,
+			"database_bytes": 4096, "recent_errors": [{"time": "2026-01-02T00:00:00Z", "message": "query failed"}]}`))
+	}))
+	defer mcp.Close()
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"running": false, "posts_stored": 7, "recent_errors": [{"time": "2026-01-03T00:00:00Z", "message": "❌ Error collecting"}]}`))
+	}))
+	defer collector.Close()
+
+	handler := systemHandler(rl, systemSources{MCPServer: mcp.URL, Collector: collector.URL, Uploader: "http://127.0.0.1:1"})
+	req := httptest.NewRequest("GET", "/admin/system", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var report SystemReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	if gotAuth != "Bearer admin" {
+		t.Errorf("Expected admin token to be forwarded, got %q", gotAuth)
+	}
+	if report.Content == nil || report.Content.Total != 3 || report.Content.EmbeddingBacklog != 2 {
+		t.Errorf("Unexpected content section: %+v", report.Content)
+	}
+	if report.Queues == nil || report.Queues.OfflineUsers != 2 || report.Queues.OfflineMessages != 3 {
+		t.Errorf("Unexpected queue section: %+v", report.Queues)
+	}
+	var reddit map[string]interface{}
+	json.Unmarshal(report.Collectors["reddit"], &reddit)
+	if reddit["posts_stored"] != 7.0 || reddit["recent_errors"] != nil {
+		t.Errorf("Expected collector status without its errors, got %v", reddit)
+	}
+	if len(report.RecentErrors) != 2 || report.RecentErrors[0].Service != "reddit-collector" {
+		t.Errorf("Expected merged errors newest first, got %+v", report.RecentErrors)
+	}
+	if _, ok := report.Unavailable["file-uploader"]; !ok {
+		t.Errorf("Expected unreachable uploader to be reported, got %v", report.Unavailable)
+	}
+}
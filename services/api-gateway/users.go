@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/adminauth"
+	"selin/internal/clients"
+	"selin/internal/config"
+)
+
+// DeletionReport is the DELETE /admin/users/{id}/data response: what was
+// deleted from each store, and the stores that could not be purged.
+type DeletionReport struct {
+	UserID      string                     `json:"user_id"`
+	Deleted     map[string]json.RawMessage `json:"deleted"`
+	Failed      map[string]string          `json:"failed,omitempty"`
+	CompletedAt time.Time                  `json:"completed_at"`
+}
+
+// RedisDeletion is what deleting a user removed from Redis.
+type RedisDeletion struct {
+	// RateLimitKeys counts rate limit windows and allow/deny list entries
+	RateLimitKeys int `json:"rate_limit_keys"`
+	// QueueKeys counts the ws service's offline queue and sequence keys
+	QueueKeys int `json:"ws_queue_keys"`
+}
+
+// userDataHandler serves DELETE /admin/users/{id}/data: it deletes
+// everything the user left in Postgres (through the MCP server), their
+// uploads (through the uploader) and their Redis keys, and reports what
+// went. A user is deleted from every workspace at once, so this is an
+// ADMIN_API_KEY endpoint rather than one a workspace's admin key reaches.
+// Stores are purged independently; when any fails the report comes with
+// 502, and the request can be repeated.
+func userDataHandler(rl *RateLimiter, sources systemSources) http.HandlerFunc {
+	mcpServer := clients.NewMCPServer(sources.MCPServer)
+	uploader := clients.NewUploader(sources.Uploader)
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/data")
+		if !ok || userID == "" || strings.Contains(userID, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := &DeletionReport{
+			UserID:  userID,
+			Deleted: map[string]json.RawMessage{},
+			Failed:  map[string]string{},
+		}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		// The services' deletion endpoints take the same ADMIN_API_KEY the
+		// caller presented
+		auth := "Bearer " + config.Secret(adminauth.SecretName)
+		purge := func(store string, del func(ctx context.Context, auth, userID string) (json.RawMessage, error)) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				deleted, err := del(r.Context(), auth, userID)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					report.Failed[store] = err.Error()
+					return
+				}
+				report.Deleted[store] = deleted
+			}()
+		}
+		purge("postgres", mcpServer.DeleteUserData)
+		purge("uploads", uploader.DeleteUserUploads)
+		wg.Wait()
+
+		if deleted, err := deleteUserRedis(r.Context(), rl, userID); err != nil {
+			report.Failed["redis"] = err.Error()
+		} else {
+			report.Deleted["redis"], _ = json.Marshal(deleted)
+		}
+		report.CompletedAt = time.Now().UTC()
+
+		if len(report.Failed) > 0 {
+			slog.Error("user data deletion incomplete", "user_id", userID, "failed", report.Failed)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(report)
+			return
+		}
+		slog.Info("deleted user data", "user_id", userID)
+		writeJSON(w, report)
+	}
+}
+
+// deleteUserRedis deletes the user's rate limit state, in every workspace
+// and for every tool, and the messages the ws service holds for them.
+func deleteUserRedis(ctx context.Context, rl *RateLimiter, userID string) (RedisDeletion, error) {
+	var d RedisDeletion
+	n, err := rl.Forget(ctx, userID)
+	if err != nil {
+		return d, fmt.Errorf("failed to delete rate limit keys: %w", err)
+	}
+	d.RateLimitKeys = n
+	deleted, err := rl.client.Del(ctx, "ws:outbox:"+userID, "ws:seq:"+userID).Result()
+	if err != nil && err != redis.Nil {
+		return d, fmt.Errorf("failed to delete offline queue: %w", err)
+	}
+	d.QueueKeys = int(deleted)
+	return d, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/config"
+)
+
+func TestUserDataHandler(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admin")
+	config.Secrets().Reload()
+	rl, mr := newMiniredisLimiter(t, "10")
+	mr.RPush("ws:outbox:alice", "a")
+	mr.Set("ws:seq:alice", "3")
+	mr.RPush("ws:outbox:bob", "b")
+	for _, key := range []string{"alice", "acme:alice", "bob"} {
+		if _, err := rl.Allow(t.Context(), key, key, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var gotPath, gotAuth string
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.Method+" "+r.URL.Path, r.Header.Get("Authorization")
+		w.Write([]byte(`{"user_id": "alice", "deleted": {"query_history": 4}}`))
+	}))
+	defer mcp.Close()
+	uploader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Uploads are only recorded with Postgres storage", http.StatusNotImplemented)
+	}))
+	defer uploader.Close()
+
+	handler := userDataHandler(rl, systemSources{MCPServer: mcp.URL, Uploader: uploader.URL})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/admin/users/alice/data", nil))
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 with the uploader failing, got %d", rr.Code)
+	}
+	var report DeletionReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	if gotPath != "DELETE /admin/users/alice/data" || gotAuth != "Bearer admin" {
+		t.Errorf("Expected an admin DELETE of alice's data, got %q with %q", gotPath, gotAuth)
+	}
+	if string(report.Deleted["postgres"]) != `{"query_history":4}` {
+		t.Errorf("Expected the MCP server's counts, got %s", report.Deleted["postgres"])
+	}
+	if _, ok := report.Failed["uploads"]; !ok {
+		t.Errorf("Expected the uploader failure reported, got %v", report.Failed)
+	}
+	var redisDeleted RedisDeletion
+	json.Unmarshal(report.Deleted["redis"], &redisDeleted)
+	if redisDeleted.RateLimitKeys != 2 || redisDeleted.QueueKeys != 2 {
+		t.Errorf("Expected 2 rate limit and 2 queue keys deleted, got %+v", redisDeleted)
+	}
+	if mr.Exists("rate_limit:acme:alice") || mr.Exists("ws:outbox:alice") {
+		t.Error("Expected alice's Redis keys deleted")
+	}
+	if !mr.Exists("rate_limit:bob") || !mr.Exists("ws:outbox:bob") {
+		t.Error("Expected bob's Redis keys kept")
+	}
+	if report.CompletedAt.IsZero() {
+		t.Error("Expected a completion time")
+	}
+}
+
+func TestUserDataHandlerRoutes(t *testing.T) {
+	rl, _ := newMiniredisLimiter(t, "10")
+	handler := userDataHandler(rl, systemSources{MCPServer: "http://127.0.0.1:1", Uploader: "http://127.0.0.1:1"})
+	for path, want := range map[string]int{
+		"/admin/users/alice":          http.StatusNotFound,
+		"/admin/users//data":          http.StatusNotFound,
+		"/admin/users/alice/bob/data": http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("DELETE", path, nil))
+		if rr.Code != want {
+			t.Errorf("DELETE %s: expected %d, got %d", path, want, rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/users/alice/data", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rr.Code)
+	}
+}
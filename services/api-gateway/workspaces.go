@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/apikeys"
+	"selin/internal/logging"
+)
+
+// Workspaces partition one deployment between groups of users. The gateway
+// resolves each request's workspace from its API key and forwards it to the
+// services in X-Workspace-ID, replacing anything the client sent, so a
+// caller can only reach its own workspace's data. Requests without a key
+// use the default workspace.
+const (
+	workspacesKey    = apikeys.WorkspacesKey
+	defaultWorkspace = apikeys.DefaultWorkspace
+	workspaceHeader  = "X-Workspace-ID"
+)
+
+var (
+	workspacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+	errUnknownWorkspace = errors.New("unknown workspace")
+)
+
+type Workspace struct {
+	ID        string    `json:"id"`
+	RateLimit int       `json:"rate_limit,omitempty"` // requests per window; 0 uses RATE_LIMIT
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// identity scopes a rate limit identity to the workspace, leaving the
+// default workspace's identities (and allow/deny list entries) unchanged.
+func (w Workspace) identity(id string) string {
+	if w.ID == "" || w.ID == defaultWorkspace {
+		return id
+	}
+	return w.ID + ":" + id
+}
+
+type workspaceContextKey struct{}
+
+// keyNameContextKey holds the name of the API key a request came with.
+type keyNameContextKey struct{}
+
+// workspaceFrom returns the workspace resolved for the request.
+func workspaceFrom(ctx context.Context) Workspace {
+	if w, ok := ctx.Value(workspaceContextKey{}).(Workspace); ok {
+		return w
+	}
+	return Workspace{ID: defaultWorkspace}
+}
+
+// keyNameFrom returns the name of the request's API key, or "" without one.
+func keyNameFrom(ctx context.Context) string {
+	name, _ := ctx.Value(keyNameContextKey{}).(string)
+	return name
+}
+
+type Workspaces struct {
+	client *redis.Client
+}
+
+func NewWorkspaces(client *redis.Client) *Workspaces {
+	return &Workspaces{client: client}
+}
+
+func (ws *Workspaces) Save(ctx context.Context, w Workspace) error {
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now().UTC()
+	}
+	data, _ := json.Marshal(w)
+	return ws.client.HSet(ctx, workspacesKey, w.ID, data).Err()
+}
+
+// Get returns a workspace. The default workspace always exists.
+func (ws *Workspaces) Get(ctx context.Context, id string) (Workspace, error) {
+	data, err := ws.client.HGet(ctx, workspacesKey, id).Result()
+	if err == redis.Nil {
+		if id == defaultWorkspace {
+			return Workspace{ID: defaultWorkspace}, nil
+		}
+		return Workspace{}, errUnknownWorkspace
+	}
+	if err != nil {
+		return Workspace{}, err
+	}
+	var w Workspace
+	if err := json.Unmarshal([]byte(data), &w); err != nil {
+		return Workspace{}, err
+	}
+	return w, nil
+}
+
+func (ws *Workspaces) List(ctx context.Context) ([]Workspace, error) {
+	entries, err := ws.client.HGetAll(ctx, workspacesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := []Workspace{}
+	for _, data := range entries {
+		var w Workspace
+		if json.Unmarshal([]byte(data), &w) == nil {
+			list = append(list, w)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (ws *Workspaces) Delete(ctx context.Context, id string) (bool, error) {
+	n, err := ws.client.HDel(ctx, workspacesKey, id).Result()
+	return n > 0, err
+}
+
+// workspaceMiddleware resolves the caller's workspace and role from its API
+// key (X-API-Key or a bearer token). When requireKey is set, requests
+// without a valid key are rejected; otherwise keyless requests use the
+// default workspace and leave the role to the RBAC policy.
+func workspaceMiddleware(keys *APIKeys, workspaces *Workspaces, requireKey bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := apikeys.FromRequest(r)
+
+		ctx := r.Context()
+		workspaceID := defaultWorkspace
+		switch {
+		case key != "":
+			info, err := keys.Lookup(r.Context(), key)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to check API key", "error", err)
+				http.Error(w, "API key check unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if info == nil {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			workspaceID = info.Workspace
+			ctx = context.WithValue(ctx, roleContextKey{}, info.Role)
+			ctx = context.WithValue(ctx, keyNameContextKey{}, info.Name)
+		case requireKey:
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+
+		workspace, err := workspaces.Get(r.Context(), workspaceID)
+		if errors.Is(err, errUnknownWorkspace) {
+			http.Error(w, "Workspace no longer exists", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to load workspace", "workspace", workspaceID, "error", err)
+			http.Error(w, "Workspace lookup unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		r.Header.Set(workspaceHeader, workspace.ID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, workspaceContextKey{}, workspace)))
+	})
+}
+
+// Workspace management: GET lists workspaces, POST {"id": ..., "rate_limit":
+// ...} creates or updates one, DELETE ?id=... removes it. Keys issued for a
+// deleted workspace stop working.
+func workspacesHandler(workspaces *Workspaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			list, err := workspaces.List(r.Context())
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to list workspaces", "error", err)
+				http.Error(w, "Failed to list workspaces", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, map[string]interface{}{"workspaces": list})
+
+		case http.MethodPost:
+			var req Workspace
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !workspacePattern.MatchString(req.ID) {
+				http.Error(w, "A lowercase workspace id is required", http.StatusBadRequest)
+				return
+			}
+			if req.RateLimit < 0 {
+				http.Error(w, "rate_limit must not be negative", http.StatusBadRequest)
+				return
+			}
+			if existing, err := workspaces.Get(r.Context(), req.ID); err == nil {
+				req.CreatedAt = existing.CreatedAt
+			}
+			if err := workspaces.Save(r.Context(), req); err != nil {
+				logging.FromContext(r.Context()).Error("failed to save workspace", "workspace", req.ID, "error", err)
+				http.Error(w, "Failed to save workspace", http.StatusInternalServerError)
+				return
+			}
+			logging.FromContext(r.Context()).Info("saved workspace", "workspace", req.ID, "rate_limit", req.RateLimit)
+			writeJSON(w, req)
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" || id == defaultWorkspace {
+				http.Error(w, "A non-default workspace id is required", http.StatusBadRequest)
+				return
+			}
+			found, err := workspaces.Delete(r.Context(), id)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to delete workspace", "workspace", id, "error", err)
+				http.Error(w, "Failed to delete workspace", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Workspace not found", http.StatusNotFound)
+				return
+			}
+			logging.FromContext(r.Context()).Info("deleted workspace", "workspace", id)
+			writeJSON(w, map[string]interface{}{"deleted": id})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"selin/internal/adminauth"
+	"selin/internal/errlog"
+	"selin/internal/logging"
+)
+
+// UploadUsage is the disk space taken by stored uploads.
+type UploadUsage struct {
+	Files       int              `json:"files"`
+	Bytes       int64            `json:"bytes"`
+	ByWorkspace map[string]int64 `json:"bytes_by_workspace"`
+}
+
+func uploadUsage(dir string) (UploadUsage, error) {
+	usage := UploadUsage{ByWorkspace: map[string]int64{}}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		usage.Files++
+		usage.Bytes += info.Size()
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			usage.ByWorkspace[strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]] += info.Size()
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// statusHandler serves GET /status with upload storage and recent errors.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+
+	usage, err := uploadUsage("uploads")
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to measure uploads", "error", err)
+		http.Error(w, "Failed to measure uploads", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uploads":       usage,
+		"recent_errors": errlog.Recent(),
+	})
+}
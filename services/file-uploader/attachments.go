@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"selin/internal/blob"
+	"selin/internal/config"
+	"selin/internal/keyring"
+)
+
+// Attachments larger than this are recorded without being stored.
+const maxAttachmentSize = 100 << 20
+
+// attachment is a file attached to a message. Open is nil for files the
+// export only refers to, such as Slack files, which exports leave out.
+type attachment struct {
+	Name     string
+	MimeType string
+	Size     int64
+	URL      string
+	Open     func() (io.ReadCloser, error)
+}
+
+// media is the files that came with an export in a zip, by their path
+// relative to the export's JSON file. It is nil for plain JSON uploads.
+type media map[string]*zip.File
+
+// readExportZip finds the export JSON in a zip (name, if present, else the
+// first JSON file) and the media next to it.
+func readExportZip(filePath, name string) ([]byte, media, func() error, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var export *zip.File
+	for _, f := range archive.File {
+		if path.Ext(f.Name) != ".json" || f.FileInfo().IsDir() {
+			continue
+		}
+		if export == nil || (path.Base(f.Name) == name && path.Base(export.Name) != name) {
+			export = f
+		}
+	}
+	if export == nil {
+		archive.Close()
+		return nil, nil, nil, fmt.Errorf("no JSON export in the zip")
+	}
+	r, err := export.Open()
+	if err != nil {
+		archive.Close()
+		return nil, nil, nil, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		archive.Close()
+		return nil, nil, nil, err
+	}
+
+	prefix := ""
+	if dir := path.Dir(export.Name); dir != "." {
+		prefix = dir + "/"
+	}
+	files := media{}
+	for _, f := range archive.File {
+		if rel, ok := strings.CutPrefix(f.Name, prefix); ok {
+			files[rel] = f
+		}
+	}
+	return data, files, archive.Close, nil
+}
+
+// attach describes a file an export refers to by ref, either a URL or a
+// path relative to the export. Files found in m can be stored.
+func (m media) attach(ref, name, mimeType string, size int64) attachment {
+	// Telegram leaves a placeholder in place of media it did not export
+	if strings.HasPrefix(ref, "(") {
+		ref = ""
+	}
+	if name == "" && ref != "" {
+		name = path.Base(ref)
+	} else if name == "" {
+		name = "attachment"
+	}
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	}
+	a := attachment{Name: name, MimeType: mimeType, Size: size}
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		a.URL = ref
+	} else if f, ok := m[ref]; ok && f.UncompressedSize64 <= maxAttachmentSize {
+		a.Size = int64(f.UncompressedSize64)
+		a.Open = func() (io.ReadCloser, error) { return f.Open() }
+	}
+	return a
+}
+
+// ocrCommand runs OCR on image attachments when set: it is called with
+// the image's path and "stdout", as tesseract is, and prints the text.
+var ocrCommand = config.Env("OCR_COMMAND", "")
+
+func extractText(ctx context.Context, imagePath string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, ocrCommand, imagePath, "stdout").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// storeAttachments records a stored message's attachments, keeping the
+// files that came with the upload in blob storage. In workspaces with
+// encryption keys the files and the text OCR found in them are encrypted.
+func storeAttachments(ctx context.Context, db *sql.DB, blobs *blob.Store, workspace, contentID string, attachments []attachment) error {
+	for i, a := range attachments {
+		var blobKey, text string
+		if a.Open != nil {
+			var err error
+			if blobKey, a.Size, text, err = storeAttachmentFile(ctx, blobs, workspace, a); err != nil {
+				return fmt.Errorf("failed to store %s: %v", a.Name, err)
+			}
+			if text, err = keyring.Default().SealString(ctx, workspace, text); err != nil {
+				return err
+			}
+		}
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO content_attachments (
+				content_id, position, workspace_id, filename, mime_type, size_bytes, blob_key, source_url, extracted_text
+			) VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6::bigint, 0), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''))
+			ON CONFLICT (content_id, position) DO UPDATE SET
+				filename = EXCLUDED.filename,
+				mime_type = EXCLUDED.mime_type,
+				size_bytes = EXCLUDED.size_bytes,
+				blob_key = EXCLUDED.blob_key,
+				source_url = EXCLUDED.source_url,
+				extracted_text = EXCLUDED.extracted_text`,
+			contentID, i, workspace, a.Name, a.MimeType, a.Size, blobKey, a.URL, text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeAttachmentFile puts an attachment's file in blob storage and runs
+// OCR on images, returning the blob's key, the file's size and the text
+// found. Files are streamed to the store unless the workspace encrypts
+// them: sealing one takes it whole, and OCR then reads a plaintext copy
+// that is removed afterwards.
+func storeAttachmentFile(ctx context.Context, blobs *blob.Store, workspace string, a attachment) (key string, size int64, text string, err error) {
+	encrypted, err := keyring.Default().Enabled(ctx, workspace)
+	if err != nil {
+		return "", 0, "", err
+	}
+	r, err := a.Open()
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer r.Close()
+	ocr := ocrCommand != "" && strings.HasPrefix(a.MimeType, "image/")
+
+	var imagePath string
+	if !encrypted {
+		if key, size, err = blobs.Put(r); err != nil {
+			return "", 0, "", err
+		}
+		imagePath, _ = blobs.Path(key)
+	} else {
+		data, err := io.ReadAll(io.LimitReader(r, maxAttachmentSize))
+		if err != nil {
+			return "", 0, "", err
+		}
+		sealed, err := keyring.Default().Seal(ctx, workspace, data)
+		if err != nil {
+			return "", 0, "", err
+		}
+		if key, _, err = blobs.Put(bytes.NewReader(sealed)); err != nil {
+			return "", 0, "", err
+		}
+		size = int64(len(data))
+		if ocr {
+			tmp, err := os.CreateTemp("", "ocr-*"+path.Ext(a.Name))
+			if err != nil {
+				return "", 0, "", err
+			}
+			defer os.Remove(tmp.Name())
+			_, err = tmp.Write(data)
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return "", 0, "", err
+			}
+			imagePath = tmp.Name()
+		}
+	}
+	if ocr {
+		if text, err = extractText(ctx, imagePath); err != nil {
+			slog.Warn("OCR failed", "attachment", a.Name, "error", err)
+		}
+	}
+	return key, size, text, nil
+}
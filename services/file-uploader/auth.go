@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/config"
+	"selin/internal/logging"
+)
+
+// Uploads are authenticated once UPLOAD_API_KEYS or UPLOADER_TOKEN is set.
+// UPLOAD_API_KEYS gives each user a key ("alice:key1,bob:key2"), sent as
+// X-API-Key or a bearer token; the upload is attributed to the key's user,
+// whatever X-User-ID says. UPLOADER_TOKEN is shared with internal services
+// such as the gateway, which upload on behalf of the X-User-ID they send;
+// the gateway sends the name of the caller's API key, never the caller's
+// own X-User-ID. Without either, anyone who can reach the service may
+// upload.
+
+// uploadCaller returns the user a request uploads as and whether its key
+// was accepted.
+func uploadCaller(r *http.Request) (string, bool) {
+	keys := config.Secret("UPLOAD_API_KEYS")
+	token := config.Secret("UPLOADER_TOKEN")
+	if keys == "" && token == "" {
+		return r.Header.Get("X-User-ID"), true
+	}
+	given := r.Header.Get("X-API-Key")
+	if given == "" {
+		given = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if given == "" {
+		return "", false
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+		return r.Header.Get("X-User-ID"), true
+	}
+	for _, entry := range strings.Split(keys, ",") {
+		user, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if ok && user != "" && key != "" && subtle.ConstantTimeCompare([]byte(given), []byte(key)) == 1 {
+			return user, true
+		}
+	}
+	return "", false
+}
+
+// uploadQuota is how much one user may upload per day (UTC), from
+// UPLOAD_DAILY_QUOTA_MB and UPLOAD_DAILY_QUOTA_ITEMS. Zero is no limit.
+// Usage is counted from the uploads recorded in Postgres, so quotas need
+// Postgres storage.
+type uploadQuota struct {
+	Bytes int64
+	Items int
+}
+
+func uploadQuotaFromEnv() (uploadQuota, error) {
+	mb, err := strconv.ParseInt(config.Env("UPLOAD_DAILY_QUOTA_MB", "0"), 10, 64)
+	if err != nil || mb < 0 {
+		return uploadQuota{}, fmt.Errorf("invalid UPLOAD_DAILY_QUOTA_MB")
+	}
+	items, err := strconv.Atoi(config.Env("UPLOAD_DAILY_QUOTA_ITEMS", "0"))
+	if err != nil || items < 0 {
+		return uploadQuota{}, fmt.Errorf("invalid UPLOAD_DAILY_QUOTA_ITEMS")
+	}
+	return uploadQuota{Bytes: mb << 20, Items: items}, nil
+}
+
+// QuotaUsage is what a user uploaded today.
+type QuotaUsage struct {
+	UserID string `json:"user_id"`
+	Bytes  int64  `json:"bytes"`
+	Items  int    `json:"items"`
+	// Resets is when the day's usage starts over
+	Resets time.Time `json:"resets"`
+}
+
+// quotaUsage adds up the uploads recorded for userID since midnight UTC.
+// Uploads without a user share the anonymous quota.
+func quotaUsage(ctx context.Context, userID string) (QuotaUsage, error) {
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	usage := QuotaUsage{UserID: userID, Resets: day.Add(24 * time.Hour)}
+	db, ok := openPostgres()
+	if !ok {
+		return usage, nil
+	}
+	defer db.Close()
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(size_bytes), 0), COALESCE(SUM(items), 0)
+		FROM uploads WHERE COALESCE(user_id, '') = $1 AND created_at >= $2`, userID, day).
+		Scan(&usage.Bytes, &usage.Items)
+	return usage, err
+}
+
+// Uploads in progress are not in the uploads table yet, so each reserves
+// the bytes it may read in Redis until its handler is done: its
+// Content-Length, or all that is left of the day's quota when it has none.
+// Reservations expire after UPLOAD_LOCK_TTL should their upload die.
+// Without Redis only recorded uploads count.
+
+// reserveScript reserves up to ARGV[1] bytes, what the recorded uploads
+// leave of the quota, less those already reserved: ARGV[2] of them, or all
+// that are left when ARGV[2] is negative. It returns the bytes reserved, 0
+// when they do not fit.
+var reserveScript = redis.NewScript(`
+local left = tonumber(ARGV[1]) - tonumber(redis.call("GET", KEYS[1]) or "0")
+local want = tonumber(ARGV[2])
+if want < 0 then want = left end
+if want <= 0 or want > left then return 0 end
+redis.call("INCRBY", KEYS[1], want)
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return want
+`)
+
+func quotaReservationKey(userID string, day time.Time) string {
+	return "file-uploader:quota-reserved:" + userID + ":" + day.Format("2006-01-02")
+}
+
+// reserveQuota reserves the bytes an upload of size bytes (-1 when
+// unknown) may read, given left bytes of the quota, and returns how many
+// it got: 0 when uploads in progress hold too many. Without Redis it
+// returns size, or left when size is unknown, without reserving them.
+func reserveQuota(ctx context.Context, userID string, left, size int64) (int64, bool) {
+	fallback := size
+	if fallback < 0 || fallback > left {
+		fallback = left
+	}
+	if uploadLocks == nil {
+		return fallback, false
+	}
+	key := quotaReservationKey(userID, time.Now().UTC())
+	reserved, err := reserveScript.Run(ctx, uploadLocks, []string{key}, left, size, uploadLockTTL().Milliseconds()).Int64()
+	if err != nil {
+		slog.Warn("failed to reserve upload quota", "user_id", userID, "error", err)
+		return fallback, false
+	}
+	return reserved, true
+}
+
+// releaseQuota gives back bytes reserved for userID's upload once it is
+// recorded.
+func releaseQuota(userID string, bytes int64) {
+	key := quotaReservationKey(userID, time.Now().UTC())
+	if err := uploadLocks.DecrBy(context.Background(), key, bytes).Err(); err != nil {
+		slog.Warn("failed to release upload quota", "user_id", userID, "error", err)
+	}
+}
+
+// uploadGuard authenticates uploads and, when limited, checks the
+// caller's daily quota before next gets the body. An upload larger than
+// the whole quota is turned away with 413, and so is one that turns out to
+// be larger than the bytes it reserved as it is read. Once the day's bytes
+// or items are used up, or the upload's Content-Length would go over,
+// uploads get 429 with Retry-After until the quota resets.
+func uploadGuard(quota uploadQuota, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := uploadCaller(r)
+		if !ok {
+			respondRejected(w, http.StatusUnauthorized, "Valid API key required", nil)
+			return
+		}
+		r.Header.Set("X-User-ID", userID)
+		if r.Method != http.MethodPost || quota == (uploadQuota{}) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if quota.Bytes > 0 && r.ContentLength > quota.Bytes {
+			respondRejected(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Upload of %d bytes is over the daily quota of %d bytes", r.ContentLength, quota.Bytes), nil)
+			return
+		}
+		usage, err := quotaUsage(r.Context(), userID)
+		if err != nil {
+			// Uploads are not held up by the quota's bookkeeping
+			logging.FromContext(r.Context()).Warn("failed to look up upload quota", "user_id", userID, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		var over string
+		switch {
+		case quota.Bytes > 0 && usage.Bytes+max(r.ContentLength, 0) > quota.Bytes:
+			over = fmt.Sprintf("Upload would go over the daily quota: %d of %d bytes used", usage.Bytes, quota.Bytes)
+		case quota.Items > 0 && usage.Items >= quota.Items:
+			over = fmt.Sprintf("Daily upload quota used up: %d of %d items stored", usage.Items, quota.Items)
+		}
+		if over == "" && quota.Bytes > 0 {
+			reserved, held := reserveQuota(r.Context(), userID, quota.Bytes-usage.Bytes, r.ContentLength)
+			if reserved == 0 {
+				over = fmt.Sprintf("Uploads in progress hold the rest of the daily quota: %d of %d bytes used", usage.Bytes, quota.Bytes)
+			} else {
+				if held {
+					defer releaseQuota(userID, reserved)
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, reserved)
+			}
+		}
+		if over != "" {
+			slog.Info("upload over quota", "user_id", userID, "bytes", usage.Bytes, "items", usage.Items)
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(usage.Resets).Seconds())+1))
+			respondRejected(w, http.StatusTooManyRequests, over, &usage)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func respondRejected(w http.ResponseWriter, status int, message string, usage *QuotaUsage) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(UploadResponse{Message: message, Quota: usage})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReserveQuota(t *testing.T) {
+	mr := useMiniredisLocks(t)
+	ctx := context.Background()
+
+	if got, held := reserveQuota(ctx, "alice", 100, 60); got != 60 || !held {
+		t.Fatalf("Expected 60 bytes reserved, got %d (%v)", got, held)
+	}
+	// A concurrent upload only fits in what the first left
+	if got, _ := reserveQuota(ctx, "alice", 100, 50); got != 0 {
+		t.Errorf("Expected an upload over the unreserved quota refused, got %d", got)
+	}
+	if got, _ := reserveQuota(ctx, "alice", 100, -1); got != 40 {
+		t.Errorf("Expected an upload of unknown size to reserve the remaining 40 bytes, got %d", got)
+	}
+	if got, _ := reserveQuota(ctx, "alice", 100, -1); got != 0 {
+		t.Errorf("Expected nothing left to reserve, got %d", got)
+	}
+	if got, _ := reserveQuota(ctx, "bob", 100, 50); got != 50 {
+		t.Errorf("Expected another user's quota reserved on its own, got %d", got)
+	}
+
+	releaseQuota("alice", 60)
+	if got, _ := reserveQuota(ctx, "alice", 100, 50); got != 50 {
+		t.Errorf("Expected released bytes to be reserved again, got %d", got)
+	}
+	if ttl := mr.TTL(quotaReservationKey("alice", time.Now().UTC())); ttl <= 0 {
+		t.Errorf("Expected reservations to expire, got TTL %v", ttl)
+	}
+}
+
+func TestReserveQuotaWithoutRedis(t *testing.T) {
+	if got, held := reserveQuota(context.Background(), "alice", 100, -1); got != 100 || held {
+		t.Errorf("Expected the remaining quota as the limit without a reservation, got %d (%v)", got, held)
+	}
+}
+
+func TestUploadGuardLimitsChunkedUploads(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	useMiniredisLocks(t)
+	handler := uploadGuard(uploadQuota{Bytes: 1024}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			respondWithError(w, "Failed to parse form", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	upload := func(size int) *http.Request {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "notes.txt")
+		part.Write([]byte(strings.Repeat("x", size)))
+		form.Close()
+		// No Content-Length, as with chunked transfer encoding
+		req := httptest.NewRequest("POST", "/upload/file", &body)
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		return req
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, upload(4096))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a chunked upload over the quota to get 413, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, upload(100))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected an upload within the quota accepted once the first released its bytes, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
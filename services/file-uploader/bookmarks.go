@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"selin/internal/fetch"
+	"selin/internal/logging"
+	"selin/internal/pipeline"
+	"selin/internal/readability"
+	"selin/internal/storage"
+)
+
+// maxFetchedBookmarks caps the pages fetched for one import, so an import
+// finishes in minutes even with a large priority folder.
+const maxFetchedBookmarks = 50
+
+// bookmarkPages fetches the pages of bookmarks in priority folders,
+// following robots.txt. It is set up at startup.
+var bookmarkPages = fetch.New("bookmarks", fetch.DefaultOptions())
+
+// bookmark is one bookmark parsed from an export.
+type bookmark struct {
+	URL   string
+	Title string
+	// Folders is the path of folders the bookmark is in, outermost first
+	Folders []string
+	Tags    []string
+	// Note is a description or excerpt the export has
+	Note  string
+	Added time.Time
+}
+
+// bookmarkUploadHandler imports a bookmark export: a Netscape bookmark
+// file (.html, as browsers, Pocket and Raindrop export them), Chrome's
+// Bookmarks JSON (.json), or a Pocket or Raindrop CSV export (.csv). Each
+// bookmark is stored with its folders as tags, unless its URL is already
+// stored. The pages of bookmarks in the folders named in fetch_folders
+// are fetched and stored as articles.
+func bookmarkUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upload, ctx := startUpload(r, "bookmarks")
+	defer upload.done()
+	logging.FromContext(ctx).Info("processing bookmark import")
+
+	stop := upload.stages.time("receive")
+	err := r.ParseMultipartForm(32 << 20)
+	stop()
+	if err != nil {
+		respondWithError(w, "Failed to parse form", err)
+		return
+	}
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		respondWithError(w, "No file provided", err)
+		return
+	}
+	defer file.Close()
+	upload.received(handler.Size, "bookmarks")
+	ctx = withDryRun(ctx, r)
+	overrides, err := uploadOverridesFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid tags, topic, min_relevance or author_override", err)
+		return
+	}
+	ctx = withOverrides(ctx, overrides)
+
+	parse := bookmarkParser(handler.Filename)
+	if parse == nil {
+		respondWithError(w, "Unsupported bookmark export. Expected: .html, .json, .csv", nil)
+		return
+	}
+	terms, err := documentTermsFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid visibility or license", err)
+		return
+	}
+	var priority []string
+	for _, f := range strings.Split(r.FormValue("fetch_folders"), ",") {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			priority = append(priority, f)
+		}
+	}
+
+	workspace := requestWorkspace(r)
+	stop = upload.stages.time("save")
+	stored, finish, err := saveUpload(ctx, file, handler, "bookmarks", workspace, r.Header.Get("X-User-ID"))
+	stop()
+	if respondSaveError(w, err) {
+		return
+	}
+	defer finish()
+
+	stop = upload.stages.time("parse")
+	data, err := os.ReadFile(stored.path)
+	var bookmarks []bookmark
+	if err == nil {
+		bookmarks, err = parse(data)
+	}
+	stop()
+	if err != nil {
+		respondWithError(w, "Invalid bookmark export", err)
+		return
+	}
+
+	processed, skipped, processingErrors := storeBookmarks(ctx, workspace, bookmarks, priority, terms)
+	recordUploadResult(ctx, stored.ID, processed, processingErrors)
+	upload.finished(processingErrors)
+
+	response := UploadResponse{
+		Success:        len(processingErrors) == 0,
+		Message:        fmt.Sprintf("Imported %d of %d bookmarks", processed, len(bookmarks)),
+		FileID:         stored.ID,
+		Filename:       handler.Filename,
+		FileType:       "bookmarks",
+		ProcessedItems: processed,
+		SkippedItems:   skipped,
+		SHA256:         stored.SHA256,
+		Errors:         processingErrors,
+	}
+	if !dryRunResponse(ctx, &response) && response.Success && processed > 0 {
+		announceUpload(ContentEvent{ID: stored.ID, Workspace: workspace, Platform: "bookmarks", Tags: []string{"bookmark"}, Filename: handler.Filename, Items: processed})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.FromContext(ctx).Info("bookmarks imported", "bookmarks", len(bookmarks), "stored", processed, "skipped", skipped, "errors", len(processingErrors))
+}
+
+func bookmarkParser(filename string) func([]byte) ([]bookmark, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".html", ".htm":
+		return parseNetscapeBookmarks
+	case ".json":
+		return parseChromeBookmarks
+	case ".csv":
+		return parseCSVBookmarks
+	}
+	return nil
+}
+
+// storeBookmarks stores the bookmarks whose URLs are not stored yet,
+// returning how many were stored and how many were already. Bookmarks in
+// priority folders have their page fetched, up to maxFetchedBookmarks.
+func storeBookmarks(ctx context.Context, workspace string, bookmarks []bookmark, priority []string, terms documentTerms) (int, int, []string) {
+	store, err := storage.Open("file-uploader")
+	if err != nil {
+		return 0, 0, []string{fmt.Sprintf("failed to open storage: %v", err)}
+	}
+	defer store.Close()
+
+	defer stagesFrom(ctx).time("insert")()
+	ingest := newIngester(ctx, "bookmarks", store)
+	var errs []string
+	processed, skipped, fetched := 0, 0, 0
+	seen := map[string]bool{}
+	for _, b := range bookmarks {
+		if seen[b.URL] {
+			continue
+		}
+		seen[b.URL] = true
+		// URLs already collected keep what they were stored with
+		exists, err := store.Stored(ctx, workspace, b.URL)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", b.URL, err))
+			continue
+		}
+		if exists {
+			skipped++
+			continue
+		}
+
+		item := bookmarkItem(workspace, b, terms)
+		// Dry runs leave the pages alone
+		if inFolders(b, priority) && fetched < maxFetchedBookmarks && previewFrom(ctx) == nil {
+			fetched++
+			if err := fetchBookmark(ctx, item); err != nil {
+				// The bookmark is stored without its page
+				logging.FromContext(ctx).Warn("failed to fetch bookmarked page", "url", b.URL, "error", err)
+			}
+		}
+		if err := ingest.Run(ctx, item); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", b.URL, err))
+			continue
+		}
+		if item.Inserted {
+			processed++
+		} else {
+			skipped++
+		}
+	}
+	return processed, skipped, errs
+}
+
+// bookmarkItem is the content item a bookmark is stored as: its title and
+// note, tagged with its folders and tags.
+func bookmarkItem(workspace string, b bookmark, terms documentTerms) *pipeline.ContentItem {
+	tags := []string{"bookmark"}
+	for _, t := range append(append([]string(nil), b.Folders...), b.Tags...) {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	title := firstNonEmpty(b.Title, b.URL)
+	text := title
+	if b.Note != "" {
+		text += "\n\n" + b.Note
+	}
+	added := b.Added
+	if added.IsZero() {
+		added = time.Now()
+	}
+	return &pipeline.ContentItem{
+		Content: storage.Content{
+			Workspace:      workspace,
+			SourceURL:      b.URL,
+			Author:         "file_upload",
+			Timestamp:      added,
+			Tags:           tags,
+			ContentType:    "bookmark",
+			SourcePlatform: "bookmarks",
+			Summary:        documentSummary(title, firstNonEmpty(b.Note, b.URL)),
+			RelevanceScore: 0.5,
+			Visibility:     terms.Visibility,
+			License:        terms.License,
+		},
+		Text: text,
+	}
+}
+
+// fetchBookmark replaces a bookmark's text with the article on its page,
+// stored as an article with the page's author and language.
+func fetchBookmark(ctx context.Context, item *pipeline.ContentItem) error {
+	resp, err := bookmarkPages.Get(ctx, item.SourceURL)
+	if err != nil {
+		return err
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return fmt.Errorf("not a web page: %s", contentType)
+	}
+	article, err := readability.Extract(bytes.NewReader(resp.Body))
+	if err != nil {
+		return err
+	}
+	title := firstNonEmpty(article.Title, item.Text)
+	item.Text = article.Text
+	if !strings.HasPrefix(item.Text, "# ") {
+		item.Text = "# " + title + "\n\n" + item.Text
+	}
+	item.ContentType = "article"
+	item.Author = firstNonEmpty(article.Author, item.Author)
+	item.Language = article.Language
+	item.Summary = documentSummary(title, firstNonEmpty(article.Description, article.Text))
+	// Priority folders hold what matters most
+	item.RelevanceScore = 0.7
+	return nil
+}
+
+// inFolders reports whether the bookmark is in one of folders, at any
+// depth.
+func inFolders(b bookmark, folders []string) bool {
+	for _, f := range b.Folders {
+		for _, p := range folders {
+			if strings.EqualFold(f, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bookmarkURL returns the URL of a web page, or "" for anything else, such
+// as javascript: bookmarklets and browser pages. The URL is normalized so
+// the same page bookmarked twice is stored once: without its fragment,
+// utm_* tracking parameters, www. or a trailing slash.
+func bookmarkURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	u.Fragment, u.RawFragment = "", ""
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			if strings.HasPrefix(strings.ToLower(key), "utm_") {
+				query.Del(key)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// parseNetscapeBookmarks reads the Netscape bookmark file format browsers
+// export: each folder an <H3> followed by a <DL> of its bookmarks, each
+// bookmark an <A> with ADD_DATE and, from Pocket, Raindrop and Firefox,
+// TAGS. The toolbar folder is a root rather than a folder, as in Chrome's
+// file, and Pocket's lists (<ul>) are not folders either.
+func parseNetscapeBookmarks(data []byte) ([]bookmark, error) {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	var bookmarks []bookmark
+	var folders []string
+	var heading string
+	var current *bookmark
+	var text strings.Builder
+	inHeading, inNote, root := false, false, false
+	// Notes follow their bookmark in a <DD>, which is left unclosed
+	endNote := func() {
+		if inNote {
+			bookmarks[len(bookmarks)-1].Note = strings.Join(strings.Fields(text.String()), " ")
+			inNote = false
+		}
+	}
+	for {
+		tt := z.Next()
+		if tt == html.StartTagToken || tt == html.EndTagToken || tt == html.ErrorToken {
+			endNote()
+		}
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			if len(bookmarks) == 0 {
+				return nil, fmt.Errorf("no bookmarks found")
+			}
+			return bookmarks, nil
+		case html.StartTagToken:
+			t := z.Token()
+			switch t.DataAtom {
+			case atom.H3:
+				inHeading = true
+				root = attrOf(t, "personal_toolbar_folder", "unfiled_bookmarks_folder") == "true"
+				text.Reset()
+			case atom.Dl, atom.Ul:
+				folders = append(folders, heading)
+				heading = ""
+			case atom.Dd:
+				if len(bookmarks) > 0 {
+					inNote = true
+					text.Reset()
+				}
+			case atom.A:
+				b := bookmark{URL: bookmarkURL(attrOf(t, "href"))}
+				if b.URL == "" {
+					continue
+				}
+				b.Added = unixTime(attrOf(t, "add_date", "time_added"))
+				b.Tags = splitTags(attrOf(t, "tags"), ",")
+				for _, f := range folders {
+					if f != "" {
+						b.Folders = append(b.Folders, f)
+					}
+				}
+				current = &b
+				text.Reset()
+			}
+		case html.EndTagToken:
+			t := z.Token()
+			switch t.DataAtom {
+			case atom.H3:
+				inHeading = false
+				if heading = strings.TrimSpace(text.String()); root {
+					heading = ""
+				}
+			case atom.Dl, atom.Ul:
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			case atom.A:
+				if current != nil {
+					current.Title = strings.Join(strings.Fields(text.String()), " ")
+					bookmarks = append(bookmarks, *current)
+					current = nil
+				}
+			}
+		case html.TextToken:
+			if inHeading || inNote || current != nil {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
+
+func attrOf(t html.Token, keys ...string) string {
+	for _, key := range keys {
+		for _, a := range t.Attr {
+			if a.Key == key {
+				return a.Val
+			}
+		}
+	}
+	return ""
+}
+
+// unixTime parses a timestamp in seconds since the epoch.
+func unixTime(s string) time.Time {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(n, 0).UTC()
+}
+
+func splitTags(s, sep string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, sep) {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// chromeNode is a folder or bookmark in Chrome's Bookmarks file.
+type chromeNode struct {
+	Type     string       `json:"type"`
+	Name     string       `json:"name"`
+	URL      string       `json:"url"`
+	Added    string       `json:"date_added"`
+	Children []chromeNode `json:"children"`
+}
+
+// chromeEpoch is the Unix time, in seconds, of 1601-01-01, where Chrome's
+// timestamps in microseconds start.
+const chromeEpoch = -11644473600
+
+// parseChromeBookmarks reads the Bookmarks file of Chrome and the browsers
+// built on it. The bookmark bar, other and mobile bookmarks are roots
+// rather than folders, so they are not tags.
+func parseChromeBookmarks(data []byte) ([]bookmark, error) {
+	var file struct {
+		Roots map[string]json.RawMessage `json:"roots"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Roots) == 0 {
+		return nil, fmt.Errorf("no bookmark roots found")
+	}
+	var bookmarks []bookmark
+	var walk func(n chromeNode, folders []string)
+	walk = func(n chromeNode, folders []string) {
+		if n.Type == "url" {
+			if u := bookmarkURL(n.URL); u != "" {
+				b := bookmark{URL: u, Title: n.Name, Folders: folders}
+				if us, err := strconv.ParseInt(n.Added, 10, 64); err == nil && us > 0 {
+					b.Added = time.UnixMicro(us + chromeEpoch*1e6).UTC()
+				}
+				bookmarks = append(bookmarks, b)
+			}
+			return
+		}
+		for _, c := range n.Children {
+			walk(c, append(folders[:len(folders):len(folders)], n.Name))
+		}
+	}
+	for _, raw := range file.Roots {
+		var root chromeNode
+		// Roots also hold sync metadata, which is not a node
+		if json.Unmarshal(raw, &root) != nil || root.Type != "folder" {
+			continue
+		}
+		for _, c := range root.Children {
+			walk(c, nil)
+		}
+	}
+	return bookmarks, nil
+}
+
+// parseCSVBookmarks reads Pocket's CSV export (title, url, time_added,
+// tags separated by |, status) and Raindrop's (title, note, excerpt, url,
+// folder, tags separated by commas, created), telling the columns apart
+// by the header.
+func parseCSVBookmarks(data []byte) ([]bookmark, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["url"]; !ok {
+		return nil, fmt.Errorf("no url column")
+	}
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := col[name]; ok && i < len(record) && record[i] != "" {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+	tagSep := ","
+	if _, pocket := col["time_added"]; pocket {
+		tagSep = "|"
+	}
+
+	var bookmarks []bookmark
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return bookmarks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		u := bookmarkURL(field(record, "url"))
+		if u == "" {
+			continue
+		}
+		b := bookmark{
+			URL:   u,
+			Title: field(record, "title"),
+			Tags:  splitTags(field(record, "tags"), tagSep),
+			Note:  field(record, "note", "excerpt"),
+			Added: unixTime(field(record, "time_added")),
+		}
+		// Raindrop writes nested collections as "Parent / Child"
+		if folder := field(record, "folder"); folder != "" {
+			b.Folders = splitTags(folder, "/")
+		}
+		if b.Added.IsZero() {
+			b.Added, _ = time.Parse(time.RFC3339, field(record, "created"))
+		}
+		if b.Title == u {
+			b.Title = ""
+		}
+		bookmarks = append(bookmarks, b)
+	}
+}
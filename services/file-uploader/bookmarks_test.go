@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBookmarkURL(t *testing.T) {
+	for _, tt := range []struct{ raw, want string }{
+		{"https://example.com/post", "https://example.com/post"},
+		{"  https://Example.com/post/#comments ", "https://example.com/post"},
+		{"https://www.example.com/", "https://example.com"},
+		{"http://www.example.com/a/?utm_source=rss&id=7&UTM_Medium=feed", "http://example.com/a?id=7"},
+		{"https://example.com/search?q=go+generics", "https://example.com/search?q=go+generics"},
+		{"javascript:alert(1)", ""},
+		{"chrome://settings", ""},
+		{"file:///home/notes.html", ""},
+		{"https://", ""},
+	} {
+		if got := bookmarkURL(tt.raw); got != tt.want {
+			t.Errorf("bookmarkURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseNetscapeBookmarks(t *testing.T) {
+	for _, tt := range []struct {
+		name, file string
+		want       []bookmark
+		wantErr    bool
+	}{
+		{
+			name: "folders, tags and notes",
+			file: `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<DL><p>
+  <DT><H3 PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+  <DL><p>
+    <DT><H3>Research</H3>
+    <DL><p>
+      <DT><A HREF="https://example.com/raft/" ADD_DATE="1700000000" TAGS="consensus,papers">The  Raft paper</A>
+      <DD>Read the log replication part
+    </DL><p>
+    <DT><A HREF="javascript:void(0)">Bookmarklet</A>
+    <DT><A HREF="https://www.example.com/go">Go</A>
+  </DL><p>
+</DL>`,
+			want: []bookmark{
+				{URL: "https://example.com/raft", Title: "The Raft paper", Folders: []string{"Research"}, Tags: []string{"consensus", "papers"},
+					Note: "Read the log replication part", Added: time.Unix(1700000000, 0).UTC()},
+				{URL: "https://example.com/go", Title: "Go"},
+			},
+		},
+		{
+			name: "pocket lists are not folders",
+			file: `<ul><li><a href="https://example.com/a" time_added="1700000000" tags="go|web">A</a></li></ul>`,
+			want: []bookmark{{URL: "https://example.com/a", Title: "A", Tags: []string{"go|web"}, Added: time.Unix(1700000000, 0).UTC()}},
+		},
+		{name: "no bookmarks", file: `<DL><p><DT><H3>Empty</H3><DL><p></DL></DL>`, wantErr: true},
+	} {
+		got, err := parseNetscapeBookmarks([]byte(tt.file))
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseChromeBookmarks(t *testing.T) {
+	for _, tt := range []struct {
+		name, file string
+		want       []bookmark
+		wantErr    bool
+	}{
+		{
+			name: "roots are not folders",
+			file: `{"checksum": "x", "roots": {
+				"bookmark_bar": {"type": "folder", "name": "Bookmarks bar", "children": [
+					{"type": "folder", "name": "Go", "children": [
+						{"type": "url", "name": "Generics", "url": "https://go.dev/doc/tutorial/generics/", "date_added": "13345000000000000"}
+					]},
+					{"type": "url", "name": "Settings", "url": "chrome://settings"}
+				]},
+				"other": {"type": "folder", "name": "Other bookmarks", "children": [
+					{"type": "url", "name": "News", "url": "https://news.example.com/?utm_campaign=x"}
+				]},
+				"sync_transaction_version": "1"
+			}}`,
+			want: []bookmark{
+				{URL: "https://go.dev/doc/tutorial/generics", Title: "Generics", Folders: []string{"Go"}, Added: time.UnixMicro(13345000000000000 + chromeEpoch*1e6).UTC()},
+				{URL: "https://news.example.com", Title: "News"},
+			},
+		},
+		{name: "not json", file: `<html>`, wantErr: true},
+		{name: "no roots", file: `{"roots": {}}`, wantErr: true},
+	} {
+		got, err := parseChromeBookmarks([]byte(tt.file))
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		// Roots are a map, so their order varies
+		if len(got) == 2 && got[0].Title == "News" {
+			got[0], got[1] = got[1], got[0]
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSVBookmarks(t *testing.T) {
+	for _, tt := range []struct {
+		name, file string
+		want       []bookmark
+		wantErr    bool
+	}{
+		{
+			name: "pocket",
+			file: "title,url,time_added,tags,status\n" +
+				"Raft,https://example.com/raft,1700000000,consensus|papers,unread\n" +
+				"https://example.com/untitled,https://example.com/untitled,,,archive\n" +
+				"Bad,ftp://example.com/file,1700000000,,unread\n",
+			want: []bookmark{
+				{URL: "https://example.com/raft", Title: "Raft", Tags: []string{"consensus", "papers"}, Added: time.Unix(1700000000, 0).UTC()},
+				{URL: "https://example.com/untitled"},
+			},
+		},
+		{
+			name: "raindrop",
+			file: "\xef\xbb\xbfid,title,note,excerpt,url,folder,tags,created\n" +
+				`1,Raft,,The paper,https://www.example.com/raft,Research / Papers,"consensus, papers",2024-01-02T03:04:05Z` + "\n",
+			want: []bookmark{{URL: "https://example.com/raft", Title: "Raft", Folders: []string{"Research", "Papers"}, Tags: []string{"consensus", "papers"},
+				Note: "The paper", Added: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		},
+		{name: "no url column", file: "title,link\nA,https://example.com\n", wantErr: true},
+	} {
+		got, err := parseCSVBookmarks([]byte(tt.file))
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoreBookmarksSkipsStoredURLs(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "selin.db"))
+	ctx := context.Background()
+	parsed, err := parseNetscapeBookmarks([]byte(`<DL><p>
+		<DT><A HREF="https://www.example.com/raft/">Raft</A>
+		<DT><A HREF="https://example.com/raft?utm_source=hn">Raft again</A>
+		<DT><A HREF="https://example.com/paxos">Paxos</A>
+	</DL>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processed, skipped, errs := storeBookmarks(ctx, "default", parsed[:1], nil, documentTerms{})
+	if processed != 1 || skipped != 0 || len(errs) != 0 {
+		t.Fatalf("Expected the first import to store its bookmark, got %d stored, %d skipped, %v", processed, skipped, errs)
+	}
+	processed, skipped, errs = storeBookmarks(ctx, "default", parsed, nil, documentTerms{})
+	if processed != 1 || skipped != 1 || len(errs) != 0 {
+		t.Errorf("Expected only paxos stored again, the raft duplicate dropped, got %d stored, %d skipped, %v", processed, skipped, errs)
+	}
+}
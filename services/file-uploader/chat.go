@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func processChatFile(ctx context.Context, workspace, filePath, platform, filename string) (int, []string) {
+	slog.Debug("processing chat file", "platform", platform, "filename", filename)
+
+	var parse func(data []byte, files media) ([]message, error)
+	var exportName string
+	switch platform {
+	case "telegram":
+		parse, exportName = parseTelegram, "result.json"
+	case "discord":
+		parse = parseDiscord
+	default:
+		// TODO: Implement processing for the other platforms (WhatsApp, etc.)
+		processedItems := 100 // Simulated messages
+		if platform == "whatsapp" {
+			processedItems = 200
+		}
+		slog.Debug("simulated processing", "filename", filename, "items", processedItems)
+		return processedItems, []string{}
+	}
+
+	// A zip holds the export JSON along with the media it refers to
+	var data []byte
+	var files media
+	var err error
+	st := stagesFrom(ctx)
+	if strings.ToLower(filepath.Ext(filename)) == ".zip" {
+		var closeZip func() error
+		stop := st.time("unzip")
+		if data, files, closeZip, err = readExportZip(filePath, exportName); err == nil {
+			defer closeZip()
+		}
+		stop()
+	} else {
+		data, err = os.ReadFile(filePath)
+	}
+	if err != nil {
+		return 0, []string{fmt.Sprintf("invalid %s export: %v", platform, err)}
+	}
+	stop := st.time("parse")
+	msgs, err := parse(data, files)
+	stop()
+	if err != nil {
+		return 0, []string{fmt.Sprintf("invalid %s export: %v", platform, err)}
+	}
+	return storeMessages(ctx, workspace, platform, msgs)
+}
+
+// telegramExport is a chat exported from Telegram Desktop as JSON.
+type telegramExport struct {
+	Name     string `json:"name"`
+	ID       int64  `json:"id"`
+	Messages []struct {
+		ID      int64           `json:"id"`
+		Type    string          `json:"type"`
+		Date    string          `json:"date"`
+		From    string          `json:"from"`
+		Text    json.RawMessage `json:"text"`
+		ReplyTo int64           `json:"reply_to_message_id"`
+		// Paths of the media within the export; exports made without
+		// media say "(File not included...)" instead
+		Photo    string `json:"photo"`
+		File     string `json:"file"`
+		FileName string `json:"file_name"`
+		MimeType string `json:"mime_type"`
+	} `json:"messages"`
+}
+
+func parseTelegram(data []byte, files media) ([]message, error) {
+	var export telegramExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	channel := export.Name
+	if channel == "" {
+		channel = strconv.FormatInt(export.ID, 10)
+	}
+	msgs := make([]message, 0, len(export.Messages))
+	for _, m := range export.Messages {
+		if m.Type != "message" {
+			continue
+		}
+		// Dates are local to the exporting machine, which the export does
+		// not record
+		t, _ := time.Parse("2006-01-02T15:04:05", m.Date)
+		msg := message{
+			ID:      strconv.FormatInt(m.ID, 10),
+			Channel: channel,
+			Author:  m.From,
+			Text:    telegramText(m.Text),
+			Time:    t,
+		}
+		if m.ReplyTo != 0 {
+			msg.ReplyTo = strconv.FormatInt(m.ReplyTo, 10)
+		}
+		if m.Photo != "" {
+			msg.Attachments = append(msg.Attachments, files.attach(m.Photo, "", "image/jpeg", 0))
+		}
+		if m.File != "" {
+			msg.Attachments = append(msg.Attachments, files.attach(m.File, m.FileName, m.MimeType, 0))
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// telegramText flattens a message text, which Telegram writes as a
+// string, or as an array of strings and formatted {"text": ...} entities.
+func telegramText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(part, &text) == nil {
+			b.WriteString(text)
+		} else if json.Unmarshal(part, &entity) == nil {
+			b.WriteString(entity.Text)
+		}
+	}
+	return b.String()
+}
+
+// discordExport is a channel exported by DiscordChatExporter as JSON.
+type discordExport struct {
+	Channel struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"channel"`
+	Messages []struct {
+		ID        string    `json:"id"`
+		Type      string    `json:"type"`
+		Timestamp time.Time `json:"timestamp"`
+		Content   string    `json:"content"`
+		Author    struct {
+			Name     string `json:"name"`
+			Nickname string `json:"nickname"`
+		} `json:"author"`
+		Reference *struct {
+			MessageID string `json:"messageId"`
+			ChannelID string `json:"channelId"`
+		} `json:"reference"`
+		// URLs are local paths when the export was made with its media
+		Attachments []struct {
+			URL           string `json:"url"`
+			FileName      string `json:"fileName"`
+			FileSizeBytes int64  `json:"fileSizeBytes"`
+		} `json:"attachments"`
+	} `json:"messages"`
+}
+
+func parseDiscord(data []byte, files media) ([]message, error) {
+	var export discordExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	channel := export.Channel.Name
+	if channel == "" {
+		channel = export.Channel.ID
+	}
+	msgs := make([]message, 0, len(export.Messages))
+	for _, m := range export.Messages {
+		if m.Type != "Default" && m.Type != "Reply" {
+			continue
+		}
+		author := m.Author.Nickname
+		if author == "" {
+			author = m.Author.Name
+		}
+		msg := message{
+			ID:      m.ID,
+			Channel: channel,
+			Author:  author,
+			Text:    m.Content,
+			Time:    m.Timestamp,
+		}
+		// Replies to messages in other channels are not in this export
+		if m.Reference != nil && (m.Reference.ChannelID == "" || m.Reference.ChannelID == export.Channel.ID) {
+			msg.ReplyTo = m.Reference.MessageID
+		}
+		for _, a := range m.Attachments {
+			msg.Attachments = append(msg.Attachments, files.attach(a.URL, a.FileName, "", a.FileSizeBytes))
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
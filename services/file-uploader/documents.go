@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"selin/internal/chunker"
+	"selin/internal/links"
+	"selin/internal/pipeline"
+	"selin/internal/readability"
+	"selin/internal/search"
+	"selin/internal/storage"
+)
+
+// chunking is how documents are split, set from CHUNKING_CONFIG_FILE at
+// startup.
+var chunking = chunker.DefaultConfig()
+
+// documentTerms are who may see an uploaded document outside the system
+// and the license it came under, from the upload's visibility and license
+// form fields. Documents are private unless uploaded as public.
+type documentTerms struct {
+	Visibility string
+	License    string
+}
+
+func documentTermsFromForm(r *http.Request) (documentTerms, error) {
+	t := documentTerms{
+		Visibility: strings.TrimSpace(r.FormValue("visibility")),
+		License:    strings.TrimSpace(r.FormValue("license")),
+	}
+	if t.Visibility == "" {
+		t.Visibility = search.VisibilityPrivate
+	}
+	if t.Visibility != search.VisibilityPublic && t.Visibility != search.VisibilityPrivate {
+		return t, fmt.Errorf("visibility must be public or private")
+	}
+	if len(t.License) > 100 {
+		return t, fmt.Errorf("license must be at most 100 characters")
+	}
+	return t, nil
+}
+
+// storeDocument stores a markdown, text or HTML upload as one content
+// item and its chunks, returning how many chunks it was split into.
+// Chunks are kept only when the store is Postgres.
+func storeDocument(ctx context.Context, path, fileType, filename, fileID, workspace string, terms documentTerms) (int, []string) {
+	st := stagesFrom(ctx)
+	stop := st.time("parse")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		stop()
+		return 0, []string{fmt.Sprintf("failed to read file: %v", err)}
+	}
+	doc := document{Title: filename, Author: "file_upload", Timestamp: time.Now(), Text: strings.TrimSpace(string(data))}
+	if fileType == "html" {
+		doc, err = htmlDocument(data, filename)
+	}
+	stop()
+	if err != nil {
+		return 0, []string{fmt.Sprintf("failed to read %s: %v", filename, err)}
+	}
+	if doc.Text == "" {
+		return 0, []string{"file has no text"}
+	}
+
+	store, err := storage.Open("file-uploader")
+	if err != nil {
+		return 0, []string{fmt.Sprintf("failed to open storage: %v", err)}
+	}
+	defer store.Close()
+
+	defer st.time("insert")()
+	item := &pipeline.ContentItem{
+		Content: storage.Content{
+			Workspace:      workspace,
+			SourceURL:      "upload://" + fileID,
+			Author:         doc.Author,
+			Timestamp:      doc.Timestamp,
+			Tags:           []string{fileType},
+			ContentType:    fileType,
+			SourcePlatform: "file_upload",
+			Language:       doc.Language,
+			Summary:        documentSummary(doc.Title, doc.Text),
+			RelevanceScore: 0.5,
+			Visibility:     terms.Visibility,
+			License:        terms.License,
+		},
+		Text: doc.Text,
+	}
+	// A saved page is derived from the page at its canonical URL, when
+	// that was stored too
+	if doc.Canonical != "" {
+		item.Links = []pipeline.Link{{Relation: links.DerivedFrom, TargetURL: doc.Canonical}}
+	}
+	ingest := newIngester(ctx, "file_upload", store)
+	if err := ingest.Run(ctx, item); err != nil {
+		return 0, []string{fmt.Sprintf("failed to store %s: %v", filename, err)}
+	}
+	return len(item.Chunks), nil
+}
+
+// documentSummary is the document's title, such as its file name,
+// followed by the start of its text.
+func documentSummary(title, text string) string {
+	summary := strings.Join(strings.Fields(text), " ")
+	if len(summary) > pipeline.SummaryLength {
+		summary = summary[:pipeline.SummaryLength] + "..."
+	}
+	return title + ": " + summary
+}
+
+// document is an uploaded document's text and what is known about it.
+type document struct {
+	Title     string
+	Author    string
+	Timestamp time.Time
+	Language  string
+	// Canonical is the URL a saved web page came from
+	Canonical string
+	Text      string
+}
+
+// htmlDocument extracts a saved web page's article as Markdown, leaving
+// out navigation and other boilerplate, with the title, author, published
+// date and canonical URL its meta tags give. Pages without them keep the
+// file name, the uploader as author and the upload time.
+func htmlDocument(data []byte, filename string) (document, error) {
+	article, err := readability.Extract(bytes.NewReader(data))
+	if err != nil {
+		return document{}, err
+	}
+	doc := document{
+		Title:     firstNonEmpty(article.Title, filename),
+		Author:    firstNonEmpty(article.Author, "file_upload"),
+		Timestamp: article.Published,
+		Language:  article.Language,
+		Text:      strings.TrimSpace(article.Text),
+	}
+	if doc.Timestamp.IsZero() {
+		doc.Timestamp = time.Now()
+	}
+	if u, err := url.Parse(article.Canonical); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		doc.Canonical = u.String()
+	}
+	if article.Title != "" && !strings.HasPrefix(doc.Text, "# ") {
+		doc.Text = "# " + article.Title + "\n\n" + doc.Text
+	}
+	return doc, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"selin/internal/pipeline"
+)
+
+// A dry run (dry_run=true on any upload endpoint) parses, chunks, tags and
+// scores an upload the way it would be stored but stores nothing: not the
+// file, its items, their chunks, attachments and links, nor Slack import
+// marks. The request's context carries the preview its items are added
+// to, and the response reports it.
+
+// UploadPreview is what a dry run would have stored. Slack uploads also
+// report the messages per channel and those their rules leave out.
+type UploadPreview struct {
+	*pipeline.Preview
+	*SlackPreview
+}
+
+type previewKey struct{}
+
+// withDryRun returns the context of a dry run when the request asks for
+// one, and ctx otherwise.
+func withDryRun(ctx context.Context, r *http.Request) context.Context {
+	if r.FormValue("dry_run") != "true" {
+		return ctx
+	}
+	return context.WithValue(ctx, previewKey{}, pipeline.NewPreview())
+}
+
+// previewFrom returns the preview of the dry run ctx belongs to, or nil
+// outside of one.
+func previewFrom(ctx context.Context) *pipeline.Preview {
+	p, _ := ctx.Value(previewKey{}).(*pipeline.Preview)
+	return p
+}
+
+// saveUpload stores and records an upload with storeUpload. In a dry run
+// the file is only kept in a temporary file under a new ID. The returned
+// function is called once the upload is handled: it removes a dry run's
+// file again, and finishes a stored upload with finishUpload.
+func saveUpload(ctx context.Context, file multipart.File, handler *multipart.FileHeader, fileType, workspace, userID string) (Upload, func(), error) {
+	if previewFrom(ctx) == nil {
+		stored, err := storeUpload(ctx, file, handler, fileType, workspace, userID)
+		if err != nil {
+			return Upload{}, func() {}, err
+		}
+		return stored, func() { finishUpload(stored) }, nil
+	}
+	tmp, err := os.CreateTemp("", "dry-run-*")
+	if err != nil {
+		return Upload{}, func() {}, err
+	}
+	discard := func() { os.Remove(tmp.Name()) }
+	size, err := io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		discard()
+		return Upload{}, func() {}, err
+	}
+	return Upload{ID: uuid.New().String(), Workspace: workspace, UserID: userID, Filename: handler.Filename,
+		FileType: fileType, Size: size, CreatedAt: time.Now(), path: tmp.Name()}, discard, nil
+}
+
+// dryRunResponse turns response into a dry run's, reporting false outside
+// of one. There is no file to refer to, and nothing to announce.
+func dryRunResponse(ctx context.Context, response *UploadResponse) bool {
+	preview := previewFrom(ctx)
+	if preview == nil {
+		return false
+	}
+	response.FileID = ""
+	response.DryRun = true
+	if response.Preview == nil {
+		response.Preview = &UploadPreview{}
+	}
+	response.Preview.Preview = preview
+	return true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/events"
+	"selin/internal/pipeline"
+	"selin/internal/search"
+)
+
+// ContentEvent is the payload of a content.new event. Uploads are announced
+// once per processed file rather than per extracted item.
+type ContentEvent struct {
+	ID        string    `json:"id"`
+	Workspace string    `json:"workspace_id"`
+	Platform  string    `json:"platform"`
+	Tags      []string  `json:"tags"`
+	Score     float64   `json:"score"`
+	Filename  string    `json:"filename,omitempty"`
+	Items     int       `json:"items"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// announceUpload tells other services about a processed upload. With an
+// event bus it publishes upload.completed, which the ws service turns into
+// content.new for its clients; without one it posts to the ws service.
+func announceUpload(event ContentEvent) {
+	if events.Enabled("file-uploader") {
+		events.Emit("file-uploader", events.UploadCompleted, event.Workspace, events.Upload{
+			ID:       event.ID,
+			Platform: event.Platform,
+			Tags:     event.Tags,
+			Filename: event.Filename,
+			Items:    event.Items,
+		})
+		return
+	}
+	publishContentNew(event)
+}
+
+// announceItem tells the notifier about an item an upload stored, so that
+// watches and notifications cover uploaded content like collected content.
+// With an event bus it publishes content.created, which the ws service
+// leaves to announceUpload; without one it reports highly relevant public
+// items to the notifier.
+func announceItem(item *pipeline.ContentItem) {
+	// Content is stored private unless its source says otherwise
+	visibility := item.Visibility
+	if visibility == "" {
+		visibility = search.VisibilityPrivate
+	}
+	if events.Enabled("file-uploader") {
+		events.Emit("file-uploader", events.ContentCreated, item.Workspace, events.Content{
+			ID:         item.ID,
+			Platform:   item.SourcePlatform,
+			Tags:       item.Tags,
+			Score:      item.RelevanceScore,
+			Summary:    item.Summary,
+			SourceURL:  item.SourceURL,
+			Visibility: visibility,
+			Timestamp:  item.Timestamp,
+			Uploaded:   true,
+		})
+		return
+	}
+	minScore, err := strconv.ParseFloat(os.Getenv("NOTIFY_MIN_SCORE"), 64)
+	if err != nil {
+		minScore = 0.8
+	}
+	if item.RelevanceScore < minScore || visibility == search.VisibilityPrivate {
+		return
+	}
+	events.Notify(events.Notification{
+		Type:      "high_relevance_content",
+		Title:     fmt.Sprintf("New in %s (score %.1f)", strings.Join(item.Tags, ", "), item.RelevanceScore),
+		Body:      item.Summary,
+		URL:       item.SourceURL,
+		Tags:      item.Tags,
+		Workspace: item.Workspace,
+	})
+}
+
+// publishContentNew announces a processed upload through the ws service,
+// without holding up the upload response.
+func publishContentNew(event ContentEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	events.PublishWS(events.ContentNewTopic, event.Workspace, event.Tags, event)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"selin/internal/adminauth"
+	"selin/internal/logging"
+)
+
+// The uploads directory is cleaned every UPLOAD_GC_INTERVAL: files no
+// upload record refers to any more, such as those of uploads whose
+// processing failed before they were recorded, and those of failed
+// uploads are removed, and with UPLOAD_RETENTION set so is every file
+// older than it, its upload marked expired. Downloads of an upload whose
+// file was removed get 410. With UPLOAD_GC_DRY_RUN=true the cleaner only
+// logs what it would remove.
+
+// orphanGrace is how old a file without a record, or of a failed upload,
+// must be before it is removed, so uploads saved but not yet recorded are
+// left alone and failed ones can still be looked into for a while.
+const orphanGrace = time.Hour
+
+var (
+	gcRemovedFiles = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "uploader_gc_removed_files_total",
+			Help: "Total number of files removed from the uploads directory, by reason (orphaned, failed or expired)",
+		},
+		[]string{"reason"},
+	)
+
+	gcReclaimedBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "uploader_gc_reclaimed_bytes_total",
+			Help: "Total size of the files removed from the uploads directory, by reason (orphaned, failed or expired)",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(gcRemovedFiles)
+	prometheus.MustRegister(gcReclaimedBytes)
+}
+
+// RemovedUpload is a file the cleaner removed, or would remove.
+type RemovedUpload struct {
+	Path string `json:"path"`
+	Size int64  `json:"size_bytes"`
+	// Reason is orphaned, for files without a record, failed, for files of
+	// failed uploads, or expired
+	Reason   string    `json:"reason"`
+	Modified time.Time `json:"modified"`
+}
+
+// UploadsCleanup is what a run of the cleaner removed.
+type UploadsCleanup struct {
+	DryRun  bool            `json:"dry_run"`
+	Scanned int             `json:"scanned"`
+	Removed []RemovedUpload `json:"removed"`
+	Bytes   int64           `json:"reclaimed_bytes"`
+}
+
+// cleanUploads removes the files under dir no upload is recorded with or
+// whose upload failed and, when retention is set, those older than it,
+// marking their uploads expired. Without Postgres no upload is recorded,
+// so only retention applies. A dry run removes nothing.
+func cleanUploads(ctx context.Context, dir string, retention time.Duration, dryRun bool) (UploadsCleanup, error) {
+	cleanup := UploadsCleanup{DryRun: dryRun, Removed: []RemovedUpload{}}
+	// recorded maps the stored files to their upload
+	var recorded map[string]Upload
+	db, ok := openPostgres()
+	if ok {
+		defer db.Close()
+		var err error
+		if recorded, err = recordedUploads(ctx, db); err != nil {
+			return cleanup, err
+		}
+	}
+
+	now := time.Now()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		cleanup.Scanned++
+		age := now.Sub(info.ModTime())
+		upload, isRecorded := recorded[filepath.Clean(path)]
+		var reason string
+		switch {
+		case retention > 0 && age > retention:
+			reason = "expired"
+		case recorded != nil && !isRecorded && age > orphanGrace:
+			reason = "orphaned"
+		case upload.Status == "failed" && age > orphanGrace:
+			reason = "failed"
+		default:
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				slog.Warn("failed to remove upload file", "path", path, "error", err)
+				return nil
+			}
+			gcRemovedFiles.WithLabelValues(reason).Inc()
+			gcReclaimedBytes.WithLabelValues(reason).Add(float64(info.Size()))
+			if reason == "expired" && isRecorded {
+				if _, err := db.ExecContext(ctx, `UPDATE uploads SET status = 'expired' WHERE id = $1`, upload.ID); err != nil {
+					slog.Warn("failed to mark upload expired", "upload_id", upload.ID, "error", err)
+				}
+			}
+		}
+		cleanup.Removed = append(cleanup.Removed, RemovedUpload{Path: path, Size: info.Size(), Reason: reason, Modified: info.ModTime()})
+		cleanup.Bytes += info.Size()
+		return nil
+	})
+	return cleanup, err
+}
+
+// recordedUploads maps the files of recorded uploads to their upload,
+// with only its ID and status.
+func recordedUploads(ctx context.Context, db *sql.DB) (map[string]Upload, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, stored_path, status FROM uploads`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	recorded := map[string]Upload{}
+	for rows.Next() {
+		var u Upload
+		if err := rows.Scan(&u.ID, &u.path, &u.Status); err != nil {
+			return nil, err
+		}
+		recorded[filepath.Clean(u.path)] = u
+	}
+	return recorded, rows.Err()
+}
+
+// runUploadsCleanup cleans dir every interval.
+func runUploadsCleanup(dir string, interval, retention time.Duration, dryRun bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cleanup, err := cleanUploads(context.Background(), dir, retention, dryRun)
+		if err != nil {
+			slog.Error("uploads cleanup failed", "error", err)
+		} else if dryRun {
+			for _, f := range cleanup.Removed {
+				slog.Info("uploads cleanup would remove file", "path", f.Path, "size_bytes", f.Size, "reason", f.Reason)
+			}
+		} else if len(cleanup.Removed) > 0 {
+			slog.Info("cleaned up uploads", "files", len(cleanup.Removed), "reclaimed_bytes", cleanup.Bytes)
+		}
+		<-ticker.C
+	}
+}
+
+// uploadsCleanupHandler serves POST /admin/uploads/cleanup, which runs the
+// cleaner now, and reports what it would remove with dry_run=true.
+func uploadsCleanupHandler(retention time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !adminauth.Authorized(w, r) {
+			return
+		}
+		cleanup, err := cleanUploads(r.Context(), "uploads", retention, r.URL.Query().Get("dry_run") == "true")
+		if err != nil {
+			logging.FromContext(r.Context()).Error("uploads cleanup failed", "error", err)
+			http.Error(w, "Failed to clean up uploads", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cleanup)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeAged writes a file under dir last modified age ago.
+func writeAged(t *testing.T, dir, name string, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCleanUploadsRetention(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	dir := t.TempDir()
+	old := writeAged(t, dir, "old.md", 48*time.Hour)
+	fresh := writeAged(t, dir, "fresh.md", 2*time.Hour)
+
+	for _, dryRun := range []bool{true, false} {
+		cleanup, err := cleanUploads(context.Background(), dir, 24*time.Hour, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cleanup.Scanned != 2 || len(cleanup.Removed) != 1 || cleanup.Removed[0].Path != old || cleanup.Removed[0].Reason != "expired" {
+			t.Errorf("dry run %v: expected only the old file expired, got %+v", dryRun, cleanup)
+		}
+		if _, err := os.Stat(old); (err == nil) != dryRun {
+			t.Errorf("dry run %v: expected the old file removed only for real, got %v", dryRun, err)
+		}
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("Expected the fresh file kept without a record, since there are none without Postgres: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"selin/internal/blob"
+	"selin/internal/links"
+	"selin/internal/pipeline"
+	"selin/internal/search"
+	"selin/internal/storage"
+)
+
+// message is one message parsed from a Slack or chat export.
+type message struct {
+	// ID identifies the message within its channel
+	ID      string
+	Channel string
+	Author  string
+	// AuthorID is the author's user ID, when the export has one
+	AuthorID string
+	Text     string
+	Time     time.Time
+	// Direct marks messages of direct and group direct conversations
+	Direct bool
+	// ReplyTo is the ID of the message this one answers
+	ReplyTo string
+	// ThreadOf is the ID of the first message of this one's thread
+	ThreadOf    string
+	Attachments []attachment
+}
+
+// messageURL is the source URL a message is stored under, so uploading
+// the same export again does not duplicate its messages.
+func messageURL(platform, channel, id string) string {
+	return fmt.Sprintf("%s://%s/%s", platform, url.PathEscape(channel), url.PathEscape(id))
+}
+
+// storeMessages stores msgs as content and links replies and thread
+// messages to the messages they belong to. It returns how many messages
+// were stored and an error for each one that was not.
+func storeMessages(ctx context.Context, workspace, platform string, msgs []message) (int, []string) {
+	store, err := storage.Open("file-uploader")
+	if err != nil {
+		return 0, []string{fmt.Sprintf("failed to open storage: %v", err)}
+	}
+	defer store.Close()
+
+	st := stagesFrom(ctx)
+	stop := st.time("insert")
+	ingest := newIngester(ctx, platform, store)
+	var errs []string
+	ids := make(map[*message]string, len(msgs))
+	for i := range msgs {
+		m := &msgs[i]
+		if strings.TrimSpace(m.Text) == "" && len(m.Attachments) == 0 {
+			continue
+		}
+		tags := []string{platform}
+		if m.Channel != "" {
+			tags = append(tags, strings.ToLower(m.Channel))
+		}
+		item := &pipeline.ContentItem{
+			Content: storage.Content{
+				Workspace:      workspace,
+				SourceURL:      messageURL(platform, m.Channel, m.ID),
+				Author:         m.Author,
+				Timestamp:      m.Time,
+				Tags:           tags,
+				ContentType:    platform + "_message",
+				SourcePlatform: platform,
+				RelevanceScore: 0.5,
+				// Chat exports are the workspace's own conversations
+				Visibility: search.VisibilityPrivate,
+			},
+			Text: strings.TrimSpace(m.Text),
+		}
+		if item.Text == "" {
+			item.Summary = "[" + m.Attachments[0].Name + "]"
+		}
+		if err := ingest.Run(ctx, item); err != nil {
+			errs = append(errs, fmt.Sprintf("message %s: %v", m.ID, err))
+			continue
+		}
+		ids[m] = item.ID
+	}
+	stop()
+
+	// Links and attachments need Postgres. Links go in once every message
+	// is stored, since a reply may come before its parent in the export
+	db, postgres := storage.PostgresDB(store)
+	if !postgres || previewFrom(ctx) != nil {
+		return len(ids), errs
+	}
+	defer st.time("attach")()
+	blobs := blob.FromEnv()
+	for m, id := range ids {
+		if err := storeAttachments(ctx, db, blobs, workspace, id, m.Attachments); err != nil {
+			errs = append(errs, fmt.Sprintf("attachments of message %s: %v", m.ID, err))
+		}
+		for _, link := range []struct {
+			rel    links.Relation
+			target string
+		}{{links.ReplyTo, m.ReplyTo}, {links.SameThread, m.ThreadOf}} {
+			if link.target == "" {
+				continue
+			}
+			if err := links.Add(ctx, db, workspace, id, link.rel, messageURL(platform, m.Channel, link.target)); err != nil {
+				slog.Warn("failed to link message", "content_id", id, "relation", link.rel, "error", err)
+			}
+		}
+	}
+	return len(ids), errs
+}
+
+// ingester runs an upload's items through the standard pipeline, with the
+// upload's overrides, or in a dry run through the pipeline without the
+// stages that write, adding them to the preview.
+type ingester struct {
+	pipeline  *pipeline.Pipeline
+	preview   *pipeline.Preview
+	overrides uploadOverrides
+	store     storage.Store
+	// tracked is set once the overrides' topic is tracked
+	tracked bool
+}
+
+func newIngester(ctx context.Context, name string, store storage.Store) *ingester {
+	i := &ingester{
+		preview:   previewFrom(ctx),
+		overrides: overridesFrom(ctx),
+		store:     store,
+	}
+	i.pipeline = i.overrides.apply(pipeline.Standard(pipeline.Deps{Name: name, Store: store, Chunking: chunking}))
+	if i.preview != nil {
+		i.pipeline = i.pipeline.DryRun()
+	}
+	return i
+}
+
+func (i *ingester) Run(ctx context.Context, item *pipeline.ContentItem) error {
+	if err := i.pipeline.Run(ctx, item); err != nil {
+		return err
+	}
+	if i.preview == nil {
+		if !i.tracked {
+			i.overrides.trackTopic(ctx, i.store, item.Workspace)
+			i.tracked = true
+		}
+		if item.Inserted {
+			announceItem(item)
+		}
+		return nil
+	}
+	// Without the store stage to tell, an item is new unless its URL was
+	// stored before
+	stored, err := i.store.Stored(ctx, item.Workspace, item.SourceURL)
+	if err != nil {
+		return err
+	}
+	item.Inserted = !stored
+	i.preview.Add(item)
+	return nil
+}
@@ -0,0 +1,67 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration . (needs a Docker daemon)
+
+func TestCleanUploadsAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"failed":     writeAged(t, dir, "failed.md", 2*time.Hour),
+		"processing": writeAged(t, dir, "processing.md", 2*time.Hour),
+		"expired":    writeAged(t, dir, "expired.md", 48*time.Hour),
+		"orphaned":   writeAged(t, dir, "orphaned.md", 2*time.Hour),
+	}
+	ids := map[string]string{
+		"failed":     "00000000-0000-0000-0000-000000000001",
+		"processing": "00000000-0000-0000-0000-000000000002",
+		"expired":    "00000000-0000-0000-0000-000000000003",
+	}
+	for status, id := range ids {
+		recorded := status
+		if status == "expired" {
+			recorded = "completed"
+		}
+		if _, err := db.Exec(`
+			INSERT INTO uploads (id, filename, file_type, size_bytes, sha256, stored_path, status)
+			VALUES ($1, $2, 'markdown', 1, 'abc', $3, $4)`, id, status+".md", files[status], recorded); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleanup, err := cleanUploads(context.Background(), dir, 24*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := map[string]string{}
+	for _, f := range cleanup.Removed {
+		removed[f.Path] = f.Reason
+	}
+	for name, path := range files {
+		_, err := os.Stat(path)
+		if name == "processing" {
+			if err != nil || removed[path] != "" {
+				t.Errorf("Expected the processing upload's file kept, got %v", err)
+			}
+			continue
+		}
+		if !os.IsNotExist(err) || removed[path] != name {
+			t.Errorf("Expected %s removed as %s, got %q (%v)", path, name, removed[path], err)
+		}
+	}
+
+	var status string
+	if err := db.QueryRow(`SELECT status FROM uploads WHERE id = $1`, ids["expired"]).Scan(&status); err != nil || status != "expired" {
+		t.Errorf("Expected the upload of the expired file marked expired, got %q (%v)", status, err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/config"
+)
+
+// Uploads of the same file to a workspace are processed once at a time: the
+// first takes a lock on the file's checksum in Redis until it is done, and
+// uploads of the file arriving meanwhile are answered with 202 and the
+// first upload's file_id, whose status they can poll. The lock expires
+// after UPLOAD_LOCK_TTL should its holder die. Without Redis every upload
+// is processed.
+
+// uploadLocks is the Redis client uploads are locked through, set at
+// startup.
+var uploadLocks *redis.Client
+
+// lockScript takes the lock for ARGV[1] and returns it, or returns the
+// upload holding it.
+var lockScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then return ARGV[1] end
+return redis.call("GET", KEYS[1])
+`)
+
+// unlockScript releases the lock if ARGV[1] still holds it.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end
+return 0
+`)
+
+// inProgressUploadError reports a file an earlier upload to the workspace
+// is still processing.
+type inProgressUploadError struct {
+	// Holder is the ID of the upload processing the file
+	Holder string
+}
+
+func (e *inProgressUploadError) Error() string {
+	return "file is being processed by upload " + e.Holder
+}
+
+func uploadLockKey(u Upload) string {
+	return "file-uploader:upload-lock:" + u.Workspace + ":" + u.SHA256
+}
+
+func uploadLockTTL() time.Duration {
+	ttl, err := time.ParseDuration(config.Env("UPLOAD_LOCK_TTL", "1h"))
+	if err != nil || ttl <= 0 {
+		return time.Hour
+	}
+	return ttl
+}
+
+// lockUpload locks u's file for u, or reports the upload holding the lock
+// as an *inProgressUploadError. Uploads are not held up when Redis is
+// unavailable.
+func lockUpload(ctx context.Context, u Upload) error {
+	if uploadLocks == nil {
+		return nil
+	}
+	holder, err := lockScript.Run(ctx, uploadLocks, []string{uploadLockKey(u)}, u.ID, uploadLockTTL().Milliseconds()).Text()
+	if err != nil {
+		slog.Warn("failed to lock upload", "file_id", u.ID, "error", err)
+		return nil
+	}
+	if holder != u.ID {
+		return &inProgressUploadError{Holder: holder}
+	}
+	return nil
+}
+
+// unlockUpload releases u's lock on its file.
+func unlockUpload(u Upload) {
+	if uploadLocks == nil {
+		return
+	}
+	if err := unlockScript.Run(context.Background(), uploadLocks, []string{uploadLockKey(u)}, u.ID).Err(); err != nil {
+		slog.Warn("failed to unlock upload", "file_id", u.ID, "error", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func useMiniredisLocks(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	uploadLocks = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { uploadLocks = nil })
+	return mr
+}
+
+func TestLockUpload(t *testing.T) {
+	mr := useMiniredisLocks(t)
+	ctx := context.Background()
+	first := Upload{ID: "first", Workspace: "default", SHA256: "abc"}
+	second := Upload{ID: "second", Workspace: "default", SHA256: "abc"}
+
+	if err := lockUpload(ctx, first); err != nil {
+		t.Fatalf("Expected the first upload to take the lock, got %v", err)
+	}
+	var inProgress *inProgressUploadError
+	if err := lockUpload(ctx, second); !errors.As(err, &inProgress) || inProgress.Holder != "first" {
+		t.Fatalf("Expected the second upload to find the first holding the lock, got %v", err)
+	}
+	if err := lockUpload(ctx, Upload{ID: "other", Workspace: "team", SHA256: "abc"}); err != nil {
+		t.Errorf("Expected another workspace's upload of the file to lock on its own, got %v", err)
+	}
+
+	// Only the holder releases the lock
+	unlockUpload(second)
+	if got, _ := mr.Get(uploadLockKey(first)); got != "first" {
+		t.Errorf("Expected the lock kept by first, got %q", got)
+	}
+	unlockUpload(first)
+	if err := lockUpload(ctx, second); err != nil {
+		t.Errorf("Expected the lock free once released, got %v", err)
+	}
+}
+
+func TestLockUploadExpires(t *testing.T) {
+	mr := useMiniredisLocks(t)
+	t.Setenv("UPLOAD_LOCK_TTL", "1m")
+	ctx := context.Background()
+	first := Upload{ID: "first", Workspace: "default", SHA256: "abc"}
+	if err := lockUpload(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(uploadLockKey(first)); ttl != time.Minute {
+		t.Errorf("Expected the lock to expire after UPLOAD_LOCK_TTL, got %s", ttl)
+	}
+	mr.FastForward(time.Minute)
+	if err := lockUpload(ctx, Upload{ID: "second", Workspace: "default", SHA256: "abc"}); err != nil {
+		t.Errorf("Expected an expired lock to be taken over, got %v", err)
+	}
+}
+
+func TestLockUploadWithoutRedis(t *testing.T) {
+	mr := useMiniredisLocks(t)
+	mr.Close()
+	u := Upload{ID: "first", Workspace: "default", SHA256: "abc"}
+	if err := lockUpload(context.Background(), u); err != nil {
+		t.Errorf("Expected uploads to go ahead without Redis, got %v", err)
+	}
+	unlockUpload(u)
+}
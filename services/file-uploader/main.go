@@ -1,29 +1,62 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/google/uuid"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"selin/internal/chunker"
+	"selin/internal/config"
+	"selin/internal/events"
+	"selin/internal/fetch"
+	"selin/internal/flags"
+	"selin/internal/healthcheck"
+	"selin/internal/idempotency"
+	"selin/internal/logging"
+	"selin/internal/storage"
+	"selin/internal/tlsserve"
+	"selin/internal/tokenizer"
 )
 
 type UploadResponse struct {
-	Success        bool     `json:"success"`
-	Message        string   `json:"message"`
-	FileID         string   `json:"file_id,omitempty"`
-	Filename       string   `json:"filename,omitempty"`
-	FileType       string   `json:"file_type,omitempty"`
-	ProcessedItems int      `json:"processed_items,omitempty"`
-	Errors         []string `json:"errors,omitempty"`
+	Success        bool           `json:"success"`
+	Message        string         `json:"message"`
+	FileID         string         `json:"file_id,omitempty"`
+	Filename       string         `json:"filename,omitempty"`
+	FileType       string         `json:"file_type,omitempty"`
+	ProcessedItems int            `json:"processed_items,omitempty"`
+	SkippedItems   int            `json:"skipped_items,omitempty"`  // imported by an earlier upload
+	ExcludedItems  int            `json:"excluded_items,omitempty"` // left out by channel and user rules
+	SHA256         string         `json:"sha256,omitempty"`
+	DryRun         bool           `json:"dry_run,omitempty"`
+	Preview        *UploadPreview `json:"preview,omitempty"`
+	// Transcription is the job transcribing an audio upload
+	Transcription *TranscriptionJob `json:"transcription,omitempty"`
+	// Status is set for uploads left to process, such as one collapsed
+	// into an earlier upload of the same file
+	Status string `json:"status,omitempty"`
+	// Quota is the caller's usage today, when over their quota
+	Quota  *QuotaUsage `json:"quota,omitempty"`
+	Errors []string    `json:"errors,omitempty"`
 }
 
 type SlackMessage struct {
@@ -33,6 +66,12 @@ type SlackMessage struct {
 	Timestamp string `json:"ts"`
 	Channel   string `json:"channel,omitempty"`
 	Thread    string `json:"thread_ts,omitempty"`
+	Files     []struct {
+		Name     string `json:"name"`
+		MimeType string `json:"mimetype"`
+		Size     int64  `json:"size"`
+		URL      string `json:"url_private"`
+	} `json:"files,omitempty"`
 }
 
 type SlackExport struct {
@@ -53,33 +92,138 @@ type SlackChannel struct {
 }
 
 func main() {
-	log.Println("🚀 Starting File Uploader Service...")
+	logging.Setup("file-uploader", "1.0.0")
+	// Fail at startup rather than on first use when the flags, the
+	// tokenizer vocabulary or the event bus are misconfigured
+	flags.Default()
+	tokenizer.Default()
+	events.Default("file-uploader")
+	slog.Info("starting file uploader service")
+
+	// Documents are chunked per content type as configured
+	var err error
+	if chunking, err = chunker.FromEnv(); err != nil {
+		logging.Fatal("failed to load chunking config", "error", err)
+	}
+	setupTranscription()
+	// Pages of bookmarks in priority folders are fetched politely
+	pageOptions := fetch.OptionsFromEnv(os.Getenv("FETCH_USER_AGENT"))
+	pageOptions.Robots = true
+	bookmarkPages = fetch.New("bookmarks", pageOptions)
 
 	// Create upload directory
 	uploadDir := "uploads"
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Fatalf("Failed to create upload directory: %v", err)
+		logging.Fatal("failed to create upload directory", "error", err)
+	}
+
+	// Files left behind by failed uploads, and with a retention all old
+	// files, are cleaned up periodically
+	gcInterval, err := time.ParseDuration(config.Env("UPLOAD_GC_INTERVAL", "6h"))
+	if err != nil || gcInterval < 0 {
+		logging.Fatal("invalid UPLOAD_GC_INTERVAL", "value", os.Getenv("UPLOAD_GC_INTERVAL"))
+	}
+	retention, err := time.ParseDuration(config.Env("UPLOAD_RETENTION", "0"))
+	if err != nil || retention < 0 {
+		logging.Fatal("invalid UPLOAD_RETENTION", "value", os.Getenv("UPLOAD_RETENTION"))
+	}
+	if gcInterval > 0 {
+		go runUploadsCleanup(uploadDir, gcInterval, retention, os.Getenv("UPLOAD_GC_DRY_RUN") == "true")
+	}
+
+	// Uploads are written to local disk, so stop taking them before it fills
+	minFreeMB, err := strconv.Atoi(config.Env("UPLOAD_MIN_FREE_MB", "100"))
+	if err != nil || minFreeMB < 0 {
+		logging.Fatal("invalid UPLOAD_MIN_FREE_MB", "value", os.Getenv("UPLOAD_MIN_FREE_MB"))
+	}
+	readiness := healthcheck.New("file-uploader")
+	readiness.Register(healthcheck.Check{Name: "disk", Probe: healthcheck.DiskSpace(uploadDir, uint64(minFreeMB)<<20)})
+	// Parsed Slack and chat messages are stored as content
+	if storage.Driver() == "postgres" {
+		readiness.Register(healthcheck.Check{Name: "postgres", Probe: healthcheck.SQL(func() (*sql.DB, error) {
+			return sql.Open("postgres", config.PostgresDSN("file-uploader"))
+		})})
 	}
 
 	// Setup routes
 	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/ready", readyHandler)
-	http.HandleFunc("/upload/slack", slackUploadHandler)
-	http.HandleFunc("/upload/file", fileUploadHandler)
-	http.HandleFunc("/upload/chat", chatUploadHandler)
+	http.Handle("/ready", readiness)
+	// Retried uploads carrying an Idempotency-Key get the first response
+	// back instead of being processed twice
+	redisClient := config.RedisClient(config.Env("REDIS_URL", "localhost:6379"))
+	idempotencyTTL, err := time.ParseDuration(config.Env("IDEMPOTENCY_TTL", idempotency.DefaultTTL.String()))
+	if err != nil || idempotencyTTL <= 0 {
+		logging.Fatal("invalid IDEMPOTENCY_TTL", "value", os.Getenv("IDEMPOTENCY_TTL"))
+	}
+	idempotent := idempotency.New(redisClient, "file-uploader", idempotencyTTL)
+	uploadLocks = redisClient
+	readiness.Register(healthcheck.Check{Name: "redis", Probe: healthcheck.Redis(redisClient), Optional: true})
+
+	// Uploads need a key once keys are configured, and count towards the
+	// caller's daily quota
+	quota, err := uploadQuotaFromEnv()
+	if err != nil {
+		logging.Fatal("invalid upload quota", "error", err)
+	}
+	if quota != (uploadQuota{}) && storage.Driver() != "postgres" {
+		logging.Fatal("upload quotas are counted in Postgres: unset UPLOAD_DAILY_QUOTA_MB and UPLOAD_DAILY_QUOTA_ITEMS or use Postgres storage",
+			"storage", storage.Driver())
+	}
+	if config.Secret("UPLOAD_API_KEYS") == "" && config.Secret("UPLOADER_TOKEN") == "" {
+		slog.Warn("uploads are not authenticated: set UPLOAD_API_KEYS or UPLOADER_TOKEN")
+	}
+	guarded := func(h http.HandlerFunc) http.Handler {
+		return uploadGuard(quota, idempotent.Middleware(h))
+	}
+	http.Handle("/upload/slack", guarded(slackUploadHandler))
+	http.Handle("/upload/file", guarded(fileUploadHandler))
+	http.Handle("/upload/chat", guarded(chatUploadHandler))
+	http.Handle("/upload/bookmarks", guarded(bookmarkUploadHandler))
+	http.Handle("/ingest/repo", guarded(repoIngestHandler))
+	http.Handle("/uploads/", uploadGuard(quota, http.HandlerFunc(uploadsHandler)))
+	http.HandleFunc("/admin/users/", userUploadsHandler)
+	http.HandleFunc("/status", statusHandler)
+	http.HandleFunc("/admin/uploads/cleanup", uploadsCleanupHandler(retention))
+	http.Handle("/metrics", promhttp.Handler())
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8083"
 	}
 
-	log.Printf("📁 File uploader service starting on port %s", port)
-	log.Printf("🔗 Upload endpoints:")
-	log.Printf("  • Slack export: POST http://localhost:%s/upload/slack", port)
-	log.Printf("  • General files: POST http://localhost:%s/upload/file", port)
-	log.Printf("  • Chat exports: POST http://localhost:%s/upload/chat", port)
+	slog.Info("file uploader service starting", "port", port,
+		"endpoints", []string{"/upload/slack", "/upload/file", "/upload/chat", "/upload/bookmarks", "/ingest/repo", "/uploads/{id}/download"})
+
+	tlsConfig := tlsserve.FromEnv()
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: logging.Middleware(tlsConfig.HSTS(http.DefaultServeMux)),
+	}
+
+	// Graceful shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	go func() {
+		if err := tlsserve.ListenAndServe(server, tlsConfig); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("server failed to start", "error", err)
+		}
+	}()
+
+	<-stop
+	slog.Info("shutting down file uploader service")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("server forced to shutdown", "error", err)
+	}
+	// Send what was announced last before leaving
+	if err := events.Flush(ctx); err != nil {
+		slog.Warn("gave up on announcements still being sent", "error", err)
+	}
+
+	slog.Info("file uploader service stopped")
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -89,14 +233,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		"timestamp": time.Now(),
 		"service":   "file-uploader",
 		"version":   "1.0.0",
-	})
-}
-
-func readyHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":    "READY",
-		"timestamp": time.Now(),
+		"flags":     flags.Default().Rules(),
 	})
 }
 
@@ -106,13 +243,25 @@ func slackUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("📤 Processing Slack export upload...")
+	upload, ctx := startUpload(r, "slack")
+	defer upload.done()
+	logging.FromContext(ctx).Info("processing slack export upload")
 
 	// Parse multipart form (32MB max)
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
+	stop := upload.stages.time("receive")
+	err := r.ParseMultipartForm(32 << 20)
+	stop()
+	if err != nil {
 		respondWithError(w, "Failed to parse form", err)
 		return
 	}
+	ctx = withDryRun(ctx, r)
+	overrides, err := uploadOverridesFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid tags, topic, min_relevance or author_override", err)
+		return
+	}
+	ctx = withOverrides(ctx, overrides)
 
 	file, handler, err := r.FormFile("file")
 	if err != nil {
@@ -121,43 +270,82 @@ func slackUploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	log.Printf("📁 Received file: %s (size: %d bytes)", handler.Filename, handler.Size)
+	logging.FromContext(ctx).Info("received file", "filename", handler.Filename, "size", handler.Size)
+	upload.received(handler.Size, "slack_export")
 
 	// Validate file type
 	if !isValidSlackFile(handler.Filename) {
 		respondWithError(w, "Invalid file type. Expected .json or .zip file", nil)
 		return
 	}
-
-	// Save file
-	fileID := uuid.New().String()
-	savedPath, err := saveUploadedFile(file, handler, fileID)
+	filter, err := slackFilterFromForm(r)
 	if err != nil {
-		respondWithError(w, "Failed to save file", err)
+		respondWithError(w, "Invalid channel or user rules", err)
 		return
 	}
 
-	// Process Slack export
-	processedItems, processingErrors := processSlackFile(savedPath, handler.Filename)
+	workspace := requestWorkspace(r)
+	if previewFrom(ctx) != nil {
+		previewSlackUpload(ctx, w, upload, file, handler, workspace, filter, r.FormValue("full") == "true")
+		return
+	}
+
+	// Save file
+	stop = upload.stages.time("save")
+	stored, finish, err := saveUpload(ctx, file, handler, "slack_export", workspace, r.Header.Get("X-User-ID"))
+	stop()
+	if respondSaveError(w, err) {
+		return
+	}
+	defer finish()
+	fileID, savedPath := stored.ID, stored.path
+
+	// Process Slack export, leaving out the channels and users excluded
+	// and, unless full=true, the messages an earlier upload imported
+	var processedItems, skippedItems int
+	var processingErrors []string
+	msgs, err := readSlackFile(ctx, savedPath, handler.Filename)
+	var preview SlackPreview
+	if err != nil {
+		processingErrors = []string{err.Error()}
+	} else {
+		msgs, preview = filter.apply(msgs)
+		if r.FormValue("full") != "true" {
+			msgs, skippedItems = newSlackMessages(ctx, workspace, msgs)
+		}
+		processedItems, processingErrors = storeMessages(ctx, workspace, "slack", msgs)
+		recordUploadResult(ctx, fileID, processedItems, processingErrors)
+		// A failed message is retried by the next import only if the
+		// marks stay where they were
+		if len(processingErrors) == 0 {
+			markSlackImported(ctx, workspace, msgs)
+		}
+	}
+	upload.finished(processingErrors)
 
 	response := UploadResponse{
 		Success:        len(processingErrors) == 0,
-		Message:        fmt.Sprintf("Processed %d items from Slack export", processedItems),
+		Message:        fmt.Sprintf("Processed %d new items from Slack export, skipped %d imported before", processedItems, skippedItems),
 		FileID:         fileID,
 		Filename:       handler.Filename,
 		FileType:       "slack_export",
 		ProcessedItems: processedItems,
+		SHA256:         stored.SHA256,
+		SkippedItems:   skippedItems,
+		ExcludedItems:  preview.excluded(),
 		Errors:         processingErrors,
 	}
 
 	if len(processingErrors) > 0 {
 		response.Message = fmt.Sprintf("Processed %d items with %d errors", processedItems, len(processingErrors))
+	} else if processedItems > 0 {
+		announceUpload(ContentEvent{ID: fileID, Workspace: workspace, Platform: "slack", Filename: handler.Filename, Items: processedItems})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 
-	log.Printf("✅ Slack export processed: %d items, %d errors", processedItems, len(processingErrors))
+	logging.FromContext(ctx).Info("slack export processed", "items", processedItems, "errors", len(processingErrors))
 }
 
 func fileUploadHandler(w http.ResponseWriter, r *http.Request) {
@@ -166,13 +354,25 @@ func fileUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("📤 Processing general file upload...")
+	upload, ctx := startUpload(r, "file")
+	defer upload.done()
+	logging.FromContext(ctx).Info("processing file upload")
 
 	// Parse multipart form
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
+	stop := upload.stages.time("receive")
+	err := r.ParseMultipartForm(32 << 20)
+	stop()
+	if err != nil {
 		respondWithError(w, "Failed to parse form", err)
 		return
 	}
+	ctx = withDryRun(ctx, r)
+	overrides, err := uploadOverridesFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid tags, topic, min_relevance or author_override", err)
+		return
+	}
+	ctx = withOverrides(ctx, overrides)
 
 	file, handler, err := r.FormFile("file")
 	if err != nil {
@@ -181,25 +381,73 @@ func fileUploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	log.Printf("📁 Received file: %s (size: %d bytes)", handler.Filename, handler.Size)
+	logging.FromContext(ctx).Info("received file", "filename", handler.Filename, "size", handler.Size)
 
 	// Validate file type
 	fileType := detectFileType(handler.Filename)
+	upload.received(handler.Size, fileType)
 	if fileType == "unsupported" {
-		respondWithError(w, "Unsupported file type. Expected: .md, .txt, .pdf, .json", nil)
+		respondWithError(w, "Unsupported file type. Expected: .md, .txt, .html, .pdf, .json, .mp3, .m4a", nil)
+		return
+	}
+	if fileType == "audio" && transcriber == nil {
+		respondWithError(w, "Audio uploads need a transcription backend (TRANSCRIBE_BACKEND)", nil)
+		return
+	}
+	terms, err := documentTermsFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid visibility or license", err)
 		return
 	}
 
 	// Save file
-	fileID := uuid.New().String()
-	savedPath, err := saveUploadedFile(file, handler, fileID)
-	if err != nil {
-		respondWithError(w, "Failed to save file", err)
+	workspace := requestWorkspace(r)
+	stop = upload.stages.time("save")
+	stored, finish, err := saveUpload(ctx, file, handler, fileType, workspace, r.Header.Get("X-User-ID"))
+	stop()
+	if respondSaveError(w, err) {
+		return
+	}
+	defer finish()
+	fileID, savedPath := stored.ID, stored.path
+
+	// Audio is transcribed in the background, which a dry run has
+	// nothing to show of
+	if fileType == "audio" && previewFrom(ctx) != nil {
+		upload.finished(nil)
+		response := UploadResponse{Success: true, Message: "Would store the audio and queue its transcription", Filename: handler.Filename, FileType: fileType, SHA256: stored.SHA256}
+		dryRunResponse(ctx, &response)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if fileType == "audio" {
+		job, err := queueTranscription(ctx, savedPath, handler.Filename, fileID, workspace, terms)
+		if err != nil {
+			recordUploadResult(ctx, fileID, 0, []string{err.Error()})
+			respondWithError(w, "Failed to queue transcription", err)
+			return
+		}
+		upload.finished(nil)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(UploadResponse{
+			Success:       true,
+			Message:       "Audio stored, transcription queued",
+			FileID:        fileID,
+			Filename:      handler.Filename,
+			FileType:      fileType,
+			SHA256:        stored.SHA256,
+			Transcription: job,
+		})
+		logging.FromContext(ctx).Info("transcription queued", "file_id", fileID)
 		return
 	}
 
 	// Process file based on type
-	processedItems, processingErrors := processFile(savedPath, fileType, handler.Filename)
+	processedItems, processingErrors := processFile(ctx, savedPath, fileType, handler.Filename, fileID, workspace, terms)
+	recordUploadResult(ctx, fileID, processedItems, processingErrors)
+	upload.finished(processingErrors)
 
 	response := UploadResponse{
 		Success:        len(processingErrors) == 0,
@@ -208,13 +456,18 @@ func fileUploadHandler(w http.ResponseWriter, r *http.Request) {
 		Filename:       handler.Filename,
 		FileType:       fileType,
 		ProcessedItems: processedItems,
+		SHA256:         stored.SHA256,
 		Errors:         processingErrors,
 	}
 
+	if !dryRunResponse(ctx, &response) && response.Success && processedItems > 0 {
+		announceUpload(ContentEvent{ID: fileID, Workspace: workspace, Platform: "file_upload", Tags: []string{fileType}, Filename: handler.Filename, Items: processedItems})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 
-	log.Printf("✅ File processed: %s (%d items, %d errors)", fileType, processedItems, len(processingErrors))
+	logging.FromContext(ctx).Info("file processed", "file_type", fileType, "items", processedItems, "errors", len(processingErrors))
 }
 
 func chatUploadHandler(w http.ResponseWriter, r *http.Request) {
@@ -223,13 +476,25 @@ func chatUploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("📤 Processing chat export upload...")
+	upload, ctx := startUpload(r, "chat")
+	defer upload.done()
+	logging.FromContext(ctx).Info("processing chat export upload")
 
 	// Parse multipart form
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
+	stop := upload.stages.time("receive")
+	err := r.ParseMultipartForm(32 << 20)
+	stop()
+	if err != nil {
 		respondWithError(w, "Failed to parse form", err)
 		return
 	}
+	ctx = withDryRun(ctx, r)
+	overrides, err := uploadOverridesFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid tags, topic, min_relevance or author_override", err)
+		return
+	}
+	ctx = withOverrides(ctx, overrides)
 
 	file, handler, err := r.FormFile("file")
 	if err != nil {
@@ -244,17 +509,27 @@ func chatUploadHandler(w http.ResponseWriter, r *http.Request) {
 		platform = "unknown"
 	}
 
-	log.Printf("📱 Processing %s chat export: %s", platform, handler.Filename)
+	logging.FromContext(ctx).Info("received chat export", "platform", platform, "filename", handler.Filename)
+	if chatPlatforms[platform] {
+		upload.received(handler.Size, platform+"_chat")
+	} else {
+		upload.received(handler.Size, "other_chat")
+	}
 
 	// Save and process
-	fileID := uuid.New().String()
-	savedPath, err := saveUploadedFile(file, handler, fileID)
-	if err != nil {
-		respondWithError(w, "Failed to save file", err)
+	workspace := requestWorkspace(r)
+	stop = upload.stages.time("save")
+	stored, finish, err := saveUpload(ctx, file, handler, platform+"_chat", workspace, r.Header.Get("X-User-ID"))
+	stop()
+	if respondSaveError(w, err) {
 		return
 	}
+	defer finish()
+	fileID, savedPath := stored.ID, stored.path
 
-	processedItems, processingErrors := processChatFile(savedPath, platform, handler.Filename)
+	processedItems, processingErrors := processChatFile(ctx, workspace, savedPath, platform, handler.Filename)
+	recordUploadResult(ctx, fileID, processedItems, processingErrors)
+	upload.finished(processingErrors)
 
 	response := UploadResponse{
 		Success:        len(processingErrors) == 0,
@@ -263,13 +538,18 @@ func chatUploadHandler(w http.ResponseWriter, r *http.Request) {
 		Filename:       handler.Filename,
 		FileType:       fmt.Sprintf("%s_chat", platform),
 		ProcessedItems: processedItems,
+		SHA256:         stored.SHA256,
 		Errors:         processingErrors,
 	}
 
+	if !dryRunResponse(ctx, &response) && response.Success && processedItems > 0 {
+		announceUpload(ContentEvent{ID: fileID, Workspace: workspace, Platform: platform, Filename: handler.Filename, Items: processedItems})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 
-	log.Printf("✅ Chat export processed: %s (%d messages, %d errors)", platform, processedItems, len(processingErrors))
+	logging.FromContext(ctx).Info("chat export processed", "platform", platform, "messages", processedItems, "errors", len(processingErrors))
 }
 
 func isValidSlackFile(filename string) bool {
@@ -284,110 +564,88 @@ func detectFileType(filename string) string {
 		return "markdown"
 	case ".txt":
 		return "text"
+	case ".html", ".htm":
+		return "html"
 	case ".pdf":
 		return "pdf"
 	case ".json":
 		return "json"
+	case ".mp3", ".m4a":
+		return "audio"
 	default:
 		return "unsupported"
 	}
 }
 
-func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, fileID string) (string, error) {
-	// Create safe filename
+var workspacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// requestWorkspace is the workspace the gateway resolved for the caller.
+// Uploads without one, or with a malformed one, go to the default workspace.
+func requestWorkspace(r *http.Request) string {
+	if ws := r.Header.Get("X-Workspace-ID"); workspacePattern.MatchString(ws) {
+		return ws
+	}
+	return "default"
+}
+
+// saveUploadedFile writes the file to the upload disk, returning where it
+// was saved, its size and its SHA-256 in hex.
+func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, fileID, workspace string) (string, int64, string, error) {
+	// Create safe filename, keeping each workspace's uploads apart
 	ext := filepath.Ext(handler.Filename)
 	safeName := fmt.Sprintf("%s_%s%s", fileID, time.Now().Format("20060102_150405"), ext)
-	savedPath := filepath.Join("uploads", safeName)
+	dir := filepath.Join("uploads", workspace)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, "", err
+	}
+	savedPath := filepath.Join(dir, safeName)
 
 	// Create destination file
 	dst, err := os.Create(savedPath)
 	if err != nil {
-		return "", err
+		return "", 0, "", err
 	}
 	defer dst.Close()
 
-	// Copy file data
-	_, err = io.Copy(dst, file)
+	// Copy file data, hashing it on the way
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash), file)
 	if err != nil {
-		return "", err
+		os.Remove(savedPath)
+		return "", 0, "", err
 	}
 
-	return savedPath, nil
-}
-
-func processSlackFile(filePath, filename string) (int, []string) {
-	log.Printf("🔄 Processing Slack file: %s", filename)
-
-	// TODO: Implement actual Slack export processing
-	// This would:
-	// 1. Parse JSON/ZIP file
-	// 2. Extract messages, users, channels
-	// 3. Store in PostgreSQL content_metadata table
-	// 4. Generate embeddings for messages
-
-	// For now, simulate processing
-	processedItems := 42 // Simulated number of messages
-	errors := []string{} // No errors for now
-
-	log.Printf("📊 Simulated processing: %d Slack messages extracted", processedItems)
-
-	return processedItems, errors
+	return savedPath, size, hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func processFile(filePath, fileType, filename string) (int, []string) {
-	log.Printf("🔄 Processing %s file: %s", fileType, filename)
-
-	// TODO: Implement actual file processing based on type
-	// This would:
-	// 1. Parse file content
-	// 2. Extract text/metadata
-	// 3. Store in database
-	// 4. Generate embeddings
+// processFile stores an uploaded file as content, returning how many
+// items it was split into.
+func processFile(ctx context.Context, filePath, fileType, filename, fileID, workspace string, terms documentTerms) (int, []string) {
+	slog.Debug("processing file", "file_type", fileType, "filename", filename)
+	if fileType == "markdown" || fileType == "text" || fileType == "html" {
+		return storeDocument(ctx, filePath, fileType, filename, fileID, workspace, terms)
+	}
 
-	// For now, simulate processing
+	// TODO: Extract the text of PDF and JSON files and chunk it like
+	// documents. For now, simulate processing
+	defer stagesFrom(ctx).time("parse")()
 	processedItems := 1
 	errors := []string{}
 
 	switch fileType {
-	case "markdown":
-		processedItems = 5 // Simulated sections
 	case "pdf":
 		processedItems = 10 // Simulated pages
 	case "json":
 		processedItems = 15 // Simulated objects
 	}
 
-	log.Printf("📊 Simulated processing: %d items extracted from %s", processedItems, fileType)
-
-	return processedItems, errors
-}
-
-func processChatFile(filePath, platform, filename string) (int, []string) {
-	log.Printf("🔄 Processing %s chat file: %s", platform, filename)
-
-	// TODO: Implement actual chat processing
-	// Support for WhatsApp, Telegram, Discord, etc.
-
-	// Simulate processing based on platform
-	processedItems := 100 // Simulated messages
-	errors := []string{}
-
-	if platform == "whatsapp" {
-		processedItems = 200
-	} else if platform == "discord" {
-		processedItems = 150
-	}
-
-	log.Printf("📊 Simulated processing: %d messages from %s", processedItems, platform)
+	slog.Debug("simulated processing", "filename", filename, "items", processedItems)
 
 	return processedItems, errors
 }
 
 func respondWithError(w http.ResponseWriter, message string, err error) {
-	log.Printf("❌ Error: %s", message)
-	if err != nil {
-		log.Printf("❌ Details: %v", err)
-	}
+	slog.Warn("upload failed", "reason", message, "error", err)
 
 	response := UploadResponse{
 		Success: false,
@@ -399,7 +657,13 @@ func respondWithError(w http.ResponseWriter, message string, err error) {
 		response.Errors = append(response.Errors, err.Error())
 	}
 
+	status := http.StatusBadRequest
+	// The body went over the bytes its quota left it
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		status = http.StatusRequestEntityTooLarge
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	uploadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "uploader_uploads_total",
+			Help: "Total number of uploads by endpoint, file type and outcome (success, partial or failed)",
+		},
+		[]string{"endpoint", "type", "status"},
+	)
+
+	receivedBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "uploader_received_bytes_total",
+			Help: "Total size of the files uploaded, by endpoint",
+		},
+		[]string{"endpoint"},
+	)
+
+	stageDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "uploader_stage_duration_seconds",
+			Help:    "Time spent on each stage of processing an upload: receive, save, unzip, parse, insert and attach",
+			Buckets: prometheus.ExponentialBuckets(0.01, 3, 10),
+		},
+		[]string{"stage"},
+	)
+
+	uploadsInProgress = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "uploader_uploads_in_progress",
+			Help: "Number of uploads currently being received or processed",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(uploadsTotal)
+	prometheus.MustRegister(receivedBytes)
+	prometheus.MustRegister(stageDuration)
+	prometheus.MustRegister(uploadsInProgress)
+}
+
+// chatPlatforms are the platform labels chat uploads are counted under;
+// any other platform form value is counted as "other".
+var chatPlatforms = map[string]bool{"telegram": true, "discord": true, "whatsapp": true}
+
+// stages adds up the time one upload spends in each stage. Parsing a zip
+// export alternates between unzipping and parsing its files, so a stage
+// may be timed many times before the total is observed.
+type stages map[string]time.Duration
+
+// time starts timing stage, returning the function that stops it.
+func (s stages) time(stage string) func() {
+	start := time.Now()
+	return func() { s[stage] += time.Since(start) }
+}
+
+type stagesKey struct{}
+
+// stagesFrom returns the stages of the upload ctx belongs to, or stages
+// nobody observes outside of one.
+func stagesFrom(ctx context.Context) stages {
+	if s, ok := ctx.Value(stagesKey{}).(stages); ok {
+		return s
+	}
+	return stages{}
+}
+
+// uploadRecord collects the metrics of one upload, recorded by done.
+type uploadRecord struct {
+	endpoint  string
+	fileType  string
+	bytes     int64
+	processed bool
+	errors    int
+	stages    stages
+}
+
+// startUpload counts an upload to endpoint as in progress until done is
+// called. Its stages are timed through the returned context.
+func startUpload(r *http.Request, endpoint string) (*uploadRecord, context.Context) {
+	uploadsInProgress.Inc()
+	u := &uploadRecord{endpoint: endpoint, fileType: "unknown", stages: stages{}}
+	return u, context.WithValue(r.Context(), stagesKey{}, u.stages)
+}
+
+// received records the uploaded file's size and type.
+func (u *uploadRecord) received(size int64, fileType string) {
+	u.bytes = size
+	u.fileType = fileType
+	receivedBytes.WithLabelValues(u.endpoint).Add(float64(size))
+}
+
+// finished records that the file was processed with errs item errors.
+func (u *uploadRecord) finished(errs []string) {
+	u.processed = true
+	u.errors = len(errs)
+}
+
+func (u *uploadRecord) done() {
+	uploadsInProgress.Dec()
+	status := "failed"
+	if u.processed {
+		status = "success"
+		if u.errors > 0 {
+			status = "partial"
+		}
+	}
+	uploadsTotal.WithLabelValues(u.endpoint, u.fileType, status).Inc()
+	for stage, d := range u.stages {
+		stageDuration.WithLabelValues(stage).Observe(d.Seconds())
+	}
+}
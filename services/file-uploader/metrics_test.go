@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// stageCount returns how many times stage was observed.
+func stageCount(t *testing.T, stage string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := stageDuration.WithLabelValues(stage).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestUploadRecord(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		processed bool
+		errs      []string
+		status    string
+	}{
+		{"success", true, nil, "success"},
+		{"partial", true, []string{"line 3: invalid"}, "partial"},
+		{"failed", false, nil, "failed"},
+	} {
+		endpoint := "test-" + tt.name
+		total := uploadsTotal.WithLabelValues(endpoint, "md", tt.status)
+		parsed := stageCount(t, "parse")
+
+		u, ctx := startUpload(httptest.NewRequest("POST", "/upload", nil), endpoint)
+		if got := testutil.ToFloat64(uploadsInProgress); got != 1 {
+			t.Errorf("%s: expected the upload in progress, got %v", tt.name, got)
+		}
+		u.received(2048, "md")
+		// Stages timed more than once are observed once, added up
+		stagesFrom(ctx).time("parse")()
+		stagesFrom(ctx).time("parse")()
+		if tt.processed {
+			u.finished(tt.errs)
+		}
+		u.done()
+
+		if got := testutil.ToFloat64(uploadsInProgress); got != 0 {
+			t.Errorf("%s: expected no uploads in progress once done, got %v", tt.name, got)
+		}
+		if got := testutil.ToFloat64(total); got != 1 {
+			t.Errorf("%s: expected the upload counted as %s, got %v", tt.name, tt.status, got)
+		}
+		if got := testutil.ToFloat64(receivedBytes.WithLabelValues(endpoint)); got != 2048 {
+			t.Errorf("%s: expected 2048 bytes received, got %v", tt.name, got)
+		}
+		if got := stageCount(t, "parse") - parsed; got != 1 {
+			t.Errorf("%s: expected parse observed once, got %d", tt.name, got)
+		}
+	}
+}
+
+func TestStagesFromOutsideUpload(t *testing.T) {
+	ctx := httptest.NewRequest("GET", "/", nil).Context()
+	stagesFrom(ctx).time("parse")()
+	if s := stagesFrom(ctx); len(s) != 0 {
+		t.Errorf("Expected stages outside of an upload to go unobserved, got %v", s)
+	}
+}
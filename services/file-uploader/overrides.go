@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"selin/internal/pipeline"
+	"selin/internal/storage"
+	"selin/internal/tagging"
+)
+
+// maxOverrideTags bounds the tags an upload gives its items.
+const maxOverrideTags = 20
+
+// uploadOverrides are what every item of an upload gets on top of what its
+// file says, from the upload's tags, topic, min_relevance and
+// author_override form fields. Conference notes uploaded with
+// topic=kubernetes, for one, are not left untagged.
+type uploadOverrides struct {
+	// Tags are added to each item's own
+	Tags []string
+	// Topic is added as a tag too, and its learning progress is tracked
+	Topic string
+	// MinRelevance raises lower relevance scores to it
+	MinRelevance float64
+	// Author replaces each item's author
+	Author string
+}
+
+func uploadOverridesFromForm(r *http.Request) (uploadOverrides, error) {
+	o := uploadOverrides{
+		Topic:  tagging.Normalize(r.FormValue("topic")),
+		Author: strings.TrimSpace(r.FormValue("author_override")),
+	}
+	for _, tag := range strings.Split(r.FormValue("tags"), ",") {
+		if tag = tagging.Normalize(tag); tag != "" {
+			o.Tags = append(o.Tags, tag)
+		}
+	}
+	if len(o.Tags) > maxOverrideTags {
+		return o, fmt.Errorf("at most %d tags", maxOverrideTags)
+	}
+	if v := strings.TrimSpace(r.FormValue("min_relevance")); v != "" {
+		score, err := strconv.ParseFloat(v, 64)
+		if err != nil || score < 0 || score > 1 {
+			return o, fmt.Errorf("min_relevance must be between 0 and 1")
+		}
+		o.MinRelevance = score
+	}
+	if len(o.Author) > 200 {
+		return o, fmt.Errorf("author_override must be at most 200 characters")
+	}
+	return o, nil
+}
+
+type overridesKey struct{}
+
+// withOverrides returns ctx carrying the upload's overrides to the items
+// it is stored through.
+func withOverrides(ctx context.Context, o uploadOverrides) context.Context {
+	return context.WithValue(ctx, overridesKey{}, o)
+}
+
+func overridesFrom(ctx context.Context) uploadOverrides {
+	o, _ := ctx.Value(overridesKey{}).(uploadOverrides)
+	return o
+}
+
+// apply adds the overrides' stages to p: tags and author ahead of the tag
+// aliases and author reputation, so both apply to them, and the relevance
+// floor ahead of the store, after reputation weighed the score.
+func (o uploadOverrides) apply(p *pipeline.Pipeline) *pipeline.Pipeline {
+	if len(o.Tags) > 0 || o.Topic != "" || o.Author != "" {
+		p.Before("tag_aliases", pipeline.Stage{Name: "upload_overrides", Run: func(ctx context.Context, item *pipeline.ContentItem) error {
+			tags := item.Tags
+			if o.Topic != "" {
+				tags = append(tags, o.Topic)
+			}
+			item.Tags = tagging.Aliases(nil).Apply(append(tags, o.Tags...))
+			if o.Author != "" {
+				item.Author = o.Author
+			}
+			return nil
+		}})
+	}
+	if o.MinRelevance > 0 {
+		p.Before("store", pipeline.Stage{Name: "min_relevance", Run: func(ctx context.Context, item *pipeline.ContentItem) error {
+			item.RelevanceScore = math.Max(item.RelevanceScore, o.MinRelevance)
+			return nil
+		}})
+	}
+	return p
+}
+
+// trackTopic starts tracking learning progress on the upload's topic.
+func (o uploadOverrides) trackTopic(ctx context.Context, store storage.Store, workspace string) {
+	if o.Topic == "" {
+		return
+	}
+	if err := store.TrackTopic(ctx, workspace, o.Topic); err != nil {
+		slog.Warn("failed to track upload topic", "topic", o.Topic, "error", err)
+	}
+}
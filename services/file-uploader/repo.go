@@ -0,0 +1,710 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"selin/internal/chunker"
+	"selin/internal/config"
+	"selin/internal/logging"
+	"selin/internal/pipeline"
+	"selin/internal/storage"
+	"selin/internal/tokenizer"
+)
+
+const (
+	// maxRepoFiles caps the files stored from one repository.
+	maxRepoFiles = 2000
+	// maxRepoFileSize is the largest file read; larger ones are usually
+	// generated or data.
+	maxRepoFileSize = 1 << 20
+)
+
+// maxRepoSize caps what an archive unpacks to.
+var maxRepoSize int64 = 500 << 20
+
+// gitCommand clones repositories given by URL; without it only archives
+// can be ingested.
+var gitCommand = config.Env("GIT_COMMAND", "git")
+
+// skippedRepoDirs are directories of dependencies, build output and tool
+// state rather than the project's own files.
+var skippedRepoDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "third_party": true, "dist": true, "build": true,
+	"target": true, "out": true, "bin": true, "obj": true, "__pycache__": true, "venv": true,
+}
+
+// repoIngestHandler stores a source code repository's documentation and
+// code comments, and with symbols=true its functions and types, as
+// content. The repository is a git URL to clone (the url field, with an
+// optional ref) or an uploaded .zip or .tar.gz archive (the file field).
+func repoIngestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upload, ctx := startUpload(r, "repo")
+	defer upload.done()
+	logging.FromContext(ctx).Info("processing repository ingestion")
+
+	stop := upload.stages.time("receive")
+	err := r.ParseMultipartForm(32 << 20)
+	stop()
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		respondWithError(w, "Failed to parse form", err)
+		return
+	}
+	terms, err := documentTermsFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid visibility or license", err)
+		return
+	}
+	symbols := r.FormValue("symbols") == "true"
+	workspace := requestWorkspace(r)
+	ctx = withDryRun(ctx, r)
+	overrides, err := uploadOverridesFromForm(r)
+	if err != nil {
+		respondWithError(w, "Invalid tags, topic, min_relevance or author_override", err)
+		return
+	}
+	ctx = withOverrides(ctx, overrides)
+
+	dir, err := os.MkdirTemp("", "repo-*")
+	if err != nil {
+		respondWithError(w, "Failed to create a working directory", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var fileID, filename string
+	name := r.FormValue("name")
+	if repoURL := strings.TrimSpace(r.FormValue("url")); repoURL != "" {
+		if _, err := exec.LookPath(gitCommand); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotImplemented)
+			json.NewEncoder(w).Encode(UploadResponse{Message: "Cloning needs git; upload an archive instead", Errors: []string{err.Error()}})
+			return
+		}
+		upload.received(0, "repository")
+		stop = upload.stages.time("save")
+		err = cloneRepo(ctx, repoURL, r.FormValue("ref"), dir)
+		stop()
+		if err != nil {
+			respondWithError(w, "Failed to clone repository", err)
+			return
+		}
+		// Tokens in the URL stay out of the response
+		filename = repoURL
+		if u, err := url.Parse(repoURL); err == nil {
+			filename = u.Redacted()
+		}
+		if name == "" {
+			name = repoName(repoURL)
+		}
+	} else {
+		file, handler, err := r.FormFile("file")
+		if err != nil {
+			respondWithError(w, "No repository URL or archive provided", err)
+			return
+		}
+		defer file.Close()
+		upload.received(handler.Size, "repository")
+		if archiveType(handler.Filename) == "" {
+			respondWithError(w, "Unsupported archive type. Expected: .zip, .tar.gz, .tgz", nil)
+			return
+		}
+
+		stop = upload.stages.time("save")
+		stored, finish, err := saveUpload(ctx, file, handler, "repository", workspace, r.Header.Get("X-User-ID"))
+		stop()
+		if respondSaveError(w, err) {
+			return
+		}
+		defer finish()
+		stop = upload.stages.time("unzip")
+		err = extractArchive(stored.path, handler.Filename, dir)
+		stop()
+		if err != nil {
+			respondWithError(w, "Failed to unpack archive", err)
+			return
+		}
+		fileID, filename = stored.ID, handler.Filename
+		if name == "" {
+			name = repoName(handler.Filename)
+		}
+	}
+	name = sanitizeRepoName(name)
+
+	stored, skipped, processingErrors := storeRepo(ctx, workspace, name, repoRoot(dir), symbols, terms)
+	recordUploadResult(ctx, fileID, stored, processingErrors)
+	upload.finished(processingErrors)
+
+	response := UploadResponse{
+		Success:        len(processingErrors) == 0,
+		Message:        fmt.Sprintf("Ingested repository %s with %d files", name, stored),
+		FileID:         fileID,
+		Filename:       filename,
+		FileType:       "repository",
+		ProcessedItems: stored,
+		SkippedItems:   skipped,
+		Errors:         processingErrors,
+	}
+	if !dryRunResponse(ctx, &response) && response.Success && stored > 0 {
+		announceUpload(ContentEvent{ID: firstNonEmpty(fileID, "repo://"+name), Workspace: workspace, Platform: "repository", Tags: []string{name}, Filename: filename, Items: stored})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logging.FromContext(ctx).Info("repository ingested", "repository", name, "files", stored, "skipped", skipped, "errors", len(processingErrors))
+}
+
+// cloneRepo makes a shallow clone of an http(s) repository URL into dir.
+// Other transports are refused: file:// and ext:: would reach into the
+// host.
+func cloneRepo(ctx context.Context, repoURL, ref, dir string) error {
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("repository URL must be http or https")
+	}
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	timeout, err := time.ParseDuration(config.Env("REPO_CLONE_TIMEOUT", "5m"))
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := []string{"-c", "protocol.allow=never", "-c", "protocol.https.allow=always", "-c", "protocol.http.allow=always",
+		"clone", "--depth=1", "--single-branch", "--no-tags"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	cmd := exec.CommandContext(ctx, gitCommand, append(args, "--", repoURL, dir)...)
+	// Never wait on a password prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// repoName is the repository's name from its URL or archive file name.
+func repoName(source string) string {
+	name := path.Base(strings.TrimRight(source, "/"))
+	for _, ext := range []string{".git", ".zip", ".tar.gz", ".tgz"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+var repoNameUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// sanitizeRepoName makes name safe to use in source URLs and as a tag.
+func sanitizeRepoName(name string) string {
+	name = strings.Trim(repoNameUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+	if name == "" {
+		return "repository"
+	}
+	return name
+}
+
+func archiveType(filename string) string {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	}
+	return ""
+}
+
+// extractArchive unpacks a .zip or .tar.gz into dir. Links and entries
+// that would land outside dir are skipped, and unpacking stops at
+// maxRepoSize.
+func extractArchive(archivePath, filename, dir string) error {
+	total := int64(0)
+	write := func(name string, r io.Reader) error {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		f, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(f, io.LimitReader(r, maxRepoSize-total+1))
+		if total += n; total > maxRepoSize {
+			return fmt.Errorf("archive unpacks to more than %d MB", maxRepoSize>>20)
+		}
+		return err
+	}
+
+	if archiveType(filename) == "zip" {
+		archive, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		for _, f := range archive.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = write(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := write(h.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// repoRoot is the directory the repository's files are in: archives made
+// by GitHub and git archive --prefix hold a single top directory.
+func repoRoot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() || entries[0].Name() == ".git" {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
+
+// storeRepo stores the documentation and source files under root as
+// content, returning how many were stored and how many were already.
+func storeRepo(ctx context.Context, workspace, name, root string, symbols bool, terms documentTerms) (int, int, []string) {
+	st := stagesFrom(ctx)
+	stop := st.time("parse")
+	files, errs := readRepo(root, symbols)
+	stop()
+
+	store, err := storage.Open("file-uploader")
+	if err != nil {
+		return 0, 0, append(errs, fmt.Sprintf("failed to open storage: %v", err))
+	}
+	defer store.Close()
+
+	defer st.time("insert")()
+	ingest := newIngester(ctx, "repository", store)
+	stored, skipped := 0, 0
+	for _, f := range files {
+		tags := []string{name, f.Language}
+		if dir, _, ok := strings.Cut(f.Path, "/"); ok {
+			tags = append(tags, strings.ToLower(dir))
+		}
+		item := &pipeline.ContentItem{
+			Content: storage.Content{
+				Workspace:      workspace,
+				SourceURL:      "repo://" + name + "/" + f.Path,
+				Author:         "file_upload",
+				Timestamp:      time.Now(),
+				Tags:           tags,
+				ContentType:    f.ContentType,
+				SourcePlatform: "repository",
+				Summary:        documentSummary(name+"/"+f.Path, f.Summary),
+				RelevanceScore: 0.5,
+				Visibility:     terms.Visibility,
+				License:        terms.License,
+			},
+			Text:   f.Text,
+			Chunks: f.Chunks,
+		}
+		if err := ingest.Run(ctx, item); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f.Path, err))
+			continue
+		}
+		if item.Inserted {
+			stored++
+		} else {
+			skipped++
+		}
+	}
+	return stored, skipped, errs
+}
+
+// repoFile is what is stored of one file of a repository.
+type repoFile struct {
+	// Path is the file's slash-separated path in the repository
+	Path        string
+	Language    string
+	ContentType string
+	Text        string
+	// Summary is the text the item's summary starts with
+	Summary string
+	// Chunks are the file's symbols, when split by them
+	Chunks []chunker.Chunk
+}
+
+// readRepo reads the files worth storing under root: documentation as
+// Markdown or text, and of source files their comments, or with symbols
+// the code split by function and type.
+func readRepo(root string, symbols bool) ([]repoFile, []string) {
+	var files []repoFile
+	var errs []string
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != root && (strings.HasPrefix(d.Name(), ".") || skippedRepoDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		kind, language := repoFileKind(rel)
+		if kind == "" {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxRepoFileSize || info.Size() == 0 {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", rel, err))
+			return nil
+		}
+		// Binary and generated files
+		if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+			return nil
+		}
+		if f, ok := readRepoFile(rel, kind, language, string(data), symbols); ok {
+			files = append(files, f)
+		}
+		if len(files) >= maxRepoFiles {
+			errs = append(errs, fmt.Sprintf("stopped after %d files", maxRepoFiles))
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	return files, errs
+}
+
+// docExtensions are documentation files, by the content type they are
+// stored as.
+var docExtensions = map[string]string{
+	".md": "markdown", ".markdown": "markdown", ".mdx": "markdown", ".rst": "text", ".txt": "text", ".adoc": "text",
+}
+
+// repoFileKind tells documentation ("doc", with its content type) from
+// source ("code", with its language). Other files have no kind.
+func repoFileKind(rel string) (kind, language string) {
+	base := strings.ToLower(path.Base(rel))
+	ext := path.Ext(base)
+	if contentType, ok := docExtensions[ext]; ok {
+		return "doc", contentType
+	}
+	if strings.HasPrefix(base, "readme") && ext == "" {
+		return "doc", "text"
+	}
+	if strings.HasSuffix(base, ".min.js") || strings.HasSuffix(base, ".pb.go") || strings.HasSuffix(base, "_generated.go") {
+		return "", ""
+	}
+	if lang, ok := languages[ext]; ok {
+		return "code", lang
+	}
+	return "", ""
+}
+
+func readRepoFile(rel, kind, language, source string, symbols bool) (repoFile, bool) {
+	if kind == "doc" {
+		text := strings.TrimSpace(source)
+		return repoFile{Path: rel, Language: "docs", ContentType: language, Text: text, Summary: text}, text != ""
+	}
+	syntax := commentSyntaxes[language]
+	comments := extractComments(source, syntax)
+	f := repoFile{Path: rel, Language: language, ContentType: "source_code", Summary: comments}
+	if symbols {
+		f.Text = source
+		f.Chunks = symbolChunks(rel, source, language)
+		if f.Summary == "" {
+			f.Summary = source
+		}
+		return f, strings.TrimSpace(source) != ""
+	}
+	if comments == "" {
+		return f, false
+	}
+	f.Text = "# " + rel + "\n\n" + comments
+	return f, true
+}
+
+// languages are the source languages read, by file extension.
+var languages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".mjs": "javascript", ".jsx": "javascript",
+	".ts": "typescript", ".tsx": "typescript", ".rs": "rust", ".java": "java", ".kt": "kotlin",
+	".scala": "scala", ".cs": "csharp", ".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".rb": "ruby", ".php": "php", ".swift": "swift", ".sh": "shell", ".bash": "shell",
+	".sol": "solidity", ".proto": "protobuf", ".sql": "sql", ".lua": "lua", ".ex": "elixir", ".exs": "elixir",
+}
+
+// commentSyntax is how a language writes comments.
+type commentSyntax struct {
+	Line       string
+	BlockStart string
+	BlockEnd   string
+}
+
+var (
+	cStyle    = commentSyntax{Line: "//", BlockStart: "/*", BlockEnd: "*/"}
+	hashStyle = commentSyntax{Line: "#"}
+)
+
+var commentSyntaxes = map[string]commentSyntax{
+	"go": cStyle, "javascript": cStyle, "typescript": cStyle, "rust": cStyle, "java": cStyle,
+	"kotlin": cStyle, "scala": cStyle, "csharp": cStyle, "c": cStyle, "cpp": cStyle, "php": cStyle,
+	"swift": cStyle, "solidity": cStyle, "protobuf": cStyle,
+	"python": {Line: "#", BlockStart: `"""`, BlockEnd: `"""`},
+	"ruby":   {Line: "#", BlockStart: "=begin", BlockEnd: "=end"},
+	"shell":  hashStyle, "elixir": hashStyle,
+	"sql": {Line: "--", BlockStart: "/*", BlockEnd: "*/"},
+	"lua": {Line: "--", BlockStart: "--[[", BlockEnd: "]]"},
+}
+
+// directive matches comments meant for tools rather than readers.
+var directive = regexp.MustCompile(`^(go:|\+build|nolint|eslint|prettier|@ts-|noqa|type:|pylint|rubocop|!)`)
+
+// extractComments collects the file's comments as Markdown, each block
+// under the line of code it documents. License headers and tool
+// directives are left out.
+func extractComments(source string, syntax commentSyntax) string {
+	var sections []string
+	var block []string
+	lines := strings.Split(source, "\n")
+	flush := func(start, next int) {
+		text := strings.TrimSpace(strings.Join(block, "\n"))
+		block = nil
+		if text == "" || isLicense(text) {
+			return
+		}
+		// The block documents the next line of code, if one follows, or
+		// for a docstring the line declaring it
+		following := lines[next:]
+		if syntax.BlockStart == `"""` && strings.HasPrefix(strings.TrimSpace(lines[start]), `"""`) {
+			following = nil
+			for i := start - 1; i >= 0; i-- {
+				if l := strings.TrimSpace(lines[i]); l != "" {
+					if strings.HasSuffix(l, ":") {
+						following = []string{l}
+					}
+					break
+				}
+			}
+		}
+		heading := ""
+		for _, l := range following {
+			if l = strings.TrimSpace(l); l != "" {
+				if !strings.HasPrefix(l, syntax.Line) || syntax.Line == "" {
+					heading = strings.TrimRight(l, " {:")
+				}
+				break
+			}
+		}
+		if heading != "" && len(heading) <= 120 {
+			text = "## " + heading + "\n\n" + text
+		}
+		sections = append(sections, text)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case syntax.BlockStart != "" && strings.HasPrefix(line, syntax.BlockStart):
+			start := i
+			body := strings.TrimPrefix(line, syntax.BlockStart)
+			for !strings.Contains(body, syntax.BlockEnd) && i+1 < len(lines) {
+				i++
+				block = append(block, strings.TrimPrefix(strings.TrimPrefix(body, "*"), " "))
+				body = strings.TrimSpace(lines[i])
+			}
+			body, _, _ = strings.Cut(body, syntax.BlockEnd)
+			block = append(block, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(body), "*"), " "))
+			flush(start, i+1)
+		case syntax.Line != "" && strings.HasPrefix(line, syntax.Line):
+			text := strings.TrimPrefix(strings.TrimLeft(line, syntax.Line[:1]), " ")
+			if directive.MatchString(text) {
+				continue
+			}
+			block = append(block, text)
+			if i+1 >= len(lines) || !strings.HasPrefix(strings.TrimSpace(lines[i+1]), syntax.Line) {
+				flush(i, i+1)
+			}
+		}
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+func isLicense(text string) bool {
+	lower := strings.ToLower(text)
+	return strings.Contains(lower, "copyright") || strings.Contains(lower, "spdx-license-identifier") ||
+		strings.Contains(lower, "licensed under")
+}
+
+// symbolPatterns match the lines that start a function, method or type
+// declaration in each language.
+var symbolPatterns = map[string]*regexp.Regexp{
+	"go":         regexp.MustCompile(`^(func|type)\s`),
+	"python":     regexp.MustCompile(`^\s*(async\s+def|def|class)\s+\w+`),
+	"javascript": regexp.MustCompile(`^\s*(export\s+)?(default\s+)?((async\s+)?function\*?\s|class\s|(const|let)\s+\w+\s*=\s*(async\s*)?(\([^)]*\)|\w+)\s*=>)`),
+	"typescript": regexp.MustCompile(`^\s*(export\s+)?(default\s+)?((async\s+)?function\*?\s|(abstract\s+)?class\s|interface\s|type\s+\w+\s*=|enum\s|(const|let)\s+\w+\s*=\s*(async\s*)?(\([^)]*\)|\w+)\s*=>)`),
+	"rust":       regexp.MustCompile(`^\s*(pub(\([^)]*\))?\s+)?((async|const|unsafe)\s+)*(fn|struct|enum|trait|impl|mod)\b`),
+	"java":       regexp.MustCompile(`^\s*((public|private|protected|static|final|abstract|synchronized)\s+)*(class|interface|enum|record)\s+\w+|^\s+(public|private|protected)\s+[\w<>\[\], ]+\s+\w+\s*\(`),
+	"kotlin":     regexp.MustCompile(`^\s*((public|private|protected|internal|open|abstract|override|data|sealed|suspend|inline)\s+)*(fun|class|interface|object)\s`),
+	"scala":      regexp.MustCompile(`^\s*((private|protected|override|final|sealed|case|implicit)\s+)*(def|class|trait|object)\s`),
+	"csharp":     regexp.MustCompile(`^\s*((public|private|protected|internal|static|abstract|sealed|override|virtual|async|partial)\s+)+[\w<>\[\], ]*\s*\w+\s*(\(|\{|$)`),
+	"c":          regexp.MustCompile(`^(static\s+|struct\s+|enum\s+|typedef\s+)?[A-Za-z_][\w\s\*]*[\s\*]\**\w+\s*\([^;]*$|^(struct|enum|union)\s+\w+\s*\{`),
+	"cpp":        regexp.MustCompile(`^(template\s*<.*>\s*)?((class|struct|enum|namespace)\s+\w+|[A-Za-z_][\w\s\*&:<>,]*[\s\*&]+[\w:~]+\s*\([^;]*$)`),
+	"ruby":       regexp.MustCompile(`^\s*(def|class|module)\s`),
+	"php":        regexp.MustCompile(`^\s*((public|private|protected|static|abstract|final)\s+)*(function|class|interface|trait)\s`),
+	"swift":      regexp.MustCompile(`^\s*((public|private|internal|open|static|final|override|mutating)\s+)*(func|class|struct|enum|protocol|extension)\s`),
+	"shell":      regexp.MustCompile(`^\s*(function\s+\w+|\w+\s*\(\)\s*\{?)`),
+	"solidity":   regexp.MustCompile(`^\s*(contract|interface|library|function|struct|event|modifier|enum)\s`),
+	"protobuf":   regexp.MustCompile(`^\s*(message|service|enum|rpc)\s`),
+	"elixir":     regexp.MustCompile(`^\s*(defmodule|def|defp|defmacro)\s`),
+	"lua":        regexp.MustCompile(`^\s*(local\s+)?function\s`),
+}
+
+// symbolChunks splits source into a chunk per declaration, from the
+// comment above it to the next one, with the declaring line as heading.
+// Code before the first declaration is a chunk headed by the file's path,
+// and declarations longer than the source_code max_tokens are split
+// between lines. Languages without a pattern are split between lines only.
+func symbolChunks(rel, source, language string) []chunker.Chunk {
+	maxTokens := chunking.For("source_code").MaxTokens
+	tok := tokenizer.Default()
+	syntax := commentSyntaxes[language]
+
+	type symbol struct {
+		heading string
+		lines   []string
+	}
+	symbols := []symbol{{heading: rel}}
+	pattern := symbolPatterns[language]
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		if pattern != nil && pattern.MatchString(line) {
+			// The comment right above belongs to the declaration
+			cur := &symbols[len(symbols)-1]
+			start := len(cur.lines)
+			for start > 0 && isCommentLine(cur.lines[start-1], syntax) {
+				start--
+			}
+			doc := append([]string(nil), cur.lines[start:]...)
+			cur.lines = cur.lines[:start]
+			heading := strings.TrimRight(strings.TrimSpace(line), " {:")
+			if len(heading) > 200 {
+				heading = heading[:200]
+			}
+			symbols = append(symbols, symbol{heading: heading, lines: append(doc, lines[i])})
+			continue
+		}
+		symbols[len(symbols)-1].lines = append(symbols[len(symbols)-1].lines, line)
+	}
+
+	var chunks []chunker.Chunk
+	for _, s := range symbols {
+		for _, text := range splitLines(s.lines, maxTokens, tok) {
+			chunks = append(chunks, chunker.Chunk{Position: len(chunks), Heading: s.heading, Text: text, Tokens: tok.Count(text)})
+		}
+	}
+	return chunks
+}
+
+// splitLines groups whole lines into parts of up to maxTokens tokens,
+// keeping the code's layout.
+func splitLines(lines []string, maxTokens int, tok tokenizer.Tokenizer) []string {
+	var parts []string
+	var part []string
+	size := 0
+	add := func() {
+		if text := strings.Trim(strings.Join(part, "\n"), "\n"); strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
+		part, size = nil, 0
+	}
+	for _, line := range lines {
+		n := tok.Count(line)
+		if size+n > maxTokens && len(part) > 0 {
+			add()
+		}
+		part = append(part, line)
+		size += n
+	}
+	add()
+	return parts
+}
+
+func isCommentLine(line string, syntax commentSyntax) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+	for _, prefix := range []string{syntax.Line, syntax.BlockStart, "*", syntax.BlockEnd} {
+		if prefix != "" && strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
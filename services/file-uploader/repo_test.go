@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name, body string
+	link       bool
+}
+
+func writeZip(t *testing.T, entries []archiveEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "repo.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.link {
+			h.SetMode(os.ModeSymlink | 0o777)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeTarGz(t *testing.T, entries []archiveEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "repo.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.link {
+			h = &tar.Header{Name: e.name, Linkname: e.body, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if !e.link {
+			tw.Write([]byte(e.body))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return path
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "repo/README.md", body: "# Raft"},
+		{name: "../escape.txt", body: "outside"},
+		{name: "repo/../../escape.txt", body: "outside"},
+		{name: "repo/passwd", body: "/etc/passwd", link: true},
+	}
+	for _, tt := range []struct{ filename, path string }{
+		{"repo.zip", writeZip(t, entries)},
+		{"repo.tar.gz", writeTarGz(t, entries)},
+	} {
+		parent := t.TempDir()
+		dir := filepath.Join(parent, "out")
+		if err := extractArchive(tt.path, tt.filename, dir); err != nil {
+			t.Fatalf("%s: %v", tt.filename, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "repo", "README.md")); err != nil || string(data) != "# Raft" {
+			t.Errorf("%s: expected the README unpacked, got %q (%v)", tt.filename, data, err)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected entries outside dir skipped, got %v", tt.filename, err)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "repo", "passwd")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected links skipped, got %v", tt.filename, err)
+		}
+	}
+}
+
+func TestExtractArchiveSizeCap(t *testing.T) {
+	saved := maxRepoSize
+	t.Cleanup(func() { maxRepoSize = saved })
+	maxRepoSize = 10
+	entries := []archiveEntry{{name: "a.md", body: "123456"}, {name: "b.md", body: "123456"}}
+	for _, tt := range []struct{ filename, path string }{
+		{"repo.zip", writeZip(t, entries)},
+		{"repo.tar.gz", writeTarGz(t, entries)},
+	} {
+		err := extractArchive(tt.path, tt.filename, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "archive unpacks to more than") {
+			t.Errorf("%s: expected the size cap to stop unpacking, got %v", tt.filename, err)
+		}
+	}
+}
+
+func TestCloneRepoValidation(t *testing.T) {
+	saved := gitCommand
+	t.Cleanup(func() { gitCommand = saved })
+	// Refused requests never get as far as running git
+	gitCommand = filepath.Join(t.TempDir(), "no-git")
+
+	for _, tt := range []struct{ url, ref, want string }{
+		{"file:///etc", "", "must be http or https"},
+		{"ext::sh -c touch% /tmp/pwned", "", "must be http or https"},
+		{"ssh://git@example.com/repo.git", "", "must be http or https"},
+		{"https:///repo.git", "", "must be http or https"},
+		{"https://example.com/repo.git", "--upload-pack=touch /tmp/pwned", "invalid ref"},
+		{"https://example.com/repo.git", "main", "no-git"},
+	} {
+		err := cloneRepo(context.Background(), tt.url, tt.ref, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("cloneRepo(%q, %q): expected an error with %q, got %v", tt.url, tt.ref, tt.want, err)
+		}
+	}
+}
+
+func TestExtractComments(t *testing.T) {
+	for _, tt := range []struct {
+		name, source string
+		syntax       commentSyntax
+		want         string
+	}{
+		{
+			name: "go",
+			source: `// Copyright 2024 Example. Licensed under MIT.
+package raft
+
+//go:generate stringer -type=State
+
+// State is a node's role in the cluster.
+type State int
+
+/* Elect starts an election
+   after a timeout. */
+func Elect() {
+}
+`,
+			syntax: cStyle,
+			want:   "## type State int\n\nState is a node's role in the cluster.\n\n## func Elect()\n\nElect starts an election\nafter a timeout.",
+		},
+		{
+			name: "python docstring",
+			source: `def vote(term):
+    """Cast a vote for term."""
+    return term
+`,
+			syntax: commentSyntaxes["python"],
+			want:   "## def vote(term)\n\nCast a vote for term.",
+		},
+		{name: "no comments", source: "package raft\n", syntax: cStyle, want: ""},
+	} {
+		if got := extractComments(tt.source, tt.syntax); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSymbolChunks(t *testing.T) {
+	source := `package raft
+
+import "time"
+
+// Node runs the protocol.
+type Node struct {
+	timeout time.Duration
+}
+
+// Step advances the node.
+func (n *Node) Step() {
+}
+`
+	chunks := symbolChunks("raft/node.go", source, "go")
+	want := []struct{ heading, text string }{
+		{"raft/node.go", "package raft\n\nimport \"time\""},
+		{"type Node struct", "// Node runs the protocol.\ntype Node struct {\n\ttimeout time.Duration\n}"},
+		{"func (n *Node) Step()", "// Step advances the node.\nfunc (n *Node) Step() {\n}"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Expected %d chunks, got %+v", len(want), chunks)
+	}
+	for i, w := range want {
+		if c := chunks[i]; c.Position != i || c.Heading != w.heading || c.Text != w.text || c.Tokens == 0 {
+			t.Errorf("Chunk %d: expected %q with %q, got %+v", i, w.heading, w.text, c)
+		}
+	}
+
+	// Without a pattern, the file is one chunk headed by its path
+	if chunks := symbolChunks("notes.txt", "plain text", "text"); len(chunks) != 1 || chunks[0].Heading != "notes.txt" {
+		t.Errorf("Expected one chunk for a language without a pattern, got %+v", chunks)
+	}
+}
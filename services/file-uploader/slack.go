@@ -0,0 +1,197 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readSlackFile parses an uploaded Slack export, a channel's .json or the
+// workspace .zip.
+func readSlackFile(ctx context.Context, filePath, filename string) ([]message, error) {
+	slog.Debug("processing slack file", "filename", filename)
+
+	if strings.ToLower(filepath.Ext(filename)) == ".zip" {
+		return parseSlackZip(filePath, stagesFrom(ctx))
+	}
+	defer stagesFrom(ctx).time("parse")()
+	return parseSlackJSON(filePath, strings.TrimSuffix(filename, filepath.Ext(filename)))
+}
+
+// parseSlackJSON reads one exported channel file: either the array of
+// messages Slack writes per channel and day, or an object holding
+// messages and users. Messages without a channel are put in channel.
+func parseSlackJSON(filePath, channel string) ([]message, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var export SlackExport
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &export.Messages)
+	} else {
+		err = json.Unmarshal(data, &export)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid Slack export: %v", err)
+	}
+	return slackMessages(export.Messages, slackUserNames(export.Users), channel), nil
+}
+
+// parseSlackZip reads a workspace export: users.json and channels.json at
+// the top, and a directory of daily message files per channel. Reading the
+// files is timed as the unzip stage and decoding them as the parse stage.
+func parseSlackZip(filePath string, st stages) ([]message, error) {
+	stop := st.time("unzip")
+	archive, err := zip.OpenReader(filePath)
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Slack export: %v", err)
+	}
+	defer archive.Close()
+
+	var users []SlackUser
+	var dms, mpims []SlackChannel
+	byChannel := map[string][]SlackMessage{}
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || path.Ext(f.Name) != ".json" {
+			continue
+		}
+		dir := path.Dir(f.Name)
+		if dir == "." {
+			var err error
+			switch f.Name {
+			case "users.json":
+				err = readZipJSON(f, &users, st)
+			case "dms.json":
+				err = readZipJSON(f, &dms, st)
+			case "mpims.json":
+				err = readZipJSON(f, &mpims, st)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var day []SlackMessage
+		if err := readZipJSON(f, &day, st); err != nil {
+			return nil, err
+		}
+		channel := path.Base(dir)
+		byChannel[channel] = append(byChannel[channel], day...)
+	}
+
+	defer st.time("parse")()
+	// Direct conversations are kept in directories named after the DM's ID
+	// and the group DM's name
+	direct := map[string]bool{}
+	for _, c := range dms {
+		direct[c.ID] = true
+	}
+	for _, c := range mpims {
+		direct[c.Name] = true
+	}
+
+	names := slackUserNames(users)
+	var msgs []message
+	for channel, day := range byChannel {
+		channelMsgs := slackMessages(day, names, channel)
+		if direct[channel] {
+			for i := range channelMsgs {
+				channelMsgs[i].Direct = true
+			}
+		}
+		msgs = append(msgs, channelMsgs...)
+	}
+	return msgs, nil
+}
+
+func readZipJSON(f *zip.File, v interface{}, st stages) error {
+	stop := st.time("unzip")
+	r, err := f.Open()
+	if err != nil {
+		stop()
+		return err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	stop()
+	if err != nil {
+		return err
+	}
+	defer st.time("parse")()
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid Slack export file %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+func slackUserNames(users []SlackUser) map[string]string {
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		if u.Real != "" {
+			names[u.ID] = u.Real
+		} else {
+			names[u.ID] = u.Name
+		}
+	}
+	return names
+}
+
+// slackMessages converts exported messages. Slack records only which
+// thread a reply is in, not which reply it answers, so thread replies are
+// linked to the thread's first message.
+func slackMessages(exported []SlackMessage, names map[string]string, channel string) []message {
+	msgs := make([]message, 0, len(exported))
+	for _, m := range exported {
+		if (m.Type != "" && m.Type != "message") || m.Timestamp == "" {
+			continue
+		}
+		author := names[m.User]
+		if author == "" {
+			author = m.User
+		}
+		msg := message{
+			ID:       m.Timestamp,
+			Channel:  channel,
+			Author:   author,
+			AuthorID: m.User,
+			Text:     m.Text,
+			Time:     slackTime(m.Timestamp),
+			Direct:   isDirectChannel(channel),
+		}
+		if m.Channel != "" {
+			msg.Channel = m.Channel
+		}
+		if m.Thread != "" && m.Thread != m.Timestamp {
+			msg.ThreadOf = m.Thread
+		}
+		// Exports only link to files, which need a token to download
+		for _, f := range m.Files {
+			msg.Attachments = append(msg.Attachments, media(nil).attach(f.URL, f.Name, f.MimeType, f.Size))
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// slackTime parses a Slack timestamp, seconds since the epoch with
+// microseconds after the dot ("1700000000.123456").
+func slackTime(ts string) time.Time {
+	seconds, micros, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	us, _ := strconv.ParseInt(micros, 10, 64)
+	return time.Unix(s, us*1000).UTC()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// slackFilter selects which messages of a Slack export are stored, so
+// channels such as #random and private conversations can be kept out of
+// the knowledge base. Channel patterns are shell globs matched against
+// channel names ("random", "team-*"); users are matched by ID or name.
+type slackFilter struct {
+	IncludeChannels []string
+	ExcludeChannels []string
+	ExcludeUsers    []string
+	ExcludeDMs      bool
+}
+
+// SlackPreview reports what a Slack upload stores, or would store in a
+// dry run: messages per channel, and those left out by channel and by user.
+type SlackPreview struct {
+	Messages         int            `json:"messages"`
+	Channels         map[string]int `json:"channels"`
+	ExcludedChannels map[string]int `json:"excluded_channels,omitempty"`
+	ExcludedUsers    map[string]int `json:"excluded_users,omitempty"`
+}
+
+// directChannelPattern matches the IDs Slack exports DMs under.
+var directChannelPattern = regexp.MustCompile(`^D[A-Z0-9]{8,}$`)
+
+// isDirectChannel tells DMs and group DMs from channels by name, for
+// exports without dms.json and mpims.json, such as a single channel file.
+func isDirectChannel(channel string) bool {
+	return strings.HasPrefix(channel, "mpdm-") || directChannelPattern.MatchString(channel)
+}
+
+// slackFilterFromForm reads the filter from an upload's form fields:
+// include_channels, exclude_channels and exclude_users (comma separated)
+// and exclude_dms.
+func slackFilterFromForm(r *http.Request) (slackFilter, error) {
+	f := slackFilter{
+		IncludeChannels: formList(r, "include_channels"),
+		ExcludeChannels: formList(r, "exclude_channels"),
+		ExcludeUsers:    formList(r, "exclude_users"),
+		ExcludeDMs:      r.FormValue("exclude_dms") == "true",
+	}
+	for _, pattern := range append(f.IncludeChannels, f.ExcludeChannels...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return slackFilter{}, fmt.Errorf("invalid channel pattern %q", pattern)
+		}
+	}
+	return f, nil
+}
+
+// formList splits a comma separated form field, dropping a leading # from
+// channel names.
+func formList(r *http.Request, field string) []string {
+	var list []string
+	for _, v := range strings.Split(r.FormValue(field), ",") {
+		if v = strings.TrimPrefix(strings.TrimSpace(v), "#"); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// matchesAny matches channel names case-insensitively.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// channelAllowed reports whether the messages of a channel are stored:
+// channels must match an include pattern when there are any, and no
+// exclude pattern.
+func (f slackFilter) channelAllowed(channel string, direct bool) bool {
+	if direct && f.ExcludeDMs {
+		return false
+	}
+	if len(f.IncludeChannels) > 0 && !matchesAny(f.IncludeChannels, channel) {
+		return false
+	}
+	return !matchesAny(f.ExcludeChannels, channel)
+}
+
+func (f slackFilter) userExcluded(m message) bool {
+	for _, user := range f.ExcludeUsers {
+		if strings.EqualFold(user, m.AuthorID) || strings.EqualFold(user, m.Author) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the messages the filter allows and the report of what was
+// kept and left out.
+func (f slackFilter) apply(msgs []message) ([]message, SlackPreview) {
+	preview := SlackPreview{Channels: map[string]int{}, ExcludedChannels: map[string]int{}, ExcludedUsers: map[string]int{}}
+	kept := make([]message, 0, len(msgs))
+	for _, m := range msgs {
+		switch {
+		case !f.channelAllowed(m.Channel, m.Direct):
+			preview.ExcludedChannels[m.Channel]++
+		case f.userExcluded(m):
+			preview.ExcludedUsers[m.Author]++
+		default:
+			preview.Channels[m.Channel]++
+			kept = append(kept, m)
+		}
+	}
+	preview.Messages = len(kept)
+	return kept, preview
+}
+
+// excluded counts the messages left out.
+func (p SlackPreview) excluded() int {
+	n := 0
+	for _, c := range p.ExcludedChannels {
+		n += c
+	}
+	for _, c := range p.ExcludedUsers {
+		n += c
+	}
+	return n
+}
+
+// previewSlackUpload answers a dry run: the export is parsed, filtered and
+// run through the pipeline but nothing is kept, neither the file nor its
+// messages.
+func previewSlackUpload(ctx context.Context, w http.ResponseWriter, upload *uploadRecord, file multipart.File, handler *multipart.FileHeader, workspace string, filter slackFilter, full bool) {
+	stop := upload.stages.time("save")
+	tmp, discard, err := saveUpload(ctx, file, handler, "slack_export", workspace, "")
+	stop()
+	if err != nil {
+		respondWithError(w, "Failed to save file", err)
+		return
+	}
+	defer discard()
+
+	msgs, err := readSlackFile(ctx, tmp.path, handler.Filename)
+	if err != nil {
+		respondWithError(w, "Invalid Slack export", err)
+		return
+	}
+	kept, preview := filter.apply(msgs)
+	skipped := 0
+	if !full {
+		kept, skipped = newSlackMessages(ctx, workspace, kept)
+		preview.Messages = len(kept)
+		preview.Channels = map[string]int{}
+		for _, m := range kept {
+			preview.Channels[m.Channel]++
+		}
+	}
+	_, processingErrors := storeMessages(ctx, workspace, "slack", kept)
+	upload.finished(processingErrors)
+
+	response := UploadResponse{
+		Success:       len(processingErrors) == 0,
+		Message:       fmt.Sprintf("Would store %d of %d messages from Slack export", preview.Messages, len(msgs)),
+		Filename:      handler.Filename,
+		FileType:      "slack_export",
+		SkippedItems:  skipped,
+		ExcludedItems: preview.excluded(),
+		Preview:       &UploadPreview{SlackPreview: &preview},
+		Errors:        processingErrors,
+	}
+	dryRunResponse(ctx, &response)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
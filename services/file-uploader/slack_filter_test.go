@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIsDirectChannel(t *testing.T) {
+	for _, tt := range []struct {
+		channel string
+		want    bool
+	}{
+		{"D024BE91L", true},
+		{"mpdm-ana--bo--cy-1", true},
+		{"general", false},
+		{"D1", false},
+		{"Design", false},
+	} {
+		if got := isDirectChannel(tt.channel); got != tt.want {
+			t.Errorf("Expected isDirectChannel(%q) to be %v, got %v", tt.channel, tt.want, got)
+		}
+	}
+}
+
+func TestSlackFilterChannelAllowed(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		filter  slackFilter
+		channel string
+		direct  bool
+		want    bool
+	}{
+		{"no filter", slackFilter{}, "random", false, true},
+		{"excluded", slackFilter{ExcludeChannels: []string{"random"}}, "random", false, false},
+		{"excluded glob", slackFilter{ExcludeChannels: []string{"team-*"}}, "team-infra", false, false},
+		{"case-insensitive", slackFilter{ExcludeChannels: []string{"Random"}}, "random", false, false},
+		{"included", slackFilter{IncludeChannels: []string{"eng-*"}}, "eng-go", false, true},
+		{"not included", slackFilter{IncludeChannels: []string{"eng-*"}}, "random", false, false},
+		{"exclude wins", slackFilter{IncludeChannels: []string{"eng-*"}, ExcludeChannels: []string{"eng-social"}}, "eng-social", false, false},
+		{"dms kept", slackFilter{}, "D024BE91L", true, true},
+		{"dms excluded", slackFilter{ExcludeDMs: true}, "D024BE91L", true, false},
+		{"channels kept without dms", slackFilter{ExcludeDMs: true}, "general", false, true},
+	} {
+		if got := tt.filter.channelAllowed(tt.channel, tt.direct); got != tt.want {
+			t.Errorf("%s: expected channelAllowed(%q) to be %v, got %v", tt.name, tt.channel, tt.want, got)
+		}
+	}
+}
+
+func TestSlackFilterApply(t *testing.T) {
+	msgs := []message{
+		{ID: "1", Channel: "general", Author: "ana", AuthorID: "U1"},
+		{ID: "2", Channel: "general", Author: "bot", AuthorID: "U2"},
+		{ID: "3", Channel: "random", Author: "ana", AuthorID: "U1"},
+		{ID: "4", Channel: "D024BE91L", Author: "bo", AuthorID: "U3", Direct: true},
+		{ID: "5", Channel: "eng", Author: "Bo", AuthorID: "U3"},
+	}
+	for _, tt := range []struct {
+		name    string
+		filter  slackFilter
+		kept    []string
+		preview SlackPreview
+	}{
+		{
+			name:    "nothing left out",
+			kept:    []string{"1", "2", "3", "4", "5"},
+			preview: SlackPreview{Messages: 5, Channels: map[string]int{"general": 2, "random": 1, "D024BE91L": 1, "eng": 1}},
+		},
+		{
+			name:   "channels, dms and users",
+			filter: slackFilter{ExcludeChannels: []string{"random"}, ExcludeUsers: []string{"u2", "bo"}, ExcludeDMs: true},
+			kept:   []string{"1"},
+			preview: SlackPreview{Messages: 1, Channels: map[string]int{"general": 1},
+				ExcludedChannels: map[string]int{"random": 1, "D024BE91L": 1}, ExcludedUsers: map[string]int{"bot": 1, "Bo": 1}},
+		},
+	} {
+		kept, preview := tt.filter.apply(msgs)
+		var ids []string
+		for _, m := range kept {
+			ids = append(ids, m.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.kept) {
+			t.Errorf("%s: expected %v kept, got %v", tt.name, tt.kept, ids)
+		}
+		// apply leaves empty maps rather than nil ones
+		for _, m := range []*map[string]int{&tt.preview.ExcludedChannels, &tt.preview.ExcludedUsers} {
+			if *m == nil {
+				*m = map[string]int{}
+			}
+		}
+		if !reflect.DeepEqual(preview, tt.preview) {
+			t.Errorf("%s: expected preview %+v, got %+v", tt.name, tt.preview, preview)
+		}
+		if want := len(msgs) - len(tt.kept); preview.excluded() != want {
+			t.Errorf("%s: expected %d excluded, got %d", tt.name, want, preview.excluded())
+		}
+	}
+}
+
+func TestSlackFilterFromForm(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		form    url.Values
+		want    slackFilter
+		wantErr bool
+	}{
+		{name: "empty", form: url.Values{}, want: slackFilter{}},
+		{
+			name: "lists",
+			form: url.Values{"include_channels": {"#eng-*, general ,"}, "exclude_channels": {"eng-social"}, "exclude_users": {"U2,bot"}, "exclude_dms": {"true"}},
+			want: slackFilter{IncludeChannels: []string{"eng-*", "general"}, ExcludeChannels: []string{"eng-social"}, ExcludeUsers: []string{"U2", "bot"}, ExcludeDMs: true},
+		},
+		{name: "bad pattern", form: url.Values{"exclude_channels": {"team-["}}, wantErr: true},
+	} {
+		r := httptest.NewRequest("POST", "/upload/slack", strings.NewReader(tt.form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		got, err := slackFilterFromForm(r)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected filter %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Slack messages are identified by their timestamp within a channel, and
+// exports only ever add messages after the newest one. Re-importing a newer
+// export therefore only needs what came after the newest message already
+// imported from each channel, its mark in slack_import_marks.
+
+// newSlackMessages drops the messages imported before, returning the rest
+// and how many were dropped. Without Postgres every message is new.
+func newSlackMessages(ctx context.Context, workspace string, msgs []message) ([]message, int) {
+	db, ok := openPostgres()
+	if !ok {
+		return msgs, 0
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT channel, last_ts FROM slack_import_marks WHERE workspace_id = $1`, workspace)
+	if err != nil {
+		slog.Warn("failed to load slack import marks, importing everything", "error", err)
+		return msgs, 0
+	}
+	defer rows.Close()
+	marks := map[string]string{}
+	for rows.Next() {
+		var channel, ts string
+		if err := rows.Scan(&channel, &ts); err != nil {
+			slog.Warn("failed to load slack import marks, importing everything", "error", err)
+			return msgs, 0
+		}
+		marks[channel] = ts
+	}
+
+	fresh := make([]message, 0, len(msgs))
+	for _, m := range msgs {
+		if mark, ok := marks[m.Channel]; ok && !slackTime(m.ID).After(slackTime(mark)) {
+			continue
+		}
+		fresh = append(fresh, m)
+	}
+	return fresh, len(msgs) - len(fresh)
+}
+
+// markSlackImported moves each channel's mark to its newest message in
+// msgs. Marks never move back, so importing an older export after a newer
+// one does not make the newer messages count as new again.
+func markSlackImported(ctx context.Context, workspace string, msgs []message) {
+	newest := map[string]string{}
+	for _, m := range msgs {
+		if ts, ok := newest[m.Channel]; !ok || slackTime(m.ID).After(slackTime(ts)) {
+			newest[m.Channel] = m.ID
+		}
+	}
+	if len(newest) == 0 {
+		return
+	}
+
+	db, ok := openPostgres()
+	if !ok {
+		return
+	}
+	defer db.Close()
+	for channel, ts := range newest {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO slack_import_marks (workspace_id, channel, last_ts) VALUES ($1, $2, $3)
+			ON CONFLICT (workspace_id, channel) DO UPDATE SET last_ts = EXCLUDED.last_ts, updated_at = now()
+			WHERE slack_import_marks.last_ts::numeric < EXCLUDED.last_ts::numeric`,
+			workspace, channel, ts)
+		if err != nil {
+			slog.Warn("failed to save slack import mark", "channel", channel, "error", err)
+		}
+	}
+}
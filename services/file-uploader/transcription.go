@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"selin/internal/blob"
+	"selin/internal/config"
+	"selin/internal/keyring"
+	"selin/internal/pipeline"
+	"selin/internal/storage"
+	"selin/internal/tokenizer"
+	"selin/internal/transcribe"
+)
+
+// maxTranscriptionAttempts is how often a job is started before it is
+// left failed.
+const maxTranscriptionAttempts = 3
+
+// transcriber is the backend audio uploads are transcribed by, set from
+// TRANSCRIBE_BACKEND at startup. Without one audio is turned away.
+var transcriber *transcribe.Backend
+
+// transcriptionSlots bounds the transcriptions running at once, set from
+// TRANSCRIBE_CONCURRENCY at startup.
+var transcriptionSlots = make(chan struct{}, 1)
+
+// TranscriptionJob is the transcription of an audio upload, as recorded
+// in the transcription_jobs table.
+type TranscriptionJob struct {
+	UploadID  string `json:"upload_id"`
+	Workspace string `json:"workspace_id"`
+	Filename  string `json:"filename"`
+	// Status is queued, running, completed or failed
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	// ContentID is the transcript's content item, once completed
+	ContentID string `json:"content_id,omitempty"`
+	// Segments counts the chunks the transcript was split into
+	Segments int `json:"segments,omitempty"`
+
+	blobKey   string
+	size      int64
+	terms     documentTerms
+	overrides uploadOverrides
+}
+
+// setupTranscription configures the backend and, with Postgres, resumes
+// the jobs an earlier run left queued or running.
+func setupTranscription() {
+	var err error
+	if transcriber, err = transcribe.FromEnv(); err != nil {
+		slog.Error("invalid transcription backend, audio uploads are turned away", "error", err)
+		return
+	}
+	if n, err := strconv.Atoi(config.Env("TRANSCRIBE_CONCURRENCY", "1")); err == nil && n > 0 {
+		transcriptionSlots = make(chan struct{}, n)
+	}
+	if transcriber == nil {
+		return
+	}
+	db, ok := openPostgres()
+	if !ok {
+		return
+	}
+	defer db.Close()
+	rows, err := db.Query(`
+		SELECT upload_id, workspace_id, filename, blob_key, size_bytes, visibility, COALESCE(license, ''), attempts,
+			tags, COALESCE(topic, ''), min_relevance, COALESCE(author_override, '')
+		FROM transcription_jobs WHERE status IN ('queued', 'running') ORDER BY created_at`)
+	if err != nil {
+		slog.Warn("failed to look up unfinished transcriptions", "error", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		job := &TranscriptionJob{Status: "queued"}
+		if err := rows.Scan(&job.UploadID, &job.Workspace, &job.Filename, &job.blobKey, &job.size,
+			&job.terms.Visibility, &job.terms.License, &job.Attempts, pq.Array(&job.overrides.Tags), &job.overrides.Topic,
+			&job.overrides.MinRelevance, &job.overrides.Author); err != nil {
+			slog.Warn("failed to read transcription job", "error", err)
+			continue
+		}
+		slog.Info("resuming transcription", "file_id", job.UploadID, "attempts", job.Attempts)
+		go runTranscription(job)
+	}
+}
+
+// queueTranscription keeps an audio upload in blob storage, encrypted in
+// workspaces with encryption keys, and dispatches its transcription with
+// the upload's overrides. The job is recorded when storage is Postgres, so
+// it survives a restart.
+func queueTranscription(ctx context.Context, savedPath, filename, fileID, workspace string, terms documentTerms) (*TranscriptionJob, error) {
+	stop := stagesFrom(ctx).time("attach")
+	key, size, _, err := storeAttachmentFile(ctx, blob.FromEnv(), workspace, attachment{
+		Name:     filename,
+		MimeType: mime.TypeByExtension(filepath.Ext(filename)),
+		Open:     func() (io.ReadCloser, error) { return os.Open(savedPath) },
+	})
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store audio: %v", err)
+	}
+	job := &TranscriptionJob{UploadID: fileID, Workspace: workspace, Filename: filename, Status: "queued",
+		blobKey: key, size: size, terms: terms, overrides: overridesFrom(ctx)}
+
+	if db, ok := openPostgres(); ok {
+		defer db.Close()
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO transcription_jobs (upload_id, workspace_id, filename, blob_key, size_bytes, visibility, license,
+				tags, topic, min_relevance, author_override)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), COALESCE($8::text[], '{}'), NULLIF($9, ''), $10, NULLIF($11, ''))`,
+			fileID, workspace, filename, key, size, terms.Visibility, terms.License,
+			pq.Array(job.overrides.Tags), job.overrides.Topic, job.overrides.MinRelevance, job.overrides.Author)
+		if err != nil {
+			// The transcription still runs; it just is not resumed
+			slog.Warn("failed to record transcription job", "file_id", fileID, "error", err)
+		}
+	}
+	queued := *job
+	go runTranscription(job)
+	return &queued, nil
+}
+
+// runTranscription transcribes the job's audio once a slot is free and
+// stores the transcript as a content item, chunked by time, with the audio
+// as its attachment.
+func runTranscription(job *TranscriptionJob) {
+	transcriptionSlots <- struct{}{}
+	defer func() { <-transcriptionSlots }()
+
+	ctx := withOverrides(context.Background(), job.overrides)
+	db, postgres := openPostgres()
+	if postgres {
+		defer db.Close()
+	}
+	job.Attempts++
+	job.Status, job.Error = "running", ""
+	recordTranscription(ctx, db, job)
+	logger := slog.With("file_id", job.UploadID, "attempt", job.Attempts)
+	logger.Info("transcribing audio upload", "filename", job.Filename)
+
+	err := transcribeJob(ctx, db, job)
+	job.Status = "completed"
+	if err != nil {
+		job.Error = err.Error()
+		job.Status = "failed"
+		if job.Attempts < maxTranscriptionAttempts {
+			job.Status = "queued"
+		}
+		logger.Warn("transcription failed", "error", err, "status", job.Status)
+	}
+	if job.Status == "failed" {
+		recordUploadResult(ctx, job.UploadID, 0, []string{job.Error})
+	}
+	recordTranscription(ctx, db, job)
+	if job.Status == "queued" {
+		// Back off before the next attempt, without holding a slot
+		go func() {
+			time.Sleep(time.Duration(job.Attempts) * time.Minute)
+			runTranscription(job)
+		}()
+		return
+	}
+	if job.Status == "completed" {
+		recordUploadResult(ctx, job.UploadID, job.Segments, nil)
+		logger.Info("transcription completed", "content_id", job.ContentID, "segments", job.Segments)
+		announceUpload(ContentEvent{ID: job.UploadID, Workspace: job.Workspace, Platform: "file_upload", Tags: []string{"audio"}, Filename: job.Filename, Items: job.Segments})
+	}
+}
+
+func transcribeJob(ctx context.Context, db *sql.DB, job *TranscriptionJob) error {
+	f, err := blob.FromEnv().Open(job.blobKey)
+	if err != nil {
+		return fmt.Errorf("failed to open audio: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if data, err = keyring.Default().Open(ctx, job.Workspace, data); err != nil {
+		return fmt.Errorf("failed to decrypt audio: %v", err)
+	}
+
+	transcript, err := transcriber.Transcribe(ctx, job.Filename, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	text := transcript.Text()
+	if text == "" {
+		return errors.New("no speech found in the audio")
+	}
+
+	store, err := storage.Open("file-uploader")
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %v", err)
+	}
+	defer store.Close()
+	item := &pipeline.ContentItem{
+		Content: storage.Content{
+			Workspace:      job.Workspace,
+			SourceURL:      "upload://" + job.UploadID,
+			Author:         "file_upload",
+			Timestamp:      time.Now(),
+			Tags:           []string{"audio"},
+			ContentType:    "transcript",
+			SourcePlatform: "file_upload",
+			Language:       transcript.Language,
+			Summary:        documentSummary(job.Filename, text),
+			RelevanceScore: 0.5,
+			Visibility:     job.terms.Visibility,
+			License:        job.terms.License,
+		},
+		Text:   text,
+		Chunks: transcript.Chunks(chunking.For("transcript").MaxTokens, tokenizer.Default()),
+	}
+	ingest := newIngester(ctx, "transcription", store)
+	if err := ingest.Run(ctx, item); err != nil {
+		return fmt.Errorf("failed to store transcript: %v", err)
+	}
+	job.ContentID, job.Segments = item.ID, len(item.Chunks)
+
+	if db != nil && item.Inserted {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO content_attachments (content_id, position, workspace_id, filename, mime_type, size_bytes, blob_key)
+			VALUES ($1, 0, $2, $3, $4, $5, $6)
+			ON CONFLICT DO NOTHING`,
+			item.ID, job.Workspace, job.Filename, mime.TypeByExtension(filepath.Ext(job.Filename)), job.size, job.blobKey)
+		if err != nil {
+			slog.Warn("failed to attach audio to transcript", "content_id", item.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// recordTranscription saves the job's status, when there is a database.
+func recordTranscription(ctx context.Context, db *sql.DB, job *TranscriptionJob) {
+	if db == nil {
+		return
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE transcription_jobs SET status = $2, attempts = $3, error = NULLIF($4, ''), content_id = NULLIF($5, '')::uuid,
+			segments = $6, updated_at = now(), finished_at = CASE WHEN $2 IN ('completed', 'failed') THEN now() END
+		WHERE upload_id = $1`,
+		job.UploadID, job.Status, job.Attempts, job.Error, job.ContentID, job.Segments)
+	if err != nil {
+		slog.Warn("failed to record transcription status", "file_id", job.UploadID, "error", err)
+	}
+}
+
+// findTranscription returns the transcription of an upload, or
+// sql.ErrNoRows for uploads that are not audio.
+func findTranscription(ctx context.Context, db *sql.DB, uploadID string) (*TranscriptionJob, error) {
+	job := &TranscriptionJob{}
+	err := db.QueryRowContext(ctx, `
+		SELECT upload_id, workspace_id, filename, status, attempts, COALESCE(error, ''), COALESCE(content_id::text, ''), segments
+		FROM transcription_jobs WHERE upload_id = $1`, uploadID).
+		Scan(&job.UploadID, &job.Workspace, &job.Filename, &job.Status, &job.Attempts, &job.Error, &job.ContentID, &job.Segments)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
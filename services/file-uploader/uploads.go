@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"selin/internal/adminauth"
+	"selin/internal/config"
+	"selin/internal/keyring"
+	"selin/internal/logging"
+	"selin/internal/storage"
+)
+
+// Upload is an uploaded file as recorded in the uploads table.
+type Upload struct {
+	ID        string    `json:"id"`
+	Workspace string    `json:"workspace_id"`
+	UserID    string    `json:"user_id,omitempty"`
+	Filename  string    `json:"filename"`
+	FileType  string    `json:"file_type"`
+	Size      int64     `json:"size_bytes"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+	// Status is processing until the upload's items are stored, then
+	// completed or failed; expired once retention removed its file
+	Status string `json:"status"`
+	// Items counts the items the upload stored
+	Items int `json:"items"`
+	// Transcription is the job transcribing an audio upload
+	Transcription *TranscriptionJob `json:"transcription,omitempty"`
+	path          string
+}
+
+// duplicateUploadError reports a file the workspace has uploaded before.
+type duplicateUploadError struct {
+	Existing Upload
+}
+
+func (e *duplicateUploadError) Error() string {
+	return fmt.Sprintf("file already uploaded as %s (%s)", e.Existing.ID, e.Existing.Filename)
+}
+
+// rejectDuplicates turns away files whose checksum the workspace already
+// uploaded, unless UPLOAD_REJECT_DUPLICATES is false.
+func rejectDuplicates() bool {
+	return config.Env("UPLOAD_REJECT_DUPLICATES", "true") != "false"
+}
+
+// openPostgres returns the database uploads and Slack import marks are
+// recorded in. With other storage drivers there is none: uploads are kept
+// on disk only, and every Slack message is processed on each import.
+func openPostgres() (*sql.DB, bool) {
+	if storage.Driver() != "postgres" {
+		return nil, false
+	}
+	db, err := sql.Open("postgres", config.PostgresDSN("file-uploader"))
+	if err != nil {
+		return nil, false
+	}
+	return db, true
+}
+
+// storeUpload saves a file userID uploaded under a new ID, locks it and
+// records it with its SHA-256 as processing. A file an earlier upload is
+// still processing is removed again and reported as an
+// *inProgressUploadError, and, when duplicates are rejected, one the
+// workspace already uploaded as a *duplicateUploadError. The lock is the
+// caller's to release with unlockUpload.
+func storeUpload(ctx context.Context, file multipart.File, handler *multipart.FileHeader, fileType, workspace, userID string) (Upload, error) {
+	u := Upload{
+		ID:        uuid.New().String(),
+		Workspace: workspace,
+		UserID:    userID,
+		Filename:  handler.Filename,
+		FileType:  fileType,
+		CreatedAt: time.Now(),
+		Status:    "processing",
+	}
+	var err error
+	if u.path, u.Size, u.SHA256, err = saveUploadedFile(file, handler, u.ID, workspace); err != nil {
+		return Upload{}, err
+	}
+	if err := lockUpload(ctx, u); err != nil {
+		os.Remove(u.path)
+		return Upload{}, err
+	}
+
+	db, ok := openPostgres()
+	if !ok {
+		return u, nil
+	}
+	defer db.Close()
+
+	if rejectDuplicates() {
+		existing, err := findDuplicate(ctx, db, workspace, u.SHA256)
+		if err == nil {
+			os.Remove(u.path)
+			unlockUpload(u)
+			return Upload{}, &duplicateUploadError{Existing: existing}
+		}
+		if err != sql.ErrNoRows {
+			slog.Warn("failed to look up upload checksum", "error", err)
+		}
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO uploads (id, workspace_id, user_id, filename, file_type, size_bytes, sha256, stored_path, created_at, status)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10)`,
+		u.ID, u.Workspace, u.UserID, u.Filename, u.FileType, u.Size, u.SHA256, u.path, u.CreatedAt, u.Status)
+	if err != nil {
+		// The file is still processed; it just cannot be downloaded later
+		slog.Warn("failed to record upload", "file_id", u.ID, "error", err)
+	}
+	return u, nil
+}
+
+const uploadColumns = `
+	SELECT id, workspace_id, COALESCE(user_id, ''), filename, file_type, size_bytes, sha256, stored_path, created_at,
+		status, items
+	FROM uploads`
+
+func scanUpload(row interface{ Scan(...interface{}) error }) (Upload, error) {
+	var u Upload
+	err := row.Scan(&u.ID, &u.Workspace, &u.UserID, &u.Filename, &u.FileType, &u.Size, &u.SHA256, &u.path, &u.CreatedAt,
+		&u.Status, &u.Items)
+	return u, err
+}
+
+func findUpload(ctx context.Context, db *sql.DB, where string, args ...interface{}) (Upload, error) {
+	return scanUpload(db.QueryRowContext(ctx, uploadColumns+` WHERE `+where+` ORDER BY created_at LIMIT 1`, args...))
+}
+
+// findDuplicate returns the workspace's first upload of the file with the
+// given checksum that a new upload of it can be pointed at: one that did
+// not fail and whose file is still stored. It returns sql.ErrNoRows when
+// there is none.
+func findDuplicate(ctx context.Context, db *sql.DB, workspace, sha string) (Upload, error) {
+	rows, err := db.QueryContext(ctx, uploadColumns+`
+		WHERE workspace_id = $1 AND sha256 = $2 AND status NOT IN ('failed', 'expired') ORDER BY created_at`, workspace, sha)
+	if err != nil {
+		return Upload{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return Upload{}, err
+		}
+		if _, err := os.Stat(u.path); err == nil {
+			return u, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Upload{}, err
+	}
+	return Upload{}, sql.ErrNoRows
+}
+
+// recordUploadResult records the items an upload stored, which count
+// towards its user's quota, and whether it was processed without errors.
+func recordUploadResult(ctx context.Context, uploadID string, items int, errs []string) {
+	if uploadID == "" || previewFrom(ctx) != nil {
+		return
+	}
+	db, ok := openPostgres()
+	if !ok {
+		return
+	}
+	defer db.Close()
+	status := "completed"
+	if len(errs) > 0 {
+		status = "failed"
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE uploads SET items = $2, status = $3 WHERE id = $1`, uploadID, items, status); err != nil {
+		slog.Warn("failed to record upload result", "file_id", uploadID, "error", err)
+	}
+}
+
+// finishUpload seals u's file and releases its lock once its handler is
+// done. An upload the handler gave up on before recording its result is
+// left failed; audio stays processing until it is transcribed.
+func finishUpload(u Upload) {
+	if err := sealUpload(context.Background(), u); err != nil {
+		// Better gone than kept in plaintext
+		slog.Error("failed to seal upload, removing it", "file_id", u.ID, "error", err)
+		os.Remove(u.path)
+	}
+	unlockUpload(u)
+	db, ok := openPostgres()
+	if !ok {
+		return
+	}
+	defer db.Close()
+	_, err := db.Exec(`UPDATE uploads SET status = 'failed' WHERE id = $1 AND status = 'processing' AND file_type <> 'audio'`, u.ID)
+	if err != nil {
+		slog.Warn("failed to record upload result", "file_id", u.ID, "error", err)
+	}
+}
+
+// sealUpload encrypts u's stored file under its workspace's key, when the
+// workspace has keys, once its handler has read it. Like an attachment's,
+// the file is sealed whole.
+func sealUpload(ctx context.Context, u Upload) error {
+	keys := keyring.Default()
+	if encrypted, err := keys.Enabled(ctx, u.Workspace); err != nil || !encrypted {
+		return err
+	}
+	data, err := os.ReadFile(u.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sealed, err := keys.Seal(ctx, u.Workspace, data)
+	if err != nil {
+		return err
+	}
+	tmp := u.path + ".sealing"
+	if err := os.WriteFile(tmp, sealed, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, u.path)
+}
+
+// openUpload opens u's stored file for download, decrypting it when it
+// was sealed.
+func openUpload(ctx context.Context, u Upload) (io.ReadSeeker, func(), error) {
+	f, err := os.Open(u.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	head := make([]byte, 64)
+	n, _ := io.ReadFull(f, head)
+	if !keyring.Sealed(head[:n]) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return f, func() { f.Close() }, nil
+	}
+	defer f.Close()
+	sealed, err := io.ReadAll(io.MultiReader(bytes.NewReader(head[:n]), f))
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := keyring.Default().Open(ctx, u.Workspace, sealed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(data), func() {}, nil
+}
+
+// respondDuplicate answers an upload of a file the workspace already has
+// with 409 and the ID of the first upload.
+func respondDuplicate(w http.ResponseWriter, dup *duplicateUploadError) {
+	slog.Info("rejected duplicate upload", "existing_file_id", dup.Existing.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(UploadResponse{
+		Success:  false,
+		Message:  "File already uploaded",
+		FileID:   dup.Existing.ID,
+		Filename: dup.Existing.Filename,
+		FileType: dup.Existing.FileType,
+		SHA256:   dup.Existing.SHA256,
+		Errors:   []string{dup.Error()},
+	})
+}
+
+// respondSaveError answers an upload that could not be saved, or was
+// turned away as a duplicate or as in progress, and reports whether it
+// did; the upload goes ahead when err is nil.
+func respondSaveError(w http.ResponseWriter, err error) bool {
+	var duplicate *duplicateUploadError
+	var inProgress *inProgressUploadError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &duplicate):
+		respondDuplicate(w, duplicate)
+	case errors.As(err, &inProgress):
+		respondInProgress(w, inProgress)
+	default:
+		respondWithError(w, "Failed to save file", err)
+	}
+	return true
+}
+
+// respondInProgress answers an upload of a file an earlier upload is still
+// processing with 202 and that upload's ID, so the caller can poll its
+// status at /uploads/{id} instead of having it processed twice.
+func respondInProgress(w http.ResponseWriter, e *inProgressUploadError) {
+	slog.Info("collapsed concurrent upload", "processing_file_id", e.Holder)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/uploads/"+e.Holder)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(UploadResponse{
+		Success: true,
+		Message: "File is being processed by an earlier upload",
+		FileID:  e.Holder,
+		Status:  "processing",
+	})
+}
+
+// uploadsHandler serves the originals of the workspace's uploads:
+//
+//	GET /uploads/{id}            the upload's record, with its SHA-256 and status
+//	GET /uploads/{id}/download   the file, with Range support
+func uploadsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, download := strings.CutSuffix(strings.Trim(strings.TrimPrefix(r.URL.Path, "/uploads"), "/"), "/download")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	db, ok := openPostgres()
+	if !ok {
+		http.Error(w, "Uploads are only recorded with Postgres storage", http.StatusNotImplemented)
+		return
+	}
+	defer db.Close()
+
+	u, err := findUpload(r.Context(), db, "id = $1 AND workspace_id = $2", id, requestWorkspace(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to look up upload", "file_id", id, "error", err)
+		http.Error(w, "Failed to look up upload", http.StatusInternalServerError)
+		return
+	}
+
+	if !download {
+		if u.Transcription, err = findTranscription(r.Context(), db, u.ID); err != nil && err != sql.ErrNoRows {
+			logging.FromContext(r.Context()).Warn("failed to look up transcription", "file_id", id, "error", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u)
+		return
+	}
+
+	f, closeFile, err := openUpload(r.Context(), u)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Upload no longer stored", http.StatusGone)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to open upload", "file_id", id, "error", err)
+		http.Error(w, "Failed to open upload", http.StatusInternalServerError)
+		return
+	}
+	defer closeFile()
+
+	// The checksum is a strong validator, so interrupted downloads can be
+	// resumed with Range and If-Range
+	w.Header().Set("ETag", `"`+u.SHA256+`"`)
+	w.Header().Set("X-Checksum-SHA256", u.SHA256)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(u.Filename)))
+	http.ServeContent(w, r, u.Filename, u.CreatedAt, f)
+}
+
+// UserUploadsDeletion is what deleting a user's uploads removed.
+type UserUploadsDeletion struct {
+	Uploads int   `json:"uploads"`
+	Files   int   `json:"files"`
+	Bytes   int64 `json:"bytes"`
+	// Content is the documents stored from the uploads
+	Content int64 `json:"content"`
+}
+
+// deleteUserUploads deletes the uploads userID made in every workspace:
+// their stored files, the documents stored from them and their records.
+// Items imported from chat exports are the workspace's messages and stay.
+func deleteUserUploads(ctx context.Context, db *sql.DB, userID string) (UserUploadsDeletion, error) {
+	var d UserUploadsDeletion
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return d, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM uploads WHERE user_id = $1 RETURNING id, stored_path`, userID)
+	if err != nil {
+		return d, fmt.Errorf("failed to delete upload records: %w", err)
+	}
+	var ids, paths []string
+	for rows.Next() {
+		var id, path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return d, err
+		}
+		ids = append(ids, "upload://"+id)
+		paths = append(paths, path)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+	d.Uploads = len(ids)
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM content_metadata WHERE source_url = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return d, fmt.Errorf("failed to delete uploaded documents: %w", err)
+	}
+	d.Content, _ = res.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		return d, err
+	}
+
+	// Files go once their records are gone, so none is left unlisted
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return d, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		d.Files++
+		d.Bytes += info.Size()
+	}
+	return d, nil
+}
+
+// userUploadsHandler serves DELETE /admin/users/{id}/uploads, the upload
+// part of the gateway's DELETE /admin/users/{id}/data.
+func userUploadsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+	userID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/uploads")
+	if !ok || userID == "" || strings.Contains(userID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	db, ok := openPostgres()
+	if !ok {
+		http.Error(w, "Uploads are only recorded with Postgres storage", http.StatusNotImplemented)
+		return
+	}
+	defer db.Close()
+
+	deleted, err := deleteUserUploads(r.Context(), db, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to delete user uploads", "user_id", userID, "error", err)
+		http.Error(w, "Failed to delete user uploads", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("deleted user uploads", "user_id", userID, "uploads", deleted.Uploads, "files", deleted.Files)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "deleted": deleted})
+}
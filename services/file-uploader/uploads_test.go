@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"selin/internal/config"
+	"selin/internal/keyring"
+)
+
+func TestSealUpload(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	t.Setenv(keyring.SecretName("sealed"), "k1:"+base64.StdEncoding.EncodeToString(key))
+	config.Secrets().Reload()
+	ctx := context.Background()
+
+	for _, workspace := range []string{"sealed", "plain"} {
+		u := Upload{ID: "u1", Workspace: workspace, path: filepath.Join(t.TempDir(), "notes.md")}
+		os.WriteFile(u.path, []byte("# Private notes"), 0644)
+		if err := sealUpload(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		stored, _ := os.ReadFile(u.path)
+		if keyring.Sealed(stored) != (workspace == "sealed") {
+			t.Errorf("%s: expected the file sealed only with keys, got %q", workspace, stored)
+		}
+
+		f, closeFile, err := openUpload(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(f)
+		closeFile()
+		if string(data) != "# Private notes" {
+			t.Errorf("%s: expected the original back for download, got %q", workspace, data)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"selin/internal/adminauth"
+	"selin/internal/errlog"
+	"selin/internal/logging"
+)
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// SystemStats describes the stored content across all workspaces, for the
+// gateway's /admin/system report.
+type SystemStats struct {
+	TotalContent     int              `json:"total_content"`
+	ByPlatform       map[string]int   `json:"by_platform"`
+	ByWorkspace      map[string]int   `json:"by_workspace"`
+	TopTags          []TagCount       `json:"top_tags"`
+	EmbeddingBacklog int              `json:"embedding_backlog"`
+	DatabaseBytes    int64            `json:"database_bytes"`
+	TableBytes       map[string]int64 `json:"table_bytes"`
+	RecentErrors     []errlog.Entry   `json:"recent_errors"`
+}
+
+func loadSystemStats(db *sql.DB) (*SystemStats, error) {
+	stats := &SystemStats{
+		ByPlatform:  map[string]int{},
+		ByWorkspace: map[string]int{},
+		TopTags:     []TagCount{},
+		TableBytes:  map[string]int64{},
+	}
+
+	if err := countInto(db, `
+		SELECT COALESCE(source_platform, 'unknown'), COUNT(*)
+		FROM content_metadata GROUP BY 1`, stats.ByPlatform); err != nil {
+		return nil, err
+	}
+	for _, n := range stats.ByPlatform {
+		stats.TotalContent += n
+	}
+	if err := countInto(db, `
+		SELECT workspace_id, COUNT(*) FROM content_metadata GROUP BY 1`, stats.ByWorkspace); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT tag, COUNT(*) FROM content_metadata, unnest(tags) AS tag
+		GROUP BY tag ORDER BY COUNT(*) DESC, tag LIMIT 20`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		stats.TopTags = append(stats.TopTags, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := db.QueryRow(`SELECT COUNT(*) FROM content_metadata WHERE embedded_at IS NULL`).Scan(&stats.EmbeddingBacklog); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow(`SELECT pg_database_size(current_database())`).Scan(&stats.DatabaseBytes); err != nil {
+		return nil, err
+	}
+
+	tables, err := db.Query(`SELECT relname, pg_total_relation_size(relid) FROM pg_stat_user_tables`)
+	if err != nil {
+		return nil, err
+	}
+	defer tables.Close()
+	for tables.Next() {
+		var name string
+		var size int64
+		if err := tables.Scan(&name, &size); err != nil {
+			return nil, err
+		}
+		stats.TableBytes[name] = size
+	}
+	return stats, tables.Err()
+}
+
+// countInto runs a "key, count" query into m.
+func countInto(db *sql.DB, query string, m map[string]int) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			return err
+		}
+		m[key] = n
+	}
+	return rows.Err()
+}
+
+// statsHandler serves GET /admin/stats.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	stats, err := loadSystemStats(db)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load system stats", "error", err)
+		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+	stats.RecentErrors = errlog.Recent()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"selin/internal/reputation"
+)
+
+func handleGetTopAuthors(args map[string]interface{}) MCPResponse {
+	topic, _ := args["topic"].(string)
+	limit := 10
+	if l, ok := args["limit"].(float64); ok && l > 0 && l <= 50 {
+		limit = int(l)
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	authors, err := reputation.Top(contextArg(args), db, workspaceArg(args), topic, limit)
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Failed to rank authors: %v", err))
+	}
+
+	var responseText strings.Builder
+	scope := "all topics"
+	if topic != "" {
+		scope = topic
+	}
+	if len(authors) == 0 {
+		responseText.WriteString(fmt.Sprintf("👤 No authors found for %s.", scope))
+	} else {
+		responseText.WriteString(fmt.Sprintf("👤 **Top Authors** for %s\n\n", scope))
+	}
+	for i, a := range authors {
+		responseText.WriteString(fmt.Sprintf("%d. **%s** (%s) — reputation %.2f\n", i+1, a.Author, a.Platform, a.Reputation))
+		responseText.WriteString(fmt.Sprintf("   %d items, average relevance %.2f, %d of %d rated items useful\n",
+			a.Items, a.AvgRelevance, a.Useful, a.Rated))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
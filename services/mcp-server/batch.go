@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxBatchCalls bounds how many tools one batch may run at once.
+const maxBatchCalls = 20
+
+// batchTimeout is the deadline a whole batch shares, MCP_BATCH_TIMEOUT.
+func batchTimeout() time.Duration {
+	return envDuration("MCP_BATCH_TIMEOUT", 30*time.Second)
+}
+
+// runBatch runs calls concurrently and returns their results in the same
+// order. Calls share one deadline, which cancels their context when it
+// passes; those that miss it are answered with an error, and their results
+// are dropped when they do finish.
+func runBatch(r *http.Request, calls []MCPRequest, timeout time.Duration) []MCPResponse {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	type result struct {
+		i        int
+		response MCPResponse
+	}
+	results := make([]MCPResponse, len(calls))
+	done := make([]bool, len(calls))
+	finished := make(chan result, len(calls))
+	for i, call := range calls {
+		go func(i int, call MCPRequest) {
+			if denied, ok := toolDenied(r, call.Name); ok {
+				finished <- result{i, denied}
+				return
+			}
+			finished <- result{i, callTool(r, call.Name, call.Arguments)}
+		}(i, call)
+	}
+
+	for pending := len(calls); pending > 0; pending-- {
+		select {
+		case res := <-finished:
+			results[res.i], done[res.i] = res.response, true
+		case <-ctx.Done():
+			for i, call := range calls {
+				if !done[i] {
+					results[i] = errorResponse(fmt.Sprintf("%s did not finish within %s", call.Name, timeout))
+				}
+			}
+			return results
+		}
+	}
+	return results
+}
+
+// batchHandler serves POST /mcp/call/batch: {"calls": [{"name": ...,
+// "arguments": {...}}, ...]}, answered with {"results": [...]} in the
+// order of the calls.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Calls []MCPRequest `json:"calls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Calls) == 0 || len(req.Calls) > maxBatchCalls {
+		http.Error(w, fmt.Sprintf("calls must hold 1 to %d tool calls", maxBatchCalls), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": runBatch(r, req.Calls, batchTimeout()),
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"selin/internal/rbac"
+)
+
+func TestBatchKeepsOrder(t *testing.T) {
+	r := httptest.NewRequest("POST", "/mcp/call/batch", strings.NewReader(`{"calls": [
+		{"name": "no_such_tool"},
+		{"name": "search_content", "arguments": {}},
+		{"name": "set_learning_goal", "arguments": {}}
+	]}`))
+	r.Header.Set(rbac.Header, "reader")
+	w := httptest.NewRecorder()
+	batchHandler(w, r)
+
+	var body struct {
+		Results []MCPResponse `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Unknown tool: no_such_tool", "Query parameter is required", "requires the editor role"}
+	if len(body.Results) != len(want) {
+		t.Fatalf("Expected %d results, got %+v", len(want), body.Results)
+	}
+	for i, text := range want {
+		if !body.Results[i].IsError || !strings.Contains(body.Results[i].Content[0].Text, text) {
+			t.Errorf("Result %d: expected %q, got %+v", i, text, body.Results[i])
+		}
+	}
+}
+
+func TestBatchRejectsBadRequests(t *testing.T) {
+	tooMany := `{"calls": [` + strings.Repeat(`{"name": "get_learning_goals"},`, maxBatchCalls) + `{"name": "get_learning_goals"}]}`
+	for _, body := range []string{`nonsense`, `{"calls": []}`, tooMany} {
+		w := httptest.NewRecorder()
+		batchHandler(w, httptest.NewRequest("POST", "/mcp/call/batch", strings.NewReader(body)))
+		if w.Code != 400 {
+			t.Errorf("Expected 400, got %d", w.Code)
+		}
+	}
+}
+
+func TestBatchDeadlineCancelsCalls(t *testing.T) {
+	cancelled := make(chan struct{})
+	saved := tools
+	t.Cleanup(func() { tools = saved })
+	tools = mustRegistry(append(builtinTools(), MCPTool{Name: "wait", InputSchema: map[string]interface{}{}, Handler: func(args map[string]interface{}) MCPResponse {
+		<-contextArg(args).Done()
+		close(cancelled)
+		return errorResponse("cancelled")
+	}}), toolConfig{})
+
+	r := httptest.NewRequest("POST", "/mcp/call/batch", nil)
+	results := runBatch(r, []MCPRequest{{Name: "wait"}}, 10*time.Millisecond)
+	if !results[0].IsError || !strings.Contains(results[0].Content[0].Text, "did not finish within") {
+		t.Errorf("Expected the call to miss the deadline, got %+v", results[0])
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the deadline to cancel the call's context")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"selin/internal/config"
+	"selin/internal/tokenizer"
+)
+
+// Tool results are cut to a budget so a large result set does not flood the
+// caller's context. Every tool takes max_chars or max_tokens, the latter
+// counted with the shared tokenizer; without them MCP_MAX_RESULT_CHARS
+// applies.
+const (
+	// charsPerToken approximates how many characters a token covers, to
+	// compare budgets given in both units.
+	charsPerToken = 4
+	// minBudget leaves room for at least a header and the trailer.
+	minBudget = 200
+	// compactLineLength is how much of a line a compacted result keeps.
+	compactLineLength = 160
+	// trailerReserve is kept free for the trailer while results are added.
+	trailerReserve = 180
+)
+
+// budgetArgs are the schema properties every tool accepts.
+var budgetArgs = map[string]interface{}{
+	"max_chars": map[string]interface{}{
+		"type":        "number",
+		"description": "Longest result to return, in characters; lower-ranked results are shortened, then left out",
+	},
+	"max_tokens": map[string]interface{}{
+		"type":        "number",
+		"description": "Longest result to return, in tokens; lower-ranked results are shortened, then left out",
+	},
+}
+
+// budget is how long a result may be: limit characters, or limit tokens
+// when tokens is set. A zero limit is no limit.
+type budget struct {
+	limit  int
+	tokens bool
+}
+
+// chars returns a budget of n characters.
+func chars(n int) budget { return budget{limit: n} }
+
+func (b budget) tokenizer() tokenizer.Tokenizer {
+	if b.tokens {
+		return tokenizer.Default()
+	}
+	return tokenizer.RuneCount
+}
+
+// length measures s in the budget's unit.
+func (b budget) length(s string) int {
+	return b.tokenizer().Count(s)
+}
+
+// scale converts a length in characters to the budget's unit.
+func (b budget) scale(n int) int {
+	if b.tokens {
+		return n / charsPerToken
+	}
+	return n
+}
+
+func (b budget) unit() string {
+	if b.tokens {
+		return "tokens"
+	}
+	return "characters"
+}
+
+// defaultBudget is MCP_MAX_RESULT_CHARS, 0 for no limit.
+func defaultBudget() budget {
+	n, err := strconv.Atoi(config.Env("MCP_MAX_RESULT_CHARS", "24000"))
+	if err != nil || n < 0 {
+		return chars(24000)
+	}
+	return chars(n)
+}
+
+// budgetArg reads the call's budget: max_chars or max_tokens, the tighter
+// of the two when both are given, else the default.
+func budgetArg(args map[string]interface{}) (budget, error) {
+	var given []budget
+	for _, name := range []string{"max_chars", "max_tokens"} {
+		v, ok := args[name]
+		if !ok {
+			continue
+		}
+		n, ok := v.(float64)
+		if !ok || n <= 0 {
+			return budget{}, fmt.Errorf("%s must be a positive number", name)
+		}
+		given = append(given, budget{limit: int(n), tokens: name == "max_tokens"})
+	}
+	if len(given) == 0 {
+		return defaultBudget(), nil
+	}
+	b := given[0]
+	if len(given) == 2 && given[1].limit*charsPerToken < b.limit {
+		b = given[1]
+	}
+	b.limit = max(b.limit, b.scale(minBudget))
+	return b, nil
+}
+
+// itemStart matches the first line of a numbered result, such as
+// "**3. Title**", "**3.** Title", "✅ **3.** ..." or "3. **author**".
+var itemStart = regexp.MustCompile(`^(?:\S+ )?(?:\*\*)?(\d+)\.`)
+
+// resultItem is one numbered result of a tool's output.
+type resultItem struct {
+	number int
+	lines  []string
+}
+
+// compact drops a result's indented body text, such as its summary, keeping
+// the first line, its "•" metadata, shortened, and blank separators.
+func (item resultItem) compact() string {
+	kept := []string{shorten(item.lines[0])}
+	for _, line := range item.lines[1:] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && (!strings.HasPrefix(trimmed, "•") || verboseField(trimmed)) {
+			continue
+		}
+		kept = append(kept, shorten(line))
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
+
+func (item resultItem) String() string {
+	return strings.Join(item.lines, "\n") + "\n"
+}
+
+// verboseField reports whether a "• Key: value" line holds body text rather
+// than metadata.
+func verboseField(line string) bool {
+	for _, key := range []string{"Summary:", "Text:", "Content:", "Why:", "Excerpt:"} {
+		if strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(line, "•")), key) {
+			return true
+		}
+	}
+	return false
+}
+
+func shorten(line string) string {
+	if utf8.RuneCountInString(line) <= compactLineLength {
+		return line
+	}
+	return string([]rune(line)[:compactLineLength-1]) + "…"
+}
+
+// splitResults splits a tool's output into the text before its first
+// numbered result, the results, and the text after the last one. A result
+// runs until the next one starts; the last one ends at a blank line.
+func splitResults(text string) (header string, items []resultItem, footer string) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var head []string
+	i := 0
+	for ; i < len(lines); i++ {
+		m := itemStart.FindStringSubmatch(lines[i])
+		if m == nil {
+			if len(items) == 0 {
+				head = append(head, lines[i])
+				continue
+			}
+			last := &items[len(items)-1]
+			if lines[i] == "" && i+1 < len(lines) && itemStart.FindStringSubmatch(lines[i+1]) == nil {
+				break
+			}
+			last.lines = append(last.lines, lines[i])
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		items = append(items, resultItem{number: n, lines: []string{lines[i]}})
+	}
+	if len(head) > 0 {
+		header = strings.Join(head, "\n") + "\n"
+	}
+	if i < len(lines) {
+		footer = strings.Join(lines[i:], "\n") + "\n"
+	}
+	return header, items, footer
+}
+
+// applyBudget cuts the text of a response to the budget. Numbered
+// results are kept whole in rank order while they fit; lower-ranked ones
+// lose their summaries, and those that still do not fit are left out,
+// with a trailer saying how many and how to get them. Errors are left
+// alone.
+func applyBudget(resp MCPResponse, budget budget, paged bool) MCPResponse {
+	if budget.limit <= 0 || resp.IsError {
+		return resp
+	}
+	for i, content := range resp.Content {
+		if content.Type == "text" && budget.length(content.Text) > budget.limit {
+			resp.Content[i].Text = truncateText(content.Text, budget, paged)
+		}
+	}
+	return resp
+}
+
+func truncateText(text string, budget budget, paged bool) string {
+	header, items, footer := splitResults(text)
+	reserve := budget.scale(trailerReserve)
+	if len(items) == 0 || budget.length(header)+reserve > budget.limit {
+		return cutText(text, budget)
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	used := budget.length(header)
+	fits := func(s string) bool { return used+budget.length(s)+reserve <= budget.limit }
+	write := func(s string) {
+		b.WriteString(s)
+		used += budget.length(s)
+	}
+
+	compacted, shown := 0, 0
+	for _, item := range items {
+		// Once a result is compacted, lower-ranked ones are too, so the
+		// output stays in rank order
+		if full := item.String(); compacted == 0 && fits(full) {
+			write(full)
+		} else if short := item.compact(); fits(short) {
+			write(short)
+			compacted++
+		} else {
+			break
+		}
+		shown++
+	}
+
+	omitted := items[shown:]
+	if len(omitted) == 0 && fits(footer) {
+		write(footer)
+	} else {
+		// A footer about paging would point past the results left out
+		for _, line := range strings.Split(footer, "\n") {
+			if line != "" && !strings.Contains(line, "offset") && fits(line+"\n") {
+				write(line + "\n")
+			}
+		}
+	}
+
+	switch {
+	case len(omitted) > 0 && paged:
+		fmt.Fprintf(&b, "\n✂️ %d more results left out to stay within %d %s: call again with offset %d, or raise max_chars or max_tokens\n",
+			len(omitted), budget.limit, budget.unit(), omitted[0].number-1)
+	case len(omitted) > 0:
+		fmt.Fprintf(&b, "\n✂️ %d more results left out to stay within %d %s: narrow the request, or raise max_chars or max_tokens\n",
+			len(omitted), budget.limit, budget.unit())
+	case compacted > 0:
+		fmt.Fprintf(&b, "\n✂️ Summaries of the last %d results left out to stay within %d %s\n", compacted, budget.limit, budget.unit())
+	}
+	return b.String()
+}
+
+// cutText cuts unstructured text at the last line break that fits.
+func cutText(text string, budget budget) string {
+	trailer := fmt.Sprintf("\n✂️ Output cut to %d of %d %s: raise max_chars or max_tokens to see the rest\n",
+		budget.limit, budget.length(text), budget.unit())
+	keep := max(budget.limit-budget.length(trailer), 0)
+	cut := tokenizer.Truncate(budget.tokenizer(), text, keep)
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i+1]
+	}
+	return cut + trailer
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"selin/internal/tokenizer"
+)
+
+// searchOutput mimics search_content: a header, numbered results with
+// metadata and a summary, and a paging footer.
+func searchOutput(n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔍 Found %d results for 'cosmos'\n\n", n*2)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "**%d. Result** (Score: 0.90)\n", i)
+		fmt.Fprintf(&b, "   • ID: id-%d\n", i)
+		fmt.Fprintf(&b, "   • Summary: %s\n", strings.Repeat("long summary text ", 20))
+		fmt.Fprintf(&b, "   • URL: https://example.com/%d\n\n", i)
+	}
+	fmt.Fprintf(&b, "More results available: call again with offset %d\n", n)
+	return b.String()
+}
+
+func TestBudgetArg(t *testing.T) {
+	t.Setenv("MCP_MAX_RESULT_CHARS", "")
+	tests := []struct {
+		args map[string]interface{}
+		want budget
+	}{
+		{map[string]interface{}{}, chars(24000)},
+		{map[string]interface{}{"max_chars": float64(5000)}, chars(5000)},
+		{map[string]interface{}{"max_tokens": float64(1000)}, budget{limit: 1000, tokens: true}},
+		{map[string]interface{}{"max_chars": float64(3000), "max_tokens": float64(1000)}, chars(3000)},
+		{map[string]interface{}{"max_chars": float64(5000), "max_tokens": float64(1000)}, budget{limit: 1000, tokens: true}},
+		{map[string]interface{}{"max_chars": float64(10)}, chars(minBudget)},
+		{map[string]interface{}{"max_tokens": float64(10)}, budget{limit: minBudget / charsPerToken, tokens: true}},
+	}
+	for _, tt := range tests {
+		if got, err := budgetArg(tt.args); err != nil || got != tt.want {
+			t.Errorf("%v: expected %+v, got %+v (%v)", tt.args, tt.want, got, err)
+		}
+	}
+	for _, args := range []map[string]interface{}{{"max_chars": float64(0)}, {"max_tokens": "lots"}} {
+		if _, err := budgetArg(args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+
+	t.Setenv("MCP_MAX_RESULT_CHARS", "0")
+	if got, _ := budgetArg(map[string]interface{}{}); got.limit != 0 {
+		t.Errorf("Expected MCP_MAX_RESULT_CHARS=0 to turn the budget off, got %+v", got)
+	}
+}
+
+func TestApplyBudgetLeavesSmallResultsAlone(t *testing.T) {
+	text := searchOutput(2)
+	resp := applyBudget(MCPResponse{Content: []MCPContent{{Type: "text", Text: text}}}, chars(10000), true)
+	if resp.Content[0].Text != text {
+		t.Errorf("Expected the result unchanged, got:\n%s", resp.Content[0].Text)
+	}
+}
+
+func TestApplyBudgetKeepsTopResultsWhole(t *testing.T) {
+	text := searchOutput(20)
+	budget := 2000
+	out := applyBudget(MCPResponse{Content: []MCPContent{{Type: "text", Text: text}}}, chars(budget), true).Content[0].Text
+
+	if n := utf8.RuneCountInString(out); n > budget {
+		t.Errorf("Expected at most %d characters, got %d", budget, n)
+	}
+	if !strings.HasPrefix(out, "🔍 Found 40 results") {
+		t.Errorf("Expected the header to be kept:\n%s", out)
+	}
+	// The first result keeps its summary, lower-ranked ones only metadata
+	first := out[:strings.Index(out, "**2.")]
+	if !strings.Contains(first, "Summary:") {
+		t.Errorf("Expected the top result whole:\n%s", first)
+	}
+	if strings.Count(out, "Summary:") == strings.Count(out, "**") {
+		t.Errorf("Expected lower-ranked summaries to be dropped:\n%s", out)
+	}
+	if !strings.Contains(out, "• ID: id-") || !strings.Contains(out, "more results left out") {
+		t.Errorf("Expected compacted results and a trailer:\n%s", out)
+	}
+	if strings.Contains(out, "More results available") {
+		t.Errorf("Expected the stale paging footer to be dropped:\n%s", out)
+	}
+
+	// The trailer points at the first result left out
+	shown := strings.Count(out, "• ID: id-")
+	if want := fmt.Sprintf("call again with offset %d", shown); !strings.Contains(out, want) {
+		t.Errorf("Expected %q in the trailer:\n%s", want, out)
+	}
+}
+
+func TestApplyBudgetWithoutPaging(t *testing.T) {
+	out := truncateText(searchOutput(20), chars(1000), false)
+	if strings.Contains(out, "offset") || !strings.Contains(out, "narrow the request") {
+		t.Errorf("Expected no offset hint for a tool without paging:\n%s", out)
+	}
+}
+
+func TestApplyBudgetCutsUnstructuredText(t *testing.T) {
+	text := strings.Repeat("A line of progress report text\n", 100)
+	out := applyBudget(MCPResponse{Content: []MCPContent{{Type: "text", Text: text}}}, chars(500), false).Content[0].Text
+	if n := utf8.RuneCountInString(out); n > 500 {
+		t.Errorf("Expected at most 500 characters, got %d", n)
+	}
+	if !strings.Contains(out, "Output cut to 500 of") || !strings.HasPrefix(out, "A line of progress report text\n") {
+		t.Errorf("Unexpected cut:\n%s", out)
+	}
+}
+
+func TestApplyBudgetCountsTokens(t *testing.T) {
+	text := searchOutput(20)
+	out := applyBudget(MCPResponse{Content: []MCPContent{{Type: "text", Text: text}}}, budget{limit: 500, tokens: true}, true).Content[0].Text
+	if n := tokenizer.Default().Count(out); n > 500 {
+		t.Errorf("Expected at most 500 tokens, got %d", n)
+	}
+	if !strings.Contains(out, "to stay within 500 tokens") {
+		t.Errorf("Expected the trailer to give the budget in tokens:\n%s", out)
+	}
+}
+
+func TestApplyBudgetLeavesErrorsAlone(t *testing.T) {
+	resp := errorResponse(strings.Repeat("x", 1000))
+	if got := applyBudget(resp, chars(300), false); got.Content[0].Text != resp.Content[0].Text {
+		t.Error("Expected errors to be returned whole")
+	}
+}
+
+func TestToolsTakeBudgetArgs(t *testing.T) {
+	for _, tool := range tools.list() {
+		props := tool.InputSchema["properties"].(map[string]interface{})
+		if props["max_chars"] == nil || props["max_tokens"] == nil {
+			t.Errorf("Expected %s to take max_chars and max_tokens", tool.Name)
+		}
+	}
+	search, _ := tools.lookup("search_content")
+	progress, _ := tools.lookup("get_learning_progress")
+	if !search.paged() || progress.paged() {
+		t.Error("Expected only search_content of the two to page")
+	}
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+	"selin/internal/search"
+)
+
+const (
+	// maxCollectionItems keeps a collection within one search page, so it
+	// can be loaded, exported and searched as a whole.
+	maxCollectionItems = search.MaxLimit
+	maxCollectionName  = 100
+)
+
+var (
+	errCollectionNotFound = fmt.Errorf("collection not found")
+	errCollectionExists   = fmt.Errorf("a collection with that name already exists")
+)
+
+// Collection is a named set of content the user curated by hand, such as
+// "IBC deep dive". It can be exported, shared by token, and searched on its
+// own with search_content's collection argument.
+type Collection struct {
+	ID          string           `json:"id"`
+	WorkspaceID string           `json:"workspace_id"`
+	UserID      string           `json:"user_id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	ShareToken  string           `json:"share_token,omitempty"`
+	ItemCount   int              `json:"item_count"`
+	CreatedAt   time.Time        `json:"created_at"`
+	Items       []CollectionItem `json:"items,omitempty"`
+	// Withheld is how many private items an export or share left out.
+	Withheld int `json:"withheld,omitempty"`
+}
+
+// CollectionItem is a content item in a collection, with the note it was
+// added with.
+type CollectionItem struct {
+	search.Item
+	Note    string    `json:"note,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// normalizeCollection validates c and trims its name and description.
+func normalizeCollection(c *Collection) error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(c.Name) > maxCollectionName {
+		return fmt.Errorf("name must be at most %d characters", maxCollectionName)
+	}
+	if len(c.Description) > 2000 {
+		return fmt.Errorf("description must be at most 2000 characters")
+	}
+	return nil
+}
+
+// contentIDsArg reads a list of content IDs, rejecting anything that is not
+// a content UUID.
+func contentIDsArg(v interface{}) ([]string, error) {
+	list, _ := v.([]interface{})
+	var ids []string
+	for _, item := range list {
+		id, _ := item.(string)
+		if !uuidPattern.MatchString(id) {
+			return nil, fmt.Errorf("content_ids must be content UUIDs, got %v", item)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("content_ids must list at least one content ID")
+	}
+	return ids, nil
+}
+
+func createCollection(db *sql.DB, c *Collection) error {
+	// The name is unique per user, ignoring case
+	err := db.QueryRow(`
+		INSERT INTO collections (workspace_id, user_id, name, description)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at`,
+		c.WorkspaceID, c.UserID, c.Name, c.Description).Scan(&c.ID, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return errCollectionExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %v", err)
+	}
+	return nil
+}
+
+const collectionColumns = `c.id, c.workspace_id, c.user_id, c.name, c.description, COALESCE(c.share_token, ''), c.created_at,
+	(SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = c.id)`
+
+func scanCollection(row interface{ Scan(...interface{}) error }) (Collection, error) {
+	var c Collection
+	err := row.Scan(&c.ID, &c.WorkspaceID, &c.UserID, &c.Name, &c.Description, &c.ShareToken, &c.CreatedAt, &c.ItemCount)
+	return c, err
+}
+
+// findCollection looks a collection up by ID or, case-insensitively, by
+// name, so tools can refer to "IBC deep dive" directly.
+func findCollection(db *sql.DB, workspace, userID, ref string) (Collection, error) {
+	ref = strings.TrimSpace(ref)
+	cond := "lower(c.name) = lower($3)"
+	if uuidPattern.MatchString(ref) {
+		cond = "c.id = $3"
+	}
+	c, err := scanCollection(db.QueryRow(`SELECT `+collectionColumns+` FROM collections c
+		WHERE c.workspace_id = $1 AND c.user_id = $2 AND `+cond, workspace, userID, ref))
+	if err == sql.ErrNoRows {
+		return c, errCollectionNotFound
+	}
+	return c, err
+}
+
+// sharedCollection looks a collection up by its share token.
+func sharedCollection(db *sql.DB, token string) (Collection, error) {
+	c, err := scanCollection(db.QueryRow(`SELECT `+collectionColumns+` FROM collections c WHERE c.share_token = $1`, token))
+	if err == sql.ErrNoRows {
+		return c, errCollectionNotFound
+	}
+	return c, err
+}
+
+// listCollections returns the user's collections in a workspace, most
+// recently changed first.
+func listCollections(db *sql.DB, workspace, userID string) ([]Collection, error) {
+	rows, err := db.Query(`SELECT `+collectionColumns+` FROM collections c
+		WHERE c.workspace_id = $1 AND c.user_id = $2 ORDER BY c.updated_at DESC, c.name`, workspace, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %v", err)
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list collections: %v", err)
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// addToCollection adds content from the collection's workspace, returning
+// how many items were new. Every ID must exist, so a mistyped one is
+// reported rather than silently left out.
+func addToCollection(db *sql.DB, c *Collection, ids []string, note string) (int, error) {
+	rows, err := db.Query(`SELECT id FROM content_metadata WHERE workspace_id = $1 AND id::text = ANY(string_to_array($2, ','))`,
+		c.WorkspaceID, strings.Join(ids, ","))
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up content: %v", err)
+	}
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			found[strings.ToLower(id)] = true
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		if !found[strings.ToLower(id)] {
+			return 0, fmt.Errorf("%w: %s", errContentNotFound, id)
+		}
+	}
+	if c.ItemCount+len(ids) > maxCollectionItems {
+		return 0, fmt.Errorf("a collection holds at most %d items; %s has %d", maxCollectionItems, c.Name, c.ItemCount)
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO collection_items (collection_id, content_id, note)
+		SELECT $1, id, $2 FROM unnest(string_to_array($3, ',')::uuid[]) AS id
+		ON CONFLICT (collection_id, content_id) DO NOTHING`,
+		c.ID, strings.TrimSpace(note), strings.Join(ids, ","))
+	if err != nil {
+		return 0, fmt.Errorf("failed to add to collection: %v", err)
+	}
+	added, _ := res.RowsAffected()
+	if _, err := db.Exec(`UPDATE collections SET updated_at = now() WHERE id = $1`, c.ID); err != nil {
+		return 0, fmt.Errorf("failed to update collection: %v", err)
+	}
+	c.ItemCount += int(added)
+	return int(added), nil
+}
+
+// loadCollectionItems fills in c.Items in the order they were added.
+func loadCollectionItems(ctx context.Context, db *sql.DB, c *Collection) error {
+	rows, err := db.QueryContext(ctx, `SELECT content_id, note, added_at FROM collection_items
+		WHERE collection_id = $1 ORDER BY added_at, content_id`, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load collection: %v", err)
+	}
+	var entries []CollectionItem
+	for rows.Next() {
+		var e CollectionItem
+		if err := rows.Scan(&e.ID, &e.Note, &e.AddedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to load collection: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	c.Items = []CollectionItem{}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	found, err := search.Search(ctx, db, search.SearchRequest{Workspace: c.WorkspaceID, IDs: ids, Limit: maxCollectionItems})
+	if err != nil {
+		return fmt.Errorf("failed to load collection content: %v", err)
+	}
+	c.Items = orderCollectionItems(entries, found.Items)
+	c.ItemCount = len(c.Items)
+	return nil
+}
+
+// orderCollectionItems fills in each entry's content, keeping the entries'
+// order and dropping any whose content is gone.
+func orderCollectionItems(entries []CollectionItem, items []search.Item) []CollectionItem {
+	byID := make(map[string]search.Item, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	out := []CollectionItem{}
+	for _, e := range entries {
+		item, ok := byID[e.ID]
+		if !ok {
+			continue
+		}
+		e.Item = item
+		out = append(out, e)
+	}
+	return out
+}
+
+// collectionIDs returns the content IDs in a collection, for searching it.
+func collectionIDs(db *sql.DB, c Collection) ([]string, error) {
+	rows, err := db.Query(`SELECT content_id FROM collection_items WHERE collection_id = $1`, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collection: %v", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to load collection: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// setCollectionShared creates the collection's share token, keeping an
+// existing one, or revokes it.
+func setCollectionShared(db *sql.DB, c *Collection, shared bool) error {
+	if !shared {
+		c.ShareToken = ""
+		_, err := db.Exec(`UPDATE collections SET share_token = NULL, updated_at = now() WHERE id = $1`, c.ID)
+		return err
+	}
+	if c.ShareToken != "" {
+		return nil
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("failed to create share token: %v", err)
+	}
+	c.ShareToken = hex.EncodeToString(raw)
+	_, err := db.Exec(`UPDATE collections SET share_token = $2, updated_at = now() WHERE id = $1`, c.ID, c.ShareToken)
+	return err
+}
+
+// withholdPrivate drops the private items from a loaded collection about
+// to leave the system, as an export or a share.
+func withholdPrivate(c *Collection) {
+	kept := c.Items[:0]
+	for _, item := range c.Items {
+		if item.Visibility == search.VisibilityPrivate {
+			c.Withheld++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	c.Items = kept
+	c.ItemCount = len(kept)
+}
+
+// collectionMarkdown exports a loaded collection as a Markdown reading
+// list.
+func collectionMarkdown(c Collection) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", c.Name)
+	if c.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", c.Description)
+	}
+	if c.Withheld > 0 {
+		fmt.Fprintf(&b, "_Private items left out: %d._\n\n", c.Withheld)
+	}
+	if len(c.Items) == 0 {
+		b.WriteString("_This collection is empty._\n")
+		return b.String()
+	}
+	for i, item := range c.Items {
+		title := item.ContentSummary
+		if title == "" {
+			title = item.SourceURL
+		}
+		if line, _, cut := strings.Cut(title, "\n"); cut {
+			title = line
+		}
+		fmt.Fprintf(&b, "%d. [%s](%s)", i+1, title, item.SourceURL)
+		var meta []string
+		if item.Author != "" {
+			meta = append(meta, item.Author)
+		}
+		if item.SourcePlatform != "" {
+			meta = append(meta, item.SourcePlatform)
+		}
+		meta = append(meta, item.Timestamp.Format("2006-01-02"))
+		fmt.Fprintf(&b, " — %s\n", strings.Join(meta, ", "))
+		if len(item.Tags) > 0 {
+			fmt.Fprintf(&b, "   - Tags: %s\n", strings.Join(item.Tags, ", "))
+		}
+		if item.Note != "" {
+			fmt.Fprintf(&b, "   - Note: %s\n", item.Note)
+		}
+	}
+	return b.String()
+}
+
+// writeCollection answers with the loaded collection as JSON, or as
+// Markdown with ?format=markdown. A Markdown export leaves out private
+// items.
+func writeCollection(w http.ResponseWriter, r *http.Request, c Collection) {
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	case "markdown":
+		withholdPrivate(&c)
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(collectionMarkdown(c)))
+	default:
+		http.Error(w, "format must be json or markdown", http.StatusBadRequest)
+	}
+}
+
+// collectionsHandler serves the collection API:
+//
+//	GET    /collections                    list collections
+//	POST   /collections                    create a collection
+//	GET    /collections/{id}?format=       export it as json or markdown
+//	DELETE /collections/{id}               delete it
+//	POST   /collections/{id}/items         add {"content_ids": [...], "note": ...}
+//	POST   /collections/{id}/share         create a share token
+//	DELETE /collections/{id}/share         revoke the share token
+func collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/collections"), "/")
+	id, action, _ := strings.Cut(path, "/")
+	if id != "" && !uuidPattern.MatchString(id) || action != "" && action != "items" && action != "share" {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = defaultUserID
+	}
+	workspace := requestWorkspace(r)
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	fail := func(message string, err error) {
+		logging.FromContext(r.Context()).Error("collection request failed", "error", err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			collections, err := listCollections(db, workspace, userID)
+			if err != nil {
+				fail("Failed to list collections", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "collections": collections})
+		case http.MethodPost:
+			c := Collection{WorkspaceID: workspace, UserID: userID}
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			c.WorkspaceID, c.UserID = workspace, userID
+			if err := normalizeCollection(&c); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := createCollection(db, &c); err == errCollectionExists {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			} else if err != nil {
+				fail("Failed to create collection", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(c)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	c, err := findCollection(db, workspace, userID, id)
+	if err == errCollectionNotFound {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fail("Failed to load collection", err)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		if err := loadCollectionItems(r.Context(), db, &c); err != nil {
+			fail("Failed to load collection", err)
+			return
+		}
+		writeCollection(w, r, c)
+
+	case action == "" && r.Method == http.MethodDelete:
+		if _, err := db.Exec(`DELETE FROM collections WHERE id = $1`, c.ID); err != nil {
+			fail("Failed to delete collection", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "items" && r.Method == http.MethodPost:
+		var req struct {
+			ContentIDs []interface{} `json:"content_ids"`
+			Note       string        `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		ids, err := contentIDsArg(req.ContentIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, err := addToCollection(db, &c, ids, req.Note)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"added": added, "item_count": c.ItemCount})
+
+	case action == "share" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		if err := setCollectionShared(db, &c, r.Method == http.MethodPost); err != nil {
+			fail("Failed to update sharing", err)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"share_token": c.ShareToken,
+			"path":        "/shared/collections/" + c.ShareToken,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// sharedCollectionHandler serves GET /shared/collections/{token}, a
+// read-only export of a shared collection for anyone holding the token.
+func sharedCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.Trim(strings.TrimPrefix(r.URL.Path, "/shared/collections"), "/")
+	if token == "" {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	c, err := sharedCollection(db, token)
+	if err == nil {
+		err = loadCollectionItems(r.Context(), db, &c)
+	}
+	if err == errCollectionNotFound {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("shared collection request failed", "error", err)
+		http.Error(w, "Failed to load collection", http.StatusInternalServerError)
+		return
+	}
+	// The owner's details and private items stay in the system
+	c.UserID, c.ShareToken = "", ""
+	withholdPrivate(&c)
+	writeCollection(w, r, c)
+}
+
+func handleCreateCollection(args map[string]interface{}) MCPResponse {
+	c := Collection{WorkspaceID: workspaceArg(args), UserID: defaultUserID}
+	c.Name, _ = args["name"].(string)
+	c.Description, _ = args["description"].(string)
+	if err := normalizeCollection(&c); err != nil {
+		return errorResponse(err.Error())
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	if err := createCollection(db, &c); err != nil {
+		return errorResponse(err.Error())
+	}
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: fmt.Sprintf("📚 Collection created: **%s**\n   • Collection ID: %s\n\nAdd content to it with add_to_collection.", c.Name, c.ID),
+		}},
+	}
+}
+
+func handleAddToCollection(args map[string]interface{}) MCPResponse {
+	ref, _ := args["collection"].(string)
+	if strings.TrimSpace(ref) == "" {
+		return errorResponse("collection is required")
+	}
+	ids, err := contentIDsArg(args["content_ids"])
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+	note, _ := args["note"].(string)
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	c, err := findCollection(db, workspaceArg(args), defaultUserID, ref)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+	added, err := addToCollection(db, &c, ids, note)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	text := fmt.Sprintf("📚 Added %d item(s) to **%s**, which now holds %d", added, c.Name, c.ItemCount)
+	if skipped := len(ids) - added; skipped > 0 {
+		text += fmt.Sprintf(" (%d already in it)", skipped)
+	}
+	return MCPResponse{Content: []MCPContent{{Type: "text", Text: text}}}
+}
+
+func handleGetCollection(args map[string]interface{}) MCPResponse {
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	workspace := workspaceArg(args)
+	ref, _ := args["collection"].(string)
+	if strings.TrimSpace(ref) == "" {
+		collections, err := listCollections(db, workspace, defaultUserID)
+		if err != nil {
+			return errorResponse(err.Error())
+		}
+		if len(collections) == 0 {
+			return MCPResponse{Content: []MCPContent{{Type: "text", Text: "📚 No collections yet. Create one with create_collection!"}}}
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "📚 **Collections** (%d)\n\n", len(collections))
+		for i, c := range collections {
+			fmt.Fprintf(&b, "**%d. %s** — %d items\n", i+1, c.Name, c.ItemCount)
+			if c.Description != "" {
+				fmt.Fprintf(&b, "   • Description: %s\n", c.Description)
+			}
+			fmt.Fprintf(&b, "   • Collection ID: %s\n\n", c.ID)
+		}
+		return MCPResponse{Content: []MCPContent{{Type: "text", Text: b.String()}}}
+	}
+
+	c, err := findCollection(db, workspace, defaultUserID, ref)
+	if err == nil {
+		err = loadCollectionItems(contextArg(args), db, &c)
+	}
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	if format, _ := args["format"].(string); format == "markdown" {
+		withholdPrivate(&c)
+		return MCPResponse{Content: []MCPContent{{Type: "text", Text: collectionMarkdown(c)}}}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📚 **%s** (%d items)\n", c.Name, len(c.Items))
+	if c.Description != "" {
+		fmt.Fprintf(&b, "%s\n", c.Description)
+	}
+	b.WriteString("\n")
+	for i, item := range c.Items {
+		fmt.Fprintf(&b, "**%d. %s**\n", i+1, strings.Split(item.ContentSummary, " ")[0])
+		fmt.Fprintf(&b, "   • ID: %s\n", item.ID)
+		fmt.Fprintf(&b, "   • Platform: %s\n", item.SourcePlatform)
+		fmt.Fprintf(&b, "   • Tags: %s\n", strings.Join(item.Tags, ", "))
+		if item.Note != "" {
+			fmt.Fprintf(&b, "   • Note: %s\n", item.Note)
+		}
+		fmt.Fprintf(&b, "   • Summary: %s\n", item.ContentSummary)
+		fmt.Fprintf(&b, "   • URL: %s\n\n", item.SourceURL)
+	}
+	if len(c.Items) > 0 {
+		fmt.Fprintf(&b, "Search within it with search_content and collection \"%s\".\n", c.Name)
+	}
+	return MCPResponse{Content: []MCPContent{{Type: "text", Text: b.String()}}}
+}
+
+// collectionArg resolves search_content's collection argument to the
+// content IDs to search and the collection's name.
+func collectionArg(workspace, ref string) ([]string, string, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return nil, "", fmt.Errorf("database connection failed: %v", err)
+	}
+	defer db.Close()
+
+	c, err := findCollection(db, workspace, defaultUserID, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	ids, err := collectionIDs(db, c)
+	return ids, c.Name, err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"selin/internal/search"
+)
+
+func TestNormalizeCollection(t *testing.T) {
+	c := Collection{Name: "  IBC deep dive ", Description: " Relayers and light clients\n"}
+	if err := normalizeCollection(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "IBC deep dive" || c.Description != "Relayers and light clients" {
+		t.Errorf("Expected trimmed name and description, got %+v", c)
+	}
+	for _, bad := range []Collection{{Name: " "}, {Name: strings.Repeat("x", maxCollectionName+1)}} {
+		if err := normalizeCollection(&bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad.Name)
+		}
+	}
+}
+
+func TestContentIDsArg(t *testing.T) {
+	id := "6f1c1f9e-9a59-4f7e-8f0a-3c1d2b4e5a6f"
+	ids, err := contentIDsArg([]interface{}{id})
+	if err != nil || len(ids) != 1 || ids[0] != id {
+		t.Errorf("Expected [%s], got %v (%v)", id, ids, err)
+	}
+	for _, bad := range []interface{}{nil, []interface{}{}, []interface{}{"not-an-id"}, []interface{}{id, 42.0}} {
+		if _, err := contentIDsArg(bad); err == nil {
+			t.Errorf("Expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestOrderCollectionItems(t *testing.T) {
+	entries := []CollectionItem{{Item: search.Item{ID: "b"}, Note: "first"}, {Item: search.Item{ID: "gone"}}, {Item: search.Item{ID: "a"}}}
+	items := []search.Item{{ID: "a", SourceURL: "https://a"}, {ID: "b", SourceURL: "https://b"}}
+
+	got := orderCollectionItems(entries, items)
+	if len(got) != 2 || got[0].ID != "b" || got[1].ID != "a" {
+		t.Fatalf("Expected b then a in the order added, got %+v", got)
+	}
+	if got[0].Note != "first" || got[0].SourceURL != "https://b" {
+		t.Errorf("Expected the note kept and the content filled in, got %+v", got[0])
+	}
+}
+
+func TestCollectionMarkdown(t *testing.T) {
+	c := Collection{
+		Name:        "IBC deep dive",
+		Description: "Everything on relayers",
+		Items: []CollectionItem{{
+			Item: search.Item{
+				SourceURL:      "https://example.com/relayers",
+				Author:         "alice",
+				SourcePlatform: "reddit",
+				Timestamp:      time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+				Tags:           []string{"ibc", "cosmos"},
+				ContentSummary: "How IBC relayers work\nMore detail",
+			},
+			Note: "Start here",
+		}},
+	}
+	want := "# IBC deep dive\n\nEverything on relayers\n\n" +
+		"1. [How IBC relayers work](https://example.com/relayers) — alice, reddit, 2026-03-01\n" +
+		"   - Tags: ibc, cosmos\n" +
+		"   - Note: Start here\n"
+	if got := collectionMarkdown(c); got != want {
+		t.Errorf("Unexpected export:\n%s", got)
+	}
+
+	if got := collectionMarkdown(Collection{Name: "Empty"}); !strings.Contains(got, "empty") {
+		t.Errorf("Expected an empty collection to say so:\n%s", got)
+	}
+}
+
+func TestWithholdPrivate(t *testing.T) {
+	c := Collection{Items: []CollectionItem{
+		{Item: search.Item{ID: "a", Visibility: search.VisibilityPublic}},
+		{Item: search.Item{ID: "b", Visibility: search.VisibilityPrivate}},
+		{Item: search.Item{ID: "c", Visibility: search.VisibilityPublic}},
+	}, ItemCount: 3}
+
+	withholdPrivate(&c)
+	if len(c.Items) != 2 || c.Items[0].ID != "a" || c.Items[1].ID != "c" || c.ItemCount != 2 || c.Withheld != 1 {
+		t.Fatalf("Expected the private item withheld, got %+v", c)
+	}
+	if got := collectionMarkdown(c); !strings.Contains(got, "Private items left out: 1.") {
+		t.Errorf("Expected the export to say an item was left out:\n%s", got)
+	}
+}
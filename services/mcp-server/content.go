@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/config"
+	"selin/internal/links"
+	"selin/internal/logging"
+	"selin/internal/search"
+	"selin/internal/storage"
+)
+
+// defaultFreshness is the half-life in days searches decay rank by with
+// age, unless a request sets its own: SEARCH_HALF_LIFE_DAYS (60), where 0
+// turns decay off.
+func defaultFreshness() float64 {
+	days, err := strconv.ParseFloat(config.Env("SEARCH_HALF_LIFE_DAYS", "60"), 64)
+	if err != nil || days < 0 {
+		return 60
+	}
+	return days
+}
+
+// searchVectors find similar content for the hybrid ranker when a vector
+// store is configured; set up by main.
+var searchVectors search.Vectors
+
+// searchStaleness penalizes and flags content on fast-moving topics past its
+// age limit; main loads it from STALENESS_POLICY_FILE.
+var searchStaleness = search.DefaultStaleness()
+
+// searchRanking returns the hybrid ranker's weights for a search, or nil
+// for the classic ranker. Searches use SEARCH_RANKER (classic or hybrid)
+// with SEARCH_WEIGHTS over search.DefaultWeights unless they pick a ranker;
+// weights of their own also pick the hybrid ranker.
+func searchRanking(ranker, weights string) (*search.Weights, error) {
+	base, err := search.ParseWeights(config.Env("SEARCH_WEIGHTS", ""), search.DefaultWeights)
+	if err != nil {
+		return nil, fmt.Errorf("SEARCH_WEIGHTS: %w", err)
+	}
+	if ranker == "" {
+		ranker = config.Env("SEARCH_RANKER", "classic")
+		if weights != "" {
+			ranker = "hybrid"
+		}
+	}
+	switch ranker {
+	case "classic":
+		if weights != "" {
+			return nil, fmt.Errorf("weights only apply to the hybrid ranker")
+		}
+		return nil, nil
+	case "hybrid":
+		w, err := search.ParseWeights(weights, base)
+		if err != nil {
+			return nil, err
+		}
+		return &w, nil
+	}
+	return nil, fmt.Errorf("ranker must be classic or hybrid")
+}
+
+// halfLife converts a freshness in days to a search half-life.
+func halfLife(days float64) time.Duration {
+	return time.Duration(days * float64(24*time.Hour))
+}
+
+// searchRequest reads the /content query parameters: q, tags (comma
+// separated), platform, visibility (public, private or all), since (RFC 3339 or YYYY-MM-DD), freshness (the
+// half-life in days, 0 for none), facets (true to count matches by
+// platform, tag, content type and month), ranker (classic or hybrid),
+// weights (the hybrid ranker's, as keyword=0.6,vector=0.4), limit and
+// offset.
+func searchRequest(r *http.Request) (search.SearchRequest, error) {
+	q := r.URL.Query()
+	req := search.SearchRequest{
+		Workspace:  requestWorkspace(r),
+		Query:      q.Get("q"),
+		Platform:   q.Get("platform"),
+		Visibility: q.Get("visibility"),
+		HalfLife:   halfLife(defaultFreshness()),
+		Collapse:   true,
+	}
+	if !search.ValidVisibility(req.Visibility) {
+		return req, fmt.Errorf("visibility must be public, private or all")
+	}
+	if v := q.Get("freshness"); v != "" {
+		days, err := strconv.ParseFloat(v, 64)
+		if err != nil || days < 0 {
+			return req, fmt.Errorf("freshness must be a non-negative number of days")
+		}
+		req.HalfLife = halfLife(days)
+	}
+	if v := q.Get("facets"); v != "" {
+		facets, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, fmt.Errorf("facets must be true or false")
+		}
+		req.Facets = facets
+	}
+	if v := q.Get("collapse"); v != "" {
+		collapse, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, fmt.Errorf("collapse must be true or false")
+		}
+		req.Collapse = collapse
+	}
+	if tags := q.Get("tags"); tags != "" {
+		req.Tags = strings.Split(tags, ",")
+	}
+	var err error
+	if req.Hybrid, err = searchRanking(q.Get("ranker"), q.Get("weights")); err != nil {
+		return req, err
+	}
+	req.Vectors, req.Staleness = searchVectors, searchStaleness
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", since); err != nil {
+				return req, fmt.Errorf("since must be a date or RFC 3339 time")
+			}
+		}
+		req.Since = t
+	}
+	for name, dst := range map[string]*int{"limit": &req.Limit, "offset": &req.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return req, fmt.Errorf("%s must be a non-negative number", name)
+			}
+			*dst = n
+		}
+	}
+	return req, nil
+}
+
+// writeFacets lists the facet counts of a search for the search_content
+// tool.
+func writeFacets(b *strings.Builder, f *search.Facets) {
+	b.WriteString("📊 Facets\n")
+	for _, facet := range []struct {
+		name   string
+		counts []search.FacetCount
+	}{{"Platform", f.Platforms}, {"Tag", f.Tags}, {"Content type", f.ContentTypes}, {"Month", f.Months}} {
+		if len(facet.counts) == 0 {
+			continue
+		}
+		values := make([]string, len(facet.counts))
+		for i, c := range facet.counts {
+			values[i] = fmt.Sprintf("%s (%d)", c.Value, c.Count)
+		}
+		fmt.Fprintf(b, "   • %s: %s\n", facet.name, strings.Join(values, ", "))
+	}
+	b.WriteString("\n")
+}
+
+// alsoSeenOn lists where else a collapsed search result was collected.
+func alsoSeenOn(dups []search.Duplicate) string {
+	seen := make([]string, len(dups))
+	for i, d := range dups {
+		seen[i] = fmt.Sprintf("%s (%s)", d.SourcePlatform, d.ID)
+	}
+	return strings.Join(seen, ", ")
+}
+
+// contentHandler serves GET /content (a filtered, paginated listing),
+// GET /content/{id}, GET /content/{id}/revisions and GET /content/{id}/thread.
+func contentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/content"), "/")
+	id, revisions := strings.CutSuffix(id, "/revisions")
+	id, thread := strings.CutSuffix(id, "/thread")
+	var req search.SearchRequest
+	if id == "" {
+		var err error
+		if req, err = searchRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer store.Close()
+	db, postgres := storage.PostgresDB(store)
+
+	var result interface{}
+	if id == "" {
+		variant, inExperiment := assignVariant(r, &req)
+		inExperiment = inExperiment && postgres
+		start := time.Now()
+		var found *search.SearchResult
+		if found, err = store.Search(r.Context(), req); err == nil && postgres && strings.TrimSpace(req.Query) != "" {
+			record := QueryRecord{
+				WorkspaceID: req.Workspace,
+				UserID:      requestUser(r),
+				Query:       req.Query,
+				Tool:        "content_api",
+				ResultCount: &found.Total,
+				RequestID:   logging.RequestID(r.Context()),
+				DurationMS:  int(time.Since(start).Milliseconds()),
+			}
+			if inExperiment {
+				record.Experiment, record.Variant, record.ResultIDs = searchExperiment.Name, variant.Name, resultIDs(found.Items)
+			}
+			queryID := logQuery(db, record)
+			if inExperiment {
+				// Each response carries its own query_id, so none is cached
+				w = untagged(w)
+				result = experimentSearch{SearchResult: found, QueryID: queryID, Experiment: searchExperiment.Name, Variant: variant.Name}
+			}
+		}
+		if result == nil {
+			result = found
+		}
+	} else if (revisions || thread) && !postgres {
+		http.Error(w, "Revisions and threads need Postgres storage", http.StatusNotImplemented)
+		return
+	} else if thread {
+		var messages []links.Message
+		if messages, err = links.Thread(r.Context(), db, requestWorkspace(r), id); err == nil {
+			result = map[string]interface{}{"content_id": id, "messages": messages}
+		} else if err == links.ErrNotFound {
+			err = search.ErrNotFound
+		}
+	} else if revisions {
+		var history []ContentRevision
+		if _, history, err = contentRevisions(r.Context(), db, requestWorkspace(r), id, 100); err == nil {
+			result = map[string]interface{}{"content_id": id, "revisions": history}
+		}
+	} else {
+		result, err = store.Get(r.Context(), requestWorkspace(r), id)
+	}
+	if err == search.ErrNotFound {
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load content", "error", err)
+		http.Error(w, "Failed to load content", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// tagsHandler serves GET /tags, the workspace's most used tags.
+func tagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	store, err := openStore()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer store.Close()
+
+	tags, err := store.Tags(r.Context(), requestWorkspace(r), limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load tags", "error", err)
+		http.Error(w, "Failed to load tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tags": tags})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"selin/internal/search"
+	"selin/internal/storage"
+)
+
+func TestSearchRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/content?q=ibc&tags=go,cosmos&platform=reddit&since=2026-01-15&limit=5&offset=10", nil)
+	r.Header.Set(workspaceHeader, "team")
+	vouch(t, r)
+
+	req, err := searchRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Workspace != "team" || req.Query != "ibc" || req.Platform != "reddit" {
+		t.Errorf("Unexpected request: %+v", req)
+	}
+	if !reflect.DeepEqual(req.Tags, []string{"go", "cosmos"}) {
+		t.Errorf("Expected tags [go cosmos], got %v", req.Tags)
+	}
+	if !req.Since.Equal(time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected since: %v", req.Since)
+	}
+	if req.Limit != 5 || req.Offset != 10 {
+		t.Errorf("Expected limit 5 offset 10, got %d %d", req.Limit, req.Offset)
+	}
+}
+
+func TestSearchRequestFreshness(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		env, query string
+		want       time.Duration
+	}{
+		{"", "", 60 * day},
+		{"", "freshness=7", 7 * day},
+		{"", "freshness=0", 0},
+		{"30", "", 30 * day},
+		{"0", "", 0},
+		{"0", "freshness=14", 14 * day},
+		{"nonsense", "", 60 * day},
+	}
+	for _, tt := range tests {
+		t.Setenv("SEARCH_HALF_LIFE_DAYS", tt.env)
+		req, err := searchRequest(httptest.NewRequest("GET", "/content?"+tt.query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.HalfLife != tt.want {
+			t.Errorf("SEARCH_HALF_LIFE_DAYS=%q %s: expected half-life %v, got %v", tt.env, tt.query, tt.want, req.HalfLife)
+		}
+	}
+}
+
+func TestSearchRequestFacets(t *testing.T) {
+	for query, want := range map[string]bool{"": false, "facets=true": true, "facets=1": true, "facets=false": false} {
+		req, err := searchRequest(httptest.NewRequest("GET", "/content?"+query, nil))
+		if err != nil || req.Facets != want {
+			t.Errorf("%q: expected facets %v, got %v (%v)", query, want, req.Facets, err)
+		}
+	}
+}
+
+func TestSearchRequestCollapse(t *testing.T) {
+	for query, want := range map[string]bool{"": true, "collapse=false": false, "collapse=0": false} {
+		req, err := searchRequest(httptest.NewRequest("GET", "/content?"+query, nil))
+		if err != nil || req.Collapse != want {
+			t.Errorf("%q: expected collapse %v, got %v (%v)", query, want, req.Collapse, err)
+		}
+	}
+}
+
+func TestSearchRequestRanker(t *testing.T) {
+	t.Setenv("SEARCH_WEIGHTS", "recency=0")
+	tests := []struct {
+		env, query string
+		want       *search.Weights
+	}{
+		{"", "", nil},
+		{"hybrid", "", &search.Weights{Keyword: 0.4, Vector: 0.3, Relevance: 0.2}},
+		{"hybrid", "ranker=classic", nil},
+		{"", "weights=keyword=1", &search.Weights{Keyword: 1, Vector: 0.3, Relevance: 0.2}},
+	}
+	for _, tt := range tests {
+		t.Setenv("SEARCH_RANKER", tt.env)
+		req, err := searchRequest(httptest.NewRequest("GET", "/content?"+tt.query, nil))
+		if err != nil || !reflect.DeepEqual(req.Hybrid, tt.want) {
+			t.Errorf("SEARCH_RANKER=%q %s: expected %v, got %v (%v)", tt.env, tt.query, tt.want, req.Hybrid, err)
+		}
+	}
+}
+
+func TestAlsoSeenOn(t *testing.T) {
+	got := alsoSeenOn([]search.Duplicate{{ID: "a", SourcePlatform: "hackernews"}, {ID: "b", SourcePlatform: "file_upload"}})
+	if got != "hackernews (a), file_upload (b)" {
+		t.Errorf("Unexpected list: %s", got)
+	}
+}
+
+func TestWriteFacets(t *testing.T) {
+	var b strings.Builder
+	writeFacets(&b, &search.Facets{
+		Platforms: []search.FacetCount{{Value: "reddit", Count: 3}, {Value: "slack", Count: 1}},
+		Months:    []search.FacetCount{{Value: "2026-04", Count: 4}},
+	})
+	out := b.String()
+	if !strings.Contains(out, "Platform: reddit (3), slack (1)") || !strings.Contains(out, "Month: 2026-04 (4)") {
+		t.Errorf("Unexpected facets output:\n%s", out)
+	}
+	if strings.Contains(out, "Tag:") {
+		t.Errorf("Expected empty facets to be left out:\n%s", out)
+	}
+}
+
+func TestSearchRequestRejectsBadParameters(t *testing.T) {
+	for _, query := range []string{"since=yesterday", "limit=lots", "offset=-1", "freshness=-3", "freshness=recent", "facets=maybe", "collapse=maybe",
+		"ranker=fancy", "ranker=classic&weights=keyword=1", "weights=bm25=1"} {
+		r := httptest.NewRequest("GET", "/content?"+query, nil)
+		if _, err := searchRequest(r); err == nil {
+			t.Errorf("Expected %s to be rejected", query)
+		}
+	}
+}
+
+func TestContentHandlerRejectsWrites(t *testing.T) {
+	w := httptest.NewRecorder()
+	contentHandler(w, httptest.NewRequest("POST", "/content", nil))
+	if w.Code != 405 {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestContentHandlerOnSQLite(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "selin.db"))
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := store.SaveContent(context.Background(), storage.Content{
+		Workspace:      defaultWorkspace,
+		SourceURL:      "https://example.com/ibc",
+		Tags:           []string{"ibc", "cosmos"},
+		Summary:        "Relaying IBC packets",
+		RelevanceScore: 0.8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	contentHandler(w, httptest.NewRequest("GET", "/content?q=ibc", nil))
+	var found search.SearchResult
+	if err := json.NewDecoder(w.Body).Decode(&found); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 || found.Total != 1 || found.Items[0].ID != id {
+		t.Errorf("Expected the stored item, got %d %+v", w.Code, found)
+	}
+
+	w = httptest.NewRecorder()
+	contentHandler(w, httptest.NewRequest("GET", "/content/"+id, nil))
+	if w.Code != 200 {
+		t.Errorf("Expected 200 for the item, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	contentHandler(w, httptest.NewRequest("GET", "/content/"+id+"/revisions", nil))
+	if w.Code != 501 {
+		t.Errorf("Expected revisions to need Postgres, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	contentHandler(w, httptest.NewRequest("GET", "/content/"+id+"/thread", nil))
+	if w.Code != 501 {
+		t.Errorf("Expected threads to need Postgres, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	tagsHandler(w, httptest.NewRequest("GET", "/tags", nil))
+	var tags struct{ Tags []search.TagCount }
+	json.NewDecoder(w.Body).Decode(&tags)
+	if len(tags.Tags) != 2 {
+		t.Errorf("Expected 2 tags, got %+v", tags.Tags)
+	}
+
+	// Cosmos content past the shipped policy's 18 months is flagged
+	if _, _, err := store.SaveContent(context.Background(), storage.Content{
+		Workspace:      defaultWorkspace,
+		SourceURL:      "https://example.com/sdk-045",
+		Tags:           []string{"cosmos"},
+		Summary:        "Cosmos SDK v0.45 migration",
+		RelevanceScore: 0.9,
+		Timestamp:      time.Now().AddDate(-3, 0, 0),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	contentHandler(w, httptest.NewRequest("GET", "/content?q=cosmos&freshness=0", nil))
+	found = search.SearchResult{}
+	if err := json.NewDecoder(w.Body).Decode(&found); err != nil {
+		t.Fatal(err)
+	}
+	if found.Total != 2 || found.Items[0].ID != id || found.Items[1].PossiblyOutdated == nil {
+		t.Errorf("Expected the old cosmos item ranked last and flagged, got %+v", found.Items)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// Dashboard endpoints read the dashboard_* materialized views, which
+// runDashboardRefresher rebuilds on a schedule, and the content_stats_daily
+// snapshots, so charts cost a few index lookups instead of scanning content
+// on every page load. Every endpoint is read-only and scoped to the
+// caller's workspace.
+var dashboardViews = []string{
+	"dashboard_tag_counts",
+	"dashboard_relevance_histogram",
+	"dashboard_progress_daily",
+	"dashboard_platform_activity",
+}
+
+// A platform with nothing collected for longer than this is reported stale.
+const collectorStaleAfter = 2 * time.Hour
+
+const histogramBuckets = 10
+
+type VolumePoint struct {
+	Day          string  `json:"day"`
+	Platform     string  `json:"platform"`
+	Items        int     `json:"items"`
+	AvgRelevance float64 `json:"avg_relevance"`
+}
+
+type TagStat struct {
+	Tag      string    `json:"tag"`
+	Items    int       `json:"items"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type HistogramBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Items int     `json:"items"`
+}
+
+type ProgressPoint struct {
+	Day           string  `json:"day"`
+	ProgressScore float64 `json:"progress_score"`
+	SkillLevel    string  `json:"skill_level"`
+}
+
+type CollectorHealth struct {
+	Platform      string    `json:"platform"`
+	LastCollected time.Time `json:"last_collected"`
+	Items24h      int       `json:"items_24h"`
+	Status        string    `json:"status"` // "healthy" or "stale"
+	RefreshedAt   time.Time `json:"refreshed_at"`
+}
+
+func runDashboardRefresher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		db, err := getDBConnection()
+		if err != nil {
+			slog.Error("dashboard refresh failed", "error", err)
+			continue
+		}
+		if err := refreshDashboards(db); err != nil {
+			slog.Error("dashboard refresh failed", "error", err)
+		}
+		db.Close()
+	}
+}
+
+func refreshDashboards(db *sql.DB) error {
+	for _, view := range dashboardViews {
+		if _, err := db.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY " + view); err != nil {
+			return fmt.Errorf("failed to refresh %s: %v", view, err)
+		}
+	}
+	// The views changed without a content write, so ETags must change too
+	if _, err := db.Exec("UPDATE content_version SET version = version + 1"); err != nil {
+		return fmt.Errorf("failed to bump content version: %v", err)
+	}
+	return nil
+}
+
+// histogram turns bucket counts from dashboard_relevance_histogram into
+// all ten score ranges, including empty ones.
+func histogram(counts map[int]int) []HistogramBucket {
+	buckets := make([]HistogramBucket, histogramBuckets)
+	for i := range buckets {
+		buckets[i] = HistogramBucket{
+			Min:   float64(i) / histogramBuckets,
+			Max:   float64(i+1) / histogramBuckets,
+			Items: counts[i+1],
+		}
+	}
+	return buckets
+}
+
+func collectorStatus(lastCollected, now time.Time) string {
+	if now.Sub(lastCollected) > collectorStaleAfter {
+		return "stale"
+	}
+	return "healthy"
+}
+
+// dashboardDays reads the days query parameter, defaulting to def and
+// capped at a year.
+func dashboardDays(r *http.Request, def int) int {
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d > 0 && d <= 365 {
+		return d
+	}
+	return def
+}
+
+// dashboardHandler serves GET /dashboard/{volume,tags,trends,relevance,progress,collectors}.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	workspace := requestWorkspace(r)
+	q := r.URL.Query()
+	var result interface{}
+	switch strings.TrimPrefix(r.URL.Path, "/dashboard/") {
+	case "volume":
+		result, err = contentVolume(db, workspace, dashboardDays(r, 30), q.Get("platform"))
+	case "tags":
+		limit := 20
+		if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+		result, err = tagDistribution(db, workspace, limit)
+	case "trends":
+		days := dashboardDays(r, 7)
+		if tag := strings.ToLower(q.Get("tag")); tag != "" {
+			result, err = tagSeries(db, workspace, tag, days)
+		} else {
+			result, err = tagTrends(db, workspace, days, 20)
+		}
+	case "relevance":
+		result, err = relevanceHistogram(db, workspace, q.Get("platform"))
+	case "progress":
+		result, err = progressCurves(db, workspace, dashboardDays(r, 90), strings.ToLower(q.Get("topic")))
+	case "collectors":
+		result, err = collectorHealth(db, workspace, time.Now())
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("dashboard query failed", "path", r.URL.Path, "error", err)
+		http.Error(w, "Failed to load dashboard data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func contentVolume(db *sql.DB, workspace string, days int, platform string) ([]VolumePoint, error) {
+	rows, err := db.Query(`
+		SELECT day, source_platform, items, COALESCE(relevance_sum / NULLIF(scored_items, 0), 0)
+		FROM content_stats_daily
+		WHERE workspace_id = $1 AND tag = ''
+		  AND day >= current_date - $2::int
+		  AND ($3 = '' OR source_platform = $3)
+		ORDER BY day, source_platform`, workspace, days, platform)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []VolumePoint{}
+	for rows.Next() {
+		var p VolumePoint
+		var day time.Time
+		if err := rows.Scan(&day, &p.Platform, &p.Items, &p.AvgRelevance); err != nil {
+			return nil, err
+		}
+		p.Day = day.Format("2006-01-02")
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func tagDistribution(db *sql.DB, workspace string, limit int) ([]TagStat, error) {
+	rows, err := db.Query(`
+		SELECT tag, items, last_seen
+		FROM dashboard_tag_counts
+		WHERE workspace_id = $1
+		ORDER BY items DESC, tag
+		LIMIT $2`, workspace, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagStat{}
+	for rows.Next() {
+		var t TagStat
+		if err := rows.Scan(&t.Tag, &t.Items, &t.LastSeen); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func relevanceHistogram(db *sql.DB, workspace, platform string) ([]HistogramBucket, error) {
+	rows, err := db.Query(`
+		SELECT bucket, SUM(items)
+		FROM dashboard_relevance_histogram
+		WHERE workspace_id = $1 AND ($2 = '' OR source_platform = $2)
+		GROUP BY bucket`, workspace, platform)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var bucket, items int
+		if err := rows.Scan(&bucket, &items); err != nil {
+			return nil, err
+		}
+		counts[bucket] = items
+	}
+	return histogram(counts), rows.Err()
+}
+
+// progressCurves returns each topic's daily progress, keyed by topic.
+func progressCurves(db *sql.DB, workspace string, days int, topic string) (map[string][]ProgressPoint, error) {
+	rows, err := db.Query(`
+		SELECT topic, day, progress_score, skill_level
+		FROM dashboard_progress_daily
+		WHERE workspace_id = $1
+		  AND day >= current_date - $2::int
+		  AND ($3 = '' OR topic = $3)
+		ORDER BY topic, day`, workspace, days, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	curves := map[string][]ProgressPoint{}
+	for rows.Next() {
+		var t string
+		var p ProgressPoint
+		var day time.Time
+		if err := rows.Scan(&t, &day, &p.ProgressScore, &p.SkillLevel); err != nil {
+			return nil, err
+		}
+		p.Day = day.Format("2006-01-02")
+		curves[t] = append(curves[t], p)
+	}
+	return curves, rows.Err()
+}
+
+func collectorHealth(db *sql.DB, workspace string, now time.Time) ([]CollectorHealth, error) {
+	rows, err := db.Query(`
+		SELECT source_platform, last_collected, items_24h, refreshed_at
+		FROM dashboard_platform_activity
+		WHERE workspace_id = $1
+		ORDER BY source_platform`, workspace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	health := []CollectorHealth{}
+	for rows.Next() {
+		var h CollectorHealth
+		if err := rows.Scan(&h.Platform, &h.LastCollected, &h.Items24h, &h.RefreshedAt); err != nil {
+			return nil, err
+		}
+		h.Status = collectorStatus(h.LastCollected, now)
+		health = append(health, h)
+	}
+	return health, rows.Err()
+}
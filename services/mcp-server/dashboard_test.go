@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHistogramFillsEmptyBuckets(t *testing.T) {
+	buckets := histogram(map[int]int{1: 4, 10: 2})
+	if len(buckets) != 10 {
+		t.Fatalf("Expected 10 buckets, got %d", len(buckets))
+	}
+	if buckets[0].Items != 4 || buckets[0].Min != 0 || buckets[0].Max != 0.1 {
+		t.Errorf("Unexpected first bucket: %+v", buckets[0])
+	}
+	if buckets[5].Items != 0 {
+		t.Errorf("Expected empty middle bucket, got %+v", buckets[5])
+	}
+	if buckets[9].Items != 2 || buckets[9].Max != 1 {
+		t.Errorf("Unexpected last bucket: %+v", buckets[9])
+	}
+}
+
+func TestCollectorStatus(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := collectorStatus(now.Add(-10*time.Minute), now); got != "healthy" {
+		t.Errorf("Expected recent collection to be healthy, got %s", got)
+	}
+	if got := collectorStatus(now.Add(-3*time.Hour), now); got != "stale" {
+		t.Errorf("Expected old collection to be stale, got %s", got)
+	}
+}
+
+func TestDashboardDays(t *testing.T) {
+	tests := map[string]int{"": 30, "7": 7, "0": 30, "1000": 30, "x": 30}
+	for value, want := range tests {
+		r := httptest.NewRequest("GET", "/dashboard/volume?days="+value, nil)
+		if got := dashboardDays(r, 30); got != want {
+			t.Errorf("days=%q: expected %d, got %d", value, want, got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEngagementHours = 24
+	maxEngagementHours     = 24 * 14 // snapshots are kept 14 days
+	defaultEngagementLimit = 10
+)
+
+// engagementSnapshot is a post's Reddit score and comment count at one
+// collection cycle, from content_engagement_snapshots.
+type engagementSnapshot struct {
+	Score       int
+	NumComments int
+	At          time.Time
+}
+
+// engagement weighs a comment like two votes: discussions are what the
+// trends are after.
+func (s engagementSnapshot) engagement() float64 {
+	return float64(s.Score + 2*s.NumComments)
+}
+
+// EngagementTrend is a collected item whose engagement is picking up.
+type EngagementTrend struct {
+	ContentID   string `json:"content_id"`
+	SourceURL   string `json:"source_url"`
+	Summary     string `json:"summary"`
+	Score       int    `json:"score"`
+	NumComments int    `json:"num_comments"`
+	// RecentRate and EarlierRate are the engagement gained per hour in the
+	// second and first half of the window
+	RecentRate   float64 `json:"recent_rate"`
+	EarlierRate  float64 `json:"earlier_rate"`
+	Acceleration float64 `json:"acceleration"`
+}
+
+// engagementRates splits an item's snapshots, oldest first, at the last one
+// taken by mid and returns how fast engagement grew per hour after and
+// before it. ok is false without snapshots on both sides of mid.
+func engagementRates(snapshots []engagementSnapshot, mid time.Time) (recent, earlier float64, ok bool) {
+	pivot := -1
+	for i, s := range snapshots {
+		if !s.At.After(mid) {
+			pivot = i
+		}
+	}
+	if pivot <= 0 || pivot == len(snapshots)-1 {
+		return 0, 0, false
+	}
+	first, middle, last := snapshots[0], snapshots[pivot], snapshots[len(snapshots)-1]
+	rate := func(from, to engagementSnapshot) float64 {
+		hours := to.At.Sub(from.At).Hours()
+		if hours <= 0 {
+			return 0
+		}
+		return (to.engagement() - from.engagement()) / hours
+	}
+	return rate(middle, last), rate(first, middle), true
+}
+
+// acceleratingItems loads the snapshots of the last hours and returns the
+// items gaining engagement faster in the second half of them than in the
+// first, fastest accelerating first.
+func acceleratingItems(db *sql.DB, workspace, topic string, hours, limit int) ([]EngagementTrend, error) {
+	rows, err := db.Query(`
+		SELECT s.content_id, c.source_url, COALESCE(c.content_summary, ''), s.score, s.num_comments, s.collected_at
+		FROM content_engagement_snapshots s
+		JOIN content_metadata c ON c.id = s.content_id
+		WHERE s.workspace_id = $1 AND s.collected_at >= now() - make_interval(hours => $2)
+		  AND ($3 = '' OR $3 = ANY(c.tags))
+		ORDER BY s.content_id, s.collected_at`, workspace, hours, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load engagement snapshots: %v", err)
+	}
+	defer rows.Close()
+
+	mid := time.Now().Add(-time.Duration(hours) * time.Hour / 2)
+	var trends []EngagementTrend
+	var current EngagementTrend
+	var snapshots []engagementSnapshot
+	flush := func() {
+		recent, earlier, ok := engagementRates(snapshots, mid)
+		if ok && recent > earlier && recent > 0 {
+			last := snapshots[len(snapshots)-1]
+			current.Score, current.NumComments = last.Score, last.NumComments
+			current.RecentRate, current.EarlierRate, current.Acceleration = recent, earlier, recent-earlier
+			trends = append(trends, current)
+		}
+	}
+	for rows.Next() {
+		var item EngagementTrend
+		var s engagementSnapshot
+		if err := rows.Scan(&item.ContentID, &item.SourceURL, &item.Summary, &s.Score, &s.NumComments, &s.At); err != nil {
+			return nil, err
+		}
+		if item.ContentID != current.ContentID {
+			flush()
+			current, snapshots = item, nil
+		}
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	sort.Slice(trends, func(i, j int) bool { return trends[i].Acceleration > trends[j].Acceleration })
+	if len(trends) > limit {
+		trends = trends[:limit]
+	}
+	return trends, nil
+}
+
+func handleGetEngagementTrends(args map[string]interface{}) MCPResponse {
+	topic, _ := args["topic"].(string)
+	hours := defaultEngagementHours
+	if h, ok := args["hours"].(float64); ok && h >= 2 && h <= maxEngagementHours {
+		hours = int(h)
+	}
+	limit := defaultEngagementLimit
+	if l, ok := args["limit"].(float64); ok && l > 0 && l <= 50 {
+		limit = int(l)
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	trends, err := acceleratingItems(db, workspaceArg(args), topic, hours, limit)
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Failed to analyze engagement: %v", err))
+	}
+
+	var responseText strings.Builder
+	if len(trends) == 0 {
+		responseText.WriteString(fmt.Sprintf("📈 No discussions picking up in the last %d hours.", hours))
+	} else {
+		responseText.WriteString(fmt.Sprintf("📈 **Accelerating Discussions** (last %d hours)\n\n", hours))
+	}
+	for i, t := range trends {
+		responseText.WriteString(fmt.Sprintf("%d. **%s**\n", i+1, t.Summary))
+		responseText.WriteString(fmt.Sprintf("   %d points, %d comments — gaining %.1f/h, up from %.1f/h\n",
+			t.Score, t.NumComments, t.RecentRate, t.EarlierRate))
+		responseText.WriteString(fmt.Sprintf("   %s (ID: %s)\n", t.SourceURL, t.ContentID))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
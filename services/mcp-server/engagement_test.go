@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEngagementRates(t *testing.T) {
+	now := time.Now()
+	at := func(hoursAgo float64) time.Time { return now.Add(-time.Duration(hoursAgo * float64(time.Hour))) }
+	mid := at(12)
+
+	// 10 points an hour, then 20 points and a comment an hour
+	snapshots := []engagementSnapshot{
+		{Score: 0, At: at(24)},
+		{Score: 120, At: at(12)},
+		{Score: 360, NumComments: 12, At: at(0)},
+	}
+	recent, earlier, ok := engagementRates(snapshots, mid)
+	if !ok || recent != 22 || earlier != 10 {
+		t.Errorf("Expected 22/h after 10/h, got %v after %v (ok %v)", recent, earlier, ok)
+	}
+
+	// Collected only since the middle of the window: nothing to compare to
+	if _, _, ok := engagementRates(snapshots[1:], mid); ok {
+		t.Error("Expected no rates without a snapshot before the middle")
+	}
+	if _, _, ok := engagementRates(snapshots[:2], mid); ok {
+		t.Error("Expected no rates without a snapshot after the middle")
+	}
+	if _, _, ok := engagementRates(nil, mid); ok {
+		t.Error("Expected no rates without snapshots")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"selin/internal/httpcache"
+	"selin/internal/logging"
+)
+
+// contentVersion reads the counter the database bumps on every content
+// write and dashboard refresh.
+func contentVersion(ctx context.Context) (int64, error) {
+	db, err := getDBConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var version int64
+	err = db.QueryRowContext(ctx, "SELECT version FROM content_version").Scan(&version)
+	return version, err
+}
+
+// withContentETag answers GETs to a read-only endpoint with a weak ETag of
+// the content version, the workspace and the request URI, and conditional
+// GETs naming the current one with 304 Not Modified without running next.
+// The version is read before next runs, so a write landing in between
+// leaves the response with an older ETag than its body, never a newer one.
+// When the version cannot be read, next runs without an ETag.
+func withContentETag(version func(context.Context) (int64, error), next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+		v, err := version(r.Context())
+		if err != nil {
+			logging.FromContext(r.Context()).Debug("content version unavailable, not tagging response", "error", err)
+			next(w, r)
+			return
+		}
+
+		etag := httpcache.ETag(v, requestWorkspace(r), r.URL.RequestURI())
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if httpcache.Matches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next(&etagWriter{ResponseWriter: w, etag: etag}, r)
+	}
+}
+
+// untagged returns the writer under withContentETag's, for a response that
+// must not be cached, such as a search logged for an experiment.
+func untagged(w http.ResponseWriter) http.ResponseWriter {
+	if ew, ok := w.(*etagWriter); ok {
+		return ew.ResponseWriter
+	}
+	return w
+}
+
+// etagWriter sets the ETag on successful responses only.
+type etagWriter struct {
+	http.ResponseWriter
+	etag  string
+	wrote bool
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.wrote = true
+		if code == http.StatusOK {
+			w.Header().Set("ETag", w.etag)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
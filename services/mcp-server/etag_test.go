@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithContentETag(t *testing.T) {
+	version := int64(3)
+	calls := 0
+	handler := withContentETag(func(context.Context) (int64, error) { return version, nil }, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"tags":[]}`))
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/tags?limit=5", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected a tagged response, got %d with ETag %q", rr.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/tags?limit=5", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || calls != 1 {
+		t.Errorf("Expected 304 without running the handler, got %d after %d calls", rr.Code, calls)
+	}
+
+	// Another workspace or a content write gets a different ETag
+	req = httptest.NewRequest("GET", "/tags?limit=5", nil)
+	req.Header.Set("If-None-Match", etag)
+	req.Header.Set(workspaceHeader, "research")
+	vouch(t, req)
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("Expected another workspace to get its own response, got %d with ETag %q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	version++
+	req = httptest.NewRequest("GET", "/tags?limit=5", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("Expected a new version to invalidate the ETag, got %d with ETag %q", rr.Code, rr.Header().Get("ETag"))
+	}
+}
+
+func TestWithContentETagSkipsFailures(t *testing.T) {
+	handler := withContentETag(func(context.Context) (int64, error) { return 1, nil }, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Content not found", http.StatusNotFound)
+	})
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/content/missing", nil))
+	if rr.Code != http.StatusNotFound || rr.Header().Get("ETag") != "" {
+		t.Errorf("Expected an untagged 404, got %d with ETag %q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	// Without a version the response is served untagged
+	handler = withContentETag(func(context.Context) (int64, error) { return 0, errors.New("no database") }, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	req := httptest.NewRequest("GET", "/tags", nil)
+	req.Header.Set("If-None-Match", "*")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != "" {
+		t.Errorf("Expected an untagged 200 without a version, got %d with ETag %q", rr.Code, rr.Header().Get("ETag"))
+	}
+}
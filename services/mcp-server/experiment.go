@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/adminauth"
+	"selin/internal/experiment"
+	"selin/internal/logging"
+	"selin/internal/search"
+)
+
+// Most days of searches /admin/experiments compares.
+const maxExperimentDays = 366
+
+// searchExperiment splits /content searches between ranking variants; set
+// up by main from SEARCH_EXPERIMENT_FILE.
+var searchExperiment *experiment.Experiment
+
+// experimentSearch is a /content listing served under an experiment. Views
+// and reads of its results name its query_id as their source.
+type experimentSearch struct {
+	*search.SearchResult
+	QueryID    string `json:"query_id,omitempty"`
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+}
+
+// assignVariant puts a /content search into a variant of the running
+// experiment and ranks it the variant's way. Searches without a query, or
+// that pick their ranker or weights, are left out.
+func assignVariant(r *http.Request, req *search.SearchRequest) (experiment.Variant, bool) {
+	q := r.URL.Query()
+	if searchExperiment == nil || strings.TrimSpace(req.Query) == "" || q.Get("ranker") != "" || q.Get("weights") != "" {
+		return experiment.Variant{}, false
+	}
+	v := searchExperiment.Assign(callerIdentity(r), r.Header.Get(experiment.Header))
+	// Variants were checked when the experiment was loaded
+	req.Hybrid, _ = v.Ranking()
+	return v, true
+}
+
+// resultIDs lists a page's items in order.
+func resultIDs(items []search.Item) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+// experimentsHandler serves GET /admin/experiments: the running experiment
+// and how its variants fared in the caller's workspace (?experiment= for
+// an earlier one, ?days= default 14).
+func experimentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	name := q.Get("experiment")
+	if name == "" && searchExperiment != nil {
+		name = searchExperiment.Name
+	}
+	if name == "" {
+		http.Error(w, "No experiment is running; name one with ?experiment=", http.StatusNotFound)
+		return
+	}
+	days := 14
+	if n, err := strconv.Atoi(q.Get("days")); err == nil && n > 0 {
+		days = min(n, maxExperimentDays)
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	results, err := experiment.Results(r.Context(), db, name, requestWorkspace(r), since)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load experiment results", "experiment", name, "error", err)
+		http.Error(w, "Failed to load experiment results", http.StatusInternalServerError)
+		return
+	}
+	out := map[string]interface{}{"experiment": name, "since": since.UTC().Format(time.RFC3339), "results": results}
+	if searchExperiment != nil && searchExperiment.Name == name {
+		out["variants"] = searchExperiment.Variants
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
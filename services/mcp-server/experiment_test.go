@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/config"
+	"selin/internal/experiment"
+	"selin/internal/search"
+)
+
+func TestAssignVariant(t *testing.T) {
+	defer func(e *experiment.Experiment) { searchExperiment = e }(searchExperiment)
+	searchExperiment = &experiment.Experiment{Name: "ranking", Variants: []experiment.Variant{
+		{Name: "control", Weight: 1, Ranker: "classic"},
+		{Name: "hybrid", Weight: 1, Ranker: "hybrid", Weights: "keyword=1"},
+	}}
+
+	r := httptest.NewRequest("GET", "/content?q=cosmos", nil)
+	r.Header.Set(experiment.Header, "hybrid")
+	req := search.SearchRequest{Query: "cosmos"}
+	v, ok := assignVariant(r, &req)
+	if !ok || v.Name != "hybrid" || req.Hybrid == nil || req.Hybrid.Keyword != 1 {
+		t.Errorf("Expected the requested variant's ranking, got %s %v (%v)", v.Name, req.Hybrid, ok)
+	}
+
+	r.Header.Set(experiment.Header, "control")
+	req = search.SearchRequest{Query: "cosmos", Hybrid: &search.DefaultWeights}
+	if v, ok = assignVariant(r, &req); !ok || req.Hybrid != nil {
+		t.Errorf("Expected the control to rank the classic way, got %v", req.Hybrid)
+	}
+
+	// Searches choosing their own ranking, and listings, stay out
+	for _, url := range []string{"/content?q=cosmos&ranker=hybrid", "/content?q=cosmos&weights=keyword=1", "/content"} {
+		r := httptest.NewRequest("GET", url, nil)
+		req, _ := searchRequest(r)
+		if _, ok := assignVariant(r, &req); ok {
+			t.Errorf("%s: expected no variant", url)
+		}
+	}
+}
+
+func TestExperimentsHandlerWithoutExperiment(t *testing.T) {
+	defer func(e *experiment.Experiment) { searchExperiment = e }(searchExperiment)
+	searchExperiment = nil
+	t.Setenv("ADMIN_API_KEY", "secret")
+	config.Secrets().Reload()
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/admin/experiments", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	experimentsHandler(rec, r)
+	if rec.Code != 404 {
+		t.Errorf("Expected 404 with no experiment named, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"selin/internal/adminauth"
+	"selin/internal/logging"
+)
+
+const (
+	// feedbackWindowDays is how far back ratings are blended in, so old
+	// ones stop counting
+	feedbackWindowDays = 180
+	// feedbackPrior is how many neutral ratings a tally starts from, so a
+	// single rating moves little
+	feedbackPrior = 3
+	// Most a relevance score moves for feedback, and most a topic's
+	// keyword weight moves away from 1
+	maxFeedbackAdjustment = 0.2
+	maxTopicShift         = 0.5
+)
+
+// Feedback records whether a search result was useful to a user.
+type Feedback struct {
+	ID        string    `json:"id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	ContentID string    `json:"content_id"`
+	Useful    *bool     `json:"useful"`
+	QueryID   string    `json:"query_id,omitempty"` // the search it was a result of
+	Query     string    `json:"query,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+
+	workspace string // only content in this workspace can be rated
+}
+
+// validate fills in defaults and checks the feedback fields.
+func (f *Feedback) validate() error {
+	if f.UserID == "" {
+		f.UserID = defaultUserID
+	}
+	if f.workspace == "" {
+		f.workspace = defaultWorkspace
+	}
+	if !uuidPattern.MatchString(f.ContentID) {
+		return fmt.Errorf("content_id must be a content UUID")
+	}
+	if f.Useful == nil {
+		return fmt.Errorf("useful must be true or false")
+	}
+	if f.QueryID != "" && !uuidPattern.MatchString(f.QueryID) {
+		return fmt.Errorf("query_id must be a query UUID")
+	}
+	if len(f.Query) > 1000 {
+		return fmt.Errorf("query must be at most 1000 characters")
+	}
+	return nil
+}
+
+// recordFeedback stores f. A later rating of the same item by the same user
+// replaces this one when feedback is applied.
+func recordFeedback(db *sql.DB, f *Feedback) error {
+	// A query_id that is not the workspace's is dropped, not refused
+	err := db.QueryRow(`
+		INSERT INTO result_feedback (workspace_id, user_id, content_id, query_id, query_text, useful)
+		SELECT $1, $2, id,
+			(SELECT q.id FROM query_history q WHERE q.id::text = NULLIF($4, '') AND q.workspace_id = $1),
+			NULLIF($5, ''), $6
+		FROM content_metadata WHERE id = $3 AND workspace_id = $1
+		RETURNING id, created_at`,
+		f.workspace, f.UserID, f.ContentID, f.QueryID, f.Query, *f.Useful).Scan(&f.ID, &f.CreatedAt)
+	if err == sql.ErrNoRows {
+		return errContentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record feedback: %v", err)
+	}
+	return nil
+}
+
+// feedbackHandler serves POST /feedback.
+func feedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f := Feedback{workspace: requestWorkspace(r)}
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if f.UserID == "" {
+		f.UserID = requestUser(r)
+	}
+	if err := f.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	if err := recordFeedback(db, &f); err != nil {
+		if err == errContentNotFound {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		logging.FromContext(r.Context()).Error("failed to record feedback", "error", err)
+		http.Error(w, "Failed to record feedback", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(f)
+}
+
+func handleRateResult(args map[string]interface{}) MCPResponse {
+	f := Feedback{workspace: workspaceArg(args)}
+	f.ContentID, _ = args["content_id"].(string)
+	if useful, ok := args["useful"].(bool); ok {
+		f.Useful = &useful
+	}
+	f.QueryID, _ = args["query_id"].(string)
+	f.Query, _ = args["query"].(string)
+	if err := f.validate(); err != nil {
+		return errorResponse(err.Error())
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	if err := recordFeedback(db, &f); err != nil {
+		return errorResponse(err.Error())
+	}
+
+	text := fmt.Sprintf("👍 Recorded that content %s was useful", f.ContentID)
+	if !*f.Useful {
+		text = fmt.Sprintf("👎 Recorded that content %s was not useful", f.ContentID)
+	}
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: text + ". Ratings tune how results are ranked.",
+		}},
+	}
+}
+
+// blendFeedback turns a tally of ratings into a shift of at most limit
+// either way, smoothed by feedbackPrior.
+func blendFeedback(useful, notUseful int, limit float64) float64 {
+	return limit * float64(useful-notUseful) / float64(useful+notUseful+feedbackPrior)
+}
+
+// feedbackTuning is what applying feedback changed.
+type feedbackTuning struct {
+	// Items is how many relevance scores moved
+	Items int `json:"items"`
+	// Topics is how many topics have a learned keyword weight
+	Topics int `json:"topics"`
+}
+
+// ratedContent is each user's latest rating of each item since $1.
+const ratedContent = `
+	WITH votes AS (
+		SELECT DISTINCT ON (user_id, content_id) content_id, useful
+		FROM result_feedback WHERE created_at >= $1
+		ORDER BY user_id, content_id, created_at DESC
+	)`
+
+// applyFeedback blends recent ratings into relevance scores, replacing the
+// adjustment of the last run, and relearns the topics' keyword weights the
+// collectors score with. Topics no longer rated go back to 1.
+func applyFeedback(ctx context.Context, db *sql.DB) (feedbackTuning, error) {
+	var tuning feedbackTuning
+	since := time.Now().AddDate(0, 0, -feedbackWindowDays)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return tuning, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, ratedContent+`
+		SELECT c.id, c.feedback_adjustment,
+			COUNT(*) FILTER (WHERE v.useful), COUNT(*) FILTER (WHERE NOT v.useful)
+		FROM content_metadata c LEFT JOIN votes v ON v.content_id = c.id
+		WHERE c.feedback_adjustment <> 0 OR v.content_id IS NOT NULL
+		GROUP BY c.id, c.feedback_adjustment`, since)
+	if err != nil {
+		return tuning, fmt.Errorf("failed to tally feedback: %w", err)
+	}
+	adjustments := make(map[string]float64)
+	for rows.Next() {
+		var id string
+		var current float64
+		var useful, notUseful int
+		if err := rows.Scan(&id, &current, &useful, &notUseful); err != nil {
+			rows.Close()
+			return tuning, err
+		}
+		if next := blendFeedback(useful, notUseful, maxFeedbackAdjustment); math.Abs(next-current) > 1e-6 {
+			adjustments[id] = next
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return tuning, err
+	}
+	for id, adjustment := range adjustments {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE content_metadata
+			SET relevance_score = LEAST(GREATEST(COALESCE(base_relevance_score, COALESCE(relevance_score, 0) - feedback_adjustment) + $1, 0), 1),
+				base_relevance_score = COALESCE(base_relevance_score, COALESCE(relevance_score, 0) - feedback_adjustment),
+				feedback_adjustment = $1, updated_at = now()
+			WHERE id = $2`, adjustment, id); err != nil {
+			return tuning, fmt.Errorf("failed to adjust %s: %w", id, err)
+		}
+		tuning.Items++
+	}
+
+	rows, err = tx.QueryContext(ctx, ratedContent+`
+		SELECT c.workspace_id, tag, COUNT(*) FILTER (WHERE v.useful), COUNT(*) FILTER (WHERE NOT v.useful)
+		FROM votes v JOIN content_metadata c ON c.id = v.content_id, unnest(c.tags) AS tag
+		GROUP BY 1, 2`, since)
+	if err != nil {
+		return tuning, fmt.Errorf("failed to tally topic feedback: %w", err)
+	}
+	type topic struct {
+		workspace, name   string
+		useful, notUseful int
+	}
+	var topics []topic
+	for rows.Next() {
+		var t topic
+		if err := rows.Scan(&t.workspace, &t.name, &t.useful, &t.notUseful); err != nil {
+			rows.Close()
+			return tuning, err
+		}
+		topics = append(topics, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return tuning, err
+	}
+	for _, t := range topics {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO topic_weights (workspace_id, topic, weight, useful, not_useful, updated_at)
+			VALUES ($1, $2, $3, $4, $5, now())
+			ON CONFLICT (workspace_id, topic) DO UPDATE
+			SET weight = EXCLUDED.weight, useful = EXCLUDED.useful, not_useful = EXCLUDED.not_useful, updated_at = now()`,
+			t.workspace, t.name, 1+blendFeedback(t.useful, t.notUseful, maxTopicShift), t.useful, t.notUseful); err != nil {
+			return tuning, fmt.Errorf("failed to learn weight of %s: %w", t.name, err)
+		}
+	}
+	tuning.Topics = len(topics)
+	// now() is the transaction's start, so this is every topic not rated above
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE topic_weights SET weight = 1, useful = 0, not_useful = 0, updated_at = now()
+		WHERE updated_at < now()`); err != nil {
+		return tuning, fmt.Errorf("failed to reset topic weights: %w", err)
+	}
+	return tuning, tx.Commit()
+}
+
+// feedbackApplyHandler serves POST /admin/feedback/apply, run by the
+// scheduler's apply_feedback job.
+func feedbackApplyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	tuning, err := applyFeedback(r.Context(), db)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("applying feedback failed", "error", err)
+		http.Error(w, "Applying feedback failed", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("applied feedback", "items", tuning.Items, "topics", tuning.Topics)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tuning)
+}
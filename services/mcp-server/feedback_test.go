@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeedbackValidate(t *testing.T) {
+	const contentID = "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b"
+	useful := true
+
+	f := Feedback{ContentID: contentID, Useful: &useful}
+	if err := f.validate(); err != nil {
+		t.Fatalf("Expected valid feedback, got %v", err)
+	}
+	if f.UserID != defaultUserID || f.workspace != defaultWorkspace {
+		t.Errorf("Expected defaults to be filled in, got user %q workspace %q", f.UserID, f.workspace)
+	}
+
+	invalid := []Feedback{
+		{ContentID: contentID},
+		{ContentID: "not-a-uuid", Useful: &useful},
+		{ContentID: contentID, Useful: &useful, QueryID: "q1"},
+		{ContentID: contentID, Useful: &useful, Query: strings.Repeat("q", 1001)},
+	}
+	for _, f := range invalid {
+		if err := f.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", f)
+		}
+	}
+}
+
+func TestBlendFeedback(t *testing.T) {
+	tests := []struct {
+		useful, notUseful int
+		want              float64
+	}{
+		{0, 0, 0},
+		{1, 0, 0.05},
+		{3, 3, 0},
+		{0, 1, -0.05},
+		{97, 0, 0.194},
+	}
+	for _, tt := range tests {
+		if got := blendFeedback(tt.useful, tt.notUseful, 0.2); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("blendFeedback(%d, %d) = %v, want %v", tt.useful, tt.notUseful, got, tt.want)
+		}
+	}
+}
+
+func TestFeedbackHandlerRejectsBadRequests(t *testing.T) {
+	rr := httptest.NewRecorder()
+	feedbackHandler(rr, httptest.NewRequest("GET", "/feedback", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	feedbackHandler(rr, httptest.NewRequest("POST", "/feedback", strings.NewReader(`{"content_id": "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b"}`)))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "useful") {
+		t.Errorf("Expected feedback without useful to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if resp := handleRateResult(map[string]interface{}{"content_id": "not-a-uuid", "useful": true}); !resp.IsError {
+		t.Errorf("Expected rate_result to reject a bad content_id, got %+v", resp)
+	}
+}
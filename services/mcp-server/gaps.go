@@ -0,0 +1,218 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultGapDays     = 30
+	defaultGapMinCount = 3
+	maxGapExamples     = 5
+)
+
+// gapStopwords are left out when picking a gap's topic: they would group
+// unrelated queries ("how to ...") together.
+var gapStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "how": true, "what": true,
+	"why": true, "when": true, "does": true, "are": true, "can": true, "use": true,
+	"using": true, "vs": true, "from": true, "into": true, "about": true, "between": true,
+	"explain": true, "best": true, "way": true, "work": true, "works": true, "get": true,
+}
+
+// ContentGap is a topic users searched for without finding anything.
+type ContentGap struct {
+	Topic    string   `json:"topic"`
+	Count    int      `json:"count"`
+	Examples []string `json:"examples"`
+}
+
+// gapTerms splits a query into lowercase words worth grouping on.
+func gapTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	var terms []string
+	seen := map[string]bool{}
+	for _, w := range words {
+		w = strings.Trim(w, "-")
+		if len(w) < 3 || gapStopwords[w] || seen[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// clusterGaps groups zero-result queries by topic: each query joins the
+// cluster of its word that the most queries share, so "ibc relayer setup"
+// and "ibc timeouts" both land under "ibc". Biggest gaps come first.
+func clusterGaps(queries []string) []ContentGap {
+	frequency := map[string]int{}
+	terms := make([][]string, len(queries))
+	for i, q := range queries {
+		terms[i] = gapTerms(q)
+		for _, t := range terms[i] {
+			frequency[t]++
+		}
+	}
+
+	clusters := map[string]*ContentGap{}
+	for i, q := range queries {
+		topic := ""
+		for _, t := range terms[i] {
+			if topic == "" || frequency[t] > frequency[topic] || (frequency[t] == frequency[topic] && t < topic) {
+				topic = t
+			}
+		}
+		if topic == "" {
+			continue
+		}
+		gap, ok := clusters[topic]
+		if !ok {
+			gap = &ContentGap{Topic: topic, Examples: []string{}}
+			clusters[topic] = gap
+		}
+		gap.Count++
+		example := strings.TrimSpace(q)
+		if len(gap.Examples) < maxGapExamples && !containsString(gap.Examples, example) {
+			gap.Examples = append(gap.Examples, example)
+		}
+	}
+
+	gaps := make([]ContentGap, 0, len(clusters))
+	for _, gap := range clusters {
+		gaps = append(gaps, *gap)
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].Count != gaps[j].Count {
+			return gaps[i].Count > gaps[j].Count
+		}
+		return gaps[i].Topic < gaps[j].Topic
+	})
+	return gaps
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// zeroResultQueries loads the searches that found nothing in the last days.
+// Questions (NULL result_count) are not searches and are left out.
+func zeroResultQueries(db *sql.DB, workspace string, days int) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT query_text FROM query_history
+		WHERE workspace_id = $1 AND result_count = 0
+		  AND created_at >= now() - make_interval(days => $2)`, workspace, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load zero-result queries: %v", err)
+	}
+	defer rows.Close()
+
+	var queries []string
+	for rows.Next() {
+		var q string
+		if err := rows.Scan(&q); err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, rows.Err()
+}
+
+// suggestKeywords stores gaps seen at least minCount times as collector
+// keyword suggestions. Suggestions already accepted or dismissed keep their
+// status; only their count is refreshed.
+func suggestKeywords(db *sql.DB, workspace string, gaps []ContentGap, minCount int) ([]string, error) {
+	var suggested []string
+	for _, gap := range gaps {
+		if gap.Count < minCount {
+			continue
+		}
+		_, err := db.Exec(`
+			INSERT INTO keyword_suggestions (workspace_id, keyword, query_count)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (workspace_id, keyword) DO UPDATE
+			SET query_count = EXCLUDED.query_count, updated_at = now()`,
+			workspace, gap.Topic, gap.Count)
+		if err != nil {
+			return suggested, fmt.Errorf("failed to save keyword suggestion: %v", err)
+		}
+		suggested = append(suggested, gap.Topic)
+	}
+	return suggested, nil
+}
+
+func handleContentGaps(args map[string]interface{}) MCPResponse {
+	days := defaultGapDays
+	if d, ok := args["days"].(float64); ok && d > 0 && d <= 365 {
+		days = int(d)
+	}
+	limit := 10
+	if l, ok := args["limit"].(float64); ok && l > 0 && l <= 50 {
+		limit = int(l)
+	}
+	minCount := defaultGapMinCount
+	if m, ok := args["min_count"].(float64); ok && m >= 1 {
+		minCount = int(m)
+	}
+	suggest, _ := args["suggest_keywords"].(bool)
+	workspace := workspaceArg(args)
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	queries, err := zeroResultQueries(db, workspace, days)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+	gaps := clusterGaps(queries)
+
+	var responseText strings.Builder
+	if len(gaps) == 0 {
+		responseText.WriteString(fmt.Sprintf("✅ No zero-result searches in the last %d days.", days))
+	} else {
+		responseText.WriteString(fmt.Sprintf("🕳️ **Content Gaps** (%d zero-result searches in the last %d days)\n\n", len(queries), days))
+	}
+	for i, gap := range gaps {
+		if i >= limit {
+			break
+		}
+		responseText.WriteString(fmt.Sprintf("**%d. %s** — %d searches\n", i+1, gap.Topic, gap.Count))
+		for _, example := range gap.Examples {
+			responseText.WriteString(fmt.Sprintf("   • \"%s\"\n", example))
+		}
+		responseText.WriteString("\n")
+	}
+
+	if suggest {
+		suggested, err := suggestKeywords(db, workspace, gaps, minCount)
+		if err != nil {
+			return errorResponse(err.Error())
+		}
+		if len(suggested) == 0 {
+			responseText.WriteString(fmt.Sprintf("💡 No gap was searched %d+ times, so no keywords were suggested.", minCount))
+		} else {
+			responseText.WriteString(fmt.Sprintf("💡 Suggested collector keywords: %s", strings.Join(suggested, ", ")))
+		}
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGapTerms(t *testing.T) {
+	got := gapTerms("How to use IBC relayer with Cosmos-SDK? ibc!")
+	want := []string{"ibc", "relayer", "cosmos-sdk"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestClusterGaps(t *testing.T) {
+	gaps := clusterGaps([]string{
+		"ibc relayer setup",
+		"IBC timeouts",
+		"ibc relayer setup",
+		"zk proofs",
+		"how to",
+	})
+
+	if len(gaps) != 2 {
+		t.Fatalf("Expected 2 gaps, got %+v", gaps)
+	}
+	if gaps[0].Topic != "ibc" || gaps[0].Count != 3 {
+		t.Errorf("Expected ibc with 3 searches first, got %+v", gaps[0])
+	}
+	if !reflect.DeepEqual(gaps[0].Examples, []string{"ibc relayer setup", "IBC timeouts"}) {
+		t.Errorf("Expected distinct examples, got %v", gaps[0].Examples)
+	}
+	if gaps[1].Topic != "proofs" || gaps[1].Count != 1 {
+		t.Errorf("Expected proofs with 1 search, got %+v", gaps[1])
+	}
+}
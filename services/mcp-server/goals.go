@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"selin/internal/logging"
+	"selin/internal/storage"
+)
+
+const (
+	defaultGoalTarget = 6.0 // "advanced" on the progress scale
+	goalTrendDays     = 14
+)
+
+var (
+	validGoalStatuses = map[string]bool{"active": true, "completed": true, "archived": true}
+
+	errGoalNotFound = fmt.Errorf("goal not found")
+)
+
+// LearningGoal is something the user is working towards, such as "pass
+// CKA", measured by the progress of its target topics.
+type LearningGoal struct {
+	ID          string      `json:"id"`
+	WorkspaceID string      `json:"workspace_id"`
+	UserID      string      `json:"user_id"`
+	Title       string      `json:"title"`
+	Topics      []string    `json:"topics"`
+	TargetScore float64     `json:"target_score"`
+	Deadline    *time.Time  `json:"deadline,omitempty"`
+	Status      string      `json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Report      *GoalReport `json:"report,omitempty"`
+}
+
+// GoalReport is the completion estimate for a goal.
+type GoalReport struct {
+	Completion    float64    `json:"completion"` // 0–1
+	DailyProgress float64    `json:"daily_progress"`
+	EstimatedDate *time.Time `json:"estimated_date,omitempty"`
+	OnTrack       *bool      `json:"on_track,omitempty"` // nil without a deadline or estimate
+}
+
+// goalCompletion averages how far each topic is towards target, capped per
+// topic so one strong topic cannot carry the others.
+func goalCompletion(scores []float64, target float64) float64 {
+	if len(scores) == 0 || target <= 0 {
+		return 0
+	}
+	total := 0.0
+	for _, s := range scores {
+		total += math.Min(s/target, 1)
+	}
+	return total / float64(len(scores))
+}
+
+// estimateGoal projects the completion trend over the last goalTrendDays
+// forward to estimate when the goal will be reached.
+func estimateGoal(now, past []float64, target float64, deadline *time.Time, today time.Time) GoalReport {
+	r := GoalReport{Completion: goalCompletion(now, target)}
+	r.DailyProgress = (r.Completion - goalCompletion(past, target)) / goalTrendDays
+
+	switch {
+	case r.Completion >= 1:
+		r.EstimatedDate = &today
+	case r.DailyProgress > 0:
+		days := math.Ceil((1-r.Completion)/r.DailyProgress - 1e-9)
+		eta := today.AddDate(0, 0, int(days))
+		r.EstimatedDate = &eta
+	}
+	if deadline != nil && r.EstimatedDate != nil {
+		onTrack := !r.EstimatedDate.After(*deadline)
+		r.OnTrack = &onTrack
+	} else if deadline != nil && r.Completion < 1 {
+		onTrack := false
+		r.OnTrack = &onTrack
+	}
+
+	r.Completion = math.Round(r.Completion*1000) / 1000
+	return r
+}
+
+// goalReport loads the current and past progress of the goal's topics.
+func goalReport(db *sql.DB, g LearningGoal) (GoalReport, error) {
+	var now, past []float64
+	for _, topic := range g.Topics {
+		var current, earlier float64
+		err := db.QueryRow(`SELECT progress_score FROM learning_progress WHERE workspace_id = $1 AND topic = $2 LIMIT 1`,
+			g.WorkspaceID, topic).Scan(&current)
+		if err != nil && err != sql.ErrNoRows {
+			return GoalReport{}, fmt.Errorf("failed to load progress for %s: %v", topic, err)
+		}
+		err = db.QueryRow(`
+			SELECT progress_score FROM learning_progress_history
+			WHERE workspace_id = $1 AND topic = $2 AND recorded_at <= now() - make_interval(days => $3)
+			ORDER BY recorded_at DESC LIMIT 1`, g.WorkspaceID, topic, goalTrendDays).Scan(&earlier)
+		if err == sql.ErrNoRows {
+			earlier = current
+		} else if err != nil {
+			return GoalReport{}, fmt.Errorf("failed to load progress history for %s: %v", topic, err)
+		}
+		now = append(now, current)
+		past = append(past, earlier)
+	}
+	return estimateGoal(now, past, g.TargetScore, g.Deadline, time.Now().Truncate(24*time.Hour)), nil
+}
+
+// normalizeGoal validates g and lowercases its topics.
+func normalizeGoal(g *LearningGoal) error {
+	g.Title = strings.TrimSpace(g.Title)
+	if g.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	var topics []string
+	for _, t := range g.Topics {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("at least one topic is required")
+	}
+	g.Topics = topics
+	if g.TargetScore == 0 {
+		g.TargetScore = defaultGoalTarget
+	}
+	if g.TargetScore < 0 || g.TargetScore > 10 {
+		return fmt.Errorf("target_score must be between 0 and 10")
+	}
+	if g.Status == "" {
+		g.Status = "active"
+	}
+	if !validGoalStatuses[g.Status] {
+		return fmt.Errorf("status must be active, completed or archived")
+	}
+	return nil
+}
+
+// saveGoal inserts a new goal, or updates it when g.ID is set, and starts
+// tracking progress for any topic not tracked yet.
+func saveGoal(db *sql.DB, g *LearningGoal) error {
+	var err error
+	if g.ID == "" {
+		err = db.QueryRow(`
+			INSERT INTO learning_goals (workspace_id, user_id, title, topics, target_score, deadline, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at`,
+			g.WorkspaceID, g.UserID, g.Title, pq.Array(g.Topics), g.TargetScore, g.Deadline, g.Status).Scan(&g.ID, &g.CreatedAt)
+	} else {
+		err = db.QueryRow(`
+			UPDATE learning_goals
+			SET title = $4, topics = $5, target_score = $6, deadline = $7, status = $8, updated_at = now()
+			WHERE id = $1 AND workspace_id = $2 AND user_id = $3
+			RETURNING created_at`,
+			g.ID, g.WorkspaceID, g.UserID, g.Title, pq.Array(g.Topics), g.TargetScore, g.Deadline, g.Status).Scan(&g.CreatedAt)
+	}
+	if err == sql.ErrNoRows {
+		return errGoalNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save goal: %v", err)
+	}
+
+	progress := storage.NewPostgres(db)
+	for _, topic := range g.Topics {
+		if err := progress.TrackTopic(context.Background(), g.WorkspaceID, topic); err != nil {
+			slog.Error("failed to start tracking topic", "topic", topic, "error", err)
+		}
+	}
+	return nil
+}
+
+const goalColumns = `id, workspace_id, user_id, title, array_to_string(topics, ','), target_score, deadline, status, created_at`
+
+func scanGoal(row interface{ Scan(...interface{}) error }) (LearningGoal, error) {
+	var g LearningGoal
+	var topics string
+	var deadline sql.NullTime
+	err := row.Scan(&g.ID, &g.WorkspaceID, &g.UserID, &g.Title, &topics, &g.TargetScore, &deadline, &g.Status, &g.CreatedAt)
+	if topics != "" {
+		g.Topics = strings.Split(topics, ",")
+	}
+	if deadline.Valid {
+		g.Deadline = &deadline.Time
+	}
+	return g, err
+}
+
+func loadGoal(db *sql.DB, workspace, userID, id string) (LearningGoal, error) {
+	g, err := scanGoal(db.QueryRow(`SELECT `+goalColumns+` FROM learning_goals WHERE id = $1 AND workspace_id = $2 AND user_id = $3`,
+		id, workspace, userID))
+	if err == sql.ErrNoRows {
+		return g, errGoalNotFound
+	}
+	return g, err
+}
+
+// listGoals returns the user's goals in a workspace, optionally filtered by
+// status.
+func listGoals(db *sql.DB, workspace, userID, status string) ([]LearningGoal, error) {
+	query := `SELECT ` + goalColumns + ` FROM learning_goals WHERE workspace_id = $1 AND user_id = $2`
+	args := []interface{}{workspace, userID}
+	if status != "" {
+		query += " AND status = $3"
+		args = append(args, status)
+	}
+	rows, err := db.Query(query+" ORDER BY deadline NULLS LAST, created_at", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list goals: %v", err)
+	}
+
+	goals := []LearningGoal{}
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			continue
+		}
+		goals = append(goals, g)
+	}
+	rows.Close()
+	return goals, nil
+}
+
+// attachReports computes the completion report of each goal.
+func attachReports(db *sql.DB, goals []LearningGoal) error {
+	for i := range goals {
+		report, err := goalReport(db, goals[i])
+		if err != nil {
+			return err
+		}
+		goals[i].Report = &report
+	}
+	return nil
+}
+
+// activeGoalTopics maps each topic of an active goal to the goal's title.
+func activeGoalTopics(db *sql.DB, workspace, userID string) (map[string]string, error) {
+	goals, err := listGoals(db, workspace, userID, "active")
+	if err != nil {
+		return nil, err
+	}
+	topics := map[string]string{}
+	for _, g := range goals {
+		for _, t := range g.Topics {
+			if _, ok := topics[t]; !ok {
+				topics[t] = g.Title
+			}
+		}
+	}
+	return topics, nil
+}
+
+// GoalRequest is the body of POST /goals and PUT /goals/{id}. Deadline is a
+// YYYY-MM-DD date; omitted fields keep their current value on update.
+type GoalRequest struct {
+	UserID      string   `json:"user_id,omitempty"`
+	Title       *string  `json:"title,omitempty"`
+	Topics      []string `json:"topics,omitempty"`
+	TargetScore *float64 `json:"target_score,omitempty"`
+	Deadline    *string  `json:"deadline,omitempty"` // "" clears it
+	Status      *string  `json:"status,omitempty"`
+}
+
+// apply copies the fields set in req onto g.
+func (req GoalRequest) apply(g *LearningGoal) error {
+	if req.Title != nil {
+		g.Title = *req.Title
+	}
+	if req.Topics != nil {
+		g.Topics = req.Topics
+	}
+	if req.TargetScore != nil {
+		g.TargetScore = *req.TargetScore
+	}
+	if req.Status != nil {
+		g.Status = *req.Status
+	}
+	if req.Deadline != nil {
+		if *req.Deadline == "" {
+			g.Deadline = nil
+		} else {
+			d, err := time.Parse("2006-01-02", *req.Deadline)
+			if err != nil {
+				return fmt.Errorf("deadline must be a YYYY-MM-DD date")
+			}
+			g.Deadline = &d
+		}
+	}
+	return normalizeGoal(g)
+}
+
+// goalsHandler serves the goal CRUD API:
+//
+//	GET    /goals?status=active   list goals with completion reports
+//	POST   /goals                 create a goal
+//	GET    /goals/{id}            one goal with its report
+//	PUT    /goals/{id}            update a goal
+//	DELETE /goals/{id}            delete a goal
+func goalsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/goals"), "/")
+	if id != "" && !uuidPattern.MatchString(id) {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = defaultUserID
+	}
+	workspace := requestWorkspace(r)
+
+	var req GoalRequest
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.UserID != "" {
+			userID = req.UserID
+		}
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		goals, err := listGoals(db, workspace, userID, r.URL.Query().Get("status"))
+		if err == nil {
+			err = attachReports(db, goals)
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("goal request failed", "error", err)
+			http.Error(w, "Failed to list goals", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "goals": goals})
+
+	case id == "" && r.Method == http.MethodPost:
+		g := LearningGoal{WorkspaceID: workspace, UserID: userID}
+		if err := req.apply(&g); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := saveGoal(db, &g); err != nil {
+			logging.FromContext(r.Context()).Error("goal request failed", "error", err)
+			http.Error(w, "Failed to save goal", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(g)
+
+	case id != "" && (r.Method == http.MethodGet || r.Method == http.MethodPut):
+		g, err := loadGoal(db, workspace, userID, id)
+		if err == errGoalNotFound {
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("goal request failed", "error", err)
+			http.Error(w, "Failed to load goal", http.StatusInternalServerError)
+			return
+		}
+		if r.Method == http.MethodPut {
+			if err := req.apply(&g); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := saveGoal(db, &g); err != nil {
+				logging.FromContext(r.Context()).Error("goal request failed", "error", err)
+				http.Error(w, "Failed to save goal", http.StatusInternalServerError)
+				return
+			}
+		}
+		if report, err := goalReport(db, g); err == nil {
+			g.Report = &report
+		}
+		json.NewEncoder(w).Encode(g)
+
+	case id != "" && r.Method == http.MethodDelete:
+		res, err := db.Exec(`DELETE FROM learning_goals WHERE id = $1 AND workspace_id = $2 AND user_id = $3`, id, workspace, userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to delete goal", "error", err)
+			http.Error(w, "Failed to delete goal", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// goalRequestFromArgs converts MCP tool arguments into a GoalRequest.
+func goalRequestFromArgs(args map[string]interface{}) GoalRequest {
+	var req GoalRequest
+	if v, ok := args["title"].(string); ok {
+		req.Title = &v
+	}
+	if v, ok := args["topics"].([]interface{}); ok {
+		req.Topics = []string{}
+		for _, t := range v {
+			if s, ok := t.(string); ok {
+				req.Topics = append(req.Topics, s)
+			}
+		}
+	}
+	if v, ok := args["target_score"].(float64); ok {
+		req.TargetScore = &v
+	}
+	if v, ok := args["deadline"].(string); ok {
+		req.Deadline = &v
+	}
+	if v, ok := args["status"].(string); ok {
+		req.Status = &v
+	}
+	return req
+}
+
+func handleSetLearningGoal(args map[string]interface{}) MCPResponse {
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	g := LearningGoal{WorkspaceID: workspaceArg(args), UserID: defaultUserID}
+	if id, ok := args["goal_id"].(string); ok && id != "" {
+		if !uuidPattern.MatchString(id) {
+			return errorResponse("goal_id must be a goal UUID")
+		}
+		if g, err = loadGoal(db, g.WorkspaceID, defaultUserID, id); err != nil {
+			return errorResponse(err.Error())
+		}
+	}
+	if err := goalRequestFromArgs(args).apply(&g); err != nil {
+		return errorResponse(err.Error())
+	}
+	if err := saveGoal(db, &g); err != nil {
+		return errorResponse(err.Error())
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: fmt.Sprintf("🎯 Goal saved: **%s** (topics: %s, status: %s)\n   • Goal ID: %s",
+				g.Title, strings.Join(g.Topics, ", "), g.Status, g.ID),
+		}},
+	}
+}
+
+func handleGetLearningGoals(args map[string]interface{}) MCPResponse {
+	status := "active"
+	if s, ok := args["status"].(string); ok {
+		status = s
+	}
+	if status == "all" {
+		status = ""
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	goals, err := listGoals(db, workspaceArg(args), defaultUserID, status)
+	if err == nil {
+		err = attachReports(db, goals)
+	}
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var responseText strings.Builder
+	if len(goals) == 0 {
+		responseText.WriteString("🎯 No learning goals yet. Set one with set_learning_goal!")
+	} else {
+		responseText.WriteString(fmt.Sprintf("🎯 **Learning Goals** (%d)\n\n", len(goals)))
+	}
+	for i, g := range goals {
+		responseText.WriteString(fmt.Sprintf("**%d. %s** — %.0f%% complete\n", i+1, g.Title, g.Report.Completion*100))
+		responseText.WriteString(fmt.Sprintf("   • Topics: %s (target %.1f/10)\n", strings.Join(g.Topics, ", "), g.TargetScore))
+		if g.Report.EstimatedDate != nil {
+			responseText.WriteString(fmt.Sprintf("   • Estimated completion: %s\n", g.Report.EstimatedDate.Format("2006-01-02")))
+		} else {
+			responseText.WriteString("   • Estimated completion: no progress in the last two weeks\n")
+		}
+		if g.Deadline != nil {
+			state := "on track"
+			if g.Report.OnTrack != nil && !*g.Report.OnTrack {
+				state = "behind"
+			}
+			responseText.WriteString(fmt.Sprintf("   • Deadline: %s (%s)\n", g.Deadline.Format("2006-01-02"), state))
+		}
+		responseText.WriteString(fmt.Sprintf("   • Goal ID: %s\n\n", g.ID))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoalCompletion(t *testing.T) {
+	if got := goalCompletion([]float64{3, 9}, 6); got != 0.75 {
+		t.Errorf("Expected 0.75 with one topic capped at its target, got %v", got)
+	}
+	if got := goalCompletion(nil, 6); got != 0 {
+		t.Errorf("Expected 0 for a goal without topics, got %v", got)
+	}
+}
+
+func TestEstimateGoal(t *testing.T) {
+	today := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	deadline := today.AddDate(0, 0, 30)
+
+	// 0.3 → 0.44 over 14 days is 0.01/day, so the remaining 0.56 takes 56 days
+	r := estimateGoal([]float64{2.64}, []float64{1.8}, 6, &deadline, today)
+	if r.EstimatedDate == nil || !r.EstimatedDate.Equal(today.AddDate(0, 0, 56)) {
+		t.Fatalf("Expected completion in 56 days, got %+v", r.EstimatedDate)
+	}
+	if r.OnTrack == nil || *r.OnTrack {
+		t.Errorf("Expected goal to be behind its deadline, got %+v", r.OnTrack)
+	}
+
+	stalled := estimateGoal([]float64{3}, []float64{3}, 6, nil, today)
+	if stalled.EstimatedDate != nil || stalled.OnTrack != nil {
+		t.Errorf("Expected no estimate without progress or deadline, got %+v", stalled)
+	}
+
+	done := estimateGoal([]float64{7}, []float64{5}, 6, &deadline, today)
+	if done.Completion != 1 || done.OnTrack == nil || !*done.OnTrack {
+		t.Errorf("Expected a reached goal to be complete and on track, got %+v", done)
+	}
+}
+
+func TestGoalRequestApply(t *testing.T) {
+	title := "  Pass CKA "
+	deadline := "2026-06-30"
+	g := LearningGoal{}
+	if err := (GoalRequest{Title: &title, Topics: []string{" Kubernetes", ""}, Deadline: &deadline}).apply(&g); err != nil {
+		t.Fatal(err)
+	}
+	if g.Title != "Pass CKA" || len(g.Topics) != 1 || g.Topics[0] != "kubernetes" {
+		t.Errorf("Expected normalized title and topics, got %+v", g)
+	}
+	if g.TargetScore != defaultGoalTarget || g.Status != "active" || g.Deadline == nil {
+		t.Errorf("Expected defaults and deadline to be set, got %+v", g)
+	}
+
+	bad := "next week"
+	if err := (GoalRequest{Deadline: &bad}).apply(&g); err == nil {
+		t.Error("Expected an invalid deadline to be rejected")
+	}
+}
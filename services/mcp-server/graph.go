@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxGraphDepth     = 3
+	maxGraphNeighbors = 10
+)
+
+// ConceptEdge links two concepts that co-occur in content. Weight is the
+// number of content items mentioning both.
+type ConceptEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Weight int    `json:"weight"`
+	Depth  int    `json:"depth"` // hops from the starting concept to To
+}
+
+// neighborFunc returns the strongest edges of a concept, From set to it.
+type neighborFunc func(concept string) ([]ConceptEdge, error)
+
+// relatedConcepts loads up to limit neighbors of concept, strongest first.
+func relatedConcepts(db *sql.DB, limit int) neighborFunc {
+	return func(concept string) ([]ConceptEdge, error) {
+		rows, err := db.Query(`
+			SELECT CASE WHEN source = $1 THEN target ELSE source END, weight
+			FROM concept_edges
+			WHERE source = $1 OR target = $1
+			ORDER BY weight DESC
+			LIMIT $2`, concept, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load related concepts: %v", err)
+		}
+		defer rows.Close()
+
+		var edges []ConceptEdge
+		for rows.Next() {
+			e := ConceptEdge{From: concept, Depth: 1}
+			if err := rows.Scan(&e.To, &e.Weight); err != nil {
+				continue
+			}
+			edges = append(edges, e)
+		}
+		return edges, nil
+	}
+}
+
+// graphNeighborhood walks the graph breadth-first from start up to depth
+// hops, returning each newly reached concept once, via the strongest edge
+// found at the shallowest depth.
+func graphNeighborhood(start string, depth int, neighbors neighborFunc) ([]ConceptEdge, error) {
+	visited := map[string]bool{start: true}
+	frontier := []string{start}
+	var edges []ConceptEdge
+
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		var next []string
+		for _, concept := range frontier {
+			found, err := neighbors(concept)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range found {
+				if visited[e.To] {
+					continue
+				}
+				visited[e.To] = true
+				e.Depth = d
+				edges = append(edges, e)
+				next = append(next, e.To)
+			}
+		}
+		frontier = next
+	}
+	return edges, nil
+}
+
+// lookupConcept resolves a concept name, returning its kind and mention count.
+func lookupConcept(db *sql.DB, name string) (string, int, error) {
+	var kind string
+	var mentions int
+	err := db.QueryRow(`SELECT kind, mention_count FROM knowledge_concepts WHERE name = $1`, name).Scan(&kind, &mentions)
+	return kind, mentions, err
+}
+
+func conceptArgs(args map[string]interface{}) (string, int, *MCPResponse) {
+	concept, ok := args["concept"].(string)
+	if !ok || concept == "" {
+		resp := errorResponse("Concept parameter is required")
+		return "", 0, &resp
+	}
+	limit := 5
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+	if limit > maxGraphNeighbors {
+		limit = maxGraphNeighbors
+	}
+	return strings.ToLower(strings.TrimSpace(concept)), limit, nil
+}
+
+func handleGetRelatedConcepts(args map[string]interface{}) MCPResponse {
+	concept, limit, errResp := conceptArgs(args)
+	if errResp != nil {
+		return *errResp
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	kind, mentions, err := lookupConcept(db, concept)
+	if err == sql.ErrNoRows {
+		return MCPResponse{
+			Content: []MCPContent{{
+				Type: "text",
+				Text: fmt.Sprintf("🕸️ '%s' is not in the knowledge graph yet.", concept),
+			}},
+		}
+	}
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Query failed: %v", err))
+	}
+
+	edges, err := relatedConcepts(db, limit)(concept)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var responseText strings.Builder
+	responseText.WriteString(fmt.Sprintf("🕸️ **%s** (%s, mentioned in %d items)\n\n", concept, kind, mentions))
+	if len(edges) == 0 {
+		responseText.WriteString("No related concepts yet.")
+	}
+	for i, e := range edges {
+		responseText.WriteString(fmt.Sprintf("**%d.** %s — co-mentioned in %d items\n", i+1, e.To, e.Weight))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
+
+func handleGetGraphNeighborhood(args map[string]interface{}) MCPResponse {
+	concept, limit, errResp := conceptArgs(args)
+	if errResp != nil {
+		return *errResp
+	}
+	depth := 2
+	if d, ok := args["depth"].(float64); ok && d > 0 {
+		depth = int(d)
+	}
+	if depth > maxGraphDepth {
+		depth = maxGraphDepth
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	if _, _, err := lookupConcept(db, concept); err == sql.ErrNoRows {
+		return MCPResponse{
+			Content: []MCPContent{{
+				Type: "text",
+				Text: fmt.Sprintf("🕸️ '%s' is not in the knowledge graph yet.", concept),
+			}},
+		}
+	} else if err != nil {
+		return errorResponse(fmt.Sprintf("Query failed: %v", err))
+	}
+
+	edges, err := graphNeighborhood(concept, depth, relatedConcepts(db, limit))
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var responseText strings.Builder
+	responseText.WriteString(fmt.Sprintf("🕸️ **Neighborhood of %s** (%d hops, %d concepts)\n\n", concept, depth, len(edges)))
+	if len(edges) == 0 {
+		responseText.WriteString("No related concepts yet.")
+	}
+	for _, e := range edges {
+		responseText.WriteString(fmt.Sprintf("%s%s → %s (%d)\n", strings.Repeat("  ", e.Depth-1), e.From, e.To, e.Weight))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestGraphNeighborhood(t *testing.T) {
+	graph := map[string][]ConceptEdge{
+		"tendermint": {{From: "tendermint", To: "cometbft", Weight: 12}, {From: "tendermint", To: "cosmos", Weight: 8}},
+		"cometbft":   {{From: "cometbft", To: "abci", Weight: 5}, {From: "cometbft", To: "tendermint", Weight: 12}},
+		"cosmos":     {{From: "cosmos", To: "ibc", Weight: 4}, {From: "cosmos", To: "abci", Weight: 2}},
+		"abci":       {{From: "abci", To: "golang", Weight: 3}},
+	}
+	neighbors := func(concept string) ([]ConceptEdge, error) { return graph[concept], nil }
+
+	edges, err := graphNeighborhood("tendermint", 2, neighbors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ConceptEdge{
+		{From: "tendermint", To: "cometbft", Weight: 12, Depth: 1},
+		{From: "tendermint", To: "cosmos", Weight: 8, Depth: 1},
+		{From: "cometbft", To: "abci", Weight: 5, Depth: 2},
+		{From: "cosmos", To: "ibc", Weight: 4, Depth: 2},
+	}
+	if len(edges) != len(want) {
+		t.Fatalf("Expected %d edges, got %+v", len(want), edges)
+	}
+	for i := range want {
+		if edges[i] != want[i] {
+			t.Errorf("Edge %d: expected %+v, got %+v", i, want[i], edges[i])
+		}
+	}
+
+	edges, _ = graphNeighborhood("tendermint", 3, neighbors)
+	if last := edges[len(edges)-1]; last.To != "golang" || last.Depth != 3 {
+		t.Errorf("Expected golang at depth 3, got %+v", last)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// QueryRecord is one search or question, kept in query_history. The
+// progress engine counts a topic's queries from it for total_queries.
+// ResultCount is nil for questions, which have no result list.
+type QueryRecord struct {
+	ID          string    `json:"id,omitempty"`
+	WorkspaceID string    `json:"workspace_id"`
+	UserID      string    `json:"user_id"`
+	Query       string    `json:"query"`
+	Tool        string    `json:"tool"`
+	ResultCount *int      `json:"result_count,omitempty"`
+	RequestID   string    `json:"request_id,omitempty"`
+	DurationMS  int       `json:"duration_ms"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Searches served under an experiment also keep its variant and the
+	// IDs they returned
+	Experiment string   `json:"-"`
+	Variant    string   `json:"-"`
+	ResultIDs  []string `json:"-"`
+}
+
+func recordQuery(db *sql.DB, q *QueryRecord) error {
+	if q.UserID == "" {
+		q.UserID = defaultUserID
+	}
+	err := db.QueryRow(`
+		INSERT INTO query_history (workspace_id, user_id, query_text, tool, result_count, request_id, processing_time_ms,
+			experiment, variant, result_ids)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, ''), string_to_array(NULLIF($10, ''), ','))
+		RETURNING id`,
+		q.WorkspaceID, q.UserID, q.Query, q.Tool, q.ResultCount, q.RequestID, q.DurationMS,
+		q.Experiment, q.Variant, strings.Join(q.ResultIDs, ",")).Scan(&q.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record query: %v", err)
+	}
+	return nil
+}
+
+// logQuery records a query without failing the caller's request, and
+// returns its ID, "" when it could not be recorded.
+func logQuery(db *sql.DB, q QueryRecord) string {
+	if err := recordQuery(db, &q); err != nil {
+		slog.Error("failed to record query", "tool", q.Tool, "error", err)
+	}
+	return q.ID
+}
+
+// listQueryHistory returns a user's most recent queries, optionally for one
+// tool only.
+func listQueryHistory(db *sql.DB, workspace, userID, tool string, limit int) ([]QueryRecord, error) {
+	rows, err := db.Query(`
+		SELECT id, workspace_id, COALESCE(user_id, ''), query_text, COALESCE(tool, ''), result_count,
+		       COALESCE(request_id, ''), COALESCE(processing_time_ms, 0), created_at
+		FROM query_history
+		WHERE workspace_id = $1 AND user_id = $2 AND ($3 = '' OR tool = $3)
+		ORDER BY created_at DESC
+		LIMIT $4`, workspace, userID, tool, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load query history: %v", err)
+	}
+	defer rows.Close()
+
+	history := []QueryRecord{}
+	for rows.Next() {
+		var q QueryRecord
+		var count sql.NullInt64
+		if err := rows.Scan(&q.ID, &q.WorkspaceID, &q.UserID, &q.Query, &q.Tool, &count,
+			&q.RequestID, &q.DurationMS, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		if count.Valid {
+			n := int(count.Int64)
+			q.ResultCount = &n
+		}
+		history = append(history, q)
+	}
+	return history, rows.Err()
+}
+
+// queriesHandler serves GET /queries (the caller's history) and POST
+// /queries, which the gateway uses to record questions asked through it.
+func queriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		userID := q.Get("user_id")
+		if userID == "" {
+			userID = defaultUserID
+		}
+		limit := 20
+		if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+		history, err := listQueryHistory(db, requestWorkspace(r), userID, q.Get("tool"), limit)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to list query history", "error", err)
+			http.Error(w, "Failed to load query history", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"queries": history})
+
+	case http.MethodPost:
+		var q QueryRecord
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&q); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(q.Query) == "" || q.Tool == "" {
+			http.Error(w, "query and tool are required", http.StatusBadRequest)
+			return
+		}
+		q.WorkspaceID = requestWorkspace(r)
+		if q.RequestID == "" {
+			q.RequestID = logging.RequestID(r.Context())
+		}
+		if err := recordQuery(db, &q); err != nil {
+			logging.FromContext(r.Context()).Error("failed to record query", "error", err)
+			http.Error(w, "Failed to record query", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func handleGetQueryHistory(args map[string]interface{}) MCPResponse {
+	limit := 20
+	if l, ok := args["limit"].(float64); ok && l > 0 && l <= 100 {
+		limit = int(l)
+	}
+	tool, _ := args["tool"].(string)
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	history, err := listQueryHistory(db, workspaceArg(args), defaultUserID, tool, limit)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var responseText strings.Builder
+	if len(history) == 0 {
+		responseText.WriteString("🕘 No queries recorded yet.")
+	} else {
+		responseText.WriteString(fmt.Sprintf("🕘 **Recent Queries** (%d)\n\n", len(history)))
+	}
+	for _, q := range history {
+		results := "question"
+		if q.ResultCount != nil {
+			results = fmt.Sprintf("%d results", *q.ResultCount)
+		}
+		responseText.WriteString(fmt.Sprintf("• %s — \"%s\" via %s (%s)\n",
+			q.CreatedAt.Format("2006-01-02 15:04"), q.Query, q.Tool, results))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueriesHandlerRejectsOtherMethods(t *testing.T) {
+	w := httptest.NewRecorder()
+	queriesHandler(w, httptest.NewRequest("DELETE", "/queries", nil))
+	if w.Code != 405 {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
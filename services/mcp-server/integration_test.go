@@ -0,0 +1,376 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"selin/internal/events"
+	"selin/internal/storage"
+	"selin/internal/tagging"
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration . (needs a Docker daemon)
+
+// TestContentPathAgainstPostgres follows content from storage, the way the
+// collectors store it, through search, trends and learning progress.
+func TestContentPathAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+	store := storage.NewPostgres(db)
+
+	for i, c := range []storage.Content{
+		{Summary: "IBC relayer internals", Tags: []string{"cosmos", "ibc"}, RelevanceScore: 0.9},
+		{Summary: "Cosmos SDK module wiring", Tags: []string{"cosmos", "golang"}, RelevanceScore: 0.7},
+		{Summary: "Goroutine leaks", Tags: []string{"golang"}, RelevanceScore: 0.6},
+	} {
+		c.Workspace = defaultWorkspace
+		c.SourceURL = "https://example.com/" + c.Summary
+		c.SourcePlatform = "reddit"
+		c.Timestamp = time.Now().Add(-time.Duration(i) * time.Hour)
+		if _, inserted, err := store.SaveContent(ctx, c); err != nil || !inserted {
+			t.Fatalf("Failed to store %q: inserted=%v err=%v", c.Summary, inserted, err)
+		}
+	}
+	args := func(kv ...interface{}) map[string]interface{} {
+		m := map[string]interface{}{workspaceArgName: defaultWorkspace}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i].(string)] = kv[i+1]
+		}
+		return m
+	}
+
+	t.Run("search records the query", func(t *testing.T) {
+		resp := handleSearchContent(args("query", "cosmos"))
+		if resp.IsError || !strings.Contains(resp.Content[0].Text, "Found 2 results") {
+			t.Fatalf("Unexpected search response: %+v", resp)
+		}
+		var tool string
+		var results int
+		if err := db.QueryRow(`SELECT tool, result_count FROM query_history WHERE query_text = 'cosmos'`).Scan(&tool, &results); err != nil {
+			t.Fatal(err)
+		}
+		if tool != "search_content" || results != 2 {
+			t.Errorf("Expected the search in query_history, got %s with %d results", tool, results)
+		}
+	})
+
+	t.Run("trends read the snapshots", func(t *testing.T) {
+		if err := snapshotContentStats(db, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		resp := handleAnalyzeTrends(args("topic", "golang"))
+		text := resp.Content[0].Text
+		if resp.IsError || !strings.Contains(text, "**Reddit**: 3 items") || !strings.Contains(text, "• cosmos: 2 items") {
+			t.Errorf("Unexpected trends: %s", text)
+		}
+		if !strings.Contains(text, time.Now().UTC().Format("2006-01-02")+": 2 items") {
+			t.Errorf("Expected today's golang items in the series: %s", text)
+		}
+	})
+
+	t.Run("progress follows reads", func(t *testing.T) {
+		if err := store.TrackTopic(ctx, defaultWorkspace, "ibc"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`
+			INSERT INTO content_interactions (content_id, interaction_type)
+			SELECT id, 'read' FROM content_metadata WHERE 'ibc' = ANY(tags)`); err != nil {
+			t.Fatal(err)
+		}
+		if err := updateLearningProgress(db); err != nil {
+			t.Fatal(err)
+		}
+		p, err := store.Progress(ctx, defaultWorkspace, "ibc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Score <= 0 {
+			t.Errorf("Expected the read to raise the ibc score, got %+v", p)
+		}
+		resp := handleGetLearningProgress(args("topic", "ibc"))
+		if resp.IsError || !strings.Contains(resp.Content[0].Text, "Learning Progress for Ibc") {
+			t.Errorf("Unexpected progress response: %+v", resp)
+		}
+	})
+
+	t.Run("interactions are listed per workspace", func(t *testing.T) {
+		for workspace, want := range map[string]string{defaultWorkspace: `"interaction_type":"read"`, "acme": `"interactions":[]`} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/content/interactions", nil)
+			req.Header.Set(workspaceHeader, workspace)
+			vouch(t, req)
+			rr := httptest.NewRecorder()
+			listInteractions(rr, req)
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Errorf("%s: expected %s, got %s", workspace, want, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("preferences set search defaults", func(t *testing.T) {
+		resp := handleSetPreferences(args("default_platform", "slack", "result_format", "concise"))
+		if resp.IsError || !strings.Contains(resp.Content[0].Text, "**Default platform**: slack") {
+			t.Fatalf("Unexpected set_preferences response: %+v", resp)
+		}
+		if text := handleSearchContent(args("query", "cosmos")).Content[0].Text; !strings.Contains(text, "Found 0 results") {
+			t.Errorf("Expected the search limited to Slack: %s", text)
+		}
+		text := handleSearchContent(args("query", "cosmos", "platform", "all")).Content[0].Text
+		if !strings.Contains(text, "Found 2 results") || strings.Contains(text, "Author:") {
+			t.Errorf("Expected concise results from every platform: %s", text)
+		}
+		handleSetPreferences(args("default_platform", "all", "result_format", "balanced"))
+	})
+
+	t.Run("writes change the content ETag", func(t *testing.T) {
+		handler := withContentETag(contentVersion, tagsHandler)
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "/tags", nil))
+		etag := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || etag == "" {
+			t.Fatalf("Expected tagged tags, got %d with ETag %q", rr.Code, etag)
+		}
+
+		revalidate := func() int {
+			req := httptest.NewRequest("GET", "/tags", nil)
+			req.Header.Set("If-None-Match", etag)
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			return rr.Code
+		}
+		if code := revalidate(); code != http.StatusNotModified {
+			t.Errorf("Expected 304 before any write, got %d", code)
+		}
+		if _, err := db.Exec(`UPDATE content_metadata SET tags = array_append(tags, 'relayers') WHERE content_summary = 'IBC relayer internals'`); err != nil {
+			t.Fatal(err)
+		}
+		if code := revalidate(); code != http.StatusOK {
+			t.Errorf("Expected the write to invalidate the ETag, got %d", code)
+		}
+	})
+
+	t.Run("feedback tunes relevance", func(t *testing.T) {
+		var id string
+		if err := db.QueryRow(`SELECT id FROM content_metadata WHERE content_summary = 'Goroutine leaks'`).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO topic_weights (topic, weight, useful, updated_at) VALUES ('ibc', 1.2, 1, now() - INTERVAL '1 day')`); err != nil {
+			t.Fatal(err)
+		}
+		rate := func(user string, useful bool) {
+			f := Feedback{UserID: user, ContentID: id, Useful: &useful}
+			if err := f.validate(); err != nil {
+				t.Fatal(err)
+			}
+			if err := recordFeedback(db, &f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		check := func(wantScore, wantWeight float64) {
+			t.Helper()
+			if _, err := applyFeedback(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+			var score, weight float64
+			if err := db.QueryRow(`SELECT relevance_score FROM content_metadata WHERE id = $1`, id).Scan(&score); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.QueryRow(`SELECT weight FROM topic_weights WHERE topic = 'golang'`).Scan(&weight); err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(score-wantScore) > 1e-4 || math.Abs(weight-wantWeight) > 1e-4 {
+				t.Errorf("Expected score %.4f and golang weight %.4f, got %.4f and %.4f", wantScore, wantWeight, score, weight)
+			}
+		}
+
+		rate("ana", true)
+		rate("bo", true)
+		rate("cy", true)
+		check(0.7, 1.25)
+		// The latest rating counts, and the last adjustment is replaced
+		rate("cy", false)
+		check(0.6+0.2/6, 1+0.5/6)
+
+		var stale float64
+		if err := db.QueryRow(`SELECT weight FROM topic_weights WHERE topic = 'ibc'`).Scan(&stale); err != nil || stale != 1 {
+			t.Errorf("Expected an unrated topic back at 1, got %v (%v)", stale, err)
+		}
+	})
+
+	t.Run("embeddings leave the backlog", func(t *testing.T) {
+		var id string
+		if err := db.QueryRow(`SELECT id FROM content_metadata WHERE content_summary = 'Goroutine leaks'`).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		bus := events.NewMemory()
+		watchCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go watchEmbeddings(watchCtx, bus, db)
+
+		ready, _ := events.New(events.EmbeddingReady, defaultWorkspace, events.Embedding{ContentID: id})
+		backlog := func() int {
+			stats, err := loadSystemStats(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return stats.EmbeddingBacklog
+		}
+		// The subscription starts in the background, so publish until it hears
+		for deadline := time.Now().Add(2 * time.Second); backlog() != 2; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the embedded item off the backlog, %d left", backlog())
+			}
+			bus.Publish(ctx, ready)
+		}
+	})
+
+	t.Run("a card counts towards progress once", func(t *testing.T) {
+		var card string
+		if err := db.QueryRow(`
+			INSERT INTO quiz_cards (content_id, topic, question, answer)
+			SELECT id, 'golang', 'What leaks?', 'goroutines' FROM content_metadata WHERE content_summary = 'Goroutine leaks'
+			RETURNING id`).Scan(&card); err != nil {
+			t.Fatal(err)
+		}
+		for _, answer := range []string{"goroutine", "Goroutines!", "goroutines"} {
+			if _, err := submitQuizAnswers(db, []QuizAnswer{{CardID: card, Answer: answer}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := submitQuizAnswers(db, []QuizAnswer{{CardID: card, Answer: "goroutines"}, {CardID: "00000000-0000-0000-0000-000000000000"}}); err == nil {
+			t.Error("Expected an unknown card to refuse the submission")
+		}
+
+		var attempts, quizzed int
+		if err := db.QueryRow(`
+			SELECT (SELECT COUNT(*) FROM quiz_attempts WHERE card_id = $1),
+				(SELECT COUNT(*) FROM content_interactions WHERE interaction_type = 'quizzed')`, card).Scan(&attempts, &quizzed); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 3 || quizzed != 1 {
+			t.Errorf("Expected 3 attempts and one quizzed interaction, got %d and %d", attempts, quizzed)
+		}
+	})
+
+	t.Run("deleting a user's data", func(t *testing.T) {
+		if _, err := db.Exec(`INSERT INTO query_history (user_id, query_text) VALUES ('ana', 'goroutines'), ('bo', 'channels')`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO user_preferences (user_id) VALUES ('ana')`); err != nil {
+			t.Fatal(err)
+		}
+
+		deleted, err := deleteUserData(ctx, db, "ana")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted["query_history"] != 1 || deleted["result_feedback"] != 1 || deleted["user_preferences"] != 1 || deleted["quiz_cards"] != 0 {
+			t.Errorf("Expected ana's query, rating and preferences deleted, got %v", deleted)
+		}
+		var left int
+		if err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM query_history WHERE user_id = 'bo') + (SELECT COUNT(*) FROM result_feedback WHERE user_id = 'bo')`).Scan(&left); err != nil || left != 2 {
+			t.Errorf("Expected bo's data kept, got %d rows (%v)", left, err)
+		}
+	})
+}
+
+// TestReindexAgainstPostgres interrupts a reindex between batches and
+// checks it resumes where it left off.
+func TestReindexAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+	store := storage.NewPostgres(db)
+
+	for _, summary := range []string{"Cosmos SDK upgrades", "IBC light clients", "Tendermint consensus"} {
+		c := storage.Content{
+			Workspace:      defaultWorkspace,
+			Summary:        summary,
+			Tags:           []string{"tm"},
+			SourceURL:      "https://example.com/" + summary,
+			SourcePlatform: "reddit",
+			Timestamp:      time.Now(),
+		}
+		if _, _, err := store.SaveContent(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`ALTER TABLE content_metadata DISABLE TRIGGER content_metadata_search_vector`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE content_metadata SET search_vector = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`ALTER TABLE content_metadata ENABLE TRIGGER content_metadata_search_vector`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tagging.SetAlias(ctx, db, defaultWorkspace, "tm", "tendermint"); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := ReindexRequest{BatchSize: 2}.job()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := startReindex(db, &job); err != nil {
+		t.Fatal(err)
+	}
+	if err := startReindex(db, &ReindexJob{Steps: defaultReindexSteps, BatchSize: 2}); err != errReindexUnfinished {
+		t.Fatalf("Expected a second job to be refused, got %v", err)
+	}
+
+	run, err := claimReindex(db, "first")
+	if err != nil || run == nil {
+		t.Fatalf("Expected to claim the job, got %v (%v)", run, err)
+	}
+	if more, err := run.batch(ctx); !more || err != nil {
+		t.Fatalf("Expected the first batch to run, got %v (%v)", more, err)
+	}
+	if _, err := setReindexStatus(db, "paused", "running"); err != nil {
+		t.Fatal(err)
+	}
+	if more, err := run.batch(ctx); more || err != nil {
+		t.Fatalf("Expected the paused job to stop, got %v (%v)", more, err)
+	}
+	if _, err := setReindexStatus(db, "running", "paused"); err != nil {
+		t.Fatal(err)
+	}
+	run, err = claimReindex(db, "second")
+	if err != nil || run == nil {
+		t.Fatalf("Expected to claim the resumed job, got %v (%v)", run, err)
+	}
+	if run.job.Processed != 2 {
+		t.Errorf("Expected to resume after 2 rows, got %d", run.job.Processed)
+	}
+	for {
+		more, err := run.batch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !more {
+			break
+		}
+	}
+
+	latest, err := latestReindex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status != "completed" || latest.Processed != 3 || latest.Total != 3 {
+		t.Errorf("Expected all 3 rows reindexed once, got %+v", latest)
+	}
+	var missing, aliased int
+	if err := db.QueryRow(`SELECT count(*) FILTER (WHERE search_vector IS NULL), count(*) FILTER (WHERE tags = '{tendermint}')
+		FROM content_metadata`).Scan(&missing, &aliased); err != nil {
+		t.Fatal(err)
+	}
+	if missing != 0 || aliased != 3 {
+		t.Errorf("Expected every row rebuilt, got %d without a search vector and %d aliased", missing, aliased)
+	}
+}
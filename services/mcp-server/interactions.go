@@ -0,0 +1,238 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"selin/internal/logging"
+)
+
+const defaultUserID = "default_user"
+
+var (
+	validInteractionTypes = map[string]bool{"viewed": true, "read": true}
+	uuidPattern           = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	errContentNotFound = fmt.Errorf("content not found")
+)
+
+// Interaction records that a user viewed or read a content item. Reads feed
+// learning progress and recommendations.
+type Interaction struct {
+	ID              string    `json:"id,omitempty"`
+	UserID          string    `json:"user_id,omitempty"`
+	ContentID       string    `json:"content_id"`
+	InteractionType string    `json:"interaction_type,omitempty"` // viewed, read
+	Rating          int       `json:"rating,omitempty"`           // 1-5, 0 when unrated
+	Notes           string    `json:"notes,omitempty"`
+	QueryID         string    `json:"query_id,omitempty"` // the search it was found through
+	CreatedAt       time.Time `json:"created_at,omitempty"`
+
+	workspace string // only content in this workspace can be recorded
+}
+
+// validate fills in defaults and checks the interaction fields.
+func (i *Interaction) validate() error {
+	if i.UserID == "" {
+		i.UserID = defaultUserID
+	}
+	if i.workspace == "" {
+		i.workspace = defaultWorkspace
+	}
+	if i.InteractionType == "" {
+		i.InteractionType = "read"
+	}
+	if !uuidPattern.MatchString(i.ContentID) {
+		return fmt.Errorf("content_id must be a content UUID")
+	}
+	if i.QueryID != "" && !uuidPattern.MatchString(i.QueryID) {
+		return fmt.Errorf("query_id must be a query UUID")
+	}
+	if !validInteractionTypes[i.InteractionType] {
+		return fmt.Errorf("interaction_type must be viewed or read")
+	}
+	if i.Rating < 0 || i.Rating > 5 {
+		return fmt.Errorf("rating must be between 1 and 5")
+	}
+	if len(i.Notes) > 2000 {
+		return fmt.Errorf("notes must be at most 2000 characters")
+	}
+	return nil
+}
+
+// recordInteraction stores i and, for reads, counts it towards the learning
+// progress of every topic the content is tagged with.
+func recordInteraction(db *sql.DB, i *Interaction) error {
+	var rating sql.NullInt64
+	if i.Rating > 0 {
+		rating = sql.NullInt64{Int64: int64(i.Rating), Valid: true}
+	}
+
+	// A query_id that is not the workspace's is dropped, not refused
+	err := db.QueryRow(`
+		INSERT INTO content_interactions (user_id, content_id, interaction_type, rating, notes, query_id)
+		SELECT $1, id, $3, $4, NULLIF($5, ''),
+			(SELECT q.id FROM query_history q WHERE q.id::text = NULLIF($7, '') AND q.workspace_id = $6)
+		FROM content_metadata WHERE id = $2 AND workspace_id = $6
+		RETURNING id, created_at`,
+		i.UserID, i.ContentID, i.InteractionType, rating, i.Notes, i.workspace, i.QueryID).Scan(&i.ID, &i.CreatedAt)
+	if err == sql.ErrNoRows {
+		return errContentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record interaction: %v", err)
+	}
+
+	if i.InteractionType == "read" {
+		_, err = db.Exec(`
+			UPDATE learning_progress
+			SET total_content_consumed = total_content_consumed + 1
+			WHERE workspace_id = $2 AND topic IN (SELECT unnest(tags) FROM content_metadata WHERE id = $1)`,
+			i.ContentID, i.workspace)
+		if err != nil {
+			slog.Error("failed to count read towards progress", "content_id", i.ContentID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// interactionsHandler serves POST (record) and GET (list) on
+// /content/interactions.
+func interactionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		createInteraction(w, r)
+	case http.MethodGet:
+		listInteractions(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createInteraction(w http.ResponseWriter, r *http.Request) {
+	i := Interaction{workspace: requestWorkspace(r)}
+	if err := json.NewDecoder(r.Body).Decode(&i); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := i.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	if err := recordInteraction(db, &i); err != nil {
+		if err == errContentNotFound {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		logging.FromContext(r.Context()).Error("failed to record interaction", "error", err)
+		http.Error(w, "Failed to record interaction", http.StatusInternalServerError)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("recorded interaction", "user_id", i.UserID, "type", i.InteractionType, "content_id", i.ContentID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(i)
+}
+
+func listInteractions(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = defaultUserID
+	}
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	// Only interactions with the workspace's content are listed
+	query := `
+		SELECT i.id, i.user_id, i.content_id, i.interaction_type, COALESCE(i.rating, 0), COALESCE(i.notes, ''), i.created_at
+		FROM content_interactions i JOIN content_metadata c ON c.id = i.content_id
+		WHERE i.user_id = $1 AND c.workspace_id = $2`
+	args := []interface{}{userID, requestWorkspace(r)}
+	if contentID := r.URL.Query().Get("content_id"); contentID != "" {
+		query += " AND i.content_id::text = $3"
+		args = append(args, contentID)
+	}
+	query += " ORDER BY i.created_at DESC LIMIT " + strconv.Itoa(limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to list interactions", "error", err)
+		http.Error(w, "Failed to list interactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	interactions := []Interaction{}
+	for rows.Next() {
+		var i Interaction
+		if err := rows.Scan(&i.ID, &i.UserID, &i.ContentID, &i.InteractionType, &i.Rating, &i.Notes, &i.CreatedAt); err != nil {
+			continue
+		}
+		interactions = append(interactions, i)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":      userID,
+		"interactions": interactions,
+	})
+}
+
+func handleMarkAsRead(args map[string]interface{}) MCPResponse {
+	i := Interaction{InteractionType: "read", workspace: workspaceArg(args)}
+	i.ContentID, _ = args["content_id"].(string)
+	if r, ok := args["rating"].(float64); ok {
+		i.Rating = int(r)
+	}
+	i.Notes, _ = args["notes"].(string)
+	if err := i.validate(); err != nil {
+		return errorResponse(err.Error())
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	if err := recordInteraction(db, &i); err != nil {
+		return errorResponse(err.Error())
+	}
+
+	text := fmt.Sprintf("✅ Marked content %s as read", i.ContentID)
+	if i.Rating > 0 {
+		text += fmt.Sprintf(" (rated %d/5)", i.Rating)
+	}
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: text + ". It now counts towards your learning progress.",
+		}},
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestInteractionValidate(t *testing.T) {
+	const contentID = "3f2b8c1e-9a4d-4e6f-8b7a-1c2d3e4f5a6b"
+
+	i := Interaction{ContentID: contentID}
+	if err := i.validate(); err != nil {
+		t.Fatalf("Expected valid interaction, got %v", err)
+	}
+	if i.UserID != defaultUserID || i.InteractionType != "read" {
+		t.Errorf("Expected defaults to be filled in, got user %q type %q", i.UserID, i.InteractionType)
+	}
+
+	invalid := []Interaction{
+		{ContentID: "not-a-uuid"},
+		{ContentID: contentID, InteractionType: "liked"},
+		{ContentID: contentID, Rating: 6},
+		{ContentID: contentID, Rating: -1},
+		{ContentID: contentID, QueryID: "q1"},
+	}
+	for _, i := range invalid {
+		if err := i.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", i)
+		}
+	}
+}
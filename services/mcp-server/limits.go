@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"selin/internal/config"
+	"selin/internal/logging"
+	"selin/internal/ratelimit"
+)
+
+// toolLimiter limits tool calls per caller and tool, so an agent stuck in
+// a loop cannot hammer an expensive tool. main sets it up; it is nil, and
+// calls are not limited, when MCP_RATE_LIMIT is 0.
+var toolLimiter *ratelimit.Limiter
+
+// defaultToolRateLimit is MCP_RATE_LIMIT, the calls per minute each caller
+// may make to each tool unless the tools file sets the tool's own limit.
+func defaultToolRateLimit() int {
+	n, err := strconv.Atoi(config.Env("MCP_RATE_LIMIT", "30"))
+	if err != nil || n < 0 {
+		return 30
+	}
+	return n
+}
+
+// newToolLimiter shares its windows, and the allow and deny lists, with
+// the gateway through Redis at REDIS_URL.
+func newToolLimiter() *ratelimit.Limiter {
+	limit := defaultToolRateLimit()
+	if limit == 0 {
+		return nil
+	}
+	client := config.RedisClient(config.Env("REDIS_URL", "localhost:6379"))
+	return ratelimit.New(client, limit, time.Minute, ratelimit.FallbackFromEnv())
+}
+
+// callerIdentity is who a tool call is limited as: the user the gateway
+// vouches for, or the caller's address, scoped to its workspace the way the
+// gateway scopes its own limits.
+func callerIdentity(r *http.Request) string {
+	id := requestUser(r)
+	if id == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		id = "ip:" + host
+	}
+	if ws := requestWorkspace(r); ws != defaultWorkspace {
+		return ws + ":" + id
+	}
+	return id
+}
+
+// limitTool returns the error response for a call over the caller's limit
+// for the tool, and whether it is.
+func limitTool(r *http.Request, tool MCPTool) (MCPResponse, bool) {
+	if toolLimiter == nil {
+		return MCPResponse{}, false
+	}
+	limit := tool.RateLimit
+	if limit == 0 {
+		limit = toolLimiter.Limit()
+	}
+	identity := callerIdentity(r)
+	allowed, err := toolLimiter.Allow(r.Context(), "mcp:"+tool.Name+":"+identity, identity, limit)
+	switch {
+	case errors.Is(err, ratelimit.ErrBlocked):
+		logging.FromContext(r.Context()).Warn("blocked tool call", "tool", tool.Name, "identity", identity)
+		return errorResponse(fmt.Sprintf("🚫 %s is blocked from calling tools", identity)), true
+	case err != nil:
+		return errorResponse(fmt.Sprintf("⏳ Rate limiting is unavailable, so %s cannot be called right now; try again in %s",
+			tool.Name, ratelimit.RetryInterval)), true
+	case !allowed:
+		logging.FromContext(r.Context()).Warn("rate limited tool call", "tool", tool.Name, "identity", identity, "limit", limit)
+		return errorResponse(fmt.Sprintf("⏳ Rate limit reached: %s allows %d calls per minute. Wait up to a minute before calling it again, "+
+			"and work with the results you already have in the meantime", tool.Name, limit)), true
+	}
+	return MCPResponse{}, false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/ratelimit"
+)
+
+// withToolLimiter limits tool calls to limit per minute for the test.
+func withToolLimiter(t *testing.T, limit int) *ratelimit.Limiter {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	l := ratelimit.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), limit, time.Minute, ratelimit.FallbackLocal)
+	saved := toolLimiter
+	toolLimiter = l
+	t.Cleanup(func() {
+		toolLimiter = saved
+		l.Close()
+	})
+	return l
+}
+
+func TestCallerIdentity(t *testing.T) {
+	r := httptest.NewRequest("POST", "/mcp/call", nil)
+	r.RemoteAddr = "10.1.2.3:5555"
+	if got := callerIdentity(r); got != "ip:10.1.2.3" {
+		t.Errorf("Expected the caller's address, got %s", got)
+	}
+	r.Header.Set("X-User-ID", "alice")
+	r.Header.Set(workspaceHeader, "team")
+	if got := callerIdentity(r); got != "ip:10.1.2.3" {
+		t.Errorf("Expected the headers ignored without the token, got %s", got)
+	}
+	vouch(t, r)
+	if got := callerIdentity(r); got != "team:alice" {
+		t.Errorf("Expected the user scoped to the workspace, got %s", got)
+	}
+}
+
+func TestToolCallsAreLimitedPerTool(t *testing.T) {
+	withToolLimiter(t, 2)
+	call := func(name string) MCPResponse {
+		r := httptest.NewRequest("POST", "/mcp/call", nil)
+		r.Header.Set("X-User-ID", "alice")
+		return callTool(r, name, map[string]interface{}{})
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := call("search_content"); strings.Contains(resp.Content[0].Text, "Rate limit") {
+			t.Fatalf("Call %d should not be limited: %s", i+1, resp.Content[0].Text)
+		}
+	}
+	resp := call("search_content")
+	if !resp.IsError || !strings.Contains(resp.Content[0].Text, "search_content allows 2 calls per minute") {
+		t.Errorf("Expected an informative limit error, got %+v", resp)
+	}
+	if resp := call("get_thread"); strings.Contains(resp.Content[0].Text, "Rate limit") {
+		t.Errorf("Expected other tools to have their own limit, got %s", resp.Content[0].Text)
+	}
+}
+
+func TestToolRateLimitFromConfig(t *testing.T) {
+	withToolLimiter(t, 30)
+	saved := tools
+	t.Cleanup(func() { tools = saved })
+	tools = mustRegistry(builtinTools(), toolConfig{RateLimits: map[string]int{"search_content": 1}})
+
+	r := httptest.NewRequest("POST", "/mcp/call", nil)
+	callTool(r, "search_content", nil)
+	if resp := callTool(r, "search_content", nil); !strings.Contains(resp.Content[0].Text, "allows 1 calls per minute") {
+		t.Errorf("Expected the configured limit, got %s", resp.Content[0].Text)
+	}
+
+	if _, err := newToolRegistry(builtinTools(), toolConfig{RateLimits: map[string]int{"search_content": 0}}); err == nil {
+		t.Error("Expected a zero limit to be rejected")
+	}
+}
+
+func TestDenylistedCallersAreBlocked(t *testing.T) {
+	l := withToolLimiter(t, 30)
+	if err := l.AddToList(context.Background(), "denylist", "abuser"); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/mcp/call", nil)
+	r.Header.Set("X-User-ID", "abuser")
+	vouch(t, r)
+	if resp := callTool(r, "search_content", nil); !resp.IsError || !strings.Contains(resp.Content[0].Text, "blocked") {
+		t.Errorf("Expected a blocked error, got %+v", resp)
+	}
+}
@@ -1,17 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"selin/internal/config"
+	"selin/internal/events"
+	"selin/internal/experiment"
+	"selin/internal/flags"
+	"selin/internal/healthcheck"
+	"selin/internal/llm"
+	"selin/internal/logging"
+	"selin/internal/preferences"
+	"selin/internal/rbac"
+	"selin/internal/search"
+	"selin/internal/storage"
+	"selin/internal/tlsserve"
+	"selin/internal/tokenizer"
 )
 
 // MCP Tool definitions for Claude
@@ -19,6 +34,11 @@ type MCPTool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	InputSchema map[string]interface{} `json:"inputSchema"`
+	// Handler runs the tool with the call's arguments
+	Handler func(args map[string]interface{}) MCPResponse `json:"-"`
+	// RateLimit is the calls per minute each caller may make, 0 for
+	// MCP_RATE_LIMIT
+	RateLimit int `json:"-"`
 }
 
 type MCPRequest struct {
@@ -36,39 +56,129 @@ type MCPContent struct {
 	Text string `json:"text"`
 }
 
-type ContentResult struct {
-	ID             string    `json:"id"`
-	SourceURL      string    `json:"source_url"`
-	Author         string    `json:"author"`
-	Timestamp      time.Time `json:"timestamp"`
-	Tags           []string  `json:"tags"`
-	ContentType    string    `json:"content_type"`
-	SourcePlatform string    `json:"source_platform"`
-	ContentSummary string    `json:"content_summary"`
-	RelevanceScore float64   `json:"relevance_score"`
-}
-
 func main() {
-	log.Println("🚀 Starting Selin MCP Server for Claude...")
+	logging.Setup("mcp-server", "1.0.0")
+	// Fail at startup rather than on first use when the flags, the
+	// tokenizer vocabulary or the LLM provider are misconfigured
+	flags.Default()
+	tokenizer.Default()
+	llm.Default()
+	slog.Info("starting selin mcp server")
+
+	var err error
+	if policy, err = rbac.FromEnv(); err != nil {
+		logging.Fatal("failed to load rbac policy", "error", err)
+	}
+	if tools, err = loadTools(); err != nil {
+		logging.Fatal("failed to load tools", "error", err)
+	}
+	toolLimiter = newToolLimiter()
+
+	// The ledger outlives requests, unlike the handlers' connections
+	budgets, err := llm.BudgetsFromEnv()
+	if err != nil {
+		logging.Fatal("failed to load llm budgets", "error", err)
+	}
+	ledgerDB, err := getDBConnection()
+	if err != nil {
+		logging.Fatal("failed to open usage ledger", "error", err)
+	}
+	usageLedger = llm.NewSQLLedger(ledgerDB, budgets)
+	if client := llm.Default(); client != nil {
+		client.Ledger = usageLedger
+		client.Cache = llm.NewSQLEmbedCache(ledgerDB)
+	}
+	if _, err := searchRanking("", ""); err != nil {
+		logging.Fatal("invalid search ranking", "error", err)
+	}
+	if searchStaleness, err = search.StalenessFromEnv(); err != nil {
+		logging.Fatal("failed to load staleness policy", "error", err)
+	}
+	if searchExperiment, err = experiment.FromEnv(); err != nil {
+		logging.Fatal("failed to load search experiment", "error", err)
+	}
+	if searchExperiment != nil {
+		slog.Info("search experiment running", "experiment", searchExperiment.Name, "variants", len(searchExperiment.Variants))
+	}
+	if client := llm.Default(); client != nil {
+		if vectors := search.WeaviateFromEnv(func(ctx context.Context, text string) ([]float32, error) {
+			v, err := client.Embed(ctx, "search", []string{text})
+			if err != nil {
+				return nil, err
+			}
+			return v[0], nil
+		}); vectors != nil {
+			searchVectors = vectors
+			slog.Info("vector search enabled", "url", vectors.URL, "class", vectors.Class)
+		}
+	}
+
+	// Keep learning_progress derived from actual activity
+	go runProgressEngine(envDuration("PROGRESS_INTERVAL", time.Hour))
+	go runDashboardRefresher(envDuration("DASHBOARD_REFRESH_INTERVAL", 10*time.Minute))
+	// Refresh the stats soon after new content too when there is a bus
+	contentChanged := make(chan struct{}, 1)
+	if bus := events.Default("mcp-server"); bus != events.Discard {
+		go watchContentEvents(context.Background(), bus, contentChanged)
+		if db, err := getDBConnection(); err == nil {
+			go watchEmbeddings(context.Background(), bus, db)
+		}
+		slog.Info("event bus enabled", "bus", os.Getenv("EVENT_BUS"))
+	}
+	go runStatsSnapshots(envDuration("STATS_SNAPSHOT_INTERVAL", 15*time.Minute), contentChanged)
+	go runReindexer()
 
 	// Setup HTTP routes for MCP
 	http.HandleFunc("/mcp/tools", toolsHandler)
 	http.HandleFunc("/mcp/call", callHandler)
+	http.HandleFunc("/mcp/call/batch", batchHandler)
+	http.HandleFunc("/mcp/rpc", rpcHandler)
+	http.HandleFunc("/tools/openai", openAIToolsHandler)
+	http.HandleFunc("/tools/openai/call", openAICallHandler)
+	http.HandleFunc("/content", withContentETag(contentVersion, contentHandler))
+	http.HandleFunc("/content/", withContentETag(contentVersion, contentHandler))
+	http.HandleFunc("/content/interactions", interactionsHandler)
+	http.HandleFunc("/feedback", feedbackHandler)
+	http.HandleFunc("/tags", withContentETag(contentVersion, tagsHandler))
+	http.HandleFunc("/queries", queriesHandler)
+	http.HandleFunc("/usage", usageHandler)
+	http.HandleFunc("/usage/allow", usageAllowHandler)
+	http.HandleFunc("/reviews", reviewsHandler)
+	http.HandleFunc("/preferences", preferencesHandler)
+	http.HandleFunc("/recommendations", recommendationsHandler)
+	http.HandleFunc("/goals", goalsHandler)
+	http.HandleFunc("/goals/", goalsHandler)
+	http.HandleFunc("/collections", collectionsHandler)
+	http.HandleFunc("/collections/", collectionsHandler)
+	http.HandleFunc("/shared/collections/", sharedCollectionHandler)
+	http.HandleFunc("/dashboard/", withContentETag(contentVersion, dashboardHandler))
+	http.HandleFunc("/admin/stats", statsHandler)
+	http.HandleFunc("/admin/stats/snapshot", statsSnapshotHandler)
+	http.HandleFunc("/admin/tags/", tagAdminHandler)
+	http.HandleFunc("/admin/reindex", reindexHandler)
+	http.HandleFunc("/admin/reindex/", reindexHandler)
+	http.HandleFunc("/admin/experiments", experimentsHandler)
+	http.HandleFunc("/admin/feedback/apply", feedbackApplyHandler)
+	http.HandleFunc("/admin/users/", userDataHandler)
 	http.HandleFunc("/health", healthHandler)
 	http.HandleFunc("/ready", readyHandler)
+	http.Handle("/metrics", promhttp.Handler())
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8084"
 	}
 
-	log.Printf("🔗 MCP Server starting on port %s", port)
-	log.Printf("📡 MCP Endpoints:")
-	log.Printf("  • Tools list: GET http://localhost:%s/mcp/tools", port)
-	log.Printf("  • Tool calls: POST http://localhost:%s/mcp/call", port)
-	log.Printf("  • Health: GET http://localhost:%s/health", port)
+	slog.Info("mcp server starting", "port", port)
 
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	tlsConfig := tlsserve.FromEnv()
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: logging.Middleware(tlsConfig.HSTS(http.DefaultServeMux)),
+	}
+	if err := tlsserve.ListenAndServe(server, tlsConfig); err != nil {
+		logging.Fatal("server failed to start", "error", err)
+	}
 }
 
 func toolsHandler(w http.ResponseWriter, r *http.Request) {
@@ -77,9 +187,19 @@ func toolsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tools := []MCPTool{
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tools": tools.list(),
+	})
+}
+
+// builtinTools defines every tool the server can offer. The tools file
+// picks which of them it does (see tools.go).
+func builtinTools() []MCPTool {
+	return []MCPTool{
 		{
 			Name:        "search_content",
+			Handler:     handleSearchContent,
 			Description: "Search Selin's knowledge base for content related to Go, blockchain, or cryptography",
 			InputSchema: map[string]interface{}{
 				"type": "object",
@@ -93,11 +213,52 @@ func toolsHandler(w http.ResponseWriter, r *http.Request) {
 						"description": "Maximum number of results to return (default: 10)",
 						"default":     10,
 					},
+					"offset": map[string]interface{}{
+						"type":        "number",
+						"description": "Number of results to skip, for paging (default: 0)",
+						"default":     0,
+					},
 					"platform": map[string]interface{}{
 						"type":        "string",
-						"description": "Filter by source platform (reddit, slack, file_upload)",
+						"description": "Filter by source platform (reddit, slack, file_upload; default: the default_platform preference)",
 						"enum":        []string{"reddit", "slack", "file_upload", "all"},
-						"default":     "all",
+					},
+					"visibility": map[string]interface{}{
+						"type":        "string",
+						"description": "Only public content (such as Reddit posts) or only private content (such as Slack messages); default: all",
+						"enum":        []string{"public", "private", "all"},
+					},
+					"format": map[string]interface{}{
+						"type":        "string",
+						"description": "How much to show of each result (default: the result_format preference)",
+						"enum":        []string{"concise", "balanced", "detailed"},
+					},
+					"freshness": map[string]interface{}{
+						"type":        "number",
+						"description": "Half-life in days: older results rank lower, halving every this many days (default: 60; 0 ranks without regard to age)",
+					},
+					"facets": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Also count all matches by platform, tag, content type and month, to narrow the search down",
+						"default":     false,
+					},
+					"collection": map[string]interface{}{
+						"type":        "string",
+						"description": "Only search the content in this collection (name or ID)",
+					},
+					"collapse_duplicates": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Show content collected from several places once, listing where else it was seen",
+						"default":     true,
+					},
+					"ranker": map[string]interface{}{
+						"type":        "string",
+						"description": "How to rank: classic (relevance weighted by the match) or hybrid (blending keyword rank, semantic similarity, recency and relevance)",
+						"enum":        []string{"classic", "hybrid"},
+					},
+					"weights": map[string]interface{}{
+						"type":        "string",
+						"description": "Hybrid ranker weights, such as keyword=0.6,vector=0.4 (signals: keyword, vector, recency, relevance)",
 					},
 				},
 				"required": []string{"query"},
@@ -105,6 +266,7 @@ func toolsHandler(w http.ResponseWriter, r *http.Request) {
 		},
 		{
 			Name:        "get_learning_progress",
+			Handler:     handleGetLearningProgress,
 			Description: "Get the user's learning progress for specific topics",
 			InputSchema: map[string]interface{}{
 				"type": "object",
@@ -119,6 +281,7 @@ func toolsHandler(w http.ResponseWriter, r *http.Request) {
 		},
 		{
 			Name:        "get_recent_content",
+			Handler:     handleGetRecentContent,
 			Description: "Get recently collected content from Selin's knowledge base",
 			InputSchema: map[string]interface{}{
 				"type": "object",
@@ -139,6 +302,7 @@ func toolsHandler(w http.ResponseWriter, r *http.Request) {
 		},
 		{
 			Name:        "analyze_content_trends",
+			Handler:     handleAnalyzeTrends,
 			Description: "Analyze trends in collected content and learning topics",
 			InputSchema: map[string]interface{}{
 				"type": "object",
@@ -155,12 +319,574 @@ func toolsHandler(w http.ResponseWriter, r *http.Request) {
 				},
 			},
 		},
+		{
+			Name:        "mark_as_read",
+			Handler:     handleMarkAsRead,
+			Description: "Record that the user has read a content item so it counts towards their learning progress",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"content_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of the content item, as shown in search results",
+					},
+					"rating": map[string]interface{}{
+						"type":        "number",
+						"description": "Optional usefulness rating from 1 to 5",
+					},
+					"notes": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional notes about the content",
+					},
+				},
+				"required": []string{"content_id"},
+			},
+		},
+		{
+			Name:        "rate_result",
+			Handler:     handleRateResult,
+			Description: "Record whether a search result was useful; ratings tune how results are ranked",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"content_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of the content item, as shown in search results",
+					},
+					"useful": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Whether the result was useful",
+					},
+					"query_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional query_id of the search that returned it",
+					},
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "Optional query the result was found for",
+					},
+				},
+				"required": []string{"content_id", "useful"},
+			},
+		},
+		{
+			Name:        "flag_for_review",
+			Handler:     handleFlagForReview,
+			Description: "Flag a content item for spaced-repetition review",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"content_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of the content item, as shown in search results",
+					},
+				},
+				"required": []string{"content_id"},
+			},
+		},
+		{
+			Name:        "get_due_reviews",
+			Handler:     handleGetDueReviews,
+			Description: "Get the content items that are due for review today",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of items to return (default: 10)",
+						"default":     10,
+					},
+				},
+			},
+		},
+		{
+			Name:        "record_review",
+			Handler:     handleRecordReview,
+			Description: "Record how well the user recalled a reviewed item, which schedules its next review",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"content_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of the reviewed content item",
+					},
+					"quality": map[string]interface{}{
+						"type":        "number",
+						"description": "Recall quality from 0 (forgot completely) to 5 (perfect recall)",
+					},
+				},
+				"required": []string{"content_id", "quality"},
+			},
+		},
+		{
+			Name:        "generate_quiz",
+			Handler:     handleGenerateQuiz,
+			Description: "Generate quiz questions about a topic from stored content",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"topic": map[string]interface{}{
+						"type":        "string",
+						"description": "Quiz topic (e.g., 'golang', 'cosmos')",
+					},
+					"count": map[string]interface{}{
+						"type":        "number",
+						"description": "Number of questions (default: 5, max: 20)",
+						"default":     5,
+					},
+				},
+				"required": []string{"topic"},
+			},
+		},
+		{
+			Name:        "submit_quiz_answers",
+			Handler:     handleSubmitQuizAnswers,
+			Description: "Grade the user's answers to a generated quiz and record the results",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"answers": map[string]interface{}{
+						"type":        "array",
+						"description": "Answers to quiz cards",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"card_id": map[string]interface{}{"type": "string"},
+								"answer":  map[string]interface{}{"type": "string"},
+							},
+							"required": []string{"card_id", "answer"},
+						},
+					},
+				},
+				"required": []string{"answers"},
+			},
+		},
+		{
+			Name:        "get_related_concepts",
+			Handler:     handleGetRelatedConcepts,
+			Description: "Get the concepts most often mentioned together with a tool, library, protocol or algorithm",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"concept": map[string]interface{}{
+						"type":        "string",
+						"description": "Concept name (e.g., 'tendermint', 'grpc', 'ed25519')",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of related concepts (default: 5, max: 10)",
+						"default":     5,
+					},
+				},
+				"required": []string{"concept"},
+			},
+		},
+		{
+			Name:        "get_graph_neighborhood",
+			Handler:     handleGetGraphNeighborhood,
+			Description: "Explore the knowledge graph around a concept, following co-occurrence links several hops out",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"concept": map[string]interface{}{
+						"type":        "string",
+						"description": "Starting concept",
+					},
+					"depth": map[string]interface{}{
+						"type":        "number",
+						"description": "Number of hops to follow (default: 2, max: 3)",
+						"default":     2,
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Links followed per concept (default: 5, max: 10)",
+						"default":     5,
+					},
+				},
+				"required": []string{"concept"},
+			},
+		},
+		{
+			Name:        "get_recommendations",
+			Handler:     handleGetRecommendations,
+			Description: "Recommend unread content to read next, based on the topics the user is learning",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Number of recommendations (default: 5)",
+						"default":     5,
+					},
+					"topic": map[string]interface{}{
+						"type":        "string",
+						"description": "Only recommend content tagged with this topic",
+					},
+				},
+			},
+		},
+		{
+			Name:        "set_learning_goal",
+			Handler:     handleSetLearningGoal,
+			Description: "Create a learning goal (e.g. 'pass CKA') with target topics and an optional deadline, or update one by goal_id",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"goal_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of an existing goal to update; omit to create a new goal",
+					},
+					"title": map[string]interface{}{
+						"type":        "string",
+						"description": "What the user wants to achieve",
+					},
+					"topics": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Topics the goal depends on (e.g., ['kubernetes', 'containerization'])",
+					},
+					"target_score": map[string]interface{}{
+						"type":        "number",
+						"description": "Progress score each topic should reach, 0-10 (default: 6)",
+					},
+					"deadline": map[string]interface{}{
+						"type":        "string",
+						"description": "Target date as YYYY-MM-DD; empty string clears it",
+					},
+					"status": map[string]interface{}{
+						"type": "string",
+						"enum": []string{"active", "completed", "archived"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "get_learning_goals",
+			Handler:     handleGetLearningGoals,
+			Description: "Get the user's learning goals with completion estimates",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"status": map[string]interface{}{
+						"type":    "string",
+						"enum":    []string{"active", "completed", "archived", "all"},
+						"default": "active",
+					},
+				},
+			},
+		},
+		{
+			Name:        "get_query_history",
+			Handler:     handleGetQueryHistory,
+			Description: "Get the user's recent searches and questions",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of queries to return (default: 20)",
+						"default":     20,
+					},
+					"tool": map[string]interface{}{
+						"type":        "string",
+						"description": "Only queries made through this tool or API (e.g. search_content, content_api, query)",
+					},
+				},
+			},
+		},
+		{
+			Name:        "content_gaps",
+			Handler:     handleContentGaps,
+			Description: "Find topics users searched for but no content was found, grouped by topic",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"days": map[string]interface{}{
+						"type":        "number",
+						"description": "How many days of searches to analyse (default: 30)",
+						"default":     30,
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of gaps to show (default: 10)",
+						"default":     10,
+					},
+					"suggest_keywords": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Save frequent gaps as collector keyword suggestions",
+						"default":     false,
+					},
+					"min_count": map[string]interface{}{
+						"type":        "number",
+						"description": "Searches a gap needs before it is suggested as a keyword (default: 3)",
+						"default":     3,
+					},
+				},
+			},
+		},
+		{
+			Name:        "get_content_revisions",
+			Handler:     handleGetContentRevisions,
+			Description: "Show how a content item changed over time, such as rescored relevance",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"content_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of the content item",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of revisions to return (default: 20)",
+						"default":     20,
+					},
+				},
+				"required": []string{"content_id"},
+			},
+		},
+		{
+			Name:        "get_thread",
+			Handler:     handleGetThread,
+			Description: "Reconstruct the full conversation (Slack thread, chat replies) that a content item belongs to",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"content_id": map[string]interface{}{
+						"type":        "string",
+						"description": "ID of any message in the conversation",
+					},
+				},
+				"required": []string{"content_id"},
+			},
+		},
+		{
+			Name:        "get_top_authors",
+			Handler:     handleGetTopAuthors,
+			Description: "List the best reputed authors for a topic, by the relevance of their content and how often it was rated useful",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"topic": map[string]interface{}{
+						"type":        "string",
+						"description": "Topic tag (e.g. golang); all content when omitted",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of authors to return (default: 10)",
+						"default":     10,
+					},
+				},
+			},
+		},
+		{
+			Name:        "get_engagement_trends",
+			Handler:     handleGetEngagementTrends,
+			Description: "Find collected Reddit posts whose score and comments are growing faster than before, early signals of important discussions",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"hours": map[string]interface{}{
+						"type":        "number",
+						"description": "Window to compare the first and second half of, in hours (default: 24, at most 336)",
+						"default":     24,
+					},
+					"topic": map[string]interface{}{
+						"type":        "string",
+						"description": "Topic tag (e.g. golang); all content when omitted",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "Maximum number of posts to return (default: 10)",
+						"default":     10,
+					},
+				},
+			},
+		},
+		{
+			Name:        "rename_tag",
+			Handler:     tagChangeHandler("rename_tag"),
+			Description: "Rename a tag on all content (admin)",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"from": map[string]interface{}{
+						"type":        "string",
+						"description": "Tag to rename",
+					},
+					"to": map[string]interface{}{
+						"type":        "string",
+						"description": "New tag name",
+					},
+					"add_alias": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Also tag new content collected with the old tag with the new one",
+						"default":     false,
+					},
+				},
+				"required": []string{"from", "to"},
+			},
+		},
+		{
+			Name:        "merge_tags",
+			Handler:     tagChangeHandler("merge_tags"),
+			Description: "Merge several tags into one on all content (admin)",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tags": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Tags to merge",
+					},
+					"into": map[string]interface{}{
+						"type":        "string",
+						"description": "Tag they are merged into",
+					},
+					"add_alias": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Also tag new content collected with the merged tags with the new one",
+						"default":     false,
+					},
+				},
+				"required": []string{"tags", "into"},
+			},
+		},
+		{
+			Name:        "delete_tag",
+			Handler:     tagChangeHandler("delete_tag"),
+			Description: "Remove a tag from all content (admin)",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"tag": map[string]interface{}{
+						"type":        "string",
+						"description": "Tag to remove",
+					},
+				},
+				"required": []string{"tag"},
+			},
+		},
+		{
+			Name:        "set_tag_alias",
+			Handler:     handleSetTagAlias,
+			Description: "Tag new content with one tag whenever a collector produces another, e.g. k8s → kubernetes (admin)",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"alias": map[string]interface{}{
+						"type":        "string",
+						"description": "Tag to replace",
+					},
+					"tag": map[string]interface{}{
+						"type":        "string",
+						"description": "Tag to use instead",
+					},
+				},
+				"required": []string{"alias", "tag"},
+			},
+		},
+		{
+			Name:        "create_collection",
+			Handler:     handleCreateCollection,
+			Description: "Create a named collection for curating content by hand, such as 'IBC deep dive'",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":        "string",
+						"description": "Name of the collection, unique per user",
+					},
+					"description": map[string]interface{}{
+						"type":        "string",
+						"description": "What the collection is for",
+					},
+				},
+				"required": []string{"name"},
+			},
+		},
+		{
+			Name:        "add_to_collection",
+			Handler:     handleAddToCollection,
+			Description: "Add content items, by the IDs search results show, to a collection",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"collection": map[string]interface{}{
+						"type":        "string",
+						"description": "Name or ID of the collection",
+					},
+					"content_ids": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "IDs of the content items to add",
+					},
+					"note": map[string]interface{}{
+						"type":        "string",
+						"description": "Why these items belong in the collection",
+					},
+				},
+				"required": []string{"collection", "content_ids"},
+			},
+		},
+		{
+			Name:        "get_collection",
+			Handler:     handleGetCollection,
+			Description: "Get the content in a collection, or export it as a Markdown reading list; omit collection to list all collections",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"collection": map[string]interface{}{
+						"type":        "string",
+						"description": "Name or ID of the collection",
+					},
+					"format": map[string]interface{}{
+						"type":    "string",
+						"enum":    []string{"summary", "markdown"},
+						"default": "summary",
+					},
+				},
+			},
+		},
+		{
+			Name:        "get_preferences",
+			Handler:     handleGetPreferences,
+			Description: "Get the user's settings: followed tags, digest schedule and search defaults",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "set_preferences",
+			Handler:     handleSetPreferences,
+			Description: "Change the user's settings; settings left out keep their current value",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"subscribed_tags": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Tags to be notified about (an empty list follows all tags)",
+					},
+					"digest_schedule": map[string]interface{}{
+						"type":        "string",
+						"description": "How often email digests are sent",
+						"enum":        []string{"daily", "weekly", "off"},
+					},
+					"default_platform": map[string]interface{}{
+						"type":        "string",
+						"description": "Platform searches are limited to when they name none",
+						"enum":        []string{"reddit", "slack", "file_upload", "all"},
+					},
+					"result_format": map[string]interface{}{
+						"type":        "string",
+						"description": "How much search results show by default",
+						"enum":        []string{"concise", "balanced", "detailed"},
+					},
+				},
+			},
+		},
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"tools": tools,
-	})
 }
 
 func callHandler(w http.ResponseWriter, r *http.Request) {
@@ -175,31 +901,46 @@ func callHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("🔧 MCP Tool call: %s with args: %v", req.Name, req.Arguments)
+	if !authorizeTool(w, r, req.Name) {
+		return
+	}
 
-	var response MCPResponse
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(callTool(r, req.Name, req.Arguments))
+}
 
-	switch req.Name {
-	case "search_content":
-		response = handleSearchContent(req.Arguments)
-	case "get_learning_progress":
-		response = handleGetLearningProgress(req.Arguments)
-	case "get_recent_content":
-		response = handleGetRecentContent(req.Arguments)
-	case "analyze_content_trends":
-		response = handleAnalyzeTrends(req.Arguments)
-	default:
-		response = MCPResponse{
+// callTool runs a tool the caller is authorized for, in the caller's
+// workspace, and cuts its result to the call's budget.
+func callTool(r *http.Request, name string, args map[string]interface{}) MCPResponse {
+	// Tools only ever see the caller's workspace, whatever the arguments say
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	args[workspaceArgName] = requestWorkspace(r)
+	args[userArgName] = requestUser(r)
+
+	logging.FromContext(r.Context()).Info("tool call", "tool", name, "args", args)
+	args[contextArgName] = r.Context()
+
+	budget, err := budgetArg(args)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	tool, ok := tools.lookup(name)
+	if !ok {
+		return MCPResponse{
 			Content: []MCPContent{{
 				Type: "text",
-				Text: fmt.Sprintf("Unknown tool: %s", req.Name),
+				Text: fmt.Sprintf("Unknown tool: %s", name),
 			}},
 			IsError: true,
 		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if limited, ok := limitTool(r, tool); ok {
+		return limited
+	}
+	return applyBudget(tool.Handler(args), budget, tool.paged())
 }
 
 func handleSearchContent(args map[string]interface{}) MCPResponse {
@@ -208,80 +949,132 @@ func handleSearchContent(args map[string]interface{}) MCPResponse {
 		return errorResponse("Query parameter is required")
 	}
 
-	limit := 10
+	req := search.SearchRequest{
+		Workspace: workspaceArg(args),
+		Query:     query,
+		Limit:     10,
+	}
 	if l, ok := args["limit"].(float64); ok {
-		limit = int(l)
+		req.Limit = int(l)
 	}
-
-	platform := "all"
-	if p, ok := args["platform"].(string); ok {
-		platform = p
+	if o, ok := args["offset"].(float64); ok {
+		req.Offset = int(o)
+	}
+	format, _ := args["format"].(string)
+	switch format {
+	case "", preferences.FormatConcise, preferences.FormatBalanced, preferences.FormatDetailed:
+	default:
+		return errorResponse("format must be concise, balanced or detailed")
+	}
+	freshness := defaultFreshness()
+	if f, ok := args["freshness"].(float64); ok {
+		if f < 0 {
+			return errorResponse("freshness must be a non-negative number of days")
+		}
+		freshness = f
+	}
+	req.HalfLife = halfLife(freshness)
+	req.Facets, _ = args["facets"].(bool)
+	ranker, _ := args["ranker"].(string)
+	weights, _ := args["weights"].(string)
+	hybrid, err := searchRanking(ranker, weights)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+	req.Hybrid, req.Vectors, req.Staleness = hybrid, searchVectors, searchStaleness
+	req.Collapse = true
+	if c, ok := args["collapse_duplicates"].(bool); ok {
+		req.Collapse = c
+	}
+	if ref, ok := args["collection"].(string); ok && ref != "" {
+		ids, name, err := collectionArg(req.Workspace, ref)
+		if err != nil {
+			return errorResponse(err.Error())
+		}
+		if len(ids) == 0 {
+			return MCPResponse{Content: []MCPContent{{Type: "text", Text: fmt.Sprintf("📚 %s is empty. Add content to it with add_to_collection.", name)}}}
+		}
+		req.IDs = ids
 	}
 
-	db, err := getDBConnection()
+	store, err := openStore()
 	if err != nil {
 		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
 	}
-	defer db.Close()
-
-	// Build SQL query
-	sql := `
-		SELECT id, source_url, author, timestamp, tags, content_type, 
-		       source_platform, content_summary, relevance_score
-		FROM content_metadata 
-		WHERE (content_summary ILIKE $1 OR array_to_string(tags, ',') ILIKE $1)`
+	defer store.Close()
 
-	args_sql := []interface{}{"%" + query + "%"}
-
-	if platform != "all" {
-		sql += " AND source_platform = $2"
-		args_sql = append(args_sql, platform)
+	defaults := searchDefaults(store, workspaceArg(args), userArg(args))
+	req.Platform = defaults.DefaultPlatform
+	if p, ok := args["platform"].(string); ok && p != "" {
+		req.Platform = p
+	}
+	req.Visibility, _ = args["visibility"].(string)
+	if !search.ValidVisibility(req.Visibility) {
+		return errorResponse("visibility must be public, private or all")
+	}
+	if format == "" {
+		format = defaults.ResultFormat
 	}
 
-	sql += " ORDER BY relevance_score DESC, created_at DESC LIMIT $" + strconv.Itoa(len(args_sql)+1)
-	args_sql = append(args_sql, limit)
-
-	rows, err := db.Query(sql, args_sql...)
+	start := time.Now()
+	found, err := store.Search(contextArg(args), req)
 	if err != nil {
 		return errorResponse(fmt.Sprintf("Query failed: %v", err))
 	}
-	defer rows.Close()
-
-	var results []ContentResult
-	for rows.Next() {
-		var result ContentResult
-		var tagsStr string
-
-		err := rows.Scan(&result.ID, &result.SourceURL, &result.Author,
-			&result.Timestamp, &tagsStr, &result.ContentType,
-			&result.SourcePlatform, &result.ContentSummary, &result.RelevanceScore)
-		if err != nil {
-			continue
-		}
-
-		// Parse tags array
-		tagsStr = strings.Trim(tagsStr, "{}")
-		if tagsStr != "" {
-			result.Tags = strings.Split(tagsStr, ",")
-		}
-
-		results = append(results, result)
+	if db, ok := storage.PostgresDB(store); ok {
+		logQuery(db, QueryRecord{
+			WorkspaceID: req.Workspace,
+			Query:       query,
+			Tool:        "search_content",
+			ResultCount: &found.Total,
+			DurationMS:  int(time.Since(start).Milliseconds()),
+		})
 	}
 
 	// Format response
 	var responseText strings.Builder
-	responseText.WriteString(fmt.Sprintf("🔍 Found %d results for '%s'\n\n", len(results), query))
+	responseText.WriteString(fmt.Sprintf("🔍 Found %d results for '%s'\n\n", found.Total, query))
+	if found.Facets != nil {
+		writeFacets(&responseText, found.Facets)
+	}
 
-	for i, result := range results {
-		responseText.WriteString(fmt.Sprintf("**%d. %s** (Score: %.2f)\n", i+1, 
-			strings.Split(result.ContentSummary, " ")[0], result.RelevanceScore))
+	for i, result := range found.Items {
+		responseText.WriteString(fmt.Sprintf("**%d. %s** (Score: %.2f)\n", found.Offset+i+1, 
+			strings.Split(result.ContentSummary, " ")[0], result.Score))
+		if rule := result.PossiblyOutdated; rule != nil {
+			responseText.WriteString(fmt.Sprintf("   ⚠️ Possibly outdated: %s content older than %d months\n", rule.Tag, rule.MaxAgeMonths))
+		}
+		if format == preferences.FormatConcise {
+			responseText.WriteString(fmt.Sprintf("   • ID: %s\n   • URL: %s\n\n", result.ID, result.SourceURL))
+			continue
+		}
+		responseText.WriteString(fmt.Sprintf("   • ID: %s\n", result.ID))
 		responseText.WriteString(fmt.Sprintf("   • Author: %s\n", result.Author))
 		responseText.WriteString(fmt.Sprintf("   • Platform: %s\n", result.SourcePlatform))
+		if len(result.AlsoSeenOn) > 0 {
+			responseText.WriteString(fmt.Sprintf("   • Also seen on: %s\n", alsoSeenOn(result.AlsoSeenOn)))
+		}
 		responseText.WriteString(fmt.Sprintf("   • Tags: %s\n", strings.Join(result.Tags, ", ")))
+		if format == preferences.FormatDetailed {
+			responseText.WriteString(fmt.Sprintf("   • Type: %s\n", result.ContentType))
+			responseText.WriteString(fmt.Sprintf("   • Relevance: %.2f\n", result.RelevanceScore))
+			if result.TokenCount > 0 {
+				responseText.WriteString(fmt.Sprintf("   • Tokens: %d\n", result.TokenCount))
+			}
+		}
 		responseText.WriteString(fmt.Sprintf("   • Summary: %s\n", result.ContentSummary))
 		responseText.WriteString(fmt.Sprintf("   • URL: %s\n", result.SourceURL))
+		for _, a := range result.Attachments {
+			responseText.WriteString(fmt.Sprintf("   • Attachment: %s (%s)\n", a.Filename, a.MimeType))
+			if a.ExtractedText != "" {
+				responseText.WriteString(fmt.Sprintf("     Text: %s\n", a.ExtractedText))
+			}
+		}
 		responseText.WriteString(fmt.Sprintf("   • Date: %s\n\n", result.Timestamp.Format("2006-01-02 15:04")))
 	}
+	if found.NextOffset != nil {
+		responseText.WriteString(fmt.Sprintf("More results available: call again with offset %d\n", *found.NextOffset))
+	}
 
 	return MCPResponse{
 		Content: []MCPContent{{
@@ -297,26 +1090,16 @@ func handleGetLearningProgress(args map[string]interface{}) MCPResponse {
 		return errorResponse("Topic parameter is required")
 	}
 
-	db, err := getDBConnection()
+	store, err := openStore()
 	if err != nil {
 		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
 	}
-	defer db.Close()
+	defer store.Close()
 
 	// Get learning progress
-	var skillLevel string
-	var progressScore float64
-	var totalContent, totalQueries int
-	var lastUpdated time.Time
-
-	err = db.QueryRow(`
-		SELECT skill_level, progress_score, total_content_consumed, 
-		       total_queries, last_updated
-		FROM learning_progress 
-		WHERE topic = $1`, topic).Scan(&skillLevel, &progressScore, &totalContent, &totalQueries, &lastUpdated)
-
+	progress, err := store.Progress(contextArg(args), workspaceArg(args), topic)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == storage.ErrNotFound {
 			return MCPResponse{
 				Content: []MCPContent{{
 					Type: "text",
@@ -327,16 +1110,30 @@ func handleGetLearningProgress(args map[string]interface{}) MCPResponse {
 		return errorResponse(fmt.Sprintf("Query failed: %v", err))
 	}
 
+	// Compare with the score recorded a week ago, if there is one
+	trend := "not enough history yet"
+	if db, ok := storage.PostgresDB(store); ok {
+		var weekAgoScore float64
+		err = db.QueryRow(`
+			SELECT progress_score FROM learning_progress_history
+			WHERE workspace_id = $1 AND topic = $2 AND recorded_at <= NOW() - INTERVAL '7 days'
+			ORDER BY recorded_at DESC LIMIT 1`, workspaceArg(args), topic).Scan(&weekAgoScore)
+		if err == nil {
+			trend = fmt.Sprintf("%+.1f over the last 7 days", progress.Score-weekAgoScore)
+		}
+	}
+
 	responseText := fmt.Sprintf(`📊 **Learning Progress for %s**
 
 • **Skill Level**: %s
 • **Progress Score**: %.1f/10.0
+• **Trend**: %s
 • **Content Consumed**: %d items
 • **Queries Made**: %d
 • **Last Updated**: %s
 
 💡 Keep exploring content and asking questions to improve your progress!`,
-		strings.Title(topic), skillLevel, progressScore, totalContent, totalQueries, lastUpdated.Format("2006-01-02 15:04"))
+		strings.Title(topic), progress.SkillLevel, progress.Score, trend, progress.ContentConsumed, progress.Queries, progress.LastUpdated.Format("2006-01-02 15:04"))
 
 	return MCPResponse{
 		Content: []MCPContent{{
@@ -367,15 +1164,18 @@ func handleGetRecentContent(args map[string]interface{}) MCPResponse {
 		SELECT source_platform, content_type, author, content_summary, 
 		       relevance_score, created_at
 		FROM content_metadata 
-		WHERE created_at >= NOW() - INTERVAL '%d hours'`
+		WHERE workspace_id = $1 AND created_at >= NOW() - make_interval(hours => $2)`
+
+	args_sql := []interface{}{workspaceArg(args), int(hours)}
 
 	if platform != "all" {
-		sql += " AND source_platform = '" + platform + "'"
+		sql += " AND source_platform = $3"
+		args_sql = append(args_sql, platform)
 	}
 
 	sql += " ORDER BY created_at DESC LIMIT 20"
 
-	rows, err := db.Query(fmt.Sprintf(sql, int(hours)))
+	rows, err := db.Query(sql, args_sql...)
 	if err != nil {
 		return errorResponse(fmt.Sprintf("Query failed: %v", err))
 	}
@@ -414,10 +1214,13 @@ func handleGetRecentContent(args map[string]interface{}) MCPResponse {
 }
 
 func handleAnalyzeTrends(args map[string]interface{}) MCPResponse {
-	days := 7.0
-	if d, ok := args["days"].(float64); ok {
-		days = d
+	days := 7
+	if d, ok := args["days"].(float64); ok && d > 0 && d <= 365 {
+		days = int(d)
 	}
+	topic, _ := args["topic"].(string)
+	topic = strings.ToLower(strings.TrimSpace(topic))
+	workspace := workspaceArg(args)
 
 	db, err := getDBConnection()
 	if err != nil {
@@ -425,33 +1228,39 @@ func handleAnalyzeTrends(args map[string]interface{}) MCPResponse {
 	}
 	defer db.Close()
 
-	// Get content trends
-	rows, err := db.Query(`
-		SELECT source_platform, COUNT(*) as count, AVG(relevance_score) as avg_score
-		FROM content_metadata 
-		WHERE created_at >= NOW() - INTERVAL '%d days'
-		GROUP BY source_platform
-		ORDER BY count DESC`, int(days))
-
+	// Read from the daily snapshots rather than scanning content
+	platforms, err := platformTrends(db, workspace, days)
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Trends query failed: %v", err))
+	}
+	tags, err := tagTrends(db, workspace, days, 10)
 	if err != nil {
 		return errorResponse(fmt.Sprintf("Trends query failed: %v", err))
 	}
-	defer rows.Close()
 
 	var responseText strings.Builder
-	responseText.WriteString(fmt.Sprintf("📈 **Content Trends (Last %.0f days)**\n\n", days))
+	responseText.WriteString(fmt.Sprintf("📈 **Content Trends (Last %d days)**\n\n", days))
 
-	for rows.Next() {
-		var platform string
-		var count int
-		var avgScore float64
+	for _, p := range platforms {
+		responseText.WriteString(fmt.Sprintf("• **%s**: %d items (Avg Score: %.2f)\n", strings.Title(p.Platform), p.Items, p.AvgRelevance))
+	}
 
-		err := rows.Scan(&platform, &count, &avgScore)
-		if err != nil {
-			continue
+	if len(tags) > 0 {
+		responseText.WriteString(fmt.Sprintf("\n🏷️ **Top Tags** (vs the %d days before)\n", days))
+		for _, t := range tags {
+			responseText.WriteString(fmt.Sprintf("• %s: %d items (%s)\n", t.Tag, t.Items, trendChange(t.Items, t.Previous)))
 		}
+	}
 
-		responseText.WriteString(fmt.Sprintf("• **%s**: %d items (Avg Score: %.2f)\n", strings.Title(platform), count, avgScore))
+	if topic != "" {
+		series, err := tagSeries(db, workspace, topic, days)
+		if err != nil {
+			return errorResponse(fmt.Sprintf("Trends query failed: %v", err))
+		}
+		responseText.WriteString(fmt.Sprintf("\n📅 **%s per day**\n", strings.Title(topic)))
+		for _, p := range series {
+			responseText.WriteString(fmt.Sprintf("• %s: %d items\n", p.Day, p.Items))
+		}
 	}
 
 	return MCPResponse{
@@ -463,33 +1272,26 @@ func handleAnalyzeTrends(args map[string]interface{}) MCPResponse {
 }
 
 func getDBConnection() (*sql.DB, error) {
-	dbHost := os.Getenv("POSTGRES_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
-	}
-	dbPort := os.Getenv("POSTGRES_PORT")
-	if dbPort == "" {
-		dbPort = "5433"
-	}
-	dbUser := os.Getenv("POSTGRES_USER")
-	if dbUser == "" {
-		dbUser = "postgres"
-	}
-	dbPassword := os.Getenv("POSTGRES_PASSWORD")
-	if dbPassword == "" {
-		dbPassword = "changmeplease"
-	}
-	dbName := os.Getenv("POSTGRES_DB")
-	if dbName == "" {
-		dbName = "selin"
-	}
-
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+	connStr := config.PostgresDSN("mcp-server")
 
 	return sql.Open("postgres", connStr)
 }
 
+// openStore opens the storage selected by STORAGE_DRIVER. Only content,
+// search and learning progress go through it; everything else needs the
+// Postgres database from getDBConnection.
+func openStore() (storage.Store, error) {
+	return storage.Open("mcp-server")
+}
+
+// envDuration reads a Go duration (e.g. "1h") from the environment.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
 func errorResponse(message string) MCPResponse {
 	return MCPResponse{
 		Content: []MCPContent{{
@@ -501,7 +1303,7 @@ func errorResponse(message string) MCPResponse {
 }
 
 func respondWithError(w http.ResponseWriter, message string) {
-	log.Printf("❌ MCP Error: %s", message)
+	slog.Warn("mcp error", "message", message)
 	response := errorResponse(message)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusBadRequest)
@@ -515,28 +1317,20 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		"timestamp": time.Now(),
 		"service":   "selin-mcp-server",
 		"version":   "1.0.0",
-		"tools":     []string{"search_content", "get_learning_progress", "get_recent_content", "analyze_content_trends"},
+		"tools":     tools.names(),
+		"flags": flags.Default().Rules(),
 	})
 }
 
-func readyHandler(w http.ResponseWriter, r *http.Request) {
-	// Test database connection
-	db, err := getDBConnection()
-	if err != nil {
-		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
-		return
+// readiness checks the database every tool reads from.
+var readiness = func() *healthcheck.Checker {
+	checks := healthcheck.New("mcp-server")
+	if storage.Driver() == "postgres" {
+		checks.Register(healthcheck.Check{Name: "postgres", Probe: healthcheck.SQL(getDBConnection)})
 	}
-	defer db.Close()
+	return checks
+}()
 
-	if err := db.Ping(); err != nil {
-		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":    "READY",
-		"timestamp": time.Now(),
-		"database":  "connected",
-	})
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	readiness.ServeHTTP(w, r)
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The MCP tools are also served in OpenAI's function-calling shape, so
+// agents built on it can use Selin without translating: /tools/openai
+// lists the functions and /tools/openai/call runs the tool calls a model
+// asked for, answering with the tool messages to send back.
+
+// openAIFunction is a tool as OpenAI's chat completions API declares it.
+type openAIFunction struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	} `json:"function"`
+}
+
+// openAIToolCall is one entry of an assistant message's tool_calls.
+// Arguments is the JSON object as a string, the way the model writes it.
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAIToolMessage is the result of a tool call, ready to append to the
+// conversation.
+type openAIToolMessage struct {
+	Role       string `json:"role"`
+	ToolCallID string `json:"tool_call_id"`
+	Content    string `json:"content"`
+}
+
+// openAITools translates the MCP tools into OpenAI functions. Input
+// schemas are JSON Schema objects already, so they carry over as is.
+func openAITools(defs []MCPTool) []openAIFunction {
+	functions := make([]openAIFunction, len(defs))
+	for i, tool := range defs {
+		functions[i].Type = "function"
+		functions[i].Function.Name = tool.Name
+		functions[i].Function.Description = tool.Description
+		functions[i].Function.Parameters = tool.InputSchema
+	}
+	return functions
+}
+
+// openAIToolsHandler serves GET /tools/openai.
+func openAIToolsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tools": openAITools(tools.list()),
+	})
+}
+
+// openAICallHandler serves POST /tools/openai/call. It takes one tool call,
+// answered with one tool message, or an assistant message's
+// {"tool_calls": [...]}, answered with {"messages": [...]} in the same
+// order. Failed calls are answered with the error as the content, which is
+// how a model learns it should try something else.
+func openAICallHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		openAIToolCall
+		ToolCalls []openAIToolCall `json:"tool_calls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(body.ToolCalls) > 0 {
+		messages := make([]openAIToolMessage, len(body.ToolCalls))
+		for i, call := range body.ToolCalls {
+			messages[i] = runOpenAICall(r, call)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages})
+		return
+	}
+	if body.Function.Name == "" {
+		http.Error(w, "function.name or tool_calls is required", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(runOpenAICall(r, body.openAIToolCall))
+}
+
+func runOpenAICall(r *http.Request, call openAIToolCall) openAIToolMessage {
+	response := openAICallResponse(r, call)
+	texts := make([]string, len(response.Content))
+	for i, content := range response.Content {
+		texts[i] = content.Text
+	}
+	return openAIToolMessage{Role: "tool", ToolCallID: call.ID, Content: strings.Join(texts, "\n")}
+}
+
+func openAICallResponse(r *http.Request, call openAIToolCall) MCPResponse {
+	if denied, ok := toolDenied(r, call.Function.Name); ok {
+		return denied
+	}
+	args := map[string]interface{}{}
+	if strings.TrimSpace(call.Function.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return errorResponse(fmt.Sprintf("arguments must be a JSON object: %v", err))
+		}
+	}
+	return callTool(r, call.Function.Name, args)
+}
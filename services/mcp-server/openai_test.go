@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"selin/internal/rbac"
+)
+
+func TestOpenAITools(t *testing.T) {
+	w := httptest.NewRecorder()
+	openAIToolsHandler(w, httptest.NewRequest("GET", "/tools/openai", nil))
+
+	var body struct {
+		Tools []openAIFunction `json:"tools"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Tools) != len(tools.list()) {
+		t.Fatalf("Expected every tool, got %d", len(body.Tools))
+	}
+	search := body.Tools[0]
+	if search.Type != "function" || search.Function.Name != "search_content" || search.Function.Parameters["type"] != "object" {
+		t.Errorf("Unexpected function: %+v", search)
+	}
+	props := search.Function.Parameters["properties"].(map[string]interface{})
+	if props["query"] == nil || props["max_tokens"] == nil {
+		t.Errorf("Expected the tool's and the budget's parameters, got %v", props)
+	}
+}
+
+func TestOpenAICall(t *testing.T) {
+	w := httptest.NewRecorder()
+	openAICallHandler(w, httptest.NewRequest("POST", "/tools/openai/call",
+		strings.NewReader(`{"id": "call_1", "type": "function", "function": {"name": "search_content", "arguments": "{}"}}`)))
+
+	var msg openAIToolMessage
+	if err := json.NewDecoder(w.Body).Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Role != "tool" || msg.ToolCallID != "call_1" || !strings.Contains(msg.Content, "Query parameter is required") {
+		t.Errorf("Unexpected tool message: %+v", msg)
+	}
+}
+
+func TestOpenAICallBatchKeepsOrder(t *testing.T) {
+	r := httptest.NewRequest("POST", "/tools/openai/call", strings.NewReader(`{"tool_calls": [
+		{"id": "a", "function": {"name": "no_such_tool"}},
+		{"id": "b", "function": {"name": "search_content", "arguments": "not json"}},
+		{"id": "c", "function": {"name": "set_learning_goal", "arguments": "{}"}}
+	]}`))
+	r.Header.Set(rbac.Header, "reader")
+	w := httptest.NewRecorder()
+	openAICallHandler(w, r)
+
+	var body struct {
+		Messages []openAIToolMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ id, content string }{
+		{"a", "Unknown tool: no_such_tool"},
+		{"b", "arguments must be a JSON object"},
+		{"c", "requires the editor role"},
+	}
+	if len(body.Messages) != len(want) {
+		t.Fatalf("Expected %d messages, got %+v", len(want), body.Messages)
+	}
+	for i, tt := range want {
+		if body.Messages[i].ToolCallID != tt.id || !strings.Contains(body.Messages[i].Content, tt.content) {
+			t.Errorf("Message %d: expected %s with %q, got %+v", i, tt.id, tt.content, body.Messages[i])
+		}
+	}
+}
+
+func TestOpenAICallRejectsBadRequests(t *testing.T) {
+	for _, body := range []string{`nonsense`, `{}`} {
+		w := httptest.NewRecorder()
+		openAICallHandler(w, httptest.NewRequest("POST", "/tools/openai/call", strings.NewReader(body)))
+		if w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
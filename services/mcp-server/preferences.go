@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"selin/internal/logging"
+	"selin/internal/preferences"
+	"selin/internal/storage"
+)
+
+// preferencesHandler serves the caller's settings in their workspace. The
+// user is the one the gateway vouches for, the default user without one:
+//
+//	GET /preferences   the settings, defaults for those never set
+//	PUT /preferences   change the settings given, keeping the rest
+func preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	workspace, userID := requestWorkspace(r), requestUser(r)
+	if userID == "" {
+		userID = defaultUserID
+	}
+
+	var update preferences.Preferences
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := update.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	var p preferences.Preferences
+	if r.Method == http.MethodPut {
+		p, err = preferences.Update(r.Context(), db, workspace, userID, update)
+	} else {
+		p, err = preferences.Load(r.Context(), db, workspace, userID)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to access preferences", "workspace_id", workspace, "user_id", userID, "error", err)
+		http.Error(w, "Failed to access preferences", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// preferencesFromArgs reads a set_preferences call as an update.
+func preferencesFromArgs(args map[string]interface{}) preferences.Preferences {
+	var update preferences.Preferences
+	if _, ok := args["subscribed_tags"].([]interface{}); ok {
+		update.SubscribedTags = stringList(args["subscribed_tags"])
+		if update.SubscribedTags == nil {
+			update.SubscribedTags = []string{}
+		}
+	}
+	update.DigestSchedule, _ = args["digest_schedule"].(string)
+	update.DefaultPlatform, _ = args["default_platform"].(string)
+	update.ResultFormat, _ = args["result_format"].(string)
+	return update
+}
+
+func formatPreferences(title string, p preferences.Preferences) string {
+	tags := "all tags"
+	if len(p.SubscribedTags) > 0 {
+		tags = strings.Join(p.SubscribedTags, ", ")
+	}
+	return fmt.Sprintf(`⚙️ **%s**
+
+• **Subscribed tags**: %s
+• **Digest schedule**: %s
+• **Default platform**: %s
+• **Result format**: %s`, title, tags, p.DigestSchedule, p.DefaultPlatform, p.ResultFormat)
+}
+
+func handleGetPreferences(args map[string]interface{}) MCPResponse {
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	p, err := preferences.Load(contextArg(args), db, workspaceArg(args), userArg(args))
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Query failed: %v", err))
+	}
+	return MCPResponse{Content: []MCPContent{{Type: "text", Text: formatPreferences("Preferences", p)}}}
+}
+
+func handleSetPreferences(args map[string]interface{}) MCPResponse {
+	update := preferencesFromArgs(args)
+	if err := update.Validate(); err != nil {
+		return errorResponse(err.Error())
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	p, err := preferences.Update(contextArg(args), db, workspaceArg(args), userArg(args), update)
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Failed to save preferences: %v", err))
+	}
+	return MCPResponse{Content: []MCPContent{{Type: "text", Text: formatPreferences("Preferences saved", p)}}}
+}
+
+// searchDefaults returns the settings the user's searches in workspace
+// default to, the built-in ones when the store is not Postgres or they
+// cannot be read.
+func searchDefaults(store storage.Store, workspace, userID string) preferences.Preferences {
+	db, ok := storage.PostgresDB(store)
+	if !ok {
+		return preferences.Default()
+	}
+	p, err := preferences.Load(context.Background(), db, workspace, userID)
+	if err != nil {
+		slog.Warn("failed to load search preferences, using defaults", "error", err)
+		return preferences.Default()
+	}
+	return p
+}
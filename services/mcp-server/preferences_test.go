@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreferencesFromArgs(t *testing.T) {
+	update := preferencesFromArgs(map[string]interface{}{
+		"subscribed_tags": []interface{}{"golang", "cosmos"},
+		"result_format":   "concise",
+	})
+	if len(update.SubscribedTags) != 2 || update.ResultFormat != "concise" || update.DigestSchedule != "" {
+		t.Errorf("Expected only the given settings, got %+v", update)
+	}
+
+	// An empty list clears the tags, a missing one keeps them
+	if update := preferencesFromArgs(map[string]interface{}{"subscribed_tags": []interface{}{}}); update.SubscribedTags == nil {
+		t.Error("Expected an empty tag list to clear the tags")
+	}
+	if update := preferencesFromArgs(map[string]interface{}{}); update.SubscribedTags != nil {
+		t.Errorf("Expected the tags left alone, got %v", update.SubscribedTags)
+	}
+}
+
+func TestSetPreferencesRejectsInvalidSettings(t *testing.T) {
+	resp := handleSetPreferences(map[string]interface{}{"digest_schedule": "hourly"})
+	if !resp.IsError || !strings.Contains(resp.Content[0].Text, "digest_schedule") {
+		t.Errorf("Expected the schedule rejected, got %+v", resp)
+	}
+
+	rr := httptest.NewRecorder()
+	preferencesHandler(rr, httptest.NewRequest(http.MethodPut, "/preferences", strings.NewReader(`{"result_format": "verbose"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown result format, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	preferencesHandler(rr, httptest.NewRequest(http.MethodPost, "/preferences", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+)
+
+// Learning progress scoring model
+//
+// Progress for a topic is derived from three signals:
+//
+//	reads    reads, successful reviews and correct quiz answers about content
+//	         tagged with the topic
+//	queries  questions asked that mention the topic
+//	idle     days since the last read or query
+//
+// Reads and queries are weighted by e^(-age/30d), so activity fades over
+// about a month instead of counting forever. The weighted counts saturate so
+// that no single signal can max out the score on its own:
+//
+//	score = 6·(1 − e^(−reads/20)) + 3·(1 − e^(−queries/15)) + 1·0.5^(idle/14)
+//
+// The result is on the 0–10 scale shown by get_learning_progress, with
+// steady reading mattering most. Skill levels use fixed thresholds:
+//
+//	beginner < 3 ≤ intermediate < 6 ≤ advanced < 8.5 ≤ expert
+const (
+	signalDecay = 30 * 24 * time.Hour
+
+	readWeight     = 6.0
+	readSaturation = 20.0
+
+	queryWeight     = 3.0
+	querySaturation = 15.0
+
+	recencyWeight   = 1.0
+	recencyHalfLife = 14.0 // days
+)
+
+var skillThresholds = []struct {
+	min   float64
+	level string
+}{
+	{8.5, "expert"},
+	{6, "advanced"},
+	{3, "intermediate"},
+	{0, "beginner"},
+}
+
+// TopicSignals are the decayed activity counts for one topic.
+type TopicSignals struct {
+	Reads        float64
+	Queries      float64
+	LastActivity time.Time // zero when there has been no activity
+}
+
+// scoreTopic applies the scoring model, returning a 0–10 score and the
+// matching skill level.
+func scoreTopic(s TopicSignals, now time.Time) (float64, string) {
+	score := readWeight*(1-math.Exp(-s.Reads/readSaturation)) +
+		queryWeight*(1-math.Exp(-s.Queries/querySaturation))
+	if !s.LastActivity.IsZero() {
+		idleDays := now.Sub(s.LastActivity).Hours() / 24
+		score += recencyWeight * math.Pow(0.5, math.Max(idleDays, 0)/recencyHalfLife)
+	}
+	score = math.Round(score*10) / 10
+
+	for _, t := range skillThresholds {
+		if score >= t.min {
+			return score, t.level
+		}
+	}
+	return score, "beginner"
+}
+
+// likeEscaper escapes LIKE's wildcards, and its escape character, with a
+// backslash.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike returns s as a LIKE pattern matching only s itself, so that
+// a topic such as "c_sharp" or "100%" is not read as wildcards.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// loadTopicSignals reads the decayed signals for topic within a workspace.
+func loadTopicSignals(db *sql.DB, workspace, topic string) (TopicSignals, int, error) {
+	var s TopicSignals
+	var queryCount int
+	var lastQuery sql.NullTime
+
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(EXP(-EXTRACT(EPOCH FROM now() - created_at) / $2)), 0),
+		       COUNT(*), MAX(created_at)
+		FROM query_history
+		WHERE query_text ILIKE '%' || $1 || '%' ESCAPE '\' AND workspace_id = $3`,
+		escapeLike(topic), signalDecay.Seconds(), workspace).Scan(&s.Queries, &queryCount, &lastQuery)
+	if err != nil {
+		return s, 0, fmt.Errorf("failed to load queries: %v", err)
+	}
+	if lastQuery.Valid {
+		s.LastActivity = lastQuery.Time
+	}
+
+	var lastRead sql.NullTime
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(EXP(-EXTRACT(EPOCH FROM now() - i.created_at) / $2)), 0),
+		       MAX(i.created_at)
+		FROM content_interactions i
+		JOIN content_metadata c ON c.id = i.content_id
+		WHERE i.interaction_type IN ('read', 'reviewed', 'quizzed') AND $1 = ANY(c.tags) AND c.workspace_id = $3`,
+		topic, signalDecay.Seconds(), workspace).Scan(&s.Reads, &lastRead)
+	if err != nil {
+		return s, 0, fmt.Errorf("failed to load reads: %v", err)
+	}
+	if lastRead.Valid && lastRead.Time.After(s.LastActivity) {
+		s.LastActivity = lastRead.Time
+	}
+
+	return s, queryCount, nil
+}
+
+// updateLearningProgress rescores every tracked topic of every workspace and
+// records a history row for each so progress can be charted over time.
+func updateLearningProgress(db *sql.DB) error {
+	rows, err := db.Query(`SELECT workspace_id, topic FROM learning_progress`)
+	if err != nil {
+		return err
+	}
+	type workspaceTopic struct{ workspace, topic string }
+	var topics []workspaceTopic
+	for rows.Next() {
+		var t workspaceTopic
+		if err := rows.Scan(&t.workspace, &t.topic); err == nil {
+			topics = append(topics, t)
+		}
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, t := range topics {
+		signals, queryCount, err := loadTopicSignals(db, t.workspace, t.topic)
+		if err != nil {
+			slog.Error("skipping progress", "workspace_id", t.workspace, "topic", t.topic, "error", err)
+			continue
+		}
+		score, level := scoreTopic(signals, now)
+
+		_, err = db.Exec(`
+			UPDATE learning_progress
+			SET progress_score = $3, skill_level = $4, total_queries = $5, last_updated = now()
+			WHERE workspace_id = $1 AND topic = $2`, t.workspace, t.topic, score, level, queryCount)
+		if err != nil {
+			slog.Error("failed to update progress", "workspace_id", t.workspace, "topic", t.topic, "error", err)
+			continue
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO learning_progress_history (workspace_id, topic, progress_score, skill_level, reads, queries)
+			VALUES ($1, $2, $3, $4, $5, $6)`, t.workspace, t.topic, score, level, signals.Reads, signals.Queries)
+		if err != nil {
+			slog.Error("failed to record progress history", "workspace_id", t.workspace, "topic", t.topic, "error", err)
+		}
+	}
+
+	slog.Info("learning progress updated", "topics", len(topics))
+	return nil
+}
+
+// runProgressEngine recomputes learning progress every interval.
+func runProgressEngine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		db, err := getDBConnection()
+		if err != nil {
+			slog.Error("learning progress update failed", "error", err)
+		} else {
+			if err := updateLearningProgress(db); err != nil {
+				slog.Error("learning progress update failed", "error", err)
+			}
+			db.Close()
+		}
+		<-ticker.C
+	}
+}
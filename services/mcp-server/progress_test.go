@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreTopic(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		signals TopicSignals
+		level   string
+	}{
+		{"no activity", TopicSignals{}, "beginner"},
+		{"a few queries", TopicSignals{Queries: 3, LastActivity: now}, "beginner"},
+		{"regular reading", TopicSignals{Reads: 15, Queries: 5, LastActivity: now}, "intermediate"},
+		{"heavy recent use", TopicSignals{Reads: 40, Queries: 20, LastActivity: now}, "advanced"},
+		{"saturated", TopicSignals{Reads: 200, Queries: 200, LastActivity: now}, "expert"},
+	}
+	for _, tt := range tests {
+		score, level := scoreTopic(tt.signals, now)
+		if level != tt.level {
+			t.Errorf("%s: expected %s, got %s (score %.1f)", tt.name, tt.level, level, score)
+		}
+		if score < 0 || score > 10 {
+			t.Errorf("%s: score %.1f outside 0-10", tt.name, score)
+		}
+	}
+}
+
+func TestScoreTopicRecencyDecays(t *testing.T) {
+	now := time.Now()
+	fresh, _ := scoreTopic(TopicSignals{Reads: 10, LastActivity: now}, now)
+	stale, _ := scoreTopic(TopicSignals{Reads: 10, LastActivity: now.Add(-60 * 24 * time.Hour)}, now)
+	if fresh <= stale {
+		t.Errorf("Expected recent activity to score higher, got %.1f <= %.1f", fresh, stale)
+	}
+}
+
+func TestScoreTopicRecencyHalfLife(t *testing.T) {
+	now := time.Now()
+	base, _ := scoreTopic(TopicSignals{}, now)
+	fresh, _ := scoreTopic(TopicSignals{LastActivity: now}, now)
+	halfLife, _ := scoreTopic(TopicSignals{LastActivity: now.Add(-recencyHalfLife * 24 * time.Hour)}, now)
+	if fresh-base != recencyWeight || halfLife-base != recencyWeight/2 {
+		t.Errorf("Expected the recency bonus halved after %v days, got %.1f then %.1f", recencyHalfLife, fresh-base, halfLife-base)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"golang":  "golang",
+		"c_sharp": `c\_sharp`,
+		"100%":    `100\%`,
+		`a\b`:     `a\\b`,
+	}
+	for topic, want := range tests {
+		if got := escapeLike(topic); got != want {
+			t.Errorf("%q: expected %q, got %q", topic, want, got)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"selin/internal/llm"
+)
+
+const maxQuizQuestions = 20
+
+// QuizCard is a question/answer pair generated from one content item.
+type QuizCard struct {
+	ID        string `json:"id,omitempty"`
+	ContentID string `json:"content_id"`
+	Question  string `json:"question"`
+	Answer    string `json:"answer"`
+	Source    string `json:"source"` // template, llm
+}
+
+// quizSource is a content item cards are generated from.
+type quizSource struct {
+	ID      string
+	Summary string
+	Tags    []string
+}
+
+// quizLLMTimeout bounds the LLM's card generation, retries included.
+const quizLLMTimeout = 60 * time.Second
+
+var nonAlphanumRun = regexp.MustCompile(`[^a-z0-9 ]+`)
+
+// loadQuizSources picks the workspace's most relevant items for topic,
+// preferring ones the user has read.
+func loadQuizSources(db *sql.DB, workspace, topic string, limit int) ([]quizSource, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.content_summary, array_to_string(c.tags, ',')
+		FROM content_metadata c
+		LEFT JOIN (SELECT DISTINCT content_id FROM content_interactions WHERE user_id = $3) r
+		       ON r.content_id = c.id
+		WHERE c.workspace_id = $4 AND ($1 = ANY(c.tags) OR c.content_summary ILIKE '%' || $1 || '%')
+		ORDER BY (r.content_id IS NOT NULL) DESC, c.relevance_score DESC, c.created_at DESC
+		LIMIT $2`, topic, limit, defaultUserID, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load content: %v", err)
+	}
+	defer rows.Close()
+
+	var sources []quizSource
+	for rows.Next() {
+		var s quizSource
+		var tags string
+		if err := rows.Scan(&s.ID, &s.Summary, &tags); err != nil {
+			continue
+		}
+		if tags != "" {
+			s.Tags = strings.Split(tags, ",")
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// templateCards builds cards without an LLM. Where a tag appears in the
+// summary it is blanked out as a cloze question; otherwise the card asks
+// for the tags the item covers.
+func templateCards(sources []quizSource) []QuizCard {
+	var cards []QuizCard
+	for _, s := range sources {
+		if s.Summary == "" {
+			continue
+		}
+		card := QuizCard{ContentID: s.ID, Source: "template"}
+		for _, tag := range s.Tags {
+			pattern := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(tag) + `\b`)
+			if pattern.MatchString(s.Summary) {
+				card.Question = "Fill in the blank: " + pattern.ReplaceAllString(s.Summary, "_____")
+				card.Answer = tag
+				break
+			}
+		}
+		if card.Question == "" {
+			if len(s.Tags) == 0 {
+				continue
+			}
+			card.Question = fmt.Sprintf("Which topics does this cover? \"%s\"", s.Summary)
+			card.Answer = strings.Join(s.Tags, ", ")
+		}
+		cards = append(cards, card)
+	}
+	return cards
+}
+
+// llmCards asks the configured LLM for one card per source.
+func llmCards(ctx context.Context, client *llm.Client, workspace string, sources []quizSource) ([]QuizCard, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Write one short quiz question per item below. Reply with only a JSON array of " +
+		`{"item": <number>, "question": "...", "answer": "..."}` + " objects.\n\n")
+	for i, s := range sources {
+		prompt.WriteString(fmt.Sprintf("%d. %s\n", i+1, s.Summary))
+	}
+
+	resp, err := client.Chat(ctx, llm.Request{
+		Feature:   "quiz",
+		Workspace: workspace,
+		UserID:    defaultUserID,
+		System:    "You write concise flashcards for a developer learning Go, blockchain and cryptography.",
+		Messages:  []llm.Message{{Role: llm.RoleUser, Content: prompt.String()}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimSuffix(strings.TrimPrefix(resp.Text, "```json"), "```")
+	var generated []struct {
+		Item     int    `json:"item"`
+		Question string `json:"question"`
+		Answer   string `json:"answer"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &generated); err != nil {
+		return nil, fmt.Errorf("LLM reply is not a JSON card list: %v", err)
+	}
+
+	var cards []QuizCard
+	for _, g := range generated {
+		if g.Item < 1 || g.Item > len(sources) || g.Question == "" || g.Answer == "" {
+			continue
+		}
+		cards = append(cards, QuizCard{ContentID: sources[g.Item-1].ID, Question: g.Question, Answer: g.Answer, Source: "llm"})
+	}
+	return cards, nil
+}
+
+// generateQuiz builds and stores up to count cards for topic.
+func generateQuiz(ctx context.Context, db *sql.DB, workspace, topic string, count int) ([]QuizCard, error) {
+	sources, err := loadQuizSources(db, workspace, topic, count)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []QuizCard
+	if client := llm.Default(); client != nil && len(sources) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, quizLLMTimeout)
+		cards, err = llmCards(ctx, client, workspace, sources)
+		cancel()
+		if err != nil {
+			slog.Warn("llm quiz generation failed, using templates", "error", err)
+		}
+	}
+	if len(cards) == 0 {
+		cards = templateCards(sources)
+	}
+
+	for i := range cards {
+		err := db.QueryRow(`
+			INSERT INTO quiz_cards (user_id, content_id, topic, question, answer, source)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id`, defaultUserID, cards[i].ContentID, topic, cards[i].Question, cards[i].Answer, cards[i].Source).Scan(&cards[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store quiz card: %v", err)
+		}
+	}
+	return cards, nil
+}
+
+// normalizeAnswer lowercases and strips punctuation so grading ignores
+// formatting differences.
+func normalizeAnswer(s string) string {
+	s = strings.ToLower(s)
+	s = nonAlphanumRun.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// gradeAnswer accepts an answer that contains the expected one, or any of
+// its comma-separated parts for multi-part answers, as whole words: "go"
+// is not found in "golang".
+func gradeAnswer(expected, given string) bool {
+	given = " " + normalizeAnswer(given) + " "
+	if strings.TrimSpace(given) == "" {
+		return false
+	}
+	if p := normalizeAnswer(expected); p != "" && strings.Contains(given, " "+p+" ") {
+		return true
+	}
+	for _, part := range strings.Split(expected, ",") {
+		if p := normalizeAnswer(part); p != "" && strings.Contains(given, " "+p+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// QuizAnswer is one answer in submit_quiz_answers.
+type QuizAnswer struct {
+	CardID string `json:"card_id"`
+	Answer string `json:"answer"`
+}
+
+// QuizResult is the graded outcome of one answer.
+type QuizResult struct {
+	CardID   string `json:"card_id"`
+	Correct  bool   `json:"correct"`
+	Expected string `json:"expected"`
+}
+
+// submitQuizAnswers grades and records answers, all or none of them. The
+// first correct answer to a card counts towards learning progress for the
+// card's content; answering it again does not count twice.
+func submitQuizAnswers(db *sql.DB, answers []QuizAnswer) ([]QuizResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var results []QuizResult
+	for _, a := range answers {
+		// The card is locked so concurrent submissions count it once
+		var contentID, expected string
+		var answered bool
+		err := tx.QueryRow(`
+			SELECT content_id, answer,
+				EXISTS (SELECT 1 FROM quiz_attempts WHERE card_id = quiz_cards.id AND user_id = $2 AND correct)
+			FROM quiz_cards WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+			a.CardID, defaultUserID).Scan(&contentID, &expected, &answered)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown quiz card %s", a.CardID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load quiz card: %v", err)
+		}
+
+		correct := gradeAnswer(expected, a.Answer)
+		_, err = tx.Exec(`
+			INSERT INTO quiz_attempts (card_id, user_id, answer, correct)
+			VALUES ($1, $2, $3, $4)`, a.CardID, defaultUserID, a.Answer, correct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record quiz answer: %v", err)
+		}
+		if correct && !answered {
+			_, err = tx.Exec(`
+				INSERT INTO content_interactions (user_id, content_id, interaction_type)
+				VALUES ($1, $2, 'quizzed')`, defaultUserID, contentID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record quiz interaction: %v", err)
+			}
+		}
+
+		results = append(results, QuizResult{CardID: a.CardID, Correct: correct, Expected: expected})
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to record quiz answers: %v", err)
+	}
+	return results, nil
+}
+
+func handleGenerateQuiz(args map[string]interface{}) MCPResponse {
+	topic, ok := args["topic"].(string)
+	if !ok || topic == "" {
+		return errorResponse("Topic parameter is required")
+	}
+	count := 5
+	if c, ok := args["count"].(float64); ok && c > 0 {
+		count = int(c)
+	}
+	if count > maxQuizQuestions {
+		count = maxQuizQuestions
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	cards, err := generateQuiz(contextArg(args), db, workspaceArg(args), strings.ToLower(topic), count)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+	if len(cards) == 0 {
+		return MCPResponse{
+			Content: []MCPContent{{
+				Type: "text",
+				Text: fmt.Sprintf("📚 Not enough content about '%s' to build a quiz yet.", topic),
+			}},
+		}
+	}
+
+	var responseText strings.Builder
+	responseText.WriteString(fmt.Sprintf("📝 **Quiz: %s** (%d questions)\n\n", strings.Title(topic), len(cards)))
+	for i, card := range cards {
+		responseText.WriteString(fmt.Sprintf("**%d.** %s\n", i+1, card.Question))
+		responseText.WriteString(fmt.Sprintf("   • Card ID: %s\n\n", card.ID))
+	}
+	responseText.WriteString("Ask the questions one at a time, then send the user's answers with submit_quiz_answers.")
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
+
+func handleSubmitQuizAnswers(args map[string]interface{}) MCPResponse {
+	raw, ok := args["answers"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return errorResponse("answers must be a non-empty list")
+	}
+
+	var answers []QuizAnswer
+	for _, r := range raw {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			return errorResponse("each answer must be an object with card_id and answer")
+		}
+		var a QuizAnswer
+		a.CardID, _ = m["card_id"].(string)
+		a.Answer, _ = m["answer"].(string)
+		if !uuidPattern.MatchString(a.CardID) {
+			return errorResponse("card_id must be a quiz card UUID")
+		}
+		answers = append(answers, a)
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	results, err := submitQuizAnswers(db, answers)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	correct := 0
+	var responseText strings.Builder
+	for i, r := range results {
+		mark := "❌"
+		if r.Correct {
+			mark = "✅"
+			correct++
+		}
+		responseText.WriteString(fmt.Sprintf("%s **%d.** Expected: %s\n", mark, i+1, r.Expected))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: fmt.Sprintf("🎯 **Score: %d/%d**\n\n%s", correct, len(results), responseText.String()),
+		}},
+	}
+}
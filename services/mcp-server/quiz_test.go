@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateCards(t *testing.T) {
+	cards := templateCards([]quizSource{
+		{ID: "a", Summary: "Understanding Goroutine leaks in golang services", Tags: []string{"golang", "concurrency"}},
+		{ID: "b", Summary: "A gentle introduction", Tags: []string{"cryptography"}},
+		{ID: "c", Summary: "No tags at all"},
+	})
+
+	if len(cards) != 2 {
+		t.Fatalf("Expected 2 cards, got %d", len(cards))
+	}
+	if cards[0].Answer != "golang" || !strings.Contains(cards[0].Question, "_____") || strings.Contains(cards[0].Question, "golang") {
+		t.Errorf("Expected a cloze card blanking golang, got %+v", cards[0])
+	}
+	if cards[1].Answer != "cryptography" || !strings.Contains(cards[1].Question, "Which topics") {
+		t.Errorf("Expected a topic card, got %+v", cards[1])
+	}
+}
+
+func TestGradeAnswer(t *testing.T) {
+	tests := []struct {
+		expected, given string
+		correct         bool
+	}{
+		{"golang", "Golang!", true},
+		{"merkle tree", "it's a Merkle  tree", true},
+		{"golang, concurrency", "concurrency", true},
+		{"golang", "rust", false},
+		{"golang", "", false},
+		{"go", "golang", false},
+		{"tree", "a subtree", false},
+		{"golang, concurrency", "go", false},
+	}
+	for _, tt := range tests {
+		if got := gradeAnswer(tt.expected, tt.given); got != tt.correct {
+			t.Errorf("gradeAnswer(%q, %q) = %v, want %v", tt.expected, tt.given, got, tt.correct)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"selin/internal/clients"
+	"selin/internal/config"
+	"selin/internal/logging"
+	"selin/internal/rbac"
+)
+
+// policy decides which roles may call each tool. main replaces it with the
+// one from RBAC_POLICY_FILE.
+var policy = rbac.DefaultPolicy()
+
+// vouched reports whether the request comes from the gateway or another
+// service holding MCP_SERVER_TOKEN, whose caller headers can be believed.
+// Without the token nobody is vouched for.
+func vouched(r *http.Request) bool {
+	token := config.Secret(clients.MCPServerToken)
+	return token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(clients.TokenHeader)), []byte(token)) == 1
+}
+
+// requestRole returns the role the gateway resolved for the caller. Direct
+// callers, and requests the role header does not come with the token on,
+// are readers whatever they claim.
+func requestRole(r *http.Request) rbac.Role {
+	if !vouched(r) {
+		return rbac.Reader
+	}
+	if role, ok := rbac.ParseRole(r.Header.Get(rbac.Header)); ok {
+		return role
+	}
+	return rbac.Reader
+}
+
+// authorizeTool writes a 403 and returns false when the caller's role may
+// not call the tool.
+func authorizeTool(w http.ResponseWriter, r *http.Request, tool string) bool {
+	denied, ok := toolDenied(r, tool)
+	if !ok {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(denied)
+	return false
+}
+
+// toolDenied returns the error response for a tool the caller's role may
+// not call, and whether it may not.
+func toolDenied(r *http.Request, tool string) (MCPResponse, bool) {
+	role, need := requestRole(r), policy.ToolRole(tool)
+	if role.Includes(need) {
+		return MCPResponse{}, false
+	}
+	logging.FromContext(r.Context()).Warn("denied tool call", "tool", tool, "role", role)
+	return errorResponse(fmt.Sprintf("🔒 %s requires the %s role", tool, need)), true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/clients"
+	"selin/internal/config"
+	"selin/internal/rbac"
+)
+
+// vouch has r come with the MCP server token, as from the gateway.
+func vouch(t *testing.T, r *http.Request) {
+	t.Setenv(clients.MCPServerToken, "shared")
+	config.Secrets().Reload()
+	r.Header.Set(clients.TokenHeader, "shared")
+}
+
+func TestAuthorizeTool(t *testing.T) {
+	tests := []struct {
+		role    string
+		vouched bool
+		tool    string
+		want    bool
+	}{
+		{"reader", true, "search_content", true},
+		{"reader", true, "set_learning_goal", false},
+		{"editor", true, "set_learning_goal", true},
+		{"", true, "set_learning_goal", false},
+		{"superuser", true, "mark_as_read", false},
+		{"", false, "search_content", true}, // direct callers are readers
+		{"admin", false, "rename_tag", false},
+		{"editor", false, "set_learning_goal", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/mcp/call", nil)
+		req.Header.Set(rbac.Header, tt.role)
+		if tt.vouched {
+			vouch(t, req)
+		}
+		rr := httptest.NewRecorder()
+		if got := authorizeTool(rr, req, tt.tool); got != tt.want {
+			t.Errorf("role %q (vouched %v) calling %s: expected %v, got %v", tt.role, tt.vouched, tt.tool, tt.want, got)
+		}
+		if !tt.want && rr.Code != 403 {
+			t.Errorf("role %q calling %s: expected 403, got %d", tt.role, tt.tool, rr.Code)
+		}
+	}
+}
+
+func TestRequestRoleWrongToken(t *testing.T) {
+	req := httptest.NewRequest("POST", "/mcp/call", nil)
+	vouch(t, req)
+	req.Header.Set(clients.TokenHeader, "guess")
+	req.Header.Set(rbac.Header, "admin")
+	if role := requestRole(req); role != rbac.Reader {
+		t.Errorf("Expected a reader without the right token, got %s", role)
+	}
+}
+
+// readOnlyTools are the tools a reader may call. generate_quiz keeps the
+// cards it makes for grading, and content_gaps only suggests keywords for
+// an admin to review; neither changes what anyone reads.
+var readOnlyTools = map[string]bool{
+	"search_content":         true,
+	"get_learning_progress":  true,
+	"get_recent_content":     true,
+	"analyze_content_trends": true,
+	"get_due_reviews":        true,
+	"generate_quiz":          true,
+	"get_related_concepts":   true,
+	"get_graph_neighborhood": true,
+	"get_recommendations":    true,
+	"get_learning_goals":     true,
+	"get_query_history":      true,
+	"content_gaps":           true,
+	"get_content_revisions":  true,
+	"get_thread":             true,
+	"get_top_authors":        true,
+	"get_engagement_trends":  true,
+	"get_collection":         true,
+	"get_preferences":        true,
+}
+
+// TestWriteToolsNeedEditor keeps every tool that writes, including ones
+// added later, out of a reader's reach in the default policy, which
+// config/rbac.yaml matches.
+func TestWriteToolsNeedEditor(t *testing.T) {
+	p := rbac.DefaultPolicy()
+	for _, tool := range builtinTools() {
+		if readOnlyTools[tool.Name] {
+			continue
+		}
+		if need := p.ToolRole(tool.Name); !need.Includes(rbac.Editor) {
+			t.Errorf("%s writes but needs only the %s role", tool.Name, need)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// Recommendations rank unread content by
+//
+//	score = 0.45·fit + 0.35·relevance + 0.20·e^(−age/7d)
+//
+// where fit is how much the user still needs the best-matching topic being
+// learned (1 − progress/10, at least 0.2; 0 when no tag matches), raised by
+// goalBonus for topics of an active learning goal. Picks are then made
+// greedily with at most maxPerTopic items per topic, so one busy topic
+// cannot fill the whole list.
+const (
+	fitWeight       = 0.45
+	relevanceWeight = 0.35
+	freshnessWeight = 0.20
+	freshnessDays   = 7.0
+	maxPerTopic     = 2
+	minTopicNeed    = 0.2
+	goalBonus       = 0.3
+
+	candidatePool = 200
+)
+
+// LearningTopic is a topic the user is learning and how far along they are.
+type LearningTopic struct {
+	Topic         string
+	SkillLevel    string
+	ProgressScore float64
+	Goal          string // title of an active goal covering the topic
+}
+
+// RecommendationCandidate is unread content considered for recommendation.
+type RecommendationCandidate struct {
+	ContentID      string
+	Summary        string
+	SourceURL      string
+	Platform       string
+	Tags           []string
+	RelevanceScore float64
+	CreatedAt      time.Time
+}
+
+// Recommendation is a ranked candidate with the reason it was picked.
+type Recommendation struct {
+	ContentID   string   `json:"content_id"`
+	Summary     string   `json:"summary"`
+	SourceURL   string   `json:"source_url"`
+	Platform    string   `json:"platform"`
+	Tags        []string `json:"tags"`
+	Topic       string   `json:"topic,omitempty"`
+	Score       float64  `json:"score"`
+	Explanation string   `json:"explanation"`
+}
+
+// rankRecommendations scores candidates against the learning topics and
+// returns up to limit diverse picks, best first.
+func rankRecommendations(candidates []RecommendationCandidate, topics map[string]LearningTopic, now time.Time, limit int) []Recommendation {
+	type scored struct {
+		c     RecommendationCandidate
+		topic string
+		fit   float64
+		score float64
+	}
+
+	var ranked []scored
+	for _, c := range candidates {
+		s := scored{c: c}
+		for _, tag := range c.Tags {
+			t, ok := topics[strings.ToLower(tag)]
+			if !ok {
+				continue
+			}
+			need := math.Max(minTopicNeed, 1-t.ProgressScore/10)
+			if t.Goal != "" {
+				need = math.Min(1, need+goalBonus)
+			}
+			if need > s.fit {
+				s.fit = need
+				s.topic = t.Topic
+			}
+		}
+		ageDays := math.Max(now.Sub(c.CreatedAt).Hours()/24, 0)
+		s.score = fitWeight*s.fit + relevanceWeight*c.RelevanceScore + freshnessWeight*math.Exp(-ageDays/freshnessDays)
+		ranked = append(ranked, s)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+
+	recommendations := []Recommendation{}
+	perTopic := map[string]int{}
+	for _, s := range ranked {
+		if len(recommendations) >= limit {
+			break
+		}
+		if s.topic != "" && perTopic[s.topic] >= maxPerTopic {
+			continue
+		}
+		perTopic[s.topic]++
+
+		var reasons []string
+		if s.topic != "" {
+			t := topics[s.topic]
+			if t.Goal != "" {
+				reasons = append(reasons, fmt.Sprintf("supports your goal %q", t.Goal))
+			}
+			reasons = append(reasons, fmt.Sprintf("fits your %s learning (%s, %.1f/10)", t.Topic, t.SkillLevel, t.ProgressScore))
+		}
+		reasons = append(reasons, fmt.Sprintf("relevance %.2f", s.c.RelevanceScore))
+		reasons = append(reasons, "collected "+ageString(now.Sub(s.c.CreatedAt)))
+
+		recommendations = append(recommendations, Recommendation{
+			ContentID:   s.c.ContentID,
+			Summary:     s.c.Summary,
+			SourceURL:   s.c.SourceURL,
+			Platform:    s.c.Platform,
+			Tags:        s.c.Tags,
+			Topic:       s.topic,
+			Score:       math.Round(s.score*100) / 100,
+			Explanation: strings.Join(reasons, ", "),
+		})
+	}
+	return recommendations
+}
+
+func ageString(d time.Duration) string {
+	switch days := int(d.Hours() / 24); {
+	case days < 1:
+		return "today"
+	case days == 1:
+		return "yesterday"
+	default:
+		return fmt.Sprintf("%d days ago", days)
+	}
+}
+
+// loadLearningTopics returns the workspace's topics being learned keyed by
+// lowercase name.
+func loadLearningTopics(db *sql.DB, workspace string) (map[string]LearningTopic, error) {
+	rows, err := db.Query(`SELECT topic, skill_level, progress_score FROM learning_progress WHERE workspace_id = $1`, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load learning topics: %v", err)
+	}
+	defer rows.Close()
+
+	topics := map[string]LearningTopic{}
+	for rows.Next() {
+		var t LearningTopic
+		if err := rows.Scan(&t.Topic, &t.SkillLevel, &t.ProgressScore); err != nil {
+			continue
+		}
+		t.Topic = strings.ToLower(t.Topic)
+		topics[t.Topic] = t
+	}
+	return topics, nil
+}
+
+// loadRecommendationCandidates returns the workspace's most relevant content
+// the user has not read, optionally restricted to a topic.
+func loadRecommendationCandidates(db *sql.DB, workspace, userID, topic string) ([]RecommendationCandidate, error) {
+	query := `
+		SELECT c.id, c.content_summary, c.source_url, c.source_platform,
+		       array_to_string(c.tags, ','), c.relevance_score, c.created_at
+		FROM content_metadata c
+		WHERE c.workspace_id = $2 AND NOT EXISTS (
+			SELECT 1 FROM content_interactions i
+			WHERE i.content_id = c.id AND i.user_id = $1 AND i.interaction_type <> 'viewed'
+		)`
+	args := []interface{}{userID, workspace}
+	if topic != "" {
+		query += " AND $3 = ANY(c.tags)"
+		args = append(args, topic)
+	}
+	query += " ORDER BY c.relevance_score DESC, c.created_at DESC LIMIT " + strconv.Itoa(candidatePool)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load candidates: %v", err)
+	}
+	defer rows.Close()
+
+	var candidates []RecommendationCandidate
+	for rows.Next() {
+		var c RecommendationCandidate
+		var tags string
+		if err := rows.Scan(&c.ContentID, &c.Summary, &c.SourceURL, &c.Platform, &tags, &c.RelevanceScore, &c.CreatedAt); err != nil {
+			continue
+		}
+		if tags != "" {
+			c.Tags = strings.Split(tags, ",")
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+func recommend(db *sql.DB, workspace, userID, topic string, limit int) ([]Recommendation, error) {
+	topics, err := loadLearningTopics(db, workspace)
+	if err != nil {
+		return nil, err
+	}
+	goals, err := activeGoalTopics(db, workspace, userID)
+	if err != nil {
+		return nil, err
+	}
+	for topic, goal := range goals {
+		t, ok := topics[topic]
+		if !ok {
+			t = LearningTopic{Topic: topic, SkillLevel: "beginner"}
+		}
+		t.Goal = goal
+		topics[topic] = t
+	}
+	candidates, err := loadRecommendationCandidates(db, workspace, userID, topic)
+	if err != nil {
+		return nil, err
+	}
+	return rankRecommendations(candidates, topics, time.Now(), limit), nil
+}
+
+// recommendationsHandler serves GET /recommendations.
+func recommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = defaultUserID
+	}
+	limit := 10
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 50 {
+		limit = l
+	}
+	topic := strings.ToLower(r.URL.Query().Get("topic"))
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	recommendations, err := recommend(db, requestWorkspace(r), userID, topic, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load recommendations", "error", err)
+		http.Error(w, "Failed to build recommendations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":         userID,
+		"recommendations": recommendations,
+	})
+}
+
+func handleGetRecommendations(args map[string]interface{}) MCPResponse {
+	limit := 5
+	if l, ok := args["limit"].(float64); ok && l > 0 && l <= 50 {
+		limit = int(l)
+	}
+	topic, _ := args["topic"].(string)
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	recommendations, err := recommend(db, workspaceArg(args), defaultUserID, strings.ToLower(topic), limit)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var responseText strings.Builder
+	if len(recommendations) == 0 {
+		responseText.WriteString("📭 You're all caught up — no unread content to recommend.")
+	} else {
+		responseText.WriteString(fmt.Sprintf("📚 **What to read next** (%d picks)\n\n", len(recommendations)))
+	}
+	for i, rec := range recommendations {
+		responseText.WriteString(fmt.Sprintf("**%d.** %s\n", i+1, rec.Summary))
+		responseText.WriteString(fmt.Sprintf("   • Why: %s\n", rec.Explanation))
+		responseText.WriteString(fmt.Sprintf("   • ID: %s\n", rec.ContentID))
+		responseText.WriteString(fmt.Sprintf("   • URL: %s\n\n", rec.SourceURL))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
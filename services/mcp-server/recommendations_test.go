@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRankRecommendations(t *testing.T) {
+	now := time.Now()
+	topics := map[string]LearningTopic{
+		"golang":     {Topic: "golang", SkillLevel: "beginner", ProgressScore: 1},
+		"blockchain": {Topic: "blockchain", SkillLevel: "expert", ProgressScore: 9.5},
+	}
+	candidates := []RecommendationCandidate{
+		{ContentID: "blockchain-1", Tags: []string{"blockchain"}, RelevanceScore: 0.6, CreatedAt: now},
+		{ContentID: "golang-1", Tags: []string{"Golang"}, RelevanceScore: 0.6, CreatedAt: now},
+		{ContentID: "golang-2", Tags: []string{"golang"}, RelevanceScore: 0.6, CreatedAt: now.Add(-24 * time.Hour)},
+		{ContentID: "golang-3", Tags: []string{"golang"}, RelevanceScore: 0.6, CreatedAt: now.Add(-48 * time.Hour)},
+		{ContentID: "other", Tags: []string{"rust"}, RelevanceScore: 0.2, CreatedAt: now},
+	}
+
+	recs := rankRecommendations(candidates, topics, now, 4)
+
+	var ids []string
+	for _, r := range recs {
+		ids = append(ids, r.ContentID)
+	}
+	want := "golang-1,golang-2,blockchain-1,other"
+	if got := strings.Join(ids, ","); got != want {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+	if !strings.Contains(recs[0].Explanation, "golang learning") {
+		t.Errorf("Expected explanation to name the topic, got %q", recs[0].Explanation)
+	}
+	if recs[3].Topic != "" {
+		t.Errorf("Expected untracked content to have no topic, got %q", recs[3].Topic)
+	}
+}
+
+func TestRankRecommendationsGoalBoost(t *testing.T) {
+	now := time.Now()
+	topics := map[string]LearningTopic{
+		"golang":     {Topic: "golang", SkillLevel: "intermediate", ProgressScore: 5},
+		"kubernetes": {Topic: "kubernetes", SkillLevel: "intermediate", ProgressScore: 5, Goal: "pass CKA"},
+	}
+	candidates := []RecommendationCandidate{
+		{ContentID: "golang-1", Tags: []string{"golang"}, RelevanceScore: 0.6, CreatedAt: now},
+		{ContentID: "k8s-1", Tags: []string{"kubernetes"}, RelevanceScore: 0.6, CreatedAt: now},
+	}
+
+	recs := rankRecommendations(candidates, topics, now, 2)
+	if recs[0].ContentID != "k8s-1" {
+		t.Fatalf("Expected goal content first, got %s", recs[0].ContentID)
+	}
+	if !strings.Contains(recs[0].Explanation, `goal "pass CKA"`) {
+		t.Errorf("Expected explanation to name the goal, got %q", recs[0].Explanation)
+	}
+}
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"selin/internal/adminauth"
+	"selin/internal/blob"
+	"selin/internal/keyring"
+	"selin/internal/logging"
+	"selin/internal/tagging"
+)
+
+const (
+	defaultReindexBatch    = 500
+	maxReindexBatch        = 5000
+	defaultReindexThrottle = 100 * time.Millisecond
+	maxReindexThrottle     = time.Minute
+	reindexPollInterval    = 10 * time.Second
+	// reindexLease is how long a job's worker may go without checkpointing
+	// before another replica takes the job over.
+	reindexLease = 2 * time.Minute
+)
+
+var errReindexUnfinished = fmt.Errorf("a reindex job is already unfinished: resume or cancel it first")
+
+// reindexWake starts the reindexer's next poll now; it holds at most one
+// pending wake-up.
+var reindexWake = make(chan struct{}, 1)
+
+// reindexStep rebuilds one derived column for a batch of content IDs,
+// inside the batch's transaction.
+type reindexStep func(ctx context.Context, run *reindexRun, tx *sql.Tx, ids []string) error
+
+// reindexSteps are the derived columns a reindex can rebuild.
+var reindexSteps = map[string]reindexStep{
+	// search_vector is filled in by a trigger as content is written; rows
+	// stored before it existed need it computed
+	"search_vector": func(ctx context.Context, _ *reindexRun, tx *sql.Tx, ids []string) error {
+		_, err := tx.ExecContext(ctx, `UPDATE content_metadata SET search_vector = content_search_vector(content_summary, tags)
+			WHERE id::text = ANY(string_to_array($1, ','))`, strings.Join(ids, ","))
+		return err
+	},
+	// tags are normalized and the workspace's current aliases applied, which
+	// new content gets as it is stored
+	"tags": reindexTags,
+	// embeddings are queued for the vector generator again
+	"embeddings": func(ctx context.Context, _ *reindexRun, tx *sql.Tx, ids []string) error {
+		_, err := tx.ExecContext(ctx, `UPDATE content_metadata SET embedded_at = NULL
+			WHERE embedded_at IS NOT NULL AND id::text = ANY(string_to_array($1, ','))`, strings.Join(ids, ","))
+		return err
+	},
+	// encryption seals chunk text, attachment text and attachment files
+	// under their workspace's current key: content stored before the
+	// workspace had keys, or under a key being rotated out
+	"encryption": reindexEncryption,
+}
+
+// defaultReindexSteps leaves out embeddings, which are expensive to
+// regenerate.
+var defaultReindexSteps = []string{"search_vector", "tags"}
+
+// ReindexJob is a reindex and its progress.
+type ReindexJob struct {
+	ID         int64      `json:"id"`
+	Steps      []string   `json:"steps"`
+	Status     string     `json:"status"`
+	BatchSize  int        `json:"batch_size"`
+	ThrottleMS int        `json:"throttle_ms"`
+	LastID     string     `json:"last_id,omitempty"`
+	Processed  int64      `json:"processed"`
+	Total      int64      `json:"total"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	Percent    float64    `json:"percent"`
+	RowsPerSec float64    `json:"rows_per_sec,omitempty"`
+	ETA        *time.Time `json:"eta,omitempty"`
+}
+
+// ReindexRequest is the body of POST /admin/reindex; omitted fields take
+// their defaults.
+type ReindexRequest struct {
+	Steps     []string `json:"steps"`
+	BatchSize int      `json:"batch_size"`
+	Throttle  string   `json:"throttle"` // a Go duration such as "250ms"
+}
+
+// job validates the request and returns the job it starts.
+func (req ReindexRequest) job() (ReindexJob, error) {
+	job := ReindexJob{Steps: req.Steps, BatchSize: req.BatchSize, ThrottleMS: int(defaultReindexThrottle.Milliseconds())}
+	if len(job.Steps) == 0 {
+		job.Steps = defaultReindexSteps
+	}
+	seen := map[string]bool{}
+	for _, step := range job.Steps {
+		if _, ok := reindexSteps[step]; !ok {
+			return job, fmt.Errorf("unknown step %q: steps are search_vector, tags, embeddings and encryption", step)
+		}
+		if seen[step] {
+			return job, fmt.Errorf("step %q is listed twice", step)
+		}
+		seen[step] = true
+	}
+	if job.BatchSize == 0 {
+		job.BatchSize = defaultReindexBatch
+	}
+	if job.BatchSize < 1 || job.BatchSize > maxReindexBatch {
+		return job, fmt.Errorf("batch_size must be between 1 and %d", maxReindexBatch)
+	}
+	if req.Throttle != "" {
+		throttle, err := time.ParseDuration(req.Throttle)
+		if err != nil || throttle < 0 || throttle > maxReindexThrottle {
+			return job, fmt.Errorf("throttle must be a duration between 0s and %s", maxReindexThrottle)
+		}
+		job.ThrottleMS = int(throttle.Milliseconds())
+	}
+	return job, nil
+}
+
+// progress fills in how far the job is and, while it runs, when it should
+// finish at the rate it has kept so far.
+func (j *ReindexJob) progress(now time.Time) {
+	j.Percent, j.RowsPerSec, j.ETA = 100, 0, nil
+	if j.Total > 0 {
+		j.Percent = math.Round(float64(min(j.Processed, j.Total))*1000/float64(j.Total)) / 10
+	}
+	end := now
+	if j.FinishedAt != nil {
+		end = *j.FinishedAt
+	} else if j.Status != "running" {
+		end = j.UpdatedAt
+	}
+	elapsed := end.Sub(j.CreatedAt).Seconds()
+	if j.Processed == 0 || elapsed <= 0 {
+		return
+	}
+	j.RowsPerSec = math.Round(float64(j.Processed)/elapsed*10) / 10
+	if j.Status == "running" && j.Processed < j.Total {
+		eta := now.Add(time.Duration(float64(j.Total-j.Processed) / (float64(j.Processed) / elapsed) * float64(time.Second))).Truncate(time.Second)
+		j.ETA = &eta
+	}
+}
+
+const reindexJobColumns = `id, steps, status, batch_size, throttle_ms, COALESCE(last_id::text, ''), processed, total,
+	COALESCE(error, ''), created_at, updated_at, finished_at`
+
+func scanReindexJob(row interface{ Scan(...interface{}) error }) (ReindexJob, error) {
+	var j ReindexJob
+	var finished sql.NullTime
+	err := row.Scan(&j.ID, pq.Array(&j.Steps), &j.Status, &j.BatchSize, &j.ThrottleMS, &j.LastID, &j.Processed, &j.Total,
+		&j.Error, &j.CreatedAt, &j.UpdatedAt, &finished)
+	if finished.Valid {
+		j.FinishedAt = &finished.Time
+	}
+	return j, err
+}
+
+// startReindex records a new running job over every content row.
+func startReindex(db *sql.DB, job *ReindexJob) error {
+	started, err := scanReindexJob(db.QueryRow(`
+		INSERT INTO reindex_jobs (steps, batch_size, throttle_ms, total)
+		SELECT $1, $2, $3, COUNT(*) FROM content_metadata
+		ON CONFLICT DO NOTHING
+		RETURNING `+reindexJobColumns, pq.Array(job.Steps), job.BatchSize, job.ThrottleMS))
+	if err == sql.ErrNoRows {
+		return errReindexUnfinished
+	}
+	if err != nil {
+		return err
+	}
+	*job = started
+	return nil
+}
+
+// latestReindex returns the newest job, or nil when there has been none.
+func latestReindex(db *sql.DB) (*ReindexJob, error) {
+	job, err := scanReindexJob(db.QueryRow(`SELECT ` + reindexJobColumns + ` FROM reindex_jobs ORDER BY id DESC LIMIT 1`))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// setReindexStatus moves the unfinished job from one of the from statuses
+// to status, returning it, or nil when there is no such job. Resumed jobs
+// lose their worker so the next poll picks them up.
+func setReindexStatus(db *sql.DB, status string, from ...string) (*ReindexJob, error) {
+	job, err := scanReindexJob(db.QueryRow(`
+		UPDATE reindex_jobs SET status = $1, updated_at = now(),
+			error = CASE WHEN $1 = 'running' THEN NULL ELSE error END,
+			worker = CASE WHEN $1 = 'running' THEN NULL ELSE worker END,
+			heartbeat_at = CASE WHEN $1 = 'running' THEN NULL ELSE heartbeat_at END,
+			finished_at = CASE WHEN $1 = 'cancelled' THEN now() ELSE finished_at END
+		WHERE status = ANY($2)
+		RETURNING `+reindexJobColumns, status, pq.Array(from)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// reindexRun is the state of one worker's run of a job.
+type reindexRun struct {
+	db      *sql.DB
+	job     ReindexJob
+	worker  string
+	aliases map[string]tagging.Aliases // by workspace
+	// replacedBlobs are the blobs the batch's attachments were moved off,
+	// removed once the batch commits
+	replacedBlobs []string
+}
+
+// claimReindex takes the running job when no live worker holds it.
+func claimReindex(db *sql.DB, worker string) (*reindexRun, error) {
+	job, err := scanReindexJob(db.QueryRow(`
+		UPDATE reindex_jobs SET worker = $1, heartbeat_at = now()
+		WHERE status = 'running' AND (heartbeat_at IS NULL OR heartbeat_at < now() - make_interval(secs => $2))
+		RETURNING `+reindexJobColumns, worker, reindexLease.Seconds()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reindexRun{db: db, job: job, worker: worker, aliases: map[string]tagging.Aliases{}}, nil
+}
+
+// batch rebuilds the next batch and checkpoints it in the same
+// transaction, so each row is reindexed once however often the job is
+// interrupted. It reports false once the job is done or no longer this
+// worker's to run.
+func (run *reindexRun) batch(ctx context.Context) (bool, error) {
+	job := &run.job
+	after := sql.NullString{String: job.LastID, Valid: job.LastID != ""}
+	rows, err := run.db.QueryContext(ctx, `SELECT id FROM content_metadata WHERE $1::uuid IS NULL OR id > $1::uuid ORDER BY id LIMIT $2`,
+		after, job.BatchSize)
+	if err != nil {
+		return false, fmt.Errorf("failed to load batch: %v", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to load batch: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		res, err := run.db.ExecContext(ctx, `UPDATE reindex_jobs SET status = 'completed', finished_at = now(), updated_at = now()
+			WHERE id = $1 AND status = 'running' AND worker = $2`, job.ID, run.worker)
+		if err != nil {
+			return false, fmt.Errorf("failed to complete job: %v", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			slog.Info("reindex completed", "job", job.ID, "processed", job.Processed)
+		}
+		return false, nil
+	}
+
+	tx, err := run.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	run.replacedBlobs = nil
+	for _, name := range job.Steps {
+		if err := reindexSteps[name](ctx, run, tx, ids); err != nil {
+			return false, fmt.Errorf("step %s failed after %s: %v", name, job.LastID, err)
+		}
+	}
+	last := ids[len(ids)-1]
+	res, err := tx.ExecContext(ctx, `
+		UPDATE reindex_jobs SET last_id = $3, processed = processed + $4, heartbeat_at = now(), updated_at = now()
+		WHERE id = $1 AND status = 'running' AND worker = $2`, job.ID, run.worker, last, len(ids))
+	if err != nil {
+		return false, fmt.Errorf("failed to checkpoint: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Paused, cancelled or taken over: drop the batch
+		return false, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to checkpoint: %v", err)
+	}
+	run.removeReplacedBlobs(ctx)
+	job.LastID = last
+	job.Processed += int64(len(ids))
+	return true, nil
+}
+
+// fail records why the job stopped; resuming it retries the batch.
+func (run *reindexRun) fail(err error) {
+	slog.Error("reindex failed", "job", run.job.ID, "error", err)
+	if _, dbErr := run.db.Exec(`UPDATE reindex_jobs SET status = 'failed', error = $3, updated_at = now()
+		WHERE id = $1 AND worker = $2 AND status = 'running'`, run.job.ID, run.worker, err.Error()); dbErr != nil {
+		slog.Error("failed to record reindex failure", "job", run.job.ID, "error", dbErr)
+	}
+}
+
+func reindexTags(ctx context.Context, run *reindexRun, tx *sql.Tx, ids []string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, workspace_id, COALESCE(tags, '{}') FROM content_metadata
+		WHERE id::text = ANY(string_to_array($1, ','))`, strings.Join(ids, ","))
+	if err != nil {
+		return err
+	}
+	type change struct {
+		id   string
+		tags []string
+	}
+	var changes []change
+	for rows.Next() {
+		var id, workspace string
+		var tags []string
+		if err := rows.Scan(&id, &workspace, pq.Array(&tags)); err != nil {
+			rows.Close()
+			return err
+		}
+		aliases, ok := run.aliases[workspace]
+		if !ok {
+			if aliases, err = tagging.LoadAliases(ctx, run.db, workspace); err != nil {
+				rows.Close()
+				return err
+			}
+			run.aliases[workspace] = aliases
+		}
+		if next := aliases.Apply(tags); strings.Join(next, ",") != strings.Join(tags, ",") {
+			changes = append(changes, change{id, next})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if _, err := tx.ExecContext(ctx, `UPDATE content_metadata SET tags = $2, updated_at = now() WHERE id = $1`,
+			c.id, pq.Array(c.tags)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reindexEncryption(ctx context.Context, run *reindexRun, tx *sql.Tx, ids []string) error {
+	keys := keyring.Default()
+	rows, err := tx.QueryContext(ctx, `SELECT content_id, position, workspace_id, text FROM content_chunks
+		WHERE content_id::text = ANY(string_to_array($1, ','))`, strings.Join(ids, ","))
+	if err != nil {
+		return err
+	}
+	type chunk struct {
+		id        string
+		position  int
+		workspace string
+		text      string
+	}
+	var chunks []chunk
+	for rows.Next() {
+		var c chunk
+		if err := rows.Scan(&c.id, &c.position, &c.workspace, &c.text); err != nil {
+			rows.Close()
+			return err
+		}
+		stale, err := keys.StaleString(ctx, c.workspace, c.text)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if stale {
+			chunks = append(chunks, c)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		text, err := keys.RewrapString(ctx, c.workspace, c.text)
+		if err != nil {
+			return fmt.Errorf("chunk %d of %s: %v", c.position, c.id, err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE content_chunks SET text = $3 WHERE content_id = $1 AND position = $2`,
+			c.id, c.position, text); err != nil {
+			return err
+		}
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT content_id, position, workspace_id, COALESCE(blob_key, ''), COALESCE(extracted_text, '')
+		FROM content_attachments WHERE content_id::text = ANY(string_to_array($1, ','))
+		AND (blob_key IS NOT NULL OR extracted_text IS NOT NULL)`, strings.Join(ids, ","))
+	if err != nil {
+		return err
+	}
+	type attachment struct {
+		id        string
+		position  int
+		workspace string
+		blobKey   string
+		text      string
+	}
+	var attachments []attachment
+	for rows.Next() {
+		var a attachment
+		if err := rows.Scan(&a.id, &a.position, &a.workspace, &a.blobKey, &a.text); err != nil {
+			rows.Close()
+			return err
+		}
+		attachments = append(attachments, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	blobs := blob.FromEnv()
+	for _, a := range attachments {
+		blobKey, err := rewrapBlob(ctx, blobs, a.workspace, a.blobKey)
+		if err != nil {
+			return fmt.Errorf("attachment %d of %s: %v", a.position, a.id, err)
+		}
+		text := a.text
+		if stale, err := keys.StaleString(ctx, a.workspace, text); err != nil {
+			return err
+		} else if stale && text != "" {
+			if text, err = keys.RewrapString(ctx, a.workspace, text); err != nil {
+				return fmt.Errorf("attachment %d of %s: %v", a.position, a.id, err)
+			}
+		}
+		if blobKey == a.blobKey && text == a.text {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE content_attachments SET blob_key = NULLIF($3, ''), extracted_text = NULLIF($4, '')
+			WHERE content_id = $1 AND position = $2`, a.id, a.position, blobKey, text); err != nil {
+			return err
+		}
+		if blobKey != a.blobKey {
+			run.replacedBlobs = append(run.replacedBlobs, a.blobKey)
+		}
+	}
+	return nil
+}
+
+// removeReplacedBlobs removes the blobs the committed batch moved
+// attachments off, unless other attachments or transcriptions still use
+// them: plaintext blobs are shared by every copy of a file.
+func (run *reindexRun) removeReplacedBlobs(ctx context.Context) {
+	blobs := blob.FromEnv()
+	for _, key := range run.replacedBlobs {
+		var used bool
+		err := run.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM content_attachments WHERE blob_key = $1)
+			OR EXISTS (SELECT 1 FROM transcription_jobs WHERE blob_key = $1)`, key).Scan(&used)
+		if err != nil {
+			slog.Warn("failed to check blob use, keeping it", "blob", key, "error", err)
+			continue
+		}
+		if used {
+			continue
+		}
+		if err := blobs.Remove(key); err != nil {
+			slog.Warn("failed to remove replaced blob", "blob", key, "error", err)
+		}
+	}
+	run.replacedBlobs = nil
+}
+
+// rewrapBlob stores the blob with key again under workspace's current key
+// when it is not already, and returns its new key. The old blob is left
+// in place until the batch commits, and then only removed if nothing else
+// shares it.
+func rewrapBlob(ctx context.Context, blobs *blob.Store, workspace, key string) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	f, err := blobs.Open(key)
+	if errors.Is(err, blob.ErrNotFound) {
+		return key, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	stale, err := keyring.Default().Stale(ctx, workspace, data)
+	if err != nil || !stale {
+		return key, err
+	}
+	sealed, err := keyring.Default().Rewrap(ctx, workspace, data)
+	if err != nil {
+		return "", err
+	}
+	key, _, err = blobs.Put(bytes.NewReader(sealed))
+	return key, err
+}
+
+// runReindexer polls for a running job no live worker holds and runs it,
+// one batch at a time with the job's throttle in between.
+func runReindexer() {
+	host, _ := os.Hostname()
+	worker := fmt.Sprintf("%s/%d", host, os.Getpid())
+
+	ticker := time.NewTicker(reindexPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-reindexWake:
+		}
+		db, err := getDBConnection()
+		if err != nil {
+			slog.Error("reindex poll failed", "error", err)
+			continue
+		}
+		run, err := claimReindex(db, worker)
+		if err != nil {
+			slog.Error("reindex poll failed", "error", err)
+		} else if run != nil {
+			slog.Info("reindex running", "job", run.job.ID, "steps", run.job.Steps, "from", run.job.LastID)
+			throttle := time.Duration(run.job.ThrottleMS) * time.Millisecond
+			for {
+				more, err := run.batch(context.Background())
+				if err != nil {
+					run.fail(err)
+					break
+				}
+				if !more {
+					break
+				}
+				time.Sleep(throttle)
+			}
+		}
+		db.Close()
+	}
+}
+
+// reindexHandler serves the reindex admin API:
+//
+//	GET    /admin/reindex          progress of the latest job
+//	POST   /admin/reindex          start a job ({"steps": [...], "batch_size": 500, "throttle": "100ms"})
+//	POST   /admin/reindex/pause    pause the running job after its current batch
+//	POST   /admin/reindex/resume   resume a paused or failed job where it stopped
+//	DELETE /admin/reindex          cancel the unfinished job
+func reindexHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/reindex"), "/")
+
+	var req ReindexRequest
+	var job ReindexJob
+	if action == "" && r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if job, err = req.job(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	var found *ReindexJob
+	status := http.StatusOK
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		found, err = latestReindex(db)
+	case action == "" && r.Method == http.MethodPost:
+		if err = startReindex(db, &job); err == errReindexUnfinished {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		found, status = &job, http.StatusAccepted
+	case action == "" && r.Method == http.MethodDelete:
+		found, err = setReindexStatus(db, "cancelled", "running", "paused", "failed")
+	case action == "pause" && r.Method == http.MethodPost:
+		found, err = setReindexStatus(db, "paused", "running")
+	case action == "resume" && r.Method == http.MethodPost:
+		found, err = setReindexStatus(db, "running", "paused", "failed")
+	case action == "" || action == "pause" || action == "resume":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("reindex request failed", "error", err)
+		http.Error(w, "Reindex request failed", http.StatusInternalServerError)
+		return
+	}
+	if found == nil {
+		http.Error(w, "No reindex job to act on", http.StatusNotFound)
+		return
+	}
+	if found.Status == "running" {
+		select {
+		case reindexWake <- struct{}{}:
+		default:
+		}
+	}
+
+	found.progress(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(found)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReindexRequestDefaults(t *testing.T) {
+	job, err := ReindexRequest{}.job()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.Steps) != 2 || job.Steps[0] != "search_vector" || job.Steps[1] != "tags" {
+		t.Errorf("Expected the cheap steps by default, got %v", job.Steps)
+	}
+	if job.BatchSize != defaultReindexBatch || job.ThrottleMS != 100 {
+		t.Errorf("Expected default batch and throttle, got %d and %dms", job.BatchSize, job.ThrottleMS)
+	}
+
+	job, err = ReindexRequest{Steps: []string{"embeddings"}, BatchSize: 50, Throttle: "1s"}.job()
+	if err != nil || job.BatchSize != 50 || job.ThrottleMS != 1000 {
+		t.Errorf("Expected the request's settings, got %+v (%v)", job, err)
+	}
+}
+
+func TestReindexRequestRejectsBadSettings(t *testing.T) {
+	for _, req := range []ReindexRequest{
+		{Steps: []string{"vectors"}},
+		{Steps: []string{"tags", "tags"}},
+		{BatchSize: -1},
+		{BatchSize: maxReindexBatch + 1},
+		{Throttle: "soon"},
+		{Throttle: "2h"},
+	} {
+		if _, err := req.job(); err == nil {
+			t.Errorf("Expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestReindexProgress(t *testing.T) {
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(100 * time.Second)
+
+	job := ReindexJob{Status: "running", Processed: 250, Total: 1000, CreatedAt: start}
+	job.progress(now)
+	if job.Percent != 25 || job.RowsPerSec != 2.5 {
+		t.Errorf("Expected 25%% at 2.5 rows/s, got %v%% at %v", job.Percent, job.RowsPerSec)
+	}
+	if job.ETA == nil || !job.ETA.Equal(now.Add(300*time.Second)) {
+		t.Errorf("Expected the remaining 750 rows in 300s, got %v", job.ETA)
+	}
+
+	// A paused job's rate stops at its last checkpoint and it has no ETA
+	job = ReindexJob{Status: "paused", Processed: 250, Total: 1000, CreatedAt: start, UpdatedAt: start.Add(50 * time.Second)}
+	job.progress(now)
+	if job.RowsPerSec != 5 || job.ETA != nil {
+		t.Errorf("Expected 5 rows/s and no ETA while paused, got %v and %v", job.RowsPerSec, job.ETA)
+	}
+
+	empty := ReindexJob{Status: "completed", CreatedAt: start, FinishedAt: &start}
+	empty.progress(now)
+	if empty.Percent != 100 {
+		t.Errorf("Expected a job over no rows to be complete, got %v%%", empty.Percent)
+	}
+}
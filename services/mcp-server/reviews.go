@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// Review scheduling follows SM-2: each review is graded 0–5. A grade below 3
+// restarts the item at a one-day interval; otherwise the interval grows
+// 1 day → 6 days → previous interval × ease factor. The ease factor starts
+// at 2.5, moves with every grade and never drops below 1.3.
+const (
+	initialEase = 2.5
+	minimumEase = 1.3
+)
+
+// ReviewState is the SM-2 scheduling state of one review item.
+type ReviewState struct {
+	EaseFactor   float64 `json:"ease_factor"`
+	IntervalDays int     `json:"interval_days"`
+	Repetitions  int     `json:"repetitions"`
+}
+
+// ReviewItem is a content item flagged for spaced repetition.
+type ReviewItem struct {
+	ID             string    `json:"id"`
+	ContentID      string    `json:"content_id"`
+	ContentSummary string    `json:"content_summary,omitempty"`
+	SourceURL      string    `json:"source_url,omitempty"`
+	DueAt          time.Time `json:"due_at"`
+	ReviewState
+}
+
+// nextReview grades a review and returns the updated state.
+func nextReview(s ReviewState, quality int) ReviewState {
+	if quality < 3 {
+		s.Repetitions = 0
+		s.IntervalDays = 1
+	} else {
+		switch s.Repetitions {
+		case 0:
+			s.IntervalDays = 1
+		case 1:
+			s.IntervalDays = 6
+		default:
+			s.IntervalDays = int(math.Round(float64(s.IntervalDays) * s.EaseFactor))
+		}
+		s.Repetitions++
+	}
+
+	q := float64(5 - quality)
+	s.EaseFactor = math.Max(minimumEase, s.EaseFactor+0.1-q*(0.08+q*0.02))
+	return s
+}
+
+// flagForReview schedules content for its first review tomorrow. Flagging an
+// item that is already scheduled leaves its schedule unchanged.
+func flagForReview(db *sql.DB, workspace, userID, contentID string) (time.Time, error) {
+	var dueAt time.Time
+	err := db.QueryRow(`
+		INSERT INTO review_items (user_id, content_id, ease_factor, due_at)
+		SELECT $1, id, $3, now() + INTERVAL '1 day'
+		FROM content_metadata WHERE id = $2 AND workspace_id = $4
+		ON CONFLICT (user_id, content_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING due_at`, userID, contentID, initialEase, workspace).Scan(&dueAt)
+	if err == sql.ErrNoRows {
+		return dueAt, errContentNotFound
+	}
+	if err != nil {
+		return dueAt, fmt.Errorf("failed to flag for review: %v", err)
+	}
+	return dueAt, nil
+}
+
+// dueReviews lists the workspace's items due by the end of today, most
+// overdue first.
+func dueReviews(db *sql.DB, workspace, userID string, limit int) ([]ReviewItem, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.content_id, c.content_summary, c.source_url, r.due_at,
+		       r.ease_factor, r.interval_days, r.repetitions
+		FROM review_items r
+		JOIN content_metadata c ON c.id = r.content_id
+		WHERE r.user_id = $1 AND c.workspace_id = $3 AND r.due_at < date_trunc('day', now()) + INTERVAL '1 day'
+		ORDER BY r.due_at
+		LIMIT $2`, userID, limit, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load due reviews: %v", err)
+	}
+	defer rows.Close()
+
+	items := []ReviewItem{}
+	for rows.Next() {
+		var item ReviewItem
+		if err := rows.Scan(&item.ID, &item.ContentID, &item.ContentSummary, &item.SourceURL, &item.DueAt,
+			&item.EaseFactor, &item.IntervalDays, &item.Repetitions); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// recordReview grades a review, reschedules the item and, when it was
+// recalled, counts it towards learning progress like a read.
+func recordReview(db *sql.DB, userID, contentID string, quality int) (ReviewItem, error) {
+	item := ReviewItem{ContentID: contentID}
+	err := db.QueryRow(`
+		SELECT id, ease_factor, interval_days, repetitions
+		FROM review_items WHERE user_id = $1 AND content_id = $2`,
+		userID, contentID).Scan(&item.ID, &item.EaseFactor, &item.IntervalDays, &item.Repetitions)
+	if err == sql.ErrNoRows {
+		return item, fmt.Errorf("content %s is not flagged for review", contentID)
+	}
+	if err != nil {
+		return item, fmt.Errorf("failed to load review: %v", err)
+	}
+
+	item.ReviewState = nextReview(item.ReviewState, quality)
+	item.DueAt = time.Now().AddDate(0, 0, item.IntervalDays)
+
+	_, err = db.Exec(`
+		UPDATE review_items
+		SET ease_factor = $2, interval_days = $3, repetitions = $4, due_at = $5, last_reviewed_at = now()
+		WHERE id = $1`, item.ID, item.EaseFactor, item.IntervalDays, item.Repetitions, item.DueAt)
+	if err != nil {
+		return item, fmt.Errorf("failed to reschedule review: %v", err)
+	}
+
+	if quality >= 3 {
+		_, err = db.Exec(`
+			INSERT INTO content_interactions (user_id, content_id, interaction_type, rating)
+			VALUES ($1, $2, 'reviewed', NULL)`, userID, contentID)
+		if err != nil {
+			slog.Error("failed to record review interaction", "content_id", contentID, "error", err)
+		}
+	}
+
+	return item, nil
+}
+
+// ReviewRequest is the body of POST /reviews. Without a quality it flags the
+// content for review; with one it records a review outcome.
+type ReviewRequest struct {
+	UserID    string `json:"user_id,omitempty"`
+	ContentID string `json:"content_id"`
+	Quality   *int   `json:"quality,omitempty"` // 0 (forgot) – 5 (perfect recall)
+}
+
+// reviewsHandler serves GET (due reviews) and POST (flag or grade) on
+// /reviews.
+func reviewsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			userID = defaultUserID
+		}
+		limit := 20
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+		items, err := dueReviews(db, requestWorkspace(r), userID, limit)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("review request failed", "error", err)
+			http.Error(w, "Failed to load reviews", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "due": items})
+		return
+	}
+
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = defaultUserID
+	}
+	if !uuidPattern.MatchString(req.ContentID) {
+		http.Error(w, "content_id must be a content UUID", http.StatusBadRequest)
+		return
+	}
+
+	if req.Quality == nil {
+		dueAt, err := flagForReview(db, requestWorkspace(r), req.UserID, req.ContentID)
+		if err == errContentNotFound {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("review request failed", "error", err)
+			http.Error(w, "Failed to flag for review", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"content_id": req.ContentID, "due_at": dueAt})
+		return
+	}
+
+	if *req.Quality < 0 || *req.Quality > 5 {
+		http.Error(w, "quality must be between 0 and 5", http.StatusBadRequest)
+		return
+	}
+	item, err := recordReview(db, req.UserID, req.ContentID, *req.Quality)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(item)
+}
+
+func handleFlagForReview(args map[string]interface{}) MCPResponse {
+	contentID, _ := args["content_id"].(string)
+	if !uuidPattern.MatchString(contentID) {
+		return errorResponse("content_id must be a content UUID")
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	dueAt, err := flagForReview(db, workspaceArg(args), defaultUserID, contentID)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: fmt.Sprintf("🗓️ Content %s is scheduled for review on %s", contentID, dueAt.Format("2006-01-02")),
+		}},
+	}
+}
+
+func handleGetDueReviews(args map[string]interface{}) MCPResponse {
+	limit := 10
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	items, err := dueReviews(db, workspaceArg(args), defaultUserID, limit)
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var responseText strings.Builder
+	if len(items) == 0 {
+		responseText.WriteString("🎉 Nothing is due for review today.")
+	} else {
+		responseText.WriteString(fmt.Sprintf("🧠 **%d items due for review**\n\n", len(items)))
+	}
+	for i, item := range items {
+		responseText.WriteString(fmt.Sprintf("**%d.** %s\n", i+1, item.ContentSummary))
+		responseText.WriteString(fmt.Sprintf("   • ID: %s\n", item.ContentID))
+		responseText.WriteString(fmt.Sprintf("   • URL: %s\n", item.SourceURL))
+		responseText.WriteString(fmt.Sprintf("   • Due: %s (reviewed %d times)\n\n", item.DueAt.Format("2006-01-02"), item.Repetitions))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
+
+func handleRecordReview(args map[string]interface{}) MCPResponse {
+	contentID, _ := args["content_id"].(string)
+	if !uuidPattern.MatchString(contentID) {
+		return errorResponse("content_id must be a content UUID")
+	}
+	q, ok := args["quality"].(float64)
+	if !ok || q < 0 || q > 5 {
+		return errorResponse("quality must be between 0 and 5")
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	item, err := recordReview(db, defaultUserID, contentID, int(q))
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: fmt.Sprintf("✅ Review recorded. Next review in %d days (%s).", item.IntervalDays, item.DueAt.Format("2006-01-02")),
+		}},
+	}
+}
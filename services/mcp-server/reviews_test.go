@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestNextReviewIntervals(t *testing.T) {
+	s := ReviewState{EaseFactor: initialEase}
+
+	s = nextReview(s, 4)
+	if s.IntervalDays != 1 || s.Repetitions != 1 {
+		t.Fatalf("Expected first review after 1 day, got %+v", s)
+	}
+	s = nextReview(s, 4)
+	if s.IntervalDays != 6 || s.Repetitions != 2 {
+		t.Fatalf("Expected second review after 6 days, got %+v", s)
+	}
+	s = nextReview(s, 4)
+	if s.IntervalDays != 15 {
+		t.Fatalf("Expected third interval of 6 × 2.5 = 15 days, got %+v", s)
+	}
+}
+
+func TestNextReviewLapse(t *testing.T) {
+	s := ReviewState{EaseFactor: initialEase, IntervalDays: 15, Repetitions: 3}
+
+	s = nextReview(s, 1)
+	if s.IntervalDays != 1 || s.Repetitions != 0 {
+		t.Errorf("Expected a lapse to restart the schedule, got %+v", s)
+	}
+	if s.EaseFactor >= initialEase {
+		t.Errorf("Expected a lapse to lower the ease factor, got %.2f", s.EaseFactor)
+	}
+}
+
+func TestNextReviewEaseFloor(t *testing.T) {
+	s := ReviewState{EaseFactor: initialEase}
+	for i := 0; i < 20; i++ {
+		s = nextReview(s, 0)
+	}
+	if s.EaseFactor != minimumEase {
+		t.Errorf("Expected ease factor to bottom out at %.1f, got %.2f", minimumEase, s.EaseFactor)
+	}
+
+	perfect := nextReview(ReviewState{EaseFactor: initialEase}, 5)
+	if perfect.EaseFactor <= initialEase {
+		t.Errorf("Expected perfect recall to raise the ease factor, got %.2f", perfect.EaseFactor)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"selin/internal/search"
+)
+
+// ContentRevision is one update of a content item: the values the changed
+// fields had before it, recorded by the content_metadata trigger.
+type ContentRevision struct {
+	ID        int64                  `json:"id"`
+	ChangedBy string                 `json:"changed_by"`
+	ChangedAt time.Time              `json:"changed_at"`
+	Changes   []FieldChange          `json:"changes"`
+	previous  map[string]interface{} // as stored, before Changes is filled in
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// fillChanges works out each revision's new values. Revisions are newest
+// first, so the values after the newest are the current row's and each
+// older revision's are what the next one replaced.
+func fillChanges(current map[string]interface{}, revisions []ContentRevision) {
+	state := make(map[string]interface{}, len(current))
+	for k, v := range current {
+		state[k] = v
+	}
+	for i := range revisions {
+		fields := make([]string, 0, len(revisions[i].previous))
+		for field := range revisions[i].previous {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		revisions[i].Changes = []FieldChange{}
+		for _, field := range fields {
+			from := revisions[i].previous[field]
+			revisions[i].Changes = append(revisions[i].Changes, FieldChange{Field: field, From: from, To: state[field]})
+			state[field] = from
+		}
+	}
+}
+
+// contentRevisions returns an item's revisions, newest first, or
+// search.ErrNotFound when the item is not in the workspace.
+func contentRevisions(ctx context.Context, db *sql.DB, workspace, id string, limit int) (*search.Item, []ContentRevision, error) {
+	item, err := search.Get(ctx, db, workspace, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var raw []byte
+	if err := db.QueryRowContext(ctx,
+		`SELECT to_jsonb(c) FROM content_metadata c WHERE id = $1`, id).Scan(&raw); err != nil {
+		return nil, nil, err
+	}
+	var current map[string]interface{}
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, previous, changed_by, changed_at FROM content_revisions
+		WHERE content_id = $1
+		ORDER BY changed_at DESC, id DESC
+		LIMIT $2`, id, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load revisions: %v", err)
+	}
+	defer rows.Close()
+
+	revisions := []ContentRevision{}
+	for rows.Next() {
+		var rev ContentRevision
+		var previous []byte
+		if err := rows.Scan(&rev.ID, &previous, &rev.ChangedBy, &rev.ChangedAt); err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal(previous, &rev.previous); err != nil {
+			return nil, nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	fillChanges(current, revisions)
+	return item, revisions, nil
+}
+
+func handleGetContentRevisions(args map[string]interface{}) MCPResponse {
+	contentID, _ := args["content_id"].(string)
+	if contentID == "" {
+		return errorResponse("content_id is required")
+	}
+	limit := 20
+	if l, ok := args["limit"].(float64); ok && l > 0 && l <= 100 {
+		limit = int(l)
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	item, revisions, err := contentRevisions(contextArg(args), db, workspaceArg(args), contentID, limit)
+	if err == search.ErrNotFound {
+		return errorResponse("Content not found: " + contentID)
+	}
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	var responseText strings.Builder
+	responseText.WriteString(fmt.Sprintf("📜 **Revision History** for %s\n\n", item.ContentSummary))
+	if len(revisions) == 0 {
+		responseText.WriteString("No changes since it was collected.")
+	}
+	for _, rev := range revisions {
+		responseText.WriteString(fmt.Sprintf("**%s** by %s\n", rev.ChangedAt.Format("2006-01-02 15:04"), rev.ChangedBy))
+		for _, c := range rev.Changes {
+			responseText.WriteString(fmt.Sprintf("   • %s: %v → %v\n", c.Field, c.From, c.To))
+		}
+		responseText.WriteString("\n")
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFillChanges(t *testing.T) {
+	current := map[string]interface{}{"relevance_score": 0.9, "tags": []interface{}{"go"}, "author": "alice"}
+	revisions := []ContentRevision{
+		{ID: 2, previous: map[string]interface{}{"relevance_score": 0.6}},
+		{ID: 1, previous: map[string]interface{}{"relevance_score": 0.4, "tags": []interface{}{}}},
+	}
+
+	fillChanges(current, revisions)
+
+	if want := []FieldChange{{Field: "relevance_score", From: 0.6, To: 0.9}}; !reflect.DeepEqual(revisions[0].Changes, want) {
+		t.Errorf("Newest revision: expected %v, got %v", want, revisions[0].Changes)
+	}
+	want := []FieldChange{
+		{Field: "relevance_score", From: 0.4, To: 0.6},
+		{Field: "tags", From: []interface{}{}, To: []interface{}{"go"}},
+	}
+	if !reflect.DeepEqual(revisions[1].Changes, want) {
+		t.Errorf("Oldest revision: expected %v, got %v", want, revisions[1].Changes)
+	}
+	if current["relevance_score"] != 0.9 {
+		t.Error("Expected the current row to be left unchanged")
+	}
+}
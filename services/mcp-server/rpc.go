@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var rpcNullID = json.RawMessage("null")
+
+func rpcFailure(id json.RawMessage, code int, message string) *rpcResponse {
+	if id == nil {
+		id = rpcNullID
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+// rpcHandler serves POST /mcp/rpc, the MCP methods tools/list and
+// tools/call (and ping) over JSON-RPC 2.0. A batch, a JSON array of
+// requests, runs its tool calls concurrently with one shared deadline, as
+// /mcp/call/batch does, and is answered in the same order. Notifications,
+// requests without an id, get no answer.
+func rpcHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeRPC(w, rpcFailure(nil, rpcParseError, "Parse error"))
+		return
+	}
+
+	batch := bytes.HasPrefix(bytes.TrimSpace(raw), []byte("["))
+	var entries []json.RawMessage
+	if !batch {
+		entries = []json.RawMessage{raw}
+	} else if err := json.Unmarshal(raw, &entries); err != nil || len(entries) == 0 {
+		writeRPC(w, rpcFailure(nil, rpcInvalidRequest, "Invalid Request"))
+		return
+	} else if len(entries) > maxBatchCalls {
+		writeRPC(w, rpcFailure(nil, rpcInvalidRequest, fmt.Sprintf("Batches may hold at most %d requests", maxBatchCalls)))
+		return
+	}
+
+	responses := make([]*rpcResponse, len(entries))
+	requests := make([]rpcRequest, len(entries))
+	var calls []MCPRequest
+	var callIndex []int
+	for i, entry := range entries {
+		req := &requests[i]
+		if err := json.Unmarshal(entry, req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+			responses[i] = rpcFailure(nil, rpcInvalidRequest, "Invalid Request")
+			continue
+		}
+		switch req.Method {
+		case "ping":
+			responses[i] = &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: struct{}{}}
+		case "tools/list":
+			responses[i] = &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{
+				"tools": tools.list(),
+			}}
+		case "tools/call":
+			var call MCPRequest
+			if err := json.Unmarshal(req.Params, &call); err != nil || call.Name == "" {
+				responses[i] = rpcFailure(req.ID, rpcInvalidParams, "params must be {\"name\": ..., \"arguments\": {...}}")
+				continue
+			}
+			calls = append(calls, call)
+			callIndex = append(callIndex, i)
+		default:
+			responses[i] = rpcFailure(req.ID, rpcMethodNotFound, "Method not found: "+req.Method)
+		}
+	}
+	if len(calls) > 0 {
+		for j, result := range runBatch(r, calls, batchTimeout()) {
+			i := callIndex[j]
+			responses[i] = &rpcResponse{JSONRPC: "2.0", ID: requests[i].ID, Result: result}
+		}
+	}
+
+	// Notifications are run but not answered
+	var answers []*rpcResponse
+	for i, resp := range responses {
+		if requests[i].ID == nil && resp.Error == nil {
+			continue
+		}
+		answers = append(answers, resp)
+	}
+	switch {
+	case len(answers) == 0:
+		w.WriteHeader(http.StatusNoContent)
+	case !batch:
+		writeRPC(w, answers[0])
+	default:
+		writeRPC(w, answers)
+	}
+}
+
+func writeRPC(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func rpc(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	rpcHandler(w, httptest.NewRequest("POST", "/mcp/rpc", strings.NewReader(body)))
+	return w
+}
+
+func TestRPCSingleRequest(t *testing.T) {
+	w := rpc(t, `{"jsonrpc": "2.0", "id": 7, "method": "tools/list"}`)
+	var resp struct {
+		ID     int `json:"id"`
+		Result struct {
+			Tools []MCPTool `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 7 || len(resp.Result.Tools) != len(tools.list()) {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	w := rpc(t, `[
+		{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "search_content", "arguments": {}}},
+		{"jsonrpc": "2.0", "method": "tools/call", "params": {"name": "no_such_tool"}},
+		{"jsonrpc": "2.0", "id": "two", "method": "ping"},
+		{"jsonrpc": "2.0", "id": 3, "method": "resources/list"},
+		{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {}},
+		{"id": 5}
+	]`)
+	var resps []struct {
+		ID     json.RawMessage `json:"id"`
+		Result *MCPResponse    `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resps); err != nil {
+		t.Fatal(err)
+	}
+	// The notification gets no answer; the rest answer in order
+	if len(resps) != 5 {
+		t.Fatalf("Expected 5 responses, got %d", len(resps))
+	}
+	if string(resps[0].ID) != "1" || resps[0].Result == nil || !strings.Contains(resps[0].Result.Content[0].Text, "Query parameter is required") {
+		t.Errorf("Unexpected tool call response: %s %+v", resps[0].ID, resps[0].Result)
+	}
+	if string(resps[1].ID) != `"two"` || resps[1].Error != nil {
+		t.Errorf("Unexpected ping response: %s %+v", resps[1].ID, resps[1].Error)
+	}
+	for i, code := range map[int]int{2: rpcMethodNotFound, 3: rpcInvalidParams, 4: rpcInvalidRequest} {
+		if resps[i].Error == nil || resps[i].Error.Code != code {
+			t.Errorf("Response %d: expected error %d, got %+v", i, code, resps[i].Error)
+		}
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{not json`, rpcParseError},
+		{`[]`, rpcInvalidRequest},
+		{`[` + strings.Repeat(`{"jsonrpc": "2.0", "id": 1, "method": "ping"},`, maxBatchCalls) + `{"jsonrpc": "2.0", "id": 1, "method": "ping"}]`, rpcInvalidRequest},
+	}
+	for _, tt := range tests {
+		var resp rpcResponse
+		if err := json.NewDecoder(rpc(t, tt.body).Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error == nil || resp.Error.Code != tt.code || string(resp.ID) != "null" {
+			t.Errorf("%.20s: expected error %d, got %+v", tt.body, tt.code, resp)
+		}
+	}
+
+	if w := rpc(t, `{"jsonrpc": "2.0", "method": "ping"}`); w.Code != 204 {
+		t.Errorf("Expected a lone notification to get 204, got %d", w.Code)
+	}
+}
@@ -31,6 +31,10 @@ logger = logging.getLogger("selin-mcp")
 # Selin API configuration
 SELIN_API_BASE = os.getenv("SELIN_API_BASE", "http://localhost:8084")
 
+# Tools exposed to Claude under a different name than the Go server uses
+TOOL_ALIASES = {"search_content": "search_selin_content"}
+TOOL_NAMES = {alias: name for name, alias in TOOL_ALIASES.items()}
+
 class SelinMCPServer:
     def __init__(self):
         self.server = Server("selin")
@@ -39,85 +43,19 @@ class SelinMCPServer:
     def setup_handlers(self):
         @self.server.list_tools()
         async def list_tools() -> List[Tool]:
-            """List available Selin tools for Claude"""
+            """List available Selin tools for Claude, as advertised by the Go server"""
+            async with httpx.AsyncClient() as client:
+                response = await client.get(f"{SELIN_API_BASE}/mcp/tools", timeout=30.0)
+                response.raise_for_status()
+                tools = response.json()["tools"]
+
             return [
                 Tool(
-                    name="search_selin_content",
-                    description="Search Selin's knowledge base for content related to Go, blockchain, or cryptography",
-                    inputSchema={
-                        "type": "object",
-                        "properties": {
-                            "query": {
-                                "type": "string",
-                                "description": "Search query (e.g., 'golang concurrency', 'cosmos blockchain')"
-                            },
-                            "limit": {
-                                "type": "number",
-                                "description": "Maximum number of results to return",
-                                "default": 10
-                            },
-                            "platform": {
-                                "type": "string", 
-                                "description": "Filter by source platform",
-                                "enum": ["reddit", "slack", "file_upload", "all"],
-                                "default": "all"
-                            }
-                        },
-                        "required": ["query"]
-                    }
-                ),
-                Tool(
-                    name="get_learning_progress",
-                    description="Get the user's learning progress for specific topics",
-                    inputSchema={
-                        "type": "object",
-                        "properties": {
-                            "topic": {
-                                "type": "string",
-                                "description": "Learning topic (e.g., 'golang', 'blockchain', 'cryptography')"
-                            }
-                        },
-                        "required": ["topic"]
-                    }
-                ),
-                Tool(
-                    name="get_recent_content", 
-                    description="Get recently collected content from Selin's knowledge base",
-                    inputSchema={
-                        "type": "object",
-                        "properties": {
-                            "hours": {
-                                "type": "number",
-                                "description": "Number of hours back to look",
-                                "default": 24
-                            },
-                            "platform": {
-                                "type": "string",
-                                "description": "Filter by source platform", 
-                                "enum": ["reddit", "slack", "file_upload", "all"],
-                                "default": "all"
-                            }
-                        }
-                    }
-                ),
-                Tool(
-                    name="analyze_content_trends",
-                    description="Analyze trends in collected content and learning topics",
-                    inputSchema={
-                        "type": "object", 
-                        "properties": {
-                            "days": {
-                                "type": "number",
-                                "description": "Number of days to analyze",
-                                "default": 7
-                            },
-                            "topic": {
-                                "type": "string",
-                                "description": "Focus on specific topic"
-                            }
-                        }
-                    }
+                    name=TOOL_ALIASES.get(tool["name"], tool["name"]),
+                    description=tool["description"],
+                    inputSchema=tool["inputSchema"],
                 )
+                for tool in tools
             ]
 
         @self.server.call_tool()
@@ -126,17 +64,7 @@ class SelinMCPServer:
             logger.info(f"Tool called: {name} with arguments: {arguments}")
             
             try:
-                if name == "search_selin_content":
-                    result = await self.search_content(arguments)
-                elif name == "get_learning_progress":
-                    result = await self.get_learning_progress(arguments)
-                elif name == "get_recent_content":
-                    result = await self.get_recent_content(arguments)
-                elif name == "analyze_content_trends":
-                    result = await self.analyze_trends(arguments)
-                else:
-                    raise ValueError(f"Unknown tool: {name}")
-                
+                result = await self.call_selin(TOOL_NAMES.get(name, name), arguments)
                 return CallToolResult(content=[TextContent(type="text", text=result)])
                 
             except Exception as e:
@@ -146,60 +74,12 @@ class SelinMCPServer:
                     isError=True
                 )
 
-    async def search_content(self, args: Dict[str, Any]) -> str:
-        """Search Selin's content database"""
-        async with httpx.AsyncClient() as client:
-            response = await client.post(
-                f"{SELIN_API_BASE}/mcp/call",
-                json={"name": "search_content", "arguments": args},
-                timeout=30.0
-            )
-            response.raise_for_status()
-            data = response.json()
-            
-            if data.get("isError"):
-                raise Exception(data["content"][0]["text"])
-            
-            return data["content"][0]["text"]
-
-    async def get_learning_progress(self, args: Dict[str, Any]) -> str:
-        """Get learning progress from Selin"""
-        async with httpx.AsyncClient() as client:
-            response = await client.post(
-                f"{SELIN_API_BASE}/mcp/call",
-                json={"name": "get_learning_progress", "arguments": args},
-                timeout=30.0
-            )
-            response.raise_for_status()
-            data = response.json()
-            
-            if data.get("isError"):
-                raise Exception(data["content"][0]["text"])
-            
-            return data["content"][0]["text"]
-
-    async def get_recent_content(self, args: Dict[str, Any]) -> str:
-        """Get recent content from Selin"""
-        async with httpx.AsyncClient() as client:
-            response = await client.post(
-                f"{SELIN_API_BASE}/mcp/call", 
-                json={"name": "get_recent_content", "arguments": args},
-                timeout=30.0
-            )
-            response.raise_for_status()
-            data = response.json()
-            
-            if data.get("isError"):
-                raise Exception(data["content"][0]["text"])
-            
-            return data["content"][0]["text"]
-
-    async def analyze_trends(self, args: Dict[str, Any]) -> str:
-        """Analyze content trends in Selin"""
+    async def call_selin(self, name: str, args: Dict[str, Any]) -> str:
+        """Forward a tool call to the Selin MCP server"""
         async with httpx.AsyncClient() as client:
             response = await client.post(
                 f"{SELIN_API_BASE}/mcp/call",
-                json={"name": "analyze_content_trends", "arguments": args},
+                json={"name": name, "arguments": args},
                 timeout=30.0
             )
             response.raise_for_status()
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"selin/internal/adminauth"
+	"selin/internal/events"
+	"selin/internal/logging"
+)
+
+// content_stats_daily holds each day's content counts per platform (with
+// an empty tag) and per platform and tag, so trend queries read one row per
+// day instead of scanning content. runStatsSnapshots rebuilds everything at
+// startup and then the last statsLookbackDays days on every run, since
+// those are the days still receiving content.
+const statsLookbackDays = 3
+
+type PlatformTrend struct {
+	Platform     string  `json:"platform"`
+	Items        int     `json:"items"`
+	AvgRelevance float64 `json:"avg_relevance"`
+}
+
+// TagTrend compares a tag's items in the period with the one before it.
+type TagTrend struct {
+	Tag      string `json:"tag"`
+	Items    int    `json:"items"`
+	Previous int    `json:"previous"`
+}
+
+// snapshotContentStats rewrites the stats of every day from since on. A zero
+// since rebuilds the whole table.
+func snapshotContentStats(db *sql.DB, since time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	day := since.Format("2006-01-02")
+	if _, err := tx.Exec(`DELETE FROM content_stats_daily WHERE day >= $1::date`, day); err != nil {
+		return fmt.Errorf("failed to clear content stats: %v", err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO content_stats_daily (workspace_id, day, source_platform, tag, items, scored_items, relevance_sum)
+		SELECT workspace_id, collection_date::date, COALESCE(source_platform, 'unknown'), '',
+		       COUNT(*), COUNT(relevance_score), COALESCE(SUM(relevance_score), 0)
+		FROM content_metadata
+		WHERE collection_date >= $1::date
+		GROUP BY 1, 2, 3
+		UNION ALL
+		SELECT workspace_id, collection_date::date, COALESCE(source_platform, 'unknown'), tag,
+		       COUNT(*), COUNT(relevance_score), COALESCE(SUM(relevance_score), 0)
+		FROM content_metadata, unnest(tags) AS tag
+		WHERE collection_date >= $1::date
+		GROUP BY 1, 2, 3, 4`, day); err != nil {
+		return fmt.Errorf("failed to snapshot content stats: %v", err)
+	}
+	return tx.Commit()
+}
+
+// rebuildContentStats recomputes every day after changes to old content,
+// such as tag merges.
+func rebuildContentStats(db *sql.DB) {
+	if err := snapshotContentStats(db, time.Time{}); err != nil {
+		slog.Error("content stats rebuild failed", "error", err)
+	}
+}
+
+// statsSnapshotHandler snapshots the last statsLookbackDays days on POST,
+// for the scheduler's stats_snapshot job; ?full=true rebuilds every day.
+func statsSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	since := time.Now().AddDate(0, 0, -statsLookbackDays)
+	if r.URL.Query().Get("full") == "true" {
+		since = time.Time{}
+	}
+	if err := snapshotContentStats(db, since); err != nil {
+		logging.FromContext(r.Context()).Error("content stats snapshot failed", "error", err)
+		http.Error(w, "Snapshot failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "full": since.IsZero()})
+}
+
+// statsEventDelay is how long a snapshot waits after new content is
+// announced, so a burst of items is counted in one run.
+const statsEventDelay = 30 * time.Second
+
+// watchContentEvents signals changed whenever the bus announces new content
+// or a processed upload, until ctx is done.
+func watchContentEvents(ctx context.Context, bus events.Bus, changed chan<- struct{}) {
+	err := bus.Subscribe(ctx, func(events.Event) {
+		select {
+		case changed <- struct{}{}:
+		default: // a snapshot is already due
+		}
+	}, events.ContentCreated, events.UploadCompleted)
+	if err != nil {
+		slog.Error("event bus subscription failed", "error", err)
+	}
+}
+
+// watchEmbeddings records when the vector generator announces an item's
+// embedding stored, which takes the item off the embedding backlog, until
+// ctx is done.
+func watchEmbeddings(ctx context.Context, bus events.Bus, db *sql.DB) {
+	err := bus.Subscribe(ctx, func(e events.Event) {
+		var embedding events.Embedding
+		if err := e.Decode(&embedding); err != nil {
+			slog.Warn("invalid embedding event", "error", err)
+			return
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE content_metadata SET embedded_at = now() WHERE id::text = $1 AND workspace_id = $2`,
+			embedding.ContentID, e.Workspace); err != nil {
+			slog.Error("failed to record embedding", "content_id", embedding.ContentID, "error", err)
+		}
+	}, events.EmbeddingReady)
+	if err != nil {
+		slog.Error("event bus subscription failed", "error", err)
+	}
+}
+
+// runStatsSnapshots snapshots every interval, and soon after a signal on
+// changed when there is an event bus.
+func runStatsSnapshots(interval time.Duration, changed <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var since time.Time // rebuild everything on the first run
+	for {
+		db, err := getDBConnection()
+		if err != nil {
+			slog.Error("content stats snapshot failed", "error", err)
+		} else {
+			if err := snapshotContentStats(db, since); err != nil {
+				slog.Error("content stats snapshot failed", "error", err)
+			} else {
+				since = time.Now().AddDate(0, 0, -statsLookbackDays)
+			}
+			db.Close()
+		}
+		select {
+		case <-ticker.C:
+		case <-changed:
+			time.Sleep(statsEventDelay)
+			select {
+			case <-changed: // already counted by this run
+			default:
+			}
+		}
+	}
+}
+
+func platformTrends(db *sql.DB, workspace string, days int) ([]PlatformTrend, error) {
+	rows, err := db.Query(`
+		SELECT source_platform, SUM(items), COALESCE(SUM(relevance_sum) / NULLIF(SUM(scored_items), 0), 0)
+		FROM content_stats_daily
+		WHERE workspace_id = $1 AND tag = '' AND day > current_date - $2::int
+		GROUP BY source_platform
+		ORDER BY 2 DESC, source_platform`, workspace, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trends := []PlatformTrend{}
+	for rows.Next() {
+		var t PlatformTrend
+		if err := rows.Scan(&t.Platform, &t.Items, &t.AvgRelevance); err != nil {
+			return nil, err
+		}
+		trends = append(trends, t)
+	}
+	return trends, rows.Err()
+}
+
+// tagTrends returns the busiest tags of the last days days with their
+// count in the days before.
+func tagTrends(db *sql.DB, workspace string, days, limit int) ([]TagTrend, error) {
+	rows, err := db.Query(`
+		SELECT tag,
+		       COALESCE(SUM(items) FILTER (WHERE day > current_date - $2::int), 0) AS items,
+		       COALESCE(SUM(items) FILTER (WHERE day <= current_date - $2::int), 0) AS previous
+		FROM content_stats_daily
+		WHERE workspace_id = $1 AND tag <> '' AND day > current_date - 2 * $2::int
+		GROUP BY tag
+		HAVING SUM(items) FILTER (WHERE day > current_date - $2::int) > 0
+		ORDER BY items DESC, tag
+		LIMIT $3`, workspace, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trends := []TagTrend{}
+	for rows.Next() {
+		var t TagTrend
+		if err := rows.Scan(&t.Tag, &t.Items, &t.Previous); err != nil {
+			return nil, err
+		}
+		trends = append(trends, t)
+	}
+	return trends, rows.Err()
+}
+
+// tagSeries returns one tag's items per day, oldest first, with empty days
+// included.
+func tagSeries(db *sql.DB, workspace, tag string, days int) ([]VolumePoint, error) {
+	rows, err := db.Query(`
+		SELECT d::date, COALESCE(SUM(s.items), 0),
+		       COALESCE(SUM(s.relevance_sum) / NULLIF(SUM(s.scored_items), 0), 0)
+		FROM generate_series(current_date - ($3::int - 1), current_date, interval '1 day') AS d
+		LEFT JOIN content_stats_daily s ON s.day = d::date AND s.workspace_id = $1 AND s.tag = $2
+		GROUP BY 1
+		ORDER BY 1`, workspace, tag, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []VolumePoint{}
+	for rows.Next() {
+		var p VolumePoint
+		var day time.Time
+		if err := rows.Scan(&day, &p.Items, &p.AvgRelevance); err != nil {
+			return nil, err
+		}
+		p.Day = day.Format("2006-01-02")
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// trendChange describes the change from previous to current, e.g. "+50%".
+func trendChange(current, previous int) string {
+	if previous == 0 {
+		return "new"
+	}
+	change := math.Round(float64(current-previous) / float64(previous) * 100)
+	if change == 0 {
+		return "steady"
+	}
+	return fmt.Sprintf("%+.0f%%", change)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"selin/internal/config"
+	"selin/internal/events"
+)
+
+func TestTrendChange(t *testing.T) {
+	tests := []struct {
+		current, previous int
+		want              string
+	}{
+		{5, 0, "new"},
+		{15, 10, "+50%"},
+		{5, 10, "-50%"},
+		{10, 10, "steady"},
+		{0, 4, "-100%"},
+	}
+	for _, tt := range tests {
+		if got := trendChange(tt.current, tt.previous); got != tt.want {
+			t.Errorf("trendChange(%d, %d) = %q, want %q", tt.current, tt.previous, got, tt.want)
+		}
+	}
+}
+
+func TestWatchContentEventsSignalsChanges(t *testing.T) {
+	bus := events.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go watchContentEvents(ctx, bus, changed)
+
+	embedded, _ := events.New(events.EmbeddingReady, "default", events.Embedding{ContentID: "c1"})
+	created, _ := events.New(events.ContentCreated, "default", events.Content{ID: "c1"})
+	// The subscription starts in the background, so publish until it hears
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		bus.Publish(ctx, embedded)
+		bus.Publish(ctx, created)
+		select {
+		case <-changed:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected content.created to signal a change")
+		}
+	}
+}
+
+func TestStatsSnapshotHandlerNeedsAdmin(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "secret")
+	config.Secrets().Reload()
+	for _, tt := range []struct {
+		method, token string
+		want          int
+	}{
+		{http.MethodGet, "secret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tt.method, "/admin/stats/snapshot", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		statsSnapshotHandler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s with token %q: expected %d, got %d", tt.method, tt.token, tt.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"selin/internal/adminauth"
+	"selin/internal/logging"
+	"selin/internal/tagging"
+)
+
+// TagChange is a bulk tag operation. Rename uses From[0].
+type TagChange struct {
+	From  []string `json:"from"`
+	To    string   `json:"to"`
+	Tag   string   `json:"tag"`
+	Alias bool     `json:"alias"` // keep the old tags as aliases of To
+}
+
+type TagAlias struct {
+	Alias string `json:"alias"`
+	Tag   string `json:"tag"`
+}
+
+// tagAdminHandler serves the workspace's bulk tag operations:
+//
+//	POST   /admin/tags/rename   {"from": ["k8s"], "to": "kubernetes", "alias": true}
+//	POST   /admin/tags/merge    {"from": ["k8s", "kube"], "to": "kubernetes"}
+//	POST   /admin/tags/delete   {"tag": "misc"}
+//	GET    /admin/tags/aliases
+//	PUT    /admin/tags/aliases  {"alias": "k8s", "tag": "kubernetes"}
+//	DELETE /admin/tags/aliases?alias=k8s
+func tagAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/tags"), "/")
+	if action == "aliases" {
+		tagAliasesHandler(w, r)
+		return
+	}
+	if action != "rename" && action != "merge" && action != "delete" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var change TagChange
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&change); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if action == "rename" && len(change.From) != 1 {
+		http.Error(w, "rename takes exactly one from tag", http.StatusBadRequest)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	workspace := requestWorkspace(r)
+	var updated int64
+	if action == "delete" {
+		updated, err = tagging.Delete(r.Context(), db, workspace, change.Tag)
+	} else {
+		updated, err = tagging.Merge(r.Context(), db, workspace, change.From, change.To, change.Alias)
+	}
+	if errors.Is(err, tagging.ErrInvalidTag) {
+		http.Error(w, "Tags must be non-empty and different", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("tag update failed", "action", action, "error", err)
+		http.Error(w, "Failed to update tags", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("updated tags", "action", action, "workspace", workspace, "updated", updated)
+	if updated > 0 {
+		rebuildContentStats(db)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"updated": updated})
+}
+
+func tagAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+	workspace := requestWorkspace(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		aliases, err := tagging.LoadAliases(r.Context(), db, workspace)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to load tag aliases", "error", err)
+			http.Error(w, "Failed to load aliases", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"aliases": sortedAliases(aliases)})
+
+	case http.MethodPut:
+		var a TagAlias
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&a); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		err := tagging.SetAlias(r.Context(), db, workspace, a.Alias, a.Tag)
+		if errors.Is(err, tagging.ErrInvalidTag) {
+			http.Error(w, "alias and tag must be non-empty and different", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to save tag alias", "error", err)
+			http.Error(w, "Failed to save alias", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		removed, err := tagging.DeleteAlias(r.Context(), db, workspace, r.URL.Query().Get("alias"))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to delete tag alias", "error", err)
+			http.Error(w, "Failed to delete alias", http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, "Alias not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func sortedAliases(aliases tagging.Aliases) []TagAlias {
+	list := make([]TagAlias, 0, len(aliases))
+	for alias, tag := range aliases {
+		list = append(list, TagAlias{Alias: alias, Tag: tag})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Alias < list[j].Alias })
+	return list
+}
+
+// stringList reads a tool argument given as a JSON array of strings.
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// tagChangeHandler is the handler of the rename_tag, merge_tags or
+// delete_tag tool.
+func tagChangeHandler(tool string) func(args map[string]interface{}) MCPResponse {
+	return func(args map[string]interface{}) MCPResponse {
+		return handleTagChange(tool, args)
+	}
+}
+
+// handleTagChange runs the rename_tag, merge_tags and delete_tag tools.
+func handleTagChange(tool string, args map[string]interface{}) MCPResponse {
+	addAlias, _ := args["add_alias"].(bool)
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	ctx, workspace := contextArg(args), workspaceArg(args)
+	var updated int64
+	var summary string
+	switch tool {
+	case "rename_tag":
+		from, _ := args["from"].(string)
+		to, _ := args["to"].(string)
+		updated, err = tagging.Rename(ctx, db, workspace, from, to, addAlias)
+		summary = fmt.Sprintf("Renamed **%s** to **%s**", tagging.Normalize(from), tagging.Normalize(to))
+	case "merge_tags":
+		from := stringList(args["tags"])
+		into, _ := args["into"].(string)
+		updated, err = tagging.Merge(ctx, db, workspace, from, into, addAlias)
+		summary = fmt.Sprintf("Merged %s into **%s**", strings.Join(from, ", "), tagging.Normalize(into))
+	case "delete_tag":
+		tag, _ := args["tag"].(string)
+		updated, err = tagging.Delete(ctx, db, workspace, tag)
+		summary = fmt.Sprintf("Deleted **%s**", tagging.Normalize(tag))
+	}
+	if errors.Is(err, tagging.ErrInvalidTag) {
+		return errorResponse("Tags must be non-empty and different")
+	}
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Failed to update tags: %v", err))
+	}
+	if updated > 0 {
+		rebuildContentStats(db)
+	}
+
+	text := fmt.Sprintf("🏷️ %s on %d items.", summary, updated)
+	if addAlias && tool != "delete_tag" {
+		text += "\nNew content will get the new tag too."
+	}
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: text,
+		}},
+	}
+}
+
+func handleSetTagAlias(args map[string]interface{}) MCPResponse {
+	alias, _ := args["alias"].(string)
+	tag, _ := args["tag"].(string)
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	err = tagging.SetAlias(contextArg(args), db, workspaceArg(args), alias, tag)
+	if errors.Is(err, tagging.ErrInvalidTag) {
+		return errorResponse("alias and tag must be non-empty and different")
+	}
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Failed to save alias: %v", err))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: fmt.Sprintf("🏷️ New content tagged **%s** will be tagged **%s** instead. Use merge_tags to update existing content.",
+				tagging.Normalize(alias), tagging.Normalize(tag)),
+		}},
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"selin/internal/config"
+)
+
+func TestTagAdminHandlerRequiresAdminKey(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "secret")
+	config.Secrets().Reload()
+
+	w := httptest.NewRecorder()
+	tagAdminHandler(w, httptest.NewRequest("POST", "/admin/tags/rename", strings.NewReader(`{"from":["k8s"],"to":"kubernetes"}`)))
+	if w.Code != 401 {
+		t.Errorf("Expected 401 without a key, got %d", w.Code)
+	}
+}
+
+func TestTagAdminHandlerValidatesRequests(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "secret")
+	config.Secrets().Reload()
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/admin/tags/unknown", `{}`, 404},
+		{"GET", "/admin/tags/rename", ``, 405},
+		{"POST", "/admin/tags/rename", `not json`, 400},
+		{"POST", "/admin/tags/rename", `{"from":["a","b"],"to":"c"}`, 400},
+		{"POST", "/admin/tags/aliases", `{}`, 405},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		tagAdminHandler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s %s: expected %d, got %d", tt.method, tt.path, tt.body, tt.want, w.Code)
+		}
+	}
+}
+
+func TestStringList(t *testing.T) {
+	got := stringList([]interface{}{"k8s", 3.0, "kube"})
+	if !reflect.DeepEqual(got, []string{"k8s", "kube"}) {
+		t.Errorf("Expected [k8s kube], got %v", got)
+	}
+	if stringList("k8s") != nil {
+		t.Error("Expected nil for a non-array")
+	}
+}
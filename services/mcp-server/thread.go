@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"selin/internal/links"
+)
+
+// threadDepths is how deep each message of a thread nests: 0 for messages
+// without a parent in the thread, one more than the parent otherwise.
+func threadDepths(thread []links.Message) map[string]int {
+	parents := make(map[string]string, len(thread))
+	for _, m := range thread {
+		parents[m.ID] = m.ParentID
+	}
+	depths := make(map[string]int, len(thread))
+	var depth func(id string, seen int) int
+	depth = func(id string, seen int) int {
+		if d, ok := depths[id]; ok {
+			return d
+		}
+		parent := parents[id]
+		// Links can form cycles; a message never nests deeper than the
+		// thread is long
+		if _, inThread := parents[parent]; parent == "" || !inThread || seen > len(thread) {
+			return 0
+		}
+		d := depth(parent, seen+1) + 1
+		depths[id] = d
+		return d
+	}
+	for _, m := range thread {
+		depths[m.ID] = depth(m.ID, 0)
+	}
+	return depths
+}
+
+func handleGetThread(args map[string]interface{}) MCPResponse {
+	contentID, _ := args["content_id"].(string)
+	if contentID == "" {
+		return errorResponse("content_id is required")
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Database connection failed: %v", err))
+	}
+	defer db.Close()
+
+	thread, err := links.Thread(contextArg(args), db, workspaceArg(args), contentID)
+	if err == links.ErrNotFound {
+		return errorResponse("Content not found: " + contentID)
+	}
+	if err != nil {
+		return errorResponse(fmt.Sprintf("Failed to load thread: %v", err))
+	}
+
+	depths := threadDepths(thread)
+	var responseText strings.Builder
+	responseText.WriteString(fmt.Sprintf("🧵 **Thread** (%d messages)\n\n", len(thread)))
+	for _, m := range thread {
+		indent := strings.Repeat("   ", depths[m.ID])
+		marker := ""
+		if strings.EqualFold(m.ID, contentID) {
+			marker = " ◀"
+		}
+		responseText.WriteString(fmt.Sprintf("%s**%s** (%s, %s)%s\n", indent, m.Author, m.SourcePlatform, m.Timestamp.Format("2006-01-02 15:04"), marker))
+		responseText.WriteString(fmt.Sprintf("%s%s\n\n", indent, m.ContentSummary))
+	}
+	if len(thread) == links.MaxThread {
+		responseText.WriteString(fmt.Sprintf("Showing the first %d messages.\n", links.MaxThread))
+	}
+
+	return MCPResponse{
+		Content: []MCPContent{{
+			Type: "text",
+			Text: responseText.String(),
+		}},
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"selin/internal/links"
+)
+
+func TestThreadDepths(t *testing.T) {
+	thread := []links.Message{
+		{ID: "root"},
+		{ID: "a", ParentID: "root"},
+		{ID: "b", ParentID: "a"},
+		{ID: "c", ParentID: "root"},
+		// Its parent was not returned, say past MaxThread
+		{ID: "d", ParentID: "missing"},
+	}
+	depths := threadDepths(thread)
+	for id, want := range map[string]int{"root": 0, "a": 1, "b": 2, "c": 1, "d": 0} {
+		if depths[id] != want {
+			t.Errorf("%s: expected depth %d, got %d", id, want, depths[id])
+		}
+	}
+}
+
+func TestThreadDepthsWithCycle(t *testing.T) {
+	thread := []links.Message{{ID: "a", ParentID: "b"}, {ID: "b", ParentID: "a"}}
+	depths := threadDepths(thread)
+	if depths["a"] > len(thread)+1 || depths["b"] > len(thread)+1 {
+		t.Errorf("Expected bounded depths for a cycle, got %v", depths)
+	}
+}
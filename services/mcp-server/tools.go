@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// toolConfig is the tools file named by MCP_TOOLS_FILE (see
+// config/tools.yaml): which of the built-in tools a deployment offers,
+// descriptions replacing the built-in ones and per-tool rate limits.
+type toolConfig struct {
+	// Enabled, when set, lists the only tools offered
+	Enabled []string `yaml:"enabled"`
+	// Disabled tools are not offered
+	Disabled     []string          `yaml:"disabled"`
+	Descriptions map[string]string `yaml:"descriptions"`
+	// RateLimits are calls per minute per caller, for tools that need a
+	// limit other than MCP_RATE_LIMIT
+	RateLimits map[string]int `yaml:"rate_limits"`
+}
+
+// toolRegistry holds the tools the server offers, in the order they are
+// listed. /mcp/tools, the OpenAI and JSON-RPC catalogs and every way of
+// calling a tool go through it, so a disabled tool is gone everywhere.
+type toolRegistry struct {
+	tools  []MCPTool
+	byName map[string]int
+}
+
+// tools is the registry in use; main replaces it with one configured from
+// MCP_TOOLS_FILE.
+var tools = mustRegistry(builtinTools(), toolConfig{})
+
+// newToolRegistry registers the tools cfg enables, with their
+// descriptions overridden and max_chars and max_tokens added to their
+// schemas. Naming a tool that does not exist is an error, so typos do not
+// silently leave a tool on.
+func newToolRegistry(defs []MCPTool, cfg toolConfig) (*toolRegistry, error) {
+	known := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		known[def.Name] = true
+	}
+	check := func(what, name string) error {
+		if !known[name] {
+			return fmt.Errorf("%s names unknown tool %q", what, name)
+		}
+		return nil
+	}
+	enabled := map[string]bool{}
+	for _, name := range cfg.Enabled {
+		if err := check("enabled", name); err != nil {
+			return nil, err
+		}
+		enabled[name] = true
+	}
+	disabled := map[string]bool{}
+	for _, name := range cfg.Disabled {
+		if err := check("disabled", name); err != nil {
+			return nil, err
+		}
+		disabled[name] = true
+	}
+	for name := range cfg.Descriptions {
+		if err := check("descriptions", name); err != nil {
+			return nil, err
+		}
+	}
+	for name, limit := range cfg.RateLimits {
+		if err := check("rate_limits", name); err != nil {
+			return nil, err
+		}
+		if limit <= 0 {
+			return nil, fmt.Errorf("rate_limits sets %s to %d, not a positive number of calls", name, limit)
+		}
+	}
+
+	reg := &toolRegistry{byName: map[string]int{}}
+	for _, def := range defs {
+		if disabled[def.Name] || (len(enabled) > 0 && !enabled[def.Name]) {
+			continue
+		}
+		if d := cfg.Descriptions[def.Name]; d != "" {
+			def.Description = d
+		}
+		def.RateLimit = cfg.RateLimits[def.Name]
+		addBudgetArgs(def)
+		reg.byName[def.Name] = len(reg.tools)
+		reg.tools = append(reg.tools, def)
+	}
+	return reg, nil
+}
+
+func mustRegistry(defs []MCPTool, cfg toolConfig) *toolRegistry {
+	reg, err := newToolRegistry(defs, cfg)
+	if err != nil {
+		panic(err)
+	}
+	return reg
+}
+
+// loadTools reads MCP_TOOLS_FILE, or offers every tool when it is unset.
+func loadTools() (*toolRegistry, error) {
+	var cfg toolConfig
+	if path := os.Getenv("MCP_TOOLS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid tools file %s: %v", path, err)
+		}
+	}
+	reg, err := newToolRegistry(builtinTools(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tools file: %v", err)
+	}
+	return reg, nil
+}
+
+// addBudgetArgs adds max_chars and max_tokens to a tool's schema.
+func addBudgetArgs(tool MCPTool) {
+	props, ok := tool.InputSchema["properties"].(map[string]interface{})
+	if !ok {
+		props = map[string]interface{}{}
+		tool.InputSchema["properties"] = props
+	}
+	for name, schema := range budgetArgs {
+		props[name] = schema
+	}
+}
+
+// list returns the tools offered.
+func (reg *toolRegistry) list() []MCPTool {
+	return reg.tools
+}
+
+// names returns the names of the tools offered, sorted.
+func (reg *toolRegistry) names() []string {
+	names := make([]string, 0, len(reg.tools))
+	for _, tool := range reg.tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns an offered tool.
+func (reg *toolRegistry) lookup(name string) (MCPTool, bool) {
+	i, ok := reg.byName[name]
+	if !ok {
+		return MCPTool{}, false
+	}
+	return reg.tools[i], true
+}
+
+// paged reports whether a tool takes an offset, so a budget trailer can
+// tell the caller where to continue.
+func (tool MCPTool) paged() bool {
+	props, _ := tool.InputSchema["properties"].(map[string]interface{})
+	_, ok := props["offset"]
+	return ok
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegistryOffersEveryBuiltinTool(t *testing.T) {
+	if got, want := len(tools.list()), len(builtinTools()); got != want {
+		t.Errorf("Expected %d tools, got %d", want, got)
+	}
+	for _, tool := range tools.list() {
+		if tool.Handler == nil {
+			t.Errorf("%s has no handler", tool.Name)
+		}
+	}
+}
+
+func TestRegistryConfig(t *testing.T) {
+	reg, err := newToolRegistry(builtinTools(), toolConfig{
+		Disabled:     []string{"delete_tag", "merge_tags"},
+		Descriptions: map[string]string{"search_content": "Search the team's notes"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reg.lookup("delete_tag"); ok {
+		t.Error("Expected delete_tag to be disabled")
+	}
+	if len(reg.list()) != len(builtinTools())-2 {
+		t.Errorf("Expected two tools fewer, got %d", len(reg.list()))
+	}
+	if tool, ok := reg.lookup("search_content"); !ok || tool.Description != "Search the team's notes" {
+		t.Errorf("Expected the description to be overridden, got %+v", tool)
+	}
+
+	reg, err = newToolRegistry(builtinTools(), toolConfig{Enabled: []string{"get_thread", "search_content"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tools keep their built-in order
+	if names := []string{reg.list()[0].Name, reg.list()[1].Name}; len(reg.list()) != 2 || !reflect.DeepEqual(names, []string{"search_content", "get_thread"}) {
+		t.Errorf("Expected only the enabled tools, got %v", reg.names())
+	}
+
+	for _, cfg := range []toolConfig{
+		{Enabled: []string{"serch_content"}},
+		{Disabled: []string{"nope"}},
+		{Descriptions: map[string]string{"nope": "x"}},
+	} {
+		if _, err := newToolRegistry(builtinTools(), cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestLoadTools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	os.WriteFile(path, []byte("disabled: [generate_quiz]\n"), 0o644)
+	t.Setenv("MCP_TOOLS_FILE", path)
+	reg, err := loadTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reg.lookup("generate_quiz"); ok {
+		t.Error("Expected generate_quiz to be disabled")
+	}
+
+	t.Setenv("MCP_TOOLS_FILE", filepath.Join("..", "..", "config", "tools.yaml"))
+	if reg, err := loadTools(); err != nil || len(reg.list()) != len(builtinTools()) {
+		t.Errorf("Expected the shipped tools file to offer every tool, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("disabled: [no_such_tool]\n"), 0o644)
+	t.Setenv("MCP_TOOLS_FILE", path)
+	if _, err := loadTools(); err == nil || !strings.Contains(err.Error(), "no_such_tool") {
+		t.Errorf("Expected unknown tools to be rejected, got %v", err)
+	}
+}
+
+func TestCallToolRefusesDisabledTools(t *testing.T) {
+	saved := tools
+	t.Cleanup(func() { tools = saved })
+	tools = mustRegistry(builtinTools(), toolConfig{Disabled: []string{"search_content"}})
+
+	resp := callTool(httptest.NewRequest("POST", "/mcp/call", nil), "search_content", map[string]interface{}{"query": "ibc"})
+	if !resp.IsError || !strings.Contains(resp.Content[0].Text, "Unknown tool") {
+		t.Errorf("Expected a disabled tool to be unknown, got %+v", resp)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"selin/internal/llm"
+	"selin/internal/logging"
+)
+
+// Most days of usage /usage reports.
+const maxUsageDays = 366
+
+// usageLedger is the LLM usage ledger, set up by main. The gateway and the
+// ws service keep theirs here too, through /usage.
+var usageLedger *llm.SQLLedger
+
+// UsageTotal sums a usage report.
+type UsageTotal struct {
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// usageHandler serves the LLM usage ledger of the caller's workspace:
+//
+//	GET  /usage        usage per day, user and feature, with its total and
+//	                   the budgets (?user_id=, ?feature=, ?days= default 30)
+//	POST /usage        record a call (an llm.Entry)
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if usageLedger == nil {
+		http.Error(w, "Usage ledger not ready", http.StatusServiceUnavailable)
+		return
+	}
+	ctx := r.Context()
+
+	if r.Method == http.MethodPost {
+		var entry llm.Entry
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&entry); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(entry.Feature) == "" || entry.Provider == "" || entry.Model == "" {
+			http.Error(w, "feature, provider and model are required", http.StatusBadRequest)
+			return
+		}
+		if entry.InputTokens < 0 || entry.OutputTokens < 0 || entry.Cost < 0 {
+			http.Error(w, "tokens and cost must not be negative", http.StatusBadRequest)
+			return
+		}
+		entry.Workspace = requestWorkspace(r)
+		if entry.RequestID == "" {
+			entry.RequestID = logging.RequestID(ctx)
+		}
+		if err := usageLedger.Record(ctx, entry); err != nil {
+			logging.FromContext(ctx).Error("failed to record llm usage", "error", err)
+			http.Error(w, "Failed to record usage", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	q := r.URL.Query()
+	days := 30
+	if n, err := strconv.Atoi(q.Get("days")); err == nil && n > 0 {
+		days = min(n, maxUsageDays)
+	}
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	usage, err := usageLedger.Usage(ctx, llm.UsageFilter{
+		Workspace: requestWorkspace(r),
+		UserID:    q.Get("user_id"),
+		Feature:   q.Get("feature"),
+		Since:     since,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to load llm usage", "error", err)
+		http.Error(w, "Failed to load usage", http.StatusInternalServerError)
+		return
+	}
+	var total UsageTotal
+	for _, u := range usage {
+		total.Calls += u.Calls
+		total.InputTokens += u.InputTokens
+		total.OutputTokens += u.OutputTokens
+		total.Cost += u.Cost
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"since":   since.Format("2006-01-02"),
+		"usage":   usage,
+		"total":   total,
+		"budgets": usageLedger.Budgets(),
+	})
+}
+
+// usageAllowHandler serves GET /usage/allow?user_id=&feature=, which tells
+// the gateway and the ws service whether a user of the caller's workspace
+// may make another LLM call for a feature.
+func usageAllowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if usageLedger == nil {
+		http.Error(w, "Usage ledger not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := usageLedger.Allow(r.Context(), llm.Account{
+		Workspace: requestWorkspace(r),
+		UserID:    r.URL.Query().Get("user_id"),
+		Feature:   r.URL.Query().Get("feature"),
+	})
+	result := map[string]interface{}{"allowed": err == nil}
+	var budget *llm.BudgetError
+	switch {
+	case errors.As(err, &budget):
+		result["exceeded"] = budget
+	case err != nil:
+		logging.FromContext(r.Context()).Error("failed to check llm budget", "error", err)
+		http.Error(w, "Failed to check budget", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"selin/internal/llm"
+)
+
+func TestUsageHandlerRejects(t *testing.T) {
+	defer func(l *llm.SQLLedger) { usageLedger = l }(usageLedger)
+
+	usageLedger = nil
+	rec := httptest.NewRecorder()
+	usageHandler(rec, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without a ledger, got %d", rec.Code)
+	}
+
+	// Every request below is turned away before the database is used
+	db, _ := sql.Open("postgres", "")
+	defer db.Close()
+	usageLedger = llm.NewSQLLedger(db, llm.Budgets{})
+	for _, tt := range []struct {
+		method, body string
+		want         int
+	}{
+		{http.MethodDelete, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, `{`, http.StatusBadRequest},
+		{http.MethodPost, `{"feature": "query", "provider": "openai"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"feature": "query", "provider": "openai", "model": "gpt-4o-mini", "cost": -1}`, http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		usageHandler(rec, httptest.NewRequest(tt.method, "/usage", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.body, tt.want, rec.Code)
+		}
+	}
+}
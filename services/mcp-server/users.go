@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"selin/internal/adminauth"
+	"selin/internal/logging"
+)
+
+// userTables are the tables holding a user's own data, keyed by user_id,
+// in the order their rows are deleted. Quiz attempts go before their cards
+// and collection items with their collections.
+var userTables = []string{
+	"query_history",
+	"content_interactions",
+	"result_feedback",
+	"review_items",
+	"quiz_attempts",
+	"quiz_cards",
+	"learning_goals",
+	"collections",
+	"user_preferences",
+	"notification_preferences",
+	"usage_ledger",
+}
+
+// deleteUserData deletes everything userID left in every workspace, and
+// returns how many rows went from each table. Content the user saved or
+// uploaded stays: it belongs to the workspace.
+func deleteUserData(ctx context.Context, db *sql.DB, userID string) (map[string]int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := make(map[string]int64, len(userTables))
+	for _, table := range userTables {
+		res, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+		deleted[table], _ = res.RowsAffected()
+	}
+	return deleted, tx.Commit()
+}
+
+// userDataHandler serves DELETE /admin/users/{id}/data, the Postgres part
+// of the gateway's DELETE /admin/users/{id}/data.
+func userDataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+	userID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/data")
+	if !ok || userID == "" || strings.Contains(userID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	db, err := getDBConnection()
+	if err != nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	deleted, err := deleteUserData(r.Context(), db, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to delete user data", "user_id", userID, "error", err)
+		http.Error(w, "Failed to delete user data", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("deleted user data", "user_id", userID, "deleted", deleted)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "deleted": deleted})
+}
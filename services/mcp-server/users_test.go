@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/config"
+)
+
+func TestUserDataHandlerRejectsBadRequests(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "secret")
+	config.Secrets().Reload()
+
+	tests := []struct {
+		method, path, auth string
+		want               int
+	}{
+		{"GET", "/admin/users/ana/data", "Bearer secret", http.StatusMethodNotAllowed},
+		{"DELETE", "/admin/users/ana/data", "", http.StatusUnauthorized},
+		{"DELETE", "/admin/users//data", "Bearer secret", http.StatusNotFound},
+		{"DELETE", "/admin/users/ana", "Bearer secret", http.StatusNotFound},
+		{"DELETE", "/admin/users/ana/bo/data", "Bearer secret", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rr := httptest.NewRecorder()
+		userDataHandler(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, rr.Code)
+		}
+	}
+}
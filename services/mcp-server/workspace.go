@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"selin/internal/adminauth"
+	"selin/internal/clients"
+)
+
+// Every request runs in one workspace, which scopes the content and
+// learning progress it can see. The gateway sets X-Workspace-ID from the
+// caller's API key and vouches for it with the MCP server token; admins
+// pick the workspace they manage. Everyone else gets the default
+// workspace, whatever header they send.
+const (
+	defaultWorkspace = "default"
+	workspaceHeader  = clients.WorkspaceHeader
+	workspaceArgName = "workspace_id"
+	// userArgName holds requestUser in tool arguments
+	userArgName = "_user_id"
+)
+
+var workspacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+func validWorkspace(id string) string {
+	if workspacePattern.MatchString(id) {
+		return id
+	}
+	return defaultWorkspace
+}
+
+func requestWorkspace(r *http.Request) string {
+	if !vouched(r) && !adminauth.Valid(r) {
+		return defaultWorkspace
+	}
+	return validWorkspace(r.Header.Get(workspaceHeader))
+}
+
+// requestUser returns the user the gateway vouched for in X-User-ID, the
+// name of the caller's API key, or "" for everyone else.
+func requestUser(r *http.Request) string {
+	if !vouched(r) {
+		return ""
+	}
+	return r.Header.Get(clients.UserHeader)
+}
+
+// workspaceArg returns the workspace callHandler put into tool arguments.
+func workspaceArg(args map[string]interface{}) string {
+	id, _ := args[workspaceArgName].(string)
+	return validWorkspace(id)
+}
+
+// userArg returns the user callTool put into tool arguments, or the default
+// user for callers the gateway did not vouch for.
+func userArg(args map[string]interface{}) string {
+	if id, _ := args[userArgName].(string); id != "" {
+		return id
+	}
+	return defaultUserID
+}
+
+// contextArgName holds the context of the call in tool arguments, so
+// handlers stop when the caller goes away or a batch runs out of time.
+const contextArgName = "_context"
+
+// contextArg returns the context callTool put into tool arguments, or the
+// background context for handlers called without one.
+func contextArg(args map[string]interface{}) context.Context {
+	if ctx, ok := args[contextArgName].(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/adminauth"
+	"selin/internal/config"
+)
+
+func TestRequestWorkspace(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"", defaultWorkspace},
+		{"study-group", "study-group"},
+		{"Study Group", defaultWorkspace},
+		{"x'; DROP TABLE content_metadata; --", defaultWorkspace},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/recommendations", nil)
+		r.Header.Set(workspaceHeader, tt.header)
+		vouch(t, r)
+		if got := requestWorkspace(r); got != tt.want {
+			t.Errorf("requestWorkspace(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRequestWorkspaceNeedsCredentials(t *testing.T) {
+	t.Setenv(adminauth.SecretName, "admin")
+	config.Secrets().Reload()
+	r := httptest.NewRequest("GET", "/recommendations", nil)
+	r.Header.Set(workspaceHeader, "study-group")
+	r.Header.Set("X-User-ID", "alice")
+	if got := requestWorkspace(r); got != defaultWorkspace {
+		t.Errorf("Expected a direct caller in the default workspace, got %q", got)
+	}
+	if got := requestUser(r); got != "" {
+		t.Errorf("Expected no user without the token, got %q", got)
+	}
+
+	r.Header.Set("Authorization", "Bearer admin")
+	if got := requestWorkspace(r); got != "study-group" {
+		t.Errorf("Expected an admin to pick the workspace, got %q", got)
+	}
+}
+
+func TestUserArg(t *testing.T) {
+	r := httptest.NewRequest("POST", "/mcp/call", nil)
+	r.Header.Set("X-User-ID", "mallory")
+	if got := userArg(map[string]interface{}{userArgName: requestUser(r)}); got != defaultUserID {
+		t.Errorf("Expected the default user without the token, got %q", got)
+	}
+	vouch(t, r)
+	r.Header.Set("X-User-ID", "alice-laptop")
+	if got := userArg(map[string]interface{}{userArgName: requestUser(r)}); got != "alice-laptop" {
+		t.Errorf("Expected the vouched user, got %q", got)
+	}
+}
+
+func TestWorkspaceArg(t *testing.T) {
+	if got := workspaceArg(map[string]interface{}{}); got != defaultWorkspace {
+		t.Errorf("Expected default workspace, got %q", got)
+	}
+	if got := workspaceArg(map[string]interface{}{workspaceArgName: "team-a"}); got != "team-a" {
+		t.Errorf("Expected team-a, got %q", got)
+	}
+}
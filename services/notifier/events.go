@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"selin/internal/events"
+	"selin/internal/search"
+)
+
+// notifyMinScore is the relevance score at or above which new content is
+// worth a notification, from NOTIFY_MIN_SCORE.
+func notifyMinScore() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("NOTIFY_MIN_SCORE"), 64); err == nil {
+		return v
+	}
+	return 0.8
+}
+
+// runEventBus notifies users of highly relevant new content announced on
+// the bus, collected or uploaded, and of content matching their watches,
+// until ctx is done. It takes the place of collectors posting it to /notify
+// when there is a bus.
+func runEventBus(ctx context.Context, n *Notifier, bus events.Bus, watches WatchStore) {
+	minScore := notifyMinScore()
+	err := bus.Subscribe(ctx, func(e events.Event) {
+		notifyWatches(ctx, n, watches, bus, e)
+		event, ok := contentNotification(e, minScore)
+		if !ok {
+			return
+		}
+		if _, err := n.Dispatch(ctx, event); err != nil {
+			slog.Error("failed to notify of new content", "error", err)
+		}
+	}, events.ContentCreated)
+	if err != nil {
+		slog.Error("event bus subscription failed", "error", err)
+	}
+}
+
+// contentNotification returns the high_relevance_content event for a
+// content.created event scoring at least minScore. Private content is
+// never sent out.
+func contentNotification(e events.Event, minScore float64) (Event, bool) {
+	var c events.Content
+	if err := e.Decode(&c); err != nil || c.Score < minScore || c.Visibility == search.VisibilityPrivate {
+		return Event{}, false
+	}
+	return Event{
+		Type:      EventHighRelevance,
+		Title:     fmt.Sprintf("New in %s (score %.1f)", strings.Join(c.Tags, ", "), c.Score),
+		Body:      c.Summary,
+		URL:       c.SourceURL,
+		Tags:      c.Tags,
+		Workspace: e.Workspace,
+	}, true
+}
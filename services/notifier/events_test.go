@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"selin/internal/events"
+	"selin/internal/search"
+)
+
+func TestContentNotification(t *testing.T) {
+	e, _ := events.New(events.ContentCreated, "default", events.Content{
+		ID: "c1", Tags: []string{"golang", "grpc"}, Score: 0.92, Summary: "Streaming RPCs", SourceURL: "https://reddit.com/r/golang/1",
+	})
+	got, ok := contentNotification(e, 0.8)
+	if !ok {
+		t.Fatal("Expected content scoring above the minimum to be notified")
+	}
+	if got.Type != EventHighRelevance || got.Title != "New in golang, grpc (score 0.9)" || got.Body != "Streaming RPCs" || got.URL != "https://reddit.com/r/golang/1" || got.Workspace != "default" {
+		t.Errorf("Expected the high relevance event, got %+v", got)
+	}
+
+	if _, ok := contentNotification(e, 0.95); ok {
+		t.Error("Expected content below the minimum to be skipped")
+	}
+	if _, ok := contentNotification(events.Event{Type: events.ContentCreated, Data: json.RawMessage(`[]`)}, 0); ok {
+		t.Error("Expected a malformed event to be skipped")
+	}
+
+	private, _ := events.New(events.ContentCreated, "default", events.Content{ID: "c2", Score: 0.95, Summary: "Release plan", Visibility: search.VisibilityPrivate})
+	if _, ok := contentNotification(private, 0.8); ok {
+		t.Error("Expected private content never to be notified")
+	}
+}
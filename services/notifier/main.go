@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"selin/internal/events"
+	"selin/internal/flags"
+	"selin/internal/healthcheck"
+	"selin/internal/logging"
+)
+
+// Metrics
+var (
+	notificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notifier_notifications_total",
+			Help: "Total number of notifications by channel and outcome",
+		},
+		[]string{"channel", "status"},
+	)
+
+	watchMatchesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "notifier_watch_matches_total",
+			Help: "Total number of new content items matching a user's watch",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(notificationsTotal)
+	prometheus.MustRegister(watchMatchesTotal)
+}
+
+// Largest event or preference body accepted.
+const maxBodyBytes = 64 << 10
+
+// Slack targets are user-supplied, so only real incoming webhooks are
+// accepted rather than arbitrary URLs.
+const slackWebhookPrefix = "https://hooks.slack.com/"
+
+var telegramChatPattern = regexp.MustCompile(`^(-?[0-9]+|@[A-Za-z0-9_]{5,})$`)
+
+var validChannels = map[string]bool{ChannelEmail: true, ChannelSlack: true, ChannelTelegram: true}
+
+// authorized checks the NOTIFIER_TOKEN bearer token shared with internal
+// services. The API is disabled when no token is configured.
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("NOTIFIER_TOKEN")
+	if token == "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "OK",
+		"timestamp": time.Now(),
+		"service":   "notifier",
+		"version":   "1.0.0",
+		"flags":     flags.Default().Rules(),
+	})
+}
+
+// readiness checks the database holding notification preferences, without
+// which no event can be routed.
+var readiness = func() *healthcheck.Checker {
+	checks := healthcheck.New("notifier")
+	checks.Register(healthcheck.Check{Name: "postgres", Probe: healthcheck.SQL(getDBConnection)})
+	return checks
+}()
+
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	readiness.ServeHTTP(w, r)
+}
+
+// Notify endpoint: other services report events here, e.g.
+// {"type": "high_relevance_content", "title": "...", "url": "..."}.
+func notifyHandler(n *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(w, r) {
+			return
+		}
+
+		var e Event
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&e); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if !validEvents[e.Type] {
+			http.Error(w, "Unknown event type", http.StatusBadRequest)
+			return
+		}
+		if e.Title == "" {
+			http.Error(w, "Title is required", http.StatusBadRequest)
+			return
+		}
+
+		delivered, err := n.Dispatch(r.Context(), e)
+		if err != nil && delivered == 0 {
+			http.Error(w, "Delivery failed", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "dispatched",
+			"deliveries": delivered,
+		})
+	}
+}
+
+// Digests endpoint: POST sends the email digests that are due, for the
+// scheduler's send_digests job.
+func digestsHandler(n *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(w, r) {
+			return
+		}
+		n.FlushDigests(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "sent"})
+	}
+}
+
+// Preferences endpoint: GET ?user_id= lists a user's routes, PUT sets one
+// and DELETE ?user_id=&event_type=&channel= removes one. Routes belong to
+// ?workspace_id= (default "default"), or the route's workspace_id on PUT.
+func preferencesHandler(store PreferenceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		workspace := r.URL.Query().Get("workspace_id")
+		if workspace == "" {
+			workspace = "default"
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			userID := r.URL.Query().Get("user_id")
+			if userID == "" {
+				http.Error(w, "user_id is required", http.StatusBadRequest)
+				return
+			}
+			prefs, err := store.ForUser(r.Context(), workspace, userID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to load preferences", "user_id", userID, "error", err)
+				http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+				return
+			}
+			if prefs == nil {
+				prefs = []Preference{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"preferences": prefs})
+
+		case http.MethodPut:
+			var p Preference
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&p); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if p.Workspace == "" {
+				p.Workspace = "default"
+			}
+			if msg := validatePreference(p); msg != "" {
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+			if err := store.Set(r.Context(), p); err != nil {
+				logging.FromContext(r.Context()).Error("failed to save preference", "user_id", p.UserID, "error", err)
+				http.Error(w, "Failed to save preference", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
+
+		case http.MethodDelete:
+			q := r.URL.Query()
+			if q.Get("user_id") == "" || q.Get("event_type") == "" || q.Get("channel") == "" {
+				http.Error(w, "user_id, event_type and channel are required", http.StatusBadRequest)
+				return
+			}
+			if err := store.Delete(r.Context(), workspace, q.Get("user_id"), q.Get("event_type"), q.Get("channel")); err != nil {
+				logging.FromContext(r.Context()).Error("failed to delete preference", "error", err)
+				http.Error(w, "Failed to delete preference", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// validatePreference returns a client-facing error, or "" if p is valid.
+func validatePreference(p Preference) string {
+	if p.UserID == "" {
+		return "user_id is required"
+	}
+	if !validEvents[p.EventType] {
+		return "event_type must be high_relevance_content, weekly_summary or watch_match"
+	}
+	switch p.Channel {
+	case ChannelEmail:
+		if addr, err := mail.ParseAddress(p.Target); err != nil || addr.Address != p.Target {
+			return "target must be an email address"
+		}
+	case ChannelSlack:
+		if !strings.HasPrefix(p.Target, slackWebhookPrefix) {
+			return "target must be a Slack incoming webhook URL"
+		}
+	case ChannelTelegram:
+		if !telegramChatPattern.MatchString(p.Target) {
+			return "target must be a Telegram chat ID"
+		}
+	default:
+		return "channel must be email, slack or telegram"
+	}
+	return ""
+}
+
+// envDuration reads a Go duration (e.g. "24h") from the environment.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func main() {
+	logging.Setup("notifier", "1.0.0")
+	// Fail at startup rather than on first use when the flags are misconfigured
+	flags.Default()
+	slog.Info("starting notifier service")
+
+	db, err := getDBConnection()
+	if err != nil {
+		logging.Fatal("failed to open database", "error", err)
+	}
+	defer db.Close()
+
+	store := &postgresPreferences{db: db}
+	sinks := sinksFromEnv()
+	for channel := range sinks {
+		slog.Info("channel enabled", "channel", channel)
+	}
+	notifier := NewNotifier(store, sinks)
+	watches := &postgresWatches{db: db}
+
+	ctx, stopDigests := context.WithCancel(context.Background())
+	digestsDone := make(chan struct{})
+	go func() {
+		notifier.RunDigests(ctx, envDuration("NOTIFY_DIGEST_INTERVAL", 24*time.Hour))
+		close(digestsDone)
+	}()
+
+	if bus := events.Default("notifier"); bus != events.Discard {
+		defer bus.Close()
+		go runEventBus(ctx, notifier, bus, watches)
+		slog.Info("event bus enabled", "bus", os.Getenv("EVENT_BUS"))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/ready", readyHandler)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/notify", notifyHandler(notifier))
+	mux.HandleFunc("/digests", digestsHandler(notifier))
+	mux.HandleFunc("/summaries", summariesHandler(notifier, &postgresSummaries{db: db}))
+	mux.HandleFunc("/preferences", preferencesHandler(store))
+	mux.HandleFunc("/watches", watchesHandler(watches))
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8085"
+	}
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: logging.Middleware(mux),
+		// Security timeouts
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 60 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// Graceful shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		slog.Info("notifier service starting", "port", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("server failed to start", "error", err)
+		}
+	}()
+
+	<-stop
+	slog.Info("shutting down notifier service")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server forced to shutdown", "error", err)
+	}
+
+	// Send whatever digests are pending before exiting
+	stopDigests()
+	<-digestsDone
+
+	slog.Info("notifier service stopped")
+}
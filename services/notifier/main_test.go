@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest("GET", "/health", nil))
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || response["status"] != "OK" {
+		t.Errorf("Expected 200 OK, got %d %v", rr.Code, response["status"])
+	}
+}
+
+func authedRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer internal")
+	return req
+}
+
+func TestNotifyHandler(t *testing.T) {
+	slack := &recordingSink{}
+	store := &memoryPreferences{prefs: []Preference{
+		{Workspace: "default", UserID: "alice", EventType: EventHighRelevance, Channel: ChannelSlack, Target: "https://hooks.slack.com/a"},
+	}}
+	handler := notifyHandler(NewNotifier(store, map[string]Sink{ChannelSlack: slack}))
+
+	rr := httptest.NewRecorder()
+	handler(rr, authedRequest("POST", "/notify", `{"type":"high_relevance_content","title":"x"}`))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without NOTIFIER_TOKEN, got %d", rr.Code)
+	}
+
+	t.Setenv("NOTIFIER_TOKEN", "internal")
+	for body, want := range map[string]int{
+		`{"type":"unknown","title":"x"}`:                http.StatusBadRequest,
+		`{"type":"high_relevance_content"}`:             http.StatusBadRequest,
+		`{"type":"high_relevance_content","title":"x"}`: http.StatusOK,
+	} {
+		rr := httptest.NewRecorder()
+		handler(rr, authedRequest("POST", "/notify", body))
+		if rr.Code != want {
+			t.Errorf("%s: expected %d, got %d", body, want, rr.Code)
+		}
+	}
+	if len(slack.sent) != 1 {
+		t.Errorf("Expected one Slack delivery, got %d", len(slack.sent))
+	}
+}
+
+func TestDigestsHandler(t *testing.T) {
+	email := &recordingSink{}
+	n := NewNotifier(&memoryPreferences{prefs: []Preference{
+		{Workspace: "default", UserID: "alice", EventType: EventHighRelevance, Channel: ChannelEmail, Target: "alice@example.com"},
+	}}, map[string]Sink{ChannelEmail: email})
+	t.Setenv("NOTIFIER_TOKEN", "internal")
+	if _, err := n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	digestsHandler(n)(rr, authedRequest("GET", "/digests", ""))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	digestsHandler(n)(rr, authedRequest("POST", "/digests", ""))
+	if rr.Code != http.StatusOK || len(email.sent) != 1 {
+		t.Errorf("Expected the pending digest sent, got %d with %d emails", rr.Code, len(email.sent))
+	}
+}
+
+func TestPreferencesHandler(t *testing.T) {
+	t.Setenv("NOTIFIER_TOKEN", "internal")
+	store := &memoryPreferences{}
+	handler := preferencesHandler(store)
+
+	invalid := []string{
+		`{"user_id":"alice","event_type":"weekly_summary","channel":"slack","target":"http://169.254.169.254/"}`,
+		`{"user_id":"alice","event_type":"weekly_summary","channel":"email","target":"Alice <alice@example.com>"}`,
+		`{"user_id":"alice","event_type":"weekly_summary","channel":"telegram","target":"not a chat"}`,
+		`{"user_id":"alice","event_type":"weekly_summary","channel":"fax","target":"123"}`,
+		`{"event_type":"weekly_summary","channel":"email","target":"alice@example.com"}`,
+	}
+	for _, body := range invalid {
+		rr := httptest.NewRecorder()
+		handler(rr, authedRequest("PUT", "/preferences", body))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, authedRequest("PUT", "/preferences", `{"user_id":"alice","event_type":"weekly_summary","channel":"email","target":"alice@example.com"}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, authedRequest("GET", "/preferences?user_id=alice", ""))
+	var response struct {
+		Preferences []Preference `json:"preferences"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	if len(response.Preferences) != 1 || response.Preferences[0].Target != "alice@example.com" {
+		t.Errorf("Expected alice's email route, got %+v", response.Preferences)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, authedRequest("GET", "/preferences?user_id=alice&workspace_id=team-a", ""))
+	response.Preferences = nil
+	json.NewDecoder(rr.Body).Decode(&response)
+	if len(response.Preferences) != 0 {
+		t.Errorf("Expected no routes for alice in team-a, got %+v", response.Preferences)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, authedRequest("DELETE", "/preferences?user_id=alice&event_type=weekly_summary&channel=email", ""))
+	if rr.Code != http.StatusNoContent || len(store.prefs) != 0 {
+		t.Errorf("Expected the route to be deleted, got %d and %+v", rr.Code, store.prefs)
+	}
+}
+
+func TestWatchesHandler(t *testing.T) {
+	t.Setenv("NOTIFIER_TOKEN", "internal")
+	store := &memoryWatches{}
+	handler := watchesHandler(store)
+
+	for _, body := range []string{
+		`{"expression":"CVE"}`,
+		`{"user_id":"alice","expression":"  "}`,
+		`{"user_id":"alice","expression":"` + strings.Repeat("a ", maxWatchLength) + `"}`,
+	} {
+		rr := httptest.NewRecorder()
+		handler(rr, authedRequest("POST", "/watches", body))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%.40s: expected 400, got %d", body, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, authedRequest("POST", "/watches", `{"user_id":"alice","expression":" cosmos sdk vulnerability "}`))
+	var created Watch
+	json.NewDecoder(rr.Body).Decode(&created)
+	if rr.Code != http.StatusCreated || created.ID == "" || created.Expression != "cosmos sdk vulnerability" || created.Workspace != "default" {
+		t.Fatalf("Expected the watch created in the default workspace, got %d: %+v", rr.Code, created)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, authedRequest("GET", "/watches?user_id=alice", ""))
+	var response struct {
+		Watches []Watch `json:"watches"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	if len(response.Watches) != 1 || response.Watches[0].ID != created.ID {
+		t.Errorf("Expected alice's watch, got %+v", response.Watches)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, authedRequest("DELETE", "/watches?user_id=alice&id="+created.ID, ""))
+	if rr.Code != http.StatusNoContent || len(store.watches) != 0 {
+		t.Errorf("Expected the watch to be deleted, got %d and %+v", rr.Code, store.watches)
+	}
+}
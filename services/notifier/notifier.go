@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"selin/internal/logging"
+	"selin/internal/preferences"
+)
+
+// Event types users can route to their channels.
+const (
+	EventHighRelevance = "high_relevance_content"
+	EventWeeklySummary = "weekly_summary"
+	// EventWatchMatch is sent as soon as new content matches a user's watch
+	EventWatchMatch = "watch_match"
+)
+
+var validEvents = map[string]bool{EventHighRelevance: true, EventWeeklySummary: true, EventWatchMatch: true}
+
+// Event is something worth telling users about. Without a UserID it goes to
+// every user who routes its type somewhere. Tagged events only reach users
+// who follow one of the tags, or no tags in particular, in their settings
+// for the event's workspace (the default one when empty).
+type Event struct {
+	Type      string   `json:"type"`
+	UserID    string   `json:"user_id,omitempty"`
+	Workspace string   `json:"workspace_id,omitempty"`
+	Title     string   `json:"title"`
+	Body      string   `json:"body,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// Most events kept per address between digests; older ones are dropped.
+const maxDigestEvents = 50
+
+// weeklyDigestAge is how long a weekly digest collects events before it is
+// sent.
+const weeklyDigestAge = 7 * 24 * time.Hour
+
+// digest is the email pending for one address.
+type digest struct {
+	events   []Event
+	schedule string    // the user's digest_schedule preference
+	since    time.Time // when the first pending event was queued
+}
+
+// Notifier routes events to sinks according to user preferences. Email is
+// collected into a periodic digest; every other channel, and watch matches
+// on any channel, is sent immediately.
+type Notifier struct {
+	store PreferenceStore
+	sinks map[string]Sink
+
+	mu      sync.Mutex
+	digests map[string]*digest // by email address
+}
+
+func NewNotifier(store PreferenceStore, sinks map[string]Sink) *Notifier {
+	return &Notifier{store: store, sinks: sinks, digests: make(map[string]*digest)}
+}
+
+// Dispatch delivers e to every matching route and returns how many
+// deliveries were sent or queued. Failed deliveries are logged and counted;
+// the first error is returned once all routes have been tried.
+func (n *Notifier) Dispatch(ctx context.Context, e Event) (int, error) {
+	prefs, err := n.store.ForEvent(ctx, e.workspace(), e.Type, e.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load preferences: %v", err)
+	}
+
+	delivered := 0
+	var firstErr error
+	settings := map[string]preferences.Preferences{}
+	for _, p := range prefs {
+		sink, ok := n.sinks[p.Channel]
+		if !ok {
+			notificationsTotal.WithLabelValues(p.Channel, "unconfigured").Inc()
+			continue
+		}
+
+		s, ok := settings[p.UserID]
+		if !ok {
+			if s, err = n.store.Settings(ctx, e.workspace(), p.UserID); err != nil {
+				logging.FromContext(ctx).Warn("failed to load user preferences, using defaults", "user_id", p.UserID, "error", err)
+				s = preferences.Default()
+			}
+			settings[p.UserID] = s
+		}
+		// A watch is what the user asked to hear about, whatever its tags
+		if e.Type != EventWatchMatch && !s.Follows(e.Tags) {
+			notificationsTotal.WithLabelValues(p.Channel, "unsubscribed").Inc()
+			continue
+		}
+
+		if p.Channel == ChannelEmail && e.Type != EventWatchMatch {
+			if s.DigestSchedule == preferences.DigestOff {
+				notificationsTotal.WithLabelValues(p.Channel, "unsubscribed").Inc()
+				continue
+			}
+			n.queueDigest(p.Target, s.DigestSchedule, e, time.Now())
+			notificationsTotal.WithLabelValues(p.Channel, "queued").Inc()
+			delivered++
+			continue
+		}
+
+		if err := sink.Send(ctx, p.Target, Notification{Subject: subjectFor(e), Events: []Event{e}}); err != nil {
+			logging.FromContext(ctx).Error("failed to send notification", "event_type", e.Type, "user_id", p.UserID, "channel", p.Channel, "error", err)
+			notificationsTotal.WithLabelValues(p.Channel, "failed").Inc()
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		notificationsTotal.WithLabelValues(p.Channel, "sent").Inc()
+		delivered++
+	}
+	return delivered, firstErr
+}
+
+// workspace returns the workspace e happened in.
+func (e Event) workspace() string {
+	if e.Workspace == "" {
+		return "default"
+	}
+	return e.Workspace
+}
+
+func subjectFor(e Event) string {
+	switch e.Type {
+	case EventHighRelevance:
+		return "Selin: new high-relevance content"
+	case EventWeeklySummary:
+		return "Selin: your weekly progress"
+	case EventWatchMatch:
+		return "Selin: " + e.Title
+	default:
+		return "Selin notification"
+	}
+}
+
+func (n *Notifier) queueDigest(address, schedule string, e Event, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d, ok := n.digests[address]
+	if !ok {
+		d = &digest{since: now}
+		n.digests[address] = d
+	}
+	d.schedule = schedule
+	d.events = append(d.events, e)
+	if len(d.events) > maxDigestEvents {
+		d.events = d.events[len(d.events)-maxDigestEvents:]
+	}
+}
+
+// FlushDigests emails every pending digest that is due: daily ones every
+// time, weekly ones once they are a week old. Digests that fail to send are
+// dropped so one bad address cannot grow without bound.
+func (n *Notifier) FlushDigests(ctx context.Context) {
+	n.flushDigests(ctx, time.Now(), false)
+}
+
+// flushDigests sends the digests due at now, or every digest when all is
+// set.
+func (n *Notifier) flushDigests(ctx context.Context, now time.Time, all bool) {
+	n.mu.Lock()
+	due := make(map[string][]Event)
+	for address, d := range n.digests {
+		if all || d.schedule != preferences.DigestWeekly || now.Sub(d.since) >= weeklyDigestAge {
+			due[address] = d.events
+			delete(n.digests, address)
+		}
+	}
+	n.mu.Unlock()
+
+	sink, ok := n.sinks[ChannelEmail]
+	if !ok {
+		return
+	}
+	for address, events := range due {
+		subject := fmt.Sprintf("Your Selin digest: %d updates", len(events))
+		if err := sink.Send(ctx, address, Notification{Subject: subject, Events: events}); err != nil {
+			slog.Error("failed to send digest", "address", address, "error", err)
+			notificationsTotal.WithLabelValues(ChannelEmail, "failed").Inc()
+			continue
+		}
+		notificationsTotal.WithLabelValues(ChannelEmail, "sent").Inc()
+	}
+}
+
+// RunDigests flushes digests every interval until ctx is cancelled, then
+// sends everything still pending so nothing queued is lost on shutdown.
+func (n *Notifier) RunDigests(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			n.flushDigests(flushCtx, time.Now(), true)
+			cancel()
+			return
+		case <-ticker.C:
+			n.FlushDigests(ctx)
+		}
+	}
+}
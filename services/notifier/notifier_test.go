@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"selin/internal/preferences"
+)
+
+// memoryPreferences is an in-memory PreferenceStore for tests.
+type memoryPreferences struct {
+	prefs    []Preference
+	settings map[string]preferences.Preferences
+}
+
+func (m *memoryPreferences) Settings(ctx context.Context, workspace, userID string) (preferences.Preferences, error) {
+	if s, ok := m.settings[userID]; ok {
+		return s, nil
+	}
+	return preferences.Default(), nil
+}
+
+func (m *memoryPreferences) ForEvent(ctx context.Context, workspace, eventType, userID string) ([]Preference, error) {
+	var out []Preference
+	for _, p := range m.prefs {
+		if p.Workspace == workspace && p.EventType == eventType && (userID == "" || p.UserID == userID) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryPreferences) ForUser(ctx context.Context, workspace, userID string) ([]Preference, error) {
+	var out []Preference
+	for _, p := range m.prefs {
+		if p.Workspace == workspace && p.UserID == userID {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryPreferences) Set(ctx context.Context, p Preference) error {
+	m.Delete(ctx, p.Workspace, p.UserID, p.EventType, p.Channel)
+	m.prefs = append(m.prefs, p)
+	return nil
+}
+
+func (m *memoryPreferences) Delete(ctx context.Context, workspace, userID, eventType, channel string) error {
+	kept := m.prefs[:0]
+	for _, p := range m.prefs {
+		if p.Workspace != workspace || p.UserID != userID || p.EventType != eventType || p.Channel != channel {
+			kept = append(kept, p)
+		}
+	}
+	m.prefs = kept
+	return nil
+}
+
+type sentNotification struct {
+	target string
+	n      Notification
+}
+
+// recordingSink remembers what it was asked to send.
+type recordingSink struct {
+	mu   sync.Mutex
+	sent []sentNotification
+	err  error
+}
+
+func (s *recordingSink) Send(ctx context.Context, target string, n Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, sentNotification{target: target, n: n})
+	return nil
+}
+
+func TestDispatchRoutesByPreference(t *testing.T) {
+	store := &memoryPreferences{prefs: []Preference{
+		{Workspace: "default", UserID: "alice", EventType: EventHighRelevance, Channel: ChannelSlack, Target: "https://hooks.slack.com/a"},
+		{Workspace: "default", UserID: "bob", EventType: EventHighRelevance, Channel: ChannelTelegram, Target: "42"},
+		{Workspace: "default", UserID: "bob", EventType: EventWeeklySummary, Channel: ChannelSlack, Target: "https://hooks.slack.com/b"},
+	}}
+	slack, telegram := &recordingSink{}, &recordingSink{}
+	n := NewNotifier(store, map[string]Sink{ChannelSlack: slack, ChannelTelegram: telegram})
+
+	delivered, err := n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: "Go 1.24 released"})
+	if err != nil || delivered != 2 {
+		t.Fatalf("Expected 2 deliveries, got %d (%v)", delivered, err)
+	}
+	if len(slack.sent) != 1 || slack.sent[0].target != "https://hooks.slack.com/a" {
+		t.Errorf("Expected one Slack message to alice's webhook, got %+v", slack.sent)
+	}
+	if len(telegram.sent) != 1 || telegram.sent[0].target != "42" {
+		t.Errorf("Expected one Telegram message to bob, got %+v", telegram.sent)
+	}
+
+	// A targeted event only reaches that user
+	delivered, _ = n.Dispatch(context.Background(), Event{Type: EventWeeklySummary, UserID: "alice", Title: "Week 12"})
+	if delivered != 0 {
+		t.Errorf("Expected no deliveries for alice's weekly summary, got %d", delivered)
+	}
+
+	// Nor do another workspace's events reach them
+	delivered, _ = n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: "Roadmap", Workspace: "team-b"})
+	if delivered != 0 {
+		t.Errorf("Expected no deliveries for team-b's content, got %d", delivered)
+	}
+}
+
+func TestDispatchBatchesEmailIntoDigest(t *testing.T) {
+	store := &memoryPreferences{prefs: []Preference{
+		{Workspace: "default", UserID: "alice", EventType: EventHighRelevance, Channel: ChannelEmail, Target: "alice@example.com"},
+	}}
+	email := &recordingSink{}
+	n := NewNotifier(store, map[string]Sink{ChannelEmail: email})
+
+	for _, title := range []string{"first", "second"} {
+		if _, err := n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(email.sent) != 0 {
+		t.Fatalf("Expected email to wait for the digest, got %+v", email.sent)
+	}
+
+	n.FlushDigests(context.Background())
+	if len(email.sent) != 1 {
+		t.Fatalf("Expected a single digest email, got %d", len(email.sent))
+	}
+	if events := email.sent[0].n.Events; len(events) != 2 || events[0].Title != "first" {
+		t.Errorf("Expected both events in order, got %+v", events)
+	}
+
+	n.FlushDigests(context.Background())
+	if len(email.sent) != 1 {
+		t.Errorf("Expected an empty digest not to be sent, got %d emails", len(email.sent))
+	}
+}
+
+func TestDispatchSkipsUnconfiguredAndReportsFailures(t *testing.T) {
+	store := &memoryPreferences{prefs: []Preference{
+		{Workspace: "default", UserID: "alice", EventType: EventHighRelevance, Channel: ChannelTelegram, Target: "42"},
+		{Workspace: "default", UserID: "bob", EventType: EventHighRelevance, Channel: ChannelSlack, Target: "https://hooks.slack.com/b"},
+		{Workspace: "default", UserID: "carol", EventType: EventHighRelevance, Channel: ChannelSlack, Target: "https://hooks.slack.com/c"},
+	}}
+	failing := &recordingSink{err: errors.New("webhook gone")}
+	n := NewNotifier(store, map[string]Sink{ChannelSlack: failing})
+
+	delivered, err := n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: "x"})
+	if delivered != 0 || err == nil {
+		t.Errorf("Expected no deliveries and an error, got %d (%v)", delivered, err)
+	}
+}
+
+func TestDispatchFollowsSubscribedTags(t *testing.T) {
+	store := &memoryPreferences{
+		prefs: []Preference{
+			{Workspace: "default", UserID: "alice", EventType: EventHighRelevance, Channel: ChannelSlack, Target: "https://hooks.slack.com/a"},
+			{Workspace: "default", UserID: "bob", EventType: EventHighRelevance, Channel: ChannelSlack, Target: "https://hooks.slack.com/b"},
+		},
+		settings: map[string]preferences.Preferences{"alice": {SubscribedTags: []string{"cosmos"}}},
+	}
+	slack := &recordingSink{}
+	n := NewNotifier(store, map[string]Sink{ChannelSlack: slack})
+
+	delivered, err := n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: "Go 1.24", Tags: []string{"golang"}})
+	if err != nil || delivered != 1 || slack.sent[0].target != "https://hooks.slack.com/b" {
+		t.Errorf("Expected only bob, who follows every tag, to be told, got %d: %+v", delivered, slack.sent)
+	}
+	if delivered, _ := n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: "IBC v8", Tags: []string{"Cosmos"}}); delivered != 2 {
+		t.Errorf("Expected both users told about cosmos content, got %d", delivered)
+	}
+}
+
+func TestDigestSchedules(t *testing.T) {
+	store := &memoryPreferences{
+		prefs: []Preference{
+			{Workspace: "default", UserID: "alice", EventType: EventHighRelevance, Channel: ChannelEmail, Target: "alice@example.com"},
+			{Workspace: "default", UserID: "bob", EventType: EventHighRelevance, Channel: ChannelEmail, Target: "bob@example.com"},
+			{Workspace: "default", UserID: "carol", EventType: EventHighRelevance, Channel: ChannelEmail, Target: "carol@example.com"},
+		},
+		settings: map[string]preferences.Preferences{
+			"bob":   {DigestSchedule: preferences.DigestWeekly},
+			"carol": {DigestSchedule: preferences.DigestOff},
+		},
+	}
+	email := &recordingSink{}
+	n := NewNotifier(store, map[string]Sink{ChannelEmail: email})
+
+	if delivered, _ := n.Dispatch(context.Background(), Event{Type: EventHighRelevance, Title: "x"}); delivered != 2 {
+		t.Errorf("Expected carol, who turned digests off, to be skipped, got %d deliveries", delivered)
+	}
+
+	n.flushDigests(context.Background(), time.Now(), false)
+	if len(email.sent) != 1 || email.sent[0].target != "alice@example.com" {
+		t.Fatalf("Expected only alice's daily digest, got %+v", email.sent)
+	}
+	n.flushDigests(context.Background(), time.Now().Add(weeklyDigestAge), false)
+	if len(email.sent) != 2 || email.sent[1].target != "bob@example.com" {
+		t.Errorf("Expected bob's weekly digest a week later, got %+v", email.sent)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"selin/internal/config"
+	"selin/internal/preferences"
+)
+
+// Preference routes one event type for one user of a workspace to one
+// channel.
+type Preference struct {
+	Workspace string `json:"workspace_id"`
+	UserID    string `json:"user_id"`
+	EventType string `json:"event_type"`
+	Channel   string `json:"channel"`
+	Target    string `json:"target"` // email address, Slack webhook URL or Telegram chat ID
+}
+
+// PreferenceStore looks up and edits notification routing.
+type PreferenceStore interface {
+	// ForEvent returns the routes for eventType in workspace, limited to
+	// userID unless it is empty.
+	ForEvent(ctx context.Context, workspace, eventType, userID string) ([]Preference, error)
+	ForUser(ctx context.Context, workspace, userID string) ([]Preference, error)
+	Set(ctx context.Context, p Preference) error
+	Delete(ctx context.Context, workspace, userID, eventType, channel string) error
+	// Settings returns the user's general preferences in workspace, such as
+	// the tags they follow and their digest schedule.
+	Settings(ctx context.Context, workspace, userID string) (preferences.Preferences, error)
+}
+
+// postgresPreferences stores routes in the notification_preferences table.
+type postgresPreferences struct {
+	db *sql.DB
+}
+
+func getDBConnection() (*sql.DB, error) {
+	connStr := config.PostgresDSN("notifier")
+
+	return sql.Open("postgres", connStr)
+}
+
+func (s *postgresPreferences) ForEvent(ctx context.Context, workspace, eventType, userID string) ([]Preference, error) {
+	query := `
+		SELECT workspace_id, user_id, event_type, channel, target FROM notification_preferences
+		WHERE workspace_id = $1 AND event_type = $2`
+	args := []interface{}{workspace, eventType}
+	if userID != "" {
+		query += " AND user_id = $3"
+		args = append(args, userID)
+	}
+	return s.query(ctx, query, args...)
+}
+
+func (s *postgresPreferences) ForUser(ctx context.Context, workspace, userID string) ([]Preference, error) {
+	return s.query(ctx, `
+		SELECT workspace_id, user_id, event_type, channel, target FROM notification_preferences
+		WHERE workspace_id = $1 AND user_id = $2 ORDER BY event_type, channel`, workspace, userID)
+}
+
+func (s *postgresPreferences) query(ctx context.Context, query string, args ...interface{}) ([]Preference, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prefs []Preference
+	for rows.Next() {
+		var p Preference
+		if err := rows.Scan(&p.Workspace, &p.UserID, &p.EventType, &p.Channel, &p.Target); err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, p)
+	}
+	return prefs, rows.Err()
+}
+
+func (s *postgresPreferences) Set(ctx context.Context, p Preference) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO notification_preferences (workspace_id, user_id, event_type, channel, target)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (workspace_id, user_id, event_type, channel) DO UPDATE SET
+			target = EXCLUDED.target,
+			updated_at = now()`,
+		p.Workspace, p.UserID, p.EventType, p.Channel, p.Target)
+	return err
+}
+
+func (s *postgresPreferences) Delete(ctx context.Context, workspace, userID, eventType, channel string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM notification_preferences
+		WHERE workspace_id = $1 AND user_id = $2 AND event_type = $3 AND channel = $4`,
+		workspace, userID, eventType, channel)
+	return err
+}
+
+func (s *postgresPreferences) Settings(ctx context.Context, workspace, userID string) (preferences.Preferences, error) {
+	return preferences.Load(ctx, s.db, workspace, userID)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Delivery channels a user can route events to.
+const (
+	ChannelEmail    = "email"
+	ChannelSlack    = "slack"
+	ChannelTelegram = "telegram"
+)
+
+// Sink delivers a rendered notification to one target: an email address, a
+// Slack incoming webhook URL or a Telegram chat ID.
+type Sink interface {
+	Send(ctx context.Context, target string, n Notification) error
+}
+
+// Notification is what a sink renders; a digest carries several events.
+type Notification struct {
+	Subject string
+	Events  []Event
+}
+
+// Text renders the notification as plain text, one event per paragraph.
+func (n Notification) Text() string {
+	var b strings.Builder
+	for i, e := range n.Events {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(e.Title)
+		if e.Body != "" {
+			b.WriteString("\n" + e.Body)
+		}
+		if e.URL != "" {
+			b.WriteString("\n" + e.URL)
+		}
+	}
+	return b.String()
+}
+
+// sinksFromEnv builds every sink whose credentials are configured.
+func sinksFromEnv() map[string]Sink {
+	sinks := make(map[string]Sink)
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		sinks[ChannelEmail] = &SMTPSink{
+			addr:     host + ":" + port,
+			host:     host,
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+			from:     os.Getenv("SMTP_FROM"),
+			send:     smtp.SendMail,
+		}
+	}
+	// Slack needs no credentials: each user's target is their own webhook
+	sinks[ChannelSlack] = &SlackSink{client: &http.Client{Timeout: 10 * time.Second}}
+	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		sinks[ChannelTelegram] = &TelegramSink{
+			baseURL: "https://api.telegram.org/bot" + token,
+			client:  &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return sinks
+}
+
+// SMTPSink sends plain-text email.
+type SMTPSink struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	send     func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (s *SMTPSink) Send(ctx context.Context, target string, n Notification) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.from, target, n.Subject, strings.ReplaceAll(n.Text(), "\n", "\r\n"))
+	return s.send(s.addr, auth, s.from, []string{target}, []byte(msg))
+}
+
+// SlackSink posts to a Slack incoming webhook.
+type SlackSink struct {
+	client *http.Client
+}
+
+func (s *SlackSink) Send(ctx context.Context, target string, n Notification) error {
+	text := n.Text()
+	if n.Subject != "" {
+		text = "*" + n.Subject + "*\n" + text
+	}
+	return postJSON(ctx, s.client, target, map[string]string{"text": text})
+}
+
+// TelegramSink sends messages through a Telegram bot.
+type TelegramSink struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (s *TelegramSink) Send(ctx context.Context, target string, n Notification) error {
+	text := n.Text()
+	if n.Subject != "" {
+		text = n.Subject + "\n\n" + text
+	}
+	return postJSON(ctx, s.client, s.baseURL+"/sendMessage", map[string]interface{}{
+		"chat_id":                  target,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func captureJSON(t *testing.T, status int) (*httptest.Server, *map[string]interface{}, *string) {
+	t.Helper()
+	var body map[string]interface{}
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &body, &path
+}
+
+func TestSlackSink(t *testing.T) {
+	server, body, _ := captureJSON(t, http.StatusOK)
+	sink := &SlackSink{client: server.Client()}
+
+	n := Notification{Subject: "Heads up", Events: []Event{{Title: "Go 1.24", URL: "https://go.dev"}}}
+	if err := sink.Send(context.Background(), server.URL, n); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := (*body)["text"].(string)
+	if !strings.HasPrefix(text, "*Heads up*") || !strings.Contains(text, "https://go.dev") {
+		t.Errorf("Unexpected Slack text %q", text)
+	}
+}
+
+func TestTelegramSink(t *testing.T) {
+	server, body, path := captureJSON(t, http.StatusOK)
+	sink := &TelegramSink{baseURL: server.URL + "/botTOKEN", client: server.Client()}
+
+	if err := sink.Send(context.Background(), "42", Notification{Events: []Event{{Title: "hi"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if *path != "/botTOKEN/sendMessage" || (*body)["chat_id"] != "42" || (*body)["text"] != "hi" {
+		t.Errorf("Unexpected Telegram request %s %+v", *path, *body)
+	}
+}
+
+func TestSinkReportsErrorStatus(t *testing.T) {
+	server, _, _ := captureJSON(t, http.StatusNotFound)
+	sink := &SlackSink{client: server.Client()}
+	if err := sink.Send(context.Background(), server.URL, Notification{Events: []Event{{Title: "x"}}}); err == nil {
+		t.Error("Expected an error for a 404 from the webhook")
+	}
+}
+
+func TestSMTPSink(t *testing.T) {
+	var gotTo []string
+	var gotMsg string
+	sink := &SMTPSink{
+		addr: "smtp.example.com:587",
+		host: "smtp.example.com",
+		from: "selin@example.com",
+		send: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			gotTo, gotMsg = to, string(msg)
+			return nil
+		},
+	}
+
+	n := Notification{Subject: "Your Selin digest: 2 updates", Events: []Event{{Title: "one"}, {Title: "two"}}}
+	if err := sink.Send(context.Background(), "alice@example.com", n); err != nil {
+		t.Fatal(err)
+	}
+	if len(gotTo) != 1 || gotTo[0] != "alice@example.com" {
+		t.Errorf("Unexpected recipients %v", gotTo)
+	}
+	if !strings.Contains(gotMsg, "Subject: Your Selin digest: 2 updates\r\n") || !strings.Contains(gotMsg, "one\r\n\r\ntwo") {
+		t.Errorf("Unexpected message %q", gotMsg)
+	}
+}
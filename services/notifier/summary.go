@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// The weekly summary tells users how their topics moved over the last week
+// and how much new content came in. The scheduler's send_weekly_summary
+// job asks for it every Monday; it goes to every user routing the
+// weekly_summary event type.
+
+// summaryWeek is the period a summary covers.
+const summaryWeek = 7 * 24 * time.Hour
+
+// Topics listed in a summary, those that moved most first.
+const maxSummaryTopics = 10
+
+// TopicProgress is a topic's progress score at the start and end of a week.
+type TopicProgress struct {
+	Topic      string
+	Was, Is    float64
+	SkillLevel string
+}
+
+// WeekSummary is what happened in a workspace over a week.
+type WeekSummary struct {
+	NewContent int
+	Topics     []TopicProgress
+}
+
+// SummaryStore reads what a weekly summary reports.
+type SummaryStore interface {
+	// Week returns what happened in the workspace since since.
+	Week(ctx context.Context, workspace string, since time.Time) (WeekSummary, error)
+}
+
+// postgresSummaries reads content_metadata and the learning progress the
+// MCP server keeps.
+type postgresSummaries struct {
+	db *sql.DB
+}
+
+func (s *postgresSummaries) Week(ctx context.Context, workspace string, since time.Time) (WeekSummary, error) {
+	var w WeekSummary
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM content_metadata WHERE workspace_id = $1 AND created_at >= $2`,
+		workspace, since).Scan(&w.NewContent); err != nil {
+		return w, err
+	}
+
+	// Topics start the week where their last score before it left them
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.topic, p.progress_score, p.skill_level,
+		       COALESCE((SELECT h.progress_score FROM learning_progress_history h
+		                 WHERE h.workspace_id = p.workspace_id AND h.topic = p.topic AND h.recorded_at < $2
+		                 ORDER BY h.recorded_at DESC LIMIT 1), 0)
+		FROM learning_progress p WHERE p.workspace_id = $1`, workspace, since)
+	if err != nil {
+		return w, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TopicProgress
+		if err := rows.Scan(&t.Topic, &t.Is, &t.SkillLevel, &t.Was); err != nil {
+			return w, err
+		}
+		w.Topics = append(w.Topics, t)
+	}
+	return w, rows.Err()
+}
+
+// summaryEvent writes up the week ending at now, listing the topics whose
+// progress, on its 0–10 scale, moved by at least a tenth.
+func summaryEvent(w WeekSummary, now time.Time) Event {
+	var moved []TopicProgress
+	for _, t := range w.Topics {
+		if math.Abs(t.Is-t.Was) >= 0.1 {
+			moved = append(moved, t)
+		}
+	}
+	sort.SliceStable(moved, func(i, j int) bool {
+		return math.Abs(moved[i].Is-moved[i].Was) > math.Abs(moved[j].Is-moved[j].Was)
+	})
+	if len(moved) > maxSummaryTopics {
+		moved = moved[:maxSummaryTopics]
+	}
+
+	lines := []string{fmt.Sprintf("%d new items collected.", w.NewContent)}
+	if len(moved) == 0 {
+		lines = append(lines, "No topic moved this week.")
+	}
+	for _, t := range moved {
+		lines = append(lines, fmt.Sprintf("%s: %.1f → %.1f (%s)", t.Topic, t.Was, t.Is, t.SkillLevel))
+	}
+	return Event{
+		Type:  EventWeeklySummary,
+		Title: "Week of " + now.Add(-summaryWeek).Format("Jan 2"),
+		Body:  strings.Join(lines, "\n"),
+	}
+}
+
+// Summaries endpoint: POST sends the weekly summary of ?workspace_id=
+// (default "default"), for the scheduler's send_weekly_summary job.
+func summariesHandler(n *Notifier, store SummaryStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(w, r) {
+			return
+		}
+		workspace := r.URL.Query().Get("workspace_id")
+		if workspace == "" {
+			workspace = "default"
+		}
+
+		now := time.Now()
+		week, err := store.Week(r.Context(), workspace, now.Add(-summaryWeek))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to load weekly summary", "workspace_id", workspace, "error", err)
+			http.Error(w, "Failed to load weekly summary", http.StatusInternalServerError)
+			return
+		}
+		e := summaryEvent(week, now)
+		e.Workspace = workspace
+		delivered, err := n.Dispatch(r.Context(), e)
+		if err != nil && delivered == 0 {
+			http.Error(w, "Delivery failed", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "dispatched",
+			"deliveries": delivered,
+		})
+	}
+}
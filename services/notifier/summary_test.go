@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memorySummaries struct {
+	weeks map[string]WeekSummary
+	err   error
+}
+
+func (s *memorySummaries) Week(ctx context.Context, workspace string, since time.Time) (WeekSummary, error) {
+	return s.weeks[workspace], s.err
+}
+
+func TestSummaryEvent(t *testing.T) {
+	now := time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC)
+	e := summaryEvent(WeekSummary{NewContent: 42, Topics: []TopicProgress{
+		{Topic: "golang", Was: 4.0, Is: 5.5, SkillLevel: "intermediate"},
+		{Topic: "rust", Was: 3.0, Is: 3.0, SkillLevel: "intermediate"},
+		{Topic: "cosmos", Was: 7.0, Is: 2.0, SkillLevel: "beginner"},
+	}}, now)
+
+	if e.Type != EventWeeklySummary || e.Title != "Week of Mar 2" {
+		t.Errorf("Expected the weekly summary of the week of Mar 2, got %s %q", e.Type, e.Title)
+	}
+	want := "42 new items collected.\ncosmos: 7.0 → 2.0 (beginner)\ngolang: 4.0 → 5.5 (intermediate)"
+	if e.Body != want {
+		t.Errorf("Expected the topics that moved, most first, got %q", e.Body)
+	}
+
+	if e := summaryEvent(WeekSummary{}, now); !strings.Contains(e.Body, "No topic moved") {
+		t.Errorf("Expected a quiet week said so, got %q", e.Body)
+	}
+}
+
+func TestSummariesHandler(t *testing.T) {
+	t.Setenv("NOTIFIER_TOKEN", "internal")
+	slack := &recordingSink{}
+	n := NewNotifier(&memoryPreferences{prefs: []Preference{
+		{Workspace: "default", UserID: "alice", EventType: EventWeeklySummary, Channel: ChannelSlack, Target: "https://hooks.slack.com/a"},
+		{Workspace: "default", UserID: "bob", EventType: EventHighRelevance, Channel: ChannelSlack, Target: "https://hooks.slack.com/b"},
+		{Workspace: "team-a", UserID: "carol", EventType: EventWeeklySummary, Channel: ChannelSlack, Target: "https://hooks.slack.com/c"},
+	}}, map[string]Sink{ChannelSlack: slack})
+	store := &memorySummaries{weeks: map[string]WeekSummary{
+		"default": {NewContent: 3},
+		"team-a":  {NewContent: 7},
+	}}
+
+	rr := httptest.NewRecorder()
+	summariesHandler(n, store)(rr, authedRequest("POST", "/summaries", ""))
+	if rr.Code != http.StatusOK || len(slack.sent) != 1 {
+		t.Fatalf("Expected the summary sent to alice only, got %d and %d deliveries", rr.Code, len(slack.sent))
+	}
+	if body := slack.sent[0].n.Events[0].Body; !strings.HasPrefix(body, "3 new items") {
+		t.Errorf("Expected the default workspace summarized, got %q", body)
+	}
+
+	rr = httptest.NewRecorder()
+	summariesHandler(n, store)(rr, authedRequest("POST", "/summaries?workspace_id=team-a", ""))
+	if len(slack.sent) != 2 || slack.sent[1].target != "https://hooks.slack.com/c" {
+		t.Fatalf("Expected team-a's summary sent to carol only, got %+v", slack.sent)
+	}
+	if body := slack.sent[1].n.Events[0].Body; !strings.HasPrefix(body, "7 new items") {
+		t.Errorf("Expected team-a summarized, got %q", body)
+	}
+
+	store.err = errors.New("connection refused")
+	rr = httptest.NewRecorder()
+	summariesHandler(n, store)(rr, authedRequest("POST", "/summaries", ""))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 when the summary cannot be loaded, got %d", rr.Code)
+	}
+}
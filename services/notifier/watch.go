@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"selin/internal/events"
+	"selin/internal/logging"
+	"selin/internal/search"
+)
+
+// A watch is an expression a user wants to hear about as soon as new
+// content matches it, rather than in a digest: "CVE", "cosmos sdk
+// vulnerability", `"go 1.23" releas*`. Every word must appear in the
+// content's summary or tags, case-insensitively; a quoted phrase must
+// appear as is, and a word ending in * matches any word it starts.
+
+const (
+	maxWatchLength    = 200
+	maxWatchesPerUser = 50
+)
+
+// Watch is one user's watch expression in a workspace.
+type Watch struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Workspace  string    `json:"workspace_id"`
+	Expression string    `json:"expression"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WatchStore keeps the users' watches.
+type WatchStore interface {
+	// InWorkspace returns every watch on the workspace's content.
+	InWorkspace(ctx context.Context, workspace string) ([]Watch, error)
+	ForUser(ctx context.Context, userID string) ([]Watch, error)
+	// Add stores w, returning it with its ID.
+	Add(ctx context.Context, w Watch) (Watch, error)
+	Delete(ctx context.Context, userID, id string) error
+}
+
+// watchTerm is a word or phrase a watch needs, as words.
+type watchTerm struct {
+	words  []string
+	prefix bool // the last word only needs to start a word
+}
+
+// parseWatch splits an expression into the terms content must contain.
+func parseWatch(expression string) ([]watchTerm, error) {
+	var terms []watchTerm
+	for i, part := range strings.Split(expression, `"`) {
+		if i%2 == 1 {
+			// Quoted: one phrase
+			if words := watchWords(part); len(words) > 0 {
+				terms = append(terms, watchTerm{words: words})
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			prefix := strings.HasSuffix(field, "*")
+			for _, word := range watchWords(field) {
+				terms = append(terms, watchTerm{words: []string{word}})
+			}
+			if prefix && len(terms) > 0 {
+				terms[len(terms)-1].prefix = true
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("expression has no words")
+	}
+	return terms, nil
+}
+
+// watchWords lowercases text and splits it into words: letters and digits,
+// with dots inside them kept so versions like 1.23 stay one word.
+func watchWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.'
+	})
+	words := fields[:0]
+	for _, f := range fields {
+		if f = strings.Trim(f, "."); f != "" {
+			words = append(words, f)
+		}
+	}
+	return words
+}
+
+// matchesWatch reports whether every term is in one of fields, the words
+// of a summary or a tag each, so a phrase never spans two of them.
+func matchesWatch(terms []watchTerm, fields [][]string) bool {
+	for _, term := range terms {
+		found := false
+		for _, words := range fields {
+			if containsTerm(words, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsTerm(words []string, term watchTerm) bool {
+	n := len(term.words)
+	for i := 0; i+n <= len(words); i++ {
+		matched := true
+		for j, want := range term.words {
+			got := words[i+j]
+			if got != want && !(term.prefix && j == n-1 && strings.HasPrefix(got, want)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingWatches returns the watches c matches, by its summary and tags.
+func matchingWatches(watches []Watch, c events.Content) []Watch {
+	fields := [][]string{watchWords(c.Summary)}
+	for _, tag := range c.Tags {
+		fields = append(fields, watchWords(tag))
+	}
+	var matched []Watch
+	for _, w := range watches {
+		terms, err := parseWatch(w.Expression)
+		if err == nil && matchesWatch(terms, fields) {
+			matched = append(matched, w)
+		}
+	}
+	return matched
+}
+
+// notifyWatches tells the users whose watches new content matches, right
+// away: watch.matched goes out on the bus for the ws service to push to
+// their connections, and a watch_match event to the channels they route it
+// to. Private content is only pushed, never sent outside the system.
+func notifyWatches(ctx context.Context, n *Notifier, store WatchStore, bus events.Bus, e events.Event) {
+	var c events.Content
+	if err := e.Decode(&c); err != nil {
+		return
+	}
+	watches, err := store.InWorkspace(ctx, e.Workspace)
+	if err != nil {
+		slog.Error("failed to load watches", "error", err)
+		return
+	}
+	for _, w := range matchingWatches(watches, c) {
+		watchMatchesTotal.Inc()
+		match, err := events.New(events.WatchMatched, e.Workspace, events.WatchMatch{
+			WatchID: w.ID, UserID: w.UserID, Expression: w.Expression, Content: c,
+		})
+		if err == nil {
+			if err := bus.Publish(ctx, match); err != nil {
+				slog.Warn("failed to publish watch match", "watch_id", w.ID, "error", err)
+			}
+		}
+		if c.Visibility == search.VisibilityPrivate {
+			continue
+		}
+		_, err = n.Dispatch(ctx, Event{
+			Type:      EventWatchMatch,
+			UserID:    w.UserID,
+			Workspace: w.Workspace,
+			Title:     fmt.Sprintf("Watch %q matched", w.Expression),
+			Body:      c.Summary,
+			URL:       c.SourceURL,
+			Tags:      c.Tags,
+		})
+		if err != nil {
+			slog.Error("failed to notify of watch match", "watch_id", w.ID, "user_id", w.UserID, "error", err)
+		}
+	}
+}
+
+// postgresWatches stores watches in the watches table.
+type postgresWatches struct {
+	db *sql.DB
+}
+
+func (s *postgresWatches) InWorkspace(ctx context.Context, workspace string) ([]Watch, error) {
+	return s.query(ctx, `
+		SELECT id, user_id, workspace_id, expression, created_at FROM watches
+		WHERE workspace_id = $1`, workspace)
+}
+
+func (s *postgresWatches) ForUser(ctx context.Context, userID string) ([]Watch, error) {
+	return s.query(ctx, `
+		SELECT id, user_id, workspace_id, expression, created_at FROM watches
+		WHERE user_id = $1 ORDER BY created_at`, userID)
+}
+
+func (s *postgresWatches) query(ctx context.Context, query string, args ...interface{}) ([]Watch, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var watches []Watch
+	for rows.Next() {
+		var w Watch
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Workspace, &w.Expression, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+func (s *postgresWatches) Add(ctx context.Context, w Watch) (Watch, error) {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO watches (user_id, workspace_id, expression)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, workspace_id, expression) DO UPDATE SET expression = EXCLUDED.expression
+		RETURNING id, created_at`,
+		w.UserID, w.Workspace, w.Expression).Scan(&w.ID, &w.CreatedAt)
+	return w, err
+}
+
+func (s *postgresWatches) Delete(ctx context.Context, userID, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM watches WHERE user_id = $1 AND id::text = $2`, userID, id)
+	return err
+}
+
+// Watches endpoint: GET ?user_id= lists a user's watches, POST adds one,
+// e.g. {"user_id": "alice", "expression": "cosmos sdk vulnerability"}, and
+// DELETE ?user_id=&id= removes one.
+func watchesHandler(store WatchStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			userID := r.URL.Query().Get("user_id")
+			if userID == "" {
+				http.Error(w, "user_id is required", http.StatusBadRequest)
+				return
+			}
+			watches, err := store.ForUser(r.Context(), userID)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to load watches", "user_id", userID, "error", err)
+				http.Error(w, "Failed to load watches", http.StatusInternalServerError)
+				return
+			}
+			if watches == nil {
+				watches = []Watch{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"watches": watches})
+
+		case http.MethodPost:
+			var watch Watch
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&watch); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			watch.Expression = strings.TrimSpace(watch.Expression)
+			if watch.Workspace == "" {
+				watch.Workspace = "default"
+			}
+			if watch.UserID == "" {
+				http.Error(w, "user_id is required", http.StatusBadRequest)
+				return
+			}
+			if _, err := parseWatch(watch.Expression); err != nil || len(watch.Expression) > maxWatchLength {
+				http.Error(w, fmt.Sprintf("expression must have words and at most %d characters", maxWatchLength), http.StatusBadRequest)
+				return
+			}
+			existing, err := store.ForUser(r.Context(), watch.UserID)
+			if err == nil && len(existing) >= maxWatchesPerUser {
+				http.Error(w, fmt.Sprintf("At most %d watches per user", maxWatchesPerUser), http.StatusBadRequest)
+				return
+			}
+			if watch, err = store.Add(r.Context(), watch); err != nil {
+				logging.FromContext(r.Context()).Error("failed to save watch", "user_id", watch.UserID, "error", err)
+				http.Error(w, "Failed to save watch", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(watch)
+
+		case http.MethodDelete:
+			q := r.URL.Query()
+			if q.Get("user_id") == "" || q.Get("id") == "" {
+				http.Error(w, "user_id and id are required", http.StatusBadRequest)
+				return
+			}
+			if err := store.Delete(r.Context(), q.Get("user_id"), q.Get("id")); err != nil {
+				logging.FromContext(r.Context()).Error("failed to delete watch", "error", err)
+				http.Error(w, "Failed to delete watch", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"selin/internal/events"
+	"selin/internal/search"
+)
+
+// memoryWatches is an in-memory WatchStore for tests.
+type memoryWatches struct {
+	watches []Watch
+}
+
+func (m *memoryWatches) InWorkspace(ctx context.Context, workspace string) ([]Watch, error) {
+	var out []Watch
+	for _, w := range m.watches {
+		if w.Workspace == workspace {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryWatches) ForUser(ctx context.Context, userID string) ([]Watch, error) {
+	var out []Watch
+	for _, w := range m.watches {
+		if w.UserID == userID {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryWatches) Add(ctx context.Context, w Watch) (Watch, error) {
+	w.ID = fmt.Sprintf("w%d", len(m.watches)+1)
+	m.watches = append(m.watches, w)
+	return w, nil
+}
+
+func (m *memoryWatches) Delete(ctx context.Context, userID, id string) error {
+	kept := m.watches[:0]
+	for _, w := range m.watches {
+		if w.UserID != userID || w.ID != id {
+			kept = append(kept, w)
+		}
+	}
+	m.watches = kept
+	return nil
+}
+
+// recordingBus remembers what was published on it.
+type recordingBus struct {
+	published []events.Event
+}
+
+func (b *recordingBus) Publish(ctx context.Context, e events.Event) error {
+	b.published = append(b.published, e)
+	return nil
+}
+
+func (b *recordingBus) Subscribe(ctx context.Context, handle func(events.Event), types ...string) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (b *recordingBus) Close() error { return nil }
+
+func TestParseWatch(t *testing.T) {
+	for _, expr := range []string{"", "   ", `""`, "*", "!?"} {
+		if _, err := parseWatch(expr); err == nil {
+			t.Errorf("Expected %q to be rejected", expr)
+		}
+	}
+
+	terms, err := parseWatch(`"Go 1.23" releas*`)
+	if err != nil || len(terms) != 2 {
+		t.Fatalf("Expected a phrase and a word, got %+v (%v)", terms, err)
+	}
+	if len(terms[0].words) != 2 || terms[0].words[1] != "1.23" || terms[0].prefix {
+		t.Errorf("Expected the quoted phrase kept whole, got %+v", terms[0])
+	}
+	if terms[1].words[0] != "releas" || !terms[1].prefix {
+		t.Errorf("Expected a prefix word, got %+v", terms[1])
+	}
+}
+
+func TestMatchingWatches(t *testing.T) {
+	watches := []Watch{
+		{ID: "cve", Expression: "CVE"},
+		{ID: "cosmos", Expression: "cosmos sdk vulnerability"},
+		{ID: "go", Expression: `"go 1.23" releas*`},
+		{ID: "phrase", Expression: `"sdk cosmos"`},
+	}
+	cases := []struct {
+		summary string
+		tags    []string
+		want    []string
+	}{
+		{"Patch for CVE-2024-3094 in xz", nil, []string{"cve"}},
+		{"A vulnerability in the SDK", []string{"cosmos"}, []string{"cosmos"}},
+		{"Go 1.23 has been released", nil, []string{"go"}},
+		{"Go 1.23rc1 is out, release notes inside", nil, nil},
+		{"Cosmos news", nil, nil},
+	}
+	for _, c := range cases {
+		got := matchingWatches(watches, events.Content{Summary: c.summary, Tags: c.tags})
+		var ids []string
+		for _, w := range got {
+			ids = append(ids, w.ID)
+		}
+		if len(ids) != len(c.want) || (len(ids) > 0 && ids[0] != c.want[0]) {
+			t.Errorf("%q: expected %v to match, got %v", c.summary, c.want, ids)
+		}
+	}
+}
+
+func TestNotifyWatches(t *testing.T) {
+	prefs := &memoryPreferences{prefs: []Preference{
+		{Workspace: "default", UserID: "alice", EventType: EventWatchMatch, Channel: ChannelEmail, Target: "alice@example.com"},
+	}}
+	email := &recordingSink{}
+	n := NewNotifier(prefs, map[string]Sink{ChannelEmail: email})
+	store := &memoryWatches{watches: []Watch{
+		{ID: "w1", UserID: "alice", Workspace: "default", Expression: "cve"},
+		{ID: "w2", UserID: "bob", Workspace: "team", Expression: "cve"},
+	}}
+	bus := &recordingBus{}
+
+	e, _ := events.New(events.ContentCreated, "default", events.Content{ID: "c1", Summary: "CVE-2024-3094 in xz", SourceURL: "https://example.com/xz"})
+	notifyWatches(context.Background(), n, store, bus, e)
+	if len(bus.published) != 1 || bus.published[0].Type != events.WatchMatched {
+		t.Fatalf("Expected one watch.matched event, got %+v", bus.published)
+	}
+	var match events.WatchMatch
+	if err := bus.published[0].Decode(&match); err != nil || match.UserID != "alice" || match.Content.ID != "c1" {
+		t.Errorf("Expected alice's match of c1, got %+v (%v)", match, err)
+	}
+	// Watch matches skip the digest
+	if len(email.sent) != 1 || email.sent[0].n.Events[0].URL != "https://example.com/xz" {
+		t.Errorf("Expected alice emailed right away, got %+v", email.sent)
+	}
+
+	private, _ := events.New(events.ContentCreated, "default", events.Content{ID: "c2", Summary: "Internal CVE triage", Visibility: search.VisibilityPrivate})
+	notifyWatches(context.Background(), n, store, bus, private)
+	if len(bus.published) != 2 || len(email.sent) != 1 {
+		t.Errorf("Expected private content pushed but not emailed, got %d events and %d emails", len(bus.published), len(email.sent))
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"selin/internal/adminauth"
+	"selin/internal/config"
+	"selin/internal/keyring"
+	"selin/internal/logging"
+	"selin/internal/pipeline"
+	"selin/internal/storage"
+)
+
+// collectNow wakes the collection loop; it holds at most one pending request.
+var collectNow = make(chan struct{}, 1)
+
+// collectHandler serves POST /collect, starting a collection cycle now
+// instead of after the current wait.
+func collectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+
+	queued := true
+	select {
+	case collectNow <- struct{}{}:
+	default:
+		queued = false // a cycle is already pending
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"queued": queued})
+}
+
+// rescoreHandler serves POST /rescore, recomputing relevance scores of all
+// stored Reddit content with the current keyword list, topic weights and
+// author reputations, keeping each item's feedback adjustment.
+func rescoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+
+	db, err := sql.Open("postgres", config.PostgresDSN("reddit-collector/rescore"))
+	if err != nil {
+		http.Error(w, "Database not ready", http.StatusServiceUnavailable)
+		return
+	}
+	defer db.Close()
+
+	if err := loadTopicWeights(r.Context(), db); err != nil {
+		logging.FromContext(r.Context()).Warn("rescoring without fresh topic weights", "error", err)
+	}
+	scanned, updated, err := rescoreContent(r.Context(), db)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("rescore failed", "error", err)
+		http.Error(w, "Rescore failed", http.StatusInternalServerError)
+		return
+	}
+	logging.FromContext(r.Context()).Info("rescored posts", "scanned", scanned, "changed", updated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"scanned": scanned, "updated": updated})
+}
+
+// rescoreContent scores posts the way they were scored when collected:
+// from their full text, read back from their chunks, then weighed by the
+// pipeline's reputation stage. Posts without chunks are left as they are,
+// since their summary alone would score them too low.
+func rescoreContent(ctx context.Context, db *sql.DB) (scanned, updated int, err error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.id, c.workspace_id, COALESCE(c.author, ''), c.relevance_score, c.feedback_adjustment, ch.text
+		FROM content_metadata c
+		JOIN content_chunks ch ON ch.content_id = c.id
+		WHERE c.source_platform = 'reddit'
+		ORDER BY c.id, ch.position`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load content: %v", err)
+	}
+
+	type post struct {
+		item       pipeline.ContentItem
+		adjustment float64
+		text       []string
+	}
+	var posts []*post
+	keys := keyring.Default()
+	for rows.Next() {
+		var id, workspace, author, chunk string
+		var score, adjustment float64
+		if err := rows.Scan(&id, &workspace, &author, &score, &adjustment, &chunk); err != nil {
+			continue
+		}
+		if n := len(posts); n == 0 || posts[n-1].item.ID != id {
+			posts = append(posts, &post{adjustment: adjustment, item: pipeline.ContentItem{Content: storage.Content{
+				ID: id, Workspace: workspace, Author: author, SourcePlatform: "reddit", RelevanceScore: score,
+			}}})
+		}
+		text, err := keys.OpenString(ctx, workspace, chunk)
+		if err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to open %s: %v", id, err)
+		}
+		p := posts[len(posts)-1]
+		p.text = append(p.text, text)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to load content: %v", err)
+	}
+
+	reputation := pipeline.Reputation(db)
+	for _, p := range posts {
+		scanned++
+		score := p.item.RelevanceScore
+		p.item.RelevanceScore = calculateRelevanceScore(strings.Join(p.text, " "))
+		if err := reputation.Run(ctx, &p.item); err != nil {
+			logging.FromContext(ctx).Warn("rescoring without author reputation", "content_id", p.item.ID, "error", err)
+		}
+		base := p.item.RelevanceScore
+		next := math.Min(math.Max(base+p.adjustment, 0), 1)
+		if math.Abs(next-score) <= 1e-6 {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE content_metadata SET relevance_score = $1, base_relevance_score = $2, updated_at = now() WHERE id = $3`, next, base, p.item.ID); err != nil {
+			return scanned, updated, fmt.Errorf("failed to update %s: %v", p.item.ID, err)
+		}
+		updated++
+	}
+	return scanned, updated, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"selin/internal/config"
+	"selin/internal/fetch"
+	"selin/internal/healthcheck"
+)
+
+// Each source's credentials and quota are probed for /ready, so expired
+// OAuth credentials or an exhausted rate limit show up there and on
+// /metrics rather than only as failed cycles. Both checks are optional:
+// restarting does not fix them.
+
+var redditTokenURL = "https://www.reddit.com/api/v1/access_token"
+
+var (
+	credentialsValid = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_credentials_valid",
+			Help: "Whether the source accepted the collector's credentials when last probed (1) or rejected them (0)",
+		},
+		[]string{"source"},
+	)
+
+	quotaRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_quota_remaining",
+			Help: "Requests the source allows before its rate limit resets, as it last reported",
+		},
+		[]string{"source"},
+	)
+
+	quotaResetSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_quota_reset_seconds",
+			Help: "Seconds until the source's rate limit resets, as it last reported",
+		},
+		[]string{"source"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(credentialsValid)
+	prometheus.MustRegister(quotaRemaining)
+	prometheus.MustRegister(quotaResetSeconds)
+}
+
+// redditCredentials asks Reddit for an application token with
+// REDDIT_CLIENT_ID and REDDIT_CLIENT_SECRET, resolved on every probe so
+// rotated credentials are the ones checked. It fails when Reddit rejects
+// them; Reddit being unreachable leaves the gauge as it was.
+func redditCredentials(userAgent string) healthcheck.Probe {
+	return func(ctx context.Context) error {
+		clientID, secret := config.Secret("REDDIT_CLIENT_ID"), config.Secret("REDDIT_CLIENT_SECRET")
+		if clientID == "" || secret == "" {
+			return errors.New("REDDIT_CLIENT_ID and REDDIT_CLIENT_SECRET are not set")
+		}
+		form := url.Values{"grant_type": {"client_credentials"}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, redditTokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(clientID, secret)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", userAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var token struct {
+			AccessToken string `json:"access_token"`
+			Error       string `json:"error"`
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			credentialsValid.WithLabelValues("reddit").Set(0)
+			return fmt.Errorf("Reddit rejected REDDIT_CLIENT_ID and REDDIT_CLIENT_SECRET (%d)", resp.StatusCode)
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("%s returned %d", redditTokenURL, resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return fmt.Errorf("invalid token response: %v", err)
+		}
+		if token.AccessToken == "" {
+			credentialsValid.WithLabelValues("reddit").Set(0)
+			return fmt.Errorf("Reddit refused a token: %s", token.Error)
+		}
+		credentialsValid.WithLabelValues("reddit").Set(1)
+		return nil
+	}
+}
+
+// rateLimit is a source's quota as its last response reported it.
+type rateLimit struct {
+	mu        sync.Mutex
+	source    string
+	known     bool
+	remaining float64
+	resets    time.Time
+}
+
+// redditQuota follows Reddit's X-Ratelimit headers on the listings.
+var redditQuota = &rateLimit{source: "reddit"}
+
+// observe records the quota reported in a response's headers, if any.
+func (q *rateLimit) observe(header http.Header, now time.Time) {
+	remaining, err := strconv.ParseFloat(header.Get("X-Ratelimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+	reset, _ := strconv.ParseFloat(header.Get("X-Ratelimit-Reset"), 64)
+	q.set(remaining, now.Add(time.Duration(reset*float64(time.Second))))
+}
+
+// observeError counts a 429 as the quota used up until the next cycle, as
+// the headers saying when it resets do not come with the error.
+func (q *rateLimit) observeError(err error, now time.Time) {
+	var statusErr *fetch.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+		q.set(0, now.Add(collectInterval))
+	}
+}
+
+func (q *rateLimit) set(remaining float64, resets time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.known, q.remaining, q.resets = true, remaining, resets
+	quotaRemaining.WithLabelValues(q.source).Set(remaining)
+	quotaResetSeconds.WithLabelValues(q.source).Set(max(time.Until(resets).Seconds(), 0))
+}
+
+// probe fails while the quota is used up and has not reset yet.
+func (q *rateLimit) probe(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.known && q.remaining < 1 && time.Now().Before(q.resets) {
+		return fmt.Errorf("%s rate limit exhausted, resets in %s", q.source, time.Until(q.resets).Round(time.Second))
+	}
+	return nil
+}
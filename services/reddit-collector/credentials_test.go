@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"selin/internal/config"
+	"selin/internal/fetch"
+)
+
+func TestRateLimit(t *testing.T) {
+	q := &rateLimit{source: "test"}
+	ctx := context.Background()
+	now := time.Now()
+	if err := q.probe(ctx); err != nil {
+		t.Errorf("Expected an unknown quota to pass, got %v", err)
+	}
+
+	q.observe(http.Header{}, now)
+	if q.known {
+		t.Error("Expected a response without X-Ratelimit headers ignored")
+	}
+
+	q.observe(http.Header{"X-Ratelimit-Remaining": {"42.0"}, "X-Ratelimit-Reset": {"120"}}, now)
+	if err := q.probe(ctx); err != nil {
+		t.Errorf("Expected quota left to pass, got %v", err)
+	}
+	if got := testutil.ToFloat64(quotaRemaining.WithLabelValues("test")); got != 42 {
+		t.Errorf("Expected 42 requests remaining on /metrics, got %v", got)
+	}
+
+	q.observe(http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"120"}}, now)
+	if err := q.probe(ctx); err == nil {
+		t.Error("Expected an exhausted quota to fail")
+	}
+	if got := testutil.ToFloat64(quotaResetSeconds.WithLabelValues("test")); got < 110 || got > 120 {
+		t.Errorf("Expected the quota to reset in about 120s, got %v", got)
+	}
+
+	// Once it resets the quota is no longer exhausted
+	q.observe(http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"120"}}, now.Add(-time.Hour))
+	if err := q.probe(ctx); err != nil {
+		t.Errorf("Expected a reset quota to pass, got %v", err)
+	}
+}
+
+func TestRateLimitObserveError(t *testing.T) {
+	q := &rateLimit{source: "test"}
+	ctx := context.Background()
+	q.observeError(&fetch.StatusError{URL: "https://reddit.test", StatusCode: http.StatusInternalServerError}, time.Now())
+	q.observeError(errors.New("connection refused"), time.Now())
+	if err := q.probe(ctx); err != nil {
+		t.Errorf("Expected errors other than 429 ignored, got %v", err)
+	}
+	q.observeError(&fetch.StatusError{URL: "https://reddit.test", StatusCode: http.StatusTooManyRequests}, time.Now())
+	if err := q.probe(ctx); err == nil {
+		t.Error("Expected a 429 to exhaust the quota until the next cycle")
+	}
+}
+
+func TestRedditCredentials(t *testing.T) {
+	status := http.StatusOK
+	body := `{"access_token":"token"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+			t.Errorf("Expected the client credentials, got %q %q", id, secret)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	tokenURL := redditTokenURL
+	redditTokenURL = srv.URL
+	t.Cleanup(func() { redditTokenURL = tokenURL })
+	t.Setenv("REDDIT_CLIENT_ID", "client")
+	t.Setenv("REDDIT_CLIENT_SECRET", "secret")
+	config.Secrets().Reload()
+
+	probe := redditCredentials("selin-test")
+	valid := credentialsValid.WithLabelValues("reddit")
+	ctx := context.Background()
+	if err := probe(ctx); err != nil || testutil.ToFloat64(valid) != 1 {
+		t.Errorf("Expected the credentials accepted, got %v", err)
+	}
+
+	status = http.StatusUnauthorized
+	body = `{"message":"Unauthorized","error":401}`
+	if err := probe(ctx); err == nil || testutil.ToFloat64(valid) != 0 {
+		t.Errorf("Expected a 401 to mark the credentials invalid, got %v", err)
+	}
+
+	status = http.StatusOK
+	body = `{"error":"invalid_grant"}`
+	valid.Set(1)
+	if err := probe(ctx); err == nil || testutil.ToFloat64(valid) != 0 {
+		t.Errorf("Expected a refused token to mark the credentials invalid, got %v", err)
+	}
+
+	status = http.StatusBadGateway
+	valid.Set(1)
+	if err := probe(ctx); err == nil || testutil.ToFloat64(valid) != 1 {
+		t.Errorf("Expected Reddit failing to leave the credentials as they were, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/lib/pq"
+
+	"selin/internal/config"
+	"selin/internal/storage"
+)
+
+// engagementRetentionDays is how long engagement snapshots are kept.
+const engagementRetentionDays = 14
+
+// recordEngagement snapshots the Reddit score and comment count of the
+// posts stored as content, every cycle, including posts skipped as
+// unchanged. The MCP server's get_engagement_trends tool finds the posts
+// whose engagement is accelerating in them. Posts left out as irrelevant
+// have no content to belong to and are not recorded.
+func recordEngagement(ctx context.Context, workspace string, posts []RedditPost) {
+	if storage.Driver() != "postgres" || len(posts) == 0 {
+		return
+	}
+	urls := make([]string, len(posts))
+	scores := make([]int64, len(posts))
+	comments := make([]int64, len(posts))
+	for i, post := range posts {
+		urls[i] = "https://reddit.com" + post.Permalink
+		scores[i], comments[i] = int64(post.Score), int64(post.NumComments)
+	}
+
+	db, err := sql.Open("postgres", config.PostgresDSN("reddit-collector"))
+	if err != nil {
+		slog.Warn("failed to record engagement", "error", err)
+		return
+	}
+	defer db.Close()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO content_engagement_snapshots (content_id, workspace_id, score, num_comments)
+		SELECT c.id, c.workspace_id, p.score, p.num_comments
+		FROM unnest($2::text[], $3::bigint[], $4::bigint[]) AS p(source_url, score, num_comments)
+		JOIN content_metadata c ON c.workspace_id = $1 AND c.source_url = p.source_url`,
+		workspace, pq.Array(urls), pq.Array(scores), pq.Array(comments))
+	if err != nil {
+		slog.Warn("failed to record engagement", "error", err)
+	}
+}
+
+// pruneEngagement drops the snapshots older than engagementRetentionDays.
+func pruneEngagement(ctx context.Context) {
+	if storage.Driver() != "postgres" {
+		return
+	}
+	db, err := sql.Open("postgres", config.PostgresDSN("reddit-collector"))
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	_, err = db.ExecContext(ctx, `DELETE FROM content_engagement_snapshots WHERE collected_at < now() - make_interval(days => $1)`,
+		engagementRetentionDays)
+	if err != nil {
+		slog.Warn("failed to prune engagement snapshots", "error", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"selin/internal/events"
+	"selin/internal/search"
+)
+
+// announceContent tells other services about newly stored content. With an
+// event bus it publishes content.created, which the ws service and the
+// notifier subscribe to; without one it calls them directly.
+func announceContent(content ContentMetadata) {
+	if events.Enabled("reddit-collector") {
+		events.Emit("reddit-collector", events.ContentCreated, collectorWorkspace(), contentEvent(content))
+		return
+	}
+	publishContentNew(content)
+	notifyHighRelevance(content)
+}
+
+func contentEvent(content ContentMetadata) events.Content {
+	return events.Content{
+		ID:         content.ID,
+		Platform:   content.SourcePlatform,
+		Tags:       content.Tags,
+		Score:      content.RelevanceScore,
+		Summary:    content.ContentSummary,
+		SourceURL:  content.SourceURL,
+		Visibility: content.Visibility,
+		Timestamp:  content.Timestamp,
+	}
+}
+
+// publishContentNew announces newly stored content through the ws
+// service, without holding up collection.
+func publishContentNew(content ContentMetadata) {
+	events.PublishWS(events.ContentNewTopic, collectorWorkspace(), content.Tags, contentEvent(content))
+}
+
+// notifyHighRelevance reports new content scoring at least NOTIFY_MIN_SCORE
+// to the notifier service, which forwards it to users who asked for it.
+func notifyHighRelevance(content ContentMetadata) {
+	minScore, err := strconv.ParseFloat(os.Getenv("NOTIFY_MIN_SCORE"), 64)
+	if err != nil {
+		minScore = 0.8
+	}
+	if content.RelevanceScore < minScore || content.Visibility == search.VisibilityPrivate {
+		return
+	}
+	events.Notify(events.Notification{
+		Type:      "high_relevance_content",
+		Title:     fmt.Sprintf("New in %s (score %.1f)", strings.Join(content.Tags, ", "), content.RelevanceScore),
+		Body:      content.ContentSummary,
+		URL:       content.SourceURL,
+		Tags:      content.Tags,
+		Workspace: collectorWorkspace(),
+	})
+}
@@ -0,0 +1,150 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"selin/internal/tagging"
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration . (needs a Docker daemon)
+
+func TestStoreContentAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	t.Setenv("COLLECTOR_WORKSPACE", "team")
+	if err := tagging.SetAlias(context.Background(), db, "team", "containerization", "docker"); err != nil {
+		t.Fatal(err)
+	}
+
+	post := RedditPost{
+		ID:         "abc123",
+		Title:      "Deploying golang microservices with docker on kubernetes",
+		Author:     "gopher",
+		Subreddit:  "golang",
+		Permalink:  "/r/golang/comments/abc123/deploying/",
+		CreatedUTC: float64(time.Now().Add(-time.Hour).Unix()),
+	}
+	content := convertToContentMetadata(post)
+	if !shouldStore(content) {
+		t.Fatalf("Expected the post to be relevant enough to store, scored %v", content.RelevanceScore)
+	}
+	if err := storeContent(content); err != nil {
+		t.Fatal(err)
+	}
+
+	var id, workspace, tags string
+	var score float64
+	err := db.QueryRow(`
+		SELECT id, workspace_id, array_to_string(tags, ','), relevance_score
+		FROM content_metadata WHERE source_url = $1`, content.SourceURL).Scan(&id, &workspace, &tags, &score)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workspace != "team" {
+		t.Errorf("Expected the collector workspace, got %q", workspace)
+	}
+	for _, want := range []string{"golang", "kubernetes", "docker"} {
+		if !containsTag(tags, want) {
+			t.Errorf("Expected tag %q in %q", want, tags)
+		}
+	}
+	if containsTag(tags, "containerization") {
+		t.Errorf("Expected the alias to be applied, got %q", tags)
+	}
+
+	var mentions int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM concept_mentions WHERE content_id = $1`, id).Scan(&mentions); err != nil {
+		t.Fatal(err)
+	}
+	if mentions == 0 {
+		t.Error("Expected the post's concepts to be stored")
+	}
+
+	// Collecting the post again, now scoring higher, rescores the stored row
+	post.SelfText = "Goroutine tricks for blockchain indexers"
+	again := convertToContentMetadata(post)
+	if err := storeContent(again); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	var rescored float64
+	if err := db.QueryRow(`SELECT COUNT(*), MAX(relevance_score) FROM content_metadata WHERE source_url = $1`,
+		content.SourceURL).Scan(&rows, &rescored); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 || rescored <= score {
+		t.Errorf("Expected one row rescored above %v, got %d rows scoring %v", score, rows, rescored)
+	}
+
+	var changedBy string
+	if err := db.QueryRow(`SELECT changed_by FROM content_revisions WHERE content_id = $1`, id).Scan(&changedBy); err != nil {
+		t.Fatalf("Expected the rescore to be recorded as a revision: %v", err)
+	}
+	if changedBy != "reddit-collector" {
+		t.Errorf("Expected the revision to be attributed to reddit-collector, got %q", changedBy)
+	}
+
+	// Every cycle snapshots the engagement of the posts stored as content
+	post.Score, post.NumComments = 42, 7
+	unrelated := RedditPost{ID: "zzz999", Permalink: "/r/golang/comments/zzz999/never_stored/", Score: 1}
+	recordEngagement(context.Background(), "team", []RedditPost{post, unrelated})
+	var snapshots, snapScore, snapComments int
+	if err := db.QueryRow(`SELECT COUNT(*), MAX(score), MAX(num_comments) FROM content_engagement_snapshots WHERE workspace_id = 'team'`).
+		Scan(&snapshots, &snapScore, &snapComments); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots != 1 || snapScore != 42 || snapComments != 7 {
+		t.Errorf("Expected one snapshot of score 42 and 7 comments, got %d of %d and %d", snapshots, snapScore, snapComments)
+	}
+}
+
+// TestRescoreAgainstPostgres checks rescoring reads the full text of posts,
+// not their summary.
+func TestRescoreAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+	post := RedditPost{
+		ID:         "long1",
+		Title:      "Notes from a long week",
+		SelfText:   strings.Repeat("Nothing relevant here. ", 20) + "Then golang and kubernetes.",
+		Author:     "[deleted]",
+		Subreddit:  "programming",
+		Permalink:  "/r/programming/comments/long1/notes/",
+		CreatedUTC: float64(time.Now().Unix()),
+	}
+	content := convertToContentMetadata(post)
+	if err := storeContent(content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO content_metadata (source_url, source_platform, content_summary, relevance_score)
+		VALUES ('https://reddit.com/r/golang/no-chunks', 'reddit', 'golang', 0.9)`); err != nil {
+		t.Fatal(err)
+	}
+
+	scanned, updated, err := rescoreContent(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned != 1 || updated != 0 {
+		t.Errorf("Expected only the chunked post scanned and kept as scored, got %d scanned and %d updated", scanned, updated)
+	}
+	var score float64
+	if err := db.QueryRow(`SELECT relevance_score FROM content_metadata WHERE source_url = $1`, content.SourceURL).Scan(&score); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(score-content.RelevanceScore) > 1e-6 {
+		t.Errorf("Expected keywords past the summary to still count, got %v instead of %v", score, content.RelevanceScore)
+	}
+}
+
+func containsTag(tags, tag string) bool {
+	return slices.Contains(strings.Split(tags, ","), tag)
+}
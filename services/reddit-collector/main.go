@@ -1,17 +1,35 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"selin/internal/chunker"
+	"selin/internal/config"
+	"selin/internal/events"
+	"selin/internal/fetch"
+	"selin/internal/flags"
+	"selin/internal/healthcheck"
+	"selin/internal/leader"
+	"selin/internal/links"
+	"selin/internal/logging"
+	"selin/internal/pipeline"
+	"selin/internal/search"
+	"selin/internal/storage"
+	"selin/internal/tokenizer"
 )
 
 type RedditPost struct {
@@ -25,6 +43,10 @@ type RedditPost struct {
 	CreatedUTC  float64 `json:"created_utc"`
 	Permalink   string  `json:"permalink"`
 	NumComments int     `json:"num_comments"`
+	// Set on crossposts: the post this one was crossposted from
+	CrosspostParentList []struct {
+		Permalink string `json:"permalink"`
+	} `json:"crosspost_parent_list"`
 }
 
 type RedditResponse struct {
@@ -36,62 +58,225 @@ type RedditResponse struct {
 }
 
 type ContentMetadata struct {
-	ID             string    `json:"id"`
-	SourceURL      string    `json:"source_url"`
-	Author         string    `json:"author"`
-	Timestamp      time.Time `json:"timestamp"`
-	Tags           []string  `json:"tags"`
-	ContentType    string    `json:"content_type"`
-	SourcePlatform string    `json:"source_platform"`
-	Language       string    `json:"language"`
-	ContentSummary string    `json:"content_summary"`
-	RelevanceScore float64   `json:"relevance_score"`
+	ID             string             `json:"id"`
+	SourceURL      string             `json:"source_url"`
+	Author         string             `json:"author"`
+	Timestamp      time.Time          `json:"timestamp"`
+	Tags           []string           `json:"tags"`
+	ContentType    string             `json:"content_type"`
+	SourcePlatform string             `json:"source_platform"`
+	Language       string             `json:"language"`
+	ContentSummary string             `json:"content_summary"`
+	RelevanceScore float64            `json:"relevance_score"`
+	Visibility     string             `json:"visibility"`
+	License        string             `json:"license"`
+	Concepts       []pipeline.Concept `json:"concepts,omitempty"`
+	// DerivedFrom is the source URL of the content this was made from
+	DerivedFrom string `json:"derived_from,omitempty"`
+	// LinkURL is the page a link post shares
+	LinkURL string `json:"link_url,omitempty"`
+	// Text is the title and text the post is chunked from
+	Text string `json:"-"`
+	// Tokens is the length of Text in tokens, set once stored
+	Tokens int `json:"token_count"`
 }
 
+// chunking is how posts are split, set from CHUNKING_CONFIG_FILE at
+// startup.
+var chunking = chunker.DefaultConfig()
+
+// reddit fetches listings, spacing requests to Reddit and retrying the ones
+// it turns away; set up at startup with REDDIT_USER_AGENT.
+var reddit = fetch.New("reddit", fetch.DefaultOptions())
+
+// pages fetches the articles posts link to, following robots.txt.
+var pages = fetch.New("links", fetch.DefaultOptions())
+
+// redditHosts are the links that are not followed: other posts, and
+// Reddit's own image and video hosting.
+var redditHosts = []string{"reddit.com", "redd.it", "redditmedia.com"}
+
+// seen remembers the posts stored, so unchanged ones are skipped; set up
+// at startup with the group's Redis and REDDIT_SEEN_TTL.
+var seen = newSeenPosts(nil, 24*time.Hour)
+
+// How often each subreddit is collected.
+const collectInterval = 5 * time.Minute
+
+// A replica's subreddits move to the others this long after it stops
+// announcing itself.
+const memberTTL = 30 * time.Second
+
+// How long announcements of the last stored posts may take to go out on
+// shutdown.
+const flushTimeout = 10 * time.Second
+
+// Reddit posts are public, stored under Reddit's user agreement (named as
+// in the backfill in init-database.sql).
+const redditLicense = "reddit-user-agreement"
+
 func main() {
-	log.Println("🚀 Starting Reddit Collector...")
+	logging.Setup("reddit-collector", "1.0.0")
+	// Fail at startup rather than on first use when the flags, the
+	// tokenizer vocabulary or the event bus are misconfigured
+	flags.Default()
+	tokenizer.Default()
+	events.Default("reddit-collector")
+	slog.Info("starting reddit collector")
+
+	var err error
+	if chunking, err = chunker.FromEnv(); err != nil {
+		logging.Fatal("failed to load chunking config", "error", err)
+	}
 
 	// Configuration from environment or defaults
 	subreddits := getSubreddits()
-	userAgent := os.Getenv("REDDIT_USER_AGENT")
-	if userAgent == "" {
-		userAgent = "selin-bot/1.0"
+	reddit = fetch.New("reddit", fetch.OptionsFromEnv(os.Getenv("REDDIT_USER_AGENT")))
+	pageOptions := fetch.OptionsFromEnv(os.Getenv("REDDIT_USER_AGENT"))
+	pageOptions.Robots = true
+	pages = fetch.New("links", pageOptions)
+
+	// SIGTERM stops collection after the post being stored
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// With Redis, replicas split the subreddits between them; without it
+	// this instance collects them all. The group is left last, once
+	// nothing is being collected.
+	group := leader.GroupFromEnv("reddit-collector:sources", memberTTL)
+	groupCtx, leaveGroup := context.WithCancel(context.Background())
+	groupDone := make(chan struct{})
+	go func() {
+		defer close(groupDone)
+		group.Run(groupCtx)
+	}()
+	seenTTL, err := time.ParseDuration(config.Env("REDDIT_SEEN_TTL", "24h"))
+	if err != nil || seenTTL <= 0 {
+		logging.Fatal("invalid REDDIT_SEEN_TTL", "value", os.Getenv("REDDIT_SEEN_TTL"))
 	}
-
-	log.Printf("📡 Collecting from subreddits: %v", subreddits)
+	seen = newSeenPosts(group.Client(), seenTTL)
+	status.Lock()
+	status.Instance = group.ID()
+	status.Unlock()
+	slog.Info("collecting from subreddits", "subreddits", subreddits, "instance", group.ID())
 
 	// Start HTTP server for health checks
-	go startHealthServer()
+	server := startHealthServer(group)
+
+	// Collection loop; POST /collect starts the next cycle early
+	for ctx.Err() == nil {
+		collectAll(ctx, group, subreddits)
+		statusFinished(time.Now().Add(collectInterval))
+
+		slog.Info("waiting before next collection", "interval", collectInterval)
+		select {
+		case <-time.After(collectInterval):
+		case <-collectNow:
+			slog.Info("collection cycle requested")
+		case <-ctx.Done():
+		}
+	}
+	slog.Info("shutting down reddit collector")
+
+	// Send what was announced last before leaving
+	flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := events.Flush(flushCtx); err != nil {
+		slog.Warn("gave up on announcements still being sent", "error", err)
+	}
+	leaveGroup()
+	<-groupDone
+	if err := server.Shutdown(flushCtx); err != nil {
+		slog.Error("server forced to shutdown", "error", err)
+	}
+	slog.Info("reddit collector stopped")
+}
 
-	// Collection loop
-	for {
-		for _, subreddit := range subreddits {
-			log.Printf("🔍 Collecting from r/%s...", subreddit)
-			posts, err := collectFromSubreddit(subreddit, userAgent)
+// collectAll collects the subreddits assigned to this instance. Each is
+// leased until a minute past the next cycle, so another replica only picks
+// it up once this one stops collecting it.
+//
+// Once ctx is done collectAll returns after the post being stored, leaving
+// the rest of the cycle to the next one: a fetch in flight is aborted, but
+// a post is never stored halfway.
+func collectAll(ctx context.Context, group *leader.Group, subreddits []string) {
+	refreshTopicWeights(ctx)
+	pruneEngagement(ctx)
+	mine, err := group.Assign(ctx, subreddits)
+	if err != nil {
+		// Skip the cycle rather than collect what another replica may
+		slog.Error("failed to assign subreddits", "error", err)
+	}
+	statusStarted(mine)
+	for _, subreddit := range mine {
+		if ctx.Err() != nil {
+			slog.Info("collection cycle interrupted", "subreddit", subreddit)
+			return
+		}
+		if ok, err := group.Claim(ctx, subreddit, collectInterval+time.Minute); !ok {
 			if err != nil {
-				log.Printf("❌ Error collecting from r/%s: %v", subreddit, err)
-				continue
+				slog.Error("failed to lease subreddit", "subreddit", subreddit, "error", err)
+				statusCollected(subreddit, 0, 0, 0, err)
+			} else {
+				slog.Info("subreddit still leased by another instance", "subreddit", subreddit)
 			}
+			continue
+		}
+		slog.Info("collecting subreddit", "subreddit", subreddit)
+		posts, err := collectFromSubreddit(ctx, subreddit)
+		if ctx.Err() != nil {
+			slog.Info("collection cycle interrupted", "subreddit", subreddit)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to collect subreddit", "subreddit", subreddit, "error", err)
+			statusCollected(subreddit, 0, 0, 0, err)
+			continue
+		}
+
+		slog.Info("found posts", "subreddit", subreddit, "posts", len(posts))
 
-			log.Printf("📊 Found %d posts in r/%s", len(posts), subreddit)
-
-			// Process and store posts
-			for _, post := range posts {
-				content := convertToContentMetadata(post)
-				if shouldStore(content) {
-					if err := storeContent(content); err != nil {
-						log.Printf("❌ Error storing post %s: %v", post.ID, err)
-					} else {
-						log.Printf("✅ Stored post: %s", post.Title[:min(50, len(post.Title))])
-					}
+		// Process and store posts, skipping those stored before that have
+		// not changed since
+		workspace := collectorWorkspace()
+		ids := make([]string, len(posts))
+		for i, post := range posts {
+			ids[i] = post.ID
+		}
+		known := seen.lookup(ctx, workspace, ids)
+		stored, unchanged := 0, 0
+		for i, post := range posts {
+			if ctx.Err() != nil {
+				slog.Info("collection cycle interrupted", "subreddit", subreddit, "posts_left", len(posts)-i)
+				break
+			}
+			if s, ok := known[post.ID]; ok && !s.changed(post) {
+				unchanged++
+				continue
+			}
+			content := convertToContentMetadata(post)
+			if shouldStore(content) {
+				if err := storeContent(content); err != nil {
+					slog.Error("failed to store post", "post_id", post.ID, "error", err)
+				} else {
+					stored++
+					seen.mark(context.Background(), workspace, post)
+					slog.Debug("stored post", "post_id", post.ID, "title", post.Title[:min(50, len(post.Title))])
 				}
 			}
 		}
+		slog.Info("stored posts", "subreddit", subreddit, "stored", stored, "unchanged", unchanged)
+		recordEngagement(ctx, workspace, posts)
+		statusCollected(subreddit, len(posts), stored, unchanged, nil)
+	}
+}
 
-		// Wait before next collection
-		log.Println("😴 Waiting 5 minutes before next collection...")
-		time.Sleep(5 * time.Minute)
+// collectorWorkspace is the workspace collected content is stored in.
+func collectorWorkspace() string {
+	if ws := os.Getenv("COLLECTOR_WORKSPACE"); ws != "" {
+		return ws
 	}
+	return "default"
 }
 
 func getSubreddits() []string {
@@ -103,29 +288,18 @@ func getSubreddits() []string {
 	return strings.Split(subredditStr, ",")
 }
 
-func collectFromSubreddit(subreddit, userAgent string) ([]RedditPost, error) {
+func collectFromSubreddit(ctx context.Context, subreddit string) ([]RedditPost, error) {
 	url := fmt.Sprintf("https://www.reddit.com/r/%s/hot.json?limit=25", subreddit)
 
-	req, err := http.NewRequest("GET", url, nil)
+	resp, err := reddit.Get(ctx, url)
 	if err != nil {
+		redditQuota.observeError(err, time.Now())
 		return nil, err
 	}
-
-	req.Header.Set("User-Agent", userAgent)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("reddit API returned status %d", resp.StatusCode)
-	}
+	redditQuota.observe(resp.Header, time.Now())
 
 	var redditResp RedditResponse
-	if err := json.NewDecoder(resp.Body).Decode(&redditResp); err != nil {
+	if err := json.Unmarshal(resp.Body, &redditResp); err != nil {
 		return nil, err
 	}
 
@@ -155,6 +329,11 @@ func convertToContentMetadata(post RedditPost) ContentMetadata {
 	// Extract tags
 	tags := extractTags(content, post.Subreddit)
 
+	var derivedFrom string
+	if len(post.CrosspostParentList) > 0 {
+		derivedFrom = "https://reddit.com" + post.CrosspostParentList[0].Permalink
+	}
+
 	return ContentMetadata{
 		ID:             uuid.New().String(),
 		SourceURL:      "https://reddit.com" + post.Permalink,
@@ -166,24 +345,49 @@ func convertToContentMetadata(post RedditPost) ContentMetadata {
 		Language:       "en",
 		ContentSummary: summary,
 		RelevanceScore: relevanceScore,
+		Visibility:     search.VisibilityPublic,
+		License:        redditLicense,
+		Concepts:       pipeline.ExtractConcepts(content),
+		DerivedFrom:    derivedFrom,
+		LinkURL:        post.URL,
+		Text:           content,
 	}
 }
 
+// High-value keywords for our learning focus
+var highValueKeywords = []string{
+	"golang", "go programming", "concurrency", "goroutine",
+	"blockchain", "cosmos", "tendermint", "celestia",
+	"cryptography", "encryption", "hash", "merkle tree",
+	"kubernetes", "k8s", "docker", "microservices",
+}
+
+// keywordTags maps keywords to the tag content mentioning them gets.
+var keywordTags = map[string]string{
+	"golang":         "golang",
+	"go programming": "golang",
+	"goroutine":      "concurrency",
+	"channel":        "concurrency",
+	"blockchain":     "blockchain",
+	"cosmos":         "cosmos",
+	"tendermint":     "tendermint",
+	"celestia":       "celestia",
+	"cryptography":   "cryptography",
+	"encryption":     "cryptography",
+	"kubernetes":     "kubernetes",
+	"k8s":            "kubernetes",
+	"docker":         "containerization",
+}
+
+// calculateRelevanceScore adds 0.2 for each high-value keyword in content,
+// scaled by the learned weight of its topic.
 func calculateRelevanceScore(content string) float64 {
 	content = strings.ToLower(content)
 	score := 0.0
 
-	// High-value keywords for our learning focus
-	highValueKeywords := []string{
-		"golang", "go programming", "concurrency", "goroutine",
-		"blockchain", "cosmos", "tendermint", "celestia",
-		"cryptography", "encryption", "hash", "merkle tree",
-		"kubernetes", "k8s", "docker", "microservices",
-	}
-
 	for _, keyword := range highValueKeywords {
 		if strings.Contains(content, keyword) {
-			score += 0.2
+			score += 0.2 * keywordWeight(keyword)
 		}
 	}
 
@@ -199,23 +403,7 @@ func extractTags(content, subreddit string) []string {
 	content = strings.ToLower(content)
 	tags := []string{subreddit}
 
-	tagMap := map[string]string{
-		"golang":         "golang",
-		"go programming": "golang",
-		"goroutine":      "concurrency",
-		"channel":        "concurrency",
-		"blockchain":     "blockchain",
-		"cosmos":         "cosmos",
-		"tendermint":     "tendermint",
-		"celestia":       "celestia",
-		"cryptography":   "cryptography",
-		"encryption":     "cryptography",
-		"kubernetes":     "kubernetes",
-		"k8s":            "kubernetes",
-		"docker":         "containerization",
-	}
-
-	for keyword, tag := range tagMap {
+	for keyword, tag := range keywordTags {
 		if strings.Contains(content, keyword) {
 			tags = append(tags, tag)
 		}
@@ -244,83 +432,70 @@ func shouldStore(content ContentMetadata) bool {
 }
 
 func storeContent(content ContentMetadata) error {
-	// Get database connection details from environment
-	dbHost := os.Getenv("POSTGRES_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
+	store, err := storage.Open("reddit-collector")
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %v", err)
+	}
+	defer store.Close()
+
+	// The concept graph lives in Postgres only
+	db, postgres := storage.PostgresDB(store)
+	if postgres {
+		if err := db.Ping(); err != nil {
+			return fmt.Errorf("failed to ping database: %v", err)
+		}
 	}
-	dbPort := os.Getenv("POSTGRES_PORT")
-	if dbPort == "" {
-		dbPort = "5433"
+
+	item := &pipeline.ContentItem{
+		Content: storage.Content{
+			ID:             content.ID,
+			Workspace:      collectorWorkspace(),
+			SourceURL:      content.SourceURL,
+			Author:         content.Author,
+			Timestamp:      content.Timestamp,
+			Tags:           content.Tags,
+			ContentType:    content.ContentType,
+			SourcePlatform: content.SourcePlatform,
+			Language:       content.Language,
+			Summary:        content.ContentSummary,
+			RelevanceScore: content.RelevanceScore,
+			Visibility:     content.Visibility,
+			License:        content.License,
+		},
+		Text: content.Text,
 	}
-	dbUser := os.Getenv("POSTGRES_USER")
-	if dbUser == "" {
-		dbUser = "postgres"
+	// Crossposts link to their original when it was collected too
+	if content.DerivedFrom != "" {
+		item.Links = []pipeline.Link{{Relation: links.DerivedFrom, TargetURL: content.DerivedFrom}}
 	}
-	dbPassword := os.Getenv("POSTGRES_PASSWORD")
-	if dbPassword == "" {
-		dbPassword = "changmeplease"
+	if content.LinkURL != "" {
+		item.Outbound = []string{content.LinkURL}
 	}
-	dbName := os.Getenv("POSTGRES_DB")
-	if dbName == "" {
-		dbName = "selin"
+	articles := pipeline.Standard(pipeline.Deps{Name: "linked_article", Store: store, Chunking: chunking})
+	ingest := pipeline.Standard(pipeline.Deps{Name: "reddit", Store: store, Chunking: chunking}).
+		Then(pipeline.ExtractLinks(redditHosts...), pipeline.FollowLinks(db, pages, articles))
+	if err := ingest.Run(context.Background(), item); err != nil {
+		return fmt.Errorf("failed to ingest content: %w", err)
 	}
+	content.ID, content.Tags, content.RelevanceScore, content.Tokens = item.ID, item.Tags, item.RelevanceScore, item.Tokens
 
-	// Create connection string
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	// Connect to database
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
-	}
-	defer db.Close()
-
-	// Test connection
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
-	}
-
-	// Convert tags slice to PostgreSQL array format
-	tagsArray := fmt.Sprintf("{%s}", strings.Join(content.Tags, ","))
-
-	// Insert content into database
-	query := `
-		INSERT INTO content_metadata (
-			id, source_url, author, timestamp, tags, content_type,
-			source_platform, language, content_summary, relevance_score
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		ON CONFLICT (source_url) DO UPDATE SET
-			relevance_score = EXCLUDED.relevance_score,
-			updated_at = now()`
-
-	_, err = db.Exec(query,
-		content.ID,
-		content.SourceURL,
-		content.Author,
-		content.Timestamp,
-		tagsArray,
-		content.ContentType,
-		content.SourcePlatform,
-		content.Language,
-		content.ContentSummary,
-		content.RelevanceScore,
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to insert content: %v", err)
+	// Only brand-new posts are announced; re-collected ones just get rescored
+	if item.Inserted {
+		announceContent(content)
 	}
 
-	log.Printf("💾 Stored in DB: %s (score: %.2f, tags: %v)",
-		content.ContentSummary[:min(100, len(content.ContentSummary))],
-		content.RelevanceScore,
-		content.Tags)
+	slog.Debug("stored content",
+		"content_id", content.ID,
+		"summary", content.ContentSummary[:min(100, len(content.ContentSummary))],
+		"score", content.RelevanceScore,
+		"tags", content.Tags)
 
 	return nil
 }
 
-func startHealthServer() {
+// startHealthServer serves health, readiness, metrics and the admin API in
+// the background.
+func startHealthServer(group *leader.Group) *http.Server {
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -328,24 +503,61 @@ func startHealthServer() {
 			"timestamp": time.Now(),
 			"service":   "reddit-collector",
 			"version":   "1.0.0",
+			"instance":  group.ID(),
+			"flags":     flags.Default().Rules(),
 		})
 	})
 
-	http.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":    "READY",
-			"timestamp": time.Now(),
-		})
+	// Without Postgres nothing collected can be stored. Reddit being
+	// unreachable only fails the current cycle, so it is reported but
+	// optional, and probed rarely to stay clear of its rate limits.
+	readiness := healthcheck.New("reddit-collector")
+	if storage.Driver() == "postgres" {
+		readiness.Register(healthcheck.Check{Name: "postgres", Probe: healthcheck.SQL(func() (*sql.DB, error) {
+			return sql.Open("postgres", config.PostgresDSN("reddit-collector"))
+		})})
+	}
+	readiness.Register(healthcheck.Check{
+		Name:     "reddit",
+		Probe:    healthcheck.HTTP("https://www.reddit.com/api/v1/me"),
+		Optional: true,
+		TTL:      5 * time.Minute,
 	})
+	// Expired OAuth credentials and an exhausted rate limit are reported,
+	// the credentials probed as rarely as reachability
+	if config.Secret("REDDIT_CLIENT_ID") != "" && config.Secret("REDDIT_CLIENT_SECRET") != "" {
+		readiness.Register(healthcheck.Check{
+			Name:     "reddit_credentials",
+			Probe:    redditCredentials(fetch.OptionsFromEnv(os.Getenv("REDDIT_USER_AGENT")).UserAgent),
+			Optional: true,
+			TTL:      15 * time.Minute,
+		})
+	}
+	readiness.Register(healthcheck.Check{Name: "reddit_quota", Probe: redditQuota.probe, Optional: true})
+	// Replicas cannot share out the subreddits without Redis
+	if client := group.Client(); client != nil {
+		readiness.Register(healthcheck.Check{Name: "redis", Probe: healthcheck.Redis(client)})
+	}
+	http.Handle("/ready", readiness)
+
+	http.HandleFunc("/collect", collectHandler)
+	http.HandleFunc("/rescore", rescoreHandler)
+	http.HandleFunc("/status", statusHandler)
+	http.Handle("/metrics", promhttp.Handler())
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8082"
 	}
 
-	log.Printf("🏥 Health server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	server := &http.Server{Addr: ":" + port, Handler: logging.Middleware(http.DefaultServeMux)}
+	go func() {
+		slog.Info("health server starting", "port", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("health server failed", "error", err)
+		}
+	}()
+	return server
 }
 
 func min(a, b int) int {
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Hot listings return mostly the same posts cycle after cycle. Each post
+// stored is remembered with its score and comment count for
+// REDDIT_SEEN_TTL, and is only stored again once either changed
+// materially; the rest of the cycle's posts are skipped without touching
+// the database. Posts are remembered in Redis, shared by the replicas,
+// and in memory without it. Rescoring for changed topic weights is left
+// to POST /rescore.
+
+// A post is stored again once its score moves by seenScoreDelta or its
+// comment count by seenCommentsDelta, or by seenRelativeDelta of either
+// when that is more, so busy posts are not stored again for every vote.
+const (
+	seenScoreDelta    = 10
+	seenCommentsDelta = 5
+	seenRelativeDelta = 0.1
+)
+
+// seenPost is a post as it was last stored.
+type seenPost struct {
+	Score       int
+	NumComments int
+}
+
+// changed reports whether post moved materially since it was seen.
+func (s seenPost) changed(post RedditPost) bool {
+	return moved(s.Score, post.Score, seenScoreDelta) || moved(s.NumComments, post.NumComments, seenCommentsDelta)
+}
+
+func moved(was, is, delta int) bool {
+	diff := max(is-was, was-is)
+	return float64(diff) >= max(float64(delta), seenRelativeDelta*float64(max(was, -was)))
+}
+
+// seenPosts remembers the posts stored in a workspace.
+type seenPosts struct {
+	client *redis.Client // nil without Redis
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	local map[string]localSeen
+	swept time.Time // when expired posts were last forgotten
+}
+
+type localSeen struct {
+	seenPost
+	expires time.Time
+}
+
+func newSeenPosts(client *redis.Client, ttl time.Duration) *seenPosts {
+	return &seenPosts{client: client, ttl: ttl, local: map[string]localSeen{}}
+}
+
+func seenKey(workspace, postID string) string {
+	return "reddit-collector:seen:" + workspace + ":" + postID
+}
+
+// lookup returns the posts among ids seen in the workspace. Should Redis
+// fail, none are: every post is stored as before.
+func (c *seenPosts) lookup(ctx context.Context, workspace string, ids []string) map[string]seenPost {
+	seen := map[string]seenPost{}
+	if len(ids) == 0 {
+		return seen
+	}
+	if c.client == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		now := time.Now()
+		for _, id := range ids {
+			if s, ok := c.local[seenKey(workspace, id)]; ok && now.Before(s.expires) {
+				seen[id] = s.seenPost
+			}
+		}
+		return seen
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = seenKey(workspace, id)
+	}
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		slog.Warn("failed to look up seen posts", "error", err)
+		return seen
+	}
+	for i, v := range values {
+		var s seenPost
+		if str, ok := v.(string); ok {
+			if _, err := fmt.Sscanf(str, "%d %d", &s.Score, &s.NumComments); err == nil {
+				seen[ids[i]] = s
+			}
+		}
+	}
+	return seen
+}
+
+// mark remembers post as stored now.
+func (c *seenPosts) mark(ctx context.Context, workspace string, post RedditPost) {
+	key := seenKey(workspace, post.ID)
+	if c.client == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		now := time.Now()
+		// Forget expired posts once a TTL, which keeps the map to about
+		// two TTLs' worth of listings without scanning it on every mark
+		if now.Sub(c.swept) >= c.ttl {
+			for k, s := range c.local {
+				if now.After(s.expires) {
+					delete(c.local, k)
+				}
+			}
+			c.swept = now
+		}
+		c.local[key] = localSeen{seenPost{post.Score, post.NumComments}, now.Add(c.ttl)}
+		return
+	}
+	if err := c.client.Set(ctx, key, fmt.Sprintf("%d %d", post.Score, post.NumComments), c.ttl).Err(); err != nil {
+		slog.Warn("failed to remember seen post", "post_id", post.ID, "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestSeenPostChanged(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		was         seenPost
+		score, nums int
+		want        bool
+	}{
+		{"unchanged", seenPost{50, 10}, 50, 10, false},
+		{"a few votes", seenPost{50, 10}, 59, 10, false},
+		{"enough votes", seenPost{50, 10}, 60, 10, true},
+		{"votes lost", seenPost{50, 10}, 40, 10, true},
+		{"a few comments", seenPost{50, 10}, 50, 14, false},
+		{"enough comments", seenPost{50, 10}, 50, 15, true},
+		{"busy post, small share", seenPost{1000, 10}, 1050, 10, false},
+		{"busy post, large share", seenPost{1000, 10}, 1100, 10, true},
+		{"negative score", seenPost{-200, 0}, -215, 0, false},
+	} {
+		post := RedditPost{Score: tt.score, NumComments: tt.nums}
+		if got := tt.was.changed(post); got != tt.want {
+			t.Errorf("%s: expected changed to be %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSeenPostsInRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	seen := newSeenPosts(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+	ctx := context.Background()
+
+	seen.mark(ctx, "default", RedditPost{ID: "a", Score: 12, NumComments: 3})
+	got := seen.lookup(ctx, "default", []string{"a", "b"})
+	if len(got) != 1 || got["a"] != (seenPost{12, 3}) {
+		t.Errorf("Expected only a seen with its score and comments, got %+v", got)
+	}
+	if got := seen.lookup(ctx, "team", []string{"a"}); len(got) != 0 {
+		t.Errorf("Expected posts seen per workspace, got %+v", got)
+	}
+	if ttl := mr.TTL(seenKey("default", "a")); ttl != time.Hour {
+		t.Errorf("Expected the post remembered for the TTL, got %s", ttl)
+	}
+
+	mr.FastForward(time.Hour)
+	if got := seen.lookup(ctx, "default", []string{"a"}); len(got) != 0 {
+		t.Errorf("Expected the post forgotten after the TTL, got %+v", got)
+	}
+
+	mr.Close()
+	if got := seen.lookup(ctx, "default", []string{"a"}); len(got) != 0 {
+		t.Errorf("Expected no posts seen without Redis, got %+v", got)
+	}
+	seen.mark(ctx, "default", RedditPost{ID: "a"})
+}
+
+func TestSeenPostsInMemory(t *testing.T) {
+	seen := newSeenPosts(nil, time.Hour)
+	ctx := context.Background()
+
+	seen.mark(ctx, "default", RedditPost{ID: "a", Score: 12, NumComments: 3})
+	seen.mark(ctx, "default", RedditPost{ID: "b", Score: 1})
+	got := seen.lookup(ctx, "default", []string{"a", "c"})
+	if len(got) != 1 || got["a"] != (seenPost{12, 3}) {
+		t.Errorf("Expected only a seen with its score and comments, got %+v", got)
+	}
+	if got := seen.lookup(ctx, "team", []string{"a"}); len(got) != 0 {
+		t.Errorf("Expected posts seen per workspace, got %+v", got)
+	}
+
+	// Age a past the TTL
+	expired := seen.local[seenKey("default", "a")]
+	expired.expires = time.Now().Add(-time.Minute)
+	seen.local[seenKey("default", "a")] = expired
+	if got := seen.lookup(ctx, "default", []string{"a", "b"}); len(got) != 1 || got["b"] != (seenPost{1, 0}) {
+		t.Errorf("Expected only b still seen, got %+v", got)
+	}
+
+	// Expired posts are only swept once a TTL
+	seen.mark(ctx, "default", RedditPost{ID: "c"})
+	if _, ok := seen.local[seenKey("default", "a")]; !ok {
+		t.Error("Expected the expired post kept until the next sweep")
+	}
+	seen.swept = time.Now().Add(-time.Hour)
+	seen.mark(ctx, "default", RedditPost{ID: "d"})
+	if _, ok := seen.local[seenKey("default", "a")]; ok {
+		t.Error("Expected the expired post swept")
+	}
+	if len(seen.local) != 3 {
+		t.Errorf("Expected b, c and d kept, got %d posts", len(seen.local))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"selin/internal/adminauth"
+	"selin/internal/errlog"
+)
+
+// CollectorStatus describes the collection loop, served on GET /status.
+type CollectorStatus struct {
+	Instance         string         `json:"instance"`
+	Subreddits       []string       `json:"subreddits"` // those assigned to this instance
+	Running          bool           `json:"running"`
+	CollectPending   bool           `json:"collect_pending"` // a POST /collect is waiting
+	LastStarted      *time.Time     `json:"last_started,omitempty"`
+	LastFinished     *time.Time     `json:"last_finished,omitempty"`
+	LastDuration     string         `json:"last_duration,omitempty"`
+	PostsFound       int            `json:"posts_found"`
+	PostsStored      int            `json:"posts_stored"`
+	PostsUnchanged   int            `json:"posts_unchanged"` // stored before and skipped
+	FailedSubreddits []string       `json:"failed_subreddits"`
+	NextRun          *time.Time     `json:"next_run,omitempty"`
+	RecentErrors     []errlog.Entry `json:"recent_errors"`
+}
+
+var status struct {
+	sync.Mutex
+	CollectorStatus
+}
+
+func statusStarted(subreddits []string) {
+	status.Lock()
+	defer status.Unlock()
+	now := time.Now()
+	status.Subreddits = subreddits
+	status.Running = true
+	status.LastStarted = &now
+	status.NextRun = nil
+	status.PostsFound, status.PostsStored, status.PostsUnchanged = 0, 0, 0
+	status.FailedSubreddits = []string{}
+}
+
+// statusCollected records one subreddit's result in the current run.
+func statusCollected(subreddit string, found, stored, unchanged int, err error) {
+	status.Lock()
+	defer status.Unlock()
+	if err != nil {
+		status.FailedSubreddits = append(status.FailedSubreddits, subreddit)
+		return
+	}
+	status.PostsFound += found
+	status.PostsStored += stored
+	status.PostsUnchanged += unchanged
+}
+
+func statusFinished(next time.Time) {
+	status.Lock()
+	defer status.Unlock()
+	now := time.Now()
+	status.Running = false
+	status.LastFinished = &now
+	status.NextRun = &next
+	if status.LastStarted != nil {
+		status.LastDuration = now.Sub(*status.LastStarted).Round(time.Millisecond).String()
+	}
+}
+
+// statusHandler serves GET /status.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !adminauth.Authorized(w, r) {
+		return
+	}
+
+	status.Lock()
+	snapshot := status.CollectorStatus
+	status.Unlock()
+	snapshot.CollectPending = len(collectNow) > 0
+	snapshot.RecentErrors = errlog.Recent()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
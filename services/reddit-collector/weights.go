@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+
+	"selin/internal/config"
+	"selin/internal/storage"
+)
+
+// topicWeights are the collector workspace's learned keyword weights by
+// topic, from the topic_weights the MCP server's apply_feedback job keeps.
+// They are reloaded every cycle; topics without one count 1.
+var topicWeights struct {
+	sync.RWMutex
+	weights map[string]float64
+}
+
+// keywordWeight is the weight of keyword's topic: its tag, or the keyword
+// itself when it has none.
+func keywordWeight(keyword string) float64 {
+	topicWeights.RLock()
+	defer topicWeights.RUnlock()
+	if w, ok := topicWeights.weights[keywordTags[keyword]]; ok {
+		return w
+	}
+	if w, ok := topicWeights.weights[keyword]; ok {
+		return w
+	}
+	return 1
+}
+
+// refreshTopicWeights reloads the topic weights, keeping the last ones when
+// Postgres is unavailable.
+func refreshTopicWeights(ctx context.Context) {
+	if storage.Driver() != "postgres" {
+		return
+	}
+	db, err := sql.Open("postgres", config.PostgresDSN("reddit-collector"))
+	if err != nil {
+		slog.Warn("failed to load topic weights", "error", err)
+		return
+	}
+	defer db.Close()
+	if err := loadTopicWeights(ctx, db); err != nil {
+		slog.Warn("failed to load topic weights", "error", err)
+	}
+}
+
+func loadTopicWeights(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT topic, weight FROM topic_weights WHERE workspace_id = $1`, collectorWorkspace())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	weights := make(map[string]float64)
+	for rows.Next() {
+		var topic string
+		var weight float64
+		if err := rows.Scan(&topic, &weight); err != nil {
+			return err
+		}
+		weights[topic] = weight
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	topicWeights.Lock()
+	topicWeights.weights = weights
+	topicWeights.Unlock()
+	return nil
+}
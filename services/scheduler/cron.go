@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression of five fields, minute hour
+// day-of-month month day-of-week, evaluated in UTC. Fields take *, values,
+// ranges (1-5), steps (*/15, 0-30/10) and lists of those (1,15). Day-of-week
+// runs from 0 (Sunday) to 6, with 7 also Sunday. As in cron, when both
+// day fields are restricted a day matching either is enough.
+//
+// @hourly, @daily, @weekly, @monthly and @yearly are accepted too.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit n is set when n matches
+	domStar, dowStar              bool
+}
+
+var scheduleMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+}
+
+func ParseSchedule(expr string) (*Schedule, error) {
+	if macro, ok := scheduleMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+
+	s := &Schedule{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	for i, f := range []struct {
+		bits     *uint64
+		name     string
+		min, max int
+	}{
+		{&s.minute, "minute", 0, 59},
+		{&s.hour, "hour", 0, 23},
+		{&s.dom, "day-of-month", 1, 31},
+		{&s.month, "month", 1, 12},
+		{&s.dow, "day-of-week", 0, 7},
+	} {
+		bits, err := parseField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %s: %v", expr, f.name, err)
+		}
+		*f.bits = bits
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	if s.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", expr)
+	}
+	return s, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if r, st, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", st)
+			}
+			rng, step = r, n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(a)
+			hi, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rng)
+			}
+			lo = n
+			if step == 1 {
+				hi = n
+			} // 5/15 runs from 5 to the end
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for n := lo; n <= hi; n += step {
+			bits |= 1 << n
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, n int) bool {
+	return bits&(1<<n) != 0
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after after that the schedule matches, or
+// the zero time when there is none within five years.
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(s.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !has(s.hour, t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !has(s.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2026, 3, 4, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 3, 4, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 4, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 3, 5, 3, 0, 0, 0, time.UTC)},
+		{"30 9-17/4 * * *", time.Date(2026, 3, 4, 13, 30, 0, 0, time.UTC)},
+		{"0 0 * * 1", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{"0 0 15 * 5", time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"5,10 10 * * *", time.Date(2026, 3, 4, 10, 10, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: next after %s = %s, want %s", tt.expr, from, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleRejects(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *", "0 0 30 2 *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("Expected %q to be rejected", expr)
+		}
+	}
+}
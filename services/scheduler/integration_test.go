@@ -0,0 +1,101 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"selin/internal/testenv"
+)
+
+// Run with: go test -tags integration . (needs a Docker daemon)
+
+// TestSchedulerAgainstPostgres follows a job from its first tick through a
+// scheduled run, a manual trigger and pausing.
+func TestSchedulerAgainstPostgres(t *testing.T) {
+	db := testenv.Postgres(t)
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	if _, err := db.Exec(`DELETE FROM scheduled_jobs`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO scheduled_jobs (name, schedule, url, token) VALUES ('ping', '*/5 * * * *', $1, 'none')`, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	s := &Scheduler{db: db, client: server.Client(), instance: "test"}
+	lastRun := func() Run {
+		t.Helper()
+		jobs, err := listJobs(ctx, db, "ping")
+		if err != nil || len(jobs) != 1 || jobs[0].LastRun == nil {
+			t.Fatalf("Expected the job with a run, got %+v (%v)", jobs, err)
+		}
+		return *jobs[0].LastRun
+	}
+
+	// The first tick only schedules the job
+	now := time.Date(2026, 3, 4, 10, 2, 0, 0, time.UTC)
+	s.runTick(ctx, ctx, now)
+	jobs, err := listJobs(ctx, db, "ping")
+	if err != nil || jobs[0].LastRun != nil || !jobs[0].NextRunAt.Equal(now.Add(3*time.Minute)) {
+		t.Fatalf("Expected the job scheduled for 10:05 without a run, got %+v (%v)", jobs, err)
+	}
+
+	// Once due it runs, and a manual trigger meanwhile conflicts
+	s.runTick(ctx, ctx, now.Add(4*time.Minute))
+	for calls.Load() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if run := lastRun(); run.Status != "running" || run.Trigger != "schedule" || run.Instance != "test" {
+		t.Errorf("Expected a running scheduled run, got %+v", run)
+	}
+	if _, err := queueRun(ctx, db, "ping", "manual"); !errors.Is(err, errRunActive) {
+		t.Errorf("Expected errRunActive while the run is active, got %v", err)
+	}
+	// The next due tick skips instead of piling up
+	s.runTick(ctx, ctx, now.Add(9*time.Minute))
+	if run := lastRun(); run.Status != "skipped" {
+		t.Errorf("Expected an overlapping run skipped, got %+v", run)
+	}
+	close(release)
+	s.Wait()
+
+	var status, output string
+	var httpStatus int
+	if err := db.QueryRow(`SELECT status, http_status, output FROM job_runs WHERE trigger = 'schedule' AND status <> 'skipped'`).Scan(&status, &httpStatus, &output); err != nil {
+		t.Fatal(err)
+	}
+	if status != "succeeded" || httpStatus != 200 || output != `{"status":"ok"}` {
+		t.Errorf("Unexpected outcome: %s %d %q", status, httpStatus, output)
+	}
+
+	// Manual runs are picked up on the next tick, paused or not
+	if _, err := setPaused(ctx, db, "ping", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queueRun(ctx, db, "ping", "manual"); err != nil {
+		t.Fatal(err)
+	}
+	s.runTick(ctx, ctx, now.Add(time.Hour))
+	s.Wait()
+	if run := lastRun(); run.Trigger != "manual" || run.Status != "succeeded" {
+		t.Errorf("Expected the manual run to succeed, got %+v", run)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected 2 calls with the job paused, got %d", n)
+	}
+}
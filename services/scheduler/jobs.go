@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"selin/internal/config"
+)
+
+// Job is a scheduled HTTP call to another service's endpoint, such as the
+// collector's /rescore. Jobs are defined in scheduled_jobs.
+type Job struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+	// Token names the bearer token sent, one of jobTokens
+	Token     string     `json:"token"`
+	Timeout   int        `json:"timeout_seconds"`
+	Paused    bool       `json:"paused"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastRun   *Run       `json:"last_run,omitempty"`
+	// Error explains why a job with an invalid schedule never runs
+	Error string `json:"error,omitempty"`
+}
+
+// Run is one run of a job, recorded in job_runs.
+type Run struct {
+	ID         int64      `json:"id"`
+	Job        string     `json:"job"`
+	Trigger    string     `json:"trigger"` // "schedule" or "manual"
+	Status     string     `json:"status"`  // "queued", "running", "succeeded", "failed" or "skipped"
+	Instance   string     `json:"instance,omitempty"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	HTTPStatus int        `json:"http_status,omitempty"`
+	Output     string     `json:"output,omitempty"`
+}
+
+// jobTokens are the bearer tokens a job can send, by the name stored with
+// it, so job definitions never hold secrets and cannot send others.
+var jobTokens = map[string]string{
+	"admin":    "ADMIN_API_KEY",
+	"notifier": "NOTIFIER_TOKEN",
+	"none":     "",
+}
+
+// Most of a response body kept as a run's output.
+const maxOutputBytes = 1024
+
+// errRunActive is returned when a job is queued while a run of it is
+// already queued or running.
+var errRunActive = errors.New("a run of this job is already queued or running")
+
+// Scheduler queues due jobs and runs queued ones. Only the leader does
+// either; every instance serves the admin API, whose triggers the leader
+// picks up on its next tick.
+type Scheduler struct {
+	db       *sql.DB
+	client   *http.Client
+	instance string
+	tick     time.Duration
+
+	running sync.WaitGroup
+}
+
+// Lead ticks until ctx is done. runCtx bounds the jobs started meanwhile,
+// which are left to finish when leadership is lost but not on shutdown.
+func (s *Scheduler) Lead(ctx, runCtx context.Context) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for {
+		s.runTick(ctx, runCtx, time.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Wait blocks until every started run has finished.
+func (s *Scheduler) Wait() {
+	s.running.Wait()
+}
+
+func (s *Scheduler) runTick(ctx, runCtx context.Context, now time.Time) {
+	if err := s.abandonStale(ctx); err != nil {
+		slog.Error("failed to clear abandoned runs", "error", err)
+	}
+	if err := s.queueDue(ctx, now); err != nil {
+		slog.Error("failed to queue due jobs", "error", err)
+	}
+	if err := s.startQueued(ctx, runCtx); err != nil {
+		slog.Error("failed to start queued runs", "error", err)
+	}
+}
+
+// abandonStale fails runs left running past their timeout, by an instance
+// that stopped before it could record how they ended.
+func (s *Scheduler) abandonStale(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE job_runs r SET status = 'failed', finished_at = now(),
+		       output = 'abandoned: the instance running it stopped'
+		FROM scheduled_jobs j
+		WHERE r.job_name = j.name AND r.status = 'running'
+		  AND r.started_at < now() - make_interval(secs => j.timeout_seconds + 60)
+		RETURNING r.id, r.job_name, r.instance`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var job, instance string
+		if err := rows.Scan(&id, &job, &instance); err != nil {
+			return err
+		}
+		slog.Warn("job run abandoned", "job", job, "run", id, "instance", instance)
+		runsTotal.WithLabelValues(job, "abandoned").Inc()
+	}
+	return rows.Err()
+}
+
+// queueDue queues every unpaused job whose next run is due and sets when
+// it runs next. Jobs without a next run yet, new or resumed ones, only get
+// one: they do not run for the time they were not scheduled.
+func (s *Scheduler) queueDue(ctx context.Context, now time.Time) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, schedule, next_run_at IS NOT NULL FROM scheduled_jobs
+		WHERE NOT paused AND (next_run_at IS NULL OR next_run_at <= $1)`, now)
+	if err != nil {
+		return err
+	}
+	type due struct {
+		name, schedule string
+		run            bool
+	}
+	var jobs []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.name, &d.schedule, &d.run); err != nil {
+			rows.Close()
+			return err
+		}
+		jobs = append(jobs, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range jobs {
+		sched, err := ParseSchedule(d.schedule)
+		if err != nil {
+			slog.Error("job has an invalid schedule", "job", d.name, "error", err)
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE scheduled_jobs SET next_run_at = $2 WHERE name = $1`, d.name, sched.Next(now)); err != nil {
+			return err
+		}
+		if !d.run {
+			continue
+		}
+		if _, err := queueRun(ctx, s.db, d.name, "schedule"); errors.Is(err, errRunActive) {
+			// Overlapping runs are skipped rather than piled up
+			_, err = s.db.ExecContext(ctx, `
+				INSERT INTO job_runs (job_name, trigger, status, finished_at, output)
+				VALUES ($1, 'schedule', 'skipped', now(), $2)`, d.name, errRunActive.Error())
+			runsTotal.WithLabelValues(d.name, "skipped").Inc()
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueRun queues a run of the job, returning errRunActive when one is
+// already queued or running.
+func queueRun(ctx context.Context, db *sql.DB, job, trigger string) (*Run, error) {
+	run := Run{Job: job, Trigger: trigger, Status: "queued"}
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO job_runs (job_name, trigger) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING id, queued_at`, job, trigger).Scan(&run.ID, &run.QueuedAt)
+	if err == sql.ErrNoRows {
+		return nil, errRunActive
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// startQueued marks every queued run as running on this instance and runs
+// it in the background.
+func (s *Scheduler) startQueued(ctx, runCtx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE job_runs r SET status = 'running', started_at = now(), instance = $1
+		FROM scheduled_jobs j
+		WHERE r.job_name = j.name AND r.status = 'queued'
+		RETURNING r.id, j.name, j.method, j.url, j.token, j.timeout_seconds`, s.instance)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var job Job
+		if err := rows.Scan(&id, &job.Name, &job.Method, &job.URL, &job.Token, &job.Timeout); err != nil {
+			return err
+		}
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			s.execute(runCtx, id, job)
+		}()
+	}
+	return rows.Err()
+}
+
+// execute runs a job and records how it ended.
+func (s *Scheduler) execute(ctx context.Context, id int64, job Job) {
+	start := time.Now()
+	status, httpStatus, output := "succeeded", 0, ""
+	if code, body, err := s.call(ctx, job); err != nil {
+		status, output = "failed", err.Error()
+		if ctx.Err() == context.Canceled {
+			output = "interrupted by shutdown"
+		}
+	} else {
+		httpStatus, output = code, body
+		if code < 200 || code > 299 {
+			status = "failed"
+		}
+	}
+	runsTotal.WithLabelValues(job.Name, status).Inc()
+	runDuration.WithLabelValues(job.Name).Observe(time.Since(start).Seconds())
+	slog.Info("job finished", "job", job.Name, "run", id, "status", status, "http_status", httpStatus, "duration", time.Since(start))
+
+	// Recorded even when ctx was cancelled by shutdown
+	recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.db.ExecContext(recordCtx, `
+		UPDATE job_runs SET status = $2, finished_at = now(), http_status = NULLIF($3, 0), output = $4
+		WHERE id = $1`, id, status, httpStatus, output); err != nil {
+		slog.Error("failed to record job run", "job", job.Name, "run", id, "error", err)
+	}
+}
+
+// call makes the job's request, returning the status and the start of the
+// response body.
+func (s *Scheduler) call(ctx context.Context, job Job) (int, string, error) {
+	tokenEnv, ok := jobTokens[job.Token]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown token %q: use admin, notifier or none", job.Token)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(job.Timeout)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, job.Method, job.URL, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	if tokenEnv != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Secret(tokenEnv))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutputBytes))
+	return resp.StatusCode, strings.TrimSpace(string(body)), nil
+}
+
+// listJobs returns every job with its last run.
+func listJobs(ctx context.Context, db *sql.DB, name string) ([]Job, error) {
+	query := `
+		SELECT j.name, j.schedule, j.method, j.url, j.token, j.timeout_seconds, j.paused, j.next_run_at,
+		       r.id, r.trigger, r.status, r.instance, r.queued_at, r.started_at, r.finished_at, r.http_status, r.output
+		FROM scheduled_jobs j
+		LEFT JOIN LATERAL (
+			SELECT * FROM job_runs WHERE job_name = j.name ORDER BY id DESC LIMIT 1
+		) r ON true`
+	var args []interface{}
+	if name != "" {
+		query += ` WHERE j.name = $1`
+		args = append(args, name)
+	}
+	rows, err := db.QueryContext(ctx, query+` ORDER BY j.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var j Job
+		var next sql.NullTime
+		var r runColumns
+		if err := rows.Scan(&j.Name, &j.Schedule, &j.Method, &j.URL, &j.Token, &j.Timeout, &j.Paused, &next,
+			&r.id, &r.trigger, &r.status, &r.instance, &r.queuedAt, &r.startedAt, &r.finishedAt, &r.httpStatus, &r.output); err != nil {
+			return nil, err
+		}
+		if next.Valid {
+			j.NextRunAt = &next.Time
+		}
+		if r.id.Valid {
+			j.LastRun = r.run(j.Name)
+		}
+		if _, err := ParseSchedule(j.Schedule); err != nil {
+			j.Error = err.Error()
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// listRuns returns a job's latest runs, newest first.
+func listRuns(ctx context.Context, db *sql.DB, job string, limit int) ([]Run, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, trigger, status, instance, queued_at, started_at, finished_at, http_status, output
+		FROM job_runs WHERE job_name = $1 ORDER BY id DESC LIMIT $2`, job, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		var r runColumns
+		if err := rows.Scan(&r.id, &r.trigger, &r.status, &r.instance, &r.queuedAt, &r.startedAt, &r.finishedAt, &r.httpStatus, &r.output); err != nil {
+			return nil, err
+		}
+		runs = append(runs, *r.run(job))
+	}
+	return runs, rows.Err()
+}
+
+// runColumns scans a job_runs row, which may come from a LEFT JOIN.
+type runColumns struct {
+	id                              sql.NullInt64
+	trigger, status                 sql.NullString
+	instance, output                sql.NullString
+	queuedAt, startedAt, finishedAt sql.NullTime
+	httpStatus                      sql.NullInt64
+}
+
+func (c runColumns) run(job string) *Run {
+	r := &Run{
+		ID:         c.id.Int64,
+		Job:        job,
+		Trigger:    c.trigger.String,
+		Status:     c.status.String,
+		Instance:   c.instance.String,
+		QueuedAt:   c.queuedAt.Time,
+		HTTPStatus: int(c.httpStatus.Int64),
+		Output:     c.output.String,
+	}
+	if c.startedAt.Valid {
+		r.StartedAt = &c.startedAt.Time
+	}
+	if c.finishedAt.Valid {
+		r.FinishedAt = &c.finishedAt.Time
+	}
+	return r
+}
+
+// setPaused pauses or resumes a job, reporting whether it exists. A
+// resumed job is rescheduled from now on the next tick.
+func setPaused(ctx context.Context, db *sql.DB, name string, paused bool) (bool, error) {
+	res, err := db.ExecContext(ctx, `
+		UPDATE scheduled_jobs SET paused = $2, next_run_at = CASE WHEN $2 THEN next_run_at END, updated_at = now()
+		WHERE name = $1`, name, paused)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
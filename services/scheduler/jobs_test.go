@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCallSendsTheJobsToken(t *testing.T) {
+	var gotAuth, gotMethod string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotMethod = r.Header.Get("Authorization"), r.Method
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(strings.Repeat("x", 2*maxOutputBytes)))
+	}))
+	defer server.Close()
+	t.Setenv("NOTIFIER_TOKEN", "internal")
+	s := &Scheduler{client: server.Client()}
+
+	code, body, err := s.call(context.Background(), Job{Method: "POST", URL: server.URL, Token: "notifier", Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusAccepted || gotMethod != "POST" || gotAuth != "Bearer internal" {
+		t.Errorf("Unexpected call: status %d, method %s, auth %q", code, gotMethod, gotAuth)
+	}
+	if len(body) != maxOutputBytes {
+		t.Errorf("Expected the output cut to %d bytes, got %d", maxOutputBytes, len(body))
+	}
+
+	if _, _, err := s.call(context.Background(), Job{Method: "POST", URL: server.URL, Token: "none", Timeout: 5}); err != nil || gotAuth != "" {
+		t.Errorf("Expected no token for 'none', got %q (%v)", gotAuth, err)
+	}
+	if _, _, err := s.call(context.Background(), Job{Method: "POST", URL: server.URL, Token: "DATABASE_PASSWORD", Timeout: 5}); err == nil {
+		t.Error("Expected tokens outside jobTokens to be refused")
+	}
+}
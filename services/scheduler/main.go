@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"selin/internal/adminauth"
+	"selin/internal/config"
+	"selin/internal/flags"
+	"selin/internal/healthcheck"
+	"selin/internal/leader"
+	"selin/internal/logging"
+)
+
+// Metrics
+var (
+	runsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scheduler_job_runs_total",
+			Help: "Job runs by job and outcome (succeeded, failed, skipped, abandoned)",
+		},
+		[]string{"job", "status"},
+	)
+	runDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "scheduler_job_duration_seconds",
+			Help:    "How long job runs took",
+			Buckets: prometheus.ExponentialBuckets(0.1, 4, 8),
+		},
+		[]string{"job"},
+	)
+	leading = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "scheduler_leader",
+			Help: "1 when this instance is the one running jobs",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(runsTotal, runDuration, leading)
+}
+
+// Most runs listed by /admin/jobs/{name}/runs.
+const maxRunsListed = 200
+
+func getDBConnection() (*sql.DB, error) {
+	return sql.Open("postgres", config.PostgresDSN("scheduler"))
+}
+
+// jobsHandler serves the admin API:
+//
+//	GET  /admin/jobs                 every job with its last run
+//	GET  /admin/jobs/{name}          one job
+//	GET  /admin/jobs/{name}/runs     its run history (?limit=, default 20)
+//	POST /admin/jobs/{name}/trigger  queue a run now
+//	POST /admin/jobs/{name}/pause    stop scheduling it
+//	POST /admin/jobs/{name}/resume   schedule it again from now
+func jobsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminauth.Authorized(w, r) {
+			return
+		}
+		name, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/jobs"), "/"), "/")
+		ctx := r.Context()
+
+		wantMethod := http.MethodPost
+		if action == "" || action == "runs" {
+			wantMethod = http.MethodGet
+		}
+		if r.Method != wantMethod {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var jobs []Job
+		var err error
+		if name != "" {
+			if jobs, err = listJobs(ctx, db, name); err == nil && len(jobs) == 0 {
+				http.Error(w, "Job not found", http.StatusNotFound)
+				return
+			}
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to load job", "job", name, "error", err)
+			http.Error(w, "Failed to load job", http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		var result interface{}
+		switch action {
+		case "":
+			if name != "" {
+				result = jobs[0]
+				break
+			}
+			if jobs, err = listJobs(ctx, db, ""); err == nil {
+				result = map[string]interface{}{"jobs": jobs}
+			}
+		case "runs":
+			limit := 20
+			if n, convErr := strconv.Atoi(r.URL.Query().Get("limit")); convErr == nil && n > 0 {
+				limit = min(n, maxRunsListed)
+			}
+			var runs []Run
+			if runs, err = listRuns(ctx, db, name, limit); err == nil {
+				result = map[string]interface{}{"runs": runs}
+			}
+		case "trigger":
+			var run *Run
+			run, err = queueRun(ctx, db, name, "manual")
+			if errors.Is(err, errRunActive) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			status, result = http.StatusAccepted, run
+		case "pause", "resume":
+			if _, err = setPaused(ctx, db, name, action == "pause"); err == nil {
+				if jobs, err = listJobs(ctx, db, name); err == nil {
+					result = jobs[0]
+				}
+			}
+		default:
+			http.Error(w, "Unknown action", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("job request failed", "job", name, "action", action, "error", err)
+			http.Error(w, "Job request failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// envDuration reads a Go duration (e.g. "30s") from the environment.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func main() {
+	logging.Setup("scheduler", "1.0.0")
+	// Fail at startup rather than on first use when the flags are misconfigured
+	flags.Default()
+	slog.Info("starting scheduler service")
+
+	db, err := getDBConnection()
+	if err != nil {
+		logging.Fatal("failed to open database", "error", err)
+	}
+	defer db.Close()
+
+	// With Redis, replicas elect the one that runs jobs; without it this
+	// instance always does
+	elector := leader.FromEnv("scheduler:leader", envDuration("SCHEDULER_LEADER_TTL", 15*time.Second))
+	scheduler := &Scheduler{
+		db:       db,
+		client:   &http.Client{},
+		instance: elector.ID(),
+		tick:     envDuration("SCHEDULER_TICK", 15*time.Second),
+	}
+
+	readiness := healthcheck.New("scheduler")
+	readiness.Register(healthcheck.Check{Name: "postgres", Probe: healthcheck.SQL(getDBConnection)})
+	if client := elector.Client(); client != nil {
+		readiness.Register(healthcheck.Check{Name: "redis", Probe: healthcheck.Redis(client)})
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	electionDone := make(chan struct{})
+	go func() {
+		defer close(electionDone)
+		elector.Run(ctx, func(leadCtx context.Context) {
+			leading.Set(1)
+			defer leading.Set(0)
+			scheduler.Lead(leadCtx, ctx)
+		})
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    "OK",
+			"timestamp": time.Now(),
+			"service":   "scheduler",
+			"version":   "1.0.0",
+			"instance":  elector.ID(),
+			"leader":    elector.Leading(),
+			"flags":     flags.Default().Rules(),
+		})
+	})
+	mux.Handle("/ready", readiness)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/admin/jobs", jobsHandler(db))
+	mux.HandleFunc("/admin/jobs/", jobsHandler(db))
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8086"
+	}
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: logging.Middleware(mux),
+		// Security timeouts
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// Graceful shutdown
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		slog.Info("scheduler service starting", "port", port, "instance", elector.ID())
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("server failed to start", "error", err)
+		}
+	}()
+
+	<-signals
+	slog.Info("shutting down scheduler service")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server forced to shutdown", "error", err)
+	}
+
+	// Interrupt running jobs, record them as such and hand over leadership
+	stop()
+	<-electionDone
+	scheduler.Wait()
+
+	slog.Info("scheduler service stopped")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"selin/internal/config"
+)
+
+func TestJobsHandlerAuth(t *testing.T) {
+	handler := jobsHandler(nil)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/admin/jobs", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without ADMIN_API_KEY, got %d", rr.Code)
+	}
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	config.Secrets().Reload()
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/admin/jobs", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the key, got %d", rr.Code)
+	}
+
+	for _, tc := range []struct{ method, path string }{
+		{"POST", "/admin/jobs"},
+		{"POST", "/admin/jobs/rescore/runs"},
+		{"GET", "/admin/jobs/rescore/trigger"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr = httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected 405, got %d", tc.method, tc.path, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+
+	"selin/internal/apikeys"
+	"selin/internal/config"
+	"selin/internal/logging"
+)
+
+// Clients reach the ws service directly rather than through the gateway,
+// so it resolves their workspace and user from their API key the way the
+// gateway does, and never takes X-Workspace-ID or X-User-ID from them. A
+// connection's user is its key's name. Connections without a key are
+// anonymous in the default workspace, and get no direct messages or
+// replays, unless REQUIRE_API_KEY=true refuses them.
+
+// queryTopicPrefix starts the topics queries stream to. They are made up
+// by the server for the connection running the query, which is the only
+// one that may subscribe to them.
+const queryTopicPrefix = "query."
+
+// newAPIKeysFromEnv returns the gateway's key store in the Redis at
+// REDIS_URL.
+func newAPIKeysFromEnv() *apikeys.Store {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "localhost:6379"
+	}
+	return apikeys.New(config.RedisClient(redisURL))
+}
+
+// caller is who a connection belongs to.
+type caller struct {
+	workspace string
+	userID    string // the API key's name, or anonymousUser without one
+}
+
+// requestCaller resolves the workspace and user of a connection, answering
+// the request itself and returning false when it is refused.
+func requestCaller(hub *Hub, w http.ResponseWriter, r *http.Request) (caller, bool) {
+	key := apikeys.FromRequest(r)
+	if key == "" {
+		if hub.requireKey {
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return caller{}, false
+		}
+		return caller{workspace: apikeys.DefaultWorkspace, userID: anonymousUser}, true
+	}
+	if hub.keys == nil {
+		http.Error(w, "API keys are not checked by this server", http.StatusServiceUnavailable)
+		return caller{}, false
+	}
+	info, err := hub.keys.Resolve(r.Context(), key)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to check API key", "error", err)
+		http.Error(w, "API key check unavailable", http.StatusServiceUnavailable)
+		return caller{}, false
+	}
+	if info == nil {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return caller{}, false
+	}
+	return caller{workspace: info.Workspace, userID: info.Name}, true
+}
+
+// newQueryTopic makes up an unguessable topic for one query.
+func newQueryTopic() string {
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	return queryTopicPrefix + hex.EncodeToString(raw)
+}
+
+func isQueryTopic(topic string) bool {
+	return strings.HasPrefix(topic, queryTopicPrefix)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/apikeys"
+	"selin/internal/rbac"
+)
+
+// testKeys issues the API keys test connections use, one per hub and
+// user, from a miniredis the hub checks keys against.
+var (
+	testKeys  = map[*Hub]map[string]string{}
+	testRedis = map[*Hub]*miniredis.Miniredis{}
+)
+
+// userKey returns an API key in the default workspace named userID.
+func userKey(t *testing.T, hub *Hub, userID string) string {
+	t.Helper()
+	return workspaceKey(t, hub, apikeys.DefaultWorkspace, userID)
+}
+
+// workspaceKey returns an API key in workspace named userID, creating the
+// workspace.
+func workspaceKey(t *testing.T, hub *Hub, workspace, userID string) string {
+	t.Helper()
+	if hub.keys == nil {
+		mr := miniredis.RunT(t)
+		hub.keys = apikeys.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+		testKeys[hub] = map[string]string{}
+		testRedis[hub] = mr
+		t.Cleanup(func() {
+			delete(testKeys, hub)
+			delete(testRedis, hub)
+		})
+	}
+	if key, ok := testKeys[hub][userID]; ok {
+		return key
+	}
+	if workspace != apikeys.DefaultWorkspace {
+		testRedis[hub].HSet(apikeys.WorkspacesKey, workspace, `{"id":"`+workspace+`"}`)
+	}
+	key, err := hub.keys.Create(context.Background(), userID, workspace, rbac.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeys[hub][userID] = key
+	return key
+}
+
+func TestRequestCaller(t *testing.T) {
+	mr := miniredis.RunT(t)
+	hub := newHub()
+	hub.keys = apikeys.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	mr.HSet(apikeys.WorkspacesKey, "team-a", `{"id":"team-a"}`)
+	key, _ := hub.keys.Create(context.Background(), "team-a-ci", "team-a", rbac.Reader)
+
+	resolve := func(key, claimed string) (caller, int) {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Header.Set("X-Workspace-ID", claimed)
+		r.Header.Set("X-User-ID", "alice")
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		who, _ := requestCaller(hub, rr, r)
+		return who, rr.Code
+	}
+
+	if who, _ := resolve(key, "team-b"); who != (caller{workspace: "team-a", userID: "team-a-ci"}) {
+		t.Errorf("Expected the key's workspace and name, not the claimed ones, got %+v", who)
+	}
+	if who, _ := resolve("", "team-a"); who != (caller{workspace: apikeys.DefaultWorkspace, userID: anonymousUser}) {
+		t.Errorf("Expected a keyless connection anonymous in the default workspace, got %+v", who)
+	}
+	if _, code := resolve("selin_nope", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected an invalid key to be refused, got %d", code)
+	}
+
+	hub.requireKey = true
+	if _, code := resolve("", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected a keyless connection to be refused with REQUIRE_API_KEY, got %d", code)
+	}
+}
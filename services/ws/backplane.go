@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/config"
+)
+
+// Redis channel every ws replica subscribes to. Other services can PUBLISH
+// an Envelope here to reach connected clients without knowing which replica
+// holds the connection.
+const backplaneChannel = "ws:events"
+
+// Presence is stored per replica so a crashed replica's entries expire on
+// their own instead of leaving stale users online.
+const (
+	presenceKeyPrefix = "ws:presence:"
+	presenceTTL       = 30 * time.Second
+	presenceRefresh   = 10 * time.Second
+)
+
+// Envelope is the unit exchanged over the backplane.
+// Either Topic or UserID must be set: a topic reaches its subscribers
+// (optionally only those belonging to UserID), while a UserID alone is a
+// direct message to all of that user's connections.
+type Envelope struct {
+	Type      string          `json:"type,omitempty"` // message type, "event" when empty
+	Topic     string          `json:"topic,omitempty"`
+	Workspace string          `json:"workspace_id,omitempty"` // limits a topic message to one workspace's clients
+	UserID    string          `json:"user_id,omitempty"`
+	Seq       int64           `json:"seq,omitempty"`  // per-user sequence, set when queued for replay
+	Tags      []string        `json:"tags,omitempty"` // lets clients filter by their subscribed_tags
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+func (env Envelope) valid() bool {
+	if env.Topic == "" {
+		return env.UserID != ""
+	}
+	return validTopic(env.Topic)
+}
+
+// Backplane fans published messages out to every ws replica through Redis
+// pub/sub and shares which users are connected to which replica.
+type Backplane struct {
+	client     *redis.Client
+	instanceID string
+
+	mu       sync.Mutex
+	presence map[string]string // clientID -> userID on this replica
+	dirty    chan struct{}
+}
+
+// NewBackplaneFromEnv returns a Redis backplane when WS_BACKPLANE=redis, or
+// nil to run as a standalone instance.
+func NewBackplaneFromEnv() *Backplane {
+	if os.Getenv("WS_BACKPLANE") != "redis" {
+		return nil
+	}
+
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "localhost:6379"
+	}
+
+	client := config.RedisClient(redisURL)
+
+	return newBackplane(client)
+}
+
+func newBackplane(client *redis.Client) *Backplane {
+	hostname, _ := os.Hostname()
+	return &Backplane{
+		client:     client,
+		instanceID: fmt.Sprintf("%s_%s", hostname, generateClientID()),
+		presence:   make(map[string]string),
+		dirty:      make(chan struct{}, 1),
+	}
+}
+
+// Publish sends an envelope to every replica, including this one.
+func (b *Backplane) Publish(ctx context.Context, env Envelope) error {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, backplaneChannel, payload).Err()
+}
+
+// Run delivers envelopes received from Redis to deliver and keeps this
+// replica's presence entry fresh until ctx is cancelled.
+func (b *Backplane) Run(ctx context.Context, deliver func(Envelope)) {
+	pubsub := b.client.Subscribe(ctx, backplaneChannel)
+	defer pubsub.Close()
+
+	// Wait for the subscription to be confirmed so no publish is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		slog.Error("backplane subscription failed", "error", err)
+	}
+
+	go b.syncPresence(ctx)
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var env Envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil || !env.valid() {
+				slog.Warn("dropping malformed backplane message", "payload", msg.Payload)
+				continue
+			}
+			messagesTotal.WithLabelValues("backplane", "inbound").Inc()
+			deliver(env)
+		}
+	}
+}
+
+// trackPresence records a connect or disconnect on this replica. It never
+// blocks; Redis is updated by the presence sync loop.
+func (b *Backplane) trackPresence(clientID, userID string, connected bool) {
+	b.mu.Lock()
+	if connected {
+		b.presence[clientID] = userID
+	} else {
+		delete(b.presence, clientID)
+	}
+	b.mu.Unlock()
+
+	select {
+	case b.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Backplane) syncPresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceRefresh)
+	defer ticker.Stop()
+
+	key := presenceKeyPrefix + b.instanceID
+	defer b.client.Del(context.Background(), key)
+
+	for {
+		b.writePresence(ctx, key)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.dirty:
+		}
+	}
+}
+
+func (b *Backplane) writePresence(ctx context.Context, key string) {
+	b.mu.Lock()
+	snapshot := make(map[string]interface{}, len(b.presence))
+	for clientID, userID := range b.presence {
+		snapshot[clientID] = userID
+	}
+	b.mu.Unlock()
+
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(snapshot) > 0 {
+			pipe.HSet(ctx, key, snapshot)
+			pipe.Expire(ctx, key, presenceTTL)
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		slog.Error("failed to write presence", "error", err)
+	}
+}
+
+// OnlineUsers returns the number of open connections per user across all
+// replicas.
+func (b *Backplane) OnlineUsers(ctx context.Context) (map[string]int, error) {
+	users := make(map[string]int)
+	iter := b.client.Scan(ctx, 0, presenceKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		entries, err := b.client.HGetAll(ctx, iter.Val()).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, userID := range entries {
+			users[userID]++
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (b *Backplane) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// startReplica runs a hub wired to the shared Redis, as a separate ws
+// instance would be.
+func startReplica(t *testing.T, mr *miniredis.Miniredis) *Hub {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	backplane := newBackplane(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { backplane.Close() })
+
+	hub := newHub()
+	hub.backplane = backplane
+	go hub.run()
+
+	go backplane.Run(ctx, hub.deliver)
+	waitUntil(t, func() bool { return len(mr.PubSubChannels(backplaneChannel)) > 0 })
+	return hub
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBackplaneFansOutAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicaA := startReplica(t, mr)
+	replicaB := startReplica(t, mr)
+
+	onA := dialHub(t, replicaA, "alice")
+	onB := dialHub(t, replicaB, "bob")
+	onA.send(Message{Type: "subscribe", Topic: "content.new"})
+	onA.next()
+	onB.send(Message{Type: "subscribe", Topic: "content.new"})
+	onB.next()
+
+	if err := replicaA.Publish("content.new", map[string]int{"count": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, conn := range []*testConn{onA, onB} {
+		if msg := conn.next(); msg.Type != "event" || msg.Topic != "content.new" {
+			t.Errorf("Expected content.new event on every replica, got %+v", msg)
+		}
+	}
+	onA.expectNone()
+}
+
+func TestBackplaneAcceptsExternalPublishers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replica := startReplica(t, mr)
+
+	conn := dialHub(t, replica, "alice")
+	conn.send(Message{Type: "subscribe", Topic: "digest.daily"})
+	conn.next()
+
+	mr.Publish(backplaneChannel, `{"topic":"digest.daily","data":{"items":5}}`)
+	mr.Publish(backplaneChannel, `not json`)
+
+	msg := conn.next()
+	if msg.Topic != "digest.daily" {
+		t.Fatalf("Expected digest.daily event, got %+v", msg)
+	}
+	if data, ok := msg.Data.(map[string]interface{}); !ok || data["items"] != float64(5) {
+		t.Errorf("Expected payload to pass through, got %#v", msg.Data)
+	}
+}
+
+func TestBackplaneSharesPresence(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replicaA := startReplica(t, mr)
+	replicaB := startReplica(t, mr)
+
+	dialHub(t, replicaA, "alice")
+	dialHub(t, replicaB, "alice")
+	dialHub(t, replicaB, "bob")
+
+	waitUntil(t, func() bool {
+		users, err := replicaA.backplane.OnlineUsers(context.Background())
+		return err == nil && users["alice"] == 2 && users["bob"] == 1
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"selin/internal/apikeys"
+	"selin/internal/events"
+)
+
+// Topic new content from collectors and uploads alike is pushed on.
+const contentNewTopic = events.ContentNewTopic
+
+// uploadPayload is what clients receive on content.new for an upload, the
+// same payload the uploader used to post to /publish.
+type uploadPayload struct {
+	events.Upload
+	Workspace string    `json:"workspace_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// runEventBus pushes bus events to subscribed clients until ctx is done.
+// Every replica subscribes and delivers to its own clients only, so events
+// are not fanned out again over the backplane.
+func runEventBus(ctx context.Context, hub *Hub, bus events.Bus) {
+	err := bus.Subscribe(ctx, func(e events.Event) {
+		env, ok := busEnvelope(e)
+		if !ok {
+			slog.Warn("dropping malformed event", "type", e.Type)
+			return
+		}
+		messagesTotal.WithLabelValues("bus", "inbound").Inc()
+		hub.deliver(env)
+	}, events.ContentCreated, events.UploadCompleted, events.EmbeddingReady, events.WatchMatched)
+	if err != nil {
+		slog.Error("event bus subscription failed", "error", err)
+	}
+}
+
+// busEnvelope turns a bus event into the message clients get: content.new
+// for new collected content and uploads, embedding.ready as it is, both only to the
+// event's workspace, and watch_match to the connections of the user whose
+// watch new content matched.
+func busEnvelope(e events.Event) (Envelope, bool) {
+	workspace := e.Workspace
+	if workspace == "" {
+		workspace = apikeys.DefaultWorkspace
+	}
+	switch e.Type {
+	case events.ContentCreated:
+		var c events.Content
+		if err := e.Decode(&c); err != nil || c.Uploaded {
+			return Envelope{}, false
+		}
+		return Envelope{Topic: contentNewTopic, Workspace: workspace, Tags: c.Tags, Data: e.Data, Timestamp: e.Time}, true
+	case events.UploadCompleted:
+		var u events.Upload
+		if err := e.Decode(&u); err != nil {
+			return Envelope{}, false
+		}
+		data, err := json.Marshal(uploadPayload{Upload: u, Workspace: workspace, Timestamp: e.Time})
+		if err != nil {
+			return Envelope{}, false
+		}
+		return Envelope{Topic: contentNewTopic, Workspace: workspace, Tags: u.Tags, Data: data, Timestamp: e.Time}, true
+	case events.EmbeddingReady:
+		if !json.Valid(e.Data) {
+			return Envelope{}, false
+		}
+		return Envelope{Topic: events.EmbeddingReady, Workspace: workspace, Data: e.Data, Timestamp: e.Time}, true
+	case events.WatchMatched:
+		var m events.WatchMatch
+		if err := e.Decode(&m); err != nil || m.UserID == "" {
+			return Envelope{}, false
+		}
+		return Envelope{Type: "watch_match", UserID: m.UserID, Data: e.Data, Timestamp: e.Time}, true
+	}
+	return Envelope{}, false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"selin/internal/events"
+)
+
+func TestBusEnvelope(t *testing.T) {
+	e, _ := events.New(events.ContentCreated, "default", events.Content{ID: "c1", Tags: []string{"golang"}, Score: 0.9})
+	env, ok := busEnvelope(e)
+	if !ok || env.Topic != contentNewTopic || env.Workspace != "default" || !reflect.DeepEqual(env.Tags, []string{"golang"}) || string(env.Data) != string(e.Data) {
+		t.Errorf("Expected content.created pushed as content.new, got %+v", env)
+	}
+
+	e, _ = events.New(events.UploadCompleted, "team", events.Upload{ID: "f1", Platform: "slack", Filename: "export.zip", Items: 3})
+	env, ok = busEnvelope(e)
+	var payload map[string]interface{}
+	if !ok || env.Topic != contentNewTopic || env.Workspace != "team" || json.Unmarshal(env.Data, &payload) != nil {
+		t.Fatalf("Expected upload.completed pushed as content.new, got %+v", env)
+	}
+	if payload["id"] != "f1" || payload["workspace_id"] != "team" || payload["filename"] != "export.zip" || payload["items"] != float64(3) {
+		t.Errorf("Expected the upload payload with its workspace, got %v", payload)
+	}
+
+	e, _ = events.New(events.EmbeddingReady, "default", events.Embedding{ContentID: "c1"})
+	if env, ok := busEnvelope(e); !ok || env.Topic != events.EmbeddingReady {
+		t.Errorf("Expected embedding.ready pushed as is, got %+v", env)
+	}
+
+	e, _ = events.New(events.WatchMatched, "default", events.WatchMatch{WatchID: "w1", UserID: "alice", Expression: "CVE"})
+	if env, ok := busEnvelope(e); !ok || env.Type != "watch_match" || env.UserID != "alice" || env.Topic != "" {
+		t.Errorf("Expected watch.matched pushed to its user, got %+v", env)
+	}
+
+	for _, bad := range []events.Event{
+		{Type: events.ContentCreated, Data: json.RawMessage(`"not an object"`)},
+		// Uploads are pushed once per file, as upload.completed
+		{Type: events.ContentCreated, Data: json.RawMessage(`{"id": "c2", "uploaded": true}`)},
+		{Type: events.WatchMatched, Data: json.RawMessage(`{"watch_id": "w1"}`)},
+		{Type: "digest.daily", Data: json.RawMessage(`{}`)},
+	} {
+		if _, ok := busEnvelope(bad); ok {
+			t.Errorf("Expected %+v to be dropped", bad)
+		}
+	}
+}
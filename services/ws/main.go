@@ -3,17 +3,32 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"selin/internal/apikeys"
+	"selin/internal/clients"
+	"selin/internal/events"
+	"selin/internal/flags"
+	"selin/internal/healthcheck"
+	"selin/internal/llm"
+	"selin/internal/logging"
+	"selin/internal/query"
+	"selin/internal/tlsserve"
+	"selin/internal/tokenizer"
 )
 
 // Metrics
@@ -38,15 +53,24 @@ var (
 		},
 		[]string{"type", "direction"},
 	)
+	droppedMessages = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ws_dropped_messages_total",
+			Help: "Messages dropped from full client send queues",
+		},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(connectionsTotal)
 	prometheus.MustRegister(activeConnections)
 	prometheus.MustRegister(messagesTotal)
+	prometheus.MustRegister(droppedMessages)
 }
 
 var upgrader = websocket.Upgrader{
+	// Negotiate permessage-deflate with clients that offer it
+	EnableCompression: true,
 	CheckOrigin: func(r *http.Request) bool {
 		// TODO: Implement proper origin checking for security
 		return true
@@ -54,40 +78,358 @@ var upgrader = websocket.Upgrader{
 }
 
 type Client struct {
-	conn     *websocket.Conn
-	send     chan []byte
-	hub      *Hub
-	userID   string
-	clientID string
+	conn        *websocket.Conn
+	send        chan []byte
+	hub         *Hub
+	userID      string
+	workspace   string // from the API key, for queries
+	clientID    string
+	transport   string // "websocket" or "sse"
+	connectedAt time.Time
+	received    atomic.Int64
+
+	// Owned by the hub goroutine. closeCode and closeReason are set before
+	// send is closed and become the close frame written by writePump.
+	topics      map[string]bool
+	dropped     int             // consecutive messages dropped from a full queue
+	tagFilter   map[string]bool // from the subscribed_tags preference
+	sentCount   int64
+	dropCount   int64
+	closeCode   int
+	closeReason string
+
+	// Owned by the readPump goroutine
+	preferences Preferences
+	lastAck     int64
+	queryTopics map[string]bool // the topics of the queries this connection ran
 }
 
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
+	clients     map[*Client]bool
+	users       map[string]map[*Client]bool
+	topics      map[string]map[*Client]bool
+	broadcast   chan []byte
+	register    chan *Client
+	unregister  chan *Client
+	subscribe   chan subscription
+	unsubscribe chan subscription
+	publish     chan publication
+	direct      chan direct
+	inspect     chan chan []ConnectionInfo
+	filters     chan tagFilter
+	backplane   *Backplane      // nil when running as a single instance
+	offline     *OfflineQueue   // nil when replay on reconnect is disabled
+	queries     QueryRunner     // nil when this server cannot run queries
+	prefs       PreferenceStore // nil when preferences only last a connection
+	keys        *apikeys.Store  // nil when API keys are not checked
+	requireKey  bool            // refuse connections without an API key
+
+	sendQueueSize int
+	maxDrops      int
+
+	// Connection limits and keepalive timing
+	readLimit  int64
+	pongWait   time.Duration
+	pingPeriod time.Duration
+	writeWait  time.Duration
 }
 
 type Message struct {
 	Type      string      `json:"type"`
+	ID        string      `json:"id,omitempty"` // echoes the client request ID in replies
+	Topic     string      `json:"topic,omitempty"`
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
 	UserID    string      `json:"user_id,omitempty"`
+	Seq       int64       `json:"seq,omitempty"`
+}
+
+type subscription struct {
+	client *Client
+	topic  string
+	id     string // request ID echoed in the confirmation
+}
+
+type publication struct {
+	topic     string   // empty for direct messages
+	workspace string   // empty reaches subscribers in every workspace
+	userID    string   // empty delivers to every subscriber
+	tags      []string // matched against subscribers' subscribed_tags
+	message   []byte
+}
+
+// direct carries messages for one specific connection, such as protocol
+// replies or a replay of queued messages.
+type direct struct {
+	client   *Client
+	messages [][]byte
+}
+
+// Connections without an API key share this identity, so it can never be
+// the target of a direct message.
+const anonymousUser = "anonymous"
+
+var errNoRecipient = errors.New("a named user is required for direct messages")
+
+// Topics are dot-separated segments, e.g. "content.new" or "query.3f9a...".
+var topicPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+const maxTopicLength = 128
+
+func validTopic(topic string) bool {
+	return len(topic) <= maxTopicLength && topicPattern.MatchString(topic)
 }
 
 type StreamUpdate struct {
 	RequestID string `json:"request_id"`
+	Tool      string `json:"tool,omitempty"` // the tool a "streaming" update is the output of
 	Content   string `json:"content"`
-	Status    string `json:"status"` // "streaming", "complete", "error"
+	Status    string `json:"status"`             // "streaming", "complete", "error"
+	IsError   bool   `json:"is_error,omitempty"` // the tool failed; the query goes on without it
+	// TokenCount is the length of the assembled context of a "complete" update
+	TokenCount int `json:"token_count,omitempty"`
+	// Answer is the LLM's answer in a "complete" update, when there is one
+	Answer string `json:"answer,omitempty"`
+	// AnswerError says why a "complete" update has no answer despite an LLM
+	// being configured, such as a spent budget
+	AnswerError string `json:"answer_error,omitempty"`
 }
 
 func newHub() *Hub {
+	pongWait := envDuration("WS_PONG_WAIT", 60*time.Second)
+	pingPeriod := envDuration("WS_PING_INTERVAL", pongWait*9/10)
+	if pingPeriod >= pongWait {
+		slog.Warn("WS_PING_INTERVAL must be shorter than WS_PONG_WAIT", "ping_interval", pingPeriod, "pong_wait", pongWait, "using", pongWait*9/10)
+		pingPeriod = pongWait * 9 / 10
+	}
+
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		clients:     make(map[*Client]bool),
+		users:       make(map[string]map[*Client]bool),
+		topics:      make(map[string]map[*Client]bool),
+		broadcast:   make(chan []byte),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		subscribe:   make(chan subscription),
+		unsubscribe: make(chan subscription),
+		publish:     make(chan publication),
+		direct:      make(chan direct),
+		inspect:     make(chan chan []ConnectionInfo),
+		filters:     make(chan tagFilter),
+
+		sendQueueSize: envInt("WS_SEND_QUEUE_SIZE", 256),
+		maxDrops:      envInt("WS_MAX_DROPPED_MESSAGES", 64),
+
+		readLimit:  int64(envInt("WS_READ_LIMIT", 64*1024)),
+		pongWait:   pongWait,
+		pingPeriod: pingPeriod,
+		writeWait:  envDuration("WS_WRITE_WAIT", 10*time.Second),
+	}
+}
+
+// Publish sends data to every client subscribed to topic, on every replica
+// when a backplane is configured.
+func (h *Hub) Publish(topic string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	h.publishEnvelope(Envelope{Topic: topic, Data: raw, Timestamp: time.Now()})
+	return nil
+}
+
+// SendToUser delivers msg to every connection of userID, whichever replica
+// holds them, regardless of topic subscriptions.
+func (h *Hub) SendToUser(userID string, msg Message) error {
+	if userID == "" || userID == anonymousUser {
+		return errNoRecipient
+	}
+	raw, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	h.publishEnvelope(Envelope{
+		Type:      msg.Type,
+		Topic:     msg.Topic,
+		UserID:    userID,
+		Data:      raw,
+		Timestamp: msg.Timestamp,
+	})
+	return nil
+}
+
+// publishEnvelope routes an envelope through the backplane when there is
+// one, falling back to local delivery if Redis cannot be reached. Messages
+// for a specific user are numbered and kept for replay first.
+func (h *Hub) publishEnvelope(env Envelope) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if h.offline != nil && env.UserID != "" {
+		h.enqueueOffline(ctx, &env)
+	}
+
+	if h.backplane != nil {
+		err := h.backplane.Publish(ctx, env)
+		if err == nil {
+			return
+		}
+		slog.Error("backplane publish failed, delivering locally only", "error", err)
+	}
+
+	h.deliver(env)
+}
+
+// enqueueOffline assigns the envelope its sequence number and stores it in
+// the user's outbox. Failures are logged; live delivery still goes ahead.
+func (h *Hub) enqueueOffline(ctx context.Context, env *Envelope) {
+	seq, err := h.offline.NextSeq(ctx, env.UserID)
+	if err != nil {
+		slog.Error("failed to allocate sequence", "user_id", env.UserID, "error", err)
+		return
+	}
+	env.Seq = seq
+
+	msg, err := encodeEnvelope(*env)
+	if err != nil {
+		return
+	}
+	if err := h.offline.Store(ctx, env.UserID, msg); err != nil {
+		slog.Error("failed to queue message", "seq", seq, "user_id", env.UserID, "error", err)
+	}
+}
+
+func encodeEnvelope(env Envelope) ([]byte, error) {
+	msgType := env.Type
+	if msgType == "" {
+		msgType = "event"
+	}
+	return json.Marshal(Message{
+		Type:      msgType,
+		Topic:     env.Topic,
+		Data:      env.Data,
+		Timestamp: env.Timestamp,
+		UserID:    env.UserID,
+		Seq:       env.Seq,
+	})
+}
+
+// deliver hands an envelope to this replica's subscribers.
+func (h *Hub) deliver(env Envelope) {
+	msg, err := encodeEnvelope(env)
+	if err != nil {
+		slog.Error("failed to encode message", "topic", env.Topic, "error", err)
+		return
+	}
+	h.publish <- publication{topic: env.Topic, workspace: env.Workspace, userID: env.UserID, tags: env.Tags, message: msg}
+}
+
+// removeFromTopic drops a client from a topic, deleting the topic once empty.
+func (h *Hub) removeFromTopic(client *Client, topic string) {
+	if subscribers, ok := h.topics[topic]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+	delete(client.topics, topic)
+}
+
+// removeClient drops a client from the hub and all of its topics and closes
+// its send channel. It is a no-op for clients already removed. Must only be
+// called from the hub goroutine.
+func (h *Hub) removeClient(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	for topic := range client.topics {
+		h.removeFromTopic(client, topic)
+	}
+	if conns, ok := h.users[client.userID]; ok {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(h.users, client.userID)
+			h.announcePresence(client.userID, PresenceLeave)
+		}
+	}
+	delete(h.clients, client)
+	if h.backplane != nil {
+		h.backplane.trackPresence(client.clientID, client.userID, false)
+	}
+	close(client.send)
+	activeConnections.Dec()
+}
+
+// disconnect removes a client and tells it why with a close frame.
+// Must only be called from the hub goroutine.
+func (h *Hub) disconnect(client *Client, code int, reason string) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	client.closeCode = code
+	client.closeReason = reason
+	h.removeClient(client)
+	connectionsTotal.WithLabelValues("evicted").Inc()
+	slog.Info("client disconnected", "client_id", client.clientID, "reason", reason, "clients", len(h.clients))
+}
+
+// enqueue queues msg for client without blocking. When the queue is full the
+// oldest queued message is dropped to make room, and a client that keeps it
+// full for maxDrops messages in a row is disconnected as too slow. Reports
+// whether the client is still connected. Must only be called from the hub
+// goroutine.
+func (h *Hub) enqueue(client *Client, msg []byte) bool {
+	select {
+	case client.send <- msg:
+		client.dropped = 0
+		client.sentCount++
+		return true
+	default:
+	}
+
+	client.dropped++
+	client.dropCount++
+	droppedMessages.Inc()
+	if client.dropped >= h.maxDrops {
+		h.disconnect(client, websocket.CloseTryAgainLater, "slow consumer")
+		return false
+	}
+
+	select {
+	case <-client.send:
+	default:
 	}
+	// The hub is the only sender, so there is room now
+	client.send <- msg
+	client.sentCount++
+	return true
+}
+
+// recipients returns the local clients a publication should reach.
+func (h *Hub) recipients(pub publication) map[*Client]bool {
+	if pub.userID == "" {
+		return h.topics[pub.topic]
+	}
+	targets := make(map[*Client]bool)
+	for client := range h.users[pub.userID] {
+		if pub.topic == "" || client.topics[pub.topic] {
+			targets[client] = true
+		}
+	}
+	return targets
+}
+
+// notify queues a control message for a single client.
+// Must only be called from the hub goroutine.
+func (h *Hub) notify(client *Client, msgType, topic, id string) {
+	msg, err := json.Marshal(Message{Type: msgType, ID: id, Topic: topic, Timestamp: time.Now()})
+	if err != nil {
+		return
+	}
+	h.enqueue(client, msg)
 }
 
 func (h *Hub) run() {
@@ -95,9 +437,17 @@ func (h *Hub) run() {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
+			if h.users[client.userID] == nil {
+				h.users[client.userID] = make(map[*Client]bool)
+				h.announcePresence(client.userID, PresenceJoin)
+			}
+			h.users[client.userID][client] = true
+			if h.backplane != nil {
+				h.backplane.trackPresence(client.clientID, client.userID, true)
+			}
 			activeConnections.Inc()
 			connectionsTotal.WithLabelValues("connected").Inc()
-			log.Printf("Client %s connected. Total clients: %d", client.clientID, len(h.clients))
+			slog.Info("client connected", "client_id", client.clientID, "clients", len(h.clients))
 
 			// Send welcome message
 			welcome := Message{
@@ -106,34 +456,72 @@ func (h *Hub) run() {
 				Timestamp: time.Now(),
 			}
 			if msg, err := json.Marshal(welcome); err == nil {
-				select {
-				case client.send <- msg:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+				h.enqueue(client, msg)
 			}
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				activeConnections.Dec()
+				h.removeClient(client)
 				connectionsTotal.WithLabelValues("disconnected").Inc()
-				log.Printf("Client %s disconnected. Total clients: %d", client.clientID, len(h.clients))
+				slog.Info("client disconnected", "client_id", client.clientID, "clients", len(h.clients))
+			}
+
+		case sub := <-h.subscribe:
+			if _, ok := h.clients[sub.client]; !ok {
+				continue
+			}
+			if h.topics[sub.topic] == nil {
+				h.topics[sub.topic] = make(map[*Client]bool)
+			}
+			h.topics[sub.topic][sub.client] = true
+			sub.client.topics[sub.topic] = true
+			h.notify(sub.client, "subscribed", sub.topic, sub.id)
+
+		case sub := <-h.unsubscribe:
+			if _, ok := h.clients[sub.client]; !ok {
+				continue
+			}
+			h.removeFromTopic(sub.client, sub.topic)
+			h.notify(sub.client, "unsubscribed", sub.topic, sub.id)
+
+		case pub := <-h.publish:
+			if pub.topic == "" {
+				messagesTotal.WithLabelValues("direct", "outbound").Inc()
+			} else {
+				messagesTotal.WithLabelValues("topic", "outbound").Inc()
+			}
+			for client := range h.recipients(pub) {
+				if pub.workspace != "" && client.workspace != pub.workspace {
+					continue
+				}
+				if client.wantsTags(pub.tags) {
+					h.enqueue(client, pub.message)
+				}
+			}
+
+		case d := <-h.direct:
+			if _, ok := h.clients[d.client]; !ok {
+				continue
+			}
+			for _, msg := range d.messages {
+				if !h.enqueue(d.client, msg) {
+					break
+				}
 			}
 
 		case message := <-h.broadcast:
 			messagesTotal.WithLabelValues("broadcast", "outbound").Inc()
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-					activeConnections.Dec()
-				}
+				h.enqueue(client, message)
+			}
+
+		case f := <-h.filters:
+			if _, ok := h.clients[f.client]; ok {
+				f.client.tagFilter = f.tags
 			}
+
+		case reply := <-h.inspect:
+			reply <- h.connections()
 		}
 	}
 }
@@ -144,35 +532,36 @@ func (c *Client) readPump() {
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(512)
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	// ReadMessage reassembles fragmented and compressed messages; the limit
+	// applies to the whole message, and oversized ones are answered with a
+	// 1009 close frame.
+	c.conn.SetReadLimit(c.hub.readLimit)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.pongWait))
 		return nil
 	})
 
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+			if errors.Is(err, websocket.ErrReadLimit) {
+				slog.Warn("client message too large", "client_id", c.clientID, "limit_bytes", c.hub.readLimit)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				slog.Warn("websocket error", "client_id", c.clientID, "error", err)
 			}
 			break
 		}
 
 		messagesTotal.WithLabelValues("client", "inbound").Inc()
+		c.received.Add(1)
 
-		// Handle client messages (like ping/pong, preferences updates)
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err == nil {
-			log.Printf("Received message from client %s: %s", c.clientID, msg.Type)
-			// TODO: Handle different message types (e.g., preferences, subscriptions)
-		}
+		c.handleInbound(message)
 	}
 }
 
 func (c *Client) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
+	ticker := time.NewTicker(c.hub.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -181,9 +570,13 @@ func (c *Client) writePump() {
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, c.closeReason))
 				return
 			}
 
@@ -194,10 +587,13 @@ func (c *Client) writePump() {
 			w.Write(message)
 
 			// Add queued messages
-			n := len(c.send)
-			for i := 0; i < n; i++ {
+			for n := len(c.send); n > 0; n-- {
+				next := c.tryNext()
+				if next == nil {
+					break
+				}
 				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+				w.Write(next)
 			}
 
 			if err := w.Close(); err != nil {
@@ -206,7 +602,7 @@ func (c *Client) writePump() {
 			messagesTotal.WithLabelValues("server", "outbound").Inc()
 
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -214,35 +610,94 @@ func (c *Client) writePump() {
 	}
 }
 
+// tryNext returns the next queued message, or nil if there is none. The hub
+// may drop the oldest queued message at any time, so writers draining a
+// batch must never block on send.
+func (c *Client) tryNext() []byte {
+	select {
+	case msg := <-c.send:
+		return msg
+	default:
+		return nil
+	}
+}
+
+// envInt reads a positive integer from the environment, falling back to def.
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// envDuration reads a Go duration (e.g. "30s") from the environment.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
 func generateClientID() string {
 	nano := time.Now().UnixNano()
 	return time.Now().Format("20060102150405") + "_" + fmt.Sprintf("%d", nano%100000)
 }
 
 func wsHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	who, ok := requestCaller(hub, w, r)
+	if !ok {
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("WebSocket upgrade error:", err)
+		logging.FromContext(r.Context()).Warn("websocket upgrade failed", "error", err)
 		return
 	}
 
-	userID := r.Header.Get("X-User-ID")
-	if userID == "" {
-		userID = "anonymous"
-	}
-
+	prefs := storedPreferences(hub, who.workspace, who.userID)
 	client := &Client{
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		hub:      hub,
-		userID:   userID,
-		clientID: generateClientID(),
+		conn:        conn,
+		send:        make(chan []byte, hub.sendQueueSize),
+		hub:         hub,
+		userID:      who.userID,
+		workspace:   who.workspace,
+		clientID:    generateClientID(),
+		transport:   "websocket",
+		connectedAt: time.Now(),
+		topics:      make(map[string]bool),
+		tagFilter:   tagSet(prefs.SubscribedTags),
+		preferences: prefs,
 	}
 
 	client.hub.register <- client
 
 	go client.writePump()
 	go client.readPump()
+
+	// Replay anything queued since the client's last seen sequence number
+	if lastSeq, err := strconv.ParseInt(r.URL.Query().Get("last_seq"), 10, 64); err == nil {
+		replayMissed(hub, client, lastSeq)
+	}
+}
+
+func replayMissed(hub *Hub, client *Client, lastSeq int64) {
+	if hub.offline == nil || client.userID == anonymousUser {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages, err := hub.offline.Since(ctx, client.userID, lastSeq)
+	if err != nil {
+		slog.Error("failed to load queued messages", "user_id", client.userID, "error", err)
+		return
+	}
+	if len(messages) > 0 {
+		slog.Info("replaying queued messages", "client_id", client.clientID, "messages", len(messages))
+		messagesTotal.WithLabelValues("replay", "outbound").Add(float64(len(messages)))
+		hub.direct <- direct{client: client, messages: messages}
+	}
 }
 
 // Health endpoint
@@ -251,26 +706,58 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 		"status":    "OK",
 		"timestamp": time.Now(),
 		"version":   "1.0.0",
+		"flags":     flags.Default().Rules(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// Readiness endpoint
-func readyHandler(w http.ResponseWriter, r *http.Request) {
-	response := map[string]interface{}{
-		"status":    "READY",
-		"timestamp": time.Now(),
-		"version":   "1.0.0",
-	}
+// readiness gets a Redis check when the offline queue or backplane use it;
+// without them the hub depends on nothing.
+var readiness = healthcheck.New("ws")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	readiness.ServeHTTP(w, r)
 }
 
 func main() {
+	logging.Setup("ws", "1.0.0")
+	// Fail at startup rather than on first use when the flags or the
+	// tokenizer vocabulary are misconfigured
+	flags.Default()
+	tokenizer.Default()
+
+	ctx, cancelBackplane := context.WithCancel(context.Background())
+	defer cancelBackplane()
+
 	hub := newHub()
+	if offline := NewOfflineQueueFromEnv(); offline != nil {
+		hub.offline = offline
+		defer offline.Close()
+		readiness.Register(healthcheck.Check{Name: "redis-offline-queue", Probe: healthcheck.Redis(offline.client)})
+		slog.Info("offline message queue enabled")
+	}
+	if backplane := NewBackplaneFromEnv(); backplane != nil {
+		hub.backplane = backplane
+		defer backplane.Close()
+		readiness.Register(healthcheck.Check{Name: "redis-backplane", Probe: healthcheck.Redis(backplane.client)})
+		go backplane.Run(ctx, hub.deliver)
+		slog.Info("redis backplane enabled", "instance", backplane.instanceID)
+	}
+	if bus := events.Default("ws"); bus != events.Discard {
+		defer bus.Close()
+		go runEventBus(ctx, hub, bus)
+		slog.Info("event bus enabled", "bus", os.Getenv("EVENT_BUS"))
+	}
+	// LLM calls are accounted, and held to budgets, in the MCP server
+	if client := llm.Default(); client != nil {
+		client.Ledger = clients.NewMCPServer(clients.MCPServer.URL()).Ledger()
+	}
+	hub.queries = mcpQueryRunner(hub, query.New(clients.MCPServer.URL()))
+	hub.prefs = newMCPPreferences(clients.MCPServer.URL())
+	hub.keys = newAPIKeysFromEnv()
+	hub.requireKey = os.Getenv("REQUIRE_API_KEY") == "true"
 	go hub.run()
 
 	// Setup HTTP routes
@@ -281,6 +768,21 @@ func main() {
 		wsHandler(hub, w, r)
 	})
 
+	// Internal event publishing for other services
+	mux.HandleFunc("/publish", func(w http.ResponseWriter, r *http.Request) {
+		publishHandler(hub, w, r)
+	})
+
+	// Connection introspection for operators
+	mux.HandleFunc("/connections", func(w http.ResponseWriter, r *http.Request) {
+		connectionsHandler(hub, w, r)
+	})
+
+	// Server-Sent Events for clients that cannot use WebSockets
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		sseHandler(hub, w, r)
+	})
+
 	// Health and metrics endpoints
 	mux.HandleFunc("/health", healthHandler)
 	mux.HandleFunc("/ready", readyHandler)
@@ -292,9 +794,13 @@ func main() {
 		port = "8081"
 	}
 
+	// WebSocket upgrades need HTTP/1.1, so h2 is off when serving wss://
+	tlsConfig := tlsserve.FromEnv()
+	tlsConfig.HTTP1Only = true
+
 	server := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: logging.Middleware(tlsConfig.HSTS(mux)),
 		// Security timeouts
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
@@ -306,21 +812,21 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("WebSocket service starting on port %s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+		slog.Info("websocket service starting", "port", port, "scheme", tlsConfig.Scheme())
+		if err := tlsserve.ListenAndServe(server, tlsConfig); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("server failed to start", "error", err)
 		}
 	}()
 
 	<-stop
-	log.Println("Shutting down WebSocket service...")
+	slog.Info("shutting down websocket service")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logging.Fatal("server forced to shutdown", "error", err)
 	}
 
-	log.Println("WebSocket service stopped")
+	slog.Info("websocket service stopped")
 }
@@ -141,3 +141,296 @@ func TestClientIDGeneration(t *testing.T) {
 		t.Error("Client ID should not be empty")
 	}
 }
+
+// testConn wraps a client connection and splits the newline-batched frames
+// written by writePump back into individual messages.
+type testConn struct {
+	t       *testing.T
+	ws      *websocket.Conn
+	pending []Message
+}
+
+func dialHub(t *testing.T, hub *Hub, userID string) *testConn {
+	t.Helper()
+	return dialHubQuery(t, hub, userID, "")
+}
+
+func dialHubQuery(t *testing.T, hub *Hub, userID, query string) *testConn {
+	t.Helper()
+	key := ""
+	if userID != "" {
+		key = userKey(t, hub, userID)
+	}
+	return dialHubKey(t, hub, key, query)
+}
+
+// dialHubKey connects with the API key key, anonymously when it is empty.
+func dialHubKey(t *testing.T, hub *Hub, key, query string) *testConn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsHandler(hub, w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	header := http.Header{}
+	if key != "" {
+		header.Set("X-API-Key", key)
+	}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	if query != "" {
+		url += "?" + query
+	}
+	ws, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Could not open a ws connection: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	tc := &testConn{t: t, ws: ws}
+	if msg := tc.next(); msg.Type != "welcome" {
+		t.Fatalf("Expected welcome message, got %s", msg.Type)
+	}
+	return tc
+}
+
+func (tc *testConn) send(msg Message) {
+	tc.t.Helper()
+	if err := tc.ws.WriteJSON(msg); err != nil {
+		tc.t.Fatalf("Could not send message: %v", err)
+	}
+}
+
+func (tc *testConn) next() Message {
+	tc.t.Helper()
+	for len(tc.pending) == 0 {
+		tc.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := tc.ws.ReadMessage()
+		if err != nil {
+			tc.t.Fatalf("Could not read message: %v", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			var msg Message
+			if err := json.Unmarshal([]byte(line), &msg); err != nil {
+				tc.t.Fatalf("Could not unmarshal message %q: %v", line, err)
+			}
+			tc.pending = append(tc.pending, msg)
+		}
+	}
+	msg := tc.pending[0]
+	tc.pending = tc.pending[1:]
+	return msg
+}
+
+// expectNone asserts that nothing arrives within a short window. The read
+// timeout poisons the connection, so this must be the last read in a test.
+func (tc *testConn) expectNone() {
+	tc.t.Helper()
+	if len(tc.pending) > 0 {
+		tc.t.Fatalf("Expected no message, got %+v", tc.pending[0])
+	}
+	tc.ws.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := tc.ws.ReadMessage(); err == nil {
+		tc.t.Fatalf("Expected no message, got %s", data)
+	}
+}
+
+func TestTopicSubscriptions(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+
+	subscriber := dialHub(t, hub, "alice")
+	bystander := dialHub(t, hub, "bob")
+
+	subscriber.send(Message{Type: "subscribe", Topic: "content.new"})
+	if msg := subscriber.next(); msg.Type != "subscribed" || msg.Topic != "content.new" {
+		t.Fatalf("Expected subscribed confirmation, got %+v", msg)
+	}
+
+	if err := hub.Publish("content.new", map[string]interface{}{"count": 12}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := subscriber.next()
+	if msg.Type != "event" || msg.Topic != "content.new" {
+		t.Errorf("Expected content.new event, got %+v", msg)
+	}
+	bystander.expectNone()
+
+	subscriber.send(Message{Type: "unsubscribe", Topic: "content.new"})
+	if msg := subscriber.next(); msg.Type != "unsubscribed" {
+		t.Fatalf("Expected unsubscribed confirmation, got %+v", msg)
+	}
+	hub.Publish("content.new", "ignored")
+	subscriber.expectNone()
+}
+
+func TestValidTopic(t *testing.T) {
+	for _, topic := range []string{"content.new", "digest.daily", "query.req_1700000000"} {
+		if !validTopic(topic) {
+			t.Errorf("Expected %q to be valid", topic)
+		}
+	}
+	for _, topic := range []string{"", "content..new", ".content", "content new", strings.Repeat("a", 200)} {
+		if validTopic(topic) {
+			t.Errorf("Expected %q to be invalid", topic)
+		}
+	}
+}
+
+func TestSendToUserReachesEveryConnection(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+
+	laptop := dialHub(t, hub, "alice")
+	phone := dialHub(t, hub, "alice")
+	bob := dialHub(t, hub, "bob")
+
+	err := hub.SendToUser("alice", Message{Type: "query_result", Data: "answer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, conn := range []*testConn{laptop, phone} {
+		msg := conn.next()
+		if msg.Type != "query_result" || msg.Data != "answer" || msg.UserID != "alice" {
+			t.Errorf("Expected direct message for alice, got %+v", msg)
+		}
+	}
+	bob.expectNone()
+}
+
+func TestSendToUserRejectsAnonymous(t *testing.T) {
+	hub := newHub()
+	if err := hub.SendToUser(anonymousUser, Message{Type: "x"}); err != errNoRecipient {
+		t.Errorf("Expected errNoRecipient, got %v", err)
+	}
+	if err := hub.SendToUser("", Message{Type: "x"}); err != errNoRecipient {
+		t.Errorf("Expected errNoRecipient, got %v", err)
+	}
+}
+
+// stalledClient registers a client whose send queue is never drained.
+func stalledClient(hub *Hub, userID string) *Client {
+	client := &Client{
+		send:     make(chan []byte, hub.sendQueueSize),
+		hub:      hub,
+		userID:   userID,
+		clientID: generateClientID(),
+		topics:   make(map[string]bool),
+	}
+	hub.register <- client
+	return client
+}
+
+// syncHub returns once the hub has finished handling everything sent to it
+// before the call.
+func syncHub(hub *Hub) {
+	hub.unsubscribe <- subscription{client: &Client{}}
+}
+
+func TestFullQueueDropsOldest(t *testing.T) {
+	t.Setenv("WS_SEND_QUEUE_SIZE", "3")
+	hub := newHub()
+	go hub.run()
+
+	client := stalledClient(hub, "alice")
+	for i := 0; i < 5; i++ {
+		hub.SendToUser("alice", Message{Type: "update", Data: i})
+	}
+	syncHub(hub)
+
+	var got []float64
+	for len(client.send) > 0 {
+		var msg Message
+		json.Unmarshal(<-client.send, &msg)
+		got = append(got, msg.Data.(float64))
+	}
+	if len(got) != 3 || got[0] != 2 || got[1] != 3 || got[2] != 4 {
+		t.Errorf("Expected the newest messages [2 3 4], got %v", got)
+	}
+}
+
+func TestSlowClientDisconnectedWithReason(t *testing.T) {
+	t.Setenv("WS_SEND_QUEUE_SIZE", "1")
+	t.Setenv("WS_MAX_DROPPED_MESSAGES", "2")
+	hub := newHub()
+	go hub.run()
+
+	client := stalledClient(hub, "alice")
+	for i := 0; i < 3; i++ {
+		hub.SendToUser("alice", Message{Type: "update", Data: i})
+	}
+	syncHub(hub)
+
+	for range client.send {
+	}
+	if client.closeCode != websocket.CloseTryAgainLater || client.closeReason != "slow consumer" {
+		t.Errorf("Expected slow consumer close, got %d %q", client.closeCode, client.closeReason)
+	}
+
+	// Later messages and the client's own unregister must not panic
+	hub.SendToUser("alice", Message{Type: "update", Data: "late"})
+	hub.unregister <- client
+	syncHub(hub)
+}
+
+func TestLargeFragmentedMessage(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	// Well past the default 4KB write buffer, so it goes out as several frames
+	id := strings.Repeat("x", 20000)
+	conn.send(Message{Type: "subscribe", ID: id, Topic: "content.new"})
+	if msg := conn.next(); msg.Type != "subscribed" || msg.ID != id {
+		t.Errorf("Expected subscribed confirmation echoing the large id, got type %q", msg.Type)
+	}
+}
+
+func TestOversizedMessageClosed(t *testing.T) {
+	t.Setenv("WS_READ_LIMIT", "1024")
+	hub := newHub()
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.send(Message{Type: "subscribe", ID: strings.Repeat("x", 2048), Topic: "content.new"})
+	conn.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected close 1009, got %v", err)
+	}
+}
+
+func TestCompressionNegotiated(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsHandler(hub, w, r)
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Errorf("Expected permessage-deflate to be negotiated, got %q", ext)
+	}
+	tc := &testConn{t: t, ws: ws}
+	if msg := tc.next(); msg.Type != "welcome" {
+		t.Errorf("Expected welcome over a compressed connection, got %+v", msg)
+	}
+}
+
+func TestPingIntervalClampedBelowPongWait(t *testing.T) {
+	t.Setenv("WS_PONG_WAIT", "10s")
+	t.Setenv("WS_PING_INTERVAL", "30s")
+	hub := newHub()
+	if hub.pingPeriod >= hub.pongWait {
+		t.Errorf("Expected ping interval below pong wait, got %v >= %v", hub.pingPeriod, hub.pongWait)
+	}
+}
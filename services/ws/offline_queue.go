@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"selin/internal/config"
+)
+
+// OfflineQueue keeps the most recent user-directed messages in Redis so a
+// client reconnecting with ?last_seq=N can be sent everything after N. Each
+// user has a monotonic sequence counter that never expires, and a capped
+// list of messages that does.
+type OfflineQueue struct {
+	client *redis.Client
+	ttl    time.Duration
+	maxLen int64
+}
+
+// NewOfflineQueueFromEnv returns a Redis-backed queue when
+// WS_OFFLINE_QUEUE=redis, or nil to disable replay.
+func NewOfflineQueueFromEnv() *OfflineQueue {
+	if os.Getenv("WS_OFFLINE_QUEUE") != "redis" {
+		return nil
+	}
+
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "localhost:6379"
+	}
+
+	client := config.RedisClient(redisURL)
+
+	return newOfflineQueue(client,
+		envDuration("WS_OFFLINE_QUEUE_TTL", 24*time.Hour),
+		envInt("WS_OFFLINE_QUEUE_MAX", 100))
+}
+
+func newOfflineQueue(client *redis.Client, ttl time.Duration, maxLen int) *OfflineQueue {
+	return &OfflineQueue{client: client, ttl: ttl, maxLen: int64(maxLen)}
+}
+
+func seqKey(userID string) string    { return fmt.Sprintf("ws:seq:%s", userID) }
+func outboxKey(userID string) string { return fmt.Sprintf("ws:outbox:%s", userID) }
+
+// NextSeq allocates the next sequence number for userID.
+func (q *OfflineQueue) NextSeq(ctx context.Context, userID string) (int64, error) {
+	return q.client.Incr(ctx, seqKey(userID)).Result()
+}
+
+// Store appends an encoded message to the user's outbox, trimming it to the
+// configured length and refreshing its TTL.
+func (q *OfflineQueue) Store(ctx context.Context, userID string, msg []byte) error {
+	key := outboxKey(userID)
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, msg)
+		pipe.LTrim(ctx, key, -q.maxLen, -1)
+		pipe.Expire(ctx, key, q.ttl)
+		return nil
+	})
+	return err
+}
+
+// Since returns the stored messages with a sequence number above lastSeq, in
+// sequence order.
+func (q *OfflineQueue) Since(ctx context.Context, userID string, lastSeq int64) ([][]byte, error) {
+	entries, err := q.client.LRange(ctx, outboxKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	type queued struct {
+		seq int64
+		msg []byte
+	}
+	var pending []queued
+	for _, entry := range entries {
+		var header struct {
+			Seq int64 `json:"seq"`
+		}
+		if err := json.Unmarshal([]byte(entry), &header); err != nil || header.Seq <= lastSeq {
+			continue
+		}
+		pending = append(pending, queued{seq: header.Seq, msg: []byte(entry)})
+	}
+
+	// Concurrent senders may push slightly out of order
+	sort.Slice(pending, func(i, j int) bool { return pending[i].seq < pending[j].seq })
+
+	messages := make([][]byte, len(pending))
+	for i, p := range pending {
+		messages[i] = p.msg
+	}
+	return messages, nil
+}
+
+// Ack removes the stored messages with a sequence number up to seq, which
+// the user's client has confirmed receiving, so they are not replayed.
+func (q *OfflineQueue) Ack(ctx context.Context, userID string, seq int64) error {
+	key := outboxKey(userID)
+	entries, err := q.client.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	_, err = q.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, entry := range entries {
+			var header struct {
+				Seq int64 `json:"seq"`
+			}
+			if json.Unmarshal([]byte(entry), &header) == nil && header.Seq <= seq {
+				pipe.LRem(ctx, key, 1, entry)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (q *OfflineQueue) Close() error {
+	return q.client.Close()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestOfflineQueue(t *testing.T, maxLen int) (*OfflineQueue, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	q := newOfflineQueue(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour, maxLen)
+	t.Cleanup(func() { q.Close() })
+	return q, mr
+}
+
+func TestOfflineQueueSinceFiltersAndOrders(t *testing.T) {
+	q, _ := newTestOfflineQueue(t, 10)
+	ctx := context.Background()
+
+	for _, seq := range []int64{1, 3, 2, 4} {
+		q.Store(ctx, "alice", []byte(fmt.Sprintf(`{"type":"event","seq":%d}`, seq)))
+	}
+
+	messages, err := q.Since(ctx, "alice", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{"type":"event","seq":2}`, `{"type":"event","seq":3}`, `{"type":"event","seq":4}`}
+	if len(messages) != len(want) {
+		t.Fatalf("Expected %d messages, got %d", len(want), len(messages))
+	}
+	for i := range want {
+		if string(messages[i]) != want[i] {
+			t.Errorf("Message %d: got %s, want %s", i, messages[i], want[i])
+		}
+	}
+}
+
+func TestOfflineQueueTrimsAndExpires(t *testing.T) {
+	q, mr := newTestOfflineQueue(t, 3)
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		seq, err := q.NextSeq(ctx, "alice")
+		if err != nil || seq != int64(i) {
+			t.Fatalf("Expected seq %d, got %d (err=%v)", i, seq, err)
+		}
+		q.Store(ctx, "alice", []byte(fmt.Sprintf(`{"seq":%d}`, seq)))
+	}
+
+	messages, _ := q.Since(ctx, "alice", 0)
+	if len(messages) != 3 {
+		t.Errorf("Expected outbox trimmed to 3, got %d", len(messages))
+	}
+	if ttl := mr.TTL(outboxKey("alice")); ttl <= 0 {
+		t.Errorf("Expected outbox to have a TTL, got %v", ttl)
+	}
+	if ttl := mr.TTL(seqKey("alice")); ttl != 0 {
+		t.Errorf("Sequence counter must not expire, got TTL %v", ttl)
+	}
+}
+
+func TestOfflineQueueAck(t *testing.T) {
+	q, _ := newTestOfflineQueue(t, 10)
+	ctx := context.Background()
+
+	for _, seq := range []int64{1, 3, 2, 4} {
+		q.Store(ctx, "alice", []byte(fmt.Sprintf(`{"type":"event","seq":%d}`, seq)))
+	}
+	if err := q.Ack(ctx, "alice", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, _ := q.Since(ctx, "alice", 0)
+	want := []string{`{"type":"event","seq":3}`, `{"type":"event","seq":4}`}
+	if len(messages) != len(want) {
+		t.Fatalf("Expected %d messages after ack, got %d", len(want), len(messages))
+	}
+	for i := range want {
+		if string(messages[i]) != want[i] {
+			t.Errorf("Message %d: got %s, want %s", i, messages[i], want[i])
+		}
+	}
+}
+
+func TestReplayOnReconnect(t *testing.T) {
+	q, _ := newTestOfflineQueue(t, 10)
+	hub := newHub()
+	hub.offline = q
+	go hub.run()
+
+	// Sent while alice is offline
+	for _, text := range []string{"first", "second", "third"} {
+		if err := hub.SendToUser("alice", Message{Type: "notification", Data: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn := dialHubQuery(t, hub, "alice", "last_seq=1")
+	for _, want := range []struct {
+		seq  int64
+		data string
+	}{{2, "second"}, {3, "third"}} {
+		msg := conn.next()
+		if msg.Seq != want.seq || msg.Data != want.data {
+			t.Errorf("Expected seq %d %q, got %+v", want.seq, want.data, msg)
+		}
+	}
+
+	// Live messages carry the next sequence number
+	hub.SendToUser("alice", Message{Type: "notification", Data: "live"})
+	if msg := conn.next(); msg.Seq != 4 {
+		t.Errorf("Expected live message with seq 4, got %+v", msg)
+	}
+}
+
+func TestNoReplayWithoutLastSeq(t *testing.T) {
+	q, _ := newTestOfflineQueue(t, 10)
+	hub := newHub()
+	hub.offline = q
+	go hub.run()
+
+	hub.SendToUser("alice", Message{Type: "notification", Data: "missed"})
+
+	conn := dialHub(t, hub, "alice")
+	conn.expectNone()
+}
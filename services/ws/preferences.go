@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"selin/internal/clients"
+	"selin/internal/preferences"
+)
+
+// preferencesTimeout bounds loading or saving one user's preferences.
+const preferencesTimeout = 3 * time.Second
+
+// PreferenceStore keeps users' preferences in each workspace beyond their
+// connections.
+type PreferenceStore interface {
+	Load(ctx context.Context, workspace, userID string) (Preferences, error)
+	// Update merges update into the stored settings and returns them.
+	Update(ctx context.Context, workspace, userID string, update Preferences) (Preferences, error)
+}
+
+// mcpPreferences keeps preferences with the MCP server's /preferences API,
+// vouching for the user and workspace with the MCP server token.
+type mcpPreferences struct {
+	base   string
+	client *http.Client
+}
+
+func newMCPPreferences(base string) *mcpPreferences {
+	return &mcpPreferences{base: base, client: clients.NewHTTPClient(preferencesTimeout)}
+}
+
+func (m *mcpPreferences) Load(ctx context.Context, workspace, userID string) (Preferences, error) {
+	return m.do(ctx, http.MethodGet, workspace, userID, nil)
+}
+
+func (m *mcpPreferences) Update(ctx context.Context, workspace, userID string, update Preferences) (Preferences, error) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return Preferences{}, err
+	}
+	return m.do(ctx, http.MethodPut, workspace, userID, body)
+}
+
+func (m *mcpPreferences) do(ctx context.Context, method, workspace, userID string, body []byte) (Preferences, error) {
+	req, err := http.NewRequestWithContext(ctx, method, m.base+"/preferences", bytes.NewReader(body))
+	if err != nil {
+		return Preferences{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(clients.WorkspaceHeader, workspace)
+	req.Header.Set(clients.UserHeader, userID)
+	clients.Vouch(req.Header)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return Preferences{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Preferences{}, fmt.Errorf("preferences request failed: %s", resp.Status)
+	}
+	var p Preferences
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return Preferences{}, err
+	}
+	return p, nil
+}
+
+// storedPreferences returns a connecting user's saved preferences in the
+// workspace, or the defaults for anonymous users, without a store or when
+// they cannot be loaded.
+func storedPreferences(hub *Hub, workspace, userID string) Preferences {
+	if hub.prefs == nil || userID == anonymousUser {
+		return preferences.Default()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preferencesTimeout)
+	defer cancel()
+	p, err := hub.prefs.Load(ctx, workspace, userID)
+	if err != nil {
+		slog.Warn("failed to load preferences, using defaults", "user_id", userID, "error", err)
+		return preferences.Default()
+	}
+	return p
+}
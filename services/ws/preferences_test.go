@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"selin/internal/preferences"
+)
+
+// memoryPreferences is an in-memory PreferenceStore for tests.
+type memoryPreferences struct {
+	mu    sync.Mutex
+	saved map[string]Preferences
+	err   error
+}
+
+func (m *memoryPreferences) Load(ctx context.Context, workspace, userID string) (Preferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.saved[userID]; ok {
+		return p, m.err
+	}
+	return preferences.Default(), m.err
+}
+
+func (m *memoryPreferences) Update(ctx context.Context, workspace, userID string, update Preferences) (Preferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return Preferences{}, m.err
+	}
+	p := m.saved[userID].Merge(update)
+	m.saved[userID] = p
+	return p, nil
+}
+
+func TestPreferencesOutliveConnections(t *testing.T) {
+	t.Setenv("WS_PUBLISH_TOKEN", "internal")
+	store := &memoryPreferences{saved: map[string]Preferences{}}
+	hub := newHub()
+	hub.prefs = store
+	go hub.run()
+
+	first := dialHub(t, hub, "alice")
+	first.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"set_preferences","data":{"subscribed_tags":["Golang"]}}`))
+	if msg := first.next(); msg.Type != "preferences_updated" {
+		t.Fatalf("Expected preferences_updated, got %+v", msg)
+	}
+	if tags := store.saved["alice"].SubscribedTags; len(tags) != 1 || tags[0] != "golang" {
+		t.Fatalf("Expected alice's tags saved, got %v", tags)
+	}
+
+	// A later connection starts with the saved tag filter
+	second := dialHub(t, hub, "alice")
+	second.send(Message{Type: "subscribe", Topic: "content.new"})
+	second.next()
+	if rr := postPublish(hub, "internal", `{"topic":"content.new","tags":["kubernetes"],"payload":{}}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", rr.Code)
+	}
+	second.expectNone()
+}
+
+func TestPreferencesReportSaveFailures(t *testing.T) {
+	hub := newHub()
+	hub.prefs = &memoryPreferences{saved: map[string]Preferences{}, err: errors.New("mcp-server down")}
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"set_preferences","id":"p","data":{"digest_schedule":"off"}}`))
+	msg := conn.next()
+	if perr, _ := msg.Data.(map[string]interface{}); msg.Type != "error" || perr["code"] != ErrCodeUnavailable {
+		t.Errorf("Expected an unavailable error, got %+v", msg)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// Clients subscribed to this topic receive a "presence" message whenever a
+// named user's first connection to a replica opens or their last one closes.
+const presenceTopic = "presence"
+
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
+
+type PresenceEvent struct {
+	Event  string `json:"event"`
+	UserID string `json:"user_id"`
+}
+
+// ConnectionInfo describes one open connection on this replica.
+type ConnectionInfo struct {
+	ClientID         string    `json:"client_id"`
+	UserID           string    `json:"user_id"`
+	Transport        string    `json:"transport"`
+	ConnectedAt      time.Time `json:"connected_at"`
+	Topics           []string  `json:"topics"`
+	MessagesSent     int64     `json:"messages_sent"`
+	MessagesReceived int64     `json:"messages_received"`
+	MessagesDropped  int64     `json:"messages_dropped"`
+	Queued           int       `json:"queued"`
+}
+
+// announcePresence publishes a join or leave event. It is called from the
+// hub goroutine, which also receives publications, so the publish has to run
+// on its own goroutine.
+func (h *Hub) announcePresence(userID, event string) {
+	if userID == anonymousUser {
+		return
+	}
+	go func() {
+		if err := h.Publish(presenceTopic, PresenceEvent{Event: event, UserID: userID}); err != nil {
+			slog.Error("failed to publish presence", "user_id", userID, "error", err)
+		}
+	}()
+}
+
+// connections snapshots every client. Must only be called from the hub
+// goroutine.
+func (h *Hub) connections() []ConnectionInfo {
+	infos := make([]ConnectionInfo, 0, len(h.clients))
+	for client := range h.clients {
+		topics := make([]string, 0, len(client.topics))
+		for topic := range client.topics {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+
+		infos = append(infos, ConnectionInfo{
+			ClientID:         client.clientID,
+			UserID:           client.userID,
+			Transport:        client.transport,
+			ConnectedAt:      client.connectedAt,
+			Topics:           topics,
+			MessagesSent:     client.sentCount,
+			MessagesReceived: client.received.Load(),
+			MessagesDropped:  client.dropCount,
+			Queued:           len(client.send),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ConnectedAt.Before(infos[j].ConnectedAt) })
+	return infos
+}
+
+// Connections returns a snapshot of this replica's open connections.
+func (h *Hub) Connections() []ConnectionInfo {
+	reply := make(chan []ConnectionInfo, 1)
+	h.inspect <- reply
+	return <-reply
+}
+
+// Connections endpoint: lists this replica's clients for debugging and, with
+// a backplane, how many connections each user has across all replicas.
+// Requires the ADMIN_API_KEY bearer token.
+func connectionsHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if ok, status := bearerAuthorized(r, "ADMIN_API_KEY"); !ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	connections := hub.Connections()
+	hostname, _ := os.Hostname()
+	response := map[string]interface{}{
+		"instance":    hostname,
+		"count":       len(connections),
+		"connections": connections,
+	}
+
+	if hub.backplane != nil {
+		response["instance"] = hub.backplane.instanceID
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		online, err := hub.backplane.OnlineUsers(ctx)
+		if err != nil {
+			slog.Error("failed to load presence", "error", err)
+		} else {
+			response["online_users"] = online
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
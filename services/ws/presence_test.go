@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getConnections(hub *Hub, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/connections", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	connectionsHandler(hub, rr, req)
+	return rr
+}
+
+func TestConnectionsHandlerAuth(t *testing.T) {
+	hub := newHub()
+	if rr := getConnections(hub, "anything"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without ADMIN_API_KEY, got %d", rr.Code)
+	}
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	if rr := getConnections(hub, "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong key, got %d", rr.Code)
+	}
+}
+
+func TestConnectionsHandlerListsClients(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "secret")
+	hub := newHub()
+	go hub.run()
+
+	conn := dialHub(t, hub, "alice")
+	conn.send(Message{Type: "subscribe", Topic: "content.new"})
+	conn.next()
+
+	rr := getConnections(hub, "secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+
+	var response struct {
+		Count       int              `json:"count"`
+		Connections []ConnectionInfo `json:"connections"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Count != 1 || len(response.Connections) != 1 {
+		t.Fatalf("Expected one connection, got %+v", response)
+	}
+
+	info := response.Connections[0]
+	if info.UserID != "alice" || info.Transport != "websocket" || info.ConnectedAt.IsZero() {
+		t.Errorf("Unexpected connection info %+v", info)
+	}
+	if len(info.Topics) != 1 || info.Topics[0] != "content.new" {
+		t.Errorf("Expected subscription to content.new, got %v", info.Topics)
+	}
+	if info.MessagesReceived != 1 || info.MessagesSent != 2 {
+		t.Errorf("Expected 1 received and 2 sent (welcome, subscribed), got %d and %d", info.MessagesReceived, info.MessagesSent)
+	}
+}
+
+func TestPresenceTopicAnnouncesJoinAndLeave(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+
+	watcher := dialHub(t, hub, "ops")
+	watcher.send(Message{Type: "subscribe", Topic: presenceTopic})
+	watcher.next()
+
+	alice := dialHub(t, hub, "alice")
+	if msg := watcher.next(); msg.Topic != presenceTopic || presenceOf(msg) != (PresenceEvent{Event: PresenceJoin, UserID: "alice"}) {
+		t.Fatalf("Expected alice to join, got %+v", msg)
+	}
+
+	alice.ws.Close()
+	if msg := watcher.next(); presenceOf(msg) != (PresenceEvent{Event: PresenceLeave, UserID: "alice"}) {
+		t.Fatalf("Expected alice to leave, got %+v", msg)
+	}
+
+	// Anonymous connections are not announced
+	dialHub(t, hub, "")
+	watcher.expectNone()
+}
+
+func presenceOf(msg Message) PresenceEvent {
+	data, _ := json.Marshal(msg.Data)
+	var event PresenceEvent
+	json.Unmarshal(data, &event)
+	return event
+}
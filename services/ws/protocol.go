@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"selin/internal/preferences"
+)
+
+// Inbound message types a client may send. Every message is a JSON object
+// with a "type", an optional "id" echoed back in the reply, and a
+// type-specific "topic" or "data" field:
+//
+//	{"type": "subscribe", "id": "1", "topic": "content.new"}
+//	{"type": "unsubscribe", "topic": "content.new"}
+//	{"type": "query", "id": "2", "data": {"prompt": "golang generics", "request_id": "req_1"}}
+//
+// A query streams to a topic the server makes up for it, given in the
+// query_accepted reply; only the connection that ran it may subscribe.
+//
+//	{"type": "ack", "data": {"seq": 42}}
+//	{"type": "set_preferences", "data": {"subscribed_tags": ["golang"], "digest_schedule": "daily"}}
+//
+// Replies are "subscribed", "unsubscribed", "query_accepted", "acked" and
+// "preferences_updated"; failures are answered with an "error" message whose
+// data is a ProtocolError.
+const (
+	MsgSubscribe      = "subscribe"
+	MsgUnsubscribe    = "unsubscribe"
+	MsgQuery          = "query"
+	MsgAck            = "ack"
+	MsgSetPreferences = "set_preferences"
+)
+
+// Error codes carried in ProtocolError.Code.
+const (
+	ErrCodeInvalidJSON    = "invalid_json"
+	ErrCodeUnknownType    = "unknown_type"
+	ErrCodeInvalidTopic   = "invalid_topic"
+	ErrCodeInvalidPayload = "invalid_payload"
+	ErrCodeUnavailable    = "unavailable"
+	ErrCodeForbidden      = "forbidden"
+)
+
+const maxPromptLength = 4000
+
+type ProtocolError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"` // inbound type that caused the error
+}
+
+// InboundMessage is the wire shape of client messages; Data stays raw until
+// the handler for Type decodes it into its own payload type.
+type InboundMessage struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Topic string          `json:"topic,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+type QueryPayload struct {
+	Prompt    string `json:"prompt"`
+	RequestID string `json:"request_id,omitempty"`
+	// MaxTokens caps the length of the assembled context, 0 for no limit
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// ContextOnly skips the LLM's answer even when one is configured
+	ContextOnly bool `json:"context_only,omitempty"`
+}
+
+// AckPayload confirms every message up to Seq arrived; they are dropped
+// from the user's offline queue.
+type AckPayload struct {
+	Seq int64 `json:"seq"`
+}
+
+// Preferences are the settings a set_preferences message changes; fields it
+// leaves out keep their value. They are kept with the MCP server, so they
+// apply to notifications and searches too and outlive the connection.
+type Preferences = preferences.Preferences
+
+// tagFilter hands a client's subscribed_tags to the hub, which applies them
+// to tagged publications.
+type tagFilter struct {
+	client *Client
+	tags   map[string]bool
+}
+
+// wantsTags reports whether a publication with the given tags should reach
+// the client. Untagged publications, and clients that have not set
+// subscribed_tags, always match. Must only be called from the hub goroutine.
+func (c *Client) wantsTags(tags []string) bool {
+	if len(tags) == 0 || len(c.tagFilter) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if c.tagFilter[strings.ToLower(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryRunner executes a query for a client in its workspace. Progress is
+// published as StreamUpdate events on topic.
+type QueryRunner func(userID, workspace, topic string, q QueryPayload)
+
+type inboundHandler func(c *Client, msg InboundMessage) *ProtocolError
+
+var inboundHandlers map[string]inboundHandler
+
+func init() {
+	inboundHandlers = map[string]inboundHandler{
+		MsgSubscribe:      handleSubscribe,
+		MsgUnsubscribe:    handleSubscribe,
+		MsgQuery:          handleQuery,
+		MsgAck:            handleAck,
+		MsgSetPreferences: handleSetPreferences,
+	}
+}
+
+// handleInbound decodes and dispatches one client message, replying with a
+// typed error when it cannot be handled.
+func (c *Client) handleInbound(raw []byte) {
+	var msg InboundMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		c.replyError("", &ProtocolError{Code: ErrCodeInvalidJSON, Message: "Message is not valid JSON"})
+		return
+	}
+
+	slog.Debug("received client message", "client_id", c.clientID, "type", msg.Type)
+
+	handler, ok := inboundHandlers[msg.Type]
+	if !ok {
+		c.replyError(msg.ID, &ProtocolError{
+			Code:    ErrCodeUnknownType,
+			Message: fmt.Sprintf("Unknown message type %q", msg.Type),
+			Type:    msg.Type,
+		})
+		return
+	}
+
+	if perr := handler(c, msg); perr != nil {
+		perr.Type = msg.Type
+		c.replyError(msg.ID, perr)
+	}
+}
+
+// reply sends a message to this connection through the hub, which owns the
+// send channel.
+func (c *Client) reply(msg Message) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.hub.direct <- direct{client: c, messages: [][]byte{data}}
+}
+
+func (c *Client) replyError(id string, perr *ProtocolError) {
+	messagesTotal.WithLabelValues("error", "outbound").Inc()
+	c.reply(Message{Type: "error", ID: id, Data: perr})
+}
+
+// decodePayload strictly decodes msg.Data into v, rejecting unknown fields.
+func decodePayload(msg InboundMessage, v interface{}) *ProtocolError {
+	if len(msg.Data) == 0 {
+		return &ProtocolError{Code: ErrCodeInvalidPayload, Message: "Missing data"}
+	}
+	dec := json.NewDecoder(bytes.NewReader(msg.Data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &ProtocolError{Code: ErrCodeInvalidPayload, Message: err.Error()}
+	}
+	return nil
+}
+
+func handleSubscribe(c *Client, msg InboundMessage) *ProtocolError {
+	if !validTopic(msg.Topic) {
+		return &ProtocolError{Code: ErrCodeInvalidTopic, Message: fmt.Sprintf("Invalid topic %q", msg.Topic)}
+	}
+	if msg.Type == MsgSubscribe && isQueryTopic(msg.Topic) && !c.queryTopics[msg.Topic] {
+		return &ProtocolError{Code: ErrCodeForbidden, Message: "Only the connection that ran a query can follow it"}
+	}
+	sub := subscription{client: c, topic: msg.Topic, id: msg.ID}
+	if msg.Type == MsgSubscribe {
+		c.hub.subscribe <- sub
+	} else {
+		c.hub.unsubscribe <- sub
+	}
+	return nil
+}
+
+func handleQuery(c *Client, msg InboundMessage) *ProtocolError {
+	var q QueryPayload
+	if perr := decodePayload(msg, &q); perr != nil {
+		return perr
+	}
+	if q.Prompt == "" {
+		return &ProtocolError{Code: ErrCodeInvalidPayload, Message: "Prompt is required"}
+	}
+	if len(q.Prompt) > maxPromptLength {
+		return &ProtocolError{Code: ErrCodeInvalidPayload, Message: fmt.Sprintf("Prompt exceeds %d characters", maxPromptLength)}
+	}
+	if q.RequestID == "" {
+		q.RequestID = fmt.Sprintf("req_%d", time.Now().UnixNano())
+	}
+	if !validTopic(q.RequestID) {
+		return &ProtocolError{Code: ErrCodeInvalidPayload, Message: "Invalid request_id"}
+	}
+	if c.hub.queries == nil {
+		return &ProtocolError{Code: ErrCodeUnavailable, Message: "Queries are not available on this server"}
+	}
+
+	// The request_id is the client's to pick, so it only labels the updates;
+	// they go to a topic of this connection's own
+	topic := newQueryTopic()
+	if c.queryTopics == nil {
+		c.queryTopics = make(map[string]bool)
+	}
+	c.queryTopics[topic] = true
+	// Subscribe before running so no stream update can be missed
+	c.hub.subscribe <- subscription{client: c, topic: topic, id: msg.ID}
+	c.reply(Message{Type: "query_accepted", ID: msg.ID, Topic: topic, Data: map[string]string{"request_id": q.RequestID}})
+	go c.hub.queries(c.userID, c.workspace, topic, q)
+	return nil
+}
+
+func handleAck(c *Client, msg InboundMessage) *ProtocolError {
+	var ack AckPayload
+	if perr := decodePayload(msg, &ack); perr != nil {
+		return perr
+	}
+	if ack.Seq <= 0 {
+		return &ProtocolError{Code: ErrCodeInvalidPayload, Message: "seq must be positive"}
+	}
+	if ack.Seq > c.lastAck {
+		c.lastAck = ack.Seq
+		if c.hub.offline != nil && c.userID != anonymousUser {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := c.hub.offline.Ack(ctx, c.userID, ack.Seq)
+			cancel()
+			if err != nil {
+				slog.Error("failed to trim queued messages", "user_id", c.userID, "seq", ack.Seq, "error", err)
+			}
+		}
+	}
+	c.reply(Message{Type: "acked", ID: msg.ID, Seq: c.lastAck})
+	return nil
+}
+
+// handleSetPreferences saves the changed settings for a named user, or only
+// for this connection when it is anonymous or preferences are not kept.
+func handleSetPreferences(c *Client, msg InboundMessage) *ProtocolError {
+	var update Preferences
+	if perr := decodePayload(msg, &update); perr != nil {
+		return perr
+	}
+	if err := update.Validate(); err != nil {
+		return &ProtocolError{Code: ErrCodeInvalidPayload, Message: err.Error()}
+	}
+
+	prefs := c.preferences.Merge(update)
+	if c.hub.prefs != nil && c.userID != anonymousUser {
+		ctx, cancel := context.WithTimeout(context.Background(), preferencesTimeout)
+		defer cancel()
+		saved, err := c.hub.prefs.Update(ctx, c.workspace, c.userID, update)
+		if err != nil {
+			slog.Error("failed to save preferences", "user_id", c.userID, "error", err)
+			return &ProtocolError{Code: ErrCodeUnavailable, Message: "Preferences could not be saved"}
+		}
+		prefs = saved
+	}
+
+	c.preferences = prefs
+	c.hub.filters <- tagFilter{client: c, tags: tagSet(prefs.SubscribedTags)}
+	c.reply(Message{Type: "preferences_updated", ID: msg.ID, Data: prefs})
+	return nil
+}
+
+// tagSet is the hub's form of subscribed_tags.
+func tagSet(tags []string) map[string]bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[strings.ToLower(tag)] = true
+	}
+	return set
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// errorData extracts the ProtocolError carried by an error reply.
+func errorData(t *testing.T, msg Message) ProtocolError {
+	t.Helper()
+	if msg.Type != "error" {
+		t.Fatalf("Expected error reply, got %+v", msg)
+	}
+	raw, _ := json.Marshal(msg.Data)
+	var perr ProtocolError
+	if err := json.Unmarshal(raw, &perr); err != nil {
+		t.Fatalf("Could not decode error payload: %v", err)
+	}
+	return perr
+}
+
+func TestProtocolErrors(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	tests := []struct {
+		name     string
+		raw      string
+		wantCode string
+		wantID   string
+	}{
+		{"invalid json", `{"type":`, ErrCodeInvalidJSON, ""},
+		{"unknown type", `{"type":"dance","id":"1"}`, ErrCodeUnknownType, "1"},
+		{"invalid topic", `{"type":"subscribe","id":"2","topic":"no spaces"}`, ErrCodeInvalidTopic, "2"},
+		{"query without data", `{"type":"query","id":"3"}`, ErrCodeInvalidPayload, "3"},
+		{"query without prompt", `{"type":"query","data":{"prompt":""}}`, ErrCodeInvalidPayload, ""},
+		{"query unknown field", `{"type":"query","data":{"prompt":"x","bogus":1}}`, ErrCodeInvalidPayload, ""},
+		{"query with no runner", `{"type":"query","data":{"prompt":"golang"}}`, ErrCodeUnavailable, ""},
+		{"ack without seq", `{"type":"ack","data":{}}`, ErrCodeInvalidPayload, ""},
+		{"bad digest schedule", `{"type":"set_preferences","data":{"digest_schedule":"hourly"}}`, ErrCodeInvalidPayload, ""},
+		{"bad platform", `{"type":"set_preferences","data":{"default_platform":"myspace"}}`, ErrCodeInvalidPayload, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := conn.ws.WriteMessage(websocket.TextMessage, []byte(tt.raw)); err != nil {
+				t.Fatal(err)
+			}
+			msg := conn.next()
+			perr := errorData(t, msg)
+			if perr.Code != tt.wantCode {
+				t.Errorf("Expected code %s, got %s (%s)", tt.wantCode, perr.Code, perr.Message)
+			}
+			if msg.ID != tt.wantID {
+				t.Errorf("Expected id %q echoed, got %q", tt.wantID, msg.ID)
+			}
+		})
+	}
+}
+
+func TestProtocolSubscribeEchoesID(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribe","id":"sub-1","topic":"content.new"}`))
+	if msg := conn.next(); msg.Type != "subscribed" || msg.ID != "sub-1" || msg.Topic != "content.new" {
+		t.Errorf("Expected subscribed reply with id, got %+v", msg)
+	}
+}
+
+func TestProtocolAck(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"ack","data":{"seq":7}}`))
+	if msg := conn.next(); msg.Type != "acked" || msg.Seq != 7 {
+		t.Errorf("Expected acked 7, got %+v", msg)
+	}
+
+	// Acks never move backwards
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"ack","data":{"seq":3}}`))
+	if msg := conn.next(); msg.Seq != 7 {
+		t.Errorf("Expected acked to stay at 7, got %+v", msg)
+	}
+}
+
+func TestProtocolSetPreferences(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"set_preferences","id":"p","data":{"subscribed_tags":["golang"],"digest_schedule":"weekly"}}`))
+	msg := conn.next()
+	if msg.Type != "preferences_updated" || msg.ID != "p" {
+		t.Fatalf("Expected preferences_updated, got %+v", msg)
+	}
+	data := msg.Data.(map[string]interface{})
+	if data["digest_schedule"] != "weekly" {
+		t.Errorf("Expected preferences echoed back, got %v", data)
+	}
+}
+
+func TestProtocolQueryAccepted(t *testing.T) {
+	hub := newHub()
+	ran := make(chan QueryPayload, 1)
+	topics := make(chan string, 1)
+	hub.queries = func(userID, workspace, topic string, q QueryPayload) { ran <- q; topics <- topic }
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"query","id":"q1","data":{"prompt":"golang generics","request_id":"req_42"}}`))
+
+	subscribed := conn.next()
+	if subscribed.Type != "subscribed" || !isQueryTopic(subscribed.Topic) || subscribed.Topic == "query.req_42" {
+		t.Errorf("Expected subscription to a query topic made up by the server, got %+v", subscribed)
+	}
+	if msg := conn.next(); msg.Type != "query_accepted" || msg.ID != "q1" || msg.Topic != subscribed.Topic {
+		t.Errorf("Expected query_accepted with the topic, got %+v", msg)
+	}
+	if q := <-ran; q.Prompt != "golang generics" || q.RequestID != "req_42" {
+		t.Errorf("Expected the runner to receive the query, got %+v", q)
+	}
+	if topic := <-topics; topic != subscribed.Topic {
+		t.Errorf("Expected the runner to stream to %s, got %s", subscribed.Topic, topic)
+	}
+
+	// Another connection can neither follow the query nor share its topic
+	// by picking the same request_id
+	other := dialHub(t, hub, "mallory")
+	other.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribe","id":"s","topic":"`+subscribed.Topic+`"}`))
+	if perr := errorData(t, other.next()); perr.Code != ErrCodeForbidden {
+		t.Errorf("Expected subscribing to another's query to be forbidden, got %+v", perr)
+	}
+	other.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"query","id":"q2","data":{"prompt":"x","request_id":"req_42"}}`))
+	if msg := other.next(); msg.Topic == subscribed.Topic {
+		t.Errorf("Expected a topic of its own for the same request_id, got %+v", msg)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Largest payload accepted on /publish.
+const maxPublishBytes = 1 << 20
+
+type PublishRequest struct {
+	Topic     string          `json:"topic"`
+	Workspace string          `json:"workspace_id,omitempty"` // every workspace when empty
+	UserID    string          `json:"user_id,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// bearerAuthorized checks the request's bearer token against the one in the
+// tokenEnv environment variable. The endpoint is disabled when it is unset.
+func bearerAuthorized(r *http.Request, tokenEnv string) (bool, int) {
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		return false, http.StatusForbidden
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return false, http.StatusUnauthorized
+	}
+	return true, http.StatusOK
+}
+
+// Publish endpoint: lets collectors and other internal services push events
+// to connected clients, e.g. {"topic": "content.new", "payload": {...}}.
+// With only user_id set the payload is sent directly to that user.
+func publishHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if ok, status := bearerAuthorized(r, "WS_PUBLISH_TOKEN"); !ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var req PublishRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPublishBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Topic == "" && (req.UserID == "" || req.UserID == anonymousUser) {
+		http.Error(w, "A topic or user_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.Topic != "" && !validTopic(req.Topic) {
+		http.Error(w, "Invalid topic", http.StatusBadRequest)
+		return
+	}
+	if len(req.Payload) == 0 {
+		req.Payload = json.RawMessage("null")
+	}
+
+	messagesTotal.WithLabelValues("publish", "inbound").Inc()
+	hub.publishEnvelope(Envelope{
+		Topic:     req.Topic,
+		Workspace: req.Workspace,
+		UserID:    req.UserID,
+		Tags:      req.Tags,
+		Data:      req.Payload,
+		Timestamp: time.Now(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "published",
+		"topic":   req.Topic,
+		"user_id": req.UserID,
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postPublish(hub *Hub, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/publish", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	publishHandler(hub, rr, req)
+	return rr
+}
+
+func TestPublishHandlerAuth(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+
+	t.Setenv("WS_PUBLISH_TOKEN", "")
+	if rr := postPublish(hub, "anything", `{"topic":"content.new"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 when publishing is disabled, got %d", rr.Code)
+	}
+
+	t.Setenv("WS_PUBLISH_TOKEN", "internal")
+	if rr := postPublish(hub, "wrong", `{"topic":"content.new"}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong token, got %d", rr.Code)
+	}
+	if rr := postPublish(hub, "internal", `{"topic":"bad topic"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid topic, got %d", rr.Code)
+	}
+	if rr := postPublish(hub, "internal", `{"topic":`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid JSON, got %d", rr.Code)
+	}
+}
+
+func TestPublishHandlerDeliversToSubscribers(t *testing.T) {
+	t.Setenv("WS_PUBLISH_TOKEN", "internal")
+	hub := newHub()
+	go hub.run()
+
+	alice := dialHub(t, hub, "alice")
+	bob := dialHub(t, hub, "bob")
+	for _, conn := range []*testConn{alice, bob} {
+		conn.send(Message{Type: "subscribe", Topic: "content.new"})
+		conn.next()
+	}
+
+	rr := postPublish(hub, "internal", `{"topic":"content.new","payload":{"message":"12 new golang items stored"}}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, conn := range []*testConn{alice, bob} {
+		if msg := conn.next(); msg.Topic != "content.new" {
+			t.Errorf("Expected content.new event, got %+v", msg)
+		}
+	}
+
+	postPublish(hub, "internal", `{"topic":"content.new","user_id":"bob","payload":"just for bob"}`)
+	if msg := bob.next(); msg.Data != "just for bob" {
+		t.Errorf("Expected targeted event for bob, got %+v", msg)
+	}
+	alice.expectNone()
+}
+
+func TestPublishHandlerScopesToWorkspace(t *testing.T) {
+	t.Setenv("WS_PUBLISH_TOKEN", "internal")
+	hub := newHub()
+	go hub.run()
+
+	alice := dialHub(t, hub, "alice")
+	bob := dialHubKey(t, hub, workspaceKey(t, hub, "team-a", "bob"), "")
+	for _, conn := range []*testConn{alice, bob} {
+		conn.send(Message{Type: "subscribe", Topic: "content.new"})
+		conn.next()
+	}
+
+	postPublish(hub, "internal", `{"topic":"content.new","workspace_id":"team-a","payload":"for team-a"}`)
+	if msg := bob.next(); msg.Data != "for team-a" {
+		t.Errorf("Expected team-a's event for bob, got %+v", msg)
+	}
+	alice.expectNone()
+}
+
+func TestPublishHandlerDirectMessage(t *testing.T) {
+	t.Setenv("WS_PUBLISH_TOKEN", "internal")
+	hub := newHub()
+	go hub.run()
+
+	alice := dialHub(t, hub, "alice")
+	bob := dialHub(t, hub, "bob")
+
+	rr := postPublish(hub, "internal", `{"user_id":"alice","payload":"no subscription needed"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if msg := alice.next(); msg.Data != "no subscription needed" {
+		t.Errorf("Expected direct message, got %+v", msg)
+	}
+	bob.expectNone()
+
+	if rr := postPublish(hub, "internal", `{"user_id":"anonymous","payload":"x"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when targeting anonymous, got %d", rr.Code)
+	}
+}
+
+func TestPublishHandlerFiltersBySubscribedTags(t *testing.T) {
+	t.Setenv("WS_PUBLISH_TOKEN", "internal")
+	hub := newHub()
+	go hub.run()
+
+	gopher := dialHub(t, hub, "alice")
+	sre := dialHub(t, hub, "bob")
+	everything := dialHub(t, hub, "carol")
+	for _, conn := range []*testConn{gopher, sre, everything} {
+		conn.send(Message{Type: "subscribe", Topic: "content.new"})
+		conn.next()
+	}
+	gopher.send(Message{Type: "set_preferences", Data: Preferences{SubscribedTags: []string{"Golang"}}})
+	gopher.next()
+	sre.send(Message{Type: "set_preferences", Data: Preferences{SubscribedTags: []string{"kubernetes"}}})
+	sre.next()
+
+	body := `{"topic":"content.new","tags":["golang","concurrency"],"payload":{"id":"c1","platform":"reddit"}}`
+	if rr := postPublish(hub, "internal", body); rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", rr.Code)
+	}
+	for _, conn := range []*testConn{gopher, everything} {
+		if msg := conn.next(); msg.Topic != "content.new" {
+			t.Errorf("Expected content.new event, got %+v", msg)
+		}
+	}
+	sre.expectNone()
+}
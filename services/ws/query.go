@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"selin/internal/query"
+	"selin/internal/tokenizer"
+)
+
+// queryTimeout bounds one query, all of its tool calls included.
+const queryTimeout = 60 * time.Second
+
+// MsgStreamUpdate is the type of the frames a query streams back.
+const MsgStreamUpdate = "stream_update"
+
+// answerTool is the Tool of the updates streaming the LLM's answer.
+const answerTool = "answer"
+
+// mcpQueryRunner answers queries with the pipeline behind the gateway's
+// /api/v1/query. Each tool's output is published to the query's topic as a
+// "streaming" StreamUpdate as soon as it arrives. With an LLM configured,
+// its answer follows as "streaming" updates of the "answer" tool, a piece
+// at a time. The assembled context, with the whole answer, is the
+// "complete" update, or an "error" one when there is no context.
+func mcpQueryRunner(hub *Hub, pipeline *query.Pipeline) QueryRunner {
+	return func(userID, workspace, topic string, q QueryPayload) {
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		defer cancel()
+
+		publish := func(update StreamUpdate) {
+			update.RequestID = q.RequestID
+			raw, err := json.Marshal(update)
+			if err != nil {
+				return
+			}
+			messagesTotal.WithLabelValues(MsgStreamUpdate, "outbound").Inc()
+			hub.publishEnvelope(Envelope{Type: MsgStreamUpdate, Topic: topic, Data: raw, Timestamp: time.Now()})
+		}
+
+		caller := query.Caller{Workspace: workspace, RequestID: q.RequestID}
+		if userID != anonymousUser {
+			caller.UserID = userID
+		}
+		assembled, err := pipeline.RunWithin(ctx, caller, q.Prompt, max(q.MaxTokens, 0), func(res query.Result) {
+			publish(StreamUpdate{Tool: res.Tool, Content: res.Text, Status: "streaming", IsError: res.IsError})
+		})
+		if err != nil {
+			slog.Warn("query failed", "request_id", q.RequestID, "error", err)
+			publish(StreamUpdate{Content: err.Error(), Status: "error"})
+			return
+		}
+
+		var answer, answerError string
+		if pipeline.LLM != nil && !q.ContextOnly {
+			answer, err = pipeline.Reply(ctx, caller, q.Prompt, assembled, func(delta string) {
+				publish(StreamUpdate{Tool: answerTool, Content: delta, Status: "streaming"})
+			})
+			if err != nil {
+				// The context still answers the question without the LLM
+				slog.Warn("llm answer failed", "request_id", q.RequestID, "error", err)
+				answerError = query.AnswerError(err)
+			}
+		}
+		publish(StreamUpdate{
+			Content:     assembled,
+			Status:      "complete",
+			TokenCount:  tokenizer.Default().Count(assembled),
+			Answer:      answer,
+			AnswerError: answerError,
+		})
+	}
+}
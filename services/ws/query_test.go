@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"selin/internal/llm"
+	"selin/internal/query"
+)
+
+func TestQueryStreamsToolOutput(t *testing.T) {
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get("X-User-ID") != "alice" {
+			t.Errorf("Expected the query run for alice, got %q", r.Header.Get("X-User-ID"))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": req.Name + " output"}},
+			"isError": req.Name == "get_related_concepts",
+		})
+	}))
+	defer mcp.Close()
+
+	hub := newHub()
+	hub.queries = mcpQueryRunner(hub, query.New(mcp.URL))
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"query","id":"q1","data":{"prompt":"tendermint","request_id":"req_7"}}`))
+	conn.next() // subscribed
+	accepted := conn.next()
+	if accepted.Type != "query_accepted" {
+		t.Fatalf("Expected query_accepted, got %+v", accepted)
+	}
+
+	var updates []StreamUpdate
+	for len(updates) == 0 || updates[len(updates)-1].Status == "streaming" {
+		msg := conn.next()
+		if msg.Type != MsgStreamUpdate || msg.Topic != accepted.Topic {
+			t.Fatalf("Expected a stream update on the query topic, got %+v", msg)
+		}
+		raw, _ := json.Marshal(msg.Data)
+		var update StreamUpdate
+		json.Unmarshal(raw, &update)
+		updates = append(updates, update)
+	}
+
+	if len(updates) != 3 {
+		t.Fatalf("Expected one update per tool and a final one, got %+v", updates)
+	}
+	if updates[0].Tool != "search_content" || updates[0].Content != "search_content output" || updates[0].RequestID != "req_7" {
+		t.Errorf("Expected the search output first, got %+v", updates[0])
+	}
+	if !updates[1].IsError {
+		t.Errorf("Expected the failed tool marked as an error, got %+v", updates[1])
+	}
+	if last := updates[2]; last.Status != "complete" || last.Content != "## search_content\n\nsearch_content output" {
+		t.Errorf("Expected the assembled context to complete the query, got %+v", last)
+	}
+}
+
+func TestQueryStreamsTheAnswer(t *testing.T) {
+	mcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "output"}},
+		})
+	}))
+	defer mcp.Close()
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"IBC \"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"connects chains\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer model.Close()
+
+	pipeline := query.New(mcp.URL)
+	pipeline.LLM = llm.New(&llm.OpenAI{URL: model.URL, HTTP: http.DefaultClient})
+	hub := newHub()
+	hub.queries = mcpQueryRunner(hub, pipeline)
+	go hub.run()
+	conn := dialHub(t, hub, "alice")
+
+	conn.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"query","id":"q1","data":{"prompt":"ibc","request_id":"req_8"}}`))
+	conn.next() // subscribed
+	conn.next() // query_accepted
+
+	var deltas []string
+	var last StreamUpdate
+	for last.Status == "" || last.Status == "streaming" {
+		raw, _ := json.Marshal(conn.next().Data)
+		last = StreamUpdate{}
+		json.Unmarshal(raw, &last)
+		if last.Tool == answerTool {
+			deltas = append(deltas, last.Content)
+		}
+	}
+	if len(deltas) != 2 || deltas[0] != "IBC " {
+		t.Errorf("Expected the answer streamed a piece at a time, got %q", deltas)
+	}
+	if last.Status != "complete" || last.Answer != "IBC connects chains" {
+		t.Errorf("Expected the whole answer with the context, got %+v", last)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"selin/internal/logging"
+)
+
+// sseHandler streams hub messages as Server-Sent Events for clients that
+// cannot use WebSockets, such as curl scripts or proxies that strip the
+// upgrade. Topics are chosen up front with ?topic=a&topic=b. User-directed
+// messages carry their sequence number as the event id, so a reconnecting
+// client's Last-Event-ID replays everything queued after it.
+func sseHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	who, ok := requestCaller(hub, w, r)
+	if !ok {
+		return
+	}
+
+	topics := r.URL.Query()["topic"]
+	for _, topic := range topics {
+		if !validTopic(topic) {
+			http.Error(w, fmt.Sprintf("Invalid topic %q", topic), http.StatusBadRequest)
+			return
+		}
+		// Queries only stream to the connection that ran them
+		if isQueryTopic(topic) {
+			http.Error(w, "Query topics cannot be followed over SSE", http.StatusForbidden)
+			return
+		}
+	}
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		logging.FromContext(r.Context()).Warn("could not clear write deadline for event stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client := &Client{
+		send:        make(chan []byte, hub.sendQueueSize),
+		hub:         hub,
+		userID:      who.userID,
+		workspace:   who.workspace,
+		clientID:    generateClientID(),
+		transport:   "sse",
+		connectedAt: time.Now(),
+		topics:      make(map[string]bool),
+	}
+
+	hub.register <- client
+	defer func() { hub.unregister <- client }()
+
+	for _, topic := range topics {
+		hub.subscribe <- subscription{client: client, topic: topic}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastSeq, err := strconv.ParseInt(lastEventID, 10, 64); err == nil {
+		replayMissed(hub, client, lastSeq)
+	}
+
+	ticker := time.NewTicker(hub.pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case msg, ok := <-client.send:
+			if !ok {
+				writeSSEClose(w, client)
+				flusher.Flush()
+				return
+			}
+			if err := writeSSE(w, msg); err != nil {
+				return
+			}
+			for n := len(client.send); n > 0; n-- {
+				next := client.tryNext()
+				if next == nil {
+					break
+				}
+				if err := writeSSE(w, next); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+			messagesTotal.WithLabelValues("server", "outbound").Inc()
+
+		case <-ticker.C:
+			// Comment lines keep proxies from timing out an idle stream
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes one encoded Message as an event named after its type.
+// Encoded messages never contain raw newlines, so a single data line is
+// enough.
+func writeSSE(w io.Writer, msg []byte) error {
+	var header struct {
+		Type string `json:"type"`
+		Seq  int64  `json:"seq"`
+	}
+	json.Unmarshal(msg, &header)
+
+	if header.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", header.Seq); err != nil {
+			return err
+		}
+	}
+	if header.Type != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", header.Type); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", msg)
+	return err
+}
+
+// writeSSEClose tells the client why the hub ended its stream, mirroring the
+// WebSocket close frame.
+func writeSSEClose(w io.Writer, client *Client) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"code":   client.closeCode,
+		"reason": client.closeReason,
+	})
+	fmt.Fprintf(w, "event: close\ndata: %s\n\n", data)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	msg   Message
+}
+
+// eventStream reads events from a GET /events response.
+type eventStream struct {
+	t      *testing.T
+	events chan sseEvent
+}
+
+func openEvents(t *testing.T, hub *Hub, userID, query, lastEventID string) *eventStream {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sseHandler(hub, w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequest("GET", server.URL+"/events?"+query, nil)
+	if userID != "" {
+		req.Header.Set("X-API-Key", userKey(t, hub, userID))
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	stream := &eventStream{t: t, events: make(chan sseEvent, 16)}
+	go func() {
+		defer close(stream.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				stream.events <- ev
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.msg)
+			}
+		}
+	}()
+
+	if ev := stream.next(); ev.event != "welcome" {
+		t.Fatalf("Expected welcome event, got %+v", ev)
+	}
+	return stream
+}
+
+func (s *eventStream) next() sseEvent {
+	s.t.Helper()
+	select {
+	case ev, ok := <-s.events:
+		if !ok {
+			s.t.Fatal("Event stream closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		s.t.Fatal("Timed out waiting for event")
+	}
+	return sseEvent{}
+}
+
+func TestSSEReceivesTopicEvents(t *testing.T) {
+	hub := newHub()
+	go hub.run()
+
+	stream := openEvents(t, hub, "alice", "topic=content.new", "")
+	if ev := stream.next(); ev.event != "subscribed" || ev.msg.Topic != "content.new" {
+		t.Fatalf("Expected subscribed event, got %+v", ev)
+	}
+
+	hub.Publish("digest.daily", "ignored")
+	hub.Publish("content.new", map[string]int{"count": 3})
+
+	ev := stream.next()
+	if ev.event != "event" || ev.msg.Topic != "content.new" || ev.id != "" {
+		t.Errorf("Expected content.new event without id, got %+v", ev)
+	}
+}
+
+func TestSSERejectsInvalidTopic(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?topic=bad..topic", nil)
+	rr := httptest.NewRecorder()
+	sseHandler(newHub(), rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/events?topic=query.3f9a", nil)
+	rr = httptest.NewRecorder()
+	sseHandler(newHub(), rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected a query topic to be refused, got %d", rr.Code)
+	}
+}
+
+func TestSSEResumesFromLastEventID(t *testing.T) {
+	q, _ := newTestOfflineQueue(t, 10)
+	hub := newHub()
+	hub.offline = q
+	go hub.run()
+
+	for _, text := range []string{"first", "second", "third"} {
+		hub.SendToUser("alice", Message{Type: "notification", Data: text})
+	}
+
+	stream := openEvents(t, hub, "alice", "", "1")
+	for _, want := range []struct{ id, data string }{{"2", "second"}, {"3", "third"}} {
+		ev := stream.next()
+		if ev.id != want.id || ev.event != "notification" || ev.msg.Data != want.data {
+			t.Errorf("Expected id %s %q, got %+v", want.id, want.data, ev)
+		}
+	}
+}